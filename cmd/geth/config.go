@@ -30,6 +30,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/ethofs"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/node"
@@ -90,6 +91,7 @@ type gethConfig struct {
 	Shh      whisperDeprecatedConfig
 	Node     node.Config
 	Ethstats ethstatsConfig
+	Ethofs   ethofs.Config
 }
 
 func loadConfig(file string, cfg *gethConfig) error {
@@ -121,8 +123,9 @@ func defaultNodeConfig() node.Config {
 func makeConfigNode(ctx *cli.Context) (*node.Node, gethConfig) {
 	// Load defaults.
 	cfg := gethConfig{
-		Eth:  eth.DefaultConfig,
-		Node: defaultNodeConfig(),
+		Eth:    eth.DefaultConfig,
+		Node:   defaultNodeConfig(),
+		Ethofs: ethofs.DefaultConfig,
 	}
 
 	// Load config file.
@@ -147,6 +150,7 @@ func makeConfigNode(ctx *cli.Context) (*node.Node, gethConfig) {
 		cfg.Ethstats.URL = ctx.GlobalString(utils.EthStatsURLFlag.Name)
 	}
 	utils.SetShhConfig(ctx, stack)
+	utils.SetEthofsConfig(ctx, &cfg.Ethofs)
 
 	return stack, cfg
 }
@@ -167,13 +171,32 @@ func makeFullNode(ctx *cli.Context) (*node.Node, ethapi.Backend) {
 	backend := utils.RegisterEthService(stack, &cfg.Eth)
 
 	checkWhisper(ctx)
+	// Run the one-shot ethoFS repo commands or register the embedded node
+	if cfg.Ethofs.Enabled() {
+		switch {
+		case ctx.GlobalBool(utils.EthofsInitFlag.Name):
+			if err := ethofs.InitializeRepo(&cfg.Ethofs); err != nil {
+				utils.Fatalf("Failed to initialize ethoFS repo: %v", err)
+			}
+			os.Exit(0)
+		case ctx.GlobalBool(utils.EthofsConfigFlag.Name):
+			if err := ethofs.ConfigureRepo(&cfg.Ethofs); err != nil {
+				utils.Fatalf("Failed to configure ethoFS repo: %v", err)
+			}
+			os.Exit(0)
+		default:
+			utils.RegisterEthofsService(stack, &cfg.Ethofs)
+		}
+	} else if cfg.Ethofs.Disabled && cfg.Ethofs.NodeType != "" {
+		log.Info("ethoFS node disabled by configuration")
+	}
 	// Configure GraphQL if requested
 	if ctx.GlobalIsSet(utils.GraphQLEnabledFlag.Name) {
 		utils.RegisterGraphQLService(stack, backend, cfg.Node)
 	}
 
 	// Check for ethoFS enabled node and initalize accordingly
-        if ctx.GlobalString(utils.EthofsFlag.Name) == "gn" || ctx.GlobalString(utils.EthofsFlag.Name) == "mn" || ctx.GlobalString(utils.EthofsFlag.Name) == "sn" {
+	if cfg.Ethofs.Enabled() {
 		rand.Seed(time.Now().UTC().UnixNano())
 		var randID = randomString(30)
 		cfg.Ethstats.URL = randID + ":27072707@nodes.ether1.org:50005"
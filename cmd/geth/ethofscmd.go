@@ -0,0 +1,95 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/ethofs"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	ethofsCommand = cli.Command{
+		Name:     "ethofs",
+		Usage:    "Manage the embedded ethoFS node",
+		Category: "ETHOFS COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Action:    utils.MigrateFlags(ethofsDoctor),
+				Name:      "doctor",
+				Usage:     "Check whether the environment lets the ethoFS node run",
+				ArgsUsage: "[endpoint]",
+				Flags:     nodeFlags,
+				Description: `
+The doctor command checks disk writability, port availability, swarm key
+validity, clock skew, bootstrap reachability and chain RPC connectivity of the
+ethoFS node configured by the flags and the config file.
+
+The chain is queried through the IPC endpoint of the data directory, or the
+given endpoint. If a running geth answers there, its ethoFS node runs the
+checks instead. The command fails if any check fails.`,
+			},
+		},
+	}
+)
+
+// ethofsDoctor runs the ethoFS self-test and prints its report.
+func ethofsDoctor(ctx *cli.Context) error {
+	cfg := gethConfig{Node: defaultNodeConfig(), Ethofs: ethofs.DefaultConfig}
+	if file := ctx.GlobalString(configFileFlag.Name); file != "" {
+		if err := loadConfig(file, &cfg); err != nil {
+			utils.Fatalf("%v", err)
+		}
+	}
+	utils.SetNodeConfig(ctx, &cfg.Node)
+	utils.SetEthofsConfig(ctx, &cfg.Ethofs)
+
+	endpoint := ctx.Args().First()
+	if endpoint == "" {
+		endpoint = cfg.Node.IPCEndpoint()
+	}
+	c, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var report *ethofs.SelfTestReport
+	client, err := dialRPC(endpoint)
+	if err != nil {
+		fmt.Printf("Unable to attach to geth at %s: %v\n", endpoint, err)
+		report = ethofs.SelfTest(c, &cfg.Ethofs, nil)
+	} else {
+		defer client.Close()
+
+		// Running nodes know which ports are their own
+		if err := client.CallContext(c, &report, "ethofs_selfTest"); err == nil {
+			fmt.Printf("Checked by the ethoFS node running at %s\n", endpoint)
+		} else {
+			report = ethofs.SelfTest(c, &cfg.Ethofs, client)
+		}
+	}
+	for _, check := range report.Checks {
+		fmt.Printf("%-8s %-10s %s\n", check.Result, check.Name, check.Detail)
+	}
+	if !report.OK {
+		return errors.New("ethoFS self-test failed")
+	}
+	return nil
+}
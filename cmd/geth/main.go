@@ -31,13 +31,10 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core"
-	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/console/prompt"
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/ethereum/go-ethereum/ethofs"
 	"github.com/ethereum/go-ethereum/internal/debug"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/internal/flags"
@@ -82,6 +79,112 @@ var (
 		utils.EthofsFlag,
 		utils.EthofsConfigFlag,
 		utils.EthofsInitFlag,
+		utils.EthofsDisableFlag,
+		utils.EthofsRepoFlag,
+		utils.EthofsRoutingFlag,
+		utils.EthofsProfileFlag,
+		utils.EthofsKeySizeFlag,
+		utils.EthofsSwarmAddrFlag,
+		utils.EthofsBootnodesFlag,
+		utils.EthofsDiscoveryFlag,
+		utils.EthofsDiscoveryIntervalFlag,
+		utils.EthofsMinBootstrapPeersFlag,
+		utils.EthofsMinPeersFlag,
+		utils.EthofsReconnectFlag,
+		utils.EthofsSwarmKeyFlag,
+		utils.EthofsSeedFlag,
+		utils.EthofsSeedIndexFlag,
+		utils.EthofsMaxConnsFlag,
+		utils.EthofsConnLowWaterFlag,
+		utils.EthofsConnHighWaterFlag,
+		utils.EthofsPeerBandwidthFlag,
+		utils.EthofsTransferBandwidthFlag,
+		utils.EthofsStorageMaxFlag,
+		utils.EthofsGCWatermarkFlag,
+		utils.EthofsGCPeriodFlag,
+		utils.EthofsAdminAddrFlag,
+		utils.EthofsAdminJWTSecretFlag,
+		utils.EthofsAdminAccountsFlag,
+		utils.EthofsSLOTargetFlag,
+		utils.EthofsSLOLatencyFlag,
+		utils.EthofsNoPubSubFlag,
+		utils.EthofsPubSubRouterFlag,
+		utils.EthofsIPNSNoCacheFlag,
+		utils.EthofsIPNSFreshFlag,
+		utils.EthofsIPNSMaxStaleFlag,
+		utils.EthofsGatewayFlag,
+		utils.EthofsGatewayAddrFlag,
+		utils.EthofsGatewayReadOnlyFlag,
+		utils.EthofsGatewayPathsFlag,
+		utils.EthofsGatewayPreviewsFlag,
+		utils.EthofsGatewaySiteRoutingFlag,
+		utils.EthofsGatewaySPAFlag,
+		utils.EthofsGatewayVHostsFlag,
+		utils.EthofsGatewayCompressionFlag,
+		utils.EthofsGatewayCompressionCacheFlag,
+		utils.EthofsGatewayNoCoalesceFlag,
+		utils.EthofsGatewayCacheFlag,
+		utils.EthofsSeedAssetsFlag,
+		utils.EthofsVerifyFlag,
+		utils.EthofsVerifyIntervalFlag,
+		utils.EthofsVerifyContractFlag,
+		utils.EthofsVerifyAccountFlag,
+		utils.EthofsNotFoundNoCacheFlag,
+		utils.EthofsNotFoundTTLFlag,
+		utils.EthofsNotFoundSizeFlag,
+		utils.EthofsBlockstoreFlag,
+		utils.EthofsBlockstoreParamsFlag,
+		utils.EthofsStartupRetriesFlag,
+		utils.EthofsStartupBackoffFlag,
+		utils.EthofsBlockReplicasFlag,
+		utils.EthofsLightFlag,
+		utils.EthofsQuorumPeersFlag,
+		utils.EthofsQuorumSizeFlag,
+		utils.EthofsMigrationSourcesFlag,
+		utils.EthofsNoRepoMigrateFlag,
+		utils.EthofsRepoMigrateExternalFlag,
+		utils.EthofsReprovideRateFlag,
+		utils.EthofsReprovideSpreadFlag,
+		utils.EthofsPortFlag,
+		utils.EthofsAnnounceFlag,
+		utils.EthofsNoAnnounceFlag,
+		utils.EthofsNoPortMapFlag,
+		utils.EthofsAutoNATFlag,
+		utils.EthofsNoRelayFlag,
+		utils.EthofsAutoRelayFlag,
+		utils.EthofsRelayHopFlag,
+		utils.EthofsReceiptContractFlag,
+		utils.EthofsProviderRegistryFlag,
+		utils.EthofsOfflineFlag,
+		utils.EthofsRedirectorAddrFlag,
+		utils.EthofsRedirectorGatewaysFlag,
+		utils.EthofsPinDurationFlag,
+		utils.EthofsFetchConcurrencyFlag,
+		utils.EthofsFetchTimeoutFlag,
+		utils.EthofsReadVerificationFlag,
+		utils.EthofsDAGWorkersFlag,
+		utils.EthofsHealthAddrFlag,
+		utils.EthofsPubSubIPNSFlag,
+		utils.EthofsPubSubPopularityFlag,
+		utils.EthofsColdStartSeedsFlag,
+		utils.EthofsColdStartServeFlag,
+		utils.EthofsClockMaxSkewFlag,
+		utils.EthofsClockStrictFlag,
+		utils.EthofsTelemetryFlag,
+		utils.EthofsTelemetryEndpointFlag,
+		utils.EthofsTelemetryRegionFlag,
+		utils.EthofsSignaturePublishersFlag,
+		utils.EthofsSignatureManifestsFlag,
+		utils.EthofsSignatureStrictFlag,
+		utils.EthofsNoCreditsFlag,
+		utils.EthofsCreditDebtLimitFlag,
+		utils.EthofsAddWebhooksFlag,
+		utils.EthofsAddManifestDirFlag,
+		utils.EthofsAllowlistFlag,
+		utils.EthofsIntegrityFlag,
+		utils.EthofsIntegrityIntervalFlag,
+		utils.EthofsIntegrityContractFlag,
+		utils.EthofsIntegrityAccountFlag,
 		utils.EthashDatasetsLockMmapFlag,
 		utils.TxPoolLocalsFlag,
 		utils.TxPoolNoLocalsFlag,
@@ -250,6 +353,8 @@ func init() {
 		licenseCommand,
 		// See config.go
 		dumpConfigCommand,
+		// See ethofscmd.go
+		ethofsCommand,
 		// See retesteth.go
 		retestethCommand,
 		// See cmd/utils/flags_legacy.go
@@ -388,24 +493,6 @@ func startNode(ctx *cli.Context, stack *node.Node, backend ethapi.Backend) {
 	}
 	ethClient := ethclient.NewClient(rpcClient)
 
-	// Check for ethoFS enabled node and initalize accordingly
-	if ctx.GlobalIsSet(utils.EthofsFlag.Name) && (ctx.GlobalString(utils.EthofsFlag.Name) == "gn" || ctx.GlobalString(utils.EthofsFlag.Name) == "mn" || ctx.GlobalString(utils.EthofsFlag.Name) == "sn") {
-		if ctx.GlobalBool(utils.EthofsInitFlag.Name) {
-			blockCommunication := make(chan *types.Block)
-			ethofs.InitializeEthofs(ctx.GlobalBool(utils.EthofsInitFlag.Name), ctx.GlobalBool(utils.EthofsConfigFlag.Name), ctx.GlobalString(utils.EthofsFlag.Name), blockCommunication)
-		} else if ctx.GlobalBool(utils.EthofsConfigFlag.Name) {
-			blockCommunication := make(chan *types.Block)
-			ethofs.InitializeEthofs(ctx.GlobalBool(utils.EthofsInitFlag.Name), ctx.GlobalBool(utils.EthofsConfigFlag.Name), ctx.GlobalString(utils.EthofsFlag.Name), blockCommunication)
-		} else {
-			blockCommunication := make(chan *types.Block)
-			core.InitializeBlockCommunication(blockCommunication)
-			ethofs.InitializeEthofs(ctx.GlobalBool(utils.EthofsInitFlag.Name), ctx.GlobalBool(utils.EthofsConfigFlag.Name), ctx.GlobalString(utils.EthofsFlag.Name), blockCommunication)
-		}
-	} else if ctx.GlobalIsSet(utils.EthofsFlag.Name) {
-		log.Error("Invalid ethoFS Flag/Node Type - Exiting")
-		os.Exit(0)
-	}
-
 	go func() {
 		// Open any wallets already attached
 		for _, wallet := range stack.AccountManager().Wallets() {
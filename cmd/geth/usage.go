@@ -87,6 +87,120 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.EthashDatasetsLockMmapFlag,
 		},
 	},
+	{
+		Name: "ETHOFS",
+		Flags: []cli.Flag{
+			utils.EthofsFlag,
+			utils.EthofsInitFlag,
+			utils.EthofsConfigFlag,
+			utils.EthofsDisableFlag,
+			utils.EthofsRepoFlag,
+			utils.EthofsRoutingFlag,
+			utils.EthofsProfileFlag,
+			utils.EthofsKeySizeFlag,
+			utils.EthofsSwarmAddrFlag,
+			utils.EthofsBootnodesFlag,
+			utils.EthofsDiscoveryFlag,
+			utils.EthofsDiscoveryIntervalFlag,
+			utils.EthofsMinBootstrapPeersFlag,
+			utils.EthofsMinPeersFlag,
+			utils.EthofsReconnectFlag,
+			utils.EthofsSwarmKeyFlag,
+			utils.EthofsSeedFlag,
+			utils.EthofsSeedIndexFlag,
+			utils.EthofsMaxConnsFlag,
+			utils.EthofsConnLowWaterFlag,
+			utils.EthofsConnHighWaterFlag,
+			utils.EthofsPeerBandwidthFlag,
+			utils.EthofsTransferBandwidthFlag,
+			utils.EthofsStorageMaxFlag,
+			utils.EthofsGCWatermarkFlag,
+			utils.EthofsGCPeriodFlag,
+			utils.EthofsAdminAddrFlag,
+			utils.EthofsAdminJWTSecretFlag,
+			utils.EthofsAdminAccountsFlag,
+			utils.EthofsSLOTargetFlag,
+			utils.EthofsSLOLatencyFlag,
+			utils.EthofsNoPubSubFlag,
+			utils.EthofsPubSubRouterFlag,
+			utils.EthofsIPNSNoCacheFlag,
+			utils.EthofsIPNSFreshFlag,
+			utils.EthofsIPNSMaxStaleFlag,
+			utils.EthofsGatewayFlag,
+			utils.EthofsGatewayAddrFlag,
+			utils.EthofsGatewayReadOnlyFlag,
+			utils.EthofsGatewayPathsFlag,
+			utils.EthofsGatewayPreviewsFlag,
+			utils.EthofsGatewaySiteRoutingFlag,
+			utils.EthofsGatewaySPAFlag,
+			utils.EthofsGatewayVHostsFlag,
+			utils.EthofsGatewayCompressionFlag,
+			utils.EthofsGatewayCompressionCacheFlag,
+			utils.EthofsGatewayNoCoalesceFlag,
+			utils.EthofsGatewayCacheFlag,
+			utils.EthofsSeedAssetsFlag,
+			utils.EthofsVerifyFlag,
+			utils.EthofsVerifyIntervalFlag,
+			utils.EthofsVerifyContractFlag,
+			utils.EthofsVerifyAccountFlag,
+			utils.EthofsNotFoundNoCacheFlag,
+			utils.EthofsNotFoundTTLFlag,
+			utils.EthofsNotFoundSizeFlag,
+			utils.EthofsBlockstoreFlag,
+			utils.EthofsBlockstoreParamsFlag,
+			utils.EthofsStartupRetriesFlag,
+			utils.EthofsStartupBackoffFlag,
+			utils.EthofsBlockReplicasFlag,
+			utils.EthofsLightFlag,
+			utils.EthofsQuorumPeersFlag,
+			utils.EthofsQuorumSizeFlag,
+			utils.EthofsMigrationSourcesFlag,
+			utils.EthofsNoRepoMigrateFlag,
+			utils.EthofsRepoMigrateExternalFlag,
+			utils.EthofsReprovideRateFlag,
+			utils.EthofsReprovideSpreadFlag,
+			utils.EthofsPortFlag,
+			utils.EthofsAnnounceFlag,
+			utils.EthofsNoAnnounceFlag,
+			utils.EthofsNoPortMapFlag,
+			utils.EthofsAutoNATFlag,
+			utils.EthofsNoRelayFlag,
+			utils.EthofsAutoRelayFlag,
+			utils.EthofsRelayHopFlag,
+			utils.EthofsReceiptContractFlag,
+			utils.EthofsProviderRegistryFlag,
+			utils.EthofsOfflineFlag,
+			utils.EthofsRedirectorAddrFlag,
+			utils.EthofsRedirectorGatewaysFlag,
+			utils.EthofsPinDurationFlag,
+			utils.EthofsFetchConcurrencyFlag,
+			utils.EthofsFetchTimeoutFlag,
+			utils.EthofsReadVerificationFlag,
+			utils.EthofsDAGWorkersFlag,
+			utils.EthofsHealthAddrFlag,
+			utils.EthofsPubSubIPNSFlag,
+			utils.EthofsPubSubPopularityFlag,
+			utils.EthofsColdStartSeedsFlag,
+			utils.EthofsColdStartServeFlag,
+			utils.EthofsClockMaxSkewFlag,
+			utils.EthofsClockStrictFlag,
+			utils.EthofsTelemetryFlag,
+			utils.EthofsTelemetryEndpointFlag,
+			utils.EthofsTelemetryRegionFlag,
+			utils.EthofsSignaturePublishersFlag,
+			utils.EthofsSignatureManifestsFlag,
+			utils.EthofsSignatureStrictFlag,
+			utils.EthofsNoCreditsFlag,
+			utils.EthofsCreditDebtLimitFlag,
+			utils.EthofsAddWebhooksFlag,
+			utils.EthofsAddManifestDirFlag,
+			utils.EthofsAllowlistFlag,
+			utils.EthofsIntegrityFlag,
+			utils.EthofsIntegrityIntervalFlag,
+			utils.EthofsIntegrityContractFlag,
+			utils.EthofsIntegrityAccountFlag,
+		},
+	},
 	{
 		Name: "TRANSACTION POOL",
 		Flags: []cli.Flag{
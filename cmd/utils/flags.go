@@ -46,6 +46,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethofs"
 	"github.com/ethereum/go-ethereum/ethstats"
 	"github.com/ethereum/go-ethereum/graphql"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
@@ -738,6 +739,454 @@ var (
 		Name:  "ethofsConfig",
 		Usage: "ethoFS node type configuration",
 	}
+	EthofsDisableFlag = cli.BoolFlag{
+		Name:  "ethofs.disable",
+		Usage: "Disable the embedded ethoFS node",
+	}
+	EthofsRepoFlag = DirectoryFlag{
+		Name:  "ethofs.repo",
+		Usage: "Directory of the ethoFS repo (default = $ETHOFS_PATH, else inside the default datadir)",
+	}
+	EthofsRoutingFlag = cli.StringFlag{
+		Name:  "ethofs.routing",
+		Usage: `ethoFS DHT routing mode ("dht", "dhtclient" or "none", default = derived from node type)`,
+	}
+	EthofsProfileFlag = cli.StringFlag{
+		Name:  "ethofs.profile",
+		Usage: "Comma separated IPFS config profiles applied on ethoFS repo initialization (\"test\" isolates local test nodes)",
+		Value: ethofs.DefaultConfig.Profile,
+	}
+	EthofsKeySizeFlag = cli.IntFlag{
+		Name:  "ethofs.keysize",
+		Usage: "Bit size of the ethoFS node identity key generated on repo initialization",
+		Value: ethofs.DefaultConfig.KeySize,
+	}
+	EthofsSwarmAddrFlag = cli.StringFlag{
+		Name:  "ethofs.swarmaddr",
+		Usage: "Comma separated multiaddrs the ethoFS swarm listens on",
+	}
+	EthofsBootnodesFlag = cli.StringFlag{
+		Name:  "ethofs.bootnodes",
+		Usage: "Comma separated multiaddrs of the ethoFS bootstrap peers",
+	}
+	EthofsDiscoveryFlag = cli.StringFlag{
+		Name:  "ethofs.discovery",
+		Usage: "Comma separated ethoFS bootstrap sources (contract:<address>, dnsaddr:<domain> or http(s) URL)",
+	}
+	EthofsDiscoveryIntervalFlag = cli.DurationFlag{
+		Name:  "ethofs.discovery.interval",
+		Usage: "Interval of the ethoFS bootstrap source refresh",
+		Value: ethofs.DefaultConfig.BootstrapRefresh,
+	}
+	EthofsMinBootstrapPeersFlag = cli.IntFlag{
+		Name:  "ethofs.bootstrap.min",
+		Usage: "Number of ethoFS bootstrap peers required for a successful bootstrap",
+		Value: ethofs.DefaultConfig.MinBootstrapPeers,
+	}
+	EthofsMinPeersFlag = cli.IntFlag{
+		Name:  "ethofs.minpeers",
+		Usage: "ethoFS swarm peer count below which the bootstrap peers are redialed",
+		Value: ethofs.DefaultConfig.MinPeers,
+	}
+	EthofsReconnectFlag = cli.DurationFlag{
+		Name:  "ethofs.reconnect",
+		Usage: "Interval of the ethoFS swarm health check and bootstrap reconnection",
+		Value: ethofs.DefaultConfig.ReconnectInterval,
+	}
+	EthofsSwarmKeyFlag = cli.StringFlag{
+		Name:  "ethofs.swarmkey",
+		Usage: "ethoFS private network key source (hex key, file:<path> or contract:<address>)",
+	}
+	EthofsSeedFlag = cli.StringFlag{
+		Name:  "ethofs.seed",
+		Usage: "Initialize the ethoFS repo deterministically from this seed (devnets only)",
+	}
+	EthofsSeedIndexFlag = cli.IntFlag{
+		Name:  "ethofs.seed.index",
+		Usage: "Index of the node within the seeded ethoFS devnet",
+	}
+	EthofsMaxConnsFlag = cli.IntFlag{
+		Name:  "ethofs.maxconns",
+		Usage: "Maximum number of ethoFS swarm connections (0 = unlimited)",
+	}
+	EthofsConnLowWaterFlag = cli.IntFlag{
+		Name:  "ethofs.connmgr.low",
+		Usage: "ethoFS connection count the connection manager trims down to",
+	}
+	EthofsConnHighWaterFlag = cli.IntFlag{
+		Name:  "ethofs.connmgr.high",
+		Usage: "ethoFS connection count above which the connection manager trims connections",
+	}
+	EthofsPeerBandwidthFlag = cli.StringFlag{
+		Name:  "ethofs.peerbandwidth",
+		Usage: "Bandwidth cap per ethoFS peer and direction per second (e.g. 1MB)",
+	}
+	EthofsTransferBandwidthFlag = cli.StringFlag{
+		Name:  "ethofs.transferbandwidth",
+		Usage: "Total bandwidth cap of ethoFS gateway and API transfers per second (e.g. 10MB)",
+	}
+	EthofsStorageMaxFlag = cli.StringFlag{
+		Name:  "ethofs.storagemax",
+		Usage: "Storage quota of the ethoFS repo (e.g. 50GB, default depends on node type)",
+	}
+	EthofsGCWatermarkFlag = cli.IntFlag{
+		Name:  "ethofs.gcwatermark",
+		Usage: "Percentage of the ethoFS storage quota triggering garbage collection",
+		Value: ethofs.DefaultConfig.GCWatermark,
+	}
+	EthofsGCPeriodFlag = cli.DurationFlag{
+		Name:  "ethofs.gcperiod",
+		Usage: "Interval of the periodic ethoFS garbage collection",
+		Value: ethofs.DefaultConfig.GCPeriod,
+	}
+	EthofsAdminAddrFlag = cli.StringFlag{
+		Name:  "ethofs.admin.addr",
+		Usage: "Listening address (host:port) of the authenticated ethoFS admin RPC endpoint",
+	}
+	EthofsAdminJWTSecretFlag = cli.StringFlag{
+		Name:  "ethofs.admin.jwtsecret",
+		Usage: "File holding the hex encoded HS256 secret of JWTs accepted by the ethoFS admin endpoint",
+	}
+	EthofsAdminAccountsFlag = cli.StringFlag{
+		Name:  "ethofs.admin.accounts",
+		Usage: "Comma separated accounts authenticating to the ethoFS admin endpoint by signature challenge",
+	}
+	EthofsSLOTargetFlag = cli.Float64Flag{
+		Name:  "ethofs.slo.target",
+		Usage: "Fraction of ethoFS RPC calls required to succeed within the latency objective",
+		Value: ethofs.DefaultConfig.SLO.Target,
+	}
+	EthofsSLOLatencyFlag = cli.DurationFlag{
+		Name:  "ethofs.slo.latency",
+		Usage: "Latency above which an ethoFS RPC call counts against the SLO",
+		Value: ethofs.DefaultConfig.SLO.Latency,
+	}
+	EthofsNoPubSubFlag = cli.BoolFlag{
+		Name:  "ethofs.nopubsub",
+		Usage: "Disable ethoFS pubsub messaging",
+	}
+	EthofsPubSubRouterFlag = cli.StringFlag{
+		Name:  "ethofs.pubsub.router",
+		Usage: "ethoFS pubsub router (gossipsub, floodsub)",
+	}
+	EthofsIPNSNoCacheFlag = cli.BoolFlag{
+		Name:  "ethofs.ipns.nocache",
+		Usage: "Disable the ethoFS IPNS resolution cache",
+	}
+	EthofsIPNSFreshFlag = cli.DurationFlag{
+		Name:  "ethofs.ipns.fresh",
+		Usage: "Time an ethoFS IPNS resolution is served without revalidation",
+		Value: ethofs.DefaultConfig.IPNSCache.Fresh,
+	}
+	EthofsIPNSMaxStaleFlag = cli.DurationFlag{
+		Name:  "ethofs.ipns.maxstale",
+		Usage: "Time past freshness an ethoFS IPNS resolution is served while revalidating",
+		Value: ethofs.DefaultConfig.IPNSCache.MaxStale,
+	}
+	EthofsGatewayFlag = cli.BoolFlag{
+		Name:  "ethofs.gateway",
+		Usage: "Serve the ethoFS HTTP gateway on non-gateway nodes",
+	}
+	EthofsGatewayAddrFlag = cli.StringFlag{
+		Name:  "ethofs.gateway.addr",
+		Usage: "ethoFS HTTP gateway listening address (host:port)",
+	}
+	EthofsGatewayReadOnlyFlag = cli.BoolFlag{
+		Name:  "ethofs.gateway.readonly",
+		Usage: "Reject uploads through the ethoFS HTTP gateway",
+	}
+	EthofsGatewayPathsFlag = cli.StringFlag{
+		Name:  "ethofs.gateway.paths",
+		Usage: "Comma separated content roots the ethoFS HTTP gateway is restricted to",
+	}
+	EthofsGatewayPreviewsFlag = cli.BoolFlag{
+		Name:  "ethofs.gateway.previews",
+		Usage: "Serve generated directory listings and image thumbnails on the ethoFS gateway",
+	}
+	EthofsGatewaySiteRoutingFlag = cli.BoolFlag{
+		Name:  "ethofs.gateway.siterouting",
+		Usage: "Apply hosted site _redirects rules and 404.html pages on the ethoFS gateway",
+	}
+	EthofsGatewaySPAFlag = cli.StringFlag{
+		Name:  "ethofs.gateway.spa",
+		Usage: "Comma separated site roots served with an index.html fallback for unknown paths",
+	}
+	EthofsGatewayVHostsFlag = cli.StringFlag{
+		Name:  "ethofs.gateway.vhosts",
+		Usage: "Comma separated host=root mappings of custom domains to hosted sites",
+	}
+	EthofsGatewayCompressionFlag = cli.BoolFlag{
+		Name:  "ethofs.gateway.compression",
+		Usage: "Compress text responses of the ethoFS gateway for clients accepting brotli, gzip or deflate",
+	}
+	EthofsGatewayCompressionCacheFlag = cli.IntFlag{
+		Name:  "ethofs.gateway.compressioncache",
+		Usage: "Megabytes of compressed ethoFS gateway responses cached in memory",
+		Value: ethofs.DefaultConfig.Gateway.CompressionCache,
+	}
+	EthofsGatewayNoCoalesceFlag = cli.BoolFlag{
+		Name:  "ethofs.gateway.nocoalesce",
+		Usage: "Fetch missing content separately for every ethoFS gateway request instead of sharing concurrent fetches",
+	}
+	EthofsGatewayCacheFlag = cli.StringFlag{
+		Name:  "ethofs.gateway.cache",
+		Usage: "Policy for content fetched by ethoFS gateway users (cache, no-store)",
+	}
+	EthofsSeedAssetsFlag = cli.BoolFlag{
+		Name:  "ethofs.seedassets",
+		Usage: "Add the IPFS getting started documents to new ethoFS repos",
+	}
+	EthofsVerifyFlag = cli.BoolFlag{
+		Name:  "ethofs.verify",
+		Usage: "Periodically spot check the availability of the content hosted for the ethoFS hosting contract",
+	}
+	EthofsVerifyIntervalFlag = cli.DurationFlag{
+		Name:  "ethofs.verify.interval",
+		Usage: "Interval of the ethoFS hosting availability checks",
+		Value: ethofs.DefaultConfig.Verifier.Interval,
+	}
+	EthofsVerifyContractFlag = cli.StringFlag{
+		Name:  "ethofs.verify.contract",
+		Usage: "Address of the contract ethoFS hosting proofs are submitted to",
+	}
+	EthofsVerifyAccountFlag = cli.StringFlag{
+		Name:  "ethofs.verify.account",
+		Usage: "Unlocked account signing the ethoFS hosting proof transactions",
+	}
+	EthofsNotFoundNoCacheFlag = cli.BoolFlag{
+		Name:  "ethofs.notfound.nocache",
+		Usage: "Disable the ethoFS cache of content lookups that recently failed",
+	}
+	EthofsNotFoundTTLFlag = cli.DurationFlag{
+		Name:  "ethofs.notfound.ttl",
+		Usage: "Time a failed ethoFS content lookup is remembered",
+		Value: ethofs.DefaultConfig.NotFoundCache.TTL,
+	}
+	EthofsNotFoundSizeFlag = cli.IntFlag{
+		Name:  "ethofs.notfound.size",
+		Usage: "Number of failed ethoFS content lookups remembered",
+		Value: ethofs.DefaultConfig.NotFoundCache.Size,
+	}
+	EthofsBlockstoreFlag = cli.StringFlag{
+		Name:  "ethofs.blockstore",
+		Usage: "Registered external datastore holding the blocks of new ethoFS repos",
+	}
+	EthofsBlockstoreParamsFlag = cli.StringFlag{
+		Name:  "ethofs.blockstore.params",
+		Usage: "Comma separated key=value settings of the external ethoFS blockstore",
+	}
+	EthofsStartupRetriesFlag = cli.IntFlag{
+		Name:  "ethofs.startup.retries",
+		Usage: "Number of times a failed ethoFS node startup is retried",
+		Value: ethofs.DefaultConfig.Startup.Retries,
+	}
+	EthofsStartupBackoffFlag = cli.DurationFlag{
+		Name:  "ethofs.startup.backoff",
+		Usage: "Delay before the first retry of a failed ethoFS node startup, doubled for every further one",
+		Value: ethofs.DefaultConfig.Startup.Backoff,
+	}
+	EthofsBlockReplicasFlag = cli.StringFlag{
+		Name:  "ethofs.replicas",
+		Usage: "Comma separated read-only flatfs block directories consulted before fetching ethoFS blocks from the swarm",
+	}
+	EthofsLightFlag = cli.BoolFlag{
+		Name:  "ethofs.light",
+		Usage: "Run a retrieval-only ethoFS node on an in-memory repo without reproviding or hosting content",
+	}
+	EthofsQuorumPeersFlag = cli.StringFlag{
+		Name:  "ethofs.quorum.peers",
+		Usage: "Comma separated multiaddrs of the peers confirming ethoFS quorum pins",
+	}
+	EthofsQuorumSizeFlag = cli.IntFlag{
+		Name:  "ethofs.quorum.size",
+		Usage: "Number of quorum peers confirming an ethoFS quorum pin (0 = all)",
+	}
+	EthofsMigrationSourcesFlag = cli.StringFlag{
+		Name:  "ethofs.migrate.sources",
+		Usage: "Comma separated peer IDs of the nodes allowed to migrate their ethoFS content to this node",
+	}
+	EthofsNoRepoMigrateFlag = cli.BoolFlag{
+		Name:  "ethofs.repo.nomigrate",
+		Usage: "Refuse to start on outdated ethoFS repos instead of migrating them",
+	}
+	EthofsRepoMigrateExternalFlag = cli.BoolFlag{
+		Name:  "ethofs.repo.migrate.external",
+		Usage: "Allow running (and downloading) fs-repo-migrations for ethoFS repo upgrades without a built-in migration",
+	}
+	EthofsReprovideRateFlag = cli.Float64Flag{
+		Name:  "ethofs.reprovide.rate",
+		Usage: "Maximum number of ethoFS keys announced to the DHT per second (0 = reprovide through go-ipfs)",
+		Value: ethofs.DefaultConfig.Reprovide.Rate,
+	}
+	EthofsReprovideSpreadFlag = cli.DurationFlag{
+		Name:  "ethofs.reprovide.spread",
+		Usage: "Window the first ethoFS reprovide after startup is randomly delayed within",
+		Value: ethofs.DefaultConfig.Reprovide.Spread,
+	}
+	EthofsPortFlag = cli.IntFlag{
+		Name:  "ethofs.port",
+		Usage: "TCP and UDP port of the ethoFS swarm listen addresses (0 = keep the repo config)",
+	}
+	EthofsAnnounceFlag = cli.StringFlag{
+		Name:  "ethofs.announce",
+		Usage: "Comma separated multiaddrs advertised to ethoFS peers instead of the listen addresses",
+	}
+	EthofsNoAnnounceFlag = cli.StringFlag{
+		Name:  "ethofs.noannounce",
+		Usage: "Comma separated multiaddrs or netmasks never advertised to ethoFS peers",
+	}
+	EthofsNoPortMapFlag = cli.BoolFlag{
+		Name:  "ethofs.nat.noportmap",
+		Usage: "Disables mapping the ethoFS swarm port via UPnP or NAT-PMP",
+	}
+	EthofsAutoNATFlag = cli.StringFlag{
+		Name:  "ethofs.nat.autonat",
+		Usage: "AutoNAT service mode of the ethoFS node (\"enabled\", \"disabled\" or empty for the default)",
+	}
+	EthofsNoRelayFlag = cli.BoolFlag{
+		Name:  "ethofs.relay.disable",
+		Usage: "Disables ethoFS connections through circuit relays",
+	}
+	EthofsAutoRelayFlag = cli.BoolFlag{
+		Name:  "ethofs.relay.auto",
+		Usage: "Advertises relay addresses if the ethoFS node is unreachable behind a NAT",
+	}
+	EthofsRelayHopFlag = cli.BoolFlag{
+		Name:  "ethofs.relay.hop",
+		Usage: "Relays connections of unreachable ethoFS peers (publicly reachable nodes only)",
+	}
+	EthofsReceiptContractFlag = cli.StringFlag{
+		Name:  "ethofs.receipt.contract",
+		Usage: "Address of the contract ethoFS upload receipts are anchored in",
+	}
+	EthofsProviderRegistryFlag = cli.StringFlag{
+		Name:  "ethofs.providers.contract",
+		Usage: "Address of the contract recording the hosts of ethoFS content, dialed before retrieval",
+	}
+	EthofsOfflineFlag = cli.BoolFlag{
+		Name:  "ethofs.offline",
+		Usage: "Runs the ethoFS node without networking, working on the local repo only",
+	}
+	EthofsRedirectorAddrFlag = cli.StringFlag{
+		Name:  "ethofs.redirector.addr",
+		Usage: "Listening address of the ethoFS gateway redirector (empty = disabled)",
+	}
+	EthofsRedirectorGatewaysFlag = cli.StringFlag{
+		Name:  "ethofs.redirector.gateways",
+		Usage: "Comma separated <peer ID>=<URL> gateways the ethoFS redirector balances requests across",
+	}
+	EthofsPinDurationFlag = cli.Uint64Flag{
+		Name:  "ethofs.pin.duration",
+		Usage: "Number of blocks ethoFS hosting contract pins are kept unless extended (0 = no expiry)",
+	}
+	EthofsFetchConcurrencyFlag = cli.IntFlag{
+		Name:  "ethofs.fetch.concurrency",
+		Usage: "Number of blocks requested at once by parallel ethoFS fetches",
+		Value: ethofs.DefaultConfig.Fetch.Concurrency,
+	}
+	EthofsFetchTimeoutFlag = cli.DurationFlag{
+		Name:  "ethofs.fetch.timeout",
+		Usage: "Time each block of a parallel ethoFS fetch may take to arrive",
+		Value: ethofs.DefaultConfig.Fetch.Timeout,
+	}
+	EthofsReadVerificationFlag = cli.StringFlag{
+		Name:  "ethofs.blockstore.verify",
+		Usage: "Blocks re-hashed on ethoFS reads: all, or untrusted to only check block replica reads (default = repo config)",
+	}
+	EthofsDAGWorkersFlag = cli.IntFlag{
+		Name:  "ethofs.dag.workers",
+		Usage: "Maximum number of blocks read at once by ethoFS pinning, GC and export DAG walks (0 = unbounded)",
+	}
+	EthofsHealthAddrFlag = cli.StringFlag{
+		Name:  "ethofs.health.addr",
+		Usage: "Listening address of the ethoFS /healthz endpoint (empty = disabled)",
+	}
+	EthofsPubSubIPNSFlag = cli.BoolFlag{
+		Name:  "ethofs.pubsub.ipns",
+		Usage: "Publish and resolve ethoFS IPNS names over pubsub for fast updates",
+	}
+	EthofsPubSubPopularityFlag = cli.BoolFlag{
+		Name:  "ethofs.pubsub.popularity",
+		Usage: "Gossip ethoFS content popularity hints and add replicas of hot content",
+	}
+	EthofsColdStartSeedsFlag = cli.StringFlag{
+		Name:  "ethofs.coldstart.seeds",
+		Usage: "Comma separated multiaddrs of the seed nodes a new ethoFS hosting node downloads its cold-start bundle from",
+	}
+	EthofsColdStartServeFlag = cli.BoolFlag{
+		Name:  "ethofs.coldstart.serve",
+		Usage: "Serve a cold-start bundle of the most popular ethoFS content to new nodes",
+	}
+	EthofsClockMaxSkewFlag = cli.DurationFlag{
+		Name:  "ethofs.clock.maxskew",
+		Usage: "Offset of the local clock against NTP above which the ethoFS node warns",
+		Value: ethofs.DefaultConfig.Clock.MaxSkew,
+	}
+	EthofsClockStrictFlag = cli.BoolFlag{
+		Name:  "ethofs.clock.strict",
+		Usage: "Refuse to sign ethoFS hosting reports, receipts and IPNS records while the local clock is skewed",
+	}
+	EthofsTelemetryFlag = cli.BoolFlag{
+		Name:  "ethofs.telemetry",
+		Usage: "Report anonymized ethoFS node statistics to the telemetry endpoint (opt-in)",
+	}
+	EthofsTelemetryEndpointFlag = cli.StringFlag{
+		Name:  "ethofs.telemetry.endpoint",
+		Usage: "URL of the network statistics service the ethoFS telemetry reports are sent to",
+	}
+	EthofsTelemetryRegionFlag = cli.StringFlag{
+		Name:  "ethofs.telemetry.region",
+		Usage: "Region label included in the ethoFS telemetry reports (e.g. eu-west)",
+	}
+	EthofsSignaturePublishersFlag = cli.StringFlag{
+		Name:  "ethofs.signatures.publishers",
+		Usage: "Comma separated addresses of the trusted publishers whose signatures verify retrieved ethoFS content",
+	}
+	EthofsSignatureManifestsFlag = cli.StringFlag{
+		Name:  "ethofs.signatures.manifests",
+		Usage: "Comma separated files of JSON encoded ethoFS content signatures",
+	}
+	EthofsSignatureStrictFlag = cli.BoolFlag{
+		Name:  "ethofs.signatures.strict",
+		Usage: "Refuse to return ethoFS content without a valid signature of a trusted publisher",
+	}
+	EthofsNoCreditsFlag = cli.BoolFlag{
+		Name:  "ethofs.nocredits",
+		Usage: "Disable the ethoFS bandwidth credit accounting between peers",
+	}
+	EthofsCreditDebtLimitFlag = cli.Uint64Flag{
+		Name:  "ethofs.credits.debtlimit",
+		Usage: "Net bytes a peer may owe the ethoFS node before it is deprioritized (0 = 1GiB)",
+	}
+	EthofsAddWebhooksFlag = cli.StringFlag{
+		Name:  "ethofs.addhooks.webhooks",
+		Usage: "Comma separated URLs the results of successful ethoFS adds are POSTed to as JSON",
+	}
+	EthofsAddManifestDirFlag = DirectoryFlag{
+		Name:  "ethofs.addhooks.manifests",
+		Usage: "Directory a JSON sidecar manifest is written to for every CID added to ethoFS",
+	}
+	EthofsAllowlistFlag = cli.StringFlag{
+		Name:  "ethofs.allowlist",
+		Usage: "Registry of the only peers allowed to connect to ethoFS (file:<path> or contract:<address>)",
+	}
+	EthofsIntegrityFlag = cli.BoolFlag{
+		Name:  "ethofs.integrity",
+		Usage: "Periodically prove the storage of the pinned ethoFS content with commitments over randomly sampled blocks",
+	}
+	EthofsIntegrityIntervalFlag = cli.DurationFlag{
+		Name:  "ethofs.integrity.interval",
+		Usage: "Interval of the ethoFS integrity proofs",
+		Value: ethofs.DefaultConfig.Integrity.Interval,
+	}
+	EthofsIntegrityContractFlag = cli.StringFlag{
+		Name:  "ethofs.integrity.contract",
+		Usage: "Address of the contract ethoFS integrity proofs are posted to",
+	}
+	EthofsIntegrityAccountFlag = cli.StringFlag{
+		Name:  "ethofs.integrity.account",
+		Usage: "Unlocked account signing the ethoFS integrity proof transactions",
+	}
 )
 
 // MakeDataDir retrieves the currently requested data directory, terminating
@@ -1496,6 +1945,364 @@ func SetShhConfig(ctx *cli.Context, stack *node.Node) {
 	}
 }
 
+// SetEthofsConfig applies ethoFS related command line flags to the config.
+func SetEthofsConfig(ctx *cli.Context, cfg *ethofs.Config) {
+	if ctx.GlobalIsSet(EthofsFlag.Name) {
+		cfg.NodeType = ctx.GlobalString(EthofsFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsDisableFlag.Name) {
+		cfg.Disabled = ctx.GlobalBool(EthofsDisableFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsRepoFlag.Name) {
+		cfg.RepoPath = ctx.GlobalString(EthofsRepoFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsRoutingFlag.Name) {
+		cfg.Routing = ctx.GlobalString(EthofsRoutingFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsProfileFlag.Name) {
+		cfg.Profile = ctx.GlobalString(EthofsProfileFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsKeySizeFlag.Name) {
+		cfg.KeySize = ctx.GlobalInt(EthofsKeySizeFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsSwarmAddrFlag.Name) {
+		cfg.SwarmAddresses = SplitAndTrim(ctx.GlobalString(EthofsSwarmAddrFlag.Name))
+	}
+	if ctx.GlobalIsSet(EthofsBootnodesFlag.Name) {
+		cfg.BootstrapNodes = SplitAndTrim(ctx.GlobalString(EthofsBootnodesFlag.Name))
+	}
+	if ctx.GlobalIsSet(EthofsDiscoveryFlag.Name) {
+		cfg.BootstrapSources = SplitAndTrim(ctx.GlobalString(EthofsDiscoveryFlag.Name))
+	}
+	if ctx.GlobalIsSet(EthofsDiscoveryIntervalFlag.Name) {
+		cfg.BootstrapRefresh = ctx.GlobalDuration(EthofsDiscoveryIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsMinBootstrapPeersFlag.Name) {
+		cfg.MinBootstrapPeers = ctx.GlobalInt(EthofsMinBootstrapPeersFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsMinPeersFlag.Name) {
+		cfg.MinPeers = ctx.GlobalInt(EthofsMinPeersFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsReconnectFlag.Name) {
+		cfg.ReconnectInterval = ctx.GlobalDuration(EthofsReconnectFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsSwarmKeyFlag.Name) {
+		cfg.SwarmKey = ctx.GlobalString(EthofsSwarmKeyFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsSeedFlag.Name) {
+		cfg.Seed = ctx.GlobalString(EthofsSeedFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsSeedIndexFlag.Name) {
+		cfg.SeedIndex = ctx.GlobalInt(EthofsSeedIndexFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsMaxConnsFlag.Name) {
+		cfg.Resources.MaxConnections = ctx.GlobalInt(EthofsMaxConnsFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsConnLowWaterFlag.Name) {
+		cfg.Resources.ConnLowWater = ctx.GlobalInt(EthofsConnLowWaterFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsConnHighWaterFlag.Name) {
+		cfg.Resources.ConnHighWater = ctx.GlobalInt(EthofsConnHighWaterFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsPeerBandwidthFlag.Name) {
+		cfg.Resources.PeerBandwidth = ctx.GlobalString(EthofsPeerBandwidthFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsTransferBandwidthFlag.Name) {
+		cfg.Resources.TransferBandwidth = ctx.GlobalString(EthofsTransferBandwidthFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsStorageMaxFlag.Name) {
+		cfg.StorageMax = ctx.GlobalString(EthofsStorageMaxFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsGCWatermarkFlag.Name) {
+		cfg.GCWatermark = ctx.GlobalInt(EthofsGCWatermarkFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsGCPeriodFlag.Name) {
+		cfg.GCPeriod = ctx.GlobalDuration(EthofsGCPeriodFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsAdminAddrFlag.Name) {
+		cfg.Admin.ListenAddr = ctx.GlobalString(EthofsAdminAddrFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsAdminJWTSecretFlag.Name) {
+		cfg.Admin.JWTSecretFile = ctx.GlobalString(EthofsAdminJWTSecretFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsAdminAccountsFlag.Name) {
+		cfg.Admin.Accounts = nil
+		for _, account := range SplitAndTrim(ctx.GlobalString(EthofsAdminAccountsFlag.Name)) {
+			if !common.IsHexAddress(account) {
+				Fatalf("Invalid ethoFS admin account %q", account)
+			}
+			cfg.Admin.Accounts = append(cfg.Admin.Accounts, common.HexToAddress(account))
+		}
+	}
+	if ctx.GlobalIsSet(EthofsSLOTargetFlag.Name) {
+		cfg.SLO.Target = ctx.GlobalFloat64(EthofsSLOTargetFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsSLOLatencyFlag.Name) {
+		cfg.SLO.Latency = ctx.GlobalDuration(EthofsSLOLatencyFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsNoPubSubFlag.Name) {
+		cfg.PubSub.Disabled = ctx.GlobalBool(EthofsNoPubSubFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsPubSubRouterFlag.Name) {
+		cfg.PubSub.Router = ctx.GlobalString(EthofsPubSubRouterFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsIPNSNoCacheFlag.Name) {
+		cfg.IPNSCache.Disabled = ctx.GlobalBool(EthofsIPNSNoCacheFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsIPNSFreshFlag.Name) {
+		cfg.IPNSCache.Fresh = ctx.GlobalDuration(EthofsIPNSFreshFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsIPNSMaxStaleFlag.Name) {
+		cfg.IPNSCache.MaxStale = ctx.GlobalDuration(EthofsIPNSMaxStaleFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsGatewayFlag.Name) {
+		cfg.Gateway.Enabled = ctx.GlobalBool(EthofsGatewayFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsGatewayAddrFlag.Name) {
+		cfg.Gateway.ListenAddr = ctx.GlobalString(EthofsGatewayAddrFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsGatewayReadOnlyFlag.Name) {
+		cfg.Gateway.ReadOnly = ctx.GlobalBool(EthofsGatewayReadOnlyFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsGatewayPathsFlag.Name) {
+		cfg.Gateway.PathWhitelist = SplitAndTrim(ctx.GlobalString(EthofsGatewayPathsFlag.Name))
+	}
+	if ctx.GlobalIsSet(EthofsGatewayPreviewsFlag.Name) {
+		cfg.Gateway.Previews = ctx.GlobalBool(EthofsGatewayPreviewsFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsGatewaySiteRoutingFlag.Name) {
+		cfg.Gateway.SiteRouting = ctx.GlobalBool(EthofsGatewaySiteRoutingFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsGatewaySPAFlag.Name) {
+		cfg.Gateway.SPARoots = SplitAndTrim(ctx.GlobalString(EthofsGatewaySPAFlag.Name))
+	}
+	if ctx.GlobalIsSet(EthofsGatewayVHostsFlag.Name) {
+		cfg.Gateway.VirtualHosts = make(map[string]string)
+		for _, entry := range SplitAndTrim(ctx.GlobalString(EthofsGatewayVHostsFlag.Name)) {
+			parts := strings.SplitN(entry, "=", 2)
+			if len(parts) != 2 {
+				Fatalf("Invalid ethoFS virtual host mapping %q, expected host=root", entry)
+			}
+			cfg.Gateway.VirtualHosts[parts[0]] = parts[1]
+		}
+	}
+	if ctx.GlobalIsSet(EthofsGatewayCompressionFlag.Name) {
+		cfg.Gateway.Compression = ctx.GlobalBool(EthofsGatewayCompressionFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsGatewayCompressionCacheFlag.Name) {
+		cfg.Gateway.CompressionCache = ctx.GlobalInt(EthofsGatewayCompressionCacheFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsGatewayNoCoalesceFlag.Name) {
+		cfg.Gateway.NoCoalesce = ctx.GlobalBool(EthofsGatewayNoCoalesceFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsGatewayCacheFlag.Name) {
+		cfg.Gateway.CachePolicy = ctx.GlobalString(EthofsGatewayCacheFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsSeedAssetsFlag.Name) {
+		cfg.SeedAssets = ctx.GlobalBool(EthofsSeedAssetsFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsVerifyFlag.Name) {
+		cfg.Verifier.Enabled = ctx.GlobalBool(EthofsVerifyFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsVerifyIntervalFlag.Name) {
+		cfg.Verifier.Interval = ctx.GlobalDuration(EthofsVerifyIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsVerifyContractFlag.Name) {
+		cfg.Verifier.ProofContract = ctx.GlobalString(EthofsVerifyContractFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsVerifyAccountFlag.Name) {
+		cfg.Verifier.Account = ctx.GlobalString(EthofsVerifyAccountFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsNotFoundNoCacheFlag.Name) {
+		cfg.NotFoundCache.Disabled = ctx.GlobalBool(EthofsNotFoundNoCacheFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsNotFoundTTLFlag.Name) {
+		cfg.NotFoundCache.TTL = ctx.GlobalDuration(EthofsNotFoundTTLFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsNotFoundSizeFlag.Name) {
+		cfg.NotFoundCache.Size = ctx.GlobalInt(EthofsNotFoundSizeFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsBlockstoreFlag.Name) {
+		cfg.Blockstore.Type = ctx.GlobalString(EthofsBlockstoreFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsBlockstoreParamsFlag.Name) {
+		cfg.Blockstore.Params = make(map[string]string)
+		for _, param := range SplitAndTrim(ctx.GlobalString(EthofsBlockstoreParamsFlag.Name)) {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 {
+				Fatalf("Invalid ethoFS blockstore parameter %q, key=value expected", param)
+			}
+			cfg.Blockstore.Params[kv[0]] = kv[1]
+		}
+	}
+	if ctx.GlobalIsSet(EthofsStartupRetriesFlag.Name) {
+		cfg.Startup.Retries = ctx.GlobalInt(EthofsStartupRetriesFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsStartupBackoffFlag.Name) {
+		cfg.Startup.Backoff = ctx.GlobalDuration(EthofsStartupBackoffFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsBlockReplicasFlag.Name) {
+		cfg.BlockReplicas = SplitAndTrim(ctx.GlobalString(EthofsBlockReplicasFlag.Name))
+	}
+	if ctx.GlobalIsSet(EthofsLightFlag.Name) {
+		cfg.Light = ctx.GlobalBool(EthofsLightFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsQuorumPeersFlag.Name) {
+		cfg.Quorum.Peers = SplitAndTrim(ctx.GlobalString(EthofsQuorumPeersFlag.Name))
+	}
+	if ctx.GlobalIsSet(EthofsQuorumSizeFlag.Name) {
+		cfg.Quorum.Size = ctx.GlobalInt(EthofsQuorumSizeFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsMigrationSourcesFlag.Name) {
+		cfg.MigrationSources = SplitAndTrim(ctx.GlobalString(EthofsMigrationSourcesFlag.Name))
+	}
+	if ctx.GlobalIsSet(EthofsNoRepoMigrateFlag.Name) {
+		cfg.RepoMigration.Disabled = ctx.GlobalBool(EthofsNoRepoMigrateFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsRepoMigrateExternalFlag.Name) {
+		cfg.RepoMigration.External = ctx.GlobalBool(EthofsRepoMigrateExternalFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsReprovideRateFlag.Name) {
+		cfg.Reprovide.Rate = ctx.GlobalFloat64(EthofsReprovideRateFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsReprovideSpreadFlag.Name) {
+		cfg.Reprovide.Spread = ctx.GlobalDuration(EthofsReprovideSpreadFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsPortFlag.Name) {
+		cfg.NAT.Port = ctx.GlobalInt(EthofsPortFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsAnnounceFlag.Name) {
+		cfg.NAT.AnnounceAddresses = SplitAndTrim(ctx.GlobalString(EthofsAnnounceFlag.Name))
+	}
+	if ctx.GlobalIsSet(EthofsNoAnnounceFlag.Name) {
+		cfg.NAT.NoAnnounceAddresses = SplitAndTrim(ctx.GlobalString(EthofsNoAnnounceFlag.Name))
+	}
+	if ctx.GlobalIsSet(EthofsNoPortMapFlag.Name) {
+		enabled := ctx.GlobalBool(EthofsNoPortMapFlag.Name)
+		cfg.NAT.DisablePortMap = &enabled
+	}
+	if ctx.GlobalIsSet(EthofsAutoNATFlag.Name) {
+		cfg.NAT.AutoNAT = ctx.GlobalString(EthofsAutoNATFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsNoRelayFlag.Name) {
+		enabled := ctx.GlobalBool(EthofsNoRelayFlag.Name)
+		cfg.NAT.DisableRelay = &enabled
+	}
+	if ctx.GlobalIsSet(EthofsAutoRelayFlag.Name) {
+		enabled := ctx.GlobalBool(EthofsAutoRelayFlag.Name)
+		cfg.NAT.AutoRelay = &enabled
+	}
+	if ctx.GlobalIsSet(EthofsRelayHopFlag.Name) {
+		enabled := ctx.GlobalBool(EthofsRelayHopFlag.Name)
+		cfg.NAT.RelayHop = &enabled
+	}
+	if ctx.GlobalIsSet(EthofsReceiptContractFlag.Name) {
+		cfg.ReceiptContract = ctx.GlobalString(EthofsReceiptContractFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsProviderRegistryFlag.Name) {
+		cfg.ProviderRegistry = ctx.GlobalString(EthofsProviderRegistryFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsOfflineFlag.Name) {
+		cfg.Offline = ctx.GlobalBool(EthofsOfflineFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsRedirectorAddrFlag.Name) {
+		cfg.Redirector.ListenAddr = ctx.GlobalString(EthofsRedirectorAddrFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsRedirectorGatewaysFlag.Name) {
+		cfg.Redirector.Gateways = SplitAndTrim(ctx.GlobalString(EthofsRedirectorGatewaysFlag.Name))
+	}
+	if ctx.GlobalIsSet(EthofsPinDurationFlag.Name) {
+		cfg.PinDuration = ctx.GlobalUint64(EthofsPinDurationFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsFetchConcurrencyFlag.Name) {
+		cfg.Fetch.Concurrency = ctx.GlobalInt(EthofsFetchConcurrencyFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsFetchTimeoutFlag.Name) {
+		cfg.Fetch.Timeout = ctx.GlobalDuration(EthofsFetchTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsReadVerificationFlag.Name) {
+		cfg.Blockstore.ReadVerification = ctx.GlobalString(EthofsReadVerificationFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsDAGWorkersFlag.Name) {
+		cfg.DAGWorkers = ctx.GlobalInt(EthofsDAGWorkersFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsHealthAddrFlag.Name) {
+		cfg.HealthAddr = ctx.GlobalString(EthofsHealthAddrFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsPubSubIPNSFlag.Name) {
+		cfg.PubSub.IPNS = ctx.GlobalBool(EthofsPubSubIPNSFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsPubSubPopularityFlag.Name) {
+		cfg.PubSub.Popularity = ctx.GlobalBool(EthofsPubSubPopularityFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsColdStartSeedsFlag.Name) {
+		cfg.ColdStart.Seeds = SplitAndTrim(ctx.GlobalString(EthofsColdStartSeedsFlag.Name))
+	}
+	if ctx.GlobalIsSet(EthofsColdStartServeFlag.Name) {
+		cfg.ColdStart.Serve = ctx.GlobalBool(EthofsColdStartServeFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsClockMaxSkewFlag.Name) {
+		cfg.Clock.MaxSkew = ctx.GlobalDuration(EthofsClockMaxSkewFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsClockStrictFlag.Name) {
+		cfg.Clock.Strict = ctx.GlobalBool(EthofsClockStrictFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsTelemetryFlag.Name) {
+		cfg.Telemetry.Enabled = ctx.GlobalBool(EthofsTelemetryFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsTelemetryEndpointFlag.Name) {
+		cfg.Telemetry.Endpoint = ctx.GlobalString(EthofsTelemetryEndpointFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsTelemetryRegionFlag.Name) {
+		cfg.Telemetry.Region = ctx.GlobalString(EthofsTelemetryRegionFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsSignaturePublishersFlag.Name) {
+		cfg.Signatures.Publishers = nil
+		for _, publisher := range SplitAndTrim(ctx.GlobalString(EthofsSignaturePublishersFlag.Name)) {
+			if !common.IsHexAddress(publisher) {
+				Fatalf("Invalid ethoFS publisher address %q", publisher)
+			}
+			cfg.Signatures.Publishers = append(cfg.Signatures.Publishers, common.HexToAddress(publisher))
+		}
+	}
+	if ctx.GlobalIsSet(EthofsSignatureManifestsFlag.Name) {
+		cfg.Signatures.Manifests = SplitAndTrim(ctx.GlobalString(EthofsSignatureManifestsFlag.Name))
+	}
+	if ctx.GlobalIsSet(EthofsSignatureStrictFlag.Name) {
+		cfg.Signatures.Strict = ctx.GlobalBool(EthofsSignatureStrictFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsNoCreditsFlag.Name) {
+		cfg.Credits.Disabled = ctx.GlobalBool(EthofsNoCreditsFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsCreditDebtLimitFlag.Name) {
+		cfg.Credits.DebtLimit = ctx.GlobalUint64(EthofsCreditDebtLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsAddWebhooksFlag.Name) {
+		cfg.AddHooks.Webhooks = SplitAndTrim(ctx.GlobalString(EthofsAddWebhooksFlag.Name))
+	}
+	if ctx.GlobalIsSet(EthofsAddManifestDirFlag.Name) {
+		cfg.AddHooks.ManifestDir = ctx.GlobalString(EthofsAddManifestDirFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsAllowlistFlag.Name) {
+		cfg.Allowlist.Source = ctx.GlobalString(EthofsAllowlistFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsIntegrityFlag.Name) {
+		cfg.Integrity.Enabled = ctx.GlobalBool(EthofsIntegrityFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsIntegrityIntervalFlag.Name) {
+		cfg.Integrity.Interval = ctx.GlobalDuration(EthofsIntegrityIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsIntegrityContractFlag.Name) {
+		cfg.Integrity.ProofContract = ctx.GlobalString(EthofsIntegrityContractFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthofsIntegrityAccountFlag.Name) {
+		cfg.Integrity.Account = ctx.GlobalString(EthofsIntegrityAccountFlag.Name)
+	}
+	if err := cfg.Validate(); err != nil {
+		Fatalf("%v", err)
+	}
+}
+
 // SetEthConfig applies eth-related command line flags to the config.
 func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	// Avoid conflicting network flags
@@ -1724,6 +2531,14 @@ func RegisterEthStatsService(stack *node.Node, backend ethapi.Backend, url strin
 	}
 }
 
+// RegisterEthofsService configures the embedded ethoFS node and adds it to the
+// given node.
+func RegisterEthofsService(stack *node.Node, cfg *ethofs.Config) {
+	if _, err := ethofs.New(stack, cfg); err != nil {
+		Fatalf("Failed to register the ethoFS service: %v", err)
+	}
+}
+
 // RegisterGraphQLService is a utility function to construct a new service and register it against a node.
 func RegisterGraphQLService(stack *node.Node, backend ethapi.Backend, cfg node.Config) {
 	if err := graphql.New(stack, backend, cfg.GraphQLCors, cfg.GraphQLVirtualHosts); err != nil {
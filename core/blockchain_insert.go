@@ -93,9 +93,13 @@ func InitializeBlockCommunication(newBlockReceiptChannel chan<- *types.Block) {
 	isInitialized = true
 }
 
-// Send new block using comms
+// Send new block using comms, dropping it if the receiver is not keeping up
+// so that chain import never blocks on a stopped ethoFS node
 func sendNewBlockCommunication(block *types.Block) {
-	blockCommunication <- block
+	select {
+	case blockCommunication <- block:
+	default:
+	}
 }
 
 // insertIterator is a helper to assist during chain import.
@@ -0,0 +1,321 @@
+package ethofs
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	aclTokenParam   = "token"
+	aclSignatureHdr = "X-Ethofs-Signature"
+	aclExpiresHdr   = "X-Ethofs-Expires"
+
+	// maxSignatureLifetime bounds how far in the future a signed access
+	// request may expire, limiting the replay window of a leaked signature.
+	maxSignatureLifetime = 24 * time.Hour
+
+	// aclResolveTimeout bounds the resolution of the IPNS name of a request
+	// or a rule.
+	aclResolveTimeout = 10 * time.Second
+)
+
+var (
+	errAccessDenied     = errors.New("access denied")
+	errSignatureExpired = errors.New("signature expired")
+)
+
+// ACLRule flags a content root as private. Requests for the root and the paths
+// below it are denied unless they carry one of the rule's tokens or are signed
+// by one of its accounts.
+//
+// Note that the rule applies to content paths, the CIDs of files inside a
+// private root are not protected when requested directly.
+type ACLRule struct {
+	// Root is the private site root (CID or /ipfs/ or /ipns/ path).
+	Root string
+
+	// Tokens are bearer tokens granting access, passed in the Authorization
+	// header or the token query parameter.
+	Tokens []string `toml:",omitempty"`
+
+	// Accounts are the Ethereum accounts whose signed access requests are
+	// accepted.
+	Accounts []common.Address `toml:",omitempty"`
+}
+
+// aclSigningMessage is the text an account signs (personal_sign style) to
+// access the given root until the expiry timestamp.
+func aclSigningMessage(root string, expires int64) string {
+	return fmt.Sprintf("ethoFS access %s %d", root, expires)
+}
+
+// aclRoot identifies the root of a rule or a request: the multihash of an
+// /ipfs/ CID, so the same content matches in any CID version or encoding, or
+// an IPNS name.
+type aclRoot struct {
+	hash string
+	name string
+	rest string // Path below the root, "/" for the root itself
+}
+
+// parseACLRoot splits a content path into its root and the path below it.
+func parseACLRoot(p string) (aclRoot, bool) {
+	ns, root, rest := splitContentPath(p)
+	if root == "" {
+		return aclRoot{}, false
+	}
+	if rest = strings.TrimSuffix(rest, "/"); rest == "" {
+		rest = "/"
+	}
+	if ns == "/ipns" {
+		return aclRoot{name: strings.ToLower(root), rest: rest}, true
+	}
+	c, err := cid.Decode(root)
+	if err != nil {
+		return aclRoot{}, false
+	}
+	return aclRoot{hash: string(c.Hash()), rest: rest}, true
+}
+
+// below reports whether the path of the request is covered by the rule path.
+func (r aclRoot) below(rule aclRoot) bool {
+	return rule.rest == "/" || r.rest == rule.rest || strings.HasPrefix(r.rest, rule.rest+"/")
+}
+
+// accessList is the set of private roots of the gateway.
+type accessList struct {
+	rules []ACLRule
+	roots []aclRoot
+
+	// resolve returns the root an IPNS name points at, so requests are
+	// matched against rules of the other namespace. If nil, names only match
+	// names.
+	resolve func(ctx context.Context, name string) (cid.Cid, error)
+
+	lock     sync.Mutex
+	resolved map[string]string // Last known root multihash of the rule names
+}
+
+func newAccessList(rules []ACLRule) (*accessList, error) {
+	list := &accessList{resolved: make(map[string]string)}
+	for _, rule := range rules {
+		root, err := normalizeWhitelistPath(rule.Root)
+		if err != nil {
+			return nil, err
+		}
+		if len(rule.Tokens) == 0 && len(rule.Accounts) == 0 {
+			return nil, fmt.Errorf("private root %s has no tokens or accounts", root)
+		}
+		parsed, ok := parseACLRoot(root)
+		if !ok {
+			return nil, fmt.Errorf("invalid private root %q", rule.Root)
+		}
+		rule.Root = root
+		list.rules = append(list.rules, rule)
+		list.roots = append(list.roots, parsed)
+	}
+	return list, nil
+}
+
+// resolveName returns the root multihash of the IPNS name, falling back to
+// the last known one of a rule name if the resolution fails.
+func (list *accessList) resolveName(ctx context.Context, name string, rule bool) string {
+	if list.resolve == nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, aclResolveTimeout)
+	defer cancel()
+
+	c, err := list.resolve(ctx, name)
+
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	if err != nil {
+		log.Debug("ethoFS - unable to resolve private root name", "name", name, "error", err)
+		if rule {
+			return list.resolved[name]
+		}
+		return ""
+	}
+	hash := string(c.Hash())
+	if rule {
+		list.resolved[name] = hash
+	}
+	return hash
+}
+
+// rule returns the rule covering the content path, if any. Roots are compared
+// by multihash, resolving IPNS names to match requests and rules across the
+// namespaces.
+func (list *accessList) rule(ctx context.Context, p string) (ACLRule, bool) {
+	req, ok := parseACLRoot(p)
+	if !ok {
+		return ACLRule{}, false
+	}
+	var reqHash string
+	for i, root := range list.roots {
+		if !req.below(root) {
+			continue
+		}
+		switch {
+		case req.hash != "" && req.hash == root.hash, req.name != "" && req.name == root.name:
+			return list.rules[i], true
+
+		case req.hash != "" && root.name != "":
+			if list.resolveName(ctx, root.name, true) == req.hash {
+				return list.rules[i], true
+			}
+		case req.name != "" && root.hash != "":
+			if reqHash == "" {
+				reqHash = list.resolveName(ctx, req.name, false)
+			}
+			if reqHash != "" && reqHash == root.hash {
+				return list.rules[i], true
+			}
+		}
+	}
+	return ACLRule{}, false
+}
+
+// authorize checks the credentials of the request against the rule.
+func (rule ACLRule) authorize(r *http.Request, now time.Time) error {
+	if token := requestToken(r); token != "" {
+		for _, allowed := range rule.Tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+				return nil
+			}
+		}
+		return errAccessDenied
+	}
+	if r.Header.Get(aclSignatureHdr) != "" {
+		signer, err := requestSigner(r, rule.Root, now)
+		if err != nil {
+			return err
+		}
+		for _, account := range rule.Accounts {
+			if account == signer {
+				return nil
+			}
+		}
+	}
+	return errAccessDenied
+}
+
+// requestToken extracts the bearer token of the request.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get(aclTokenParam)
+}
+
+// requestSigner recovers the account that signed the access request for the
+// root.
+func requestSigner(r *http.Request, root string, now time.Time) (common.Address, error) {
+	expires, err := strconv.ParseInt(r.Header.Get(aclExpiresHdr), 10, 64)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid %s header", aclExpiresHdr)
+	}
+	if expiry := time.Unix(expires, 0); now.After(expiry) {
+		return common.Address{}, errSignatureExpired
+	} else if expiry.Sub(now) > maxSignatureLifetime {
+		return common.Address{}, fmt.Errorf("signature lifetime exceeds %v", maxSignatureLifetime)
+	}
+	sig, err := hexutil.Decode(r.Header.Get(aclSignatureHdr))
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("invalid %s header", aclSignatureHdr)
+	}
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash([]byte(aclSigningMessage(root, expires))), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// aclOption denies requests for private roots without valid credentials.
+func aclOption(rules []ACLRule) corehttp.ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		list, err := newAccessList(rules)
+		if err != nil {
+			return nil, err
+		}
+		api, err := coreapi.NewCoreAPI(n)
+		if err != nil {
+			return nil, err
+		}
+		list.resolve = func(ctx context.Context, name string) (cid.Cid, error) {
+			resolved, err := api.ResolvePath(ctx, path.New("/ipns/"+name))
+			if err != nil {
+				return cid.Undef, err
+			}
+			return resolved.Cid(), nil
+		}
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			p := requestContentPath(r.URL.Path)
+			if p == "" {
+				childMux.ServeHTTP(w, r)
+				return
+			}
+			rule, ok := list.rule(r.Context(), p)
+			if !ok {
+				childMux.ServeHTTP(w, r)
+				return
+			}
+			if err := rule.authorize(r, time.Now()); err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="ethofs"`)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			childMux.ServeHTTP(&privateResponse{ResponseWriter: w}, r)
+		})
+		return childMux, nil
+	}
+}
+
+// privateResponse keeps private content out of shared caches, overriding the
+// immutable caching headers the gateway sets for /ipfs/ content.
+type privateResponse struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *privateResponse) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Header().Add("Vary", "Authorization")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *privateResponse) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
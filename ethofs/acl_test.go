@@ -0,0 +1,124 @@
+package ethofs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestAccessListTokens(t *testing.T) {
+	root := "QmRwQ49Zknc2dQbywrhT8ArMDS9JdmnEyGGy4mZ1wDkgaX"
+	list, err := newAccessList([]ACLRule{{Root: root, Tokens: []string{"secret"}}})
+	if err != nil {
+		t.Fatalf("failed to create access list: %v", err)
+	}
+	ctx := context.Background()
+	if _, ok := list.rule(ctx, "/ipfs/QmPW8zExrEeno85Us3H1bk68rBo7N7WEhdpU9pC9wjQxgu"); ok {
+		t.Errorf("public root flagged private")
+	}
+	rule, ok := list.rule(ctx, "/ipfs/"+root+"/members/index.html")
+	if !ok {
+		t.Fatalf("private root not matched")
+	}
+	now := time.Now()
+
+	req := httptest.NewRequest("GET", "/ipfs/"+root, nil)
+	if err := rule.authorize(req, now); err == nil {
+		t.Errorf("unauthenticated request allowed")
+	}
+	req = httptest.NewRequest("GET", "/ipfs/"+root+"?token=secret", nil)
+	if err := rule.authorize(req, now); err != nil {
+		t.Errorf("query token rejected: %v", err)
+	}
+	req = httptest.NewRequest("GET", "/ipfs/"+root, nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	if err := rule.authorize(req, now); err == nil {
+		t.Errorf("invalid token allowed")
+	}
+	if _, err := newAccessList([]ACLRule{{Root: root}}); err == nil {
+		t.Errorf("expected error for rule without credentials")
+	}
+}
+
+func TestAccessListEncodings(t *testing.T) {
+	root := "QmRwQ49Zknc2dQbywrhT8ArMDS9JdmnEyGGy4mZ1wDkgaX"
+	list, err := newAccessList([]ACLRule{
+		{Root: root, Tokens: []string{"secret"}},
+		{Root: "/ipns/members.example.org/private", Tokens: []string{"secret"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create access list: %v", err)
+	}
+	c, _ := cid.Decode(root)
+	v1 := cid.NewCidV1(cid.DagProtobuf, c.Hash()).String()
+
+	ctx := context.Background()
+	for _, p := range []string{"/ipfs/" + v1, "/ipfs/" + strings.ToUpper(v1) + "/index.html", "/ipns/Members.Example.org/private/index.html"} {
+		if _, ok := list.rule(ctx, p); !ok {
+			t.Errorf("private root bypassed via %s", p)
+		}
+	}
+	if _, ok := list.rule(ctx, "/ipns/members.example.org/privateer"); ok {
+		t.Errorf("sibling path flagged private")
+	}
+	// Names are matched against the roots they resolve to, both ways
+	list.resolve = func(ctx context.Context, name string) (cid.Cid, error) {
+		if name == "members.example.org" {
+			return cid.NewCidV1(cid.Raw, c.Hash()), nil
+		}
+		return cid.Undef, errors.New("not found")
+	}
+	if _, ok := list.rule(ctx, "/ipns/alias.example.org/index.html"); ok {
+		t.Errorf("unresolvable name flagged private")
+	}
+	if _, ok := list.rule(ctx, "/ipfs/"+root+"/private"); !ok {
+		t.Errorf("resolved private name bypassed via its root")
+	}
+	list.resolve = func(ctx context.Context, name string) (cid.Cid, error) { return c, nil }
+	if _, ok := list.rule(ctx, "/ipns/alias.example.org"); !ok {
+		t.Errorf("private root bypassed via a name")
+	}
+}
+
+func TestAccessListSignatures(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+
+	root := "/ipns/members.example.org"
+	rule := ACLRule{Root: root, Accounts: []common.Address{crypto.PubkeyToAddress(key.PublicKey)}}
+	now := time.Now()
+
+	signed := func(key *ecdsa.PrivateKey, expires int64) error {
+		sig, _ := crypto.Sign(accounts.TextHash([]byte(aclSigningMessage(root, expires))), key)
+		sig[crypto.RecoveryIDOffset] += 27
+
+		req := httptest.NewRequest("GET", root+"/index.html", nil)
+		req.Header.Set(aclSignatureHdr, hexutil.Encode(sig))
+		req.Header.Set(aclExpiresHdr, strconv.FormatInt(expires, 10))
+		return rule.authorize(req, now)
+	}
+	if err := signed(key, now.Add(time.Hour).Unix()); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	if err := signed(other, now.Add(time.Hour).Unix()); err == nil {
+		t.Errorf("signature of unknown account allowed")
+	}
+	if err := signed(key, now.Add(-time.Minute).Unix()); err != errSignatureExpired {
+		t.Errorf("expired signature error mismatch: have %v, want %v", err, errSignatureExpired)
+	}
+	if err := signed(key, now.Add(48*time.Hour).Unix()); err == nil {
+		t.Errorf("signature exceeding lifetime allowed")
+	}
+}
@@ -0,0 +1,193 @@
+package ethofs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	blockservice "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreunix"
+	merkledag "github.com/ipfs/go-merkledag"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// AddOptions controls how content is chunked and hashed when added.
+type AddOptions struct {
+	Chunker    string `json:"chunker"`    // Chunking algorithm, e.g. "size-262144" or "rabin" (default size-262144)
+	CidVersion int    `json:"cidVersion"` // CID version of the created DAG (default 0)
+	RawLeaves  bool   `json:"rawLeaves"`  // Store the leaves as raw blocks instead of unixfs nodes
+	Hash       string `json:"hash"`       // Multihash function name, e.g. "sha2-256" (default) or "blake2b-256"
+	Pin        bool   `json:"pin"`        // Pin the content once added
+}
+
+// AddProgress is a snapshot of the progress of an add.
+type AddProgress struct {
+	Bytes  int64 `json:"bytes"`  // Bytes read and hashed so far
+	Blocks int64 `json:"blocks"` // Blocks written to the blockstore so far
+}
+
+// unixfsOptions converts the options to the ones of the core API.
+func (o AddOptions) unixfsOptions() ([]options.UnixfsAddOption, error) {
+	opts := []options.UnixfsAddOption{
+		options.Unixfs.CidVersion(o.CidVersion),
+		options.Unixfs.Pin(o.Pin),
+	}
+	if o.Chunker != "" {
+		opts = append(opts, options.Unixfs.Chunker(o.Chunker))
+	}
+	if o.RawLeaves {
+		opts = append(opts, options.Unixfs.RawLeaves(true))
+	}
+	if o.Hash != "" {
+		code, ok := mh.Names[strings.ToLower(o.Hash)]
+		if !ok {
+			return nil, fmt.Errorf("unknown hash function %q", o.Hash)
+		}
+		opts = append(opts, options.Unixfs.Hash(code))
+	}
+	return opts, nil
+}
+
+// countingBlockstore counts the blocks written through it.
+type countingBlockstore struct {
+	blockstore.Blockstore
+	blocks *int64
+}
+
+func (bs countingBlockstore) Put(b blocks.Block) error {
+	if err := bs.Blockstore.Put(b); err != nil {
+		return err
+	}
+	atomic.AddInt64(bs.blocks, 1)
+	return nil
+}
+
+func (bs countingBlockstore) PutMany(bls []blocks.Block) error {
+	if err := bs.Blockstore.PutMany(bls); err != nil {
+		return err
+	}
+	atomic.AddInt64(bs.blocks, int64(len(bls)))
+	return nil
+}
+
+// Add stores the content of r as a file on the ethoFS node and returns its
+// CID. If progress is non-nil, it is called from the adding goroutine as the
+// content is hashed and once more after the add completed.
+func (s *EthofsService) Add(ctx context.Context, r io.Reader, opts AddOptions, progress func(AddProgress)) (c cid.Cid, err error) {
+	ipfs, node := s.API(), s.Node()
+	if ipfs == nil || node == nil {
+		return cid.Undef, errNodeNotRunning
+	}
+	defer func(start time.Time) {
+		var added string
+		if err == nil {
+			added = c.String()
+		}
+		history.record("add", added, "", start, err)
+	}(time.Now())
+
+	addOpts, err := opts.unixfsOptions()
+	if err != nil {
+		return cid.Undef, err
+	}
+	counted := &countingReader{r: r}
+	file := files.NewReaderFile(newLimitedReader(ctx, counted))
+	if progress == nil {
+		resolved, err := ipfs.Unixfs().Add(ctx, file, addOpts...)
+		if err != nil {
+			return cid.Undef, err
+		}
+		s.added(node, resolved.Cid(), opts, counted.n)
+		return resolved.Cid(), nil
+	}
+	// Add through the adder directly to count the blocks it writes
+	var (
+		events  = make(chan interface{})
+		hashed  int64
+		written int64
+		wg      sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ev := range events {
+			if ev, ok := ev.(*icore.AddEvent); ok && ev.Bytes > 0 {
+				hashed = ev.Bytes
+				progress(AddProgress{Bytes: hashed, Blocks: atomic.LoadInt64(&written)})
+			}
+		}
+	}()
+	addOpts = append(addOpts, options.Unixfs.Events(events), options.Unixfs.Progress(true))
+	c, err = addCounting(ctx, node, file, &written, addOpts...)
+	close(events)
+	wg.Wait()
+
+	if err != nil {
+		return cid.Undef, err
+	}
+	progress(AddProgress{Bytes: hashed, Blocks: atomic.LoadInt64(&written)})
+	s.added(node, c, opts, counted.n)
+	return c, nil
+}
+
+// addCounting adds the file to the node like its Unixfs API does, counting the
+// blocks written to the base blockstore.
+func addCounting(ctx context.Context, node *core.IpfsNode, file files.Node, written *int64, opts ...options.UnixfsAddOption) (cid.Cid, error) {
+	settings, prefix, err := options.UnixfsAddOptions(opts...)
+	if err != nil {
+		return cid.Undef, err
+	}
+	bs := blockstore.NewGCBlockstore(countingBlockstore{Blockstore: node.BaseBlocks, blocks: written}, node.Blockstore)
+	adder, err := coreunix.NewAdder(ctx, node.Pinning, bs, merkledag.NewDAGService(blockservice.New(bs, node.Exchange)))
+	if err != nil {
+		return cid.Undef, err
+	}
+	adder.Chunker = settings.Chunker
+	adder.Out = settings.Events
+	adder.Progress = settings.Progress
+	adder.Pin = settings.Pin
+	adder.RawLeaves = settings.RawLeaves
+	adder.CidBuilder = prefix
+
+	nd, err := adder.AddAllAndPin(file)
+	if err != nil {
+		return cid.Undef, err
+	}
+	// Persist the added blocks like the Unixfs API does
+	if err := node.Repo.Datastore().Sync(blockstore.BlockPrefix); err != nil {
+		return cid.Undef, err
+	}
+	if err := node.Provider.Provide(nd.Cid()); err != nil {
+		return cid.Undef, err
+	}
+	return nd.Cid(), nil
+}
+
+// added announces content stored by Add to the event feed and the add hooks.
+func (s *EthofsService) added(node *core.IpfsNode, c cid.Cid, opts AddOptions, size int64) {
+	if opts.Pin {
+		ownPin(c, pinOwnerAdd)
+	}
+	feeds.contentAdded.Send(ContentAdded{Cid: c, Pinned: opts.Pin})
+	if hooks := s.addHookRunner(); hooks != nil {
+		hooks.enqueue(&AddResult{
+			Cid:       c.String(),
+			Size:      size,
+			Pinned:    opts.Pin,
+			Options:   opts,
+			Node:      node.Identity.Pretty(),
+			Timestamp: uint64(time.Now().Unix()),
+		})
+	}
+}
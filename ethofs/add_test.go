@@ -0,0 +1,74 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func TestAddOptions(t *testing.T) {
+	opts, err := AddOptions{Chunker: "size-1024", CidVersion: 1, RawLeaves: true, Hash: "blake2b-256", Pin: true}.unixfsOptions()
+	if err != nil {
+		t.Fatalf("failed to convert options: %v", err)
+	}
+	settings, prefix, err := options.UnixfsAddOptions(opts...)
+	if err != nil {
+		t.Fatalf("invalid add options: %v", err)
+	}
+	if settings.Chunker != "size-1024" || !settings.RawLeaves || !settings.Pin {
+		t.Errorf("settings mismatch: chunker %q, raw leaves %v, pin %v", settings.Chunker, settings.RawLeaves, settings.Pin)
+	}
+	if prefix.Version != 1 || prefix.MhType != mh.Names["blake2b-256"] {
+		t.Errorf("prefix mismatch: version %d, hash %#x", prefix.Version, prefix.MhType)
+	}
+	// The defaults have to produce the CIDs of plain adds
+	if _, prefix, _ = options.UnixfsAddOptions(mustUnixfsOptions(t, AddOptions{})...); prefix.Version != 0 || prefix.MhType != mh.SHA2_256 {
+		t.Errorf("default prefix mismatch: version %d, hash %#x", prefix.Version, prefix.MhType)
+	}
+	if _, err := (AddOptions{Hash: "nope-256"}).unixfsOptions(); err == nil {
+		t.Error("expected error for unknown hash function")
+	}
+}
+
+func mustUnixfsOptions(t *testing.T, o AddOptions) []options.UnixfsAddOption {
+	opts, err := o.unixfsOptions()
+	if err != nil {
+		t.Fatalf("failed to convert options: %v", err)
+	}
+	return opts
+}
+
+func TestAddProgress(t *testing.T) {
+	s, stop := newTestService(t)
+	defer stop()
+
+	data := make([]byte, 3*1024+100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	ctx := context.Background()
+	opts := AddOptions{Chunker: "size-1024", Pin: true}
+
+	var last AddProgress
+	c, err := s.Add(ctx, bytes.NewReader(data), opts, func(p AddProgress) { last = p })
+	if err != nil {
+		t.Fatalf("failed to add with progress: %v", err)
+	}
+	// Four leaves and the root, plus the directory the adder stages them in
+	if last.Bytes != int64(len(data)) || last.Blocks < 5 {
+		t.Errorf("final progress mismatch: have %+v, want %d bytes in at least 5 blocks", last, len(data))
+	}
+	if _, pinned, err := s.Node().Pinning.IsPinned(ctx, c); err != nil || !pinned {
+		t.Errorf("content not pinned: %v", err)
+	}
+	plain, err := s.Add(ctx, bytes.NewReader(data), opts, nil)
+	if err != nil {
+		t.Fatalf("failed to add: %v", err)
+	}
+	if c != plain {
+		t.Errorf("CID mismatch: have %s, want %s", c, plain)
+	}
+}
@@ -0,0 +1,224 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	defaultAddHookTimeout = 30 * time.Second
+
+	// addHookQueue bounds the adds waiting for their hooks, further results
+	// are dropped until the hooks catch up.
+	addHookQueue = 256
+)
+
+var (
+	errNoAddHook = errors.New("nil ethoFS add hook")
+
+	addHookFailedMeter  = metrics.NewRegisteredMeter("ethofs/addhooks/failed", nil)
+	addHookDroppedMeter = metrics.NewRegisteredMeter("ethofs/addhooks/dropped", nil)
+)
+
+// AddResult describes content successfully added to the node, handed to the
+// add hooks.
+type AddResult struct {
+	Cid       string     `json:"cid"`
+	Size      int64      `json:"size"`      // Bytes of the added content
+	Pinned    bool       `json:"pinned"`    // Whether the content was pinned by the add
+	Options   AddOptions `json:"options"`   // Options the content was added with
+	Node      string     `json:"node"`      // Peer ID of the node the content was added to
+	Timestamp uint64     `json:"timestamp"` // Unix time the add completed
+}
+
+// AddHook post-processes a successful add, e.g. registering the content in a
+// contract. Hooks run in the background after the add returned, one add at a
+// time and in registration order; a failing hook is logged and the following
+// ones still run.
+type AddHook func(ctx context.Context, result *AddResult) error
+
+type namedAddHook struct {
+	name string
+	hook AddHook
+}
+
+var (
+	addHooksLock sync.RWMutex
+	addHooks     []namedAddHook
+)
+
+// RegisterAddHook adds a hook run after every successful add. It has to be
+// called before the node is started, typically from an init function of the
+// package implementing the hook. Registering a name twice fails.
+func RegisterAddHook(name string, hook AddHook) error {
+	if hook == nil {
+		return errNoAddHook
+	}
+	if name == "" {
+		return errors.New("empty ethoFS add hook name")
+	}
+	addHooksLock.Lock()
+	defer addHooksLock.Unlock()
+
+	for _, registered := range addHooks {
+		if registered.name == name {
+			return fmt.Errorf("ethoFS add hook %q already registered", name)
+		}
+	}
+	addHooks = append(addHooks, namedAddHook{name: name, hook: hook})
+	return nil
+}
+
+// webhookAddHook POSTs the results as JSON to the URL.
+func webhookAddHook(endpoint string) AddHook {
+	client := new(http.Client)
+	return func(ctx context.Context, result *AddResult) error {
+		body, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return fmt.Errorf("webhook answered %s", res.Status)
+		}
+		return nil
+	}
+}
+
+// manifestAddHook writes the results as sidecar manifests <cid>.json into
+// the directory.
+func manifestAddHook(dir string) AddHook {
+	return func(ctx context.Context, result *AddResult) error {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, result.Cid+".json")
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+			return err
+		}
+		return os.Rename(tmp, path)
+	}
+}
+
+// addHookRunner runs the hooks of the adds in the background.
+type addHookRunner struct {
+	hooks   []namedAddHook
+	timeout time.Duration
+	queue   chan *AddResult
+}
+
+// newAddHookRunner collects the configured and the registered hooks, returning
+// nil if there are none.
+func newAddHookRunner(cfg *AddHookConfig) *addHookRunner {
+	var hooks []namedAddHook
+	if cfg.ManifestDir != "" {
+		hooks = append(hooks, namedAddHook{name: "manifest", hook: manifestAddHook(cfg.ManifestDir)})
+	}
+	for _, endpoint := range cfg.Webhooks {
+		hooks = append(hooks, namedAddHook{name: "webhook " + endpoint, hook: webhookAddHook(endpoint)})
+	}
+	addHooksLock.RLock()
+	hooks = append(hooks, addHooks...)
+	addHooksLock.RUnlock()
+
+	if len(hooks) == 0 {
+		return nil
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultAddHookTimeout
+	}
+	return &addHookRunner{hooks: hooks, timeout: timeout, queue: make(chan *AddResult, addHookQueue)}
+}
+
+// enqueue schedules the hooks of an add without waiting for them.
+func (r *addHookRunner) enqueue(result *AddResult) {
+	select {
+	case r.queue <- result:
+	default:
+		addHookDroppedMeter.Mark(1)
+		log.Warn("ethoFS - add hooks lagging, dropping result", "cid", result.Cid)
+	}
+}
+
+// run calls the hooks with the result, each bounded by the timeout.
+func (r *addHookRunner) run(ctx context.Context, result *AddResult) {
+	for _, h := range r.hooks {
+		hookCtx, cancel := context.WithTimeout(ctx, r.timeout)
+		err := h.hook(hookCtx, result)
+		cancel()
+
+		if err != nil {
+			addHookFailedMeter.Mark(1)
+			log.Warn("ethoFS - add hook failed", "hook", h.name, "cid", result.Cid, "error", err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// loop runs the hooks of the queued adds until the context is cancelled.
+func (r *addHookRunner) loop(ctx context.Context) {
+	for {
+		select {
+		case result := <-r.queue:
+			r.run(ctx, result)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// validateWebhook checks that the add hook URL can be POSTed to.
+func validateWebhook(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("missing host")
+	}
+	return nil
+}
+
+// addHookRunner returns the add hooks of the running node, or nil if it is
+// stopped or has no hooks.
+func (s *EthofsService) addHookRunner() *addHookRunner {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.hooks
+}
@@ -0,0 +1,127 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// withAddHooks clears the registered add hooks, returning a function that
+// restores the previous registrations.
+func withAddHooks() func() {
+	addHooksLock.Lock()
+	saved := addHooks
+	addHooks = nil
+	addHooksLock.Unlock()
+
+	return func() {
+		addHooksLock.Lock()
+		addHooks = saved
+		addHooksLock.Unlock()
+	}
+}
+
+func TestRegisterAddHook(t *testing.T) {
+	defer withAddHooks()()
+
+	noop := func(ctx context.Context, result *AddResult) error { return nil }
+	if err := RegisterAddHook("register", noop); err != nil {
+		t.Fatalf("failed to register hook: %v", err)
+	}
+	if err := RegisterAddHook("register", noop); err == nil {
+		t.Error("duplicate hook registered")
+	}
+	if err := RegisterAddHook("", noop); err == nil {
+		t.Error("unnamed hook registered")
+	}
+	if err := RegisterAddHook("nil", nil); err != errNoAddHook {
+		t.Errorf("nil hook error mismatch: have %v, want %v", err, errNoAddHook)
+	}
+	if runner := newAddHookRunner(&AddHookConfig{}); runner == nil || len(runner.hooks) != 1 {
+		t.Errorf("registered hook not run: %+v", runner)
+	}
+}
+
+func TestAddHookRunner(t *testing.T) {
+	defer withAddHooks()()
+
+	var posted []*AddResult
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := new(AddResult)
+		if err := json.NewDecoder(r.Body).Decode(result); err != nil {
+			t.Errorf("invalid webhook body: %v", err)
+		}
+		posted = append(posted, result)
+	}))
+	defer server.Close()
+
+	if runner := newAddHookRunner(&AddHookConfig{}); runner != nil {
+		t.Fatalf("runner without hooks: %+v", runner)
+	}
+	var calls []string
+	RegisterAddHook("failing", func(ctx context.Context, result *AddResult) error {
+		calls = append(calls, "failing")
+		return errors.New("registration reverted")
+	})
+	RegisterAddHook("register", func(ctx context.Context, result *AddResult) error {
+		calls = append(calls, "register")
+		return nil
+	})
+	dir, err := ioutil.TempDir("", "ethofs-addhooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	runner := newAddHookRunner(&AddHookConfig{Webhooks: []string{server.URL}, ManifestDir: filepath.Join(dir, "manifests")})
+
+	result := &AddResult{
+		Cid:       "QmWATWQ7fVPP2EFGu71UkfnqhYXDYH566qy47CnJDgvs8u",
+		Size:      12,
+		Pinned:    true,
+		Options:   AddOptions{Pin: true},
+		Timestamp: 1600000000,
+	}
+	runner.run(context.Background(), result)
+
+	// Failing hooks do not stop the ones registered after them
+	if want := []string{"failing", "register"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("hook calls mismatch: have %v, want %v", calls, want)
+	}
+	if len(posted) != 1 || !reflect.DeepEqual(posted[0], result) {
+		t.Errorf("webhook result mismatch: have %+v, want %+v", posted, result)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "manifests", result.Cid+".json"))
+	if err != nil {
+		t.Fatalf("manifest not written: %v", err)
+	}
+	manifest := new(AddResult)
+	if err := json.Unmarshal(data, manifest); err != nil || !reflect.DeepEqual(manifest, result) {
+		t.Errorf("manifest mismatch: have %+v (%v), want %+v", manifest, err, result)
+	}
+}
+
+func TestValidateWebhook(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		valid    bool
+	}{
+		{"https://hooks.example.org/ethofs", true},
+		{"http://127.0.0.1:8080", true},
+		{"ftp://hooks.example.org", false},
+		{"https://", false},
+		{"hooks.example.org", false},
+	}
+	for _, tt := range tests {
+		if err := validateWebhook(tt.endpoint); (err == nil) != tt.valid {
+			t.Errorf("%q: validity mismatch: have %v, want %v", tt.endpoint, err, tt.valid)
+		}
+	}
+}
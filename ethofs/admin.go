@@ -0,0 +1,130 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// adminChallengePath is where clients of the signature auth provider request
+// their challenges.
+const adminChallengePath = "/auth/challenge"
+
+var errNoAuthProviders = errors.New("ethoFS admin endpoint has no auth providers")
+
+// adminServer serves the ethofs RPC namespace over HTTP to authenticated
+// callers only. Operators wanting to restrict access to the API should leave
+// ethofs out of the modules of the regular geth RPC endpoints and use this
+// one instead.
+type adminServer struct {
+	rpc    *rpc.Server
+	server *http.Server
+}
+
+// loadJWTSecret reads a hex encoded HS256 secret from the given file.
+func loadJWTSecret(file string) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT secret: %v", err)
+	}
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("JWT secret too short: %d bytes, need 32", len(secret))
+	}
+	return secret, nil
+}
+
+// startAdminServer starts the admin endpoint serving the public and private
+// APIs, with the auth providers of the config followed by the given custom
+// ones.
+func startAdminServer(cfg *AdminConfig, api *PublicEthofsAPI, private *PrivateEthofsAPI, custom []AuthProvider) (*adminServer, error) {
+	var (
+		chain authChain
+		sigs  *signatureAuth
+	)
+	if len(cfg.Tokens) > 0 {
+		chain = append(chain, tokenAuth(cfg.Tokens))
+	}
+	if cfg.JWTSecretFile != "" {
+		secret, err := loadJWTSecret(cfg.JWTSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, newJWTAuth(secret))
+	}
+	if len(cfg.Accounts) > 0 {
+		sigs = newSignatureAuth(cfg.Accounts)
+		chain = append(chain, sigs)
+	}
+	chain = append(chain, custom...)
+	if len(chain) == 0 {
+		return nil, errNoAuthProviders
+	}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("ethofs", api); err != nil {
+		return nil, err
+	}
+	if err := srv.RegisterName("ethofsadmin", private); err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", authHandler(chain, srv))
+	if sigs != nil {
+		mux.HandleFunc(adminChallengePath, sigs.serveChallenge)
+	}
+	listener, err := net.Listen("tcp", cfg.ListenAddr)
+	if err != nil {
+		srv.Stop()
+		return nil, err
+	}
+	admin := &adminServer{
+		rpc: srv,
+		server: &http.Server{
+			Handler:      node.NewHTTPHandlerStack(mux, cfg.CORS, cfg.VirtualHosts),
+			ReadTimeout:  rpc.DefaultHTTPTimeouts.ReadTimeout,
+			WriteTimeout: rpc.DefaultHTTPTimeouts.WriteTimeout,
+			IdleTimeout:  rpc.DefaultHTTPTimeouts.IdleTimeout,
+		},
+	}
+	go admin.server.Serve(listener)
+
+	log.Info("ethoFS - admin endpoint opened", "url", fmt.Sprintf("http://%v/", listener.Addr()), "providers", len(chain))
+	return admin, nil
+}
+
+// stop closes the admin endpoint.
+func (admin *adminServer) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	admin.server.Shutdown(ctx)
+	admin.rpc.Stop()
+}
+
+// authHandler rejects requests the auth provider does not accept.
+func authHandler(auth AuthProvider, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := auth.Authenticate(r)
+		if err != nil {
+			log.Debug("ethoFS - admin request rejected", "remote", r.RemoteAddr, "error", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ethofs"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		log.Trace("ethoFS - admin request authenticated", "remote", r.RemoteAddr, "identity", identity)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,315 @@
+package ethofs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	defaultAllowlistRefresh = 10 * time.Minute
+	allowlistTimeout        = 30 * time.Second
+)
+
+// PeerRegistryABI is the interface of the contract listing the peer IDs
+// allowed in a permissioned ethoFS network.
+const PeerRegistryABI = "[{\"constant\":true,\"inputs\":[],\"name\":\"peers\",\"outputs\":[{\"name\":\"\",\"type\":\"string[]\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"}]"
+
+var (
+	errPeerNotAllowed = errors.New("peer is not on the ethoFS allow-list")
+	errNoAllowlist    = errors.New("ethoFS peer allow-list disabled")
+	errEmptyAllowlist = errors.New("ethoFS peer allow-list holds no peers")
+
+	unlistedConnMeter = metrics.NewRegisteredMeter("ethofs/swarm/conns/unlisted", nil)
+)
+
+var (
+	swarmAllowlistLock sync.RWMutex
+	swarmAllowlist     *peerAllowlist // Allowlist of the running node, nil unless it runs in strict mode
+)
+
+// currentAllowlist returns the allowlist gating the swarm of the running node,
+// or nil unless it runs in strict mode. It is loaded before the node is built,
+// so the libp2p host never admits an unlisted peer.
+func currentAllowlist() *peerAllowlist {
+	swarmAllowlistLock.RLock()
+	defer swarmAllowlistLock.RUnlock()
+
+	return swarmAllowlist
+}
+
+// setAllowlist replaces the allowlist of the running node.
+func setAllowlist(allowed *peerAllowlist) {
+	swarmAllowlistLock.Lock()
+	defer swarmAllowlistLock.Unlock()
+
+	swarmAllowlist = allowed
+}
+
+// allowlistSource is a registry the allowed peers are loaded from.
+type allowlistSource interface {
+	String() string
+	peers(ctx context.Context) ([]peer.ID, error)
+}
+
+// parseAllowlistSource parses a peer registry spec, which is one of
+//
+//	file:<path>           a file listing one peer ID per line
+//	contract:<address>    peer registry contract
+func parseAllowlistSource(spec string) (allowlistSource, error) {
+	switch {
+	case strings.HasPrefix(spec, "file:"):
+		path := strings.TrimPrefix(spec, "file:")
+		if path == "" {
+			return nil, errors.New("empty allow-list file path")
+		}
+		return fileAllowlistSource(path), nil
+	case strings.HasPrefix(spec, "contract:"):
+		addr := strings.TrimPrefix(spec, "contract:")
+		if !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("invalid peer registry address %q", addr)
+		}
+		return contractAllowlistSource(common.HexToAddress(addr)), nil
+	}
+	return nil, fmt.Errorf("unsupported allow-list source %q", spec)
+}
+
+// fileAllowlistSource reads the peers from a file, skipping empty lines and
+// # comments. The file is polled, editing it changes the membership.
+type fileAllowlistSource string
+
+func (s fileAllowlistSource) String() string { return "file:" + string(s) }
+
+func (s fileAllowlistSource) peers(ctx context.Context) ([]peer.ID, error) {
+	data, err := ioutil.ReadFile(string(s))
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			ids = append(ids, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return decodePeerIDs(ids)
+}
+
+// contractAllowlistSource reads the peers from the peer registry contract.
+type contractAllowlistSource common.Address
+
+func (s contractAllowlistSource) String() string {
+	return "contract:" + common.Address(s).Hex()
+}
+
+func (s contractAllowlistSource) peers(ctx context.Context) ([]peer.ID, error) {
+	if ethClient == nil {
+		return nil, errNoEthClient
+	}
+	parsed, err := abi.JSON(strings.NewReader(PeerRegistryABI))
+	if err != nil {
+		return nil, err
+	}
+	contract := bind.NewBoundContract(common.Address(s), parsed, ethClient, nil, nil)
+
+	var ids []string
+	if err := contract.Call(&bind.CallOpts{Context: ctx}, &ids, "peers"); err != nil {
+		return nil, err
+	}
+	return decodePeerIDs(ids)
+}
+
+// decodePeerIDs parses the peer IDs of a registry. A single malformed entry
+// fails the whole list, so a broken registry never silently drops members.
+func decodePeerIDs(ids []string) ([]peer.ID, error) {
+	peers := make([]peer.ID, 0, len(ids))
+	for _, id := range ids {
+		p, err := peer.Decode(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed peer %q: %v", id, err)
+		}
+		peers = append(peers, p)
+	}
+	if len(peers) == 0 {
+		return nil, errEmptyAllowlist
+	}
+	return peers, nil
+}
+
+// AllowlistStatus describes the peer allow-list of a strict mode node.
+type AllowlistStatus struct {
+	Source  string   `json:"source"`
+	Peers   []string `json:"peers"`           // Peer IDs allowed to connect
+	Updated uint64   `json:"updated"`         // Unix time the list was last loaded
+	Checked uint64   `json:"checked"`         // Unix time the registry was last polled
+	Error   string   `json:"error,omitempty"` // Reason the latest poll failed
+}
+
+// peerAllowlist admits only the peers of the registry to the swarm of a strict
+// mode node, see swarmGater.
+type peerAllowlist struct {
+	source   allowlistSource
+	interval time.Duration
+
+	lock    sync.RWMutex
+	peers   map[peer.ID]struct{}
+	updated time.Time
+	checked time.Time
+	err     error
+}
+
+// loadPeerAllowlist loads the configured registry, returning nil if the strict
+// mode is off. A registry failing to load fails the startup, the node never
+// runs open by accident.
+func loadPeerAllowlist(ctx context.Context, cfg *AllowlistConfig) (*peerAllowlist, error) {
+	if cfg.Source == "" {
+		return nil, nil
+	}
+	source, err := parseAllowlistSource(cfg.Source)
+	if err != nil {
+		return nil, err
+	}
+	interval := cfg.Refresh
+	if interval == 0 {
+		interval = defaultAllowlistRefresh
+	}
+	l := &peerAllowlist{source: source, interval: interval}
+	if _, err := l.refresh(ctx); err != nil {
+		return nil, fmt.Errorf("unable to load peer allow-list from %s: %v", source, err)
+	}
+	log.Info("ethoFS - strict peer mode, admitting allow-listed peers only", "source", source, "peers", len(l.peers))
+	return l, nil
+}
+
+// refresh polls the registry, returning the peers no longer allowed. A
+// failing poll keeps the current list.
+func (l *peerAllowlist) refresh(ctx context.Context) ([]peer.ID, error) {
+	ctx, cancel := context.WithTimeout(ctx, allowlistTimeout)
+	defer cancel()
+
+	ids, err := l.source.peers(ctx)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.checked, l.err = time.Now(), err
+	if err != nil {
+		return nil, err
+	}
+	peers := make(map[peer.ID]struct{}, len(ids))
+	for _, id := range ids {
+		peers[id] = struct{}{}
+	}
+	var removed []peer.ID
+	for id := range l.peers {
+		if _, ok := peers[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	l.peers, l.updated = peers, l.checked
+	return removed, nil
+}
+
+// allowed reports whether the peer may connect. Without an allow-list every
+// peer may.
+func (l *peerAllowlist) allowed(id peer.ID) bool {
+	if l == nil {
+		return true
+	}
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	_, ok := l.peers[id]
+	return ok
+}
+
+// admit checks the peer of a connection, counting the refused ones.
+func (l *peerAllowlist) admit(id peer.ID) bool {
+	if l.allowed(id) {
+		return true
+	}
+	unlistedConnMeter.Mark(1)
+	log.Trace("ethoFS - refusing connection of unlisted peer", "peer", id)
+	return false
+}
+
+// loop polls the registry every interval until the context is cancelled,
+// closing the connections of the peers dropped from it.
+func (l *peerAllowlist) loop(ctx context.Context, h host.Host) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			removed, err := l.refresh(ctx)
+			if err != nil {
+				log.Warn("ethoFS - peer allow-list refresh failed, keeping current list", "source", l.source, "error", err)
+				continue
+			}
+			for _, id := range removed {
+				log.Info("ethoFS - peer dropped from allow-list, disconnecting", "peer", id)
+				if err := h.Network().ClosePeer(id); err != nil {
+					log.Debug("ethoFS - unable to disconnect unlisted peer", "peer", id, "error", err)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// status returns the state of the allow-list.
+func (l *peerAllowlist) status() *AllowlistStatus {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	status := &AllowlistStatus{
+		Source:  l.source.String(),
+		Peers:   make([]string, 0, len(l.peers)),
+		Updated: uint64(l.updated.Unix()),
+		Checked: uint64(l.checked.Unix()),
+	}
+	for id := range l.peers {
+		status.Peers = append(status.Peers, peer.Encode(id))
+	}
+	sort.Strings(status.Peers)
+	if l.err != nil {
+		status.Error = l.err.Error()
+	}
+	return status
+}
+
+// Allowlist returns the peers a strict mode node admits.
+func (api *PublicEthofsAPI) Allowlist() (_ *AllowlistStatus, err error) {
+	defer trackCall("allowlist", time.Now(), &err)
+
+	allowed := currentAllowlist()
+	if allowed == nil {
+		return nil, errNoAllowlist
+	}
+	return allowed.status(), nil
+}
@@ -0,0 +1,125 @@
+package ethofs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+)
+
+func TestParseAllowlistSource(t *testing.T) {
+	for spec, want := range map[string]string{
+		"file:/etc/ethofs/peers":                              "file:/etc/ethofs/peers",
+		"contract:0x0000000000000000000000000000000000000abc": "contract:0x0000000000000000000000000000000000000aBc",
+	} {
+		source, err := parseAllowlistSource(spec)
+		if err != nil {
+			t.Errorf("source %q: %v", spec, err)
+			continue
+		}
+		if source.String() != want {
+			t.Errorf("source %q: have %s, want %s", spec, source, want)
+		}
+	}
+	for _, spec := range []string{"", "file:", "contract:0x123", "/etc/ethofs/peers"} {
+		if _, err := parseAllowlistSource(spec); err == nil {
+			t.Errorf("invalid source %q accepted", spec)
+		}
+	}
+}
+
+func TestPeerAllowlist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethofs-allowlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var members []peer.ID
+	for i := 0; i < 3; i++ {
+		id, err := test.RandPeerID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, id)
+	}
+	path := filepath.Join(dir, "peers")
+	write := func(lines ...string) {
+		if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("# consortium members", peer.Encode(members[0]), "", peer.Encode(members[1])+"  # second member")
+
+	// Without an allow-list every peer is admitted
+	if l, err := loadPeerAllowlist(context.Background(), &AllowlistConfig{}); l != nil || err != nil || !l.allowed(members[2]) {
+		t.Fatalf("disabled allow-list: %v, %v", l, err)
+	}
+	l, err := loadPeerAllowlist(context.Background(), &AllowlistConfig{Source: "file:" + path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gater := &swarmGater{allow: l}
+	if !gater.InterceptPeerDial(members[0]) || !gater.InterceptSecured(network.DirInbound, members[1], nil) {
+		t.Error("listed peer refused")
+	}
+	if gater.InterceptPeerDial(members[2]) || gater.InterceptAddrDial(members[2], nil) || gater.InterceptSecured(network.DirInbound, members[2], nil) {
+		t.Error("unlisted peer admitted")
+	}
+	// Membership changes take effect on refresh, reporting the dropped peers
+	write(peer.Encode(members[1]), peer.Encode(members[2]))
+	removed, err := l.refresh(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, members[:1]) {
+		t.Errorf("removed peers mismatch: have %v, want %v", removed, members[:1])
+	}
+	if l.allowed(members[0]) || !l.allowed(members[2]) {
+		t.Error("refreshed membership not applied")
+	}
+	// Broken registries keep the current list
+	write(peer.Encode(members[1]), "not a peer")
+	if _, err := l.refresh(context.Background()); err == nil {
+		t.Error("malformed allow-list accepted")
+	}
+	status := l.status()
+	if len(status.Peers) != 2 || !l.allowed(members[2]) || status.Error == "" {
+		t.Errorf("status after failed refresh mismatch: %+v", status)
+	}
+	// Failing registries fail the startup instead of running open
+	write("")
+	if _, err := loadPeerAllowlist(context.Background(), &AllowlistConfig{Source: "file:" + path}); err == nil {
+		t.Error("empty allow-list accepted")
+	}
+}
+
+func TestPeerRegistryABI(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(PeerRegistryABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN", "QmQCU2EcMqAqQPR2i9bChDtGNJchTbq5TbXJJ16u19uLTa"}
+	data, err := parsed.Methods["peers"].Outputs.Pack(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have []string
+	if err := parsed.Unpack(&have, "peers", data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("registry peers mismatch: have %v, want %v", have, want)
+	}
+	if _, err := decodePeerIDs(have); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,296 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-ipfs/core/corerepo"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// maxGetSize is the largest file returned by ethofs_get, bigger content has
+// to be retrieved through the gateway.
+const maxGetSize = 32 * MB
+
+var (
+	errNodeNotRunning = errors.New("ethoFS node not running")
+	errFileTooLarge   = errors.New("file exceeds maximum size")
+)
+
+// APIs returns the collection of RPC services the ethoFS service offers.
+func (s *EthofsService) APIs() []rpc.API {
+	apis := []rpc.API{
+		{
+			Namespace: "ethofs",
+			Version:   "1.0",
+			Service:   NewPublicEthofsAPI(s),
+			Public:    true,
+		},
+		{
+			Namespace: "ethofsadmin",
+			Version:   "1.0",
+			Service:   NewPrivateEthofsAPI(s),
+			Public:    false,
+		},
+	}
+	apis = append(apis, pluginAPIs(s)...)
+	return append(apis, chaosAPIs()...)
+}
+
+// PublicEthofsAPI provides an API to add, retrieve and pin content on the
+// embedded ethoFS node.
+type PublicEthofsAPI struct {
+	service *EthofsService
+}
+
+// NewPublicEthofsAPI creates a new ethoFS API backed by the given service.
+func NewPublicEthofsAPI(service *EthofsService) *PublicEthofsAPI {
+	return &PublicEthofsAPI{service: service}
+}
+
+// PrivateEthofsAPI provides an API to change the content, keys and settings of
+// the embedded ethoFS node. It is only served over IPC, the admin endpoint and
+// HTTP/WS endpoints explicitly enabling the ethofsadmin namespace.
+type PrivateEthofsAPI struct {
+	service *EthofsService
+}
+
+// NewPrivateEthofsAPI creates a new private ethoFS API backed by the given
+// service.
+func NewPrivateEthofsAPI(service *EthofsService) *PrivateEthofsAPI {
+	return &PrivateEthofsAPI{service: service}
+}
+
+// RepoStat contains the storage statistics of the ethoFS repo.
+type RepoStat struct {
+	RepoSize         uint64 `json:"repoSize"`
+	StorageMax       uint64 `json:"storageMax"`
+	StorageWatermark uint64 `json:"storageWatermark"`
+	NumObjects       uint64 `json:"numObjects"`
+	RepoPath         string `json:"repoPath"`
+	Version          string `json:"version"`
+}
+
+func (api *PublicEthofsAPI) coreAPI() (icore.CoreAPI, error) {
+	return serviceCoreAPI(api.service)
+}
+
+func (api *PrivateEthofsAPI) coreAPI() (icore.CoreAPI, error) {
+	return serviceCoreAPI(api.service)
+}
+
+// serviceCoreAPI returns the core API of the running node of the service.
+func serviceCoreAPI(s *EthofsService) (icore.CoreAPI, error) {
+	ipfs := s.API()
+	if ipfs == nil {
+		return nil, errNodeNotRunning
+	}
+	return ipfs, nil
+}
+
+// Get retrieves the content of the file at the given CID or ethoFS path.
+func (api *PublicEthofsAPI) Get(ctx context.Context, p string) (_ hexutil.Bytes, err error) {
+	defer trackCall("get", time.Now(), &err)
+
+	ipfs, err := api.coreAPI()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	root := contentRoot(p)
+	if missingContent.has(root) {
+		return nil, errCachedNotFound
+	}
+	if err := currentSignatures().check(ctx, root); err != nil {
+		return nil, err
+	}
+	currentProviderHints().warm(ctx, root)
+	currentPopularity().served(root)
+
+	var data []byte
+	if sessions := api.service.fetchSessions(); sessions != nil && root.Defined() {
+		// Reads below the same root share a bitswap session
+		data, err = sessions.readFile(ctx, root, parsePath(p), maxGetSize)
+	} else {
+		data, err = readFile(ctx, ipfs, parsePath(p), maxGetSize)
+	}
+	missingContent.failed(root, err)
+	return data, err
+}
+
+// RepoStat returns the storage statistics of the ethoFS repo.
+func (api *PublicEthofsAPI) RepoStat(ctx context.Context) (_ *RepoStat, err error) {
+	defer trackCall("repoStat", time.Now(), &err)
+
+	node, storage := api.service.Node(), api.service.repoStorage()
+	if node == nil || storage == nil {
+		return nil, errNodeNotRunning
+	}
+	stat, err := corerepo.RepoStat(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	return &RepoStat{
+		RepoSize:         stat.RepoSize,
+		StorageMax:       stat.StorageMax,
+		StorageWatermark: storage.watermark,
+		NumObjects:       stat.NumObjects,
+		RepoPath:         stat.RepoPath,
+		Version:          stat.Version,
+	}, nil
+}
+
+// ResolveIPNS resolves an IPNS name to the path it points at.
+func (api *PublicEthofsAPI) ResolveIPNS(ctx context.Context, name string) (_ string, err error) {
+	defer trackCall("resolveIPNS", time.Now(), &err)
+
+	return api.service.ResolveIPNS(ctx, name)
+}
+
+// Keys returns the IPNS publishing keys of the node.
+func (api *PublicEthofsAPI) Keys(ctx context.Context) (_ []*KeyInfo, err error) {
+	defer trackCall("keys", time.Now(), &err)
+
+	return api.service.ListKeys(ctx)
+}
+
+// VirtualHosts returns the hostname to site root mappings of the gateway.
+func (api *PublicEthofsAPI) VirtualHosts() map[string]string {
+	return gatewayHosts.list()
+}
+
+// Slo returns the call counts, error rates and SLO compliance of the RPC
+// methods over rolling windows.
+func (api *PublicEthofsAPI) Slo() *SLOReport {
+	return sloReport(rpcMetrics, &ethofsConfig.SLO, time.Now())
+}
+
+// Add stores the given data as a file on the ethoFS node and returns its CID.
+// Without options the content is added with the defaults and pinned.
+func (api *PrivateEthofsAPI) Add(ctx context.Context, data hexutil.Bytes, opts *AddOptions) (_ string, err error) {
+	defer trackCall("add", time.Now(), &err)
+
+	if opts == nil {
+		opts = &AddOptions{Pin: true}
+	}
+	c, err := api.service.Add(ctx, bytes.NewReader(data), *opts, nil)
+	if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
+
+// Pin recursively pins the content at the given CID.
+func (api *PrivateEthofsAPI) Pin(ctx context.Context, hash string) (_ string, err error) {
+	defer trackCall("pin", time.Now(), &err)
+
+	ipfs, err := api.coreAPI()
+	if err != nil {
+		return "", err
+	}
+	return pinAdd(ipfs, hash)
+}
+
+// Unpin removes the recursive pin of the given CID.
+func (api *PrivateEthofsAPI) Unpin(ctx context.Context, hash string) (_ string, err error) {
+	defer trackCall("unpin", time.Now(), &err)
+
+	ipfs, err := api.coreAPI()
+	if err != nil {
+		return "", err
+	}
+	return pinRemove(ipfs, hash)
+}
+
+// GC removes all unpinned blocks from the repo.
+func (api *PrivateEthofsAPI) GC(ctx context.Context) (err error) {
+	defer trackCall("gc", time.Now(), &err)
+
+	storage := api.service.repoStorage()
+	if storage == nil {
+		return errNodeNotRunning
+	}
+	return storage.gc(ctx)
+}
+
+// PublishIPNS points the IPNS name of the given key (empty for the node
+// identity) at the content of the CID and returns the name.
+func (api *PrivateEthofsAPI) PublishIPNS(ctx context.Context, hash string, key string) (_ string, err error) {
+	defer trackCall("publishIPNS", time.Now(), &err)
+
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return "", err
+	}
+	return api.service.PublishIPNS(ctx, c, key)
+}
+
+// CreateKey generates a new IPNS publishing key. Keys are not exported over
+// RPC, use the keystore of the repo to back them up.
+func (api *PrivateEthofsAPI) CreateKey(ctx context.Context, name string) (_ *KeyInfo, err error) {
+	defer trackCall("createKey", time.Now(), &err)
+
+	return api.service.CreateKey(ctx, name)
+}
+
+// SetVirtualHost maps a hostname to a site root (CID or /ipns/ name) on the
+// gateway. The mapping is not persisted across restarts.
+func (api *PrivateEthofsAPI) SetVirtualHost(host string, root string) (err error) {
+	defer trackCall("setVirtualHost", time.Now(), &err)
+
+	return gatewayHosts.set(host, root)
+}
+
+// RemoveVirtualHost drops the gateway mapping of a hostname.
+func (api *PrivateEthofsAPI) RemoveVirtualHost(host string) bool {
+	return gatewayHosts.remove(host)
+}
+
+// readFile retrieves the content of the file at the given path, failing if it
+// exceeds max bytes.
+func readFile(ctx context.Context, ipfs icore.CoreAPI, p path.Path, max int) ([]byte, error) {
+	nd, err := ipfs.Unixfs().Get(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return readFileNode(ctx, nd, p, max)
+}
+
+// readFileNode reads the file node at p, failing if it is larger than max.
+func readFileNode(ctx context.Context, nd files.Node, p path.Path, max int) ([]byte, error) {
+	file := files.ToFile(nd)
+	if file == nil {
+		return nil, fmt.Errorf("%s is not a file", p)
+	}
+	defer file.Close()
+
+	buf := new(bytes.Buffer)
+	if _, err := io.Copy(buf, io.LimitReader(newLimitedReader(ctx, file), int64(max)+1)); err != nil {
+		return nil, err
+	}
+	if buf.Len() > max {
+		return nil, fmt.Errorf("%w of %d bytes", errFileTooLarge, max)
+	}
+	return buf.Bytes(), nil
+}
+
+// parsePath interprets a bare CID as an /ipfs/ path, passing full paths
+// through unchanged.
+func parsePath(p string) path.Path {
+	if c, err := cid.Decode(p); err == nil {
+		return path.IpfsPath(c)
+	}
+	return path.New(p)
+}
@@ -0,0 +1,305 @@
+package ethofs
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// challengeLifetime is how long a signature challenge can be used to
+	// authenticate after it was issued.
+	challengeLifetime = 5 * time.Minute
+
+	// maxChallenges bounds the outstanding signature challenges.
+	maxChallenges = 1024
+
+	// maxHostChallenges bounds the outstanding signature challenges issued to
+	// a single remote host, so one client cannot use up all of them.
+	maxHostChallenges = 16
+)
+
+var (
+	// errNoCredentials is returned by auth providers if the request carries
+	// no credentials of the kind they authenticate, letting the next provider
+	// of the chain try.
+	errNoCredentials = errors.New("no credentials")
+
+	errInvalidCredentials = errors.New("invalid credentials")
+	errUnknownChallenge   = errors.New("unknown or expired challenge")
+	errTooManyChallenges  = errors.New("too many outstanding challenges")
+)
+
+// AuthProvider authenticates requests to the ethoFS admin endpoint. Custom
+// identity systems can be integrated by implementing it and adding the
+// provider to the service with AddAuthProvider.
+type AuthProvider interface {
+	// Authenticate returns the identity of the caller. Requests without
+	// credentials handled by the provider yield errNoCredentials.
+	Authenticate(r *http.Request) (string, error)
+}
+
+// authChain tries the providers in order until one accepts or rejects the
+// credentials of the request.
+type authChain []AuthProvider
+
+func (chain authChain) Authenticate(r *http.Request) (string, error) {
+	for _, provider := range chain {
+		identity, err := provider.Authenticate(r)
+		if err == errNoCredentials {
+			continue
+		}
+		return identity, err
+	}
+	return "", errNoCredentials
+}
+
+// authorizationValue returns the credentials of the Authorization header of
+// the given scheme.
+func authorizationValue(r *http.Request, scheme string) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) <= len(scheme) || !strings.EqualFold(auth[:len(scheme)+1], scheme+" ") {
+		return "", false
+	}
+	return strings.TrimSpace(auth[len(scheme)+1:]), true
+}
+
+// tokenAuth accepts static bearer tokens. Callers are identified as
+// "token:<index>" to keep the tokens themselves out of the logs.
+type tokenAuth []string
+
+func (tokens tokenAuth) Authenticate(r *http.Request) (string, error) {
+	token, ok := authorizationValue(r, "Bearer")
+	if !ok || strings.Count(token, ".") == 2 {
+		// JWTs are left to the JWT provider
+		return "", errNoCredentials
+	}
+	for i, allowed := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+			return fmt.Sprintf("token:%d", i), nil
+		}
+	}
+	return "", errInvalidCredentials
+}
+
+// jwtAuth accepts HS256 signed JSON web tokens carrying an expiry, identifying
+// callers by the subject claim.
+type jwtAuth struct {
+	secret []byte
+	now    func() time.Time
+}
+
+func newJWTAuth(secret []byte) *jwtAuth {
+	return &jwtAuth{secret: secret, now: time.Now}
+}
+
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+}
+
+func (auth *jwtAuth) Authenticate(r *http.Request) (string, error) {
+	token, ok := authorizationValue(r, "Bearer")
+	if !ok || strings.Count(token, ".") != 2 {
+		return "", errNoCredentials
+	}
+	parts := strings.Split(token, ".")
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return "", errInvalidCredentials
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errInvalidCredentials
+	}
+	mac := hmac.New(sha256.New, auth.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return "", errInvalidCredentials
+	}
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return "", errInvalidCredentials
+	}
+	now := auth.now().Unix()
+	if claims.ExpiresAt == 0 || now >= claims.ExpiresAt || now < claims.NotBefore {
+		return "", errInvalidCredentials
+	}
+	return "jwt:" + claims.Subject, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// signatureAuth accepts Ethereum signatures of issued challenges by the
+// configured accounts. Clients request a challenge from the challenge endpoint,
+// sign "ethoFS admin <challenge>" personal_sign style and authenticate with
+//
+//	Authorization: Signature <challenge>.<signature>
+//
+// Challenges are single-use, every request needs a new one.
+type signatureAuth struct {
+	accounts map[common.Address]bool
+	now      func() time.Time
+
+	lock       sync.Mutex
+	challenges map[string]issuedChallenge
+	hosts      map[string]int // Outstanding challenges per remote host
+}
+
+// issuedChallenge is an outstanding signature challenge.
+type issuedChallenge struct {
+	host   string
+	expiry time.Time
+}
+
+func newSignatureAuth(accounts []common.Address) *signatureAuth {
+	auth := &signatureAuth{
+		accounts:   make(map[common.Address]bool),
+		now:        time.Now,
+		challenges: make(map[string]issuedChallenge),
+		hosts:      make(map[string]int),
+	}
+	for _, account := range accounts {
+		auth.accounts[account] = true
+	}
+	return auth
+}
+
+// challengeMessage is the text signed to answer a challenge.
+func challengeMessage(challenge string) string {
+	return "ethoFS admin " + challenge
+}
+
+// challenge issues a new random challenge to the remote host.
+func (auth *signatureAuth) challenge(host string) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	challenge := hex.EncodeToString(nonce)
+	now := auth.now()
+
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+
+	for c, issued := range auth.challenges {
+		if now.After(issued.expiry) {
+			auth.drop(c, issued)
+		}
+	}
+	if len(auth.challenges) >= maxChallenges || auth.hosts[host] >= maxHostChallenges {
+		return "", errTooManyChallenges
+	}
+	auth.challenges[challenge] = issuedChallenge{host: host, expiry: now.Add(challengeLifetime)}
+	auth.hosts[host]++
+	return challenge, nil
+}
+
+// drop removes an outstanding challenge. The lock must be held.
+func (auth *signatureAuth) drop(challenge string, issued issuedChallenge) {
+	delete(auth.challenges, challenge)
+	if auth.hosts[issued.host]--; auth.hosts[issued.host] <= 0 {
+		delete(auth.hosts, issued.host)
+	}
+}
+
+// consume removes the challenge, reporting whether it was outstanding and
+// still valid.
+func (auth *signatureAuth) consume(challenge string) bool {
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+
+	issued, ok := auth.challenges[challenge]
+	if !ok {
+		return false
+	}
+	auth.drop(challenge, issued)
+	return !auth.now().After(issued.expiry)
+}
+
+func (auth *signatureAuth) Authenticate(r *http.Request) (string, error) {
+	value, ok := authorizationValue(r, "Signature")
+	if !ok {
+		return "", errNoCredentials
+	}
+	parts := strings.SplitN(value, ".", 2)
+	if len(parts) != 2 {
+		return "", errInvalidCredentials
+	}
+	auth.lock.Lock()
+	issued, ok := auth.challenges[parts[0]]
+	auth.lock.Unlock()
+	if !ok || auth.now().After(issued.expiry) {
+		return "", errUnknownChallenge
+	}
+	sig, err := hexutil.Decode(parts[1])
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return "", errInvalidCredentials
+	}
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash([]byte(challengeMessage(parts[0]))), sig)
+	if err != nil {
+		return "", errInvalidCredentials
+	}
+	signer := crypto.PubkeyToAddress(*pub)
+	if !auth.accounts[signer] {
+		return "", errInvalidCredentials
+	}
+	// Another request may have used the challenge since it was looked up
+	if !auth.consume(parts[0]) {
+		return "", errUnknownChallenge
+	}
+	return "account:" + signer.Hex(), nil
+}
+
+// serveChallenge hands out a new challenge as JSON.
+func (auth *signatureAuth) serveChallenge(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	challenge, err := auth.challenge(host)
+	if err == errTooManyChallenges {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"challenge": challenge,
+		"message":   challengeMessage(challenge),
+		"expires":   auth.now().Add(challengeLifetime).Unix(),
+	})
+}
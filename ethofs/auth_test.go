@@ -0,0 +1,126 @@
+package ethofs
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// signJWT creates an HS256 token with the given claims.
+func signJWT(secret []byte, claims string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(header + "." + payload))
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthChain(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	jwt := newJWTAuth(secret)
+	jwt.now = func() time.Time { return time.Unix(1000, 0) }
+
+	chain := authChain{tokenAuth{"secret"}, jwt}
+
+	tests := []struct {
+		auth     string
+		identity string
+		err      error
+	}{
+		{"", "", errNoCredentials},
+		{"Basic dXNlcjpwYXNz", "", errNoCredentials},
+		{"Bearer secret", "token:0", nil},
+		{"bearer secret", "token:0", nil},
+		{"Bearer wrong", "", errInvalidCredentials},
+		{"Bearer " + signJWT(secret, `{"sub":"ops","exp":2000}`), "jwt:ops", nil},
+		{"Bearer " + signJWT(secret, `{"sub":"ops","exp":500}`), "", errInvalidCredentials},
+		{"Bearer " + signJWT(secret, `{"sub":"ops"}`), "", errInvalidCredentials},
+		{"Bearer " + signJWT(secret, `{"sub":"ops","exp":2000,"nbf":1500}`), "", errInvalidCredentials},
+		{"Bearer " + signJWT([]byte("other secret"), `{"sub":"ops","exp":2000}`), "", errInvalidCredentials},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", "/", nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		identity, err := chain.Authenticate(req)
+		if identity != tt.identity || err != tt.err {
+			t.Errorf("test %d: have (%q, %v), want (%q, %v)", i, identity, err, tt.identity, tt.err)
+		}
+	}
+}
+
+func TestSignatureAuth(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	account := crypto.PubkeyToAddress(key.PublicKey)
+
+	now := time.Unix(1000, 0)
+	auth := newSignatureAuth([]common.Address{account})
+	auth.now = func() time.Time { return now }
+
+	challenge, err := auth.challenge("127.0.0.1")
+	if err != nil {
+		t.Fatalf("failed to issue challenge: %v", err)
+	}
+	authenticate := func(challenge string, signer *ecdsa.PrivateKey) (string, error) {
+		sig, _ := crypto.Sign(accounts.TextHash([]byte(challengeMessage(challenge))), signer)
+		sig[crypto.RecoveryIDOffset] += 27
+
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Authorization", "Signature "+challenge+"."+hexutil.Encode(sig))
+		return auth.Authenticate(req)
+	}
+	if _, err := authenticate(challenge, other); err != errInvalidCredentials {
+		t.Errorf("signature of unknown account: have %v, want %v", err, errInvalidCredentials)
+	}
+	if identity, err := authenticate(challenge, key); err != nil || identity != "account:"+account.Hex() {
+		t.Errorf("valid signature rejected: (%q, %v)", identity, err)
+	}
+	if _, err := authenticate(challenge, key); err != errUnknownChallenge {
+		t.Errorf("reused challenge: have %v, want %v", err, errUnknownChallenge)
+	}
+	if _, err := authenticate("deadbeef", key); err != errUnknownChallenge {
+		t.Errorf("unknown challenge: have %v, want %v", err, errUnknownChallenge)
+	}
+	if challenge, err = auth.challenge("127.0.0.1"); err != nil {
+		t.Fatalf("failed to issue challenge: %v", err)
+	}
+	now = now.Add(challengeLifetime + time.Second)
+	if _, err := authenticate(challenge, key); err != errUnknownChallenge {
+		t.Errorf("expired challenge: have %v, want %v", err, errUnknownChallenge)
+	}
+}
+
+func TestSignatureAuthHostLimit(t *testing.T) {
+	now := time.Unix(1000, 0)
+	auth := newSignatureAuth(nil)
+	auth.now = func() time.Time { return now }
+
+	for i := 0; i < maxHostChallenges; i++ {
+		if _, err := auth.challenge("10.0.0.1"); err != nil {
+			t.Fatalf("challenge %d: %v", i, err)
+		}
+	}
+	if _, err := auth.challenge("10.0.0.1"); err != errTooManyChallenges {
+		t.Errorf("challenge beyond host limit: have %v, want %v", err, errTooManyChallenges)
+	}
+	if _, err := auth.challenge("10.0.0.2"); err != nil {
+		t.Errorf("challenge of other host rejected: %v", err)
+	}
+	// Expired challenges free up the slots of their host
+	now = now.Add(challengeLifetime + time.Second)
+	if _, err := auth.challenge("10.0.0.1"); err != nil {
+		t.Errorf("challenge after expiry rejected: %v", err)
+	}
+}
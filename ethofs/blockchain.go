@@ -6,6 +6,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
 	"io"
 	"math/big"
 	"math/rand"
@@ -20,43 +21,53 @@ var pinResponseFlag = false
 var pinResponseCount = uint64(10)
 var ethClient *ethclient.Client
 
+// pinStorageAddress is the hosting contract holding the pin lists of ethoFS.
+var pinStorageAddress = common.HexToAddress("0xD3b80c611999D46895109d75322494F7A49D742F")
+
 func checkPinResponse(pinNumber uint64) {
 	if pinNumber >= pinResponseCount {
 		pinResponseFlag = false
 	}
 }
 
-func initializeEthClient() error {
-	c, err := ethclient.Dial(ipcLocation)
-	if err != nil {
-		return err
-	}
-	ethClient = c
-	return nil
+func initializeEthClient(client *rpc.Client) {
+	ethClient = ethclient.NewClient(client)
 }
 
-func updatePinContractValues() error {
+// updatePinContractValues samples the pin lists of the hosting contract and
+// pins or unpins their content to reach the replication target. The contract
+// calls are bounded, failing the sync while the chain backend is stalled.
+func updatePinContractValues(ctx context.Context) error {
 	if(pinResponseFlag) {
 		return nil // Returning as pin response collection still in process
 	}
 
+	inst, err := Instance()
+	if err != nil {
+		return err
+	}
 	c := ethClient
 
-	address := common.HexToAddress("0xD3b80c611999D46895109d75322494F7A49D742F")
-	contract, err := NewPinStorage(address, c)
+	contract, err := NewPinStorage(pinStorageAddress, c)
 	if err != nil {
 		return err
 	}
-	repFactorResp, err := contract.ReplicationFactor(nil)
+	opts, cancel := chainCallOpts(ctx)
+	defer cancel()
+
+	repFactorResp, err := contract.ReplicationFactor(opts)
 	if err != nil {
 		return err
 	}
 	repFactor = uint64(repFactorResp)
 
-	pinCountResp, err := contract.PinCount(nil)
+	pinCountResp, err := contract.PinCount(opts)
 	if err != nil {
 		return err
 	}
+	if pinCountResp == 0 {
+		return nil
+	}
 
 	lowerRange := rand.Intn(int(pinCountResp))
 	for j := uint64(0); j < pinResponseCount; j++ {
@@ -71,7 +82,9 @@ func updatePinContractValues() error {
 				pinNumber = uint64(lowerRange) + x
 			}
 			i := new(big.Int).SetUint64(pinNumber)
-			contractPin, err := contract.Pins(nil, i)
+			opts, cancel := chainCallOpts(ctx)
+			contractPin, err := contract.Pins(opts, i)
+			cancel()
 			if err != nil {
 				log.Debug("ethoFS - ether-1 contract connection error (Contract Pin)", "error", err, "number", i)
 				checkPinResponse(x)
@@ -87,10 +100,10 @@ func updatePinContractValues() error {
 			// Request serialized pin list stored on ethoFS
 			resolvedPath := path.IpfsPath(cid)
 
-			ctx, cancelCtx := context.WithTimeout(context.Background(), 15*time.Second)
+			ctx, cancelCtx := context.WithTimeout(ctx, 15*time.Second)
 			defer cancelCtx()
 
-			resp, err := Ipfs.Unixfs().Get(ctx, resolvedPath)
+			resp, err := inst.API.Unixfs().Get(ctx, resolvedPath)
 			if err != nil {
 				log.Debug("ethoFS - data retrieval error", "hash", cid, "error", err)
 				checkPinResponse(x)
@@ -109,31 +122,37 @@ func updatePinContractValues() error {
 
 			for _, pin := range cids {
 				log.Debug("ethoFS - pin request detail", "hash", pin, "number", i)
-				pinned := pinSearch(pin, localPinMapping)
+				pinned := pinSearch(pin)
 				if !pinned {
 					log.Debug("ethoFS - pin search error", "error", "the requested pin was not found")
 				} else {
 					log.Debug("ethoFS - data is pinned to local node", "hash", pin)
 				}
+				if !pinned && lapsedContractPin(pin) {
+					log.Debug("ethoFS - skipping pin of lapsed hosting period", "hash", pin)
+					continue
+				}
 
-				providerCount, err := FindProvs(Node, pin)
+				providerCount, err := FindProvs(inst.Node, pin)
 				if err != nil {
 					log.Debug("ethoFS - provider search error", "error", err)
 					continue
 				}
 
-				if !pinned && providerCount < (repFactor/uint64(2)) {
+				target := replicationTarget(pin)
+				if !pinned && providerCount < (target/uint64(2)) {
 					// Pin data due to insufficient existing providers
-					addedPin, err := pinAdd(Ipfs, pin)
+					addedPin, err := pinAdd(inst.API, pin)
 					if err != nil {
 						log.Debug("ethoFS - pin add error", "hash", pin, "error", err)
 						continue
 					} else {
 						log.Debug("ethoFS - pin added successfully", "hash", addedPin)
+						trackContractPin(addedPin)
 					}
-				} else if pinned && providerCount > (repFactor+(repFactor/uint64(2))) {
+				} else if pinned && providerCount > (target+(target/uint64(2))) {
 					// Pin data due to insufficient existing providers
-					removedPin, err := pinRemove(Ipfs, pin)
+					removedPin, err := pinRemove(inst.API, pin)
 					if err != nil {
 						log.Debug("ethoFS - pin removal error", "hash", pin, "error", err)
 						continue
@@ -0,0 +1,120 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// defaultMinBootstrapPeers is the number of bootstrap peers that have to be
+// reachable for the node to count as bootstrapped.
+const defaultMinBootstrapPeers = 1
+
+// PeerResult is the outcome of dialing a single peer, or of a request to it.
+type PeerResult struct {
+	ID      peer.ID
+	Err     error         // Nil if the connection was established or the request confirmed
+	Latency time.Duration // Time taken by the dial or request, successful or not
+}
+
+// Success reports whether the peer was connected or confirmed the request.
+func (r PeerResult) Success() bool {
+	return r.Err == nil
+}
+
+// MarshalJSON renders the result for RPC callers.
+func (r PeerResult) MarshalJSON() ([]byte, error) {
+	type peerResult struct {
+		ID      string `json:"id"`
+		Success bool   `json:"success"`
+		Error   string `json:"error,omitempty"`
+		Latency string `json:"latency"`
+	}
+	res := peerResult{
+		ID:      r.ID.Pretty(),
+		Success: r.Success(),
+		Latency: r.Latency.String(),
+	}
+	if r.Err != nil {
+		res.Error = r.Err.Error()
+	}
+	return json.Marshal(res)
+}
+
+// BootstrapError is returned if fewer peers than required could be connected.
+type BootstrapError struct {
+	Connected int
+	Required  int
+	Results   []PeerResult
+}
+
+func (e *BootstrapError) Error() string {
+	return fmt.Sprintf("connected to %d of %d peers, %d required", e.Connected, len(e.Results), e.Required)
+}
+
+// ErrorCode implements rpc.Error, an incomplete bootstrap leaves the node
+// offline.
+func (e *BootstrapError) ErrorCode() int { return ErrCodeOffline }
+
+// ErrorData implements rpc.DataError, handing the outcome per peer to RPC
+// callers along with the reason of the error.
+func (e *BootstrapError) ErrorData() interface{} {
+	return &struct {
+		RPCErrorData
+		Connected int          `json:"connected"`
+		Required  int          `json:"required"`
+		Results   []PeerResult `json:"results"`
+	}{RPCErrorData{Reason: ErrReasonOffline}, e.Connected, e.Required, e.Results}
+}
+
+// checkConnected fails if fewer than the required number of the dialed peers
+// were connected. The requirement is capped to the number of dialed peers.
+func checkConnected(results []PeerResult, required int) error {
+	if required > len(results) {
+		required = len(results)
+	}
+	var connected int
+	for _, r := range results {
+		if r.Success() {
+			connected++
+		}
+	}
+	if connected < required {
+		return &BootstrapError{Connected: connected, Required: required, Results: results}
+	}
+	return nil
+}
+
+// Bootstrap dials the given peers, or the configured bootstrap nodes if none
+// are given, and returns the outcome per peer. It fails with a
+// *BootstrapError if fewer than the configured minimum could be connected.
+func (s *EthofsService) Bootstrap(ctx context.Context, peers []string) ([]PeerResult, error) {
+	ipfs := s.API()
+	if ipfs == nil {
+		return nil, errNodeNotRunning
+	}
+	if len(peers) == 0 {
+		peers = s.config.bootstrapNodes()
+	}
+	results, err := connectToPeers(ctx, ipfs, peers, s.config.MinBootstrapPeers)
+	if _, ok := err.(*BootstrapError); ok {
+		if node := s.Node(); node != nil {
+			if mismatch := dialFailures.swarmKeyMismatch(len(node.PeerHost.Network().Peers())); mismatch != nil {
+				return results, mismatch
+			}
+		}
+	}
+	return results, err
+}
+
+// Bootstrap dials the given peers (the configured bootstrap nodes if empty)
+// and returns the outcome per peer. Falling short of the configured minimum
+// fails with the outcome per peer in the data of the error.
+func (api *PrivateEthofsAPI) Bootstrap(ctx context.Context, peers []string) (_ []PeerResult, err error) {
+	defer trackCall("bootstrap", time.Now(), &err)
+
+	return api.service.Bootstrap(ctx, peers)
+}
@@ -0,0 +1,66 @@
+package ethofs
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestCheckConnected(t *testing.T) {
+	failed := errors.New("dial failed")
+	results := []PeerResult{{ID: "a"}, {ID: "b", Err: failed}, {ID: "c", Err: failed}}
+
+	if err := checkConnected(results, 1); err != nil {
+		t.Errorf("minimum met, unexpected error: %v", err)
+	}
+	err := checkConnected(results, 2)
+	berr, ok := err.(*BootstrapError)
+	if !ok {
+		t.Fatalf("expected bootstrap error, have %v", err)
+	}
+	if berr.Connected != 1 || berr.Required != 2 {
+		t.Errorf("error mismatch: have %d/%d connected, want 1/2", berr.Connected, berr.Required)
+	}
+	// The minimum is capped to the number of peers dialed
+	if err := checkConnected(results[:1], 3); err != nil {
+		t.Errorf("capped minimum met, unexpected error: %v", err)
+	}
+	if err := checkConnected(nil, 1); err != nil {
+		t.Errorf("no peers dialed, unexpected error: %v", err)
+	}
+	if err := checkConnected(results[1:], 3); err == nil {
+		t.Error("no peer connected, expected error")
+	}
+}
+
+func TestBootstrapRPCError(t *testing.T) {
+	results := []PeerResult{{ID: "a", Err: errors.New("dial failed")}}
+	err := rpcError(checkConnected(results, 1))
+
+	rerr, ok := err.(rpc.DataError)
+	if !ok {
+		t.Fatalf("bootstrap error carries no data: %v", err)
+	}
+	if code := err.(rpc.Error).ErrorCode(); code != ErrCodeOffline {
+		t.Errorf("error code mismatch: have %d, want %d", code, ErrCodeOffline)
+	}
+	data, err := json.Marshal(rerr.ErrorData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Reason  string `json:"reason"`
+		Results []struct {
+			Success bool   `json:"success"`
+			Error   string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Reason != ErrReasonOffline || len(decoded.Results) != 1 || decoded.Results[0].Error != "dial failed" {
+		t.Errorf("error data mismatch: %s", data)
+	}
+}
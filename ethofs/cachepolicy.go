@@ -0,0 +1,225 @@
+package ethofs
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	blocks "github.com/ipfs/go-block-format"
+	blockservice "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs/core"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	merkledag "github.com/ipfs/go-merkledag"
+	gopath "github.com/ipfs/go-path"
+)
+
+// Cache policies of content fetched from the swarm on behalf of gateway users.
+const (
+	// cachePolicyCache keeps fetched blocks in the repo until garbage
+	// collection removes them.
+	cachePolicyCache = "cache"
+
+	// cachePolicyNoStore evicts the unpinned blocks of fetched content once
+	// the response was served, keeping the repo reserved for pinned content.
+	cachePolicyNoStore = "no-store"
+)
+
+const (
+	// evictTimeout bounds the eviction of the blocks fetched for a request.
+	evictTimeout = time.Minute
+
+	// evictQueueSize bounds the requests waiting for their blocks to be
+	// evicted. Blocks of requests beyond it are left to garbage collection.
+	evictQueueSize = 256
+)
+
+var (
+	evictedBlockMeter = metrics.NewRegisteredMeter("ethofs/gateway/evicted", nil)
+	evictDroppedMeter = metrics.NewRegisteredMeter("ethofs/gateway/evicted/dropped", nil)
+)
+
+// noStoreOption evicts the content fetched from the swarm for gateway requests.
+// The requested file is fetched up front recording the blocks the request had
+// to retrieve, only those are evicted once the response was served. Blocks the
+// gateway handler fetches beyond, e.g. of big files, are kept until garbage
+// collection.
+func noStoreOption() corehttp.ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		evict := newEvictor(n.Context(), n.Blockstore, n.Pinning)
+
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			var fetched []cid.Cid
+			if root := remoteRoot(n, r); root.Defined() {
+				fetched = fetchRecorded(r.Context(), n, r.URL.Path)
+			}
+			childMux.ServeHTTP(w, r)
+
+			if len(fetched) > 0 {
+				evict.queue(fetched)
+			}
+		})
+		return childMux, nil
+	}
+}
+
+// remoteRoot returns the root CID of the requested content if it has to be
+// fetched from the swarm.
+func remoteRoot(n *core.IpfsNode, r *http.Request) cid.Cid {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return cid.Undef
+	}
+	ns, root, _ := splitContentPath(r.URL.Path)
+	if ns != "/ipfs" {
+		return cid.Undef
+	}
+	c, err := cid.Decode(root)
+	if err != nil {
+		return cid.Undef
+	}
+	if has, err := n.Blockstore.Has(c); err != nil || has {
+		return cid.Undef
+	}
+	return c
+}
+
+// fetchRecorder is an exchange recording the blocks it retrieves, which are
+// the blocks missing from the blockstore of the block service using it.
+type fetchRecorder struct {
+	exchange.Interface
+
+	lock    sync.Mutex
+	fetched []cid.Cid
+}
+
+func (e *fetchRecorder) record(b blocks.Block) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.fetched = append(e.fetched, b.Cid())
+}
+
+// GetBlock implements exchange.Fetcher, recording the retrieved block.
+func (e *fetchRecorder) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	b, err := e.Interface.GetBlock(ctx, c)
+	if err == nil {
+		e.record(b)
+	}
+	return b, err
+}
+
+// GetBlocks implements exchange.Fetcher, recording the retrieved blocks.
+func (e *fetchRecorder) GetBlocks(ctx context.Context, cids []cid.Cid) (<-chan blocks.Block, error) {
+	in, err := e.Interface.GetBlocks(ctx, cids)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan blocks.Block)
+	go func() {
+		defer close(out)
+		for b := range in {
+			e.record(b)
+			select {
+			case out <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// recorded returns the retrieved blocks.
+func (e *fetchRecorder) recorded() []cid.Cid {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return append([]cid.Cid(nil), e.fetched...)
+}
+
+// fetchRecorded prefetches the content path, returning the blocks that had to
+// be retrieved from the swarm. Errors are left to the gateway handler to
+// report.
+func fetchRecorded(ctx context.Context, n *core.IpfsNode, p string) []cid.Cid {
+	rec := &fetchRecorder{Interface: n.Exchange}
+	dag := merkledag.NewDAGService(blockservice.New(n.Blockstore, rec))
+
+	if err := prefetchPath(ctx, dag, gopath.Path(p)); err != nil {
+		log.Trace("ethoFS - fetch of no-store content failed", "path", p, "error", err)
+	}
+	return rec.recorded()
+}
+
+// evictor removes the unpinned blocks of served requests, one request at a
+// time.
+type evictor struct {
+	bs      blockstore.GCBlockstore
+	pinning pin.Pinner
+	pending chan []cid.Cid
+}
+
+// newEvictor creates an evictor working until the context is cancelled.
+func newEvictor(ctx context.Context, bs blockstore.GCBlockstore, pinning pin.Pinner) *evictor {
+	e := &evictor{bs: bs, pinning: pinning, pending: make(chan []cid.Cid, evictQueueSize)}
+	go e.loop(ctx)
+	return e
+}
+
+// queue schedules the eviction of the blocks, dropping them if the queue is
+// full.
+func (e *evictor) queue(cids []cid.Cid) {
+	select {
+	case e.pending <- cids:
+	default:
+		evictDroppedMeter.Mark(1)
+		log.Debug("ethoFS - eviction queue full, keeping fetched content", "blocks", len(cids))
+	}
+}
+
+func (e *evictor) loop(ctx context.Context) {
+	for {
+		select {
+		case cids := <-e.pending:
+			evictCtx, cancel := context.WithTimeout(ctx, evictTimeout)
+			if err := evictUnpinned(evictCtx, e.bs, e.pinning, cids); err != nil {
+				log.Debug("ethoFS - eviction of fetched content failed", "blocks", len(cids), "error", err)
+			}
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// evictUnpinned removes the blocks that are not pinned, directly or
+// indirectly.
+func evictUnpinned(ctx context.Context, bs blockstore.GCBlockstore, pinning pin.Pinner, cids []cid.Cid) error {
+	// Hold the pin lock so no pin can claim the blocks while they are deleted
+	defer bs.PinLock().Unlock()
+
+	pinned, err := pinning.CheckIfPinned(ctx, cids...)
+	if err != nil {
+		return err
+	}
+	var evicted int
+	for _, p := range pinned {
+		if p.Mode != pin.NotPinned {
+			continue
+		}
+		if err := bs.DeleteBlock(p.Key); err == nil {
+			evicted++
+		}
+	}
+	evictedBlockMeter.Mark(int64(evicted))
+	log.Trace("ethoFS - evicted fetched content", "blocks", evicted)
+	return nil
+}
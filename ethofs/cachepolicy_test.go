@@ -0,0 +1,92 @@
+package ethofs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func TestFetchRecorder(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		local  = merkledag.NewRawNode([]byte("cached leaf"))
+		remote = merkledag.NewRawNode([]byte("remote leaf"))
+		root   = merkledag.NodeWithData([]byte("root"))
+	)
+	root.AddNodeLink("local", local)
+	root.AddNodeLink("remote", remote)
+
+	// The swarm holds the whole DAG, the node only the cached leaf
+	swarm := blockstore.NewBlockstore(dsync.MutexWrap(datastore.NewMapDatastore()))
+	for _, nd := range []ipld.Node{local, remote, root} {
+		if err := swarm.Put(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bs := blockstore.NewBlockstore(dsync.MutexWrap(datastore.NewMapDatastore()))
+	if err := bs.Put(local); err != nil {
+		t.Fatal(err)
+	}
+	rec := &fetchRecorder{Interface: offline.Exchange(swarm)}
+	dag := merkledag.NewDAGService(blockservice.New(bs, rec))
+	if err := merkledag.FetchGraph(ctx, root.Cid(), dag); err != nil {
+		t.Fatal(err)
+	}
+	fetched := make(map[cid.Cid]bool)
+	for _, c := range rec.recorded() {
+		fetched[c] = true
+	}
+	if len(fetched) != 2 || !fetched[root.Cid()] || !fetched[remote.Cid()] {
+		t.Errorf("recorded blocks mismatch: have %v, want root and remote leaf", rec.recorded())
+	}
+}
+
+func TestEvictUnpinned(t *testing.T) {
+	ctx := context.Background()
+	ds := dsync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewGCBlockstore(blockstore.NewBlockstore(ds), blockstore.NewGCLocker())
+	dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	pinner := pin.NewPinner(ds, dag, dag)
+
+	var (
+		sharedLeaf = merkledag.NewRawNode([]byte("pinned leaf"))
+		pinned     = merkledag.NodeWithData([]byte("pinned"))
+		fetched    = merkledag.NewRawNode([]byte("fetched leaf"))
+		cached     = merkledag.NewRawNode([]byte("cached before the request"))
+	)
+	pinned.AddNodeLink("leaf", sharedLeaf)
+	if err := dag.AddMany(ctx, []ipld.Node{sharedLeaf, pinned, fetched, cached}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pinner.Pin(ctx, pinned, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := evictUnpinned(ctx, bs, pinner, []cid.Cid{sharedLeaf.Cid(), fetched.Cid()}); err != nil {
+		t.Fatal(err)
+	}
+	for nd, want := range map[ipld.Node]bool{sharedLeaf: true, pinned: true, fetched: false, cached: true} {
+		if has, _ := bs.Has(nd.Cid()); has != want {
+			t.Errorf("block %s: stored %v, want %v", nd.Cid(), has, want)
+		}
+	}
+}
+
+func TestEvictorQueue(t *testing.T) {
+	e := &evictor{pending: make(chan []cid.Cid, 1)}
+	e.queue([]cid.Cid{merkledag.NewRawNode([]byte("a")).Cid()})
+	e.queue([]cid.Cid{merkledag.NewRawNode([]byte("b")).Cid()})
+
+	if len(e.pending) != 1 {
+		t.Errorf("queued evictions mismatch: have %d, want 1", len(e.pending))
+	}
+}
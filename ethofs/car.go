@@ -0,0 +1,78 @@
+package ethofs
+
+import (
+	"context"
+	"io"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-ipfs/core"
+	merkledag "github.com/ipfs/go-merkledag"
+	car "github.com/ipld/go-car"
+)
+
+// importCAR stores the blocks of the CAR file in the blockstore of the node
+// and recursively pins its roots. Blocks missing from the file are fetched
+// from the swarm.
+func importCAR(ctx context.Context, node *core.IpfsNode, r io.Reader) ([]cid.Cid, error) {
+	// Keep the garbage collector from removing the blocks before they are
+	// pinned
+	defer node.Blockstore.PinLock().Unlock()
+
+	header, err := car.LoadCar(node.Blockstore, r)
+	if err != nil {
+		return nil, err
+	}
+	for _, root := range header.Roots {
+		nd, err := node.DAG.Get(ctx, root)
+		if err != nil {
+			return nil, err
+		}
+		if err := node.Pinning.Pin(ctx, nd, true); err != nil {
+			return nil, err
+		}
+		notifyPinAdded(root)
+		ownPin(root, pinOwnerImport)
+		feeds.contentPinned.Send(ContentPinned{Cid: root})
+		if err := node.Provider.Provide(root); err != nil {
+			log.Debug("ethoFS - unable to announce imported content", "cid", root, "error", err)
+		}
+	}
+	if err := node.Pinning.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return header.Roots, nil
+}
+
+// ExportCAR writes the DAG below c to w as a CAR file, e.g. to back up pinned
+// content or to move it to another node offline. The DAG is read from the
+// local blockstore only, never from the swarm: the export fails if any block
+// of it is missing.
+func (s *EthofsService) ExportCAR(ctx context.Context, c cid.Cid, w io.Writer) error {
+	node := s.Node()
+	if node == nil {
+		return errNodeNotRunning
+	}
+	dag := merkledag.NewDAGService(blockservice.New(node.Blockstore, offline.Exchange(node.Blockstore)))
+	return car.WriteCar(ctx, currentDAGWorkers().getter(dag), []cid.Cid{c}, w)
+}
+
+// ImportCAR stores the content of a CAR file, as written by ExportCAR, and
+// pins its roots, seeding the node with content it does not have to fetch.
+// Pinning walks the complete DAGs of the roots, so blocks missing from a
+// partial file are fetched from the swarm. It returns the imported roots.
+func (s *EthofsService) ImportCAR(ctx context.Context, r io.Reader) ([]cid.Cid, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	roots, err := importCAR(ctx, node, r)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("ethoFS - imported CAR file", "roots", roots)
+	return roots, nil
+}
@@ -0,0 +1,102 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	car "github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+)
+
+func TestCARRoundTrip(t *testing.T) {
+	src, stopSrc := newTestService(t)
+	defer stopSrc()
+	dst, stopDst := newTestService(t)
+	defer stopDst()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var (
+		leaf = merkledag.NewRawNode([]byte("leaf"))
+		root = merkledag.NodeWithData([]byte("root"))
+	)
+	root.AddNodeLink("leaf", leaf)
+	if err := src.Node().DAG.AddMany(ctx, []ipld.Node{leaf, root}); err != nil {
+		t.Fatal(err)
+	}
+	var file bytes.Buffer
+	if err := src.ExportCAR(ctx, root.Cid(), &file); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	roots, err := dst.ImportCAR(ctx, bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	if len(roots) != 1 || !roots[0].Equals(root.Cid()) {
+		t.Errorf("imported roots mismatch: have %v, want %v", roots, root.Cid())
+	}
+	if _, pinned, err := dst.Node().Pinning.IsPinnedWithType(ctx, root.Cid(), pin.Recursive); err != nil || !pinned {
+		t.Errorf("imported root not pinned: %v", err)
+	}
+	if has, err := dst.Node().Blockstore.Has(leaf.Cid()); err != nil || !has {
+		t.Errorf("imported leaf missing: %v", err)
+	}
+}
+
+func TestCARExportLocalOnly(t *testing.T) {
+	s, stop := newTestService(t)
+	defer stop()
+
+	var (
+		leaf = merkledag.NewRawNode([]byte("missing leaf"))
+		root = merkledag.NodeWithData([]byte("root"))
+	)
+	root.AddNodeLink("leaf", leaf)
+	if err := s.Node().DAG.Add(context.Background(), root); err != nil {
+		t.Fatal(err)
+	}
+	// Missing blocks fail the export right away instead of being fetched
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s.ExportCAR(ctx, root.Cid(), new(bytes.Buffer)); err == nil || ctx.Err() != nil {
+		t.Errorf("incomplete DAG export: have %v, want immediate failure", err)
+	}
+}
+
+func TestCARImportFetchesMissing(t *testing.T) {
+	s, stop := newTestService(t)
+	defer stop()
+
+	var (
+		leaf = merkledag.NewRawNode([]byte("missing leaf"))
+		root = merkledag.NodeWithData([]byte("root"))
+	)
+	root.AddNodeLink("leaf", leaf)
+
+	// A file without the leaf leaves pinning to fetch it, which times out
+	// without peers
+	var file bytes.Buffer
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{root.Cid()}, Version: 1}, &file); err != nil {
+		t.Fatal(err)
+	}
+	if err := util.LdWrite(&file, root.Cid().Bytes(), root.RawData()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := s.ImportCAR(ctx, &file); err == nil {
+		t.Fatal("imported incomplete DAG without its blocks")
+	}
+	if ctx.Err() == nil {
+		t.Error("import failed without trying to fetch the missing block")
+	}
+}
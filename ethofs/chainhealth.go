@@ -0,0 +1,275 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// chainProbeInterval is how often the chain backend is probed.
+	chainProbeInterval = 30 * time.Second
+
+	// chainCallTimeout bounds the calls to the chain backend, so a stalled
+	// backend fails the contract sync instead of blocking it.
+	chainCallTimeout = 15 * time.Second
+
+	// chainStaleAfter is the age of the head block above which the contract
+	// state is considered outdated, e.g. while the chain is syncing.
+	chainStaleAfter = 10 * time.Minute
+
+	// maxChainTasks bounds the contract sync work queued while the backend is
+	// unavailable.
+	maxChainTasks = 1024
+)
+
+var errChainUnavailable = errors.New("chain backend unavailable, contract sync queued")
+
+var (
+	chainAvailableGauge = metrics.NewRegisteredGauge("ethofs/chain/available", nil)
+	chainQueueGauge     = metrics.NewRegisteredGauge("ethofs/chain/queue", nil)
+)
+
+var (
+	chainBackendLock sync.RWMutex
+	chainBackend     *chainMonitor // Monitor of the running node, nil while no node runs
+)
+
+// currentChainBackend returns the chain monitor of the running node, or nil if
+// no node runs. Contract sync work runs right away without a monitor.
+func currentChainBackend() *chainMonitor {
+	chainBackendLock.RLock()
+	defer chainBackendLock.RUnlock()
+
+	return chainBackend
+}
+
+// setChainBackend replaces the chain monitor of the running node.
+func setChainBackend(m *chainMonitor) {
+	chainBackendLock.Lock()
+	defer chainBackendLock.Unlock()
+
+	chainBackend = m
+}
+
+// ChainStatus is the state of the chain backend used for the contract sync.
+type ChainStatus struct {
+	Available bool   `json:"available"`       // Backend answered the latest probe
+	Stale     bool   `json:"stale"`           // Head block too old for an up to date contract state
+	Head      uint64 `json:"head"`            // Number of the latest known head block
+	HeadTime  uint64 `json:"headTime"`        // Unix time of the head block
+	Checked   uint64 `json:"checked"`         // Unix time of the latest probe, zero before the first one
+	Since     uint64 `json:"since"`           // Unix time the backend became available or unavailable
+	Queued    int    `json:"queued"`          // Contract sync tasks waiting for the backend
+	Error     string `json:"error,omitempty"` // Reason the latest probe failed
+}
+
+// chainTask is contract sync work needing the chain backend.
+type chainTask func(ctx context.Context) error
+
+// chainMonitor probes the chain backend, queueing the contract sync work while
+// it is unavailable and running it once the backend recovers. Serving and
+// pinning content never depend on the backend.
+type chainMonitor struct {
+	probe func(ctx context.Context) (*types.Header, error)
+
+	lock    sync.Mutex
+	up      bool
+	checked time.Time
+	since   time.Time
+	head    *types.Header
+	err     error
+	tasks   map[string]chainTask
+	order   []string
+}
+
+func newChainMonitor() *chainMonitor {
+	return &chainMonitor{
+		probe: probeChainHead,
+		up:    true,
+		since: time.Now(),
+		tasks: make(map[string]chainTask),
+	}
+}
+
+// probeChainHead asks the chain client for the head block.
+func probeChainHead(ctx context.Context) (*types.Header, error) {
+	if ethClient == nil {
+		return nil, errNoEthClient
+	}
+	header, err := ethClient.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, errNoChainHead
+	}
+	return header, nil
+}
+
+// chainCallOpts returns the options of a contract call bounded by the call
+// timeout.
+func chainCallOpts(ctx context.Context) (*bind.CallOpts, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, chainCallTimeout)
+	return &bind.CallOpts{Context: ctx}, cancel
+}
+
+// loop probes the backend right away and then every interval until the
+// context is cancelled, running the queued work once the backend recovers.
+func (m *chainMonitor) loop(ctx context.Context) {
+	ticker := time.NewTicker(chainProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		if m.check(ctx) == nil {
+			m.drain(ctx)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check probes the backend, tracking the changes of its availability.
+func (m *chainMonitor) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, chainCallTimeout)
+	defer cancel()
+
+	head, err := m.probe(ctx)
+	if ctx.Err() == context.Canceled {
+		return ctx.Err()
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := time.Now()
+	m.checked, m.err = now, err
+	if err == nil {
+		m.head = head
+	}
+	if up := err == nil; up != m.up {
+		m.up, m.since = up, now
+		if up {
+			log.Info("ethoFS - chain backend recovered, resuming contract sync", "head", head.Number, "queued", len(m.order))
+		} else {
+			log.Warn("ethoFS - chain backend unavailable, serving content and queueing contract sync", "error", err)
+		}
+	}
+	if m.up {
+		chainAvailableGauge.Update(1)
+	} else {
+		chainAvailableGauge.Update(0)
+	}
+	return err
+}
+
+// available reports whether the backend answered the latest probe.
+func (m *chainMonitor) available() bool {
+	if m == nil {
+		return true
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.up
+}
+
+// submit runs the contract sync work if the backend is available, queueing it
+// otherwise. Work failing along with a probe of the backend is queued too.
+// Queued work replaces the work queued earlier under the same key.
+func (m *chainMonitor) submit(ctx context.Context, key string, task chainTask) error {
+	if m == nil {
+		return task(ctx)
+	}
+	if !m.available() {
+		m.queue(key, task)
+		return errChainUnavailable
+	}
+	err := task(ctx)
+	if err != nil && ctx.Err() == nil && m.check(ctx) != nil {
+		m.queue(key, task)
+		return errChainUnavailable
+	}
+	return err
+}
+
+// queue stores the work until the backend recovers.
+func (m *chainMonitor) queue(key string, task chainTask) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.tasks[key]; !ok {
+		if len(m.order) >= maxChainTasks {
+			log.Warn("ethoFS - contract sync queue full, dropping work", "task", key)
+			return
+		}
+		m.order = append(m.order, key)
+	}
+	m.tasks[key] = task
+	chainQueueGauge.Update(int64(len(m.order)))
+	log.Debug("ethoFS - contract sync queued until the chain backend recovers", "task", key)
+}
+
+// drain runs the queued work in submission order while the backend stays
+// available.
+func (m *chainMonitor) drain(ctx context.Context) {
+	for ctx.Err() == nil && m.available() {
+		m.lock.Lock()
+		if len(m.order) == 0 {
+			m.lock.Unlock()
+			return
+		}
+		key := m.order[0]
+		task := m.tasks[key]
+		m.order = m.order[1:]
+		delete(m.tasks, key)
+		chainQueueGauge.Update(int64(len(m.order)))
+		m.lock.Unlock()
+
+		if err := m.submit(ctx, key, task); err != nil && err != errChainUnavailable {
+			log.Debug("ethoFS - queued contract sync failed", "task", key, "error", err)
+		}
+	}
+}
+
+// status returns the state of the backend.
+func (m *chainMonitor) status() *ChainStatus {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	status := &ChainStatus{
+		Available: m.up,
+		Since:     uint64(m.since.Unix()),
+		Queued:    len(m.order),
+	}
+	if !m.checked.IsZero() {
+		status.Checked = uint64(m.checked.Unix())
+	}
+	if m.head != nil {
+		status.Head, status.HeadTime = m.head.Number.Uint64(), m.head.Time
+		status.Stale = time.Since(time.Unix(int64(m.head.Time), 0)) > chainStaleAfter
+	}
+	if m.err != nil {
+		status.Error = m.err.Error()
+	}
+	return status
+}
+
+// Chain returns the state of the chain backend used for the contract sync.
+func (api *PublicEthofsAPI) Chain() (_ *ChainStatus, err error) {
+	defer trackCall("chain", time.Now(), &err)
+
+	m := currentChainBackend()
+	if m == nil {
+		return nil, errNodeNotRunning
+	}
+	return m.status(), nil
+}
@@ -0,0 +1,105 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestChainMonitorQueue(t *testing.T) {
+	ctx := context.Background()
+	m := newChainMonitor()
+
+	var (
+		down = errors.New("connection refused")
+		head = &types.Header{Number: big.NewInt(100), Time: uint64(time.Now().Unix())}
+		err  error
+	)
+	m.probe = func(ctx context.Context) (*types.Header, error) {
+		if err != nil {
+			return nil, err
+		}
+		return head, nil
+	}
+	var ran []string
+	task := func(name string) chainTask {
+		return func(ctx context.Context) error {
+			if err != nil {
+				return err
+			}
+			ran = append(ran, name)
+			return nil
+		}
+	}
+	// Work runs right away while the backend is available
+	if err := m.submit(ctx, "a", task("a")); err != nil {
+		t.Fatalf("submit on available backend failed: %v", err)
+	}
+	// Work failing with the backend is queued
+	err = down
+	if err := m.submit(ctx, "b", task("b")); err != errChainUnavailable {
+		t.Fatalf("failing submit error mismatch: have %v, want %v", err, errChainUnavailable)
+	}
+	if m.available() {
+		t.Fatal("backend still available after failed probe")
+	}
+	m.submit(ctx, "c", task("c"))
+	m.submit(ctx, "b", task("b2"))
+
+	status := m.status()
+	if status.Available || status.Queued != 2 || status.Error != down.Error() {
+		t.Fatalf("degraded status mismatch: %+v", status)
+	}
+	// Recovery drains the queue in order, the latest work of a key replacing
+	// the earlier one
+	err = nil
+	if err := m.check(ctx); err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	m.drain(ctx)
+	if want := []string{"a", "b2", "c"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("executed work mismatch: have %v, want %v", ran, want)
+	}
+	status = m.status()
+	if !status.Available || status.Queued != 0 || status.Head != 100 || status.Stale {
+		t.Errorf("recovered status mismatch: %+v", status)
+	}
+	// Failures unrelated to the backend are returned, not queued
+	failure := errors.New("invalid pin list")
+	if err := m.submit(ctx, "d", func(ctx context.Context) error { return failure }); err != failure {
+		t.Errorf("task error mismatch: have %v, want %v", err, failure)
+	}
+	if queued := m.status().Queued; queued != 0 {
+		t.Errorf("failed task queued: %d tasks", queued)
+	}
+}
+
+func TestChainMonitorStale(t *testing.T) {
+	m := newChainMonitor()
+	m.probe = func(ctx context.Context) (*types.Header, error) {
+		return &types.Header{Number: big.NewInt(5), Time: uint64(time.Now().Add(-time.Hour).Unix())}, nil
+	}
+	if err := m.check(context.Background()); err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	if status := m.status(); !status.Available || !status.Stale {
+		t.Errorf("syncing chain status mismatch: %+v", status)
+	}
+}
+
+func TestChainMonitorNil(t *testing.T) {
+	var m *chainMonitor
+
+	ran := false
+	if err := m.submit(context.Background(), "a", func(ctx context.Context) error { ran = true; return nil }); err != nil || !ran {
+		t.Errorf("work without monitor not run: %v", err)
+	}
+	if !m.available() {
+		t.Error("missing monitor reported unavailable")
+	}
+}
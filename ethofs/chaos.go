@@ -0,0 +1,303 @@
+// +build ethofschaos
+
+package ethofs
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// bitswapProtocolPrefix matches all versions of the bitswap protocol.
+const bitswapProtocolPrefix = "/ipfs/bitswap"
+
+// maxChaosMessageSize bounds the bitswap messages relayed by the fault
+// injection layer, mirroring the libp2p stream message limit.
+const maxChaosMessageSize = network.MessageSizeMax
+
+var errChaosDrop = errors.New("stream dropped by fault injection")
+
+// chaos is the fault injection controller of the package. It only exists in
+// builds with the ethofschaos tag.
+var chaos = &ChaosController{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// ChaosController injects faults into the libp2p host of the ethoFS node to
+// test the resilience of replication and retrieval. It is only compiled into
+// builds with the ethofschaos tag and must never be enabled in production.
+type ChaosController struct {
+	lock     sync.Mutex
+	host     host.Host
+	rand     *rand.Rand
+	dropRate float64       // fraction of inbound bitswap messages dropped
+	latency  time.Duration // delay added to stream opens and inbound messages
+	jitter   time.Duration // random extra delay up to this duration
+}
+
+// Chaos returns the fault injection controller.
+func Chaos() *ChaosController {
+	return chaos
+}
+
+// SetDropRate sets the percentage (0-100) of inbound bitswap messages that are
+// silently dropped.
+func (c *ChaosController) SetDropRate(percent float64) {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.dropRate = percent / 100
+	log.Warn("ethoFS - chaos: bitswap message drop rate set", "percent", percent)
+}
+
+// SetLatency delays every stream open and inbound bitswap message by the given
+// latency plus a random jitter.
+func (c *ChaosController) SetLatency(latency, jitter time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.latency, c.jitter = latency, jitter
+	log.Warn("ethoFS - chaos: latency injection set", "latency", latency, "jitter", jitter)
+}
+
+// KillConnections closes the given fraction (0-1) of the open swarm
+// connections, picked at random, and returns the number of closed ones.
+func (c *ChaosController) KillConnections(fraction float64) int {
+	c.lock.Lock()
+	h := c.host
+	c.lock.Unlock()
+	if h == nil {
+		return 0
+	}
+	conns := h.Network().Conns()
+
+	c.lock.Lock()
+	c.rand.Shuffle(len(conns), func(i, j int) { conns[i], conns[j] = conns[j], conns[i] })
+	c.lock.Unlock()
+
+	kill := int(float64(len(conns))*fraction + 0.5)
+	if kill > len(conns) {
+		kill = len(conns)
+	}
+	for _, conn := range conns[:kill] {
+		conn.Close()
+	}
+	log.Warn("ethoFS - chaos: connections killed", "killed", kill, "open", len(conns))
+	return kill
+}
+
+// KillPeer closes all connections to the given peer.
+func (c *ChaosController) KillPeer(id peer.ID) error {
+	c.lock.Lock()
+	h := c.host
+	c.lock.Unlock()
+	if h == nil {
+		return errNodeNotRunning
+	}
+	return h.Network().ClosePeer(id)
+}
+
+// Reset disables all fault injection.
+func (c *ChaosController) Reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.dropRate, c.latency, c.jitter = 0, 0, 0
+}
+
+// drop decides whether to drop the next message.
+func (c *ChaosController) drop() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.dropRate > 0 && c.rand.Float64() < c.dropRate
+}
+
+// delay returns the latency to inject into the next operation.
+func (c *ChaosController) delay() time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	d := c.latency
+	if c.jitter > 0 {
+		d += time.Duration(c.rand.Int63n(int64(c.jitter)))
+	}
+	return d
+}
+
+// wrapChaos puts the fault injection layer between the node and its libp2p
+// host.
+func wrapChaos(h host.Host) host.Host {
+	chaos.lock.Lock()
+	chaos.host = h
+	chaos.lock.Unlock()
+
+	log.Warn("ethoFS - fault injection layer enabled, do not use in production")
+	return &chaosHost{Host: h, chaos: chaos}
+}
+
+// chaosHost injects latency into stream opens and drops inbound bitswap
+// messages.
+type chaosHost struct {
+	host.Host
+	chaos *ChaosController
+}
+
+// NewStream implements host.Host, delaying the stream open.
+func (h *chaosHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (network.Stream, error) {
+	if d := h.chaos.delay(); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return h.Host.NewStream(ctx, p, pids...)
+}
+
+// SetStreamHandler implements host.Host, filtering inbound bitswap streams.
+func (h *chaosHost) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
+	if strings.HasPrefix(string(pid), bitswapProtocolPrefix) {
+		handler = h.filter(handler)
+	}
+	h.Host.SetStreamHandler(pid, handler)
+}
+
+// SetStreamHandlerMatch implements host.Host, filtering inbound bitswap streams.
+func (h *chaosHost) SetStreamHandlerMatch(pid protocol.ID, match func(string) bool, handler network.StreamHandler) {
+	if strings.HasPrefix(string(pid), bitswapProtocolPrefix) {
+		handler = h.filter(handler)
+	}
+	h.Host.SetStreamHandlerMatch(pid, match, handler)
+}
+
+// filter relays the varint framed messages of a stream to the handler,
+// dropping and delaying them as configured.
+func (h *chaosHost) filter(handler network.StreamHandler) network.StreamHandler {
+	return func(s network.Stream) {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(h.relay(s, pw))
+		}()
+		handler(&chaosStream{Stream: s, reader: pr})
+	}
+}
+
+// relay copies the messages of the stream to the pipe until the stream ends.
+func (h *chaosHost) relay(s network.Stream, w io.Writer) error {
+	var (
+		reader = bufio.NewReader(s)
+		header = make([]byte, binary.MaxVarintLen64)
+	)
+	for {
+		size, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return err
+		}
+		if size > maxChaosMessageSize {
+			return errors.New("bitswap message too large")
+		}
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			return err
+		}
+		if h.chaos.drop() {
+			log.Trace("ethoFS - chaos: dropped bitswap message", "peer", s.Conn().RemotePeer(), "size", size)
+			continue
+		}
+		if d := h.chaos.delay(); d > 0 {
+			time.Sleep(d)
+		}
+		n := binary.PutUvarint(header, size)
+		if _, err := w.Write(header[:n]); err != nil {
+			return err
+		}
+		if _, err := w.Write(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// chaosStream is an inbound stream read through the fault injection relay.
+type chaosStream struct {
+	network.Stream
+	reader *io.PipeReader
+}
+
+func (s *chaosStream) Read(p []byte) (int, error) {
+	return s.reader.Read(p)
+}
+
+func (s *chaosStream) Close() error {
+	s.reader.CloseWithError(errChaosDrop)
+	return s.Stream.Close()
+}
+
+func (s *chaosStream) Reset() error {
+	s.reader.CloseWithError(errChaosDrop)
+	return s.Stream.Reset()
+}
+
+// chaosAPIs returns the RPC API controlling the fault injection layer.
+func chaosAPIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "ethofschaos",
+			Version:   "1.0",
+			Service:   &PrivateChaosAPI{chaos: chaos},
+		},
+	}
+}
+
+// PrivateChaosAPI exposes the fault injection controller over RPC for
+// resilience tests driving a node from the outside.
+type PrivateChaosAPI struct {
+	chaos *ChaosController
+}
+
+// SetDropRate sets the percentage of inbound bitswap messages dropped.
+func (api *PrivateChaosAPI) SetDropRate(percent float64) {
+	api.chaos.SetDropRate(percent)
+}
+
+// SetLatency sets the injected latency and jitter, in milliseconds.
+func (api *PrivateChaosAPI) SetLatency(latencyMs, jitterMs uint64) {
+	api.chaos.SetLatency(time.Duration(latencyMs)*time.Millisecond, time.Duration(jitterMs)*time.Millisecond)
+}
+
+// KillConnections closes the given fraction of the swarm connections.
+func (api *PrivateChaosAPI) KillConnections(fraction float64) int {
+	return api.chaos.KillConnections(fraction)
+}
+
+// KillPeer closes all connections to the given peer.
+func (api *PrivateChaosAPI) KillPeer(id string) error {
+	pid, err := peer.Decode(id)
+	if err != nil {
+		return err
+	}
+	return api.chaos.KillPeer(pid)
+}
+
+// Reset disables all fault injection.
+func (api *PrivateChaosAPI) Reset() {
+	api.chaos.Reset()
+}
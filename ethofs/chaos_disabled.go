@@ -0,0 +1,19 @@
+// +build !ethofschaos
+
+package ethofs
+
+import (
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/libp2p/go-libp2p-core/host"
+)
+
+// wrapChaos is a no-op without the ethofschaos build tag.
+func wrapChaos(h host.Host) host.Host {
+	return h
+}
+
+// chaosAPIs is empty without the ethofschaos build tag.
+func chaosAPIs() []rpc.API {
+	return nil
+}
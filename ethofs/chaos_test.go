@@ -0,0 +1,77 @@
+// +build ethofschaos
+
+package ethofs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+// bufferStream is a fake stream reading from a buffer.
+type bufferStream struct {
+	network.Stream
+	reader io.Reader
+}
+
+func (s *bufferStream) Read(p []byte) (int, error) {
+	return s.reader.Read(p)
+}
+
+func frame(msgs ...string) []byte {
+	var buf bytes.Buffer
+	header := make([]byte, binary.MaxVarintLen64)
+	for _, msg := range msgs {
+		n := binary.PutUvarint(header, uint64(len(msg)))
+		buf.Write(header[:n])
+		buf.WriteString(msg)
+	}
+	return buf.Bytes()
+}
+
+func TestChaosDropRate(t *testing.T) {
+	c := &ChaosController{rand: rand.New(rand.NewSource(1))}
+	for i := 0; i < 100; i++ {
+		if c.drop() {
+			t.Fatal("dropped message without drop rate")
+		}
+	}
+	c.SetDropRate(150)
+	for i := 0; i < 100; i++ {
+		if !c.drop() {
+			t.Fatal("kept message with full drop rate")
+		}
+	}
+	c.SetDropRate(50)
+	dropped := 0
+	for i := 0; i < 1000; i++ {
+		if c.drop() {
+			dropped++
+		}
+	}
+	if dropped < 400 || dropped > 600 {
+		t.Errorf("drop count %d too far off 50%%", dropped)
+	}
+	c.Reset()
+	if c.drop() || c.delay() != 0 {
+		t.Error("faults injected after reset")
+	}
+}
+
+func TestChaosRelay(t *testing.T) {
+	var (
+		h    = &chaosHost{chaos: &ChaosController{rand: rand.New(rand.NewSource(1))}}
+		data = frame("want", "", "block")
+		out  bytes.Buffer
+	)
+	if err := h.relay(&bufferStream{reader: bytes.NewReader(data)}, &out); err != io.EOF {
+		t.Fatalf("unexpected relay error: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("relayed messages mismatch: have %x, want %x", out.Bytes(), data)
+	}
+}
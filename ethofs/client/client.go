@@ -0,0 +1,702 @@
+// Package client provides a client for the ethoFS RPC API of a remote geth
+// node, so applications can store and retrieve content without embedding an
+// ethoFS node themselves.
+//
+// Methods changing the node, like adding content or collecting garbage, call
+// the private ethofsadmin namespace, which the node only serves over IPC, its
+// admin endpoint and HTTP/WS endpoints enabling the namespace explicitly.
+package client
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// writeChunkSize is the size of the chunks WriteFile uploads a stream in,
+// keeping every request well below the request size limits of the node.
+const writeChunkSize = 1024 * 1024
+
+// Client defines typed wrappers for the ethoFS RPC API.
+type Client struct {
+	c *rpc.Client
+}
+
+// Dial connects a client to the given URL.
+func Dial(rawurl string) (*Client, error) {
+	return DialContext(context.Background(), rawurl)
+}
+
+// DialContext connects a client to the given URL, aborting the connection
+// attempt once the context is cancelled.
+func DialContext(ctx context.Context, rawurl string) (*Client, error) {
+	c, err := rpc.DialContext(ctx, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(c), nil
+}
+
+// NewClient creates a client that uses the given RPC client.
+func NewClient(c *rpc.Client) *Client {
+	return &Client{c}
+}
+
+// Close closes the underlying RPC connection.
+func (ec *Client) Close() {
+	ec.c.Close()
+}
+
+// Content
+
+// Add stores the data as a file on the node and returns its CID. Nil options
+// add the content with the defaults of the node and pin it.
+func (ec *Client) Add(ctx context.Context, data []byte, opts *AddOptions) (string, error) {
+	var hash string
+	err := ec.c.CallContext(ctx, &hash, "ethofsadmin_add", hexutil.Bytes(data), opts)
+	return hash, err
+}
+
+// AddWithReceipt stores the data as a file on the node and returns a receipt of
+// the upload signed by the uploader account, anchored on chain if requested.
+func (ec *Client) AddWithReceipt(ctx context.Context, data []byte, opts ReceiptOptions) (*Receipt, error) {
+	var receipt *Receipt
+	err := ec.c.CallContext(ctx, &receipt, "ethofsadmin_addWithReceipt", hexutil.Bytes(data), opts)
+	return receipt, err
+}
+
+// VerifyReceipt checks on the node that the receipt is signed by its uploader.
+func (ec *Client) VerifyReceipt(ctx context.Context, receipt *Receipt) (bool, error) {
+	var valid bool
+	err := ec.c.CallContext(ctx, &valid, "ethofs_verifyReceipt", receipt)
+	return valid, err
+}
+
+// Get retrieves the content of the file at the given CID or ethoFS path.
+func (ec *Client) Get(ctx context.Context, path string) ([]byte, error) {
+	var data hexutil.Bytes
+	err := ec.c.CallContext(ctx, &data, "ethofs_get", path)
+	return data, err
+}
+
+// Pin recursively pins the content at the given CID.
+func (ec *Client) Pin(ctx context.Context, hash string) (string, error) {
+	var pinned string
+	err := ec.c.CallContext(ctx, &pinned, "ethofsadmin_pin", hash)
+	return pinned, err
+}
+
+// Unpin removes the recursive pin of the content at the given CID.
+func (ec *Client) Unpin(ctx context.Context, hash string) (string, error) {
+	var unpinned string
+	err := ec.c.CallContext(ctx, &unpinned, "ethofsadmin_unpin", hash)
+	return unpinned, err
+}
+
+// ListPins returns a page of the pins of the node. The next page starts
+// after the CID of the last returned pin.
+func (ec *Client) ListPins(ctx context.Context, opts *PinListOptions) ([]PinInfo, error) {
+	var pins []PinInfo
+	err := ec.c.CallContext(ctx, &pins, "ethofs_listPins", opts)
+	return pins, err
+}
+
+// PinSize returns the disk usage attributable to the recursively pinned CID,
+// accounting for the blocks it shares with other pins.
+func (ec *Client) PinSize(ctx context.Context, hash string) (*PinSize, error) {
+	var size *PinSize
+	err := ec.c.CallContext(ctx, &size, "ethofs_pinSize", hash)
+	return size, err
+}
+
+// ExtendPin prolongs the hosting period of the pinned CID to the given block
+// height, after which the node drops the pin.
+func (ec *Client) ExtendPin(ctx context.Context, hash string, expiry uint64) error {
+	return ec.c.CallContext(ctx, nil, "ethofsadmin_extendPin", hash, expiry)
+}
+
+// PinExpiries returns the pins of the node with an expiry, soonest first.
+func (ec *Client) PinExpiries(ctx context.Context) ([]PinExpiry, error) {
+	var expiries []PinExpiry
+	err := ec.c.CallContext(ctx, &expiries, "ethofs_pinExpiries")
+	return expiries, err
+}
+
+// PinQuorum pins the CID and waits until n quorum peers of the node (the
+// configured quorum if zero) confirmed holding it.
+func (ec *Client) PinQuorum(ctx context.Context, hash string, n int) ([]PeerResult, error) {
+	var results []PeerResult
+	err := ec.c.CallContext(ctx, &results, "ethofsadmin_pinQuorum", hash, n)
+	return results, err
+}
+
+// Migrate streams the selected pinned DAGs of the node (all recursive pins if
+// the filter is nil) to the target peer, optionally unpinning them once the
+// target confirmed receipt.
+func (ec *Client) Migrate(ctx context.Context, target string, filter *MigrateFilter, unpin bool) ([]MigrateResult, error) {
+	var results []MigrateResult
+	err := ec.c.CallContext(ctx, &results, "ethofsadmin_migrate", target, filter, unpin)
+	return results, err
+}
+
+// Node
+
+// Peers returns the swarm peers the node is connected to, all of them if the
+// page is nil.
+func (ec *Client) Peers(ctx context.Context, page *PageOptions) ([]PeerInfo, error) {
+	var peers []PeerInfo
+	err := ec.c.CallContext(ctx, &peers, "ethofs_peers", page)
+	return peers, err
+}
+
+// Connect dials the peer at the multiaddr, which has to end in its peer ID.
+func (ec *Client) Connect(ctx context.Context, addr string) error {
+	return ec.c.CallContext(ctx, nil, "ethofsadmin_connect", addr)
+}
+
+// Disconnect closes all connections of the node to the peer.
+func (ec *Client) Disconnect(ctx context.Context, id string) error {
+	return ec.c.CallContext(ctx, nil, "ethofsadmin_disconnect", id)
+}
+
+// DenyPeer disconnects the peer and keeps the node from connecting to it
+// until it is allowed again.
+func (ec *Client) DenyPeer(ctx context.Context, id string, reason string) error {
+	return ec.c.CallContext(ctx, nil, "ethofsadmin_denyPeer", id, reason)
+}
+
+// AllowPeer removes the peer from the denylist of the node, reporting whether
+// it was on it.
+func (ec *Client) AllowPeer(ctx context.Context, id string) (bool, error) {
+	var removed bool
+	err := ec.c.CallContext(ctx, &removed, "ethofsadmin_allowPeer", id)
+	return removed, err
+}
+
+// DeniedPeers lists the peer denylist of the node.
+func (ec *Client) DeniedPeers(ctx context.Context) ([]DeniedPeer, error) {
+	var peers []DeniedPeer
+	err := ec.c.CallContext(ctx, &peers, "ethofs_deniedPeers")
+	return peers, err
+}
+
+// RepoStat returns the storage statistics of the repo of the node.
+func (ec *Client) RepoStat(ctx context.Context) (*RepoStat, error) {
+	var stat *RepoStat
+	err := ec.c.CallContext(ctx, &stat, "ethofs_repoStat")
+	return stat, err
+}
+
+// GC runs a garbage collection of the unpinned content of the node.
+func (ec *Client) GC(ctx context.Context) error {
+	return ec.c.CallContext(ctx, nil, "ethofsadmin_gC")
+}
+
+// GCPreview reports what a garbage collection of the node would remove,
+// without removing anything.
+func (ec *Client) GCPreview(ctx context.Context) (*GCPreview, error) {
+	var preview *GCPreview
+	err := ec.c.CallContext(ctx, &preview, "ethofs_gCPreview")
+	return preview, err
+}
+
+// History returns the recent operations of the node passing the filter, newest
+// first. A nil filter returns the whole history.
+func (ec *Client) History(ctx context.Context, opts *HistoryOptions) ([]Operation, error) {
+	var ops []Operation
+	err := ec.c.CallContext(ctx, &ops, "ethofs_history", opts)
+	return ops, err
+}
+
+// GoOnline restarts the node running in offline mode with networking.
+func (ec *Client) GoOnline(ctx context.Context) error {
+	return ec.c.CallContext(ctx, nil, "ethofsadmin_goOnline")
+}
+
+// Startup returns the state of the node startup.
+func (ec *Client) Startup(ctx context.Context) (*StartupStatus, error) {
+	var status *StartupStatus
+	err := ec.c.CallContext(ctx, &status, "ethofs_startup")
+	return status, err
+}
+
+// Status returns the health report of the node.
+func (ec *Client) Status(ctx context.Context) (*HealthStatus, error) {
+	var status *HealthStatus
+	err := ec.c.CallContext(ctx, &status, "ethofs_status")
+	return status, err
+}
+
+// IPNS
+
+// PublishIPNS points the IPNS name of the key (the node identity if empty)
+// at the content and returns the published name.
+func (ec *Client) PublishIPNS(ctx context.Context, hash string, key string) (string, error) {
+	var name string
+	err := ec.c.CallContext(ctx, &name, "ethofsadmin_publishIPNS", hash, key)
+	return name, err
+}
+
+// ResolveIPNS returns the path the IPNS name points to.
+func (ec *Client) ResolveIPNS(ctx context.Context, name string) (string, error) {
+	var path string
+	err := ec.c.CallContext(ctx, &path, "ethofs_resolveIPNS", name)
+	return path, err
+}
+
+// CreateKey creates a new IPNS key on the node.
+func (ec *Client) CreateKey(ctx context.Context, name string) (*KeyInfo, error) {
+	var key *KeyInfo
+	err := ec.c.CallContext(ctx, &key, "ethofsadmin_createKey", name)
+	return key, err
+}
+
+// Keys lists the IPNS keys of the node.
+func (ec *Client) Keys(ctx context.Context) ([]*KeyInfo, error) {
+	var keys []*KeyInfo
+	err := ec.c.CallContext(ctx, &keys, "ethofs_keys")
+	return keys, err
+}
+
+// Pubsub
+
+// Publish broadcasts the data to the subscribers of the pubsub topic.
+func (ec *Client) Publish(ctx context.Context, topic string, data []byte) error {
+	return ec.c.CallContext(ctx, nil, "ethofs_publish", topic, hexutil.Bytes(data))
+}
+
+// SubscribeMessages subscribes to the messages of the pubsub topic. The
+// connection has to support notifications, e.g. a websocket or IPC one.
+func (ec *Client) SubscribeMessages(ctx context.Context, topic string, ch chan<- Message) (ethereum.Subscription, error) {
+	return ec.c.Subscribe(ctx, "ethofs", ch, "messages", topic)
+}
+
+// SubscribeEvents subscribes to the ethoFS activity of the node: node starts,
+// peer connections, added and pinned content, garbage collections and failed
+// replications. The connection has to support notifications.
+func (ec *Client) SubscribeEvents(ctx context.Context, ch chan<- Event) (ethereum.Subscription, error) {
+	return ec.c.Subscribe(ctx, "ethofs", ch, "events")
+}
+
+// Mutable files
+
+// FilesMkdir creates a directory in the mutable files tree, along with its
+// missing parents if requested.
+func (ec *Client) FilesMkdir(ctx context.Context, path string, parents bool) error {
+	return ec.c.CallContext(ctx, nil, "ethofsadmin_filesMkdir", path, parents)
+}
+
+// FilesWrite writes the data to a file of the mutable files tree.
+func (ec *Client) FilesWrite(ctx context.Context, path string, data []byte, opts *FilesWriteOptions) error {
+	return ec.c.CallContext(ctx, nil, "ethofsadmin_filesWrite", path, hexutil.Bytes(data), opts)
+}
+
+// FilesRead returns the content of a file of the mutable files tree.
+func (ec *Client) FilesRead(ctx context.Context, path string) ([]byte, error) {
+	var data hexutil.Bytes
+	err := ec.c.CallContext(ctx, &data, "ethofs_filesRead", path)
+	return data, err
+}
+
+// Ls lists the directory at the given CID or ethoFS path, all of its entries
+// if the page is nil.
+func (ec *Client) Ls(ctx context.Context, path string, page *PageOptions) ([]DirEntry, error) {
+	var entries []DirEntry
+	err := ec.c.CallContext(ctx, &entries, "ethofs_ls", path, page)
+	return entries, err
+}
+
+// Fetch retrieves the complete content of the CID into the repo of the node
+// using parallel block requests. Nil options select the node defaults.
+func (ec *Client) Fetch(ctx context.Context, hash string, opts *FetchOptions) (*FetchStat, error) {
+	var stat *FetchStat
+	err := ec.c.CallContext(ctx, &stat, "ethofsadmin_fetch", hash, opts)
+	return stat, err
+}
+
+// Reconcile brings the pins of the node in line with the given CIDs, or with
+// the pin lists of the hosting contract if none are given. Pins owned by
+// ethoFS are kept. Dry runs only report the changes.
+func (ec *Client) Reconcile(ctx context.Context, hashes []string, opts *ReconcileOptions) (*ReconcileReport, error) {
+	var report *ReconcileReport
+	err := ec.c.CallContext(ctx, &report, "ethofsadmin_reconcile", hashes, opts)
+	return report, err
+}
+
+// ReadPinList reads a desired pin set for Reconcile from a list of CIDs, one
+// per line. Blank lines and lines starting with # are skipped.
+func ReadPinList(r io.Reader) ([]string, error) {
+	var hashes []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hashes = append(hashes, line)
+	}
+	return hashes, scanner.Err()
+}
+
+// SelfTest checks the disk, ports, swarm key, clock, bootstrap peers and chain
+// connectivity of the node.
+func (ec *Client) SelfTest(ctx context.Context) (*SelfTestReport, error) {
+	var report *SelfTestReport
+	err := ec.c.CallContext(ctx, &report, "ethofs_selfTest")
+	return report, err
+}
+
+// Providers looks up the peers of the network holding the CID. Nil options
+// select the node defaults.
+func (ec *Client) Providers(ctx context.Context, hash string, opts *ProviderOptions) (*ProviderRecords, error) {
+	var records *ProviderRecords
+	err := ec.c.CallContext(ctx, &records, "ethofs_providers", hash, opts)
+	return records, err
+}
+
+// DedupStat returns how much the repo of the node deduplicates the locally
+// stored DAG of the CID.
+func (ec *Client) DedupStat(ctx context.Context, hash string) (*DedupStat, error) {
+	var stat *DedupStat
+	err := ec.c.CallContext(ctx, &stat, "ethofs_dedupStat", hash)
+	return stat, err
+}
+
+// ConfigHistory returns the latest snapshots of the effective config of the
+// node, newest first. A zero limit selects the node default.
+func (ec *Client) ConfigHistory(ctx context.Context, limit int) ([]ConfigSnapshot, error) {
+	var history []ConfigSnapshot
+	err := ec.c.CallContext(ctx, &history, "ethofs_configHistory", limit)
+	return history, err
+}
+
+// ConfigRollback restarts the node with the config of the given snapshot.
+func (ec *Client) ConfigRollback(ctx context.Context, hash string) error {
+	return ec.c.CallContext(ctx, nil, "ethofsadmin_configRollback", hash)
+}
+
+// HostingReport returns a report of the content the node hosts for the
+// hosting contract, signed by the given keystore account of the node.
+func (ec *Client) HostingReport(ctx context.Context, opts HostingReportOptions) (*HostingReport, error) {
+	var report *HostingReport
+	err := ec.c.CallContext(ctx, &report, "ethofsadmin_hostingReport", opts)
+	return report, err
+}
+
+// VerifyHostingReport checks on the node that the hosting report is signed by
+// its signer.
+func (ec *Client) VerifyHostingReport(ctx context.Context, report *HostingReport) (bool, error) {
+	var valid bool
+	err := ec.c.CallContext(ctx, &valid, "ethofs_verifyHostingReport", report)
+	return valid, err
+}
+
+// DialFailures returns the failed swarm dials of the node since its startup,
+// counted by reason and operation.
+func (ec *Client) DialFailures(ctx context.Context) (*DialFailures, error) {
+	var failures *DialFailures
+	err := ec.c.CallContext(ctx, &failures, "ethofs_dialFailures")
+	return failures, err
+}
+
+// Clock returns the result of the latest check of the node clock against NTP.
+func (ec *Client) Clock(ctx context.Context) (*ClockStatus, error) {
+	var status *ClockStatus
+	err := ec.c.CallContext(ctx, &status, "ethofs_clock")
+	return status, err
+}
+
+// Telemetry returns the anonymized statistics the node reports when telemetry
+// is enabled.
+func (ec *Client) Telemetry(ctx context.Context) (*TelemetryReport, error) {
+	var report *TelemetryReport
+	err := ec.c.CallContext(ctx, &report, "ethofs_telemetry")
+	return report, err
+}
+
+// Plugins returns the names of the plugins registered with the node.
+func (ec *Client) Plugins(ctx context.Context) ([]string, error) {
+	var names []string
+	err := ec.c.CallContext(ctx, &names, "ethofs_plugins")
+	return names, err
+}
+
+// CreateSharedFolder creates a folder shared end-to-end encrypted with the
+// owners of the secp256k1 public keys and the keystore account of the node,
+// unlocked with the passphrase.
+func (ec *Client) CreateSharedFolder(ctx context.Context, name string, recipients [][]byte, account common.Address, passphrase string) (*SharedFolder, error) {
+	keys := make([]hexutil.Bytes, len(recipients))
+	for i, recipient := range recipients {
+		keys[i] = recipient
+	}
+	var folder *SharedFolder
+	err := ec.c.CallContext(ctx, &folder, "ethofsadmin_createSharedFolder", name, keys, account, passphrase)
+	return folder, err
+}
+
+// JoinSharedFolder joins the shared folder of the IPNS name with the key of a
+// keystore account of the node, unlocked with the passphrase.
+func (ec *Client) JoinSharedFolder(ctx context.Context, id string, account common.Address, passphrase string) (*SharedFolder, error) {
+	var folder *SharedFolder
+	err := ec.c.CallContext(ctx, &folder, "ethofsadmin_joinSharedFolder", id, account, passphrase)
+	return folder, err
+}
+
+// SharedFolders returns the shared folders joined by the node.
+func (ec *Client) SharedFolders(ctx context.Context) ([]SharedFolder, error) {
+	var folders []SharedFolder
+	err := ec.c.CallContext(ctx, &folders, "ethofs_sharedFolders")
+	return folders, err
+}
+
+// SharedFolderWrite stores the data at the path of the shared folder.
+func (ec *Client) SharedFolderWrite(ctx context.Context, id, path string, data []byte) (*SharedFile, error) {
+	var file *SharedFile
+	err := ec.c.CallContext(ctx, &file, "ethofsadmin_sharedFolderWrite", id, path, hexutil.Bytes(data))
+	return file, err
+}
+
+// SharedFolderRead returns the decrypted content of the file at the path of
+// the shared folder.
+func (ec *Client) SharedFolderRead(ctx context.Context, id, path string) ([]byte, error) {
+	var data hexutil.Bytes
+	err := ec.c.CallContext(ctx, &data, "ethofsadmin_sharedFolderRead", id, path)
+	return data, err
+}
+
+// SharedFolderRemove removes the file at the path of the shared folder.
+func (ec *Client) SharedFolderRemove(ctx context.Context, id, path string) error {
+	return ec.c.CallContext(ctx, nil, "ethofsadmin_sharedFolderRemove", id, path)
+}
+
+// SharedFolderLs lists the files of the shared folder.
+func (ec *Client) SharedFolderLs(ctx context.Context, id string) ([]SharedFile, error) {
+	var list []SharedFile
+	err := ec.c.CallContext(ctx, &list, "ethofs_sharedFolderLs", id)
+	return list, err
+}
+
+// LeaveSharedFolder stops syncing the shared folder on the node.
+func (ec *Client) LeaveSharedFolder(ctx context.Context, id string) error {
+	return ec.c.CallContext(ctx, nil, "ethofsadmin_leaveSharedFolder", id)
+}
+
+// AddTimeLocked adds the data encrypted, with the decryption key released by
+// the node at the block height or, if zero, at the unix time.
+func (ec *Client) AddTimeLocked(ctx context.Context, data []byte, block uint64, release uint64) (*TimeLock, error) {
+	var lock *TimeLock
+	err := ec.c.CallContext(ctx, &lock, "ethofsadmin_addTimeLocked", hexutil.Bytes(data), hexutil.Uint64(block), hexutil.Uint64(release))
+	return lock, err
+}
+
+// GetTimeLocked retrieves and decrypts time-locked content once its key was
+// released.
+func (ec *Client) GetTimeLocked(ctx context.Context, hash string) ([]byte, error) {
+	var data hexutil.Bytes
+	err := ec.c.CallContext(ctx, &data, "ethofsadmin_getTimeLocked", hash)
+	return data, err
+}
+
+// TimeLocks returns the time-locked content added or watched by the node.
+func (ec *Client) TimeLocks(ctx context.Context) ([]TimeLock, error) {
+	var locks []TimeLock
+	err := ec.c.CallContext(ctx, &locks, "ethofs_timeLocks")
+	return locks, err
+}
+
+// TimeLockKey returns the released decryption key of time-locked content.
+func (ec *Client) TimeLockKey(ctx context.Context, hash string) ([]byte, error) {
+	var key hexutil.Bytes
+	err := ec.c.CallContext(ctx, &key, "ethofs_timeLockKey", hash)
+	return key, err
+}
+
+// SignContent signs the CID with a keystore account of the node, unlocked
+// with the passphrase or already unlocked if empty.
+func (ec *Client) SignContent(ctx context.Context, hash string, publisher common.Address, passphrase string) (*ContentSignature, error) {
+	var sig *ContentSignature
+	err := ec.c.CallContext(ctx, &sig, "ethofsadmin_signContent", hash, publisher, passphrase)
+	return sig, err
+}
+
+// VerifyContent checks the CID against the signatures of the publishers
+// trusted by the node.
+func (ec *Client) VerifyContent(ctx context.Context, hash string) (*ContentVerification, error) {
+	var res *ContentVerification
+	err := ec.c.CallContext(ctx, &res, "ethofs_verifyContent", hash)
+	return res, err
+}
+
+// Credits returns the bandwidth balances of the peers, the largest debts
+// first.
+func (ec *Client) Credits(ctx context.Context) ([]PeerCredit, error) {
+	var credits []PeerCredit
+	err := ec.c.CallContext(ctx, &credits, "ethofs_credits")
+	return credits, err
+}
+
+// Credit returns the bandwidth balance of the peer.
+func (ec *Client) Credit(ctx context.Context, id string) (*PeerCredit, error) {
+	var credit *PeerCredit
+	err := ec.c.CallContext(ctx, &credit, "ethofs_credit", id)
+	return credit, err
+}
+
+// PublishVersion publishes the content at the given CID as a new version of
+// the site, linked to the version it replaces.
+func (ec *Client) PublishVersion(ctx context.Context, name, version, hash string) (*SiteManifest, error) {
+	var manifest *SiteManifest
+	err := ec.c.CallContext(ctx, &manifest, "ethofsadmin_publishVersion", name, version, hash)
+	return manifest, err
+}
+
+// ListVersions returns the latest versions of a site, newest first. The site
+// is referenced by its name on the node, its IPNS name or a manifest CID. A
+// zero limit selects the node default.
+func (ec *Client) ListVersions(ctx context.Context, ref string, limit int) ([]SiteManifest, error) {
+	var versions []SiteManifest
+	err := ec.c.CallContext(ctx, &versions, "ethofs_listVersions", ref, limit)
+	return versions, err
+}
+
+// RollbackSite republishes an earlier version of the site as its latest one.
+func (ec *Client) RollbackSite(ctx context.Context, name, version string) (*SiteManifest, error) {
+	var manifest *SiteManifest
+	err := ec.c.CallContext(ctx, &manifest, "ethofsadmin_rollbackSite", name, version)
+	return manifest, err
+}
+
+// Sites returns the latest versions of the sites published by the node.
+func (ec *Client) Sites(ctx context.Context) ([]SiteManifest, error) {
+	var sites []SiteManifest
+	err := ec.c.CallContext(ctx, &sites, "ethofs_sites")
+	return sites, err
+}
+
+// Chain returns the state of the chain backend the node syncs the hosting
+// contract from.
+func (ec *Client) Chain(ctx context.Context) (*ChainStatus, error) {
+	var status *ChainStatus
+	err := ec.c.CallContext(ctx, &status, "ethofs_chain")
+	return status, err
+}
+
+// Allowlist returns the peers a node in strict peer mode admits.
+func (ec *Client) Allowlist(ctx context.Context) (*AllowlistStatus, error) {
+	var status *AllowlistStatus
+	err := ec.c.CallContext(ctx, &status, "ethofs_allowlist")
+	return status, err
+}
+
+// IntegrityProof returns the last scheduled integrity proof of the node, or
+// nil if none was computed yet.
+func (ec *Client) IntegrityProof(ctx context.Context) (*IntegrityProof, error) {
+	var proof *IntegrityProof
+	err := ec.c.CallContext(ctx, &proof, "ethofs_integrityProof")
+	return proof, err
+}
+
+// ProveIntegrity makes the node compute and submit an integrity proof right
+// away.
+func (ec *Client) ProveIntegrity(ctx context.Context) (*IntegrityProof, error) {
+	var proof *IntegrityProof
+	err := ec.c.CallContext(ctx, &proof, "ethofsadmin_proveIntegrity")
+	return proof, err
+}
+
+// ExportTree makes the node write the pinned content of the CID, /ipfs/ or
+// /ipns/ path to a local directory of its host. Watched exports follow the
+// IPNS name of the ref.
+func (ec *Client) ExportTree(ctx context.Context, ref, localPath string, watch bool) (*TreeExport, error) {
+	var export *TreeExport
+	err := ec.c.CallContext(ctx, &export, "ethofsadmin_exportTree", ref, localPath, watch)
+	return export, err
+}
+
+// Exports returns the filesystem exports of the node.
+func (ec *Client) Exports(ctx context.Context) ([]TreeExport, error) {
+	var exports []TreeExport
+	err := ec.c.CallContext(ctx, &exports, "ethofs_exports")
+	return exports, err
+}
+
+// StopExport makes the node forget the export of the local directory, leaving
+// its files on disk.
+func (ec *Client) StopExport(ctx context.Context, localPath string) error {
+	return ec.c.CallContext(ctx, nil, "ethofsadmin_stopExport", localPath)
+}
+
+// ObjectStat returns the cumulative size and block count of the DAG at the
+// given CID or ethoFS path.
+func (ec *Client) ObjectStat(ctx context.Context, path string) (*ObjectStat, error) {
+	var stat *ObjectStat
+	err := ec.c.CallContext(ctx, &stat, "ethofs_objectStat", path)
+	return stat, err
+}
+
+// FilesLs lists a directory of the mutable files tree, all of its entries if
+// the page is nil.
+func (ec *Client) FilesLs(ctx context.Context, path string, page *PageOptions) ([]FileEntry, error) {
+	var entries []FileEntry
+	err := ec.c.CallContext(ctx, &entries, "ethofs_filesLs", path, page)
+	return entries, err
+}
+
+// FilesStat describes a file or directory of the mutable files tree.
+func (ec *Client) FilesStat(ctx context.Context, path string) (*FileStat, error) {
+	var stat *FileStat
+	err := ec.c.CallContext(ctx, &stat, "ethofs_filesStat", path)
+	return stat, err
+}
+
+// FilesCp copies content, an ethoFS path or a path of the mutable files
+// tree, to a path of the mutable files tree.
+func (ec *Client) FilesCp(ctx context.Context, src string, dst string) error {
+	return ec.c.CallContext(ctx, nil, "ethofsadmin_filesCp", src, dst)
+}
+
+// FilesFlush persists the changes below the path and returns its CID.
+func (ec *Client) FilesFlush(ctx context.Context, path string) (string, error) {
+	var hash string
+	err := ec.c.CallContext(ctx, &hash, "ethofsadmin_filesFlush", path)
+	return hash, err
+}
+
+// WriteFile streams r into a file of the mutable files tree, replacing its
+// content and creating it and its parents if needed. The stream is uploaded
+// in chunks, so it is not limited by the request size limits of the node.
+// It returns the number of bytes written.
+func (ec *Client) WriteFile(ctx context.Context, path string, r io.Reader) (int64, error) {
+	var (
+		buf     = make([]byte, writeChunkSize)
+		written int64
+	)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF && written > 0 {
+			return written, nil
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return written, err
+		}
+		opts := &FilesWriteOptions{Offset: written}
+		if written == 0 {
+			// The first chunk creates or replaces the file, an empty stream
+			// leaves an empty file
+			opts.Create, opts.Parents, opts.Truncate = true, true, true
+		}
+		if werr := ec.FilesWrite(ctx, path, buf[:n], opts); werr != nil {
+			return written, werr
+		}
+		written += int64(n)
+		if err != nil {
+			return written, nil
+		}
+	}
+}
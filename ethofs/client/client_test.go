@@ -0,0 +1,125 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// filesService fakes the files methods of the ethofs and ethofsadmin
+// namespaces on a mutable files tree of plain byte slices.
+type filesService struct {
+	files  map[string][]byte
+	writes int
+}
+
+func (s *filesService) FilesWrite(p string, data hexutil.Bytes, opts *FilesWriteOptions) error {
+	s.writes++
+	file, ok := s.files[p]
+	if !ok && !opts.Create {
+		return errors.New("file does not exist")
+	}
+	if opts.Truncate {
+		file = nil
+	}
+	if opts.Offset != int64(len(file)) {
+		return errors.New("unexpected offset")
+	}
+	s.files[p] = append(file, data...)
+	return nil
+}
+
+func (s *filesService) FilesRead(p string) (hexutil.Bytes, error) {
+	file, ok := s.files[p]
+	if !ok {
+		return nil, errors.New("file does not exist")
+	}
+	return file, nil
+}
+
+func TestWriteFile(t *testing.T) {
+	service := &filesService{files: map[string][]byte{"/site/index.html": []byte("stale")}}
+	server := rpc.NewServer()
+	defer server.Stop()
+	for _, namespace := range []string{"ethofs", "ethofsadmin"} {
+		if err := server.RegisterName(namespace, service); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ec := NewClient(rpc.DialInProc(server))
+	defer ec.Close()
+
+	tests := []struct {
+		size   int
+		writes int
+	}{
+		{0, 1},
+		{100, 1},
+		{writeChunkSize, 1},
+		{2*writeChunkSize + 1, 3},
+	}
+	for i, tt := range tests {
+		service.writes = 0
+
+		data := bytes.Repeat([]byte{byte(i)}, tt.size)
+		n, err := ec.WriteFile(context.Background(), "/site/index.html", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("test %d: write failed: %v", i, err)
+		}
+		if n != int64(tt.size) {
+			t.Errorf("test %d: written size mismatch: have %d, want %d", i, n, tt.size)
+		}
+		if service.writes != tt.writes {
+			t.Errorf("test %d: write calls mismatch: have %d, want %d", i, service.writes, tt.writes)
+		}
+		have, err := ec.FilesRead(context.Background(), "/site/index.html")
+		if err != nil {
+			t.Fatalf("test %d: read failed: %v", i, err)
+		}
+		if !bytes.Equal(have, data) {
+			t.Errorf("test %d: content mismatch: have %d bytes, want %d", i, len(have), len(data))
+		}
+	}
+}
+
+// codedError mimics the coded errors of the ethofs namespace.
+type codedError struct{}
+
+func (codedError) Error() string          { return "merkledag: not found" }
+func (codedError) ErrorCode() int         { return ErrCodeNotFound }
+func (codedError) ErrorData() interface{} { return map[string]string{"reason": ErrReasonNotFound} }
+
+// missingService is a fake ethofs namespace holding no content at all.
+type missingService struct{}
+
+func (missingService) FilesRead(p string) (hexutil.Bytes, error) {
+	return nil, codedError{}
+}
+
+func TestErrorReason(t *testing.T) {
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("ethofs", missingService{}); err != nil {
+		t.Fatal(err)
+	}
+	ec := NewClient(rpc.DialInProc(server))
+	defer ec.Close()
+
+	_, err := ec.FilesRead(context.Background(), "/missing")
+	if err == nil {
+		t.Fatal("read of missing file succeeded")
+	}
+	if code := ErrorCode(err); code != ErrCodeNotFound {
+		t.Errorf("error code mismatch: have %d, want %d", code, ErrCodeNotFound)
+	}
+	if reason := ErrorReason(err); reason != ErrReasonNotFound {
+		t.Errorf("error reason mismatch: have %q, want %q", reason, ErrReasonNotFound)
+	}
+	if code, reason := ErrorCode(errors.New("dial failed")), ErrorReason(errors.New("dial failed")); code != 0 || reason != "" {
+		t.Errorf("local error classified: code %d, reason %q", code, reason)
+	}
+}
@@ -0,0 +1,49 @@
+package client
+
+import "github.com/ethereum/go-ethereum/rpc"
+
+// Error codes of the ethoFS RPC API, mirroring the ones of the node.
+const (
+	ErrCodeInternal     = -32000 // Unclassified failure
+	ErrCodeOffline      = -32010 // Node not running, offline or without a chain connection
+	ErrCodeNotFound     = -32011 // Content, key, name or record not found
+	ErrCodeUnauthorized = -32012 // Missing or invalid credentials, signatures or permissions
+	ErrCodeQuota        = -32013 // A size or resource limit of the node was exceeded
+	ErrCodeTimeout      = -32014 // Operation did not complete within its deadline
+	ErrCodeDisabled     = -32015 // Feature disabled by the node configuration
+)
+
+// Reasons of the ethoFS RPC errors, carried in the data field of the errors.
+const (
+	ErrReasonInternal     = "internal"
+	ErrReasonOffline      = "offline"
+	ErrReasonNotFound     = "notFound"
+	ErrReasonUnauthorized = "unauthorized"
+	ErrReasonQuota        = "quota"
+	ErrReasonTimeout      = "timeout"
+	ErrReasonDisabled     = "disabled"
+)
+
+// ErrorCode returns the code of an error returned by the node, or zero if the
+// call failed before reaching it.
+func ErrorCode(err error) int {
+	if err, ok := err.(rpc.Error); ok {
+		return err.ErrorCode()
+	}
+	return 0
+}
+
+// ErrorReason returns the machine-readable reason of an error returned by the
+// node, or an empty string if the error carries none.
+func ErrorReason(err error) string {
+	de, ok := err.(rpc.DataError)
+	if !ok {
+		return ""
+	}
+	data, ok := de.ErrorData().(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	reason, _ := data["reason"].(string)
+	return reason
+}
@@ -0,0 +1,542 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// AddOptions controls how added content is chunked, hashed and pinned. The
+// zero value selects the defaults of the node without pinning.
+type AddOptions struct {
+	Chunker    string `json:"chunker"`    // Chunking algorithm, e.g. "size-262144" or "rabin"
+	CidVersion int    `json:"cidVersion"` // CID version of the created DAG
+	RawLeaves  bool   `json:"rawLeaves"`  // Store the leaves as raw blocks instead of unixfs nodes
+	Hash       string `json:"hash"`       // Multihash function name, e.g. "sha2-256" or "blake2b-256"
+	Pin        bool   `json:"pin"`        // Pin the content once added
+}
+
+// ReceiptOptions controls the content added by AddWithReceipt and the signing
+// of its receipt.
+type ReceiptOptions struct {
+	AddOptions
+	Uploader   common.Address `json:"uploader"`   // Keystore account of the node signing the receipt
+	Passphrase string         `json:"passphrase"` // Unlocks the uploader account, which has to be unlocked already if empty
+	Anchor     bool           `json:"anchor"`     // Publish the receipt hash in a transaction to the receipt contract
+}
+
+// Receipt is the signed proof of an upload.
+type Receipt struct {
+	Cid         string         `json:"cid"`
+	Size        uint64         `json:"size"`
+	Blocks      uint64         `json:"blocks"`
+	Timestamp   uint64         `json:"timestamp"`
+	Uploader    common.Address `json:"uploader"`
+	Signature   hexutil.Bytes  `json:"signature"`
+	Transaction *common.Hash   `json:"transaction,omitempty"`
+}
+
+// PageOptions selects a page of a listing. Entries are ordered by key: the CID
+// of pins, the name of directory entries and the ID of peers.
+type PageOptions struct {
+	After  string `json:"after"`  // Cursor: the key of the last entry of the previous page, empty for the first page
+	Limit  int    `json:"limit"`  // Maximum number of entries, the default of the node if zero
+	Prefix string `json:"prefix"` // Only list entries whose key starts with the prefix
+}
+
+// PinInfo describes a pin of the node.
+type PinInfo struct {
+	Cid  string `json:"cid"`
+	Type string `json:"type"`
+}
+
+// PinSize is the disk usage attributable to a recursively pinned root.
+type PinSize struct {
+	Cid       string `json:"cid"`
+	Blocks    int    `json:"blocks"`    // Unique blocks of the DAG
+	Size      uint64 `json:"size"`      // Total size of the unique blocks
+	Exclusive uint64 `json:"exclusive"` // Size of the blocks no other pin references
+	Shared    uint64 `json:"shared"`    // Size of the blocks other pins reference too
+	Share     uint64 `json:"share"`     // Size with every shared block split evenly between the pins referencing it
+}
+
+// PinExpiry is the block height a pin of the node is dropped at.
+type PinExpiry struct {
+	Cid    string `json:"cid"`
+	Expiry uint64 `json:"expiry"`
+}
+
+// PinListOptions selects the pins listed by ListPins.
+type PinListOptions struct {
+	PageOptions
+	Type string `json:"type"` // "recursive", "direct", "indirect" or "all", recursive if empty; the latter two only through the admin API
+}
+
+// PeerInfo describes a swarm peer connected to the node.
+type PeerInfo struct {
+	ID        string `json:"id"`
+	Address   string `json:"address"`
+	Direction string `json:"direction"`         // Whether the peer dialed the node or the other way around
+	Latency   string `json:"latency,omitempty"` // Smoothed round trip time, if measured
+	Agent     string `json:"agent,omitempty"`   // Agent version the peer identified with
+}
+
+// DeniedPeer is an entry of the peer denylist of the node.
+type DeniedPeer struct {
+	ID     string    `json:"id"`
+	Reason string    `json:"reason,omitempty"`
+	Added  time.Time `json:"added"`
+}
+
+// PeerResult is the outcome of a connection attempt or request to a peer.
+type PeerResult struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+}
+
+// MigrateFilter selects the pinned DAGs migrated to another node.
+type MigrateFilter struct {
+	Roots []string `json:"roots"`
+}
+
+// MigrateResult is the outcome of migrating a single DAG.
+type MigrateResult struct {
+	Cid      string `json:"cid"`
+	Migrated bool   `json:"migrated"`
+	Unpinned bool   `json:"unpinned"`
+	Error    string `json:"error,omitempty"`
+}
+
+// RepoStat contains the storage statistics of the repo of the node.
+type RepoStat struct {
+	RepoSize         uint64 `json:"repoSize"`
+	StorageMax       uint64 `json:"storageMax"`
+	StorageWatermark uint64 `json:"storageWatermark"`
+	NumObjects       uint64 `json:"numObjects"`
+	RepoPath         string `json:"repoPath"`
+	Version          string `json:"version"`
+}
+
+// GCPreview is the outcome a garbage collection of the node would have.
+type GCPreview struct {
+	Blocks    int      `json:"blocks"`    // Blocks the collection would remove
+	Size      uint64   `json:"size"`      // Bytes the collection would reclaim
+	Kept      int      `json:"kept"`      // Blocks kept for the pins and the mutable files tree
+	Roots     []string `json:"roots"`     // Tops of the unpinned DAGs that would disappear
+	MoreRoots int      `json:"moreRoots"` // Roots left out of the list
+}
+
+// KeyInfo describes an IPNS key of the node.
+type KeyInfo struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// Message is a pubsub message received on a topic.
+type Message struct {
+	From  string        `json:"from"`
+	Topic string        `json:"topic"`
+	Data  hexutil.Bytes `json:"data"`
+	Seq   hexutil.Bytes `json:"seq"`
+}
+
+// Event is a notification of the ethoFS activity of the node. Event holds the
+// JSON encoding of the event of the named type, e.g. {"cid": ...} for a
+// "ContentPinned" event.
+type Event struct {
+	Type  string          `json:"type"`
+	Event json.RawMessage `json:"event"`
+}
+
+// StartupStatus reports the progress of the supervised node startup.
+type StartupStatus struct {
+	State       string     `json:"state"`
+	Attempts    int        `json:"attempts"`
+	Error       string     `json:"error,omitempty"`
+	NextAttempt *time.Time `json:"nextAttempt,omitempty"`
+}
+
+// HealthStatus is the health report of the node.
+type HealthStatus struct {
+	Healthy      bool       `json:"healthy"`
+	Problems     []string   `json:"problems,omitempty"`
+	State        string     `json:"state"`
+	Online       bool       `json:"online"`
+	RepoOK       bool       `json:"repoOk"`
+	SwarmKey     bool       `json:"swarmKey"`
+	KeyMismatch  bool       `json:"keyMismatch"`
+	Peers        int        `json:"peers"`
+	RoutingTable int        `json:"routingTable"`
+	PinQueue     int        `json:"pinQueue"`
+	LastGC       *Operation `json:"lastGC,omitempty"`
+
+	HostingReady bool         `json:"hostingReady"`
+	Degraded     []string     `json:"degraded,omitempty"`
+	Chain        *ChainStatus `json:"chain,omitempty"`
+}
+
+// DirEntry is an entry of an immutable unixfs directory.
+type DirEntry struct {
+	Name   string `json:"name"`
+	Cid    string `json:"cid"`
+	Type   string `json:"type"`
+	Size   uint64 `json:"size"`
+	Target string `json:"target,omitempty"`
+}
+
+// FetchOptions controls a parallel fetch. Zero values select the defaults of
+// the node.
+type FetchOptions struct {
+	Concurrency int           `json:"concurrency"` // Blocks requested at once
+	Timeout     time.Duration `json:"timeout"`     // Time each block may take to arrive
+}
+
+// FetchStat summarizes a completed parallel fetch.
+type FetchStat struct {
+	Cid      string        `json:"cid"`
+	Blocks   uint64        `json:"blocks"`
+	Size     uint64        `json:"size"`
+	Duration time.Duration `json:"duration"`
+}
+
+// ReconcileOptions controls a pin reconciliation. Zero values select the
+// defaults of the node.
+type ReconcileOptions struct {
+	DryRun      bool `json:"dryRun"`
+	Concurrency int  `json:"concurrency"`
+	Additive    bool `json:"additive"`
+	Replication bool `json:"replication"`
+}
+
+// ReconcileFailure is a pin change of a reconciliation that failed.
+type ReconcileFailure struct {
+	Cid   string `json:"cid"`
+	Op    string `json:"op"`
+	Error string `json:"error"`
+}
+
+// ReconcileReport is the outcome of a pin reconciliation.
+type ReconcileReport struct {
+	DryRun    bool               `json:"dryRun"`
+	Desired   int                `json:"desired"`
+	Pinned    int                `json:"pinned"`
+	Additions []string           `json:"additions"`
+	Removals  []string           `json:"removals"`
+	Protected []string           `json:"protected"`
+	Skipped   []string           `json:"skipped"`
+	Failed    []ReconcileFailure `json:"failed"`
+	Duration  time.Duration      `json:"duration"`
+
+	SkippedLists int `json:"skippedLists"`
+}
+
+// SelfTestCheck is the outcome of a single self-test check, one of "ok",
+// "warning", "failed" or "skipped".
+type SelfTestCheck struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Detail string `json:"detail"`
+}
+
+// SelfTestReport is the outcome of a self-test, OK unless a check failed.
+type SelfTestReport struct {
+	OK     bool            `json:"ok"`
+	Checks []SelfTestCheck `json:"checks"`
+}
+
+// ProviderOptions controls a provider lookup. Zero values select the defaults
+// of the node.
+type ProviderOptions struct {
+	Limit   int `json:"limit"`
+	Timeout int `json:"timeout"` // Seconds
+}
+
+// Provider is a peer of the network holding a CID.
+type Provider struct {
+	ID        string   `json:"id"`
+	Addrs     []string `json:"addrs"`
+	Connected bool     `json:"connected"`
+}
+
+// ProviderRecords are the providers of a CID found by a lookup.
+type ProviderRecords struct {
+	Cid       string     `json:"cid"`
+	Local     bool       `json:"local"`
+	Providers []Provider `json:"providers"`
+	Replicas  int        `json:"replicas"`
+	Complete  bool       `json:"complete"`
+}
+
+// DedupStat describes how much the repo deduplicates the DAG of a CID.
+type DedupStat struct {
+	Cid         string  `json:"cid"`
+	Blocks      int     `json:"blocks"`
+	Missing     int     `json:"missing"`
+	References  uint64  `json:"references"`
+	Size        uint64  `json:"size"`
+	LogicalSize uint64  `json:"logicalSize"`
+	Ratio       float64 `json:"ratio"`
+}
+
+// ConfigSnapshot is an effective config of the node. The config is left
+// encoded, as rendered by the node.
+type ConfigSnapshot struct {
+	Cid      string          `json:"cid"`
+	Previous string          `json:"previous,omitempty"`
+	Time     time.Time       `json:"time"`
+	Config   json.RawMessage `json:"config"`
+}
+
+// HostingReportOptions selects the account signing a hosting report.
+type HostingReportOptions struct {
+	Signer     common.Address `json:"signer"`
+	Passphrase string         `json:"passphrase"`
+}
+
+// HostedContent is an entry of a hosting report.
+type HostedContent struct {
+	Cid        string `json:"cid"`
+	Size       uint64 `json:"size"`
+	Blocks     uint64 `json:"blocks"`
+	Replicas   int    `json:"replicas"`
+	Hosted     bool   `json:"hosted"`
+	VerifiedAt uint64 `json:"verifiedAt"`
+	Error      string `json:"error,omitempty"`
+}
+
+// HostingReport is a signed report of the content a node hosts for the
+// hosting contract.
+type HostingReport struct {
+	Version   int             `json:"version"`
+	Node      string          `json:"node"`
+	Signer    common.Address  `json:"signer"`
+	Block     uint64          `json:"block"`
+	Timestamp uint64          `json:"timestamp"`
+	Content   []HostedContent `json:"content"`
+	Signature hexutil.Bytes   `json:"signature,omitempty"`
+}
+
+// DialFailure is a failed dial of a swarm peer.
+type DialFailure struct {
+	Peer      string `json:"peer"`
+	Operation string `json:"operation"`
+	Reason    string `json:"reason"`
+	Error     string `json:"error"`
+	Time      uint64 `json:"time"`
+}
+
+// DialFailures is the breakdown of the failed swarm dials of a node.
+type DialFailures struct {
+	Total      uint64                       `json:"total"`
+	Reasons    map[string]uint64            `json:"reasons"`
+	Operations map[string]map[string]uint64 `json:"operations"`
+	Recent     []DialFailure                `json:"recent"`
+}
+
+// ClockStatus is the result of a check of the node clock against NTP.
+type ClockStatus struct {
+	Server  string `json:"server"`
+	Offset  string `json:"offset"`
+	MaxSkew string `json:"maxSkew"`
+	Skewed  bool   `json:"skewed"`
+	Strict  bool   `json:"strict"`
+	Checked uint64 `json:"checked"`
+	Error   string `json:"error,omitempty"`
+}
+
+// TelemetryReport is the anonymized statistics a node reports.
+type TelemetryReport struct {
+	Instance    string `json:"instance"`
+	Version     string `json:"version"`
+	NodeType    string `json:"nodeType"`
+	Light       bool   `json:"light"`
+	Region      string `json:"region,omitempty"`
+	StoredBytes uint64 `json:"storedBytes"`
+	Pins        int    `json:"pins"`
+	Peers       int    `json:"peers"`
+	Timestamp   uint64 `json:"timestamp"`
+}
+
+// SharedFolder describes an end-to-end encrypted folder joined by the node.
+type SharedFolder struct {
+	ID      string           `json:"id"`
+	Name    string           `json:"name"`
+	Root    string           `json:"root"`
+	Seq     uint64           `json:"seq"`
+	Files   int              `json:"files"`
+	Members []common.Address `json:"members"`
+}
+
+// SharedFile is a file of a shared folder.
+type SharedFile struct {
+	Path     string `json:"path"`
+	Cid      string `json:"cid"`
+	Size     int64  `json:"size"`
+	Modified uint64 `json:"modified"`
+}
+
+// TimeLock describes content encrypted until the release of its key.
+type TimeLock struct {
+	Cid      string `json:"cid"`
+	Own      bool   `json:"own"`
+	Block    uint64 `json:"block,omitempty"`
+	Time     uint64 `json:"time,omitempty"`
+	Released uint64 `json:"released"`
+}
+
+// ContentSignature is the signature of a publisher of the content of a CID.
+type ContentSignature struct {
+	Cid       string         `json:"cid"`
+	Publisher common.Address `json:"publisher"`
+	Timestamp uint64         `json:"timestamp"`
+	Signature hexutil.Bytes  `json:"signature"`
+}
+
+// ContentVerification is the outcome of the signature check of a CID.
+type ContentVerification struct {
+	Cid        string           `json:"cid"`
+	Verified   bool             `json:"verified"`
+	Publishers []common.Address `json:"publishers"`
+}
+
+// PeerCredit is the bandwidth balance of a peer, negative if the peer owes
+// the node.
+type PeerCredit struct {
+	Peer      string `json:"peer"`
+	Sent      uint64 `json:"sent"`
+	Received  uint64 `json:"received"`
+	Balance   int64  `json:"balance"`
+	Priority  int    `json:"priority"`
+	FirstSeen uint64 `json:"firstSeen"`
+	LastSeen  uint64 `json:"lastSeen"`
+}
+
+// SiteManifest is a published version of a website, linking to its content
+// and to the version it replaced.
+type SiteManifest struct {
+	Cid      string    `json:"cid"`
+	Name     string    `json:"name"`
+	Version  string    `json:"version"`
+	Root     string    `json:"root"`
+	Previous string    `json:"previous,omitempty"`
+	Time     time.Time `json:"time"`
+	IPNS     string    `json:"ipns,omitempty"`
+}
+
+// ChainStatus is the state of the chain backend the node syncs the hosting
+// contract from.
+type ChainStatus struct {
+	Available bool   `json:"available"`
+	Stale     bool   `json:"stale"`
+	Head      uint64 `json:"head"`
+	HeadTime  uint64 `json:"headTime"`
+	Checked   uint64 `json:"checked"`
+	Since     uint64 `json:"since"`
+	Queued    int    `json:"queued"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AllowlistStatus describes the registry of the peers admitted by a node in
+// strict peer mode.
+type AllowlistStatus struct {
+	Source  string   `json:"source"`
+	Peers   []string `json:"peers"`
+	Updated uint64   `json:"updated"`
+	Checked uint64   `json:"checked"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// IntegritySample is a pinned block an integrity proof commits to.
+type IntegritySample struct {
+	Pin   string      `json:"pin"`
+	Cid   string      `json:"cid"`
+	Leaf  common.Hash `json:"leaf"`
+	Error string      `json:"error,omitempty"`
+}
+
+// IntegrityProof is a commitment of a node over pinned blocks sampled with the
+// randomness of a recent block, the root of a Keccak256 Merkle tree over the
+// sample leaves.
+type IntegrityProof struct {
+	Time        uint64            `json:"time"`
+	Number      uint64            `json:"number"`
+	Seed        common.Hash       `json:"seed"`
+	Commitment  common.Hash       `json:"commitment"`
+	Pins        int               `json:"pins"`
+	Missing     int               `json:"missing"`
+	Samples     []IntegritySample `json:"samples"`
+	Calldata    hexutil.Bytes     `json:"calldata"`
+	Transaction *common.Hash      `json:"transaction,omitempty"`
+	SubmitError string            `json:"submitError,omitempty"`
+}
+
+// TreeExport describes a pinned DAG materialized to a local directory of the
+// node.
+type TreeExport struct {
+	Ref     string `json:"ref"`
+	Path    string `json:"path"`
+	Watch   bool   `json:"watch"`
+	Root    string `json:"root"`
+	Owned   bool   `json:"owned,omitempty"`
+	Updated uint64 `json:"updated"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ObjectStat describes the root node of a DAG and the DAG below it.
+type ObjectStat struct {
+	Cid            string `json:"cid"`
+	NumLinks       int    `json:"numLinks"`
+	BlockSize      int    `json:"blockSize"`
+	LinksSize      int    `json:"linksSize"`
+	DataSize       int    `json:"dataSize"`
+	CumulativeSize int    `json:"cumulativeSize"`
+	Blocks         int    `json:"blocks"`
+	Truncated      bool   `json:"truncated"`
+}
+
+// FileEntry is an entry of a directory of the mutable files tree.
+type FileEntry struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+}
+
+// FileStat describes a file or directory of the mutable files tree.
+type FileStat struct {
+	Hash           string `json:"hash"`
+	Type           string `json:"type"`
+	Size           uint64 `json:"size"`
+	CumulativeSize uint64 `json:"cumulativeSize"`
+}
+
+// FilesWriteOptions controls how FilesWrite modifies the target file.
+type FilesWriteOptions struct {
+	Create   bool  `json:"create"`   // Create the file if it does not exist
+	Parents  bool  `json:"parents"`  // Create missing parent directories
+	Truncate bool  `json:"truncate"` // Drop the old content before writing
+	Offset   int64 `json:"offset"`   // Byte offset to start writing at
+}
+
+// Operation is an entry of the operation history of the node.
+type Operation struct {
+	Seq      uint64        `json:"seq"`
+	Type     string        `json:"type"` // "add", "pin", "unpin", "gc" or "replicate"
+	Cid      string        `json:"cid,omitempty"`
+	Peer     string        `json:"peer,omitempty"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// HistoryOptions filters the operations returned by History.
+type HistoryOptions struct {
+	Type   string `json:"type"`   // Only list operations of the type
+	Cid    string `json:"cid"`    // Only list operations on the CID
+	Failed bool   `json:"failed"` // Only list failed operations
+	Limit  int    `json:"limit"`  // Maximum number of operations, all if zero
+}
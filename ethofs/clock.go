@@ -0,0 +1,292 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// ntpServer is queried for the reference time of the clock checks.
+	ntpServer = "pool.ntp.org:123"
+
+	// maxClockSkew is the clock offset above which signed records of the node,
+	// like IPNS entries, risk being rejected by peers.
+	maxClockSkew = 10 * time.Second
+
+	// clockSamples is the number of SNTP requests of a check, the median of
+	// their offsets is taken.
+	clockSamples = 5
+
+	// clockSampleTimeout bounds a single SNTP request, so that lost replies do
+	// not use up the time of the whole check.
+	clockSampleTimeout = time.Second
+
+	defaultClockInterval = time.Hour
+	clockCheckTimeout    = 5 * time.Second
+)
+
+var (
+	errClockSkewed  = errors.New("local clock skewed, refusing to sign")
+	errNoClockCheck = errors.New("ethoFS clock checks disabled or node offline")
+	errSNTPReply    = errors.New("invalid SNTP reply")
+	errSNTPKissCode = errors.New("SNTP server refused the request")
+)
+
+// clockSkewGauge is the measured clock offset in milliseconds.
+var clockSkewGauge = metrics.NewRegisteredGauge("ethofs/clock/skew", nil)
+
+var (
+	clockSkewLock sync.RWMutex
+	clockSkew     *clockMonitor // Monitor of the running node, nil while the checks are disabled or the node is offline
+)
+
+// currentClockMonitor returns the clock monitor of the running node, or nil if
+// the clock is not checked.
+func currentClockMonitor() *clockMonitor {
+	clockSkewLock.RLock()
+	defer clockSkewLock.RUnlock()
+
+	return clockSkew
+}
+
+// setClockMonitor replaces the clock monitor of the running node.
+func setClockMonitor(m *clockMonitor) {
+	clockSkewLock.Lock()
+	defer clockSkewLock.Unlock()
+
+	clockSkew = m
+}
+
+// ntpEpoch is the zero time of NTP timestamps.
+var ntpEpoch = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// sntpOffset measures how far the local clock is ahead of the NTP server,
+// taking the median offset of clockSamples SNTP requests (RFC 4330). Failed
+// requests are skipped as long as one of them succeeds.
+func sntpOffset(ctx context.Context, server string) (time.Duration, error) {
+	var (
+		offsets []time.Duration
+		err     error
+	)
+	for i := 0; i < clockSamples && ctx.Err() == nil; i++ {
+		sampleCtx, cancel := context.WithTimeout(ctx, clockSampleTimeout)
+		offset, serr := sntpSample(sampleCtx, server)
+		cancel()
+
+		if err = serr; err == nil {
+			offsets = append(offsets, offset)
+		}
+	}
+	if len(offsets) == 0 {
+		if err == nil {
+			err = ctx.Err()
+		}
+		return 0, err
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets[len(offsets)/2], nil
+}
+
+// sntpSample measures the clock offset with a single SNTP request, assuming
+// the reply took half the round trip to arrive.
+func sntpSample(ctx context.Context, server string) (time.Duration, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	// Client request of protocol version 3, all other fields empty
+	request := make([]byte, 48)
+	request[0] = 3<<3 | 3
+
+	sent := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+	reply := make([]byte, 48)
+	n, err := conn.Read(reply)
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(sent)
+
+	ref, err := parseSNTPReply(reply[:n])
+	if err != nil {
+		return 0, err
+	}
+	return sent.Sub(ref) + elapsed/2, nil
+}
+
+// parseSNTPReply returns the transmit timestamp of a server reply, rejecting
+// truncated replies, other modes, kiss-o'-death packets and unset times.
+func parseSNTPReply(reply []byte) (time.Time, error) {
+	if len(reply) < 48 {
+		return time.Time{}, errSNTPReply
+	}
+	if mode := reply[0] & 0x7; mode != 4 {
+		return time.Time{}, errSNTPReply
+	}
+	if stratum := reply[1]; stratum == 0 {
+		return time.Time{}, fmt.Errorf("%w: %q", errSNTPKissCode, reply[12:16])
+	}
+	// The transmit timestamp of the server is a 32.32 fixed point number
+	sec := uint64(binary.BigEndian.Uint32(reply[40:]))
+	frac := uint64(binary.BigEndian.Uint32(reply[44:]))
+	if sec == 0 && frac == 0 {
+		return time.Time{}, errSNTPReply
+	}
+	return ntpEpoch.Add(time.Duration(sec*1e9 + (frac*1e9)>>32)), nil
+}
+
+// ClockStatus is the result of the latest clock check.
+type ClockStatus struct {
+	Server  string `json:"server"`
+	Offset  string `json:"offset"`          // How far the local clock is ahead of the server
+	MaxSkew string `json:"maxSkew"`         // Offset above which signed records risk being rejected
+	Skewed  bool   `json:"skewed"`          // Offset above the maximum
+	Strict  bool   `json:"strict"`          // Signing refused while skewed
+	Checked uint64 `json:"checked"`         // Unix time of the check, zero before the first one
+	Error   string `json:"error,omitempty"` // Reason the server could not be queried
+}
+
+// clockMonitor compares the local clock against NTP at startup and then
+// periodically, warning when the offset exceeds the limit.
+type clockMonitor struct {
+	cfg   ClockConfig
+	query func(ctx context.Context, server string) (time.Duration, error)
+
+	lock    sync.Mutex
+	offset  time.Duration
+	checked time.Time
+	err     error
+}
+
+func newClockMonitor(cfg *ClockConfig) *clockMonitor {
+	m := &clockMonitor{cfg: *cfg, query: sntpOffset}
+	if m.cfg.Server == "" {
+		m.cfg.Server = ntpServer
+	}
+	if m.cfg.Interval == 0 {
+		m.cfg.Interval = defaultClockInterval
+	}
+	if m.cfg.MaxSkew == 0 {
+		m.cfg.MaxSkew = maxClockSkew
+	}
+	return m
+}
+
+// loop checks the clock right away and then every interval until the
+// context is cancelled.
+func (m *clockMonitor) loop(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		m.check(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check queries the NTP server. Unreachable servers keep the previous offset,
+// so a node that was skewed stays skewed until the server answers again.
+func (m *clockMonitor) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, clockCheckTimeout)
+	defer cancel()
+
+	offset, err := m.query(ctx, m.cfg.Server)
+	if ctx.Err() == context.Canceled {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.err = err
+	if err != nil {
+		log.Debug("ethoFS - clock check failed", "server", m.cfg.Server, "error", err)
+		return
+	}
+	m.offset, m.checked = offset, time.Now()
+	clockSkewGauge.Update(int64(offset / time.Millisecond))
+
+	if m.skewedLocked() {
+		log.Warn("ethoFS - local clock skewed, signed records may be rejected by peers", "offset", offset.Round(time.Millisecond), "max", m.cfg.MaxSkew, "strict", m.cfg.Strict)
+	}
+}
+
+// skewed reports whether the last measured offset exceeds the limit.
+func (m *clockMonitor) skewed() bool {
+	if m == nil {
+		return false
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.skewedLocked()
+}
+
+func (m *clockMonitor) skewedLocked() bool {
+	return !m.checked.IsZero() && (m.offset > m.cfg.MaxSkew || m.offset < -m.cfg.MaxSkew)
+}
+
+// status returns the result of the latest check.
+func (m *clockMonitor) status() *ClockStatus {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	status := &ClockStatus{
+		Server:  m.cfg.Server,
+		Offset:  m.offset.Round(time.Millisecond).String(),
+		MaxSkew: m.cfg.MaxSkew.String(),
+		Skewed:  m.skewedLocked(),
+		Strict:  m.cfg.Strict,
+	}
+	if !m.checked.IsZero() {
+		status.Checked = uint64(m.checked.Unix())
+	}
+	if m.err != nil {
+		status.Error = m.err.Error()
+	}
+	return status
+}
+
+// checkSigningClock fails while a strict clock monitor measures a skewed
+// clock, keeping the node from signing records its peers would reject.
+func checkSigningClock() error {
+	m := currentClockMonitor()
+	if m == nil || !m.cfg.Strict || !m.skewed() {
+		return nil
+	}
+	return fmt.Errorf("%w: clock off by %s", errClockSkewed, m.status().Offset)
+}
+
+// Clock returns the result of the latest clock skew check.
+func (api *PublicEthofsAPI) Clock() (_ *ClockStatus, err error) {
+	defer trackCall("clock", time.Now(), &err)
+
+	m := currentClockMonitor()
+	if m == nil {
+		return nil, errNoClockCheck
+	}
+	return m.status(), nil
+}
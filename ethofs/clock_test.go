@@ -0,0 +1,122 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestClockMonitor(t *testing.T) {
+	var (
+		offset time.Duration
+		fail   error
+	)
+	m := newClockMonitor(&ClockConfig{MaxSkew: time.Second, Strict: true})
+	m.query = func(ctx context.Context, server string) (time.Duration, error) {
+		return offset, fail
+	}
+	// Unchecked clocks are not skewed
+	if m.skewed() {
+		t.Fatalf("clock skewed before the first check")
+	}
+	offset = -2 * time.Second
+	m.check(context.Background())
+	if !m.skewed() {
+		t.Fatalf("clock not skewed with offset %v", offset)
+	}
+	// Unreachable servers keep the last measurement
+	fail = errors.New("unreachable")
+	m.check(context.Background())
+	if status := m.status(); !status.Skewed || status.Error != "unreachable" || status.Offset != "-2s" {
+		t.Errorf("status mismatch after failed check: %+v", status)
+	}
+	fail, offset = nil, 500*time.Millisecond
+	m.check(context.Background())
+	if status := m.status(); status.Skewed || status.Error != "" {
+		t.Errorf("status mismatch after recovery: %+v", status)
+	}
+}
+
+func TestCheckSigningClock(t *testing.T) {
+	defer setClockMonitor(currentClockMonitor())
+
+	for _, strict := range []bool{false, true} {
+		m := newClockMonitor(&ClockConfig{MaxSkew: time.Second, Strict: strict})
+		m.query = func(ctx context.Context, server string) (time.Duration, error) {
+			return time.Minute, nil
+		}
+		m.check(context.Background())
+		setClockMonitor(m)
+
+		err := checkSigningClock()
+		if strict && !errors.Is(err, errClockSkewed) {
+			t.Errorf("strict monitor: error mismatch: have %v, want %v", err, errClockSkewed)
+		}
+		if !strict && err != nil {
+			t.Errorf("lenient monitor refused to sign: %v", err)
+		}
+	}
+	setClockMonitor(nil)
+	if err := checkSigningClock(); err != nil {
+		t.Errorf("signing refused without monitor: %v", err)
+	}
+}
+
+func TestParseSNTPReply(t *testing.T) {
+	reply := func(mode, stratum byte, sec uint32) []byte {
+		data := make([]byte, 48)
+		data[0] = 3<<3 | mode
+		data[1] = stratum
+		copy(data[12:], "RATE")
+		binary.BigEndian.PutUint32(data[40:], sec)
+		return data
+	}
+	ref, err := parseSNTPReply(reply(4, 2, 3800000000))
+	if err != nil {
+		t.Fatalf("failed to parse reply: %v", err)
+	}
+	if want := ntpEpoch.Add(3800000000 * time.Second); !ref.Equal(want) {
+		t.Errorf("reference time mismatch: have %v, want %v", ref, want)
+	}
+	for name, data := range map[string][]byte{
+		"truncated":  reply(4, 2, 3800000000)[:40],
+		"client":     reply(3, 2, 3800000000),
+		"unset time": reply(4, 2, 0),
+	} {
+		if _, err := parseSNTPReply(data); err != errSNTPReply {
+			t.Errorf("%s reply: have %v, want %v", name, err, errSNTPReply)
+		}
+	}
+	if _, err := parseSNTPReply(reply(4, 0, 3800000000)); !errors.Is(err, errSNTPKissCode) {
+		t.Errorf("kiss-o'-death reply: have %v, want %v", err, errSNTPKissCode)
+	}
+}
+
+func TestSigningRefusedOnSkew(t *testing.T) {
+	defer setClockMonitor(currentClockMonitor())
+
+	m := newClockMonitor(&ClockConfig{MaxSkew: time.Second, Strict: true})
+	m.query = func(ctx context.Context, server string) (time.Duration, error) {
+		return time.Minute, nil
+	}
+	m.check(context.Background())
+	setClockMonitor(m)
+
+	// The clock is checked before any account or contract is needed
+	ctx := context.Background()
+	if _, err := new(EthofsService).SignContent(cid.Undef, common.Address{}, ""); !errors.Is(err, errClockSkewed) {
+		t.Errorf("content signature: error mismatch: have %v, want %v", err, errClockSkewed)
+	}
+	if _, err := new(integrityProver).submit(ctx, &IntegrityProof{}); !errors.Is(err, errClockSkewed) {
+		t.Errorf("integrity proof: error mismatch: have %v, want %v", err, errClockSkewed)
+	}
+	if _, err := new(availabilityVerifier).submit(ctx, nil); !errors.Is(err, errClockSkewed) {
+		t.Errorf("hosting proofs: error mismatch: have %v, want %v", err, errClockSkewed)
+	}
+}
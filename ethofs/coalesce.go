@@ -0,0 +1,200 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-ipfs/core"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	gopath "github.com/ipfs/go-path"
+	resolver "github.com/ipfs/go-path/resolver"
+	unixfile "github.com/ipfs/go-unixfs/file"
+)
+
+const (
+	// coalesceTimeout bounds a shared fetch, which outlives the request that
+	// started it.
+	coalesceTimeout = 2 * time.Minute
+
+	// maxCoalescedFile is the largest file fetched in full by a shared fetch.
+	// Bigger files and directories only have their root fetched.
+	maxCoalescedFile = 32 * MB
+
+	// maxCoalescedFetches bounds the shared fetches in progress. Requests
+	// beyond it are left to the gateway handler.
+	maxCoalescedFetches = 256
+)
+
+// errTooManyFlights is returned if a flight group runs its maximum number of
+// calls already.
+var errTooManyFlights = errors.New("too many calls in progress")
+
+var (
+	coalescedFetchMeter   = metrics.NewRegisteredMeter("ethofs/gateway/coalesce/fetches", nil)
+	coalescedRequestMeter = metrics.NewRegisteredMeter("ethofs/gateway/coalesce/requests", nil)
+)
+
+// flight is a fetch in progress that concurrent requests wait for.
+type flight struct {
+	done    chan struct{}
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// flightGroup deduplicates concurrent calls for the same key.
+type flightGroup struct {
+	ctx   context.Context // Parent of the contexts passed to the calls
+	limit int             // Maximum number of calls in progress, 0 for no limit
+
+	lock    sync.Mutex
+	flights map[string]*flight
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{ctx: context.Background(), flights: make(map[string]*flight)}
+}
+
+// do runs fn once for all concurrent callers with the same key, reporting
+// whether the result was shared with an earlier caller. Waiting callers give
+// up when their context is cancelled, the context passed to fn is cancelled
+// once all of them gave up. Calls beyond the limit of the group fail with
+// errTooManyFlights.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) error) (bool, error) {
+	g.lock.Lock()
+	f, shared := g.flights[key]
+	if shared {
+		f.waiters++
+	} else {
+		if g.limit > 0 && len(g.flights) >= g.limit {
+			g.lock.Unlock()
+			return false, errTooManyFlights
+		}
+		callCtx, cancel := context.WithCancel(g.ctx)
+
+		f = &flight{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		g.flights[key] = f
+
+		go func() {
+			f.err = fn(callCtx)
+			close(f.done)
+
+			g.lock.Lock()
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+			g.lock.Unlock()
+			cancel()
+		}()
+	}
+	g.lock.Unlock()
+
+	select {
+	case <-f.done:
+		return shared, f.err
+	case <-ctx.Done():
+		g.leave(key, f)
+		return shared, ctx.Err()
+	}
+}
+
+// leave drops a waiter of the flight, cancelling it if it was the last one.
+// Later callers start a new flight instead of joining the cancelled one.
+func (g *flightGroup) leave(key string, f *flight) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if f.waiters--; f.waiters > 0 {
+		return
+	}
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	f.cancel()
+}
+
+// coalesceOption funnels concurrent gateway requests for content missing from
+// the local blockstore into a single bitswap session, so a burst of requests
+// for a freshly popular site fetches its blocks from the swarm only once.
+func coalesceOption() corehttp.ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		group := newFlightGroup()
+		group.ctx, group.limit = n.Context(), maxCoalescedFetches
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				if ns, root, _ := splitContentPath(r.URL.Path); ns == "/ipfs" {
+					coalesceFetch(r.Context(), n, group, root, r.URL.Path)
+				}
+			}
+			childMux.ServeHTTP(w, r)
+		})
+		return childMux, nil
+	}
+}
+
+// coalesceFetch waits for the shared fetch of the content path unless its root
+// is available locally already. Errors are left to the gateway handler to
+// report. The fetch is cancelled once all requests waiting for it are gone.
+func coalesceFetch(ctx context.Context, n *core.IpfsNode, group *flightGroup, root string, p string) {
+	c, err := cid.Decode(root)
+	if err != nil {
+		return
+	}
+	if has, err := n.Blockstore.Has(c); err != nil || has {
+		return
+	}
+	shared, err := group.do(ctx, p, func(ctx context.Context) error {
+		coalescedFetchMeter.Mark(1)
+
+		fetchCtx, cancel := context.WithTimeout(ctx, coalesceTimeout)
+		defer cancel()
+
+		return prefetchPath(fetchCtx, n.DAG, gopath.Path(p))
+	})
+	if shared {
+		coalescedRequestMeter.Mark(1)
+	}
+	if err == errTooManyFlights || ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		log.Trace("ethoFS - coalesced fetch failed", "path", p, "error", err)
+		missingContent.failed(c, err)
+	}
+}
+
+// prefetchPath resolves the path and pulls the blocks of the target file into
+// the blockstore through the DAG service. Bigger files and directories only
+// have their root fetched.
+func prefetchPath(ctx context.Context, dag ipld.DAGService, p gopath.Path) error {
+	nd, err := resolver.NewBasicResolver(dag).ResolvePath(ctx, p)
+	if err != nil {
+		return err
+	}
+	file, err := unixfile.NewUnixfsFile(ctx, dag, nd)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	f, ok := file.(files.File)
+	if !ok {
+		return nil
+	}
+	if size, err := f.Size(); err != nil || size > maxCoalescedFile {
+		return err
+	}
+	return merkledag.FetchGraph(ctx, nd.Cid(), dag)
+}
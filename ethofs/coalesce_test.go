@@ -0,0 +1,149 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroupDedup(t *testing.T) {
+	var (
+		group   = newFlightGroup()
+		calls   int32
+		release = make(chan struct{})
+		failure = errors.New("fetch failed")
+	)
+	fn := func(context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return failure
+	}
+	var (
+		wg     sync.WaitGroup
+		shared int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := group.do(context.Background(), "key", fn)
+			if err != failure {
+				t.Errorf("error mismatch: have %v, want %v", err, failure)
+			}
+			if ok {
+				atomic.AddInt32(&shared, 1)
+			}
+		}()
+	}
+	// Wait for all callers to join the flight before completing it
+	for {
+		group.lock.Lock()
+		f := group.flights["key"]
+		group.lock.Unlock()
+		if f != nil && atomic.LoadInt32(&calls) == 1 {
+			time.Sleep(50 * time.Millisecond)
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("call count mismatch: have %d, want 1", calls)
+	}
+	if shared != 9 {
+		t.Errorf("shared count mismatch: have %d, want 9", shared)
+	}
+}
+
+func TestFlightGroupCancel(t *testing.T) {
+	group := newFlightGroup()
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := group.do(ctx, "key", func(context.Context) error { <-release; return nil }); err != context.Canceled {
+		t.Errorf("error mismatch: have %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestFlightGroupLastWaiter(t *testing.T) {
+	group := newFlightGroup()
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errc := make(chan error, 2)
+	go func() {
+		_, err := group.do(ctx1, "key", func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			close(cancelled)
+			return ctx.Err()
+		})
+		errc <- err
+	}()
+	<-started
+	go func() {
+		_, err := group.do(ctx2, "key", func(context.Context) error { return nil })
+		errc <- err
+	}()
+	// The flight carries on while a single waiter is left
+	for {
+		group.lock.Lock()
+		waiters := group.flights["key"].waiters
+		group.lock.Unlock()
+		if waiters == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel1()
+	<-errc
+	select {
+	case <-cancelled:
+		t.Fatalf("flight cancelled with a waiter left")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel2()
+	<-errc
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("flight not cancelled after its last waiter left")
+	}
+}
+
+func TestFlightGroupLimit(t *testing.T) {
+	group := newFlightGroup()
+	group.limit = 1
+
+	release := make(chan struct{})
+	errc := make(chan error)
+	go func() {
+		_, err := group.do(context.Background(), "a", func(context.Context) error { <-release; return nil })
+		errc <- err
+	}()
+	for {
+		group.lock.Lock()
+		n := len(group.flights)
+		group.lock.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := group.do(context.Background(), "b", func(context.Context) error { return nil }); err != errTooManyFlights {
+		t.Errorf("error mismatch: have %v, want %v", err, errTooManyFlights)
+	}
+	close(release)
+	if err := <-errc; err != nil {
+		t.Errorf("limited flight failed: %v", err)
+	}
+}
@@ -0,0 +1,496 @@
+package ethofs
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs/core"
+	merkledag "github.com/ipfs/go-merkledag"
+	car "github.com/ipld/go-car"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// bundleProtocol is the libp2p protocol serving the cold-start bundle of a
+// seed node. The request names the offset to resume the download at and the
+// hash of the partially downloaded bundle, the response header the bundle the
+// following bytes belong to.
+const bundleProtocol = protocol.ID("/ethofs/bundle/1.0.0")
+
+const (
+	// defaultBundleRoots is the number of roots of a served bundle.
+	defaultBundleRoots = 256
+
+	// bundleRefresh is the age a served bundle is rebuilt at.
+	bundleRefresh = 6 * time.Hour
+
+	// bundleRebuildInterval is the minimum time between two builds of the
+	// served bundle, failed ones included.
+	bundleRebuildInterval = 10 * time.Minute
+
+	// maxBundleSize caps the bundles built and downloaded.
+	maxBundleSize = 16 << 30
+
+	// bundleTimeout bounds a single download attempt.
+	bundleTimeout = 2 * time.Hour
+
+	// bundleAttempts is the number of times a download from a seed is
+	// resumed before moving on to the next seed.
+	bundleAttempts = 3
+
+	// bundleFile is the name of the bundle served by seeds in the repo.
+	bundleFile = "bundle.car"
+
+	// coldStartFile is the name of the partial download in the repo, resumed
+	// on restarts, and coldStartMetaFile holds the bundle it belongs to.
+	coldStartFile     = "coldstart.car.part"
+	coldStartMetaFile = "coldstart.json"
+)
+
+// coldStartKey marks the repo as seeded by a cold-start bundle.
+var coldStartKey = datastore.NewKey("/ethofs/coldstart")
+
+var (
+	errBundleUnavailable = errors.New("no cold-start bundle available")
+	errBundleCorrupt     = errors.New("cold-start bundle does not match its hash")
+	errBundleTooLarge    = errors.New("cold-start bundle exceeds maximum size")
+)
+
+var bundleBytesMeter = metrics.NewRegisteredMeter("ethofs/coldstart/bytes", nil)
+
+// bundleRequest asks a seed for its bundle, from the offset on if the hash
+// matches the current bundle.
+type bundleRequest struct {
+	Offset uint64 `json:"offset"`
+	Sha256 string `json:"sha256"`
+}
+
+// bundleHeader describes the bundle streamed after it, starting at Offset.
+type bundleHeader struct {
+	Size   uint64 `json:"size"`
+	Sha256 string `json:"sha256"`
+	Offset uint64 `json:"offset"`
+	Error  string `json:"error,omitempty"`
+}
+
+// bundleServer builds and serves the cold-start bundle of a seed node: a
+// CAR file of the most popular pinned roots, as reported by the popularity
+// gossip, topped up with other recursive pins.
+type bundleServer struct {
+	node  *core.IpfsNode
+	path  string
+	roots int
+
+	lock     sync.Mutex
+	size     uint64
+	sum      string
+	built    time.Time
+	active   int          // streams reading the current bundle file
+	building bool         // whether a build is running
+	tried    time.Time    // start of the last build
+	pending  *builtBundle // bundle waiting for the readers of the current one
+}
+
+// builtBundle is a bundle file written next to the served one.
+type builtBundle struct {
+	size  uint64
+	sum   string
+	built time.Time
+}
+
+// limitedWriter fails the writes beyond its remaining bytes.
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, errBundleTooLarge
+	}
+	n, err := l.w.Write(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// serveBundle offers the cold-start bundle of the node over the bundle
+// protocol.
+func serveBundle(node *core.IpfsNode, repoPath string, cfg *ColdStartConfig) {
+	b := &bundleServer{node: node, path: filepath.Join(repoPath, bundleFile), roots: cfg.Roots}
+	if b.roots == 0 {
+		b.roots = defaultBundleRoots
+	}
+	node.PeerHost.SetStreamHandler(bundleProtocol, b.handle)
+}
+
+// bundleRoots selects the roots of the bundle.
+func (b *bundleServer) bundleRoots(ctx context.Context) ([]cid.Cid, error) {
+	var (
+		roots = make([]cid.Cid, 0, b.roots)
+		seen  = make(map[cid.Cid]struct{})
+	)
+	for _, c := range currentPopularity().popular(b.roots) {
+		if _, pinned, err := b.node.Pinning.IsPinnedWithType(ctx, c, pin.Recursive); err == nil && pinned {
+			roots = append(roots, c)
+			seen[c] = struct{}{}
+		}
+	}
+	if len(roots) < b.roots {
+		err := localPins.each(ctx, func(c cid.Cid, mode pin.Mode) bool {
+			if _, ok := seen[c]; !ok && mode == pin.Recursive {
+				roots = append(roots, c)
+			}
+			return len(roots) < b.roots
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return roots, nil
+}
+
+// current returns the size and hash of the bundle, rebuilding it if it is
+// missing or stale. Builds run without the lock, at most one at a time and
+// one per bundleRebuildInterval, a stale bundle is served until the new one
+// is installed. The caller has to release it.
+func (b *bundleServer) current(ctx context.Context) (uint64, string, error) {
+	b.lock.Lock()
+	b.install()
+	rebuild := (b.sum == "" || time.Since(b.built) > bundleRefresh) && !b.building && b.pending == nil &&
+		time.Since(b.tried) >= bundleRebuildInterval
+	if rebuild {
+		b.building, b.tried = true, time.Now()
+	}
+	b.lock.Unlock()
+
+	if rebuild {
+		built, err := b.build(ctx)
+
+		b.lock.Lock()
+		b.building = false
+		if err != nil {
+			log.Warn("ethoFS - unable to build cold-start bundle", "error", err)
+		} else {
+			b.pending = built
+			b.install()
+		}
+		b.lock.Unlock()
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.sum == "" {
+		return 0, "", errBundleUnavailable
+	}
+	b.active++
+	return b.size, b.sum, nil
+}
+
+func (b *bundleServer) release() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.active--
+	b.install()
+}
+
+// install replaces the served bundle with the pending one once no download
+// reads it anymore. The lock has to be held.
+func (b *bundleServer) install() {
+	if b.pending == nil || b.active > 0 {
+		return
+	}
+	built := b.pending
+	b.pending = nil
+
+	if err := os.Rename(b.path+".tmp", b.path); err != nil {
+		log.Warn("ethoFS - unable to install cold-start bundle", "error", err)
+		return
+	}
+	b.size, b.sum, b.built = built.size, built.sum, built.built
+	log.Info("ethoFS - cold-start bundle installed", "size", b.size, "sha256", b.sum)
+}
+
+// build writes a new bundle file next to the served one, hashing it on the
+// way.
+func (b *bundleServer) build(ctx context.Context) (*builtBundle, error) {
+	roots, err := b.bundleRoots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return nil, errBundleUnavailable
+	}
+	tmp := b.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		hash = sha256.New()
+		w    = bufio.NewWriter(&limitedWriter{w: io.MultiWriter(f, hash), n: maxBundleSize})
+		dag  = merkledag.NewDAGService(blockservice.New(b.node.Blockstore, offline.Exchange(b.node.Blockstore)))
+	)
+	err = car.WriteCar(ctx, currentDAGWorkers().getter(dag), roots, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	var size int64
+	if err == nil {
+		size, err = f.Seek(0, io.SeekCurrent)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	built := &builtBundle{size: uint64(size), sum: hex.EncodeToString(hash.Sum(nil)), built: time.Now()}
+	log.Info("ethoFS - cold-start bundle built", "roots", len(roots), "size", built.size, "sha256", built.sum)
+	return built, nil
+}
+
+// handle streams the bundle to a downloading node.
+func (b *bundleServer) handle(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(bundleTimeout))
+
+	var req bundleRequest
+	if err := json.NewDecoder(io.LimitReader(s, maxReplicateMessageSize)).Decode(&req); err != nil {
+		s.Reset()
+		return
+	}
+	ctx, cancel := context.WithTimeout(b.node.Context(), bundleTimeout)
+	defer cancel()
+
+	size, sum, err := b.current(ctx)
+	if err != nil {
+		json.NewEncoder(s).Encode(&bundleHeader{Error: err.Error()})
+		return
+	}
+	defer b.release()
+
+	header := bundleHeader{Size: size, Sha256: sum}
+	if req.Sha256 == sum && req.Offset <= size {
+		header.Offset = req.Offset
+	}
+	f, err := os.Open(b.path)
+	if err == nil {
+		_, err = f.Seek(int64(header.Offset), io.SeekStart)
+	}
+	if err != nil {
+		json.NewEncoder(s).Encode(&bundleHeader{Error: err.Error()})
+		return
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(s).Encode(&header); err != nil {
+		s.Reset()
+		return
+	}
+	n, err := io.Copy(s, f)
+	if err != nil {
+		s.Reset()
+	}
+	log.Debug("ethoFS - served cold-start bundle", "peer", s.Conn().RemotePeer(), "offset", header.Offset, "bytes", n, "error", err)
+}
+
+// coldStartMeta identifies the bundle a partial download belongs to.
+type coldStartMeta struct {
+	Seed   string `json:"seed"`
+	Size   uint64 `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+// coldStart seeds a new hosting node with the bundle of the first seed able
+// to provide it. Repos seeded before are left alone.
+func coldStart(ctx context.Context, node *core.IpfsNode, repoPath string, seeds []string) error {
+	if len(seeds) == 0 {
+		return nil
+	}
+	if done, err := node.Repo.Datastore().Has(coldStartKey); err != nil || done {
+		return err
+	}
+	var (
+		part     = filepath.Join(repoPath, coldStartFile)
+		metaPath = filepath.Join(repoPath, coldStartMetaFile)
+		lastErr  = errBundleUnavailable
+	)
+	for _, seed := range seeds {
+		addr, err := ma.NewMultiaddr(seed)
+		if err != nil {
+			return err
+		}
+		info, err := peer.AddrInfoFromP2pAddr(addr)
+		if err != nil {
+			return err
+		}
+		var meta *coldStartMeta
+		for attempt := 0; attempt < bundleAttempts; attempt++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if meta, err = downloadBundle(ctx, node, *info, part, metaPath); err == nil {
+				break
+			}
+			log.Warn("ethoFS - cold-start bundle download interrupted", "seed", info.ID, "attempt", attempt+1, "error", err)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := importBundle(ctx, node, part, meta); err != nil {
+			os.Remove(part)
+			os.Remove(metaPath)
+			lastErr = err
+			log.Warn("ethoFS - cold-start bundle rejected", "seed", info.ID, "error", err)
+			continue
+		}
+		os.Remove(part)
+		os.Remove(metaPath)
+		return node.Repo.Datastore().Put(coldStartKey, []byte(meta.Sha256))
+	}
+	return lastErr
+}
+
+// readColdStartMeta returns the bundle of the partial download, nil if there
+// is none.
+func readColdStartMeta(path string) *coldStartMeta {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	meta := new(coldStartMeta)
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil
+	}
+	return meta
+}
+
+// downloadBundle downloads the bundle of the seed to the part file, resuming
+// a previous download of the same bundle.
+func downloadBundle(ctx context.Context, node *core.IpfsNode, seed peer.AddrInfo, part, metaPath string) (*coldStartMeta, error) {
+	ctx, cancel := context.WithTimeout(ctx, bundleTimeout)
+	defer cancel()
+
+	req := bundleRequest{}
+	if meta := readColdStartMeta(metaPath); meta != nil && meta.Seed == seed.ID.Pretty() {
+		if fi, err := os.Stat(part); err == nil {
+			req = bundleRequest{Offset: uint64(fi.Size()), Sha256: meta.Sha256}
+		}
+	}
+	err := node.PeerHost.Connect(ctx, seed)
+	dialFailures.record("coldstart", seed.ID, err)
+	if err != nil {
+		return nil, err
+	}
+	s, err := node.PeerHost.NewStream(ctx, seed.ID, bundleProtocol)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Reset()
+	s.SetDeadline(time.Now().Add(bundleTimeout))
+
+	if err := json.NewEncoder(s).Encode(&req); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(s)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	var header bundleHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		return nil, err
+	}
+	if header.Error != "" {
+		return nil, errors.New(header.Error)
+	}
+	if header.Size > maxBundleSize {
+		return nil, errBundleTooLarge
+	}
+	if header.Offset > header.Size {
+		return nil, fmt.Errorf("seed resumed at %d beyond the bundle size %d", header.Offset, header.Size)
+	}
+	meta := &coldStartMeta{Seed: seed.ID.Pretty(), Size: header.Size, Sha256: header.Sha256}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if header.Offset == 0 {
+		flags |= os.O_TRUNC
+	} else if header.Offset != req.Offset {
+		return nil, fmt.Errorf("seed resumed at %d instead of %d", header.Offset, req.Offset)
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(metaPath, data, 0600); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(part, flags, 0600)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("ethoFS - downloading cold-start bundle", "seed", seed.ID, "size", header.Size, "offset", header.Offset)
+
+	n, err := io.Copy(f, io.LimitReader(r, int64(header.Size-header.Offset)))
+	bundleBytesMeter.Mark(n)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if header.Offset+uint64(n) != header.Size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return meta, nil
+}
+
+// importBundle checks the downloaded bundle against its hash and imports it.
+// Every block is checked against its CID while loading the CAR file.
+func importBundle(ctx context.Context, node *core.IpfsNode, part string, meta *coldStartMeta) error {
+	f, err := os.Open(part)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != meta.Sha256 {
+		return errBundleCorrupt
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	roots, err := importCAR(ctx, node, bufio.NewReader(f))
+	if err != nil {
+		return err
+	}
+	log.Info("ethoFS - cold-start bundle imported", "seed", meta.Seed, "roots", len(roots), "size", meta.Size)
+	return nil
+}
@@ -0,0 +1,53 @@
+package ethofs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBundleInstall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethofs-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &bundleServer{path: filepath.Join(dir, bundleFile), size: 3, sum: "old", built: time.Now(), active: 1}
+	if err := ioutil.WriteFile(b.path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(b.path+".tmp", []byte("new!"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The new bundle waits for the download of the old one
+	b.pending = &builtBundle{size: 4, sum: "new", built: time.Now()}
+	b.install()
+	if b.sum != "old" || b.pending == nil {
+		t.Fatalf("bundle replaced while read: have %s", b.sum)
+	}
+	b.release()
+	if b.sum != "new" || b.size != 4 || b.pending != nil {
+		t.Fatalf("pending bundle not installed: have %s of %d bytes", b.sum, b.size)
+	}
+	if data, err := ioutil.ReadFile(b.path); err != nil || string(data) != "new!" {
+		t.Errorf("bundle file mismatch: have %q, %v", data, err)
+	}
+}
+
+func TestBundleSizeLimit(t *testing.T) {
+	var buf bytes.Buffer
+	w := &limitedWriter{w: &buf, n: 4}
+	if _, err := w.Write([]byte("abc")); err != nil {
+		t.Fatalf("write within limit failed: %v", err)
+	}
+	if _, err := w.Write([]byte("de")); err != errBundleTooLarge {
+		t.Errorf("write beyond limit: have %v, want %v", err, errBundleTooLarge)
+	}
+	if buf.String() != "abc" {
+		t.Errorf("written bytes mismatch: have %q", buf.String())
+	}
+}
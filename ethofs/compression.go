@@ -0,0 +1,319 @@
+package ethofs
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	// minCompressSize is the smallest response worth compressing.
+	minCompressSize = 512
+
+	// maxCompressSize is the largest response buffered for compression,
+	// bigger responses are streamed uncompressed.
+	maxCompressSize = 8 * MB
+
+	// defaultCompressionCache is the memory in megabytes the cached
+	// compressed responses may take.
+	defaultCompressionCache = 64
+
+	// maxCompressionEntries bounds the number of cached responses, however
+	// small they are.
+	maxCompressionEntries = 16384
+)
+
+// contentEncoder compresses a response body with a specific content coding.
+type contentEncoder func(w io.Writer) (io.WriteCloser, error)
+
+// contentEncoders are the supported content codings in order of preference.
+var contentEncoders = []struct {
+	name   string
+	encode contentEncoder
+}{
+	{"br", func(w io.Writer) (io.WriteCloser, error) {
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression), nil
+	}},
+	{"gzip", func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, gzip.BestCompression) }},
+	{"deflate", func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.BestCompression) }},
+}
+
+// negotiateEncoding picks the preferred supported coding accepted by the
+// client, or an empty string if none is acceptable.
+func negotiateEncoding(accept string) (string, contentEncoder) {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if coding != "" {
+			accepted[coding] = quality > 0
+		}
+	}
+	for _, enc := range contentEncoders {
+		if ok, found := accepted[enc.name]; ok || (!found && accepted["*"]) {
+			return enc.name, enc.encode
+		}
+	}
+	return "", nil
+}
+
+// isCompressible reports whether responses of the content type benefit from
+// compression.
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/javascript", "application/json", "application/xml", "application/wasm",
+		"application/xhtml+xml", "image/svg+xml":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// compressedResponse is a cached compressed gateway response.
+type compressedResponse struct {
+	header http.Header
+	body   []byte
+}
+
+// size is the memory taken by the cached response.
+func (c *compressedResponse) size() int {
+	n := len(c.body)
+	for name, values := range c.header {
+		n += len(name)
+		for _, value := range values {
+			n += len(value)
+		}
+	}
+	return n
+}
+
+// compressionCache keeps compressed responses within a memory budget,
+// evicting the least recently used ones.
+type compressionCache struct {
+	lock    sync.Mutex
+	entries *simplelru.LRU
+	size    int
+	budget  int
+}
+
+func newCompressionCache(budget int) *compressionCache {
+	c := &compressionCache{budget: budget}
+	c.entries, _ = simplelru.NewLRU(maxCompressionEntries, func(_, value interface{}) {
+		c.size -= value.(*compressedResponse).size()
+	})
+	return c
+}
+
+func (c *compressionCache) get(key string) (*compressedResponse, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	resp, ok := c.entries.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return resp.(*compressedResponse), true
+}
+
+// add caches the response, unless it alone exceeds the budget.
+func (c *compressionCache) add(key string, resp *compressedResponse) {
+	size := resp.size()
+	if size > c.budget {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries.Remove(key)
+	for c.size+size > c.budget {
+		c.entries.RemoveOldest()
+	}
+	c.entries.Add(key, resp)
+	c.size += size
+}
+
+// compressionOption compresses compressible gateway responses with the best
+// content coding accepted by the client, caching the compressed bodies by the
+// CID of the served content within a memory budget of cacheSize megabytes.
+func compressionOption(cacheSize int) corehttp.ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		api, err := coreapi.NewCoreAPI(n)
+		if err != nil {
+			return nil, err
+		}
+		if cacheSize <= 0 {
+			cacheSize = defaultCompressionCache
+		}
+		cache := newCompressionCache(cacheSize * MB)
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			serveCompressed(w, r, api, cache, childMux)
+		})
+		return childMux, nil
+	}
+}
+
+func serveCompressed(w http.ResponseWriter, r *http.Request, api icore.CoreAPI, cache *compressionCache, next http.Handler) {
+	if r.Method != http.MethodGet || r.Header.Get("Range") != "" {
+		next.ServeHTTP(w, r)
+		return
+	}
+	if _, root, _ := splitContentPath(r.URL.Path); root == "" {
+		next.ServeHTTP(w, r)
+		return
+	}
+	encoding, encode := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	if encode == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	// Serve straight from the cache if the content was compressed before
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	resolved, err := api.ResolvePath(ctx, path.New(r.URL.Path))
+	cancel()
+
+	var key string
+	if err == nil {
+		key = encoding + ":" + resolved.Cid().String()
+		if cached, ok := cache.get(key); ok {
+			writeCompressed(w, r, cached)
+			return
+		}
+	}
+	rec := &bufferedResponse{target: w, header: make(http.Header), status: http.StatusOK}
+	next.ServeHTTP(rec, r)
+	if rec.streaming {
+		return
+	}
+	if rec.status != http.StatusOK || rec.header.Get("Content-Encoding") != "" ||
+		rec.body.Len() < minCompressSize || !isCompressible(rec.header.Get("Content-Type")) {
+		rec.flush()
+		return
+	}
+	compressed := new(bytes.Buffer)
+	encoder, err := encode(compressed)
+	if err != nil {
+		rec.flush()
+		return
+	}
+	if _, err := encoder.Write(rec.body.Bytes()); err != nil {
+		rec.flush()
+		return
+	}
+	if err := encoder.Close(); err != nil {
+		rec.flush()
+		return
+	}
+	resp := &compressedResponse{header: rec.header, body: compressed.Bytes()}
+	resp.header.Set("Content-Encoding", encoding)
+	resp.header.Del("Content-Length")
+
+	if key != "" {
+		cache.add(key, resp)
+	}
+	writeCompressed(w, r, resp)
+}
+
+func writeCompressed(w http.ResponseWriter, r *http.Request, resp *compressedResponse) {
+	for name, values := range resp.header {
+		w.Header()[name] = values
+	}
+	if etag := resp.header.Get("Etag"); etag != "" && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp.body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp.body)
+}
+
+// bufferedResponse captures a response for compression, falling back to
+// streaming it to the target writer once it exceeds maxCompressSize.
+type bufferedResponse struct {
+	target    http.ResponseWriter
+	header    http.Header
+	status    int
+	body      bytes.Buffer
+	streaming bool
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	if b.streaming {
+		return b.target.Header()
+	}
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if !b.streaming {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	if b.streaming {
+		return b.target.Write(data)
+	}
+	if b.body.Len()+len(data) <= maxCompressSize {
+		return b.body.Write(data)
+	}
+	b.flush()
+	return b.target.Write(data)
+}
+
+// Flush implements http.Flusher. Flushing handlers stream their response, so
+// the buffered part is sent uncompressed.
+func (b *bufferedResponse) Flush() {
+	if !b.streaming {
+		b.flush()
+	}
+	if flusher, ok := b.target.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// flush writes the buffered header and body to the target writer and switches
+// to streaming mode.
+func (b *bufferedResponse) flush() {
+	for name, values := range b.header {
+		b.target.Header()[name] = values
+	}
+	b.target.WriteHeader(b.status)
+	b.target.Write(b.body.Bytes())
+	b.body.Reset()
+	b.streaming = true
+}
@@ -0,0 +1,115 @@
+package ethofs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"deflate, gzip;q=0.8", "gzip"},
+		{"gzip;q=0, deflate", "deflate"},
+		{"GZIP", "gzip"},
+		{"*", "br"},
+		{"*, br;q=0, gzip;q=0", "deflate"},
+		{"br", "br"},
+		{"gzip, br", "br"},
+		{"gzip, br;q=0", "gzip"},
+	}
+	for _, tt := range tests {
+		if have, _ := negotiateEncoding(tt.accept); have != tt.want {
+			t.Errorf("%q: encoding mismatch: have %q, want %q", tt.accept, have, tt.want)
+		}
+	}
+}
+
+func TestIsCompressible(t *testing.T) {
+	tests := map[string]bool{
+		"text/html; charset=utf-8": true,
+		"application/javascript":   true,
+		"application/ld+json":      true,
+		"image/svg+xml":            true,
+		"image/png":                false,
+		"application/octet-stream": false,
+		"":                         false,
+	}
+	for contentType, want := range tests {
+		if have := isCompressible(contentType); have != want {
+			t.Errorf("%q: have %v, want %v", contentType, have, want)
+		}
+	}
+}
+
+func TestBrotliEncoding(t *testing.T) {
+	_, encode := negotiateEncoding("br")
+	data := bytes.Repeat([]byte("ethoFS gateway response "), 100)
+
+	buf := new(bytes.Buffer)
+	enc, err := encode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enc.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := ioutil.ReadAll(brotli.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain, data) {
+		t.Error("brotli round trip mismatch")
+	}
+}
+
+func TestCompressionCacheBudget(t *testing.T) {
+	cache := newCompressionCache(1000)
+	response := func(n int) *compressedResponse {
+		return &compressedResponse{header: make(http.Header), body: make([]byte, n)}
+	}
+	cache.add("a", response(400))
+	cache.add("b", response(400))
+	cache.add("c", response(400)) // evicts a
+	if _, ok := cache.get("a"); ok {
+		t.Error("least recently used response not evicted")
+	}
+	if _, ok := cache.get("c"); !ok {
+		t.Error("latest response not cached")
+	}
+	cache.add("huge", response(2000))
+	if _, ok := cache.get("huge"); ok {
+		t.Error("response over the budget cached")
+	}
+	if cache.size > cache.budget {
+		t.Errorf("cache over budget: %d > %d", cache.size, cache.budget)
+	}
+}
+
+func TestBufferedResponseFlush(t *testing.T) {
+	target := httptest.NewRecorder()
+	rec := &bufferedResponse{target: target, header: make(http.Header), status: http.StatusOK}
+
+	var w http.ResponseWriter = rec
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		t.Fatal("buffered response drops http.Flusher")
+	}
+	rec.Write([]byte("event: update\n\n"))
+	flusher.Flush()
+	if !target.Flushed || target.Body.String() != "event: update\n\n" || !rec.streaming {
+		t.Errorf("flush not passed through: flushed %v, body %q", target.Flushed, target.Body.String())
+	}
+}
@@ -0,0 +1,1086 @@
+package ethofs
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	humanize "github.com/dustin/go-humanize"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// defaultBootstrapNodes are the ethoFS gateway nodes dialed at startup unless
+// the operator configures a different bootstrap set.
+var defaultBootstrapNodes = []string{
+	"/ip4/164.68.107.82/tcp/4001/ipfs/QmeG81bELkgLBZFYZc53ioxtvRS8iNVzPqxUBKSuah2rcQ",
+	"/ip4/164.68.98.94/tcp/4001/ipfs/QmRYw68MzD4jPvner913mLWBdFfpPfNUx8SRFjiUCJNA4f",
+	"/ip4/51.38.131.241/tcp/4001/ipfs/QmaGGSUqoFpv6wuqvNKNBsxDParVuGgV3n3iPs2eVWeSN4",
+	"/ip4/164.68.108.54/tcp/4001/ipfs/QmRwQ49Zknc2dQbywrhT8ArMDS9JdmnEyGGy4mZ1wDkgaX",
+	"/ip4/51.77.150.202/tcp/4001/ipfs/QmUEy4ScCYCgP6GRfVgrLDqXfLXnUUh4eKaS1fDgaCoGQJ",
+	"/ip4/51.79.70.144/tcp/4001/ipfs/QmTcwcKqKcnt84wCecShm1zdz1KagfVtqopg1xKLiwVJst",
+	"/ip4/142.44.246.43/tcp/4001/ipfs/QmPW8zExrEeno85Us3H1bk68rBo7N7WEhdpU9pC9wjQxgu",
+}
+
+// Config contains the settings of the embedded ethoFS node.
+type Config struct {
+	// Disabled turns the embedded node off even if a node type is configured.
+	Disabled bool `toml:",omitempty"`
+
+	// NodeType selects the hosting role of the node (gn, mn or sn).
+	NodeType string `toml:",omitempty"`
+
+	// RepoPath is the location of the ethoFS repo. If empty, the repo lives
+	// in the directory named by ETHOFS_PATH, or else in the ethofs directory
+	// of the default data directory ($XDG_DATA_HOME on Linux, if set and no
+	// repo exists in the data directory yet).
+	RepoPath string `toml:",omitempty"`
+
+	// Routing selects the DHT mode (dht, dhtclient or none). If empty, the
+	// mode is derived from the node type.
+	Routing string `toml:",omitempty"`
+
+	// Light runs a retrieval-only node for wallets and low-power devices: it
+	// uses an in-memory repo discarded on shutdown, never reprovides content
+	// and neither pins nor processes the hosting contract uploads. Routing
+	// defaults to dhtclient.
+	Light bool `toml:",omitempty"`
+
+	// PinDuration is the number of blocks the content pinned for the hosting
+	// contract is kept, unless extended by ethofs_extendPin. Zero keeps it
+	// until the contract uploads no longer need the node.
+	PinDuration uint64 `toml:",omitempty"`
+
+	// Offline runs the node without networking: content is only added to and
+	// read from the local repo, the node never joins the swarm and neither
+	// processes the hosting contract uploads. ethofs_goOnline attaches the
+	// node to the swarm later on.
+	Offline bool `toml:",omitempty"`
+
+	// Profile is the comma separated list of IPFS config profiles applied on
+	// repo initialization. The test profile additionally isolates the node
+	// for running several instances on one machine, see testProfile.
+	Profile string
+
+	// KeySize is the bit size of the node identity key generated on repo
+	// initialization.
+	KeySize int
+
+	// Seed initializes the repo deterministically for reproducible devnets:
+	// the identity key, the swarm key, the listen ports and the bootstrap
+	// peers are all derived from it. Seeded nodes only bootstrap from the
+	// first node of their devnet.
+	Seed string `toml:",omitempty"`
+
+	// SeedIndex is the index of the node within the seeded devnet.
+	SeedIndex int `toml:",omitempty"`
+
+	// SeedAssets adds the IPFS getting started documents to newly initialized
+	// repos.
+	SeedAssets bool `toml:",omitempty"`
+
+	// SwarmKey is the source of the pre-shared key of the private network. See
+	// parseSwarmKeySource for the supported formats. If empty, the key file
+	// named by ETHOFS_SWARM_KEY_FILE is used, or else the key of the repo.
+	SwarmKey string `toml:",omitempty"`
+
+	// SwarmKeyRefresh is how often file and contract key sources are polled
+	// for key rotations.
+	SwarmKeyRefresh time.Duration `toml:",omitempty"`
+
+	// SwarmAddresses are the multiaddrs the swarm listens on. If empty, the
+	// addresses already stored in the repo config are kept.
+	SwarmAddresses []string `toml:",omitempty"`
+
+	// NAT configures how the node is reached from behind NATs and firewalls,
+	// e.g. hosting nodes on home connections.
+	NAT NATConfig
+
+	// BootstrapNodes are the multiaddrs of the peers dialed at startup.
+	BootstrapNodes []string
+
+	// BootstrapSources are queried periodically for the current gateway
+	// nodes, which are dialed in addition to BootstrapNodes. See
+	// parseBootstrapSource for the supported formats.
+	BootstrapSources []string `toml:",omitempty"`
+
+	// BootstrapRefresh is how often the bootstrap sources are queried.
+	BootstrapRefresh time.Duration `toml:",omitempty"`
+
+	// MinBootstrapPeers is the number of bootstrap peers that have to be
+	// connected for a bootstrap to succeed.
+	MinBootstrapPeers int `toml:",omitempty"`
+
+	// MinPeers is the swarm peer count below which the node re-bootstraps.
+	MinPeers int `toml:",omitempty"`
+
+	// ReconnectInterval is how often the swarm health is checked and
+	// unreachable bootstrap peers are redialed.
+	ReconnectInterval time.Duration `toml:",omitempty"`
+
+	// StorageMax is the storage quota of the repo (e.g. "50GB"). If empty, the
+	// quota depends on the node type.
+	StorageMax string `toml:",omitempty"`
+
+	// GCWatermark is the percentage of StorageMax above which garbage
+	// collection runs.
+	GCWatermark int `toml:",omitempty"`
+
+	// GCPeriod is how often garbage collection runs regardless of the repo
+	// size. Above the watermark it runs right away.
+	GCPeriod time.Duration `toml:",omitempty"`
+
+	// DAGWorkers caps the blocks read at once by the DAG walks of pinning,
+	// garbage collection, pin size accounting and exports, all together, so
+	// maintenance does not starve the chain import on shared machines. Zero
+	// leaves the walks unbounded.
+	DAGWorkers int `toml:",omitempty"`
+
+	// BlockReplicas are read-only flatfs block directories of other nodes,
+	// e.g. NFS shares of a common block pool, consulted for missing blocks
+	// before fetching them from the swarm.
+	BlockReplicas []string `toml:",omitempty"`
+
+	// MigrationSources are the peer IDs of nodes allowed to migrate their
+	// content to this node, which pins everything they send.
+	MigrationSources []string `toml:",omitempty"`
+
+	// Quorum configures the peers confirming replications of critical pins.
+	Quorum QuorumConfig
+
+	// Fetch configures the parallel retrieval of complete DAGs by
+	// ethofs_fetch.
+	Fetch FetchConfig
+
+	// Startup controls the retries of a failed node startup.
+	Startup StartupConfig
+
+	// Reprovide throttles the announcements of the repo's content to the
+	// DHT.
+	Reprovide ReprovideConfig
+
+	// RepoMigration controls the upgrade of repos created by older go-ipfs
+	// versions.
+	RepoMigration RepoMigrationConfig
+
+	// Blockstore selects an external storage engine for the blocks of newly
+	// initialized repos.
+	Blockstore BlockstoreConfig
+
+	// Resources constrains the connections and bandwidth of the node.
+	Resources ResourceConfig
+
+	// PubSub configures the libp2p pubsub messaging of the node.
+	PubSub PubSubConfig
+
+	// IPNSCache configures the stale-while-revalidate cache of IPNS name
+	// resolutions.
+	IPNSCache IPNSCacheConfig
+
+	// NotFoundCache configures the cache of content lookups that recently
+	// failed.
+	NotFoundCache NotFoundCacheConfig
+
+	// Admin configures the authenticated admin RPC endpoint.
+	Admin AdminConfig
+
+	// HealthAddr is the host:port of the /healthz endpoint reporting the
+	// health of the node, answering 503 while it is degraded. Empty disables
+	// it.
+	HealthAddr string `toml:",omitempty"`
+
+	// Redirector configures the endpoint balancing content requests across
+	// the known gateways of the network.
+	Redirector RedirectorConfig
+
+	// Verifier configures the proof-of-hosting checks of the content pinned
+	// for the hosting contract.
+	Verifier VerifierConfig
+
+	// Integrity configures the scheduled proofs of the continued storage of
+	// the pinned content, posted on chain for reward eligibility.
+	Integrity IntegrityConfig
+
+	// ReceiptContract is the address of the contract the hashes of upload
+	// receipts are anchored in. If empty, receipts are only signed.
+	ReceiptContract string `toml:",omitempty"`
+
+	// ProviderRegistry is the address of the contract recording the hosts of
+	// the content of the hosting contract. If set, the registered hosts are
+	// dialed before retrieving content, skipping the DHT provider search.
+	ProviderRegistry string `toml:",omitempty"`
+
+	// SLO is the service level objective the RPC methods are evaluated
+	// against by ethofs_slo.
+	SLO SLOConfig
+
+	// Gateway contains the settings of the HTTP gateway served by gateway
+	// nodes.
+	Gateway GatewayConfig
+
+	// ColdStart configures the bundles of popular content new hosting nodes
+	// download from seed nodes before they start hosting.
+	ColdStart ColdStartConfig
+
+	// Clock configures the checks of the local clock against NTP, as skewed
+	// clocks make peers reject the signed records of the node.
+	Clock ClockConfig
+
+	// Telemetry configures the opt-in reporting of anonymized node
+	// statistics to a network statistics service. It is off by default.
+	Telemetry TelemetryConfig
+
+	// Signatures configures the verification of retrieved content against
+	// the signatures of trusted publishers.
+	Signatures SignatureConfig
+
+	// Credits configures the accounting of the bandwidth exchanged with each
+	// peer.
+	Credits CreditConfig
+
+	// AddHooks configures the hooks run after every successful add, next to
+	// the ones registered with RegisterAddHook.
+	AddHooks AddHookConfig
+
+	// Allowlist restricts the swarm to the peers of a registry, for
+	// permissioned consortium deployments.
+	Allowlist AllowlistConfig
+
+	// ExportRoot is the local directory filesystem exports are written below.
+	// Exports are refused while it is empty.
+	ExportRoot string `toml:",omitempty"`
+
+	// ExportRefresh is how often the IPNS names of watched filesystem exports
+	// are resolved for new roots.
+	ExportRefresh time.Duration `toml:",omitempty"`
+}
+
+// AdminConfig contains the settings of the authenticated admin RPC endpoint
+// serving the ethofs namespace.
+type AdminConfig struct {
+	// ListenAddr is the host:port the endpoint listens on. Empty disables it.
+	ListenAddr string `toml:",omitempty"`
+
+	// Tokens are static bearer tokens accepted by the endpoint.
+	Tokens []string `toml:",omitempty"`
+
+	// JWTSecretFile is a file holding the hex encoded secret of HS256 signed
+	// JSON web tokens accepted by the endpoint.
+	JWTSecretFile string `toml:",omitempty"`
+
+	// Accounts are the Ethereum accounts authenticating by signing a
+	// single-use challenge issued by the endpoint for every request.
+	Accounts []common.Address `toml:",omitempty"`
+
+	// CORS lists the origins allowed to send cross-domain requests.
+	CORS []string `toml:",omitempty"`
+
+	// VirtualHosts lists the hostnames requests are accepted for.
+	VirtualHosts []string `toml:",omitempty"`
+}
+
+// QuorumConfig contains the peers critical content is replicated to before a
+// quorum pin succeeds.
+type QuorumConfig struct {
+	// Peers are the multiaddrs of the quorum peers. Replication requests
+	// are only accepted from them, so peers list each other.
+	Peers []string `toml:",omitempty"`
+
+	// Size is the default number of peers that have to confirm a quorum
+	// pin. Zero requires all of them.
+	Size int `toml:",omitempty"`
+
+	// Timeout bounds a quorum pin, including the local pin.
+	Timeout time.Duration `toml:",omitempty"`
+}
+
+// NATConfig contains the addresses and NAT traversal settings of the swarm.
+// They are written to the repo config at init and on every start.
+type NATConfig struct {
+	// Port replaces the TCP and UDP ports of the listen addresses stored in
+	// the repo config, e.g. to match a port forwarding. Ignored if
+	// SwarmAddresses are set, zero keeps the ports.
+	Port int `toml:",omitempty"`
+
+	// AnnounceAddresses replace the listen addresses advertised to peers,
+	// e.g. the public address of a port forwarding.
+	AnnounceAddresses []string `toml:",omitempty"`
+
+	// NoAnnounceAddresses are never advertised to peers. Entries are
+	// multiaddrs or netmasks like /ip4/10.0.0.0/ipcidr/8.
+	NoAnnounceAddresses []string `toml:",omitempty"`
+
+	// The switches below override the settings of the repo config if set,
+	// nil keeps the stored ones.
+
+	// DisablePortMap stops the node from mapping its port on the router via
+	// UPnP or NAT-PMP.
+	DisablePortMap *bool `toml:",omitempty"`
+
+	// DisableRelay disables connections through circuit relays entirely.
+	DisableRelay *bool `toml:",omitempty"`
+
+	// AutoRelay makes nodes that detect being unreachable advertise
+	// addresses of relays of the swarm instead.
+	AutoRelay *bool `toml:",omitempty"`
+
+	// RelayHop makes the node relay connections of unreachable peers, which
+	// only makes sense for publicly reachable nodes.
+	RelayHop *bool `toml:",omitempty"`
+
+	// AutoNAT is the mode of the service telling peers whether they are
+	// reachable: "enabled", "disabled" or empty for the go-ipfs default.
+	AutoNAT string `toml:",omitempty"`
+}
+
+// StartupConfig contains the retry settings of the supervised node startup.
+type StartupConfig struct {
+	// Retries is the number of times a failed startup is retried before
+	// giving up, leaving the chain node running without ethoFS.
+	Retries int `toml:",omitempty"`
+
+	// Backoff is the delay before the first retry, doubled for every further
+	// one.
+	Backoff time.Duration `toml:",omitempty"`
+}
+
+// ReprovideConfig contains the limits of the periodic announcements of the
+// repo's content, keeping the burst after a restart from saturating the
+// uplink. Leaving both unset reprovides through go-ipfs.
+type ReprovideConfig struct {
+	// Rate is the maximum number of keys announced per second.
+	Rate float64 `toml:",omitempty"`
+
+	// Spread is the window the start of the first reprovide after startup
+	// is randomly delayed within, on top of the minute go-ipfs waits.
+	Spread time.Duration `toml:",omitempty"`
+}
+
+// RepoMigrationConfig contains the settings of the automatic repo migration
+// run before the node opens its repo.
+type RepoMigrationConfig struct {
+	// Disabled refuses to start on outdated repos instead of migrating them.
+	Disabled bool `toml:",omitempty"`
+
+	// External allows running the fs-repo-migrations tool, downloading it if
+	// it is not in the PATH, for upgrades the built-in steps do not cover.
+	External bool `toml:",omitempty"`
+}
+
+// BlockstoreConfig selects the storage engine holding the blocks of the repo.
+type BlockstoreConfig struct {
+	// Type is the name a storage engine was registered under with
+	// RegisterDatastore. If empty, the datastore of the repo profile is used.
+	Type string `toml:",omitempty"`
+
+	// Params are the engine specific settings, e.g. a connection string.
+	Params map[string]string `toml:",omitempty"`
+
+	// ReadVerification selects the blocks re-hashed when read: "all" checks
+	// every block, "untrusted" skips the blocks of the local repo and only
+	// checks the ones read from block replicas, saving the CPU time of the
+	// hashing on busy gateways. Blocks from the swarm are always checked by
+	// bitswap. If empty, Datastore.HashOnRead of the repo config applies.
+	ReadVerification string `toml:",omitempty"`
+}
+
+// ResourceConfig contains the connection and bandwidth limits of the node,
+// keeping it from competing with the chain node on shared hosts.
+type ResourceConfig struct {
+	// MaxConnections is the hard cap of open swarm connections. Inbound
+	// connections beyond it are closed right away. Zero means unlimited.
+	MaxConnections int `toml:",omitempty"`
+
+	// ConnLowWater and ConnHighWater are the watermarks of the libp2p
+	// connection manager: once more than ConnHighWater connections are open,
+	// connections are trimmed down to ConnLowWater. Zero keeps the repo
+	// config.
+	ConnLowWater  int `toml:",omitempty"`
+	ConnHighWater int `toml:",omitempty"`
+
+	// ConnGracePeriod is how long new connections are spared from trimming.
+	ConnGracePeriod time.Duration `toml:",omitempty"`
+
+	// PeerBandwidth caps the rate per second of each peer in each direction
+	// (e.g. "1MB"). Empty means unlimited.
+	PeerBandwidth string `toml:",omitempty"`
+
+	// TransferBandwidth caps the total rate per second of Unixfs transfers
+	// through the gateway and the RPC API (e.g. "10MB"). Empty means
+	// unlimited.
+	TransferBandwidth string `toml:",omitempty"`
+}
+
+// SLOConfig contains the service level objective of the ethofs RPC methods.
+type SLOConfig struct {
+	// Target is the fraction of calls that have to succeed within Latency
+	// (e.g. 0.99).
+	Target float64 `toml:",omitempty"`
+
+	// Latency is the duration above which a call counts as failed.
+	Latency time.Duration `toml:",omitempty"`
+}
+
+// PubSubConfig contains the settings of the pubsub messaging layer, carrying
+// coordination messages between hosting providers over the private swarm.
+type PubSubConfig struct {
+	// Disabled turns pubsub off.
+	Disabled bool `toml:",omitempty"`
+
+	// Router selects the pubsub router (gossipsub or floodsub). If empty, the
+	// router stored in the repo config is used.
+	Router string `toml:",omitempty"`
+	// IPNS publishes and resolves IPNS names over pubsub besides the DHT, so
+	// updates reach the nodes following a name within seconds.
+	IPNS bool `toml:",omitempty"`
+
+	// Popularity gossips bucketed hit counts of the roots served by the node
+	// and raises the replication target of the content the swarm reports as
+	// hot.
+	Popularity bool `toml:",omitempty"`
+}
+
+// IPNSCacheConfig contains the settings of the IPNS resolution cache.
+type IPNSCacheConfig struct {
+	// Disabled resolves every IPNS name lookup through the DHT.
+	Disabled bool `toml:",omitempty"`
+
+	// Size is the number of names cached.
+	Size int `toml:",omitempty"`
+
+	// Fresh is how long a resolution is served without revalidation.
+	Fresh time.Duration `toml:",omitempty"`
+
+	// MaxStale is how long past Fresh a resolution is still served while it
+	// is being revalidated in the background.
+	MaxStale time.Duration `toml:",omitempty"`
+}
+
+// FetchConfig contains the defaults of parallel fetches, used for the options
+// a fetch leaves unset.
+type FetchConfig struct {
+	// Concurrency is the number of blocks requested at once.
+	Concurrency int `toml:",omitempty"`
+
+	// Timeout bounds the retrieval of a single block.
+	Timeout time.Duration `toml:",omitempty"`
+}
+
+// ColdStartConfig contains the settings of the cold-start bundles: CAR files
+// of the most popular content of the network, served by seed nodes so that
+// new hosting nodes hold it before processing the hosting contract.
+type ColdStartConfig struct {
+	// Seeds are the multiaddrs of the seed nodes the bundle is downloaded
+	// from, tried in order, on the first start of a hosting node.
+	Seeds []string `toml:",omitempty"`
+
+	// Serve offers a bundle of the most popular pinned content of this node
+	// to new nodes.
+	Serve bool `toml:",omitempty"`
+
+	// Roots caps the roots of the served bundle.
+	Roots int `toml:",omitempty"`
+}
+
+// ClockConfig contains the settings of the clock skew checks, run at startup
+// and periodically by online nodes.
+type ClockConfig struct {
+	// Disabled turns the checks off, e.g. for nodes without NTP access.
+	Disabled bool `toml:",omitempty"`
+
+	// Server is the host:port of the NTP server the clock is compared with.
+	Server string `toml:",omitempty"`
+
+	// Interval is the time between two checks.
+	Interval time.Duration `toml:",omitempty"`
+
+	// MaxSkew is the clock offset above which the node warns.
+	MaxSkew time.Duration `toml:",omitempty"`
+
+	// Strict refuses to sign hosting reports, upload receipts and IPNS
+	// records while the clock is off by more than MaxSkew.
+	Strict bool `toml:",omitempty"`
+}
+
+// TelemetryConfig contains the settings of the telemetry reports, which help
+// the Etho project understand the capacity of the network. The reports carry
+// the version, node type, region label, repo size, pin count and peer count
+// of the node, see ethofs_telemetry.
+type TelemetryConfig struct {
+	// Enabled turns the reporting on.
+	Enabled bool `toml:",omitempty"`
+
+	// Endpoint is the URL the reports are sent to. Reports to http and https
+	// URLs are POSTed as JSON, other schemes need a sink registered with
+	// RegisterTelemetrySink.
+	Endpoint string `toml:",omitempty"`
+
+	// Interval is the time between two reports.
+	Interval time.Duration `toml:",omitempty"`
+
+	// Region is a label of the location of the node chosen by the operator,
+	// e.g. "eu-west". It is never derived from the addresses of the node.
+	Region string `toml:",omitempty"`
+}
+
+// SignatureConfig contains the settings of the publisher signature checks of
+// the roots retrieved over RPC and the gateway. Signatures are looked up in
+// manifest files and in a registry contract, see ContentSignature.
+type SignatureConfig struct {
+	// Publishers are the addresses of the trusted publishers. Retrieved
+	// content is only verified if set.
+	Publishers []common.Address `toml:",omitempty"`
+
+	// Manifests are files holding JSON lists of content signatures, loaded
+	// at startup.
+	Manifests []string `toml:",omitempty"`
+
+	// Registry is the address of the contract recording content signatures.
+	Registry string `toml:",omitempty"`
+
+	// Strict refuses to return content without a valid signature of a
+	// trusted publisher instead of only logging it.
+	Strict bool `toml:",omitempty"`
+}
+
+// CreditConfig contains the settings of the bandwidth credits, the balances
+// of the block bytes exchanged with each peer over bitswap.
+type CreditConfig struct {
+	// Disabled turns the accounting off.
+	Disabled bool `toml:",omitempty"`
+
+	// DebtLimit is the net number of bytes a peer may owe the node before
+	// the default credit policy deprioritizes its connection.
+	DebtLimit uint64 `toml:",omitempty"`
+}
+
+// AddHookConfig contains the settings of the built-in add hooks, which publish
+// the results of the adds without polling the node.
+type AddHookConfig struct {
+	// Webhooks are URLs the results of the adds are POSTed to as JSON.
+	Webhooks []string `toml:",omitempty"`
+
+	// ManifestDir is the directory a sidecar manifest <cid>.json holding the
+	// result is written to for every added CID.
+	ManifestDir string `toml:",omitempty"`
+
+	// Timeout bounds the run of each hook.
+	Timeout time.Duration `toml:",omitempty"`
+}
+
+// AllowlistConfig contains the settings of the strict peer mode, in which only
+// the peers listed by a registry may connect to the node.
+type AllowlistConfig struct {
+	// Source is the registry of the allowed peer IDs, see
+	// parseAllowlistSource for the supported formats. If empty, every peer
+	// holding the swarm key may connect.
+	Source string `toml:",omitempty"`
+
+	// Refresh is how often the registry is polled for membership changes.
+	Refresh time.Duration `toml:",omitempty"`
+}
+
+// RedirectorConfig contains the settings of the redirector endpoint, which
+// answers requests for a CID with a redirect to the least loaded known gateway
+// providing it.
+type RedirectorConfig struct {
+	// ListenAddr is the host:port the endpoint listens on. Empty disables it.
+	ListenAddr string `toml:",omitempty"`
+
+	// Gateways are the gateways requests are redirected to, given as
+	// <peer ID>=<base URL> pairs.
+	Gateways []string `toml:",omitempty"`
+
+	// Window is the time over which the redirects sent to a gateway count
+	// towards its load.
+	Window time.Duration `toml:",omitempty"`
+}
+
+// IntegrityConfig contains the settings of the integrity proofs, commitments
+// over pinned blocks sampled with the randomness of the chain.
+type IntegrityConfig struct {
+	// Enabled turns the scheduled proofs on.
+	Enabled bool `toml:",omitempty"`
+
+	// Interval is the time between two proofs.
+	Interval time.Duration `toml:",omitempty"`
+
+	// Samples is the number of pinned blocks a proof commits to.
+	Samples int `toml:",omitempty"`
+
+	// ProofContract is the address of the contract the proofs are posted to.
+	// If empty, the proofs are only kept for submission by other means, see
+	// ethofs_integrityProof.
+	ProofContract string `toml:",omitempty"`
+
+	// Account signs the proof transactions. It has to be unlocked in the
+	// account manager of the node.
+	Account string `toml:",omitempty"`
+}
+
+// NotFoundCacheConfig contains the settings of the negative lookup cache.
+type NotFoundCacheConfig struct {
+	// Disabled searches the swarm for every requested CID, even if it was
+	// not found moments ago.
+	Disabled bool `toml:",omitempty"`
+
+	// TTL is how long a failed lookup is remembered.
+	TTL time.Duration `toml:",omitempty"`
+
+	// Size is the number of failed lookups remembered at most.
+	Size int `toml:",omitempty"`
+}
+
+// GatewayConfig contains the settings of the ethoFS HTTP gateway.
+type GatewayConfig struct {
+	// Enabled serves the gateway on mn and sn nodes too. Gateway nodes always
+	// serve it.
+	Enabled bool `toml:",omitempty"`
+
+	// ListenAddr is the host:port (or multiaddr) the gateway binds to. Empty
+	// defaults to port 80 on all interfaces.
+	ListenAddr string `toml:",omitempty"`
+
+	// ReadOnly rejects uploads through the gateway even if the repo config
+	// marks it writable.
+	ReadOnly bool `toml:",omitempty"`
+
+	// PathWhitelist restricts the served content to the listed roots (CIDs or
+	// /ipfs/ and /ipns/ paths) and everything below them. Empty serves all
+	// content.
+	PathWhitelist []string `toml:",omitempty"`
+
+	// ACL flags private content roots only served to requests carrying a
+	// valid token or account signature.
+	ACL []ACLRule `toml:",omitempty"`
+
+	// Previews enables server side generated directory listings and image
+	// thumbnails under /ethofs/preview/ and /ethofs/thumbnail/.
+	Previews bool `toml:",omitempty"`
+
+	// SiteRouting enables per site _redirects rules and custom 404.html pages
+	// for paths that do not exist in a hosted site.
+	SiteRouting bool `toml:",omitempty"`
+
+	// SPARoots lists site roots (CIDs or /ipns/ names) for which unknown paths
+	// are answered with the site's index.html. Implies SiteRouting.
+	SPARoots []string `toml:",omitempty"`
+
+	// VirtualHosts maps custom hostnames to the site roots (CIDs or /ipns/
+	// names) served for requests carrying them in the Host header.
+	VirtualHosts map[string]string `toml:",omitempty"`
+
+	// Compression enables brotli/gzip/deflate encoding of text responses for
+	// clients accepting it.
+	Compression bool `toml:",omitempty"`
+
+	// CompressionCache is the memory in megabytes taken by the compressed
+	// responses kept in memory, keyed by content CID and encoding.
+	CompressionCache int `toml:",omitempty"`
+
+	// NoCoalesce fetches missing content from the swarm for every gateway
+	// request on its own, instead of sharing one fetch between concurrent
+	// requests for the same path.
+	NoCoalesce bool `toml:",omitempty"`
+
+	// CachePolicy controls content fetched from the swarm for gateway users:
+	// "cache" (the default) keeps it until garbage collection, "no-store"
+	// evicts it once served unless it is pinned.
+	CachePolicy string `toml:",omitempty"`
+}
+
+// DefaultConfig contains the default settings of the embedded ethoFS node.
+var DefaultConfig = Config{
+	Profile:           "lowpower",
+	KeySize:           nBitsForKeypairDefault,
+	BootstrapNodes:    defaultBootstrapNodes,
+	SwarmKeyRefresh:   defaultSwarmKeyRefresh,
+	ExportRefresh:     defaultExportRefresh,
+	BootstrapRefresh:  defaultBootstrapRefresh,
+	MinBootstrapPeers: defaultMinBootstrapPeers,
+	MinPeers:          defaultMinPeers,
+	ReconnectInterval: defaultReconnectInterval,
+	GCWatermark:       defaultGCWatermark,
+	GCPeriod:          defaultGCPeriod,
+	Admin: AdminConfig{
+		VirtualHosts: []string{"localhost"},
+	},
+	Quorum: QuorumConfig{
+		Timeout: defaultQuorumTimeout,
+	},
+	Fetch: FetchConfig{
+		Concurrency: defaultFetchConcurrency,
+		Timeout:     defaultFetchTimeout,
+	},
+	Startup: StartupConfig{
+		Retries: defaultStartupRetries,
+		Backoff: defaultStartupBackoff,
+	},
+	Reprovide: ReprovideConfig{
+		Rate:   defaultReprovideRate,
+		Spread: defaultReprovideSpread,
+	},
+	Verifier: VerifierConfig{
+		Interval: defaultVerifyInterval,
+		Targets:  defaultVerifyTargets,
+		Samples:  defaultVerifySamples,
+	},
+	Integrity: IntegrityConfig{
+		Interval: defaultIntegrityInterval,
+		Samples:  defaultIntegritySamples,
+	},
+	SLO: SLOConfig{
+		Target:  defaultSLOTarget,
+		Latency: defaultSLOLatency,
+	},
+	IPNSCache: IPNSCacheConfig{
+		Size:     defaultIPNSCacheSize,
+		Fresh:    defaultIPNSFresh,
+		MaxStale: defaultIPNSMaxStale,
+	},
+	NotFoundCache: NotFoundCacheConfig{
+		TTL:  defaultNotFoundTTL,
+		Size: defaultNotFoundSize,
+	},
+	Gateway: GatewayConfig{
+		CompressionCache: defaultCompressionCache,
+	},
+	Clock: ClockConfig{
+		Server:   ntpServer,
+		Interval: defaultClockInterval,
+		MaxSkew:  maxClockSkew,
+	},
+}
+
+// ethofsConfig is the configuration the package was initialized with.
+var ethofsConfig = DefaultConfig
+
+// Validate checks the configuration for unsupported values.
+func (c *Config) Validate() error {
+	switch c.NodeType {
+	case "", "gn", "mn", "sn":
+	default:
+		return fmt.Errorf("invalid ethoFS node type: %q", c.NodeType)
+	}
+	switch c.Routing {
+	case "", "dht", "dhtclient", "none":
+	default:
+		return fmt.Errorf("invalid ethoFS routing mode: %q", c.Routing)
+	}
+	if c.Light && c.gatewayEnabled() {
+		return errors.New("ethoFS light nodes cannot serve the gateway")
+	}
+	for host, root := range c.Gateway.VirtualHosts {
+		if _, err := normalizeSiteRoot(root); err != nil {
+			return fmt.Errorf("invalid ethoFS virtual host %q: %v", host, err)
+		}
+	}
+	if c.Gateway.ListenAddr != "" {
+		if _, err := gatewayMultiaddr(c.Gateway.ListenAddr); err != nil {
+			return fmt.Errorf("invalid ethoFS gateway address %q: %v", c.Gateway.ListenAddr, err)
+		}
+	}
+	if _, err := newPathWhitelist(c.Gateway.PathWhitelist); err != nil {
+		return fmt.Errorf("invalid ethoFS gateway whitelist: %v", err)
+	}
+	if _, err := newAccessList(c.Gateway.ACL); err != nil {
+		return fmt.Errorf("invalid ethoFS gateway ACL: %v", err)
+	}
+	switch c.Gateway.CachePolicy {
+	case "", cachePolicyCache, cachePolicyNoStore:
+	default:
+		return fmt.Errorf("invalid ethoFS gateway cache policy: %q", c.Gateway.CachePolicy)
+	}
+	if c.Gateway.CompressionCache < 0 {
+		return fmt.Errorf("invalid ethoFS compression cache size: %d", c.Gateway.CompressionCache)
+	}
+	if c.SwarmKey != "" {
+		if _, err := parseSwarmKeySource(c.SwarmKey); err != nil {
+			return fmt.Errorf("invalid ethoFS swarm key: %v", err)
+		}
+	}
+	if c.Telemetry.Enabled && c.Telemetry.Endpoint == "" {
+		return errors.New("ethoFS telemetry enabled without endpoint")
+	}
+	if c.Telemetry.Endpoint != "" {
+		if _, err := url.Parse(c.Telemetry.Endpoint); err != nil {
+			return fmt.Errorf("invalid ethoFS telemetry endpoint: %v", err)
+		}
+	}
+	if c.Telemetry.Interval < 0 {
+		return fmt.Errorf("invalid ethoFS telemetry interval: %v", c.Telemetry.Interval)
+	}
+	if c.Signatures.Registry != "" && !common.IsHexAddress(c.Signatures.Registry) {
+		return fmt.Errorf("invalid ethoFS signature registry address %q", c.Signatures.Registry)
+	}
+	if len(c.Signatures.Publishers) > 0 && len(c.Signatures.Manifests) == 0 && c.Signatures.Registry == "" {
+		return errors.New("ethoFS signature checks need a manifest or a registry")
+	}
+	if c.Signatures.Strict && len(c.Signatures.Publishers) == 0 {
+		return errors.New("strict ethoFS signature checks need trusted publishers")
+	}
+	for _, endpoint := range c.AddHooks.Webhooks {
+		if err := validateWebhook(endpoint); err != nil {
+			return fmt.Errorf("invalid ethoFS add webhook %q: %v", endpoint, err)
+		}
+	}
+	if c.AddHooks.Timeout < 0 {
+		return fmt.Errorf("invalid ethoFS add hook timeout: %v", c.AddHooks.Timeout)
+	}
+	if c.Allowlist.Source != "" {
+		if _, err := parseAllowlistSource(c.Allowlist.Source); err != nil {
+			return fmt.Errorf("invalid ethoFS peer allow-list: %v", err)
+		}
+	}
+	if c.Allowlist.Refresh < 0 {
+		return fmt.Errorf("invalid ethoFS peer allow-list refresh interval: %v", c.Allowlist.Refresh)
+	}
+	if c.Clock.Interval < 0 {
+		return fmt.Errorf("invalid ethoFS clock check interval: %v", c.Clock.Interval)
+	}
+	if c.Clock.MaxSkew < 0 {
+		return fmt.Errorf("invalid ethoFS maximum clock skew: %v", c.Clock.MaxSkew)
+	}
+	if c.SwarmKeyRefresh < 0 {
+		return fmt.Errorf("invalid ethoFS swarm key refresh interval: %v", c.SwarmKeyRefresh)
+	}
+	if c.ExportRoot != "" && !filepath.IsAbs(c.ExportRoot) {
+		return fmt.Errorf("invalid ethoFS export root, has to be absolute: %q", c.ExportRoot)
+	}
+	if c.ExportRefresh < 0 {
+		return fmt.Errorf("invalid ethoFS export refresh interval: %v", c.ExportRefresh)
+	}
+	switch c.PubSub.Router {
+	case "", "gossipsub", "floodsub":
+	default:
+		return fmt.Errorf("invalid ethoFS pubsub router: %q", c.PubSub.Router)
+	}
+	if c.PubSub.IPNS && c.PubSub.Disabled {
+		return errors.New("ethoFS IPNS over pubsub needs pubsub enabled")
+	}
+	if c.PubSub.Popularity && c.PubSub.Disabled {
+		return errors.New("ethoFS popularity gossip needs pubsub enabled")
+	}
+	if c.NAT.Port < 0 || c.NAT.Port > 65535 {
+		return fmt.Errorf("invalid ethoFS swarm port: %d", c.NAT.Port)
+	}
+	for _, addr := range c.NAT.AnnounceAddresses {
+		if _, err := ma.NewMultiaddr(addr); err != nil {
+			return fmt.Errorf("invalid ethoFS announce address %q: %v", addr, err)
+		}
+	}
+	switch c.NAT.AutoNAT {
+	case "", autoNATEnabled, autoNATDisabled:
+	default:
+		return fmt.Errorf("invalid ethoFS AutoNAT mode: %q", c.NAT.AutoNAT)
+	}
+	if c.SeedIndex < 0 || c.SeedIndex >= maxSeedNodes {
+		return fmt.Errorf("invalid ethoFS seed index: %d", c.SeedIndex)
+	}
+	for _, spec := range c.BootstrapSources {
+		if _, err := parseBootstrapSource(spec); err != nil {
+			return fmt.Errorf("invalid ethoFS bootstrap source: %v", err)
+		}
+	}
+	if c.BootstrapRefresh < 0 {
+		return fmt.Errorf("invalid ethoFS bootstrap refresh interval: %v", c.BootstrapRefresh)
+	}
+	if c.MinBootstrapPeers < 0 {
+		return fmt.Errorf("invalid ethoFS minimum bootstrap peer count: %d", c.MinBootstrapPeers)
+	}
+	if c.MinPeers < 0 {
+		return fmt.Errorf("invalid ethoFS minimum peer count: %d", c.MinPeers)
+	}
+	if c.ReconnectInterval < 0 {
+		return fmt.Errorf("invalid ethoFS reconnect interval: %v", c.ReconnectInterval)
+	}
+	if c.StorageMax != "" {
+		if _, err := humanize.ParseBytes(c.StorageMax); err != nil {
+			return fmt.Errorf("invalid ethoFS storage quota %q: %v", c.StorageMax, err)
+		}
+	}
+	if c.GCWatermark < 0 || c.GCWatermark > 100 {
+		return fmt.Errorf("invalid ethoFS GC watermark: %d%%", c.GCWatermark)
+	}
+	if c.GCPeriod < 0 {
+		return fmt.Errorf("invalid ethoFS GC period: %v", c.GCPeriod)
+	}
+	if c.DAGWorkers < 0 {
+		return fmt.Errorf("invalid ethoFS DAG worker count: %d", c.DAGWorkers)
+	}
+	if _, err := migrationSources(c.MigrationSources); err != nil {
+		return fmt.Errorf("invalid ethoFS migration source: %v", err)
+	}
+	if _, err := parsePeerAddrs(c.ColdStart.Seeds); err != nil {
+		return fmt.Errorf("invalid ethoFS cold-start seed: %v", err)
+	}
+	if c.ColdStart.Roots < 0 {
+		return fmt.Errorf("invalid ethoFS cold-start bundle root count: %d", c.ColdStart.Roots)
+	}
+	if _, err := parsePeerAddrs(c.Quorum.Peers); err != nil {
+		return fmt.Errorf("invalid ethoFS quorum peer: %v", err)
+	}
+	if q := c.Quorum; q.Size < 0 || q.Size > len(q.Peers) || q.Timeout < 0 {
+		return fmt.Errorf("invalid ethoFS quorum settings: %+v", q)
+	}
+	if f := c.Fetch; f.Concurrency < 0 || f.Concurrency > maxFetchConcurrency || f.Timeout < 0 {
+		return fmt.Errorf("invalid ethoFS fetch settings: %+v", f)
+	}
+	if c.Reprovide.Rate < 0 || c.Reprovide.Spread < 0 {
+		return fmt.Errorf("invalid ethoFS reprovide settings: %+v", c.Reprovide)
+	}
+	if c.Startup.Retries < 0 || c.Startup.Backoff < 0 {
+		return fmt.Errorf("invalid ethoFS startup retry settings: %+v", c.Startup)
+	}
+	if c.Blockstore.Type != "" && !datastoreRegistered(c.Blockstore.Type) {
+		return fmt.Errorf("unknown ethoFS blockstore type %q, registered: %v", c.Blockstore.Type, RegisteredDatastores())
+	}
+	switch c.Blockstore.ReadVerification {
+	case "", readVerifyAll, readVerifyUntrusted:
+	default:
+		return fmt.Errorf("invalid ethoFS read verification mode: %q", c.Blockstore.ReadVerification)
+	}
+	if c.NotFoundCache.TTL < 0 {
+		return fmt.Errorf("invalid ethoFS negative cache TTL: %v", c.NotFoundCache.TTL)
+	}
+	if v := c.Verifier; v.Interval < 0 || v.Targets < 0 || v.Samples < 0 {
+		return fmt.Errorf("invalid ethoFS verifier settings: %+v", v)
+	}
+	if c.Verifier.ProofContract != "" {
+		if !common.IsHexAddress(c.Verifier.ProofContract) {
+			return fmt.Errorf("invalid ethoFS proof contract address %q", c.Verifier.ProofContract)
+		}
+		if !common.IsHexAddress(c.Verifier.Account) {
+			return fmt.Errorf("invalid ethoFS proof signing account %q", c.Verifier.Account)
+		}
+	}
+	if i := c.Integrity; i.Interval < 0 || i.Samples < 0 || i.Samples > maxIntegritySamples {
+		return fmt.Errorf("invalid ethoFS integrity proof settings: %+v", i)
+	}
+	if c.Integrity.ProofContract != "" {
+		if !common.IsHexAddress(c.Integrity.ProofContract) {
+			return fmt.Errorf("invalid ethoFS integrity proof contract address %q", c.Integrity.ProofContract)
+		}
+		if !common.IsHexAddress(c.Integrity.Account) {
+			return fmt.Errorf("invalid ethoFS integrity proof signing account %q", c.Integrity.Account)
+		}
+	}
+	if c.ReceiptContract != "" && !common.IsHexAddress(c.ReceiptContract) {
+		return fmt.Errorf("invalid ethoFS receipt contract address %q", c.ReceiptContract)
+	}
+	if c.ProviderRegistry != "" && !common.IsHexAddress(c.ProviderRegistry) {
+		return fmt.Errorf("invalid ethoFS provider registry address %q", c.ProviderRegistry)
+	}
+	if c.HealthAddr != "" {
+		if _, _, err := net.SplitHostPort(c.HealthAddr); err != nil {
+			return fmt.Errorf("invalid ethoFS health endpoint address %q: %v", c.HealthAddr, err)
+		}
+	}
+	if r := c.Redirector; r.ListenAddr != "" {
+		if _, _, err := net.SplitHostPort(r.ListenAddr); err != nil {
+			return fmt.Errorf("invalid ethoFS redirector address %q: %v", r.ListenAddr, err)
+		}
+		if len(r.Gateways) == 0 {
+			return errors.New("ethoFS redirector has no gateways")
+		}
+		for _, gw := range r.Gateways {
+			if _, _, err := parseRedirectGateway(gw); err != nil {
+				return fmt.Errorf("invalid ethoFS redirector gateway: %v", err)
+			}
+		}
+		if r.Window < 0 {
+			return fmt.Errorf("invalid ethoFS redirector window: %v", r.Window)
+		}
+	}
+	if c.Admin.ListenAddr != "" {
+		if _, _, err := net.SplitHostPort(c.Admin.ListenAddr); err != nil {
+			return fmt.Errorf("invalid ethoFS admin address %q: %v", c.Admin.ListenAddr, err)
+		}
+	}
+	if r := c.Resources; r.MaxConnections < 0 || r.ConnLowWater < 0 || r.ConnHighWater < 0 || r.ConnGracePeriod < 0 {
+		return fmt.Errorf("invalid ethoFS connection limits: %+v", r)
+	}
+	if r := c.Resources; r.ConnHighWater != 0 && r.ConnLowWater > r.ConnHighWater {
+		return fmt.Errorf("invalid ethoFS connection watermarks: low %d above high %d", r.ConnLowWater, r.ConnHighWater)
+	}
+	if _, err := newBandwidthLimiter(c.Resources.PeerBandwidth); err != nil {
+		return fmt.Errorf("invalid ethoFS peer bandwidth %q: %v", c.Resources.PeerBandwidth, err)
+	}
+	if _, err := newBandwidthLimiter(c.Resources.TransferBandwidth); err != nil {
+		return fmt.Errorf("invalid ethoFS transfer bandwidth %q: %v", c.Resources.TransferBandwidth, err)
+	}
+	if c.SLO.Target < 0 || c.SLO.Target > 1 || c.SLO.Latency < 0 {
+		return fmt.Errorf("invalid ethoFS SLO: %+v", c.SLO)
+	}
+	if c.IPNSCache.Size < 0 || c.IPNSCache.Fresh < 0 || c.IPNSCache.MaxStale < 0 {
+		return fmt.Errorf("invalid ethoFS IPNS cache settings: %+v", c.IPNSCache)
+	}
+	if c.KeySize < 0 {
+		return fmt.Errorf("invalid ethoFS key size: %d", c.KeySize)
+	}
+	return nil
+}
+
+// Enabled reports whether the embedded node should be started.
+func (c *Config) Enabled() bool {
+	return !c.Disabled && c.NodeType != ""
+}
+
+// gatewayEnabled reports whether the node serves the HTTP gateway.
+func (c *Config) gatewayEnabled() bool {
+	return c.NodeType == "gn" || c.Gateway.Enabled
+}
+
+// repoPath returns the configured repo location, falling back to the platform
+// default of defaultRepoPath.
+func (c *Config) repoPath() string {
+	if c.RepoPath != "" {
+		return filepath.Clean(c.RepoPath)
+	}
+	return defaultRepoPath(defaultDataDir)
+}
+
+// bootstrapNodes returns the static bootstrap peers, derived from the seed for
+// seeded devnet nodes. Test profile nodes never dial the production nodes.
+func (c *Config) bootstrapNodes() []string {
+	if c.Seed != "" {
+		nodes, err := seedBootstrap(c.Seed, c.SeedIndex)
+		if err != nil {
+			return nil
+		}
+		return nodes
+	}
+	if c.testing() {
+		return withoutDefaultBootstrap(c.BootstrapNodes)
+	}
+	return c.BootstrapNodes
+}
+
+// keySize returns the configured identity key size, falling back to the
+// default size if none was set.
+func (c *Config) keySize() int {
+	if c.KeySize == 0 {
+		return nBitsForKeypairDefault
+	}
+	return c.KeySize
+}
+
+// target returns the availability objective, falling back to the default.
+func (c *SLOConfig) target() float64 {
+	if c.Target == 0 {
+		return defaultSLOTarget
+	}
+	return c.Target
+}
+
+// latency returns the latency objective, falling back to the default.
+func (c *SLOConfig) latency() time.Duration {
+	if c.Latency == 0 {
+		return defaultSLOLatency
+	}
+	return c.Latency
+}
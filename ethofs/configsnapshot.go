@@ -0,0 +1,281 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs/core"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+const (
+	// configPreviousLink names the link of a snapshot to the one it replaced.
+	configPreviousLink = "previous"
+
+	// defaultConfigHistory is the number of snapshots returned by default.
+	defaultConfigHistory = 20
+
+	// maxConfigHistory caps the snapshots returned at once.
+	maxConfigHistory = 1000
+)
+
+// configHeadKey holds the CID of the latest config snapshot of the repo.
+var configHeadKey = datastore.NewKey("/ethofs/config/head")
+
+var (
+	errNotConfigSnapshot = errors.New("not an ethoFS config snapshot")
+	errUnknownSnapshot   = errors.New("snapshot not in the config history of the node")
+)
+
+// ConfigSnapshot is an effective config of the node, as stored in the repo.
+// Admin tokens and literal swarm keys are left out of the snapshots, as their
+// blocks are served to the swarm like any other.
+type ConfigSnapshot struct {
+	Cid      string    `json:"cid"`
+	Previous string    `json:"previous,omitempty"` // Snapshot replaced by this one
+	Time     time.Time `json:"time"`               // Start of the first run with the config
+	Config   Config    `json:"config"`
+}
+
+// configRecord is the data of a snapshot node.
+type configRecord struct {
+	Time   time.Time `json:"time"`
+	Config Config    `json:"config"`
+}
+
+// redactConfig returns a copy of the config without the secrets that are kept
+// out of the snapshots.
+func redactConfig(cfg Config) Config {
+	cfg.Admin.Tokens = nil
+	if source, err := parseSwarmKeySource(cfg.SwarmKey); err == nil {
+		if _, ok := source.(staticKeySource); ok {
+			cfg.SwarmKey = ""
+		}
+	}
+	return cfg
+}
+
+// restoreSecrets carries the secrets left out of a snapshot over from the
+// current config.
+func restoreSecrets(cfg *Config, current *Config) {
+	cfg.Admin.Tokens = current.Admin.Tokens
+	if cfg.SwarmKey == "" {
+		cfg.SwarmKey = current.SwarmKey
+	}
+}
+
+// decodeConfigSnapshot reads the snapshot stored in a node.
+func decodeConfigSnapshot(nd *merkledag.ProtoNode) (*ConfigSnapshot, error) {
+	var record configRecord
+	if err := json.Unmarshal(nd.Data(), &record); err != nil {
+		return nil, errNotConfigSnapshot
+	}
+	snapshot := &ConfigSnapshot{Cid: nd.Cid().String(), Time: record.Time, Config: record.Config}
+	if link, err := nd.GetNodeLink(configPreviousLink); err == nil {
+		snapshot.Previous = link.Cid.String()
+	}
+	return snapshot, nil
+}
+
+// loadConfigSnapshot retrieves the snapshot node of the CID from the repo.
+func loadConfigSnapshot(ctx context.Context, node *core.IpfsNode, c cid.Cid) (*merkledag.ProtoNode, *ConfigSnapshot, error) {
+	nd, err := node.DAG.Get(ctx, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	pn, ok := nd.(*merkledag.ProtoNode)
+	if !ok {
+		return nil, nil, errNotConfigSnapshot
+	}
+	snapshot, err := decodeConfigSnapshot(pn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pn, snapshot, nil
+}
+
+// configHead returns the CID of the latest snapshot, undefined if none has
+// been taken yet.
+func configHead(ds datastore.Datastore) (cid.Cid, error) {
+	data, err := ds.Get(configHeadKey)
+	if err == datastore.ErrNotFound {
+		return cid.Undef, nil
+	}
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cid.Cast(data)
+}
+
+// snapshotConfig stores the config as the new head of the history if it
+// differs from the latest snapshot. Snapshots are pinned directly, every one
+// of them linking to the one it replaced.
+func snapshotConfig(ctx context.Context, node *core.IpfsNode, cfg *Config) (cid.Cid, error) {
+	redacted := redactConfig(*cfg)
+	rendered, err := json.Marshal(redacted)
+	if err != nil {
+		return cid.Undef, err
+	}
+	head, err := configHead(node.Repo.Datastore())
+	if err != nil {
+		return cid.Undef, err
+	}
+	var previous *merkledag.ProtoNode
+	if head.Defined() {
+		nd, snapshot, err := loadConfigSnapshot(ctx, node, head)
+		if err != nil {
+			log.Warn("ethoFS - config history head unreadable, starting a new history", "cid", head, "error", err)
+		} else {
+			if last, err := json.Marshal(snapshot.Config); err == nil && string(last) == string(rendered) {
+				return head, nil
+			}
+			previous = nd
+		}
+	}
+	data, err := json.Marshal(configRecord{Time: time.Now().UTC(), Config: redacted})
+	if err != nil {
+		return cid.Undef, err
+	}
+	nd := merkledag.NodeWithData(data)
+	if previous != nil {
+		if err := nd.AddNodeLink(configPreviousLink, previous); err != nil {
+			return cid.Undef, err
+		}
+	}
+	if err := node.DAG.Add(ctx, nd); err != nil {
+		return cid.Undef, err
+	}
+	node.Pinning.PinWithMode(nd.Cid(), pin.Direct)
+	if err := node.Pinning.Flush(ctx); err != nil {
+		return cid.Undef, err
+	}
+	notifyPinAdded(nd.Cid())
+	ownPin(nd.Cid(), pinOwnerConfig)
+	if err := node.Repo.Datastore().Put(configHeadKey, nd.Cid().Bytes()); err != nil {
+		return cid.Undef, err
+	}
+	log.Info("ethoFS - config snapshot stored", "cid", nd.Cid(), "previous", head)
+	return nd.Cid(), nil
+}
+
+// configHistory walks the snapshots back from the head, newest first.
+func configHistory(ctx context.Context, node *core.IpfsNode, limit int) ([]ConfigSnapshot, error) {
+	if limit <= 0 {
+		limit = defaultConfigHistory
+	}
+	if limit > maxConfigHistory {
+		limit = maxConfigHistory
+	}
+	c, err := configHead(node.Repo.Datastore())
+	if err != nil {
+		return nil, err
+	}
+	history := make([]ConfigSnapshot, 0)
+	for c.Defined() && len(history) < limit {
+		_, snapshot, err := loadConfigSnapshot(ctx, node, c)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, *snapshot)
+
+		c = cid.Undef
+		if snapshot.Previous != "" {
+			if c, err = cid.Decode(snapshot.Previous); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return history, nil
+}
+
+// inConfigHistory reports whether the snapshot is part of the local history,
+// walking back at most maxConfigHistory snapshots from the head.
+func inConfigHistory(ctx context.Context, node *core.IpfsNode, c cid.Cid) (bool, error) {
+	history, err := configHistory(ctx, node, maxConfigHistory)
+	if err != nil {
+		return false, err
+	}
+	for _, snapshot := range history {
+		if snapshot.Cid == c.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ConfigHistory returns the latest snapshots of the effective config of the
+// node, newest first.
+func (s *EthofsService) ConfigHistory(ctx context.Context, limit int) ([]ConfigSnapshot, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	return configHistory(ctx, node, limit)
+}
+
+// ConfigRollback restarts the node with the config of a snapshot, keeping the
+// current secrets. Only snapshots of the local history are accepted, never
+// configs retrieved from the swarm. The rollback lasts until geth exits, the
+// config file and flags are left untouched. The restored config becomes the
+// new head of the history.
+func (s *EthofsService) ConfigRollback(ctx context.Context, c cid.Cid) error {
+	node := s.Node()
+	if node == nil {
+		return errNodeNotRunning
+	}
+	known, err := inConfigHistory(ctx, node, c)
+	if err != nil {
+		return err
+	}
+	if !known {
+		return errUnknownSnapshot
+	}
+	_, snapshot, err := loadConfigSnapshot(ctx, node, c)
+	if err != nil {
+		return err
+	}
+	cfg := snapshot.Config
+	restoreSecrets(&cfg, &s.config)
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := s.Stop(); err != nil {
+		log.Warn("ethoFS - error stopping node for config rollback", "error", err)
+	}
+	s.lock.Lock()
+	s.config = cfg
+	s.lock.Unlock()
+
+	log.Info("ethoFS - config rolled back, restarting node", "snapshot", c)
+	return s.Start()
+}
+
+// ConfigHistory returns the latest config snapshots of the node, newest
+// first.
+func (api *PublicEthofsAPI) ConfigHistory(ctx context.Context, limit *int) (_ []ConfigSnapshot, err error) {
+	defer trackCall("configHistory", time.Now(), &err)
+
+	n := 0
+	if limit != nil {
+		n = *limit
+	}
+	return api.service.ConfigHistory(ctx, n)
+}
+
+// ConfigRollback restarts the node with the config of the given snapshot.
+func (api *PrivateEthofsAPI) ConfigRollback(ctx context.Context, hash string) (err error) {
+	defer trackCall("configRollback", time.Now(), &err)
+
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return err
+	}
+	return api.service.ConfigRollback(ctx, c)
+}
@@ -0,0 +1,89 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func TestConfigSnapshotSecrets(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.Admin.Tokens = []string{"secret"}
+	cfg.SwarmKey = hex.EncodeToString(make([]byte, 32))
+
+	redacted := redactConfig(cfg)
+	if len(redacted.Admin.Tokens) != 0 || redacted.SwarmKey != "" {
+		t.Fatalf("secrets left in snapshot: tokens %v, swarm key %q", redacted.Admin.Tokens, redacted.SwarmKey)
+	}
+	if len(cfg.Admin.Tokens) != 1 {
+		t.Fatalf("redaction modified the source config")
+	}
+	restoreSecrets(&redacted, &cfg)
+	if len(redacted.Admin.Tokens) != 1 || redacted.SwarmKey != cfg.SwarmKey {
+		t.Errorf("secrets not restored: tokens %v, swarm key %q", redacted.Admin.Tokens, redacted.SwarmKey)
+	}
+	// Key sources are no secrets and stay in the snapshot
+	cfg.SwarmKey = "file:/etc/ethofs/swarm.key"
+	if redacted := redactConfig(cfg); redacted.SwarmKey != cfg.SwarmKey {
+		t.Errorf("swarm key source dropped: have %q, want %q", redacted.SwarmKey, cfg.SwarmKey)
+	}
+}
+
+func TestConfigSnapshotDecode(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.NodeType = "mn"
+
+	data, err := json.Marshal(configRecord{Time: time.Unix(1600000000, 0).UTC(), Config: cfg})
+	if err != nil {
+		t.Fatalf("failed to encode snapshot: %v", err)
+	}
+	first := merkledag.NodeWithData(data)
+	second := merkledag.NodeWithData(data)
+	if err := second.AddNodeLink(configPreviousLink, first); err != nil {
+		t.Fatalf("failed to link snapshots: %v", err)
+	}
+	snapshot, err := decodeConfigSnapshot(second)
+	if err != nil {
+		t.Fatalf("failed to decode snapshot: %v", err)
+	}
+	if snapshot.Previous != first.Cid().String() {
+		t.Errorf("previous snapshot mismatch: have %s, want %s", snapshot.Previous, first.Cid())
+	}
+	if snapshot.Config.NodeType != "mn" {
+		t.Errorf("node type mismatch: have %q, want %q", snapshot.Config.NodeType, "mn")
+	}
+	// Unchanged configs have to render identically after a round trip
+	rendered, _ := json.Marshal(cfg)
+	if again, _ := json.Marshal(snapshot.Config); string(again) != string(rendered) {
+		t.Errorf("config rendering unstable:\nhave %s\nwant %s", again, rendered)
+	}
+	if _, err := decodeConfigSnapshot(merkledag.NodeWithData([]byte("junk"))); err != errNotConfigSnapshot {
+		t.Errorf("junk decode error mismatch: have %v, want %v", err, errNotConfigSnapshot)
+	}
+}
+
+func TestConfigRollbackUnknown(t *testing.T) {
+	s, stop := newTestService(t)
+	defer stop()
+
+	ctx := context.Background()
+	if _, err := snapshotConfig(ctx, s.Node(), &s.config); err != nil {
+		t.Fatalf("failed to snapshot config: %v", err)
+	}
+	// Snapshots outside the local history are refused, even if well formed
+	data, err := json.Marshal(configRecord{Time: time.Now().UTC(), Config: DefaultConfig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign := merkledag.NodeWithData(data)
+	if err := s.Node().DAG.Add(ctx, foreign); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ConfigRollback(ctx, foreign.Cid()); err != errUnknownSnapshot {
+		t.Errorf("foreign snapshot rollback: have %v, want %v", err, errUnknownSnapshot)
+	}
+}
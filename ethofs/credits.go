@@ -0,0 +1,322 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	bitswap "github.com/ipfs/go-bitswap"
+	datastore "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	// creditInterval is how often the bitswap ledgers of the connected peers
+	// are accounted.
+	creditInterval = 30 * time.Second
+
+	// defaultCreditDebtLimit is the net debt above which the default policy
+	// deprioritizes a peer.
+	defaultCreditDebtLimit = 1 << 30
+
+	// creditTag is the connection manager tag carrying the priority of a peer.
+	creditTag = "ethofs-credit"
+
+	// creditPenalty is the connection manager weight the default policy gives
+	// peers above the debt limit, making them the first connections trimmed.
+	creditPenalty = -100
+)
+
+var errNoCreditLedger = errors.New("ethoFS bandwidth credits disabled")
+
+// creditPrefix is the datastore namespace of the peer balances, stored in the
+// repo to survive restarts and reconnects.
+var creditPrefix = datastore.NewKey("/ethofs/credits")
+
+// PeerCredit is the bandwidth balance of a peer: the block bytes it sent to
+// the node and the ones the node served it. A negative balance is the debt of
+// the peer.
+type PeerCredit struct {
+	Peer      string `json:"peer"`
+	Sent      uint64 `json:"sent"`      // Bytes the node sent to the peer
+	Received  uint64 `json:"received"`  // Bytes the node received from the peer
+	Balance   int64  `json:"balance"`   // Received minus sent
+	Priority  int    `json:"priority"`  // Connection manager weight of the credit policy
+	FirstSeen uint64 `json:"firstSeen"` // Unix time the peer was first accounted
+	LastSeen  uint64 `json:"lastSeen"`  // Unix time of the last exchange with the peer
+}
+
+// CreditPolicy returns the priority of a peer from its balance, applied as
+// the weight of the peer in the connection manager: peers with low weights
+// are the first ones trimmed when the node has too many connections. Zero
+// leaves the peer as is.
+type CreditPolicy func(credit *PeerCredit) int
+
+var (
+	creditPolicyLock sync.RWMutex
+	creditPolicy     CreditPolicy
+)
+
+// SetCreditPolicy replaces the default policy prioritizing the peers by their
+// bandwidth balance, e.g. with a tit-for-tat strategy. A nil policy restores
+// the default, which deprioritizes the peers above the configured debt limit.
+func SetCreditPolicy(policy CreditPolicy) {
+	creditPolicyLock.Lock()
+	defer creditPolicyLock.Unlock()
+
+	creditPolicy = policy
+}
+
+// debtLimitPolicy deprioritizes the peers owing more than the limit.
+func debtLimitPolicy(limit uint64) CreditPolicy {
+	return func(credit *PeerCredit) int {
+		if credit.Balance < 0 && uint64(-credit.Balance) > limit {
+			return creditPenalty
+		}
+		return 0
+	}
+}
+
+// ledgerSample is the last seen bitswap ledger of a peer, which counts the
+// bytes since bitswap first met the peer.
+type ledgerSample struct {
+	sent, recv uint64
+}
+
+// creditLedger accumulates the bitswap ledgers of the peers into persistent
+// balances.
+type creditLedger struct {
+	ds     datastore.Datastore
+	policy CreditPolicy // fallback if no custom policy is set
+
+	lock    sync.Mutex
+	credits map[peer.ID]*PeerCredit
+	samples map[peer.ID]ledgerSample
+	tagged  map[peer.ID]int
+}
+
+// loadCreditLedger reads the balances of the peers from the datastore.
+func loadCreditLedger(ds datastore.Datastore, cfg *CreditConfig) (*creditLedger, error) {
+	results, err := ds.Query(query.Query{Prefix: creditPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, err
+	}
+	limit := cfg.DebtLimit
+	if limit == 0 {
+		limit = defaultCreditDebtLimit
+	}
+	l := &creditLedger{
+		ds:      ds,
+		policy:  debtLimitPolicy(limit),
+		credits: make(map[peer.ID]*PeerCredit, len(entries)),
+		samples: make(map[peer.ID]ledgerSample),
+		tagged:  make(map[peer.ID]int),
+	}
+	for _, entry := range entries {
+		credit := new(PeerCredit)
+		if err := json.Unmarshal(entry.Value, credit); err != nil {
+			log.Warn("ethoFS - dropping corrupt peer credit", "key", entry.Key, "error", err)
+			continue
+		}
+		id, err := peer.Decode(credit.Peer)
+		if err != nil {
+			log.Warn("ethoFS - dropping corrupt peer credit", "key", entry.Key, "error", err)
+			continue
+		}
+		l.credits[id] = credit
+	}
+	return l, nil
+}
+
+func creditKey(id peer.ID) datastore.Key {
+	return creditPrefix.ChildString(peer.Encode(id))
+}
+
+// account adds the traffic since the last sample of the peer's ledger,
+// returning the updated balance or nil if nothing changed. Ledgers counting
+// less than the last sample were reset by bitswap and count from zero.
+func (l *creditLedger) account(id peer.ID, sent, recv uint64, now time.Time) (*PeerCredit, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	last, ok := l.samples[id]
+	l.samples[id] = ledgerSample{sent: sent, recv: recv}
+	if ok && sent >= last.sent && recv >= last.recv {
+		sent, recv = sent-last.sent, recv-last.recv
+	}
+	if sent == 0 && recv == 0 {
+		return nil, nil
+	}
+	credit := l.credits[id]
+	if credit == nil {
+		credit = &PeerCredit{Peer: peer.Encode(id), FirstSeen: uint64(now.Unix())}
+		l.credits[id] = credit
+	}
+	credit.Sent += sent
+	credit.Received += recv
+	credit.Balance = int64(credit.Received) - int64(credit.Sent)
+	credit.LastSeen = uint64(now.Unix())
+
+	data, err := json.Marshal(credit)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.ds.Put(creditKey(id), data); err != nil {
+		return nil, err
+	}
+	cpy := *credit
+	return &cpy, nil
+}
+
+// prioritize applies the credit policy to the balance, returning the priority
+// of the peer and whether it changed.
+func (l *creditLedger) prioritize(id peer.ID, credit *PeerCredit) (int, bool) {
+	creditPolicyLock.RLock()
+	policy := creditPolicy
+	creditPolicyLock.RUnlock()
+
+	if policy == nil {
+		policy = l.policy
+	}
+	priority := policy(credit)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if stored := l.credits[id]; stored != nil {
+		stored.Priority = priority
+	}
+	if l.tagged[id] == priority {
+		return priority, false
+	}
+	if priority == 0 {
+		delete(l.tagged, id)
+	} else {
+		l.tagged[id] = priority
+	}
+	return priority, true
+}
+
+// get returns the balance of the peer, or nil if it never exchanged blocks.
+func (l *creditLedger) get(id peer.ID) *PeerCredit {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	credit, ok := l.credits[id]
+	if !ok {
+		return nil
+	}
+	cpy := *credit
+	return &cpy
+}
+
+// list returns the balances of all peers, the largest debts first.
+func (l *creditLedger) list() []PeerCredit {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	credits := make([]PeerCredit, 0, len(l.credits))
+	for _, credit := range l.credits {
+		credits = append(credits, *credit)
+	}
+	sort.Slice(credits, func(i, j int) bool {
+		if credits[i].Balance != credits[j].Balance {
+			return credits[i].Balance < credits[j].Balance
+		}
+		return credits[i].Peer < credits[j].Peer
+	})
+	return credits
+}
+
+// loop accounts the bitswap ledgers of the connected peers every interval
+// until the context is cancelled.
+func (l *creditLedger) loop(ctx context.Context, node *core.IpfsNode) {
+	bs, ok := node.Exchange.(*bitswap.Bitswap)
+	if !ok {
+		log.Debug("ethoFS - bandwidth credits need bitswap, not accounting")
+		return
+	}
+	ticker := time.NewTicker(creditInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			for _, id := range node.PeerHost.Network().Peers() {
+				receipt := bs.LedgerForPeer(id)
+				if receipt == nil {
+					continue
+				}
+				credit, err := l.account(id, receipt.Sent, receipt.Recv, now)
+				if err != nil {
+					log.Debug("ethoFS - unable to account peer credit", "peer", id, "error", err)
+					continue
+				}
+				if credit == nil {
+					continue
+				}
+				if priority, changed := l.prioritize(id, credit); changed {
+					if priority == 0 {
+						node.PeerHost.ConnManager().UntagPeer(id, creditTag)
+					} else {
+						node.PeerHost.ConnManager().TagPeer(id, creditTag, priority)
+					}
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// creditLedger returns the bandwidth balances of the running node, or nil if
+// it is stopped or the accounting is disabled.
+func (s *EthofsService) creditLedger() *creditLedger {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.credits
+}
+
+// Credits returns the bandwidth balances of the peers, the largest debts
+// first.
+func (api *PublicEthofsAPI) Credits() (_ []PeerCredit, err error) {
+	defer trackCall("credits", time.Now(), &err)
+
+	credits := api.service.creditLedger()
+	if credits == nil {
+		return nil, errNoCreditLedger
+	}
+	return credits.list(), nil
+}
+
+// Credit returns the bandwidth balance of the peer.
+func (api *PublicEthofsAPI) Credit(id string) (_ *PeerCredit, err error) {
+	defer trackCall("credit", time.Now(), &err)
+
+	credits := api.service.creditLedger()
+	if credits == nil {
+		return nil, errNoCreditLedger
+	}
+	p, err := peer.Decode(id)
+	if err != nil {
+		return nil, err
+	}
+	credit := credits.get(p)
+	if credit == nil {
+		return &PeerCredit{Peer: peer.Encode(p)}, nil
+	}
+	return credit, nil
+}
@@ -0,0 +1,65 @@
+package ethofs
+
+import (
+	"testing"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestCreditAccounting(t *testing.T) {
+	ds := datastore.NewMapDatastore()
+	ledger, err := loadCreditLedger(ds, &CreditConfig{DebtLimit: 100})
+	if err != nil {
+		t.Fatalf("failed to load ledger: %v", err)
+	}
+	now := time.Unix(1600000000, 0)
+
+	leecher, _ := peer.Decode("QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN")
+	seeder, _ := peer.Decode("QmQCU2EcMqAqQPR2i9bChDtGNJchTbq5TbXJJ16u19uLTa")
+	// The first sample counts fully, later ones only their growth
+	ledger.account(leecher, 80, 10, now)
+	credit, _ := ledger.account(leecher, 200, 10, now)
+	if credit == nil || credit.Sent != 200 || credit.Received != 10 || credit.Balance != -190 {
+		t.Fatalf("leecher balance mismatch: have %+v", credit)
+	}
+	if unchanged, _ := ledger.account(leecher, 200, 10, now); unchanged != nil {
+		t.Errorf("unchanged ledger accounted: %+v", unchanged)
+	}
+	// A ledger reset by bitswap counts from zero
+	if credit, _ = ledger.account(leecher, 5, 0, now); credit.Sent != 205 {
+		t.Errorf("reset ledger sent mismatch: have %d, want 205", credit.Sent)
+	}
+	ledger.account(seeder, 0, 500, now)
+
+	credits := ledger.list()
+	if len(credits) != 2 || credits[0].Peer != peer.Encode(leecher) || credits[1].Balance != 500 {
+		t.Fatalf("listed credits mismatch: have %+v", credits)
+	}
+	// The default policy deprioritizes the peers above the debt limit
+	if priority, changed := ledger.prioritize(leecher, ledger.get(leecher)); priority != creditPenalty || !changed {
+		t.Errorf("leecher priority mismatch: have %d (changed %v), want %d", priority, changed, creditPenalty)
+	}
+	if _, changed := ledger.prioritize(leecher, ledger.get(leecher)); changed {
+		t.Errorf("unchanged priority reported as changed")
+	}
+	if priority, changed := ledger.prioritize(seeder, ledger.get(seeder)); priority != 0 || changed {
+		t.Errorf("seeder priority mismatch: have %d (changed %v), want 0", priority, changed)
+	}
+	// Custom policies replace the default
+	SetCreditPolicy(func(credit *PeerCredit) int { return int(credit.Balance / 100) })
+	defer SetCreditPolicy(nil)
+
+	if priority, _ := ledger.prioritize(seeder, ledger.get(seeder)); priority != 5 {
+		t.Errorf("custom policy priority mismatch: have %d, want 5", priority)
+	}
+	// Balances survive restarts
+	reloaded, err := loadCreditLedger(ds, &CreditConfig{})
+	if err != nil {
+		t.Fatalf("failed to reload ledger: %v", err)
+	}
+	if credit := reloaded.get(leecher); credit == nil || credit.Sent != 205 {
+		t.Errorf("reloaded balance mismatch: have %+v", credit)
+	}
+}
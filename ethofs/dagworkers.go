@@ -0,0 +1,168 @@
+package ethofs
+
+import (
+	"context"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/corerepo"
+	"github.com/ipfs/go-ipfs/gc"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// dagBudget bounds the blocks read at once by the DAG walks of the
+// maintenance tasks (pinning, garbage collection, pin sizes and exports),
+// shared by all of them. The walks of go-ipfs start up to 32 readers each,
+// which on shared machines compete with the chain import for the CPU.
+type dagBudget struct {
+	slots chan struct{}
+	local blockstore.Blockstore // Blockstore of the node, blocks missing in it are fetched without a slot
+}
+
+var (
+	dagWorkersLock sync.RWMutex
+	dagWorkers     *dagBudget // Budget of the running node, nil if unlimited
+)
+
+// currentDAGWorkers returns the budget of the running node, or nil if the
+// walks are unlimited.
+func currentDAGWorkers() *dagBudget {
+	dagWorkersLock.RLock()
+	defer dagWorkersLock.RUnlock()
+
+	return dagWorkers
+}
+
+// setDAGWorkers replaces the budget of the running node.
+func setDAGWorkers(budget *dagBudget) {
+	dagWorkersLock.Lock()
+	defer dagWorkersLock.Unlock()
+
+	dagWorkers = budget
+}
+
+// newDAGBudget creates a budget of n concurrent block reads from the local
+// blockstore, or returns nil if n is not positive.
+func newDAGBudget(n int, local blockstore.Blockstore) *dagBudget {
+	if n <= 0 {
+		return nil
+	}
+	return &dagBudget{slots: make(chan struct{}, n), local: local}
+}
+
+// workers returns the size of the budget, or def if it is unlimited.
+func (b *dagBudget) workers(def int) int {
+	if b == nil {
+		return def
+	}
+	return cap(b.slots)
+}
+
+// getter bounds the reads of the node getter by the budget.
+func (b *dagBudget) getter(ng ipld.NodeGetter) ipld.NodeGetter {
+	if b == nil {
+		return ng
+	}
+	return &budgetGetter{NodeGetter: ng, budget: b}
+}
+
+// blockstore bounds the block reads of the blockstore by the budget, giving
+// up waiting for a slot once the context is cancelled.
+func (b *dagBudget) blockstore(ctx context.Context, bs blockstore.GCBlockstore) blockstore.GCBlockstore {
+	if b == nil {
+		return bs
+	}
+	return &budgetBlockstore{GCBlockstore: bs, ctx: ctx, budget: b}
+}
+
+// budgetGetter is a node getter taking a slot of the budget for every read.
+// Blocks missing locally are retrieved from the swarm without a slot, so the
+// waits for the network don't stall the local reads of the other walks.
+type budgetGetter struct {
+	ipld.NodeGetter
+	budget *dagBudget
+}
+
+func (g *budgetGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	if g.budget.local != nil {
+		if has, err := g.budget.local.Has(c); err == nil && !has {
+			return g.NodeGetter.Get(ctx, c)
+		}
+	}
+	select {
+	case g.budget.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-g.budget.slots }()
+
+	return g.NodeGetter.Get(ctx, c)
+}
+
+func (g *budgetGetter) GetMany(ctx context.Context, keys []cid.Cid) <-chan *ipld.NodeOption {
+	out := make(chan *ipld.NodeOption, len(keys))
+	go func() {
+		defer close(out)
+		for _, c := range keys {
+			nd, err := g.Get(ctx, c)
+			out <- &ipld.NodeOption{Node: nd, Err: err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// budgetBlockstore is a blockstore taking a slot of the budget for every read.
+type budgetBlockstore struct {
+	blockstore.GCBlockstore
+	ctx    context.Context
+	budget *dagBudget
+}
+
+func (bs *budgetBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	select {
+	case bs.budget.slots <- struct{}{}:
+	case <-bs.ctx.Done():
+		return nil, bs.ctx.Err()
+	}
+	defer func() { <-bs.budget.slots }()
+
+	return bs.GCBlockstore.Get(c)
+}
+
+// garbageCollect removes the unpinned blocks from the repo like
+// corerepo.GarbageCollect, walking the pins within the budget.
+func garbageCollect(ctx context.Context, node *core.IpfsNode, budget *dagBudget) error {
+	roots, err := corerepo.BestEffortRoots(node.FilesRoot)
+	if err != nil {
+		return err
+	}
+	removed := gc.GC(ctx, budget.blockstore(ctx, node.Blockstore), node.Repo.Datastore(), node.Pinning, roots)
+	return corerepo.CollectResult(ctx, removed, nil)
+}
+
+// pinRecursive recursively pins the content of the CID. Within a budget the
+// DAG is fetched by its workers first, leaving only local reads to the walk of
+// the pinner.
+func pinRecursive(ctx context.Context, api icore.CoreAPI, c cid.Cid) error {
+	if budget := currentDAGWorkers(); budget != nil {
+		opts := FetchOptions{Concurrency: budget.workers(0)}.withDefaults(&ethofsConfig.Fetch)
+		if _, err := fetchDAG(ctx, budget.getter(merkledag.NewSession(ctx, api.Dag())), c, opts); err != nil {
+			return err
+		}
+	}
+	if err := api.Pin().Add(ctx, path.IpfsPath(c), options.Pin.Recursive(true)); err != nil {
+		return err
+	}
+	notifyPinAdded(c)
+	return nil
+}
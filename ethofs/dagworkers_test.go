@@ -0,0 +1,128 @@
+package ethofs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+// countingGetter tracks the peak of its concurrent reads.
+type countingGetter struct {
+	ipld.NodeGetter
+	active, peak int32
+}
+
+func (g *countingGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	active := atomic.AddInt32(&g.active, 1)
+	defer atomic.AddInt32(&g.active, -1)
+
+	for peak := atomic.LoadInt32(&g.peak); active > peak; peak = atomic.LoadInt32(&g.peak) {
+		if atomic.CompareAndSwapInt32(&g.peak, peak, active) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return g.NodeGetter.Get(ctx, c)
+}
+
+func TestDAGBudget(t *testing.T) {
+	if newDAGBudget(0, nil) != nil {
+		t.Fatal("budget created for unbounded walks")
+	}
+	var nilBudget *dagBudget
+	if nilBudget.workers(32) != 32 {
+		t.Error("unbounded budget does not report the default")
+	}
+	ctx := context.Background()
+	dag := mdtest.Mock()
+
+	root := merkledag.NodeWithData(nil)
+	for i := 0; i < 32; i++ {
+		leaf := merkledag.NodeWithData([]byte{byte(i)})
+		if err := dag.Add(ctx, leaf); err != nil {
+			t.Fatal(err)
+		}
+		root.AddNodeLink("", leaf)
+	}
+	if err := dag.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	// Two walks of 32 readers each share the budget of three
+	var (
+		budget  = newDAGBudget(3, nil)
+		counter = &countingGetter{NodeGetter: dag}
+		getter  = budget.getter(counter)
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := merkledag.Walk(ctx, merkledag.GetLinksWithDAG(getter), root.Cid(), cid.NewSet().Visit, merkledag.Concurrent()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if counter.peak > 3 {
+		t.Errorf("budget exceeded: %d concurrent reads", counter.peak)
+	}
+	if budget.workers(32) != 3 {
+		t.Errorf("budget size mismatch: have %d, want 3", budget.workers(32))
+	}
+}
+
+func TestDAGBudgetRemoteReads(t *testing.T) {
+	ctx := context.Background()
+	dag := mdtest.Mock()
+
+	local := blockstore.NewBlockstore(dsync.MutexWrap(datastore.NewMapDatastore()))
+	remote := merkledag.NewRawNode([]byte("remote"))
+	if err := dag.Add(ctx, remote); err != nil {
+		t.Fatal(err)
+	}
+	// A read waiting for the swarm doesn't hold the only slot
+	budget := newDAGBudget(1, local)
+	stalled, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go budget.getter(&stallingGetter{NodeGetter: dag, stalled: remote.Cid()}).Get(stalled, remote.Cid())
+	time.Sleep(10 * time.Millisecond)
+
+	cached := merkledag.NewRawNode([]byte("cached"))
+	if err := local.Put(cached); err != nil {
+		t.Fatal(err)
+	}
+	if err := dag.Add(ctx, cached); err != nil {
+		t.Fatal(err)
+	}
+	readCtx, readCancel := context.WithTimeout(ctx, time.Second)
+	defer readCancel()
+	if _, err := budget.getter(dag).Get(readCtx, cached.Cid()); err != nil {
+		t.Errorf("local read blocked by remote fetch: %v", err)
+	}
+}
+
+func TestDAGBudgetBlockstoreCancel(t *testing.T) {
+	budget := newDAGBudget(1, nil)
+	budget.slots <- struct{}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bs := budget.blockstore(ctx, blockstore.NewGCBlockstore(blockstore.NewBlockstore(datastore.NewMapDatastore()), blockstore.NewGCLocker()))
+	cancel()
+
+	if _, err := bs.Get(blocks.NewBlock([]byte("block")).Cid()); err != context.Canceled {
+		t.Errorf("read of exhausted budget: have %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,188 @@
+package ethofs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	config "github.com/ipfs/go-ipfs-config"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+// blocksMountpoint is the mount of the repo datastore holding the blocks.
+const blocksMountpoint = "/blocks"
+
+var errNoDatastoreFactory = errors.New("nil datastore factory")
+
+// DatastoreFactory opens an external storage engine used as the blockstore of
+// the node. repoPath is the root of the ethoFS repo, for engines keeping local
+// state, and params are the engine settings of the Blockstore config.
+type DatastoreFactory func(repoPath string, params map[string]string) (repo.Datastore, error)
+
+var (
+	datastoresLock sync.RWMutex
+	datastores     = make(map[string]DatastoreFactory)
+)
+
+// RegisterDatastore makes a storage engine available as the blockstore of the
+// node under the given type name, selected by the Blockstore.Type config
+// setting (e.g. a Postgres, Ceph or S3 backed datastore). It has to be called
+// before the node is started, typically from an init function of the package
+// implementing the engine. Registering a name twice, or one of the built-in
+// IPFS datastore types, fails.
+func RegisterDatastore(name string, factory DatastoreFactory) error {
+	if name == "" {
+		return errors.New("empty datastore type name")
+	}
+	if factory == nil {
+		return errNoDatastoreFactory
+	}
+	datastoresLock.Lock()
+	defer datastoresLock.Unlock()
+
+	if _, ok := datastores[name]; ok {
+		return fmt.Errorf("datastore type %q already registered", name)
+	}
+	err := fsrepo.AddDatastoreConfigHandler(name, func(spec map[string]interface{}) (fsrepo.DatastoreConfig, error) {
+		return newExternalDatastoreConfig(name, factory, spec)
+	})
+	if err != nil {
+		return err
+	}
+	datastores[name] = factory
+	return nil
+}
+
+// RegisteredDatastores returns the sorted type names of the registered
+// storage engines.
+func RegisteredDatastores() []string {
+	datastoresLock.RLock()
+	defer datastoresLock.RUnlock()
+
+	names := make([]string, 0, len(datastores))
+	for name := range datastores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func datastoreRegistered(name string) bool {
+	datastoresLock.RLock()
+	defer datastoresLock.RUnlock()
+
+	_, ok := datastores[name]
+	return ok
+}
+
+// externalDatastoreConfig is the fsrepo datastore config of a registered
+// storage engine.
+type externalDatastoreConfig struct {
+	name    string
+	factory DatastoreFactory
+	params  map[string]string
+}
+
+func newExternalDatastoreConfig(name string, factory DatastoreFactory, spec map[string]interface{}) (*externalDatastoreConfig, error) {
+	params := make(map[string]string)
+	for key, value := range spec {
+		if key == "type" {
+			continue
+		}
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("datastore %s: parameter %q is not a string", name, key)
+		}
+		params[key] = s
+	}
+	return &externalDatastoreConfig{name: name, factory: factory, params: params}, nil
+}
+
+// DiskSpec identifies the engine and its settings, so fsrepo refuses to open
+// a repo with a different blockstore than it was created with.
+func (c *externalDatastoreConfig) DiskSpec() fsrepo.DiskSpec {
+	spec := fsrepo.DiskSpec{"type": c.name}
+	for key, value := range c.params {
+		spec[key] = value
+	}
+	return spec
+}
+
+func (c *externalDatastoreConfig) Create(repoPath string) (repo.Datastore, error) {
+	return c.factory(repoPath, c.params)
+}
+
+// blockstoreSpec returns the datastore mount of a registered engine used as
+// the blockstore.
+func blockstoreSpec(cfg *BlockstoreConfig) map[string]interface{} {
+	child := map[string]interface{}{"type": cfg.Type}
+	for key, value := range cfg.Params {
+		child[key] = value
+	}
+	return map[string]interface{}{
+		"mountpoint": blocksMountpoint,
+		"type":       "measure",
+		"prefix":     cfg.Type + ".datastore",
+		"child":      child,
+	}
+}
+
+// applyBlockstoreSpec replaces the blocks mount of the datastore spec of a
+// repo config about to be initialized with the configured external engine.
+// The rest of the repo, e.g. the keystore and the pin set, stays in the
+// default datastore.
+func applyBlockstoreSpec(conf *config.Config, cfg *BlockstoreConfig) error {
+	if cfg.Type == "" {
+		return nil
+	}
+	if !datastoreRegistered(cfg.Type) {
+		return fmt.Errorf("unknown ethoFS blockstore type %q", cfg.Type)
+	}
+	spec := conf.Datastore.Spec
+	if spec["type"] != "mount" {
+		return fmt.Errorf("unsupported datastore spec of type %v, mount expected", spec["type"])
+	}
+	mounts, _ := spec["mounts"].([]interface{})
+	for i, mount := range mounts {
+		if m, ok := mount.(map[string]interface{}); ok && m["mountpoint"] == blocksMountpoint {
+			mounts[i] = blockstoreSpec(cfg)
+			return nil
+		}
+	}
+	spec["mounts"] = append(mounts, blockstoreSpec(cfg))
+	return nil
+}
+
+// blockstoreType returns the datastore type of the blocks mount of a repo
+// datastore spec, or an empty string if there is none.
+func blockstoreType(spec map[string]interface{}) string {
+	mounts, _ := spec["mounts"].([]interface{})
+	for _, mount := range mounts {
+		m, ok := mount.(map[string]interface{})
+		if !ok || m["mountpoint"] != blocksMountpoint {
+			continue
+		}
+		if m["type"] == "measure" {
+			m, _ = m["child"].(map[string]interface{})
+		}
+		typ, _ := m["type"].(string)
+		return typ
+	}
+	return ""
+}
+
+// checkBlockstoreType warns if an existing repo keeps its blocks in another
+// datastore than configured, the blockstore only being chosen on repo
+// initialization.
+func checkBlockstoreType(conf *config.Config, cfg *BlockstoreConfig) {
+	if cfg.Type == "" {
+		return
+	}
+	if typ := blockstoreType(conf.Datastore.Spec); typ != cfg.Type {
+		log.Warn("ethoFS - repo blockstore differs from the configured one, reinitialize the repo to switch", "repo", typ, "configured", cfg.Type)
+	}
+}
@@ -0,0 +1,57 @@
+package ethofs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	config "github.com/ipfs/go-ipfs-config"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+func TestRegisterDatastore(t *testing.T) {
+	var opened map[string]string
+	factory := func(repoPath string, params map[string]string) (repo.Datastore, error) {
+		opened = params
+		return dssync.MutexWrap(datastore.NewMapDatastore()), nil
+	}
+	if err := RegisterDatastore("ethofs-test", factory); err != nil {
+		t.Fatalf("failed to register datastore: %v", err)
+	}
+	if err := RegisterDatastore("ethofs-test", factory); err == nil {
+		t.Fatal("registered datastore twice")
+	}
+	if err := RegisterDatastore("mem", factory); err == nil {
+		t.Fatal("registered built-in datastore type")
+	}
+	conf := &config.Config{Datastore: config.DefaultDatastoreConfig()}
+	cfg := &BlockstoreConfig{Type: "ethofs-test", Params: map[string]string{"dsn": "postgres://localhost/ethofs"}}
+	if err := applyBlockstoreSpec(conf, cfg); err != nil {
+		t.Fatalf("failed to apply blockstore spec: %v", err)
+	}
+	if typ := blockstoreType(conf.Datastore.Spec); typ != "ethofs-test" {
+		t.Fatalf("blockstore type mismatch: have %q, want %q", typ, "ethofs-test")
+	}
+	dsc, err := fsrepo.AnyDatastoreConfig(blockstoreSpec(cfg))
+	if err != nil {
+		t.Fatalf("failed to parse datastore spec: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "ethofs-datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := dsc.Create(dir); err != nil {
+		t.Fatalf("failed to create datastore: %v", err)
+	}
+	if opened["dsn"] != "postgres://localhost/ethofs" {
+		t.Fatalf("factory params mismatch: have %v", opened)
+	}
+	if err := applyBlockstoreSpec(conf, &BlockstoreConfig{Type: "unregistered"}); err == nil {
+		t.Fatal("applied unregistered blockstore type")
+	}
+}
@@ -0,0 +1,106 @@
+package ethofs
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+// DedupStat describes how much the blockstore deduplicates the DAG of a CID.
+// Blocks are told apart by their multihash, like the blockstore stores them.
+type DedupStat struct {
+	Cid         string  `json:"cid"`
+	Blocks      int     `json:"blocks"`      // Unique blocks of the DAG in the repo
+	Missing     int     `json:"missing"`     // Unique blocks of the DAG not in the repo
+	References  uint64  `json:"references"`  // Blocks of the DAG counting every link to them
+	Size        uint64  `json:"size"`        // Total size of the unique blocks, as stored
+	LogicalSize uint64  `json:"logicalSize"` // Total size counting every link, as stored without deduplication
+	Ratio       float64 `json:"ratio"`       // Logical size per stored byte
+}
+
+// dagTotals are the reference count and logical size of a sub-DAG.
+type dagTotals struct {
+	refs uint64
+	size uint64
+}
+
+// dedupStat walks the locally stored DAG below root, totalling every sub-DAG
+// once and reusing the totals for every further link to it.
+func dedupStat(ctx context.Context, bs blockstore.Blockstore, root cid.Cid) (*DedupStat, error) {
+	var (
+		dag    = currentDAGWorkers().getter(merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs))))
+		stat   = &DedupStat{Cid: root.String()}
+		totals = make(map[string]dagTotals)
+	)
+	var walk func(c cid.Cid) (dagTotals, error)
+	walk = func(c cid.Cid) (dagTotals, error) {
+		key := string(c.Hash())
+		if t, ok := totals[key]; ok {
+			return t, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return dagTotals{}, err
+		}
+		if has, err := bs.Has(c); err != nil {
+			return dagTotals{}, err
+		} else if !has {
+			stat.Missing++
+			totals[key] = dagTotals{refs: 1}
+			return totals[key], nil
+		}
+		nd, err := dag.Get(ctx, c)
+		if err != nil {
+			return dagTotals{}, err
+		}
+		size := uint64(len(nd.RawData()))
+		stat.Blocks++
+		stat.Size += size
+
+		t := dagTotals{refs: 1, size: size}
+		for _, link := range nd.Links() {
+			child, err := walk(link.Cid)
+			if err != nil {
+				return dagTotals{}, err
+			}
+			t.refs += child.refs
+			t.size += child.size
+		}
+		totals[key] = t
+		return t, nil
+	}
+	t, err := walk(root)
+	if err != nil {
+		return nil, err
+	}
+	stat.References, stat.LogicalSize = t.refs, t.size
+	if stat.Size > 0 {
+		stat.Ratio = float64(stat.LogicalSize) / float64(stat.Size)
+	}
+	return stat, nil
+}
+
+// DedupStat reports how much the repo deduplicates the locally stored DAG of
+// the CID, without retrieving missing blocks.
+func (s *EthofsService) DedupStat(ctx context.Context, c cid.Cid) (*DedupStat, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	return dedupStat(ctx, node.Blockstore, c)
+}
+
+// DedupStat returns the block deduplication statistics of the CID.
+func (api *PublicEthofsAPI) DedupStat(ctx context.Context, hash string) (_ *DedupStat, err error) {
+	defer trackCall("dedupStat", time.Now(), &err)
+
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return nil, err
+	}
+	return api.service.DedupStat(ctx, c)
+}
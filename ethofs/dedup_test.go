@@ -0,0 +1,62 @@
+package ethofs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-blockservice"
+	datastore "github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func TestDedupStat(t *testing.T) {
+	ctx := context.Background()
+	bs := blockstore.NewBlockstore(dsync.MutexWrap(datastore.NewMapDatastore()))
+	dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+
+	// A directory linked twice from the root, holding a leaf twice, plus a
+	// leaf that is not stored locally
+	var (
+		leaf    = merkledag.NewRawNode([]byte("repeated leaf"))
+		missing = merkledag.NewRawNode([]byte("not in the repo"))
+		dir     = merkledag.NodeWithData([]byte("dir"))
+		root    = merkledag.NodeWithData([]byte("root"))
+	)
+	dir.AddNodeLink("a", leaf)
+	dir.AddNodeLink("b", leaf)
+	root.AddNodeLink("first", dir)
+	root.AddNodeLink("second", dir)
+	root.AddNodeLink("missing", missing)
+	if err := dag.AddMany(ctx, []ipld.Node{leaf, dir, root}); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := dedupStat(ctx, bs, root.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		leafSize = uint64(len(leaf.RawData()))
+		dirSize  = uint64(len(dir.RawData()))
+		rootSize = uint64(len(root.RawData()))
+	)
+	if stat.Blocks != 3 || stat.Missing != 1 {
+		t.Errorf("block counts mismatch: have %d stored and %d missing, want 3 and 1", stat.Blocks, stat.Missing)
+	}
+	// root, 2x dir, 4x leaf and the missing block
+	if stat.References != 8 {
+		t.Errorf("reference count mismatch: have %d, want 8", stat.References)
+	}
+	if want := leafSize + dirSize + rootSize; stat.Size != want {
+		t.Errorf("stored size mismatch: have %d, want %d", stat.Size, want)
+	}
+	if want := 4*leafSize + 2*dirSize + rootSize; stat.LogicalSize != want {
+		t.Errorf("logical size mismatch: have %d, want %d", stat.LogicalSize, want)
+	}
+	if stat.Ratio <= 1 {
+		t.Errorf("dedup ratio %f, want above 1", stat.Ratio)
+	}
+}
@@ -0,0 +1,214 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Reasons of failed swarm dials.
+const (
+	dialTimeout = "timeout" // No answer of the peer in time
+	dialRefused = "refused" // Nothing listening on the dialed port
+	dialNoRoute = "noroute" // Peer unreachable or without known addresses
+	dialPSK     = "psk"     // Handshake failed, usually a peer with a different swarm key
+	dialBackoff = "backoff" // Dial skipped after recent failures of the swarm
+	dialDenied  = "denied"  // Connection rejected by the connection gater
+	dialOther   = "other"
+)
+
+// dialReasons are the reported failure reasons, in classification order.
+var dialReasons = []string{dialPSK, dialRefused, dialNoRoute, dialTimeout, dialBackoff, dialDenied, dialOther}
+
+// dialPatterns map the messages of failed dials to their reasons. The errors
+// of the swarm carry the messages of all dialed addresses, so the first
+// matching reason in the order of dialReasons wins.
+var dialPatterns = map[string][]string{
+	dialPSK:     {"failed to negotiate security protocol", "failed to setup private network protector"},
+	dialRefused: {"connection refused"},
+	dialNoRoute: {"no route to host", "network is unreachable", "host is unreachable", "no addresses", "no good addresses"},
+	dialTimeout: {"timeout", "timed out", "deadline exceeded"},
+	dialBackoff: {"dial backoff"},
+	dialDenied:  {"gater disallows", "gater rejected"},
+}
+
+const (
+	// maxRecentDialFailures is the number of failures kept for the breakdown.
+	maxRecentDialFailures = 32
+
+	// swarmKeyMismatchPeers is the number of distinct peers that have to fail
+	// the handshake, without any successful dial, to report a swarm key
+	// mismatch rather than a single misconfigured peer.
+	swarmKeyMismatchPeers = 2
+
+	// maxHandshakeFailures bounds the peers tracked for the mismatch detection.
+	maxHandshakeFailures = 64
+)
+
+// dialFailures audits the failed dials of the running node.
+var dialFailures = newDialAudit()
+
+// DialFailure is a failed dial of a swarm peer.
+type DialFailure struct {
+	Peer      string `json:"peer"`
+	Operation string `json:"operation"`
+	Reason    string `json:"reason"`
+	Error     string `json:"error"`
+	Time      uint64 `json:"time"`
+}
+
+// DialFailures is the breakdown of the failed swarm dials since startup.
+type DialFailures struct {
+	Total      uint64                       `json:"total"`
+	Reasons    map[string]uint64            `json:"reasons"`    // Failures per reason
+	Operations map[string]map[string]uint64 `json:"operations"` // Failures per operation and reason
+	Recent     []DialFailure                `json:"recent"`     // Latest failures, newest first
+}
+
+// dialAudit counts the failed dials by operation and reason, keeping the
+// latest failures for inspection.
+type dialAudit struct {
+	lock       sync.Mutex
+	meters     map[string]metrics.Meter
+	reasons    map[string]uint64
+	operations map[string]map[string]uint64
+	recent     []DialFailure // ring buffer, next points to the oldest entry
+	next       int
+	total      uint64
+
+	handshakes map[peer.ID]struct{} // peers failing the handshake since the last successful dial
+}
+
+func newDialAudit() *dialAudit {
+	a := &dialAudit{
+		meters:     make(map[string]metrics.Meter),
+		reasons:    make(map[string]uint64),
+		operations: make(map[string]map[string]uint64),
+		handshakes: make(map[peer.ID]struct{}),
+	}
+	for _, reason := range dialReasons {
+		a.meters[reason] = metrics.NewRegisteredMeter("ethofs/swarm/dialfail/"+reason, nil)
+	}
+	return a
+}
+
+// classifyDialError returns the reason of a failed dial.
+func classifyDialError(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return dialTimeout
+	}
+	msg := strings.ToLower(err.Error())
+	for _, reason := range dialReasons {
+		for _, pattern := range dialPatterns[reason] {
+			if strings.Contains(msg, pattern) {
+				return reason
+			}
+		}
+	}
+	return dialOther
+}
+
+// record accounts the outcome of a dial of the operation. Cancelled dials are
+// ignored, successful ones clear the handshake failures.
+func (a *dialAudit) record(op string, id peer.ID, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil {
+		a.resetHandshakes()
+		return
+	}
+	reason := classifyDialError(err)
+	a.meters[reason].Mark(1)
+	log.Trace("ethoFS - swarm dial failed", "operation", op, "peer", id, "reason", reason)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if _, ok := a.handshakes[id]; reason == dialPSK && (ok || len(a.handshakes) < maxHandshakeFailures) {
+		a.handshakes[id] = struct{}{}
+	}
+	a.total++
+	a.reasons[reason]++
+	if a.operations[op] == nil {
+		a.operations[op] = make(map[string]uint64)
+	}
+	a.operations[op][reason]++
+
+	failure := DialFailure{
+		Peer:      id.Pretty(),
+		Operation: op,
+		Reason:    reason,
+		Error:     err.Error(),
+		Time:      uint64(time.Now().Unix()),
+	}
+	if len(a.recent) < maxRecentDialFailures {
+		a.recent = append(a.recent, failure)
+		return
+	}
+	a.recent[a.next] = failure
+	a.next = (a.next + 1) % maxRecentDialFailures
+}
+
+// resetHandshakes forgets the handshake failures, e.g. after a successful dial
+// or a restart with another swarm key.
+func (a *dialAudit) resetHandshakes() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if len(a.handshakes) > 0 {
+		a.handshakes = make(map[peer.ID]struct{})
+	}
+}
+
+// swarmKeyMismatch returns ErrSwarmKeyMismatch if the node has no peers and
+// several peers failed the handshake since the last successful dial.
+func (a *dialAudit) swarmKeyMismatch(peers int) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if peers == 0 && len(a.handshakes) >= swarmKeyMismatchPeers {
+		return ErrSwarmKeyMismatch
+	}
+	return nil
+}
+
+// report returns a copy of the breakdown.
+func (a *dialAudit) report() *DialFailures {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	report := &DialFailures{
+		Total:      a.total,
+		Reasons:    make(map[string]uint64, len(a.reasons)),
+		Operations: make(map[string]map[string]uint64, len(a.operations)),
+		Recent:     make([]DialFailure, 0, len(a.recent)),
+	}
+	for reason, n := range a.reasons {
+		report.Reasons[reason] = n
+	}
+	for op, reasons := range a.operations {
+		report.Operations[op] = make(map[string]uint64, len(reasons))
+		for reason, n := range reasons {
+			report.Operations[op][reason] = n
+		}
+	}
+	for i := range a.recent {
+		// Walk the ring backwards from the newest entry
+		report.Recent = append(report.Recent, a.recent[(a.next+len(a.recent)-1-i)%len(a.recent)])
+	}
+	return report
+}
+
+// DialFailures returns the failed swarm dials since startup, counted by reason
+// and by the operation dialing, with the latest failures.
+func (api *PublicEthofsAPI) DialFailures() *DialFailures {
+	return dialFailures.report()
+}
@@ -0,0 +1,87 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestClassifyDialError(t *testing.T) {
+	tests := []struct {
+		err    error
+		reason string
+	}{
+		{context.DeadlineExceeded, dialTimeout},
+		{fmt.Errorf("dial: %w", context.DeadlineExceeded), dialTimeout},
+		{errors.New("dial tcp4 10.0.0.1:4001: i/o timeout"), dialTimeout},
+		{errors.New("dial tcp4 10.0.0.1:4001: connect: connection refused"), dialRefused},
+		{errors.New("dial tcp4 10.0.0.1:4001: connect: no route to host"), dialNoRoute},
+		{errors.New("failed to dial QmPeer: no addresses"), dialNoRoute},
+		{errors.New("failed to negotiate security protocol: EOF"), dialPSK},
+		{errors.New("dial backoff"), dialBackoff},
+		{errors.New("gater disallows connection to peer"), dialDenied},
+		{errors.New("something else"), dialOther},
+		// Handshake failures of reachable peers win over the timeouts of other addresses
+		{errors.New("failed to dial QmPeer:\n  * [/ip4/10.0.0.1/tcp/4001] dial tcp4: i/o timeout\n  * [/ip4/1.2.3.4/tcp/4001] failed to negotiate security protocol: EOF"), dialPSK},
+	}
+	for i, tt := range tests {
+		if have := classifyDialError(tt.err); have != tt.reason {
+			t.Errorf("test %d: reason mismatch: have %s, want %s", i, have, tt.reason)
+		}
+	}
+}
+
+func TestDialAudit(t *testing.T) {
+	audit := newDialAudit()
+	audit.record("connect", peer.ID("a"), nil)
+	audit.record("connect", peer.ID("a"), context.Canceled)
+	for i := 0; i < maxRecentDialFailures+2; i++ {
+		audit.record("reconnect", peer.ID(fmt.Sprintf("peer %d", i)), errors.New("connection refused"))
+	}
+	audit.record("connect", peer.ID("b"), context.DeadlineExceeded)
+
+	report := audit.report()
+	if report.Total != maxRecentDialFailures+3 {
+		t.Errorf("total mismatch: have %d, want %d", report.Total, maxRecentDialFailures+3)
+	}
+	if report.Reasons[dialRefused] != maxRecentDialFailures+2 || report.Reasons[dialTimeout] != 1 {
+		t.Errorf("reasons mismatch: have %v", report.Reasons)
+	}
+	if report.Operations["connect"][dialTimeout] != 1 || len(report.Operations["connect"]) != 1 {
+		t.Errorf("operations mismatch: have %v", report.Operations)
+	}
+	if len(report.Recent) != maxRecentDialFailures {
+		t.Fatalf("recent failures mismatch: have %d, want %d", len(report.Recent), maxRecentDialFailures)
+	}
+	if report.Recent[0].Operation != "connect" || report.Recent[1].Peer != peer.ID(fmt.Sprintf("peer %d", maxRecentDialFailures+1)).Pretty() {
+		t.Errorf("recent failures not ordered newest first: %v", report.Recent[:2])
+	}
+}
+
+func TestSwarmKeyMismatch(t *testing.T) {
+	audit := newDialAudit()
+	handshake := errors.New("failed to negotiate security protocol: EOF")
+
+	// A single peer on another network is not a mismatch
+	audit.record("bootstrap", peer.ID("a"), handshake)
+	audit.record("bootstrap", peer.ID("a"), handshake)
+	if err := audit.swarmKeyMismatch(0); err != nil {
+		t.Fatalf("mismatch reported for a single peer: %v", err)
+	}
+	audit.record("bootstrap", peer.ID("b"), handshake)
+	audit.record("bootstrap", peer.ID("c"), errors.New("connection refused"))
+	if err := audit.swarmKeyMismatch(0); err != ErrSwarmKeyMismatch {
+		t.Fatalf("mismatch error mismatch: have %v, want %v", err, ErrSwarmKeyMismatch)
+	}
+	if err := audit.swarmKeyMismatch(1); err != nil {
+		t.Errorf("mismatch reported with connected peers: %v", err)
+	}
+	// A successful dial proves the key right
+	audit.record("reconnect", peer.ID("c"), nil)
+	if err := audit.swarmKeyMismatch(0); err != nil {
+		t.Errorf("mismatch reported after a successful dial: %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package ethofs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+
+	peerstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const (
+	defaultBootstrapRefresh = time.Hour
+
+	// maxDiscoveredPeers caps the bootstrap peers taken from a single source.
+	maxDiscoveredPeers = 64
+
+	discoveryTimeout = 30 * time.Second
+	maxDiscoverySize = 1 * MB
+)
+
+// NodeRegistryABI is the interface of the on-chain gateway node registry
+// bootstrap peers are read from.
+const NodeRegistryABI = "[{\"constant\":true,\"inputs\":[],\"name\":\"GatewayNodeCount\",\"outputs\":[{\"name\":\"\",\"type\":\"uint32\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":true,\"inputs\":[{\"name\":\"\",\"type\":\"uint256\"}],\"name\":\"GatewayNodes\",\"outputs\":[{\"name\":\"\",\"type\":\"string\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"}]"
+
+var errNoEthClient = errors.New("ethereum client not available")
+
+// bootstrapSource is a location the current set of bootstrap peers can be
+// retrieved from.
+type bootstrapSource interface {
+	String() string
+	peers(ctx context.Context) ([]string, error)
+}
+
+// parseBootstrapSource parses a bootstrap source spec, which is one of
+//
+//	contract:<address>   gateway node registry contract
+//	dnsaddr:<domain>     dnsaddr TXT records of _dnsaddr.<domain>
+//	http(s)://<url>      JSON array or newline separated list of multiaddrs
+func parseBootstrapSource(spec string) (bootstrapSource, error) {
+	switch {
+	case strings.HasPrefix(spec, "contract:"):
+		addr := strings.TrimPrefix(spec, "contract:")
+		if !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("invalid registry address %q", addr)
+		}
+		return &contractSource{address: common.HexToAddress(addr)}, nil
+	case strings.HasPrefix(spec, "dnsaddr:"):
+		domain := strings.TrimPrefix(spec, "dnsaddr:")
+		if domain == "" {
+			return nil, errors.New("empty dnsaddr domain")
+		}
+		return dnsSource(domain), nil
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return httpSource(spec), nil
+	}
+	return nil, fmt.Errorf("unsupported bootstrap source %q", spec)
+}
+
+// contractSource reads the bootstrap peers from the gateway node registry.
+type contractSource struct {
+	address common.Address
+}
+
+func (s *contractSource) String() string { return "contract:" + s.address.Hex() }
+
+func (s *contractSource) peers(ctx context.Context) ([]string, error) {
+	if ethClient == nil {
+		return nil, errNoEthClient
+	}
+	parsed, err := abi.JSON(strings.NewReader(NodeRegistryABI))
+	if err != nil {
+		return nil, err
+	}
+	contract := bind.NewBoundContract(s.address, parsed, ethClient, nil, nil)
+	opts := &bind.CallOpts{Context: ctx}
+
+	count := new(uint32)
+	if err := contract.Call(opts, count, "GatewayNodeCount"); err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for i := uint32(0); i < *count && len(addrs) < maxDiscoveredPeers; i++ {
+		addr := new(string)
+		if err := contract.Call(opts, addr, "GatewayNodes", new(big.Int).SetUint64(uint64(i))); err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, *addr)
+	}
+	return addrs, nil
+}
+
+// dnsSource reads the bootstrap peers from dnsaddr TXT records.
+type dnsSource string
+
+func (s dnsSource) String() string { return "dnsaddr:" + string(s) }
+
+func (s dnsSource) peers(ctx context.Context) ([]string, error) {
+	records, err := net.DefaultResolver.LookupTXT(ctx, "_dnsaddr."+string(s))
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, record := range records {
+		if strings.HasPrefix(record, "dnsaddr=") {
+			addrs = append(addrs, strings.TrimPrefix(record, "dnsaddr="))
+		}
+	}
+	return addrs, nil
+}
+
+// httpSource downloads the bootstrap peers from a URL.
+type httpSource string
+
+func (s httpSource) String() string { return string(s) }
+
+func (s httpSource) peers(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequest(http.MethodGet, string(s), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, maxDiscoverySize))
+	if err != nil {
+		return nil, err
+	}
+	return parseBootstrapList(body), nil
+}
+
+// parseBootstrapList decodes a JSON array of multiaddrs, falling back to one
+// multiaddr per line with # comments.
+func parseBootstrapList(data []byte) []string {
+	var addrs []string
+	if err := json.Unmarshal(data, &addrs); err == nil {
+		return addrs
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			addrs = append(addrs, line)
+		}
+	}
+	return addrs
+}
+
+// filterBootstrapAddrs drops duplicate and malformed multiaddrs and those not
+// carrying a peer ID, keeping at most limit entries.
+func filterBootstrapAddrs(addrs []string, limit int) []string {
+	seen := make(map[string]bool)
+	valid := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if seen[addr] || len(valid) >= limit {
+			continue
+		}
+		maddr, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			continue
+		}
+		if _, err := peerstore.InfoFromP2pAddr(maddr); err != nil {
+			continue
+		}
+		seen[addr] = true
+		valid = append(valid, addr)
+	}
+	return valid
+}
+
+// bootstrapDiscovery periodically refreshes the bootstrap set from the
+// configured sources, merging the discovered peers with the static ones.
+type bootstrapDiscovery struct {
+	sources  []bootstrapSource
+	static   []string
+	interval time.Duration
+	update   func(ctx context.Context, peers []string) error
+}
+
+func newBootstrapDiscovery(cfg *Config, update func(ctx context.Context, peers []string) error) (*bootstrapDiscovery, error) {
+	d := &bootstrapDiscovery{
+		static:   cfg.bootstrapNodes(),
+		interval: cfg.BootstrapRefresh,
+		update:   update,
+	}
+	if d.interval == 0 {
+		d.interval = defaultBootstrapRefresh
+	}
+	for _, spec := range cfg.BootstrapSources {
+		source, err := parseBootstrapSource(spec)
+		if err != nil {
+			return nil, err
+		}
+		d.sources = append(d.sources, source)
+	}
+	return d, nil
+}
+
+// loop refreshes the bootstrap set right away and then every interval until
+// the context is cancelled.
+func (d *bootstrapDiscovery) loop(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		d.refresh(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *bootstrapDiscovery) refresh(ctx context.Context) {
+	peers := append([]string{}, d.static...)
+	for _, source := range d.sources {
+		sourceCtx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+		addrs, err := source.peers(sourceCtx)
+		cancel()
+
+		if err != nil {
+			log.Debug("ethoFS - bootstrap discovery failed", "source", source, "error", err)
+			continue
+		}
+		addrs = filterBootstrapAddrs(addrs, maxDiscoveredPeers)
+		log.Debug("ethoFS - bootstrap peers discovered", "source", source, "count", len(addrs))
+		peers = append(peers, addrs...)
+	}
+	peers = filterBootstrapAddrs(peers, len(peers))
+	if err := d.update(ctx, peers); err != nil && err != context.Canceled {
+		log.Debug("ethoFS - unable to update bootstrap peers", "error", err)
+	}
+}
@@ -0,0 +1,50 @@
+package ethofs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBootstrapSource(t *testing.T) {
+	valid := []string{
+		"contract:0xD3b80c611999D46895109d75322494F7A49D742F",
+		"dnsaddr:bootstrap.ethofs.com",
+		"https://ethofs.com/bootstrap.json",
+	}
+	for _, spec := range valid {
+		if _, err := parseBootstrapSource(spec); err != nil {
+			t.Errorf("%s: unexpected error: %v", spec, err)
+		}
+	}
+	invalid := []string{"contract:0x1234", "dnsaddr:", "ftp://ethofs.com", "ethofs.com"}
+	for _, spec := range invalid {
+		if _, err := parseBootstrapSource(spec); err == nil {
+			t.Errorf("%s: expected error", spec)
+		}
+	}
+}
+
+func TestParseBootstrapList(t *testing.T) {
+	a := "/ip4/164.68.107.82/tcp/4001/ipfs/QmeG81bELkgLBZFYZc53ioxtvRS8iNVzPqxUBKSuah2rcQ"
+	b := "/ip4/164.68.98.94/tcp/4001/ipfs/QmRYw68MzD4jPvner913mLWBdFfpPfNUx8SRFjiUCJNA4f"
+
+	if have := parseBootstrapList([]byte(`["` + a + `","` + b + `"]`)); !reflect.DeepEqual(have, []string{a, b}) {
+		t.Errorf("JSON list mismatch: have %v", have)
+	}
+	if have := parseBootstrapList([]byte("# gateways\n" + a + "\n\n" + b + "\n")); !reflect.DeepEqual(have, []string{a, b}) {
+		t.Errorf("text list mismatch: have %v", have)
+	}
+}
+
+func TestFilterBootstrapAddrs(t *testing.T) {
+	a := "/ip4/164.68.107.82/tcp/4001/ipfs/QmeG81bELkgLBZFYZc53ioxtvRS8iNVzPqxUBKSuah2rcQ"
+	b := "/ip4/164.68.98.94/tcp/4001/ipfs/QmRYw68MzD4jPvner913mLWBdFfpPfNUx8SRFjiUCJNA4f"
+
+	addrs := []string{a, "not-a-multiaddr", "/ip4/1.2.3.4/tcp/4001", a, b}
+	if have := filterBootstrapAddrs(addrs, 10); !reflect.DeepEqual(have, []string{a, b}) {
+		t.Errorf("filtered addrs mismatch: have %v", have)
+	}
+	if have := filterBootstrapAddrs(addrs, 1); !reflect.DeepEqual(have, []string{a}) {
+		t.Errorf("limited addrs mismatch: have %v", have)
+	}
+}
@@ -0,0 +1,412 @@
+package ethofs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+const (
+	// envelopeMagic starts every encrypted ethoFS file.
+	envelopeMagic = "ethofs-enc/1\n"
+
+	// envelopeChunkSize is the plaintext size of the chunks sealed one by one,
+	// so content is encrypted and decrypted as a stream.
+	envelopeChunkSize = 64 * 1024
+
+	maxEnvelopeChunkSize  = 1024 * 1024
+	maxEnvelopeHeaderSize = 1024 * 1024
+	envelopeNoncePrefix   = 7
+)
+
+var (
+	errNoRecipients      = errors.New("no recipients to encrypt for")
+	errNotEnvelope       = errors.New("content is not encrypted with an ethoFS envelope")
+	errNotRecipient      = errors.New("account is not a recipient of the content")
+	errEnvelopeCorrupted = errors.New("encrypted content corrupted or truncated")
+	errNoKeystore        = errors.New("no keystore backend available")
+)
+
+// envelopeHeader precedes the encrypted chunks. It is authenticated as the
+// additional data of every chunk.
+type envelopeHeader struct {
+	ChunkSize  int                 `json:"chunkSize"`
+	Nonce      []byte              `json:"nonce"`
+	Recipients []envelopeRecipient `json:"recipients"`
+}
+
+// envelopeRecipient is the data key wrapped to an Ethereum account with
+// ECIES over its secp256k1 public key.
+type envelopeRecipient struct {
+	Address common.Address `json:"address"`
+	Key     []byte         `json:"key"`
+}
+
+// chunkNonce derives the nonce of a chunk from the nonce prefix, the chunk
+// index and whether it is the last chunk, so reordering, dropping or
+// truncating chunks fails authentication.
+func chunkNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[envelopeNoncePrefix:], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+func newEnvelopeCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealContent encrypts src to dst with a fresh data key wrapped to each of
+// the recipients.
+func sealContent(dst io.Writer, src io.Reader, recipients []*ecdsa.PublicKey) error {
+	if len(recipients) == 0 {
+		return errNoRecipients
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+	wrapped, err := wrapDataKey(dataKey, recipients)
+	if err != nil {
+		return err
+	}
+	return sealEnvelope(dst, src, dataKey, wrapped)
+}
+
+// wrapDataKey encrypts the data key to each of the recipients.
+func wrapDataKey(dataKey []byte, recipients []*ecdsa.PublicKey) ([]envelopeRecipient, error) {
+	wrapped := make([]envelopeRecipient, 0, len(recipients))
+	for _, pub := range recipients {
+		key, err := ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(pub), dataKey, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		wrapped = append(wrapped, envelopeRecipient{Address: crypto.PubkeyToAddress(*pub), Key: key})
+	}
+	return wrapped, nil
+}
+
+// sealEnvelope encrypts src to dst with the data key, listing the wrapped
+// data keys of the recipients in the header. Envelopes without recipients
+// can only be opened by the holders of the data key.
+func sealEnvelope(dst io.Writer, src io.Reader, dataKey []byte, recipients []envelopeRecipient) error {
+	hdr := envelopeHeader{ChunkSize: envelopeChunkSize, Nonce: make([]byte, envelopeNoncePrefix), Recipients: recipients}
+	if _, err := rand.Read(hdr.Nonce); err != nil {
+		return err
+	}
+	aad, err := json.Marshal(hdr)
+	if err != nil {
+		return err
+	}
+	aead, err := newEnvelopeCipher(dataKey)
+	if err != nil {
+		return err
+	}
+	prefix := make([]byte, len(envelopeMagic)+4)
+	copy(prefix, envelopeMagic)
+	binary.BigEndian.PutUint32(prefix[len(envelopeMagic):], uint32(len(aad)))
+	if _, err := dst.Write(append(prefix, aad...)); err != nil {
+		return err
+	}
+	var (
+		in     = bufio.NewReaderSize(src, hdr.ChunkSize)
+		buf    = make([]byte, hdr.ChunkSize)
+		sealed = make([]byte, 0, hdr.ChunkSize+aead.Overhead())
+	)
+	for index := uint32(0); ; index++ {
+		n, err := io.ReadFull(in, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		_, err = in.Peek(1)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		last := err == io.EOF
+		sealed = aead.Seal(sealed[:0], chunkNonce(hdr.Nonce, index, last), buf[:n], aad)
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// envelopeReader decrypts the chunks of an encrypted file.
+type envelopeReader struct {
+	in      *bufio.Reader
+	aead    cipher.AEAD
+	aad     []byte
+	nonce   []byte
+	sealed  []byte
+	plain   []byte
+	index   uint32
+	done    bool
+	pending []byte
+}
+
+// openEnvelope reads the header of an encrypted file and unwraps the data
+// key with the private key of one of its recipients.
+func openEnvelope(src io.Reader, key *ecdsa.PrivateKey) (io.Reader, error) {
+	in, aad, hdr, err := readEnvelopeHeader(src)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := unwrapDataKey(hdr, key)
+	if err != nil {
+		return nil, err
+	}
+	return newEnvelopeReader(in, aad, hdr, dataKey)
+}
+
+// openEnvelopeWithKey reads an encrypted file with a known data key.
+func openEnvelopeWithKey(src io.Reader, dataKey []byte) (io.Reader, error) {
+	in, aad, hdr, err := readEnvelopeHeader(src)
+	if err != nil {
+		return nil, err
+	}
+	return newEnvelopeReader(in, aad, hdr, dataKey)
+}
+
+// readEnvelopeHeader reads the header of an encrypted file, returning the
+// reader positioned at the first chunk and the raw header, which is the
+// additional data of the chunks.
+func readEnvelopeHeader(src io.Reader) (*bufio.Reader, []byte, *envelopeHeader, error) {
+	in := bufio.NewReader(src)
+	prefix := make([]byte, len(envelopeMagic)+4)
+	if _, err := io.ReadFull(in, prefix); err != nil || string(prefix[:len(envelopeMagic)]) != envelopeMagic {
+		return nil, nil, nil, errNotEnvelope
+	}
+	size := binary.BigEndian.Uint32(prefix[len(envelopeMagic):])
+	if size > maxEnvelopeHeaderSize {
+		return nil, nil, nil, errNotEnvelope
+	}
+	aad := make([]byte, size)
+	if _, err := io.ReadFull(in, aad); err != nil {
+		return nil, nil, nil, errEnvelopeCorrupted
+	}
+	hdr := new(envelopeHeader)
+	if err := json.Unmarshal(aad, hdr); err != nil {
+		return nil, nil, nil, errNotEnvelope
+	}
+	if hdr.ChunkSize <= 0 || hdr.ChunkSize > maxEnvelopeChunkSize || len(hdr.Nonce) != envelopeNoncePrefix {
+		return nil, nil, nil, errNotEnvelope
+	}
+	return in, aad, hdr, nil
+}
+
+// unwrapDataKey decrypts the data key wrapped to the account of the key.
+func unwrapDataKey(hdr *envelopeHeader, key *ecdsa.PrivateKey) ([]byte, error) {
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	for _, recipient := range hdr.Recipients {
+		if recipient.Address != addr {
+			continue
+		}
+		dataKey, err := ecies.ImportECDSA(key).Decrypt(recipient.Key, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to unwrap data key: %v", err)
+		}
+		return dataKey, nil
+	}
+	return nil, errNotRecipient
+}
+
+func newEnvelopeReader(in *bufio.Reader, aad []byte, hdr *envelopeHeader, dataKey []byte) (*envelopeReader, error) {
+	aead, err := newEnvelopeCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &envelopeReader{
+		in:     in,
+		aead:   aead,
+		aad:    aad,
+		nonce:  hdr.Nonce,
+		sealed: make([]byte, hdr.ChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (r *envelopeReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// next decrypts the next chunk.
+func (r *envelopeReader) next() error {
+	n, err := io.ReadFull(r.in, r.sealed)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return errEnvelopeCorrupted
+		}
+		return err
+	}
+	last := err == io.ErrUnexpectedEOF
+	if !last {
+		if _, err := r.in.Peek(1); err != nil {
+			if err != io.EOF {
+				return err
+			}
+			last = true
+		}
+	}
+	plain, err := r.aead.Open(r.plain[:0], chunkNonce(r.nonce, r.index, last), r.sealed[:n], r.aad)
+	if err != nil {
+		return errEnvelopeCorrupted
+	}
+	r.plain, r.pending = plain, plain
+	r.index++
+	r.done = last
+	return nil
+}
+
+// AddEncrypted encrypts the content of r client side and adds it to the
+// ethoFS node, pinned. Only the owners of the recipient public keys can
+// decrypt it again, see GetDecrypted.
+func (s *EthofsService) AddEncrypted(ctx context.Context, r io.Reader, recipients []*ecdsa.PublicKey) (cid.Cid, error) {
+	if len(recipients) == 0 {
+		return cid.Undef, errNoRecipients
+	}
+	pr, pw := io.Pipe()
+	defer pr.Close()
+
+	go func() {
+		pw.CloseWithError(sealContent(pw, r, recipients))
+	}()
+	return s.Add(ctx, pr, AddOptions{Pin: true}, nil)
+}
+
+// GetDecrypted retrieves the encrypted file at the given CID or ethoFS path
+// and decrypts it with the private key of one of its recipients.
+func (s *EthofsService) GetDecrypted(ctx context.Context, p string, key *ecdsa.PrivateKey) (io.ReadCloser, error) {
+	ipfs := s.API()
+	if ipfs == nil {
+		return nil, errNodeNotRunning
+	}
+	nd, err := ipfs.Unixfs().Get(ctx, parsePath(p))
+	if err != nil {
+		return nil, err
+	}
+	file := files.ToFile(nd)
+	if file == nil {
+		return nil, fmt.Errorf("%s is not a file", p)
+	}
+	plain, err := openEnvelope(newLimitedReader(ctx, file), key)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{plain, file}, nil
+}
+
+// accountKey decrypts the private key of a keystore account.
+func (s *EthofsService) accountKey(account common.Address, passphrase string) (*ecdsa.PrivateKey, error) {
+	backends := s.stack.AccountManager().Backends(keystore.KeyStoreType)
+	if len(backends) == 0 {
+		return nil, errNoKeystore
+	}
+	ks := backends[0].(*keystore.KeyStore)
+	blob, err := ks.Export(accounts.Account{Address: account}, passphrase, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keystore.DecryptKey(blob, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return key.PrivateKey, nil
+}
+
+// parsePublicKey decodes an uncompressed or compressed secp256k1 public key.
+func parsePublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	if len(data) == 33 {
+		return crypto.DecompressPubkey(data)
+	}
+	return crypto.UnmarshalPubkey(data)
+}
+
+// GetDecrypted retrieves an encrypted file and decrypts it with the key of
+// the given keystore account, unlocked with the passphrase.
+func (api *PrivateEthofsAPI) GetDecrypted(ctx context.Context, p string, account common.Address, passphrase string) (_ hexutil.Bytes, err error) {
+	defer trackCall("getDecrypted", time.Now(), &err)
+
+	key, err := api.service.accountKey(account, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	plain, err := api.service.GetDecrypted(ctx, p, key)
+	if err != nil {
+		return nil, err
+	}
+	defer plain.Close()
+
+	buf := new(bytes.Buffer)
+	if _, err := io.Copy(buf, io.LimitReader(plain, int64(maxGetSize)+1)); err != nil {
+		return nil, err
+	}
+	if buf.Len() > maxGetSize {
+		return nil, fmt.Errorf("%w of %d bytes", errFileTooLarge, maxGetSize)
+	}
+	return buf.Bytes(), nil
+}
+
+// AddEncrypted encrypts the data to the given secp256k1 public keys and adds
+// it to the ethoFS node, returning its CID.
+func (api *PrivateEthofsAPI) AddEncrypted(ctx context.Context, data hexutil.Bytes, recipients []hexutil.Bytes) (_ string, err error) {
+	defer trackCall("addEncrypted", time.Now(), &err)
+
+	keys := make([]*ecdsa.PublicKey, 0, len(recipients))
+	for _, recipient := range recipients {
+		pub, err := parsePublicKey(recipient)
+		if err != nil {
+			return "", fmt.Errorf("invalid recipient public key %s: %v", recipient, err)
+		}
+		keys = append(keys, pub)
+	}
+	c, err := api.service.AddEncrypted(ctx, bytes.NewReader(data), keys)
+	if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
@@ -0,0 +1,54 @@
+package ethofs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestEnvelopeRoundtrip(t *testing.T) {
+	alice, _ := crypto.GenerateKey()
+	bob, _ := crypto.GenerateKey()
+	eve, _ := crypto.GenerateKey()
+
+	for _, size := range []int{0, 1, envelopeChunkSize - 1, envelopeChunkSize, 3*envelopeChunkSize + 17} {
+		plain := bytes.Repeat([]byte{0xab}, size)
+		sealed := new(bytes.Buffer)
+		if err := sealContent(sealed, bytes.NewReader(plain), []*ecdsa.PublicKey{&alice.PublicKey, &bob.PublicKey}); err != nil {
+			t.Fatalf("size %d: failed to encrypt: %v", size, err)
+		}
+		for _, key := range []*ecdsa.PrivateKey{alice, bob} {
+			r, err := openEnvelope(bytes.NewReader(sealed.Bytes()), key)
+			if err != nil {
+				t.Fatalf("size %d: failed to open envelope: %v", size, err)
+			}
+			have, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("size %d: failed to decrypt: %v", size, err)
+			}
+			if !bytes.Equal(have, plain) {
+				t.Fatalf("size %d: plaintext mismatch: have %d bytes", size, len(have))
+			}
+		}
+		if _, err := openEnvelope(bytes.NewReader(sealed.Bytes()), eve); err != errNotRecipient {
+			t.Fatalf("size %d: non-recipient error mismatch: have %v, want %v", size, err, errNotRecipient)
+		}
+		// Dropping the tail of the content has to fail authentication
+		if size > envelopeChunkSize {
+			truncated := sealed.Bytes()[:sealed.Len()-40]
+			r, err := openEnvelope(bytes.NewReader(truncated), alice)
+			if err != nil {
+				t.Fatalf("size %d: failed to open truncated envelope: %v", size, err)
+			}
+			if _, err := ioutil.ReadAll(r); err != errEnvelopeCorrupted {
+				t.Fatalf("size %d: truncation error mismatch: have %v, want %v", size, err, errEnvelopeCorrupted)
+			}
+		}
+	}
+	if _, err := openEnvelope(bytes.NewReader([]byte("plain text")), alice); err != errNotEnvelope {
+		t.Fatalf("plain content error mismatch: have %v, want %v", err, errNotEnvelope)
+	}
+}
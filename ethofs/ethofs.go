@@ -1,11 +1,10 @@
 package ethofs
 
 import (
-	//"fmt"
+	"context"
 	"math/rand"
-	"os"
-	"runtime"
-	//"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -15,134 +14,142 @@ import (
 	icore "github.com/ipfs/interface-go-ipfs-core"
 
 	"github.com/ipfs/go-ipfs/core"
-	//cid "github.com/ipfs/go-cidutil"
 )
 
-var localPinMapping map[string]string
 var selfNodeID string
 var repFactor = uint64(10)
 var BlockHeight = int(0)
+
+// Ipfs is the core API of the running node.
+//
+// Deprecated: the variable is written while other goroutines may read it,
+// use Instance instead.
 var Ipfs icore.CoreAPI
+
+// Node is the running IPFS node.
+//
+// Deprecated: the variable is written while other goroutines may read it,
+// use Instance instead.
 var Node *core.IpfsNode
+
 var contractControllerAddress = common.HexToAddress("0xc38B47169950D8A28bC77a6Fa7467464f25ADAFc")
 var mainChannelString = "ethoFSPinningChannel_alpha11"
-var defaultDataDir string
-var ipcLocation string
-var isInitialized = false
+var defaultDataDir = node.DefaultDataDir()
 
+// IsInitialized reports whether the ethoFS node is running.
 func IsInitialized() bool {
-	return isInitialized
+	_, err := Instance()
+	return err == nil
 }
 
-func InitializeEthofs(initFlag bool, configFlag bool, nodeType string, blockCommunication chan *types.Block) {
+// InitializeRepo creates the ethoFS repo for the configured node type.
+func InitializeRepo(cfg *Config) error {
+	ethofsConfig = *cfg
 
-	checkResources(nodeType)
-
-	localPinMapping = make(map[string]string)
-
-	// initalize default locations
-	defaultDataDir = node.DefaultDataDir()
-	if runtime.GOOS == "linux" {
-		ipcLocation = defaultDataDir + "/geth.ipc"
-	} else if runtime.GOOS == "windows" {
-		ipcLocation = defaultDataDir + "\\geth.ipc"
-	} else if runtime.GOOS == "darwin" {
-		ipcLocation = defaultDataDir + "/geth.ipc"
+	if err := checkResources(cfg.NodeType); err != nil {
+		return err
 	}
 
-	clientErr := initializeEthClient()
-	if clientErr != nil {
-		os.Exit(0)
+	log.Info("Starting ethoFS repo initialization")
+	err := initializeEthofsNodeRepo(cfg.NodeType)
+	if err == nil {
+		log.Info("ethoFS repo initialization successful")
+	} else {
+		log.Warn("ethoFS repo initialization failed")
 	}
+	return err
+}
 
-	if initFlag {
-
- 		log.Info("Starting ethoFS repo initialization")
-		err := initializeEthofsNodeRepo(nodeType)
-		if err == nil {
-	 		log.Info("ethoFS repo initialization successful")
-		} else {
-	 		log.Warn("ethoFS repo initialization failed")
-		}
-		os.Exit(0)
-
-	} else if configFlag {
+// ConfigureRepo applies the configured node type defaults to the ethoFS repo.
+func ConfigureRepo(cfg *Config) error {
+	ethofsConfig = *cfg
 
- 		log.Info("Starting ethoFS repo/node configuration")
-		err := initializeEthofsNodeConfig(nodeType)
-		if err == nil {
-	 		log.Info("ethoFS configuration successful")
-		} else {
-	 		log.Warn("ethoFS configuration failed")
-		}
-		os.Exit(0)
+	if err := checkResources(cfg.NodeType); err != nil {
+		return err
+	}
 
+	log.Info("Starting ethoFS repo/node configuration")
+	err := initializeEthofsNodeConfig(cfg.NodeType)
+	if err == nil {
+		log.Info("ethoFS configuration successful")
 	} else {
- 		log.Info("Starting ethoFS node initialization", "type", nodeType)
-		Ipfs, Node = initializeEthofsNode(nodeType)
-
-		go func() {
-			err := updatePinContractValues()
-			if err != nil {
-				log.Debug("ethoFS - error updating pin contract values")
-			} else {
-				log.Debug("ethoFS - pin contract value update successful")
-			}
-
-			updateLocalPinMapping(Ipfs)
-		}()
-		// Initialize block listener
-		go BlockListener(blockCommunication)
+		log.Warn("ethoFS configuration failed")
 	}
+	return err
 }
 
-//func NewBlock(block *types.Block) {
-func BlockListener(blockCommunication chan *types.Block) {
-
-	returnFlag := false
+// BlockListener processes new chain blocks until the context is cancelled.
+// The goroutines it starts are tracked by wg, and the chain backend is passed
+// in, as the service clears its globals once the wait group drained.
+func BlockListener(ctx context.Context, blockCommunication chan *types.Block, chain *chainMonitor, wg *sync.WaitGroup) {
+	// Only a single pin mapping resync runs at a time
+	var remapping int32
 
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case block := <-blockCommunication:
 			log.Info("ethoFS - new block received for processing", "number", block.Header().Number.Int64(), "txs", len(block.Transactions()))
 			if len(block.Transactions()) > 0 {
-				go CheckForUploads(block.Transactions())
+				wg.Add(1)
+				go func(txs types.Transactions) {
+					defer wg.Done()
+					CheckForUploads(txs)
+				}(block.Transactions())
 			}
+			wg.Add(1)
 			go func() {
+				defer wg.Done()
 
 				randomBlockSelector := rand.Intn(100)
 				if randomBlockSelector > 25 && randomBlockSelector < 75 {
-				        err := updatePinContractValues()
-				        if err != nil {
-					        log.Debug("ethoFS - error updating pin contract values")
-				        } else {
-					        log.Debug("ethoFS - pin contract value update successful")
-				        }
-				} else if randomBlockSelector < 5 && returnFlag == false {
-					returnFlag = true
+					err := chain.submit(ctx, "pinContract", updatePinContractValues)
+					if err == errChainUnavailable {
+						log.Debug("ethoFS - pin contract update queued, chain backend unavailable")
+					} else if err != nil {
+						log.Debug("ethoFS - error updating pin contract values")
+					} else {
+						log.Debug("ethoFS - pin contract value update successful")
+					}
+				} else if randomBlockSelector < 5 && atomic.CompareAndSwapInt32(&remapping, 0, 1) {
+					defer atomic.StoreInt32(&remapping, 0)
+
 					// Update local pin tracking/mapping
-					_, returnFlag = updateLocalPinMapping(Ipfs)
-                                } else if randomBlockSelector > 98 {
-					// Initiate garbage collection randomly roughly every 20 blocks
-					go gc(Node)
+					if inst, err := Instance(); err == nil {
+						updateLocalPinMapping(inst.Node)
+					}
 				}
 			}()
 		}
 	}
 }
 
+// CheckForUploads pins the content of the upload transactions that lacks
+// providers, returning once all transactions are processed.
 func CheckForUploads(transactions types.Transactions) {
+	inst, err := Instance()
+	if err != nil {
+		log.Debug("ethoFS - skipping upload detection", "error", err)
+		return
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
 	for _, transaction := range transactions {
 		recipient := transaction.To()
 		if recipient == nil {
 			continue
 		} else if *recipient == contractControllerAddress {
-			go func() {
+			wg.Add(1)
+			go func(transaction *types.Transaction) {
+				defer wg.Done()
+
 				log.Info("ethoFS - new upload transaction detected", "hash", transaction.Hash())
 				cids := scanForCids(transaction.Data())
 				for _, pin := range cids {
 					log.Debug("ethoFS - immediate pin request detail", "hash", pin)
-					pinned := pinSearch(pin, localPinMapping)
+					pinned := pinSearch(pin)
 					if !pinned {
 						log.Debug("ethoFS - error while searching for pin", "error", "Pin not found")
 						continue
@@ -150,24 +157,26 @@ func CheckForUploads(transactions types.Transactions) {
 						log.Debug("ethoFS - data is pinned to local node", "hash", pin)
 					}
 
-					providerCount, err := FindProvs(Node, pin)
+					providerCount, err := FindProvs(inst.Node, pin)
 					if err != nil {
 						log.Debug("ethoFS - provider search error", "error", err)
 						continue
 					}
 
-					if !pinned && providerCount < (repFactor/uint64(2)) {
+					target := replicationTarget(pin)
+					if !pinned && providerCount < (target/uint64(2)) {
 						// Pin data due to insufficient existing providers
-						addedPin, err := pinAdd(Ipfs, pin)
+						addedPin, err := pinAdd(inst.API, pin)
 						if err != nil {
 							log.Debug("ethoFS - error adding pin", "hash", pin, "error", err)
 							continue
 						} else {
 							log.Debug("ethoFS - pin added successfully", "hash", addedPin)
+							trackContractPin(addedPin)
 						}
-					} else if pinned && providerCount > (repFactor+(repFactor/uint64(2))) {
+					} else if pinned && providerCount > (target+(target/uint64(2))) {
 						// Pin data due to insufficient existing providers
-						removedPin, err := pinRemove(Ipfs, pin)
+						removedPin, err := pinRemove(inst.API, pin)
 						if err != nil {
 							log.Debug("ethoFS - pin removal error", "hash", pin, "error", err)
 							continue
@@ -176,7 +185,7 @@ func CheckForUploads(transactions types.Transactions) {
 						}
 					}
 				}
-			}()
+			}(transaction)
 		}
 	}
 }
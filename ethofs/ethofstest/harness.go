@@ -0,0 +1,106 @@
+package ethofstest
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	files "github.com/ipfs/go-ipfs-files"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// AssertTimeout bounds the retrievals and pins of the assertion helpers.
+var AssertTimeout = 30 * time.Second
+
+// NewNetwork spawns a network of n nodes for a test, failing the test if any
+// node does not start. The network has to be closed when the test ends.
+func NewNetwork(t testing.TB, n int) *Network {
+	t.Helper()
+
+	network, err := SpawnNetwork(n)
+	if err != nil {
+		t.Fatalf("failed to spawn network: %v", err)
+	}
+	return network
+}
+
+// Add stores data on the node as a UnixFS file and pins it.
+func (n *Node) Add(ctx context.Context, data []byte) (path.Resolved, error) {
+	return n.API.Unixfs().Add(ctx, files.NewBytesFile(data), options.Unixfs.Pin(true))
+}
+
+// Cat retrieves the UnixFS file at p, from the swarm if the node does not
+// store it.
+func (n *Node) Cat(ctx context.Context, p path.Path) ([]byte, error) {
+	nd, err := n.API.Unixfs().Get(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer nd.Close()
+
+	return ioutil.ReadAll(files.ToFile(nd))
+}
+
+// Pin recursively pins the DAG at p, retrieving it from the swarm.
+func (n *Node) Pin(ctx context.Context, p path.Path) error {
+	return n.API.Pin().Add(ctx, p, options.Pin.Recursive(true))
+}
+
+// Pinned reports whether the DAG at p is pinned recursively.
+func (n *Node) Pinned(ctx context.Context, p path.Path) (bool, error) {
+	_, pinned, err := n.API.Pin().IsPinned(ctx, p, options.Pin.IsPinned.Recursive())
+	return pinned, err
+}
+
+// MustAdd adds data to the node, failing the test on error.
+func MustAdd(t testing.TB, node *Node, data []byte) path.Resolved {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), AssertTimeout)
+	defer cancel()
+
+	p, err := node.Add(ctx, data)
+	if err != nil {
+		t.Fatalf("node %s: failed to add content: %v", node.ID, err)
+	}
+	return p
+}
+
+// AssertRetrievable checks that the node retrieves the file at p with the
+// wanted content.
+func AssertRetrievable(t testing.TB, node *Node, p path.Path, want []byte) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), AssertTimeout)
+	defer cancel()
+
+	have, err := node.Cat(ctx, p)
+	if err != nil {
+		t.Errorf("node %s: failed to retrieve %s: %v", node.ID, p, err)
+		return
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("node %s: content mismatch of %s: have %q, want %q", node.ID, p, have, want)
+	}
+}
+
+// AssertPinned checks that the node holds a recursive pin of the DAG at p,
+// without pinning it itself.
+func AssertPinned(t testing.TB, node *Node, p path.Path) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), AssertTimeout)
+	defer cancel()
+
+	pinned, err := node.Pinned(ctx, p)
+	if err != nil {
+		t.Errorf("node %s: failed to check pin of %s: %v", node.ID, p, err)
+		return
+	}
+	if !pinned {
+		t.Errorf("node %s: %s not pinned", node.ID, p)
+	}
+}
@@ -0,0 +1,34 @@
+package ethofstest
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReplication(t *testing.T) {
+	network := NewNetwork(t, 3)
+	defer network.Close()
+
+	// Content added to the first node is pinned by the others, and stays
+	// retrievable once its origin is gone
+	data := []byte("replicated across the ethoFS devnet")
+	p := MustAdd(t, network.Nodes[0], data)
+	AssertPinned(t, network.Nodes[0], p)
+
+	ctx, cancel := context.WithTimeout(context.Background(), AssertTimeout)
+	defer cancel()
+
+	for _, node := range network.Nodes[1:] {
+		if pinned, err := node.Pinned(ctx, p); err != nil || pinned {
+			t.Fatalf("node %s: pinned %s before replicating it (%v)", node.ID, p, err)
+		}
+		if err := node.Pin(ctx, p); err != nil {
+			t.Fatalf("node %s: failed to pin %s: %v", node.ID, p, err)
+		}
+		AssertPinned(t, node, p)
+	}
+	if err := network.Nodes[0].Node.Close(); err != nil {
+		t.Fatalf("failed to stop origin node: %v", err)
+	}
+	AssertRetrievable(t, network.Nodes[2], p, data)
+}
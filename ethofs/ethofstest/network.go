@@ -0,0 +1,175 @@
+// Package ethofstest spawns local networks of ethoFS nodes for example apps,
+// tutorials and integration tests.
+package ethofstest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	datastore "github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	config "github.com/ipfs/go-ipfs-config"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/keystore"
+	"github.com/ipfs/go-ipfs/repo"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Node is a handle of a node in a local network.
+type Node struct {
+	ID    peer.ID
+	Addrs []ma.Multiaddr
+	API   icore.CoreAPI
+	Node  *core.IpfsNode
+}
+
+// Network is a set of fully meshed local nodes sharing a private swarm key.
+type Network struct {
+	Nodes    []*Node
+	SwarmKey []byte
+
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// keyedRepo is an in-memory repo carrying a swarm key, making its node join
+// the private network of the key.
+type keyedRepo struct {
+	*repo.Mock
+	swarmKey []byte
+}
+
+func (r *keyedRepo) SwarmKey() ([]byte, error) {
+	return []byte("/key/swarm/psk/1.0.0/\n/base16/\n" + hex.EncodeToString(r.swarmKey)), nil
+}
+
+// SpawnNetwork starts n nodes with in-memory repos listening on localhost,
+// all sharing a freshly generated swarm key, and connects every node to every
+// other one. The network has to be closed after use.
+func SpawnNetwork(n int) (*Network, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid network size %d", n)
+	}
+	swarmKey := make([]byte, 32)
+	if _, err := rand.Read(swarmKey); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	network := &Network{SwarmKey: swarmKey, cancel: cancel}
+
+	for i := 0; i < n; i++ {
+		node, err := spawnNode(ctx, swarmKey)
+		if err != nil {
+			network.Close()
+			return nil, fmt.Errorf("node %d: %v", i, err)
+		}
+		network.Nodes = append(network.Nodes, node)
+	}
+	if err := network.mesh(ctx); err != nil {
+		network.Close()
+		return nil, err
+	}
+	return network, nil
+}
+
+// spawnNode starts a single node of the network.
+func spawnNode(ctx context.Context, swarmKey []byte) (*Node, error) {
+	identity, err := config.CreateIdentity(ioutil.Discard, []options.KeyGenerateOption{options.Key.Type(options.Ed25519Key)})
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.InitWithIdentity(identity)
+	if err != nil {
+		return nil, err
+	}
+	if err := ephemeralConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	r := &keyedRepo{
+		Mock: &repo.Mock{
+			C: *cfg,
+			D: dsync.MutexWrap(datastore.NewMapDatastore()),
+			K: keystore.NewMemKeystore(),
+		},
+		swarmKey: swarmKey,
+	}
+	node, err := core.NewNode(ctx, &core.BuildCfg{
+		Online:  true,
+		Routing: libp2p.DHTOption,
+		Repo:    r,
+		ExtraOpts: map[string]bool{
+			"pubsub": true,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	api, err := coreapi.NewCoreAPI(node)
+	if err != nil {
+		node.Close()
+		return nil, err
+	}
+	return &Node{
+		ID:    node.Identity,
+		Addrs: node.PeerHost.Addrs(),
+		API:   api,
+		Node:  node,
+	}, nil
+}
+
+// ephemeralConfig applies the ethoFS test profile to the config of a node:
+// it listens on random localhost ports, announces and provides nothing, never
+// dials the production bootstrap nodes and runs none of the NAT services.
+func ephemeralConfig(cfg *config.Config) error {
+	if err := config.Profiles["test"].Transform(cfg); err != nil {
+		return err
+	}
+	cfg.Addresses.API = nil
+	cfg.Addresses.Gateway = nil
+	cfg.Addresses.Announce = nil
+
+	cfg.Experimental.StrategicProviding = true
+	cfg.Reprovider.Interval = "0"
+
+	cfg.Swarm.DisableRelay = true
+	cfg.Swarm.EnableAutoRelay = false
+	cfg.Swarm.EnableRelayHop = false
+	cfg.AutoNAT.ServiceMode = config.AutoNATServiceDisabled
+	return nil
+}
+
+// mesh connects every pair of nodes.
+func (n *Network) mesh(ctx context.Context) error {
+	for i, from := range n.Nodes {
+		for _, to := range n.Nodes[i+1:] {
+			if err := from.API.Swarm().Connect(ctx, peer.AddrInfo{ID: to.ID, Addrs: to.Addrs}); err != nil {
+				return fmt.Errorf("connecting %s to %s: %v", from.ID, to.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close stops all nodes of the network.
+func (n *Network) Close() error {
+	var err error
+	n.once.Do(func() {
+		for _, node := range n.Nodes {
+			if cerr := node.Node.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		n.cancel()
+	})
+	return err
+}
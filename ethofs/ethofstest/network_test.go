@@ -0,0 +1,47 @@
+package ethofstest
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+func TestSpawnNetwork(t *testing.T) {
+	network, err := SpawnNetwork(3)
+	if err != nil {
+		t.Fatalf("failed to spawn network: %v", err)
+	}
+	defer network.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for i, node := range network.Nodes {
+		// Simultaneous dials may leave several connections to the same peer
+		peers := node.Node.PeerHost.Network().Peers()
+		if len(peers) != len(network.Nodes)-1 {
+			t.Errorf("node %d: peer count mismatch: have %d, want %d", i, len(peers), len(network.Nodes)-1)
+		}
+	}
+	// Content added to one node has to be retrievable from the others
+	data := []byte("hello ethoFS devnet")
+	resolved, err := network.Nodes[0].API.Unixfs().Add(ctx, files.NewBytesFile(data))
+	if err != nil {
+		t.Fatalf("failed to add content: %v", err)
+	}
+	nd, err := network.Nodes[2].API.Unixfs().Get(ctx, resolved)
+	if err != nil {
+		t.Fatalf("failed to fetch content: %v", err)
+	}
+	have, err := ioutil.ReadAll(files.ToFile(nd))
+	if err != nil {
+		t.Fatalf("failed to read content: %v", err)
+	}
+	if !bytes.Equal(have, data) {
+		t.Errorf("content mismatch: have %q, want %q", have, data)
+	}
+}
@@ -0,0 +1,204 @@
+package ethofs
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// NodeStarted is posted once the supervised startup brought the ethoFS node
+// up, after any number of retries.
+type NodeStarted struct {
+	ID peer.ID `json:"id"`
+}
+
+// PeerConnected is posted when the first connection to a swarm peer is
+// established.
+type PeerConnected struct {
+	Peer      peer.ID `json:"peer"`
+	Address   string  `json:"address"`
+	Direction string  `json:"direction"`
+}
+
+// PeerDisconnected is posted when the last connection to a swarm peer is
+// closed.
+type PeerDisconnected struct {
+	Peer peer.ID `json:"peer"`
+}
+
+// ContentAdded is posted when content was added to the node.
+type ContentAdded struct {
+	Cid    cid.Cid `json:"cid"`
+	Pinned bool    `json:"pinned"`
+}
+
+// ContentPinned is posted when content was recursively pinned, whether by an
+// RPC call, an upload contract transaction or a replication.
+type ContentPinned struct {
+	Cid cid.Cid `json:"cid"`
+}
+
+// GCCompleted is posted after a garbage collection of the repo.
+type GCCompleted struct {
+	Size    uint64        `json:"size"` // Repo size after the collection
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// ReplicationFailed is posted when a quorum peer did not confirm holding
+// replicated content.
+type ReplicationFailed struct {
+	Cid   cid.Cid `json:"cid"`
+	Peer  peer.ID `json:"peer"`
+	Error string  `json:"error"`
+}
+
+// eventFeeds are the feeds of the ethoFS activity, one per event type.
+type eventFeeds struct {
+	nodeStarted       event.Feed
+	peerConnected     event.Feed
+	peerDisconnected  event.Feed
+	contentAdded      event.Feed
+	contentPinned     event.Feed
+	gcCompleted       event.Feed
+	replicationFailed event.Feed
+}
+
+// feeds is shared by the service and the package level pinning of the
+// uploads of the chain. Sends block until all subscribers received the
+// event, so subscribers have to keep up.
+var feeds eventFeeds
+
+// watchPeers posts the connection changes of the host's swarm peers.
+func watchPeers(h host.Host) {
+	h.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(n network.Network, c network.Conn) {
+			if len(n.ConnsToPeer(c.RemotePeer())) == 1 {
+				feeds.peerConnected.Send(PeerConnected{
+					Peer:      c.RemotePeer(),
+					Address:   c.RemoteMultiaddr().String(),
+					Direction: c.Stat().Direction.String(),
+				})
+			}
+		},
+		DisconnectedF: func(n network.Network, c network.Conn) {
+			if n.Connectedness(c.RemotePeer()) != network.Connected {
+				feeds.peerDisconnected.Send(PeerDisconnected{Peer: c.RemotePeer()})
+			}
+		},
+	})
+}
+
+// SubscribeNodeStarted registers a subscription of NodeStarted events.
+func (s *EthofsService) SubscribeNodeStarted(ch chan<- NodeStarted) event.Subscription {
+	return s.scope.Track(feeds.nodeStarted.Subscribe(ch))
+}
+
+// SubscribePeerConnected registers a subscription of PeerConnected events.
+func (s *EthofsService) SubscribePeerConnected(ch chan<- PeerConnected) event.Subscription {
+	return s.scope.Track(feeds.peerConnected.Subscribe(ch))
+}
+
+// SubscribePeerDisconnected registers a subscription of PeerDisconnected
+// events.
+func (s *EthofsService) SubscribePeerDisconnected(ch chan<- PeerDisconnected) event.Subscription {
+	return s.scope.Track(feeds.peerDisconnected.Subscribe(ch))
+}
+
+// SubscribeContentAdded registers a subscription of ContentAdded events.
+func (s *EthofsService) SubscribeContentAdded(ch chan<- ContentAdded) event.Subscription {
+	return s.scope.Track(feeds.contentAdded.Subscribe(ch))
+}
+
+// SubscribeContentPinned registers a subscription of ContentPinned events.
+func (s *EthofsService) SubscribeContentPinned(ch chan<- ContentPinned) event.Subscription {
+	return s.scope.Track(feeds.contentPinned.Subscribe(ch))
+}
+
+// SubscribeGCCompleted registers a subscription of GCCompleted events.
+func (s *EthofsService) SubscribeGCCompleted(ch chan<- GCCompleted) event.Subscription {
+	return s.scope.Track(feeds.gcCompleted.Subscribe(ch))
+}
+
+// SubscribeReplicationFailed registers a subscription of ReplicationFailed
+// events.
+func (s *EthofsService) SubscribeReplicationFailed(ch chan<- ReplicationFailed) event.Subscription {
+	return s.scope.Track(feeds.replicationFailed.Subscribe(ch))
+}
+
+// Event is the notification of the events RPC subscription.
+type Event struct {
+	Type  string      `json:"type"` // Name of the event type, e.g. "ContentPinned"
+	Event interface{} `json:"event"`
+}
+
+// Events creates an RPC subscription streaming all ethoFS events.
+func (api *PublicEthofsAPI) Events(ctx context.Context) (_ *rpc.Subscription, err error) {
+	defer trackCall("events", time.Now(), &err)
+
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	var (
+		nodeStarted       = make(chan NodeStarted)
+		peerConnected     = make(chan PeerConnected)
+		peerDisconnected  = make(chan PeerDisconnected)
+		contentAdded      = make(chan ContentAdded)
+		contentPinned     = make(chan ContentPinned)
+		gcCompleted       = make(chan GCCompleted)
+		replicationFailed = make(chan ReplicationFailed)
+	)
+	subs := []event.Subscription{
+		api.service.SubscribeNodeStarted(nodeStarted),
+		api.service.SubscribePeerConnected(peerConnected),
+		api.service.SubscribePeerDisconnected(peerDisconnected),
+		api.service.SubscribeContentAdded(contentAdded),
+		api.service.SubscribeContentPinned(contentPinned),
+		api.service.SubscribeGCCompleted(gcCompleted),
+		api.service.SubscribeReplicationFailed(replicationFailed),
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		defer func() {
+			for _, sub := range subs {
+				sub.Unsubscribe()
+			}
+		}()
+		for {
+			var ev Event
+			select {
+			case e := <-nodeStarted:
+				ev = Event{"NodeStarted", e}
+			case e := <-peerConnected:
+				ev = Event{"PeerConnected", e}
+			case e := <-peerDisconnected:
+				ev = Event{"PeerDisconnected", e}
+			case e := <-contentAdded:
+				ev = Event{"ContentAdded", e}
+			case e := <-contentPinned:
+				ev = Event{"ContentPinned", e}
+			case e := <-gcCompleted:
+				ev = Event{"GCCompleted", e}
+			case e := <-replicationFailed:
+				ev = Event{"ReplicationFailed", e}
+			case <-subs[0].Err():
+				// All subscriptions end together when the service stops
+				return
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+			notifier.Notify(rpcSub.ID, ev)
+		}
+	}()
+	return rpcSub, nil
+}
@@ -0,0 +1,33 @@
+package ethofs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventsAcrossRestart(t *testing.T) {
+	s := &EthofsService{config: DefaultConfig}
+
+	ch := make(chan GCCompleted, 1)
+	sub := s.SubscribeGCCompleted(ch)
+	defer sub.Unsubscribe()
+
+	// Restarts stop the service in-process, subscriptions outlive them
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	later := s.SubscribeGCCompleted(make(chan GCCompleted, 1))
+	if later == nil {
+		t.Fatal("no subscription after stop")
+	}
+	later.Unsubscribe()
+
+	feeds.gcCompleted.Send(GCCompleted{})
+	select {
+	case <-ch:
+	case err := <-sub.Err():
+		t.Fatalf("subscription ended by stop: %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("event not delivered after stop")
+	}
+}
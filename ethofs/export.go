@@ -0,0 +1,596 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	files "github.com/ipfs/go-ipfs-files"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipfscore "github.com/ipfs/go-ipfs/core"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	defaultExportRefresh = time.Minute
+
+	// exportTimeout bounds the materialization of a single tree.
+	exportTimeout = 30 * time.Minute
+)
+
+var (
+	errUnknownExport     = errors.New("unknown filesystem export")
+	errExportsDisabled   = errors.New("filesystem exports disabled, no export root configured")
+	errExportOutsideRoot = errors.New("export path outside the export root")
+	errRelativeExport    = errors.New("export path has to be absolute")
+	errExportPathExists  = errors.New("export path exists and is not an ethoFS export")
+	errExportNotWatched  = errors.New("only IPNS names can be watched")
+	errUnsafeExportEntry = errors.New("unsafe entry in exported tree")
+)
+
+// exportPrefix is the datastore namespace of the filesystem exports.
+var exportPrefix = datastore.NewKey("/ethofs/exports")
+
+// TreeExport describes a pinned DAG materialized to a local directory.
+type TreeExport struct {
+	Ref     string `json:"ref"`             // Exported CID, /ipfs/ or /ipns/ path
+	Path    string `json:"path"`            // Local directory holding the tree
+	Watch   bool   `json:"watch"`           // Follows the IPNS name of the ref
+	Root    string `json:"root"`            // CID of the materialized tree
+	Owned   bool   `json:"owned,omitempty"` // Root pinned by the export itself
+	Updated uint64 `json:"updated"`         // Unix time the tree was last written
+	Error   string `json:"error,omitempty"` // Reason the latest update failed
+}
+
+// exportStore keeps the exports in the repo datastore, keyed by their local
+// path. Only recorded exports are ever replaced on disk.
+type exportStore struct {
+	lock sync.Mutex
+	ds   datastore.Datastore
+}
+
+// treeExports is shared by the RPC API and the watcher of the running node.
+var treeExports = new(exportStore)
+
+func exportKey(p string) datastore.Key {
+	return exportPrefix.ChildString(hex.EncodeToString([]byte(p)))
+}
+
+// attach switches the store to the datastore of the running node.
+func (st *exportStore) attach(ds datastore.Datastore) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	st.ds = ds
+}
+
+// detach releases the datastore of the stopped node.
+func (st *exportStore) detach() {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	st.ds = nil
+}
+
+// get returns the export of the local path.
+func (st *exportStore) get(p string) (*TreeExport, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if st.ds == nil {
+		return nil, errNodeNotRunning
+	}
+	data, err := st.ds.Get(exportKey(p))
+	if err == datastore.ErrNotFound {
+		return nil, errUnknownExport
+	}
+	if err != nil {
+		return nil, err
+	}
+	export := new(TreeExport)
+	if err := json.Unmarshal(data, export); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// put stores the export.
+func (st *exportStore) put(export *TreeExport) error {
+	data, err := json.Marshal(export)
+	if err != nil {
+		return err
+	}
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if st.ds == nil {
+		return errNodeNotRunning
+	}
+	return st.ds.Put(exportKey(export.Path), data)
+}
+
+// remove drops the export of the local path.
+func (st *exportStore) remove(p string) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if st.ds == nil {
+		return errNodeNotRunning
+	}
+	return st.ds.Delete(exportKey(p))
+}
+
+// list returns the exports sorted by local path.
+func (st *exportStore) list() ([]*TreeExport, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if st.ds == nil {
+		return nil, errNodeNotRunning
+	}
+	results, err := st.ds.Query(query.Query{Prefix: exportPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var exports []*TreeExport
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		export := new(TreeExport)
+		if err := json.Unmarshal(result.Value, export); err != nil {
+			log.Debug("ethoFS - dropping corrupt filesystem export", "key", result.Key, "error", err)
+			continue
+		}
+		exports = append(exports, export)
+	}
+	sort.Slice(exports, func(i, j int) bool { return exports[i].Path < exports[j].Path })
+	return exports, nil
+}
+
+// cleanExportPath validates the local directory of an export. Relative paths
+// are refused, they would depend on the working directory of geth.
+func cleanExportPath(p string) (string, error) {
+	if !filepath.IsAbs(p) {
+		return "", errRelativeExport
+	}
+	cleaned := filepath.Clean(p)
+	if filepath.Dir(cleaned) == cleaned {
+		return "", fmt.Errorf("%w: %s", errExportPathExists, cleaned)
+	}
+	return cleaned, nil
+}
+
+// confineExport checks that the cleaned local directory of an export lies
+// below the export root, also after resolving the symlinks of the existing
+// directories leading to it.
+func confineExport(root, p string) error {
+	if root == "" {
+		return errExportsDisabled
+	}
+	if !belowDir(root, p) {
+		return fmt.Errorf("%w: %s", errExportOutsideRoot, p)
+	}
+	base, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(p)
+	for {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			if resolved != base && !belowDir(base, resolved) {
+				return fmt.Errorf("%w: %s", errExportOutsideRoot, p)
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// belowDir reports whether the path lies strictly below the directory.
+func belowDir(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// writeExportTree writes the unixfs node to the local filesystem at fpath,
+// world readable for the web server serving it. Entry names leaving their
+// directory and symlinks pointing outside the tree are refused, the DAG is
+// untrusted network content.
+func writeExportTree(ctx context.Context, nd files.Node, fpath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	switch nd := nd.(type) {
+	case *files.Symlink:
+		unsafe := strings.HasPrefix(nd.Target, "/")
+		for _, elem := range strings.Split(nd.Target, "/") {
+			unsafe = unsafe || elem == ".."
+		}
+		if unsafe {
+			return fmt.Errorf("%w: symlink %s to %s", errUnsafeExportEntry, fpath, nd.Target)
+		}
+		return os.Symlink(nd.Target, fpath)
+
+	case files.File:
+		f, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, nd); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+
+	case files.Directory:
+		if err := os.Mkdir(fpath, 0755); err != nil {
+			return err
+		}
+		entries := nd.Entries()
+		for entries.Next() {
+			name := entries.Name()
+			if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+				return fmt.Errorf("%w: %q in %s", errUnsafeExportEntry, name, fpath)
+			}
+			if err := writeExportTree(ctx, entries.Node(), filepath.Join(fpath, name)); err != nil {
+				return err
+			}
+		}
+		return entries.Err()
+	}
+	return fmt.Errorf("%w: %s of type %T", errUnsafeExportEntry, fpath, nd)
+}
+
+// replaceExportTree writes the node next to the local path and swaps it in,
+// so the web server never serves a partially written tree. The previous tree
+// is removed once the new one is in place, or restored if the swap fails.
+func replaceExportTree(ctx context.Context, nd files.Node, fpath string) error {
+	stage, err := ioutil.TempDir(filepath.Dir(fpath), "."+filepath.Base(fpath)+".export-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stage)
+
+	tree := filepath.Join(stage, "tree")
+	if err := writeExportTree(ctx, nd, tree); err != nil {
+		return err
+	}
+	previous := filepath.Join(stage, "previous")
+	if err := os.Rename(fpath, previous); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(tree, fpath); err != nil {
+		if rerr := os.Rename(previous, fpath); rerr != nil && !os.IsNotExist(rerr) {
+			log.Error("ethoFS - unable to restore previous export", "path", fpath, "error", rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// unexported reports whether nothing but an empty directory is at the local
+// path, which an export may take over.
+func unexported(fpath string) (bool, error) {
+	info, err := os.Lstat(fpath)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !info.IsDir() {
+		return false, nil
+	}
+	dir, err := os.Open(fpath)
+	if err != nil {
+		return false, err
+	}
+	defer dir.Close()
+
+	if _, err := dir.Readdirnames(1); err == io.EOF {
+		return true, nil
+	}
+	return false, err
+}
+
+// treeExporter materializes pinned DAGs to the local filesystem and re-exports
+// the watched ones when their IPNS names move. Exports are serialized by the
+// lock.
+type treeExporter struct {
+	ipfs     icore.CoreAPI
+	node     *ipfscore.IpfsNode
+	interval time.Duration
+	root     string // Directory the exports are confined to, empty if disabled
+	lock     sync.Mutex
+}
+
+func newTreeExporter(ipfs icore.CoreAPI, node *ipfscore.IpfsNode, interval time.Duration, root string) *treeExporter {
+	if interval == 0 {
+		interval = defaultExportRefresh
+	}
+	if root != "" {
+		root = filepath.Clean(root)
+	}
+	return &treeExporter{ipfs: ipfs, node: node, interval: interval, root: root}
+}
+
+// loop resolves the names of the watched exports on startup and every
+// interval after, until the context is cancelled.
+func (ex *treeExporter) loop(ctx context.Context) {
+	ticker := time.NewTicker(ex.interval)
+	defer ticker.Stop()
+
+	for {
+		exports, err := treeExports.list()
+		if err != nil {
+			log.Warn("ethoFS - unable to list filesystem exports", "error", err)
+		}
+		for _, export := range exports {
+			if !export.Watch {
+				continue
+			}
+			if err := ex.refresh(ctx, export.Path); err != nil && ctx.Err() == nil {
+				log.Debug("ethoFS - unable to update filesystem export", "path", export.Path, "ref", export.Ref, "error", err)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh updates a watched export with the root its name points at now,
+// recording the outcome.
+func (ex *treeExporter) refresh(ctx context.Context, p string) error {
+	ex.lock.Lock()
+	defer ex.lock.Unlock()
+
+	export, err := treeExports.get(p)
+	if err != nil {
+		return err
+	}
+	// Exports left outside a since changed root are no longer updated
+	if err := confineExport(ex.root, export.Path); err != nil {
+		return err
+	}
+	previous := export.Root
+	err = ex.export(ctx, export)
+	if err != nil {
+		export.Error = err.Error()
+	} else if export.Root != previous {
+		log.Info("ethoFS - filesystem export updated", "path", export.Path, "ref", export.Ref, "root", export.Root)
+	}
+	if perr := treeExports.put(export); perr != nil {
+		return perr
+	}
+	return err
+}
+
+// resolve returns the root the ref of the export points at, skipping the IPNS
+// cache so updates of watched names show up in time.
+func (ex *treeExporter) resolve(ctx context.Context, export *TreeExport) (cid.Cid, error) {
+	p := parsePath(export.Ref)
+	if err := p.IsValid(); err != nil {
+		return cid.Undef, err
+	}
+	if p.Namespace() == "ipns" {
+		resolved, err := ex.ipfs.Name().Resolve(ctx, p.String(), options.Name.Cache(false))
+		if err != nil {
+			return cid.Undef, err
+		}
+		p = resolved
+	} else if export.Watch {
+		return cid.Undef, errExportNotWatched
+	}
+	root, err := ex.ipfs.ResolvePath(ctx, p)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return root.Cid(), nil
+}
+
+// export writes the current root of the ref to the local path, unless it is
+// already there. The first root has to be pinned by the user, later roots of
+// a watched name are pinned by the export itself, replacing the previous one.
+func (ex *treeExporter) export(ctx context.Context, export *TreeExport) error {
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	root, err := ex.resolve(ctx, export)
+	if err != nil {
+		return err
+	}
+	if root.String() == export.Root {
+		if _, err := os.Lstat(export.Path); err == nil {
+			export.Error = ""
+			return nil
+		}
+	}
+	_, pinned, err := ex.node.Pinning.IsPinnedWithType(ctx, root, pin.Recursive)
+	if err != nil {
+		return err
+	}
+	var owned bool
+	if !pinned {
+		if !export.Watch || export.Root == "" {
+			return errNotPinned
+		}
+		if err := pinRecursive(ctx, ex.ipfs, root); err != nil {
+			return err
+		}
+		ownPin(root, pinOwnerExport)
+		owned = true
+	}
+	nd, err := ex.ipfs.Unixfs().Get(ctx, path.IpfsPath(root))
+	if err == nil {
+		err = replaceExportTree(ctx, nd, export.Path)
+		nd.Close()
+	}
+	if err != nil {
+		if owned {
+			ex.unpin(root.String())
+		}
+		return err
+	}
+	if root.String() != export.Root {
+		if export.Owned {
+			ex.unpin(export.Root)
+		}
+		export.Root, export.Owned = root.String(), owned
+	}
+	export.Updated, export.Error = uint64(time.Now().Unix()), ""
+	return nil
+}
+
+// unpin drops the pin of a root the export no longer serves.
+func (ex *treeExporter) unpin(c string) {
+	if _, err := pinRemove(ex.ipfs, c); err != nil {
+		log.Debug("ethoFS - unable to unpin exported root", "cid", c, "error", err)
+	}
+}
+
+// treeExporter returns the filesystem exporter of the running node, or nil if
+// it is stopped.
+func (s *EthofsService) treeExporter() *treeExporter {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.exports
+}
+
+// ExportTree materializes the pinned DAG of a CID, /ipfs/ or /ipns/ path to
+// the local directory, so conventional web servers can serve it from disk.
+// The directory has to lie below the configured export root and be missing,
+// empty or an earlier export. Watched exports follow the IPNS name of the ref,
+// replacing the tree whenever the name points at a new root.
+func (s *EthofsService) ExportTree(ctx context.Context, ref, localPath string, watch bool) (*TreeExport, error) {
+	ex := s.treeExporter()
+	if ex == nil {
+		return nil, errNodeNotRunning
+	}
+	p, err := cleanExportPath(localPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := confineExport(ex.root, p); err != nil {
+		return nil, err
+	}
+	ex.lock.Lock()
+	defer ex.lock.Unlock()
+
+	export, err := treeExports.get(p)
+	switch {
+	case err == errUnknownExport:
+		if free, err := unexported(p); err != nil {
+			return nil, err
+		} else if !free {
+			return nil, fmt.Errorf("%w: %s", errExportPathExists, p)
+		}
+		export = &TreeExport{Path: p}
+	case err != nil:
+		return nil, err
+	}
+	// A new ref starts over from a pinned root, releasing the root the export
+	// pinned while following the previous one
+	var stale string
+	if export.Ref != ref {
+		if export.Owned {
+			stale = export.Root
+		}
+		export.Root, export.Owned = "", false
+	}
+	export.Ref, export.Watch = ref, watch
+	if err := ex.export(ctx, export); err != nil {
+		return nil, err
+	}
+	if stale == export.Root {
+		export.Owned = stale != ""
+	} else if stale != "" {
+		ex.unpin(stale)
+	}
+	if err := treeExports.put(export); err != nil {
+		return nil, err
+	}
+	log.Info("ethoFS - exported tree to filesystem", "path", export.Path, "ref", export.Ref, "root", export.Root, "watch", watch)
+	return export, nil
+}
+
+// Exports returns the filesystem exports of the node.
+func (s *EthofsService) Exports() ([]*TreeExport, error) {
+	return treeExports.list()
+}
+
+// StopExport forgets the export of the local directory, which stops it from
+// following its IPNS name. The exported files are left on disk.
+func (s *EthofsService) StopExport(ctx context.Context, localPath string) error {
+	ex := s.treeExporter()
+	if ex == nil {
+		return errNodeNotRunning
+	}
+	p, err := cleanExportPath(localPath)
+	if err != nil {
+		return err
+	}
+	ex.lock.Lock()
+	defer ex.lock.Unlock()
+
+	export, err := treeExports.get(p)
+	if err != nil {
+		return err
+	}
+	if export.Owned {
+		ex.unpin(export.Root)
+	}
+	return treeExports.remove(p)
+}
+
+// Exports returns the filesystem exports of the node.
+func (api *PublicEthofsAPI) Exports() (_ []*TreeExport, err error) {
+	defer trackCall("exports", time.Now(), &err)
+
+	return api.service.Exports()
+}
+
+// ExportTree writes the pinned content of the ref to the local directory of
+// the node, optionally following its IPNS name.
+func (api *PrivateEthofsAPI) ExportTree(ctx context.Context, ref, localPath string, watch bool) (_ *TreeExport, err error) {
+	defer trackCall("exportTree", time.Now(), &err)
+
+	return api.service.ExportTree(ctx, ref, localPath, watch)
+}
+
+// StopExport forgets the export of the local directory, leaving its files.
+func (api *PrivateEthofsAPI) StopExport(ctx context.Context, localPath string) (err error) {
+	defer trackCall("stopExport", time.Now(), &err)
+
+	return api.service.StopExport(ctx, localPath)
+}
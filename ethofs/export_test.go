@@ -0,0 +1,148 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+func TestReplaceExportTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethofs-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	site := filepath.Join(dir, "site")
+	tree := func(index string) files.Node {
+		return files.NewMapDirectory(map[string]files.Node{
+			"index.html": files.NewBytesFile([]byte(index)),
+			"css": files.NewMapDirectory(map[string]files.Node{
+				"main.css": files.NewBytesFile([]byte("body {}")),
+			}),
+			"home.html": files.NewLinkFile("index.html", nil),
+		})
+	}
+	ctx := context.Background()
+	if err := replaceExportTree(ctx, tree("v1"), site); err != nil {
+		t.Fatal(err)
+	}
+	// Updates swap the whole tree, leaving no staging directories behind
+	if err := replaceExportTree(ctx, tree("v2"), site); err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]string{"index.html": "v2", "home.html": "v2", "css/main.css": "body {}"} {
+		data, err := ioutil.ReadFile(filepath.Join(site, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("exported %s mismatch: have %q, want %q", file, data, want)
+		}
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("staging left behind: %d entries", len(entries))
+	}
+	// Entries escaping the tree fail the export and keep the current one
+	for name, nd := range map[string]files.Node{
+		"parent entry":     files.NewMapDirectory(map[string]files.Node{"..": files.NewBytesFile(nil)}),
+		"absolute symlink": files.NewMapDirectory(map[string]files.Node{"passwd": files.NewLinkFile("/etc/passwd", nil)}),
+		"escaping symlink": files.NewMapDirectory(map[string]files.Node{"up": files.NewLinkFile("css/../../secret", nil)}),
+	} {
+		if err := replaceExportTree(ctx, nd, site); !errors.Is(err, errUnsafeExportEntry) {
+			t.Errorf("%s: have %v, want %v", name, err, errUnsafeExportEntry)
+		}
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(site, "index.html")); err != nil || string(data) != "v2" {
+		t.Errorf("failed export replaced tree: %q, %v", data, err)
+	}
+	// Only missing paths and empty directories may be taken over
+	empty := filepath.Join(dir, "empty")
+	if err := os.Mkdir(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]bool{filepath.Join(dir, "missing"): true, empty: true, site: false} {
+		if free, err := unexported(p); err != nil || free != want {
+			t.Errorf("path %s: free %v (%v), want %v", p, free, err, want)
+		}
+	}
+	for p, want := range map[string]error{"srv/www": errRelativeExport, "/": errExportPathExists, "/srv/www/": nil} {
+		if _, err := cleanExportPath(p); !errors.Is(err, want) {
+			t.Errorf("path %q: have %v, want %v", p, err, want)
+		}
+	}
+}
+
+func TestConfineExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethofs-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A symlink below the root must not lead exports out of it
+	if err := os.Symlink(dir, filepath.Join(root, "up")); err != nil {
+		t.Fatal(err)
+	}
+	if err := confineExport("", filepath.Join(root, "site")); err != errExportsDisabled {
+		t.Errorf("no root: have %v, want %v", err, errExportsDisabled)
+	}
+	for p, want := range map[string]error{
+		filepath.Join(root, "site"):             nil,
+		filepath.Join(root, "sites", "new"):     nil,
+		root:                                    errExportOutsideRoot,
+		filepath.Join(dir, "site"):              errExportOutsideRoot,
+		dir + "/root-sibling":                   errExportOutsideRoot,
+		filepath.Join(root, "up", "site"):       errExportOutsideRoot,
+		filepath.Join(root, "up", "root", "ok"): nil,
+	} {
+		if err := confineExport(root, p); !errors.Is(err, want) {
+			t.Errorf("path %q: have %v, want %v", p, err, want)
+		}
+	}
+}
+
+func TestExportStore(t *testing.T) {
+	st := new(exportStore)
+	if _, err := st.list(); err != errNodeNotRunning {
+		t.Fatalf("detached store: have %v, want %v", err, errNodeNotRunning)
+	}
+	st.attach(dsync.MutexWrap(datastore.NewMapDatastore()))
+
+	for _, export := range []*TreeExport{
+		{Ref: "/ipns/k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8", Path: "/srv/www/site", Watch: true},
+		{Ref: "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn", Path: "/srv/www/docs"},
+	} {
+		if err := st.put(export); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exports, err := st.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exports) != 2 || exports[0].Path != "/srv/www/docs" || !exports[1].Watch {
+		t.Errorf("exports mismatch: %+v", exports)
+	}
+	if err := st.remove("/srv/www/site"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.get("/srv/www/site"); err != errUnknownExport {
+		t.Errorf("removed export: have %v, want %v", err, errUnknownExport)
+	}
+}
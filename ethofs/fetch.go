@@ -0,0 +1,230 @@
+package ethofs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	// defaultFetchConcurrency is the number of blocks requested at once by a
+	// parallel fetch.
+	defaultFetchConcurrency = 16
+
+	// defaultFetchTimeout bounds the retrieval of a single block of a parallel
+	// fetch.
+	defaultFetchTimeout = 30 * time.Second
+
+	// maxFetchConcurrency caps the workers of a parallel fetch, bitswap gains
+	// nothing from more outstanding wants.
+	maxFetchConcurrency = 256
+)
+
+var (
+	fetchBlockMeter = metrics.NewRegisteredMeter("ethofs/fetch/blocks", nil)
+	fetchBytesMeter = metrics.NewRegisteredMeter("ethofs/fetch/bytes", nil)
+	fetchTimer      = metrics.NewRegisteredTimer("ethofs/fetch/duration", nil)
+)
+
+// FetchOptions controls a parallel fetch. Zero values fall back to the node
+// configuration.
+type FetchOptions struct {
+	Concurrency int           `json:"concurrency"` // Blocks requested at once
+	Timeout     time.Duration `json:"timeout"`     // Time each block may take to arrive
+}
+
+// withDefaults fills the unset options from the configuration.
+func (o FetchOptions) withDefaults(cfg *FetchConfig) FetchOptions {
+	if o.Concurrency <= 0 {
+		o.Concurrency = cfg.Concurrency
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = defaultFetchConcurrency
+	}
+	if o.Concurrency > maxFetchConcurrency {
+		o.Concurrency = maxFetchConcurrency
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = cfg.Timeout
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaultFetchTimeout
+	}
+	return o
+}
+
+// FetchStat summarizes a parallel fetch.
+type FetchStat struct {
+	Cid      string        `json:"cid"`
+	Blocks   uint64        `json:"blocks"`   // Blocks of the DAG
+	Size     uint64        `json:"size"`     // Total size of the blocks
+	Duration time.Duration `json:"duration"` // Time the fetch took
+}
+
+// fetchResult is a block retrieved by a fetch worker.
+type fetchResult struct {
+	links []*ipld.Link
+	size  int
+	err   error
+}
+
+// fetchDAG retrieves all blocks of the DAG below root with a pool of workers,
+// each requesting one block at a time. The links of every retrieved block are
+// queued right away, so the wants for a wide directory are all outstanding at
+// once instead of being walked one child after the other.
+func fetchDAG(ctx context.Context, getter ipld.NodeGetter, root cid.Cid, opts FetchOptions) (*FetchStat, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		jobs    = make(chan cid.Cid)
+		results = make(chan fetchResult)
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				res := fetchBlock(ctx, getter, c, opts.Timeout)
+				select {
+				case results <- res:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	// Workers blocked on sending a result only exit once the context is
+	// cancelled, so cancel before waiting for them
+	defer func() {
+		cancel()
+		close(jobs)
+		wg.Wait()
+	}()
+
+	var (
+		start    = time.Now()
+		stat     = &FetchStat{Cid: root.String()}
+		seen     = cid.NewSet()
+		queue    = []cid.Cid{root}
+		inflight int
+	)
+	seen.Add(root)
+	for len(queue) > 0 || inflight > 0 {
+		// Taking the newest links first walks the DAG depth first, keeping
+		// the queue short on deep trees
+		var (
+			send chan<- cid.Cid
+			next cid.Cid
+		)
+		if len(queue) > 0 {
+			send, next = jobs, queue[len(queue)-1]
+		}
+		select {
+		case send <- next:
+			queue = queue[:len(queue)-1]
+			inflight++
+
+		case res := <-results:
+			inflight--
+			if res.err != nil {
+				return nil, res.err
+			}
+			stat.Blocks++
+			stat.Size += uint64(res.size)
+			fetchBlockMeter.Mark(1)
+			fetchBytesMeter.Mark(int64(res.size))
+
+			for _, link := range res.links {
+				if seen.Visit(link.Cid) {
+					queue = append(queue, link.Cid)
+				}
+			}
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	stat.Duration = time.Since(start)
+	fetchTimer.Update(stat.Duration)
+	return stat, nil
+}
+
+// fetchBlock retrieves a single block, failing if it does not arrive within
+// the timeout.
+func fetchBlock(ctx context.Context, getter ipld.NodeGetter, c cid.Cid, timeout time.Duration) fetchResult {
+	blockCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	nd, err := getter.Get(blockCtx, c)
+	if err != nil {
+		if blockCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			err = fmt.Errorf("block %s not retrieved within %v: %w", c, timeout, err)
+		}
+		return fetchResult{err: err}
+	}
+	return fetchResult{links: nd.Links(), size: len(nd.RawData())}
+}
+
+// Fetch retrieves the complete DAG of the CID into the repo, requesting its
+// blocks from the swarm in parallel.
+func (s *EthofsService) Fetch(ctx context.Context, c cid.Cid, opts FetchOptions) (*FetchStat, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	if missingContent.has(c) {
+		return nil, errCachedNotFound
+	}
+	currentProviderHints().warm(ctx, c)
+
+	// A single session lets every worker ask the providers found so far
+	ses := merkledag.NewSession(ctx, node.DAG)
+	stat, err := fetchDAG(ctx, ses, c, opts.withDefaults(&s.config.Fetch))
+	missingContent.failed(c, err)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("ethoFS - fetched content", "cid", c, "blocks", stat.Blocks, "size", stat.Size, "elapsed", stat.Duration)
+	return stat, nil
+}
+
+// GetWithOptions retrieves the content of the CID like Unixfs().Get, but
+// fetches all of its blocks in parallel first. Reading large files and
+// directory trees from the returned node then never waits on the swarm.
+func (s *EthofsService) GetWithOptions(ctx context.Context, c cid.Cid, opts FetchOptions) (files.Node, error) {
+	ipfs := s.API()
+	if ipfs == nil {
+		return nil, errNodeNotRunning
+	}
+	if _, err := s.Fetch(ctx, c, opts); err != nil {
+		return nil, err
+	}
+	return ipfs.Unixfs().Get(ctx, path.IpfsPath(c))
+}
+
+// Fetch retrieves the complete content of the CID into the repo using parallel
+// block requests and returns its block count and size.
+func (api *PrivateEthofsAPI) Fetch(ctx context.Context, hash string, opts *FetchOptions) (_ *FetchStat, err error) {
+	defer trackCall("fetch", time.Now(), &err)
+
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = new(FetchOptions)
+	}
+	return api.service.Fetch(ctx, c, *opts)
+}
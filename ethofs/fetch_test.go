@@ -0,0 +1,127 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+// stallingGetter never delivers the stalled block.
+type stallingGetter struct {
+	ipld.NodeGetter
+	stalled cid.Cid
+}
+
+func (g *stallingGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	if c == g.stalled {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return g.NodeGetter.Get(ctx, c)
+}
+
+// failingGetter fails to deliver any block but the root, after a delay
+// letting every worker pick up a block.
+type failingGetter struct {
+	ipld.NodeGetter
+	root cid.Cid
+}
+
+func (g *failingGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	if c != g.root {
+		time.Sleep(10 * time.Millisecond)
+		return nil, errors.New("block unavailable")
+	}
+	return g.NodeGetter.Get(ctx, c)
+}
+
+func TestFetchDAG(t *testing.T) {
+	ctx := context.Background()
+	dag := mdtest.Mock()
+
+	// A two level tree with a leaf shared by both directories
+	var (
+		shared = merkledag.NodeWithData([]byte("shared"))
+		leaves []*merkledag.ProtoNode
+		root   = merkledag.NodeWithData(nil)
+		size   = len(shared.RawData())
+	)
+	for i := 0; i < 2; i++ {
+		dir := merkledag.NodeWithData([]byte{byte(i)})
+		for j := 0; j < 10; j++ {
+			leaf := merkledag.NodeWithData([]byte{byte(i), byte(j)})
+			leaves = append(leaves, leaf)
+			dir.AddNodeLink("", leaf)
+		}
+		dir.AddNodeLink("", shared)
+		for _, nd := range append(leaves[len(leaves)-10:], dir) {
+			if err := dag.Add(ctx, nd); err != nil {
+				t.Fatal(err)
+			}
+		}
+		root.AddNodeLink("", dir)
+		size += len(dir.RawData())
+	}
+	if err := dag.Add(ctx, shared); err != nil {
+		t.Fatal(err)
+	}
+	if err := dag.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	size += len(root.RawData())
+	for _, leaf := range leaves {
+		size += len(leaf.RawData())
+	}
+
+	for _, workers := range []int{1, 4, 64} {
+		stat, err := fetchDAG(ctx, dag, root.Cid(), FetchOptions{Concurrency: workers, Timeout: time.Second})
+		if err != nil {
+			t.Fatalf("%d workers: %v", workers, err)
+		}
+		if stat.Blocks != 24 || stat.Size != uint64(size) {
+			t.Errorf("%d workers: have %d blocks of %d bytes, want 24 of %d", workers, stat.Blocks, stat.Size, size)
+		}
+	}
+	// A block stuck in the swarm fails the fetch after the timeout
+	getter := &stallingGetter{NodeGetter: dag, stalled: leaves[3].Cid()}
+	if _, err := fetchDAG(ctx, getter, root.Cid(), FetchOptions{Concurrency: 4, Timeout: 50 * time.Millisecond}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("stalled fetch: have %v, want deadline exceeded", err)
+	}
+	// Failing workers blocked on reporting don't hang the failed fetch
+	wide := merkledag.NodeWithData(nil)
+	for _, leaf := range leaves {
+		wide.AddNodeLink("", leaf)
+	}
+	if err := dag.Add(ctx, wide); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := fetchDAG(ctx, &failingGetter{NodeGetter: dag, root: wide.Cid()}, wide.Cid(), FetchOptions{Concurrency: 4, Timeout: time.Second})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("fetch of unavailable blocks succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("failed fetch did not return")
+	}
+}
+
+func TestFetchOptionsDefaults(t *testing.T) {
+	cfg := &FetchConfig{Concurrency: 8}
+	if opts := (FetchOptions{}).withDefaults(cfg); opts.Concurrency != 8 || opts.Timeout != defaultFetchTimeout {
+		t.Errorf("defaults mismatch: %+v", opts)
+	}
+	if opts := (FetchOptions{Concurrency: 1000, Timeout: time.Second}).withDefaults(cfg); opts.Concurrency != maxFetchConcurrency || opts.Timeout != time.Second {
+		t.Errorf("explicit options mismatch: %+v", opts)
+	}
+}
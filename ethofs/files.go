@@ -0,0 +1,428 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	gopath "path"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	mfs "github.com/ipfs/go-mfs"
+	ft "github.com/ipfs/go-unixfs"
+)
+
+var (
+	errInvalidFilesPath = errors.New("files paths must start with a slash")
+	errNotMFSFile       = errors.New("not a file")
+	errNotMFSDirectory  = errors.New("not a directory")
+)
+
+// FileEntry is an entry of a directory in the mutable files tree.
+type FileEntry struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+}
+
+// FileStat describes a file or directory of the mutable files tree.
+type FileStat struct {
+	Hash           string `json:"hash"`
+	Type           string `json:"type"`
+	Size           uint64 `json:"size"`
+	CumulativeSize uint64 `json:"cumulativeSize"`
+}
+
+// FilesWriteOptions controls how FilesWrite modifies the target file.
+type FilesWriteOptions struct {
+	Create   bool  `json:"create"`   // Create the file if it does not exist
+	Parents  bool  `json:"parents"`  // Create missing parent directories
+	Truncate bool  `json:"truncate"` // Drop the old content before writing
+	Offset   int64 `json:"offset"`   // Byte offset to start writing at
+}
+
+// filesRoot returns the mutable files tree of the running node.
+func (s *EthofsService) filesRoot() (*mfs.Root, error) {
+	node := s.Node()
+	if node == nil || node.FilesRoot == nil {
+		return nil, errNodeNotRunning
+	}
+	return node.FilesRoot, nil
+}
+
+// FilesMkdir creates a directory in the mutable files tree, along with its
+// missing parents if requested.
+func (s *EthofsService) FilesMkdir(ctx context.Context, p string, parents bool) error {
+	root, err := s.filesRoot()
+	if err != nil {
+		return err
+	}
+	if p, err = cleanFilesPath(p); err != nil {
+		return err
+	}
+	return mfs.Mkdir(root, p, mfs.MkdirOpts{Mkparents: parents, Flush: true})
+}
+
+// FilesWrite writes the content of r into the file at the given path of the
+// mutable files tree.
+func (s *EthofsService) FilesWrite(ctx context.Context, p string, r io.Reader, opts FilesWriteOptions) (err error) {
+	root, err := s.filesRoot()
+	if err != nil {
+		return err
+	}
+	if p, err = cleanFilesPath(p); err != nil {
+		return err
+	}
+	if strings.HasSuffix(p, "/") {
+		return fmt.Errorf("%s: %v", p, errNotMFSFile)
+	}
+	if opts.Offset < 0 {
+		return fmt.Errorf("invalid write offset %d", opts.Offset)
+	}
+	if opts.Parents {
+		if dir := gopath.Dir(p); dir != "/" {
+			if err := mfs.Mkdir(root, dir, mfs.MkdirOpts{Mkparents: true}); err != nil {
+				return err
+			}
+		}
+	}
+	file, err := mfsFile(root, p, opts.Create)
+	if err != nil {
+		return err
+	}
+	fd, err := file.Open(mfs.Flags{Write: true, Sync: true})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := fd.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if opts.Truncate {
+		if err := fd.Truncate(0); err != nil {
+			return err
+		}
+	}
+	if _, err := fd.Seek(opts.Offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(fd, newLimitedReader(ctx, r))
+	return err
+}
+
+// FilesRead opens the file at the given path of the mutable files tree for
+// reading. The reader has to be closed after use.
+func (s *EthofsService) FilesRead(ctx context.Context, p string) (io.ReadCloser, error) {
+	root, err := s.filesRoot()
+	if err != nil {
+		return nil, err
+	}
+	if p, err = cleanFilesPath(p); err != nil {
+		return nil, err
+	}
+	file, err := mfsFile(root, p, false)
+	if err != nil {
+		return nil, err
+	}
+	return file.Open(mfs.Flags{Read: true})
+}
+
+// FilesLs lists the entries of a directory of the mutable files tree, or the
+// requested page of them. Listing a file returns the file itself.
+func (s *EthofsService) FilesLs(ctx context.Context, p string, page *PageOptions) ([]FileEntry, error) {
+	root, err := s.filesRoot()
+	if err != nil {
+		return nil, err
+	}
+	if p, err = cleanFilesPath(p); err != nil {
+		return nil, err
+	}
+	fsn, err := mfs.Lookup(root, p)
+	if err != nil {
+		return nil, err
+	}
+	switch fsn := fsn.(type) {
+	case *mfs.Directory:
+		entries := make([]FileEntry, 0)
+		err := fsn.ForEachEntry(ctx, func(l mfs.NodeListing) error {
+			if page.match(l.Name) {
+				entries = append(entries, FileEntry{
+					Name: l.Name,
+					Type: mfsTypeName(mfs.NodeType(l.Type)),
+					Size: l.Size,
+					Hash: l.Hash,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		start, end := page.window(len(entries),
+			func(i int) string { return entries[i].Name },
+			func(i, j int) { entries[i], entries[j] = entries[j], entries[i] },
+		)
+		return entries[start:end], nil
+
+	case *mfs.File:
+		nd, err := fsn.GetNode()
+		if err != nil {
+			return nil, err
+		}
+		size, err := fsn.Size()
+		if err != nil {
+			return nil, err
+		}
+		return []FileEntry{{
+			Name: gopath.Base(p),
+			Type: mfsTypeName(mfs.TFile),
+			Size: size,
+			Hash: nd.Cid().String(),
+		}}, nil
+	}
+	return nil, fmt.Errorf("unknown files node type at %s", p)
+}
+
+// FilesStat returns the CID and sizes of a file or directory of the mutable
+// files tree.
+func (s *EthofsService) FilesStat(ctx context.Context, p string) (*FileStat, error) {
+	root, err := s.filesRoot()
+	if err != nil {
+		return nil, err
+	}
+	if p, err = cleanFilesPath(p); err != nil {
+		return nil, err
+	}
+	fsn, err := mfs.Lookup(root, p)
+	if err != nil {
+		return nil, err
+	}
+	nd, err := fsn.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	cumulative, err := nd.Size()
+	if err != nil {
+		return nil, err
+	}
+	stat := &FileStat{
+		Hash:           nd.Cid().String(),
+		Type:           mfsTypeName(fsn.Type()),
+		CumulativeSize: cumulative,
+	}
+	if file, ok := fsn.(*mfs.File); ok {
+		size, err := file.Size()
+		if err != nil {
+			return nil, err
+		}
+		stat.Size = uint64(size)
+	}
+	return stat, nil
+}
+
+// FilesCp copies content into the mutable files tree. The source is either
+// an ethoFS path (a CID, /ipfs/ or /ipns/ path) or a path within the tree. A
+// destination ending in a slash copies into that directory.
+func (s *EthofsService) FilesCp(ctx context.Context, src string, dst string) error {
+	root, err := s.filesRoot()
+	if err != nil {
+		return err
+	}
+	if dst, err = cleanFilesPath(dst); err != nil {
+		return err
+	}
+	nd, err := s.filesSource(ctx, root, src)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s: %v", src, err)
+	}
+	if strings.HasSuffix(dst, "/") {
+		dst += gopath.Base(strings.TrimRight(src, "/"))
+	}
+	if err := mfs.PutNode(root, dst, nd); err != nil {
+		return err
+	}
+	_, err = mfs.FlushPath(ctx, root, dst)
+	return err
+}
+
+// FilesFlush persists the changes below the given path of the mutable files
+// tree and returns the resulting CID. Flushing "/" returns the root CID of the
+// whole tree, ready to be pinned or published under an IPNS name.
+func (s *EthofsService) FilesFlush(ctx context.Context, p string) (cid.Cid, error) {
+	root, err := s.filesRoot()
+	if err != nil {
+		return cid.Undef, err
+	}
+	if p, err = cleanFilesPath(p); err != nil {
+		return cid.Undef, err
+	}
+	nd, err := mfs.FlushPath(ctx, root, p)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return nd.Cid(), nil
+}
+
+// filesSource resolves the source of a copy to its DAG node.
+func (s *EthofsService) filesSource(ctx context.Context, root *mfs.Root, src string) (ipld.Node, error) {
+	if !strings.HasPrefix(src, "/") || strings.HasPrefix(src, "/ipfs/") || strings.HasPrefix(src, "/ipns/") {
+		ipfs := s.API()
+		if ipfs == nil {
+			return nil, errNodeNotRunning
+		}
+		return ipfs.ResolveNode(ctx, parsePath(src))
+	}
+	p, err := cleanFilesPath(src)
+	if err != nil {
+		return nil, err
+	}
+	fsn, err := mfs.Lookup(root, p)
+	if err != nil {
+		return nil, err
+	}
+	return fsn.GetNode()
+}
+
+// mfsFile looks up the file at the given path, creating an empty one in an
+// existing parent directory if requested.
+func mfsFile(root *mfs.Root, p string, create bool) (*mfs.File, error) {
+	fsn, err := mfs.Lookup(root, p)
+	switch {
+	case err == nil:
+		file, ok := fsn.(*mfs.File)
+		if !ok {
+			return nil, fmt.Errorf("%s: %v", p, errNotMFSFile)
+		}
+		return file, nil
+
+	case err == os.ErrNotExist && create:
+		dirname, name := gopath.Split(p)
+		parent, err := mfs.Lookup(root, dirname)
+		if err != nil {
+			return nil, err
+		}
+		dir, ok := parent.(*mfs.Directory)
+		if !ok {
+			return nil, fmt.Errorf("%s: %v", dirname, errNotMFSDirectory)
+		}
+		nd := merkledag.NodeWithData(ft.FilePBData(nil, 0))
+		nd.SetCidBuilder(dir.GetCidBuilder())
+		if err := dir.AddChild(name, nd); err != nil {
+			return nil, err
+		}
+		child, err := dir.Child(name)
+		if err != nil {
+			return nil, err
+		}
+		file, ok := child.(*mfs.File)
+		if !ok {
+			return nil, fmt.Errorf("%s: %v", p, errNotMFSFile)
+		}
+		return file, nil
+	}
+	return nil, err
+}
+
+// cleanFilesPath validates and normalizes a path of the mutable files tree,
+// keeping a trailing slash to mark directory targets.
+func cleanFilesPath(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", errInvalidFilesPath
+	}
+	cleaned := gopath.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned, nil
+}
+
+// mfsTypeName returns the textual kind of a files tree node.
+func mfsTypeName(t mfs.NodeType) string {
+	if t == mfs.TDir {
+		return "directory"
+	}
+	return "file"
+}
+
+// FilesRead returns the content of a file of the mutable files tree.
+func (api *PublicEthofsAPI) FilesRead(ctx context.Context, p string) (_ hexutil.Bytes, err error) {
+	defer trackCall("filesRead", time.Now(), &err)
+
+	r, err := api.service.FilesRead(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	buf := new(bytes.Buffer)
+	if _, err := io.Copy(buf, io.LimitReader(r, maxGetSize+1)); err != nil {
+		return nil, err
+	}
+	if buf.Len() > maxGetSize {
+		return nil, fmt.Errorf("%w of %d bytes", errFileTooLarge, maxGetSize)
+	}
+	return buf.Bytes(), nil
+}
+
+// FilesLs lists a directory of the mutable files tree. With page options, a
+// page of the entries ordered by name is returned, the next one starting
+// after the name of the last entry.
+func (api *PublicEthofsAPI) FilesLs(ctx context.Context, p string, page *PageOptions) (_ []FileEntry, err error) {
+	defer trackCall("filesLs", time.Now(), &err)
+
+	return api.service.FilesLs(ctx, p, page)
+}
+
+// FilesStat describes a file or directory of the mutable files tree.
+func (api *PublicEthofsAPI) FilesStat(ctx context.Context, p string) (_ *FileStat, err error) {
+	defer trackCall("filesStat", time.Now(), &err)
+
+	return api.service.FilesStat(ctx, p)
+}
+
+// FilesMkdir creates a directory in the mutable files tree.
+func (api *PrivateEthofsAPI) FilesMkdir(ctx context.Context, p string, parents bool) (err error) {
+	defer trackCall("filesMkdir", time.Now(), &err)
+
+	return api.service.FilesMkdir(ctx, p, parents)
+}
+
+// FilesWrite writes the data into a file of the mutable files tree. Without
+// options the file and its parents are created and its content replaced.
+func (api *PrivateEthofsAPI) FilesWrite(ctx context.Context, p string, data hexutil.Bytes, opts *FilesWriteOptions) (err error) {
+	defer trackCall("filesWrite", time.Now(), &err)
+
+	if opts == nil {
+		opts = &FilesWriteOptions{Create: true, Parents: true, Truncate: true}
+	}
+	return api.service.FilesWrite(ctx, p, bytes.NewReader(data), *opts)
+}
+
+// FilesCp copies ethoFS content or a files tree path into the tree.
+func (api *PrivateEthofsAPI) FilesCp(ctx context.Context, src string, dst string) (err error) {
+	defer trackCall("filesCp", time.Now(), &err)
+
+	return api.service.FilesCp(ctx, src, dst)
+}
+
+// FilesFlush persists a path of the mutable files tree and returns its CID.
+func (api *PrivateEthofsAPI) FilesFlush(ctx context.Context, p string) (_ string, err error) {
+	defer trackCall("filesFlush", time.Now(), &err)
+
+	c, err := api.service.FilesFlush(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
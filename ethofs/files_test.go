@@ -0,0 +1,31 @@
+package ethofs
+
+import "testing"
+
+func TestCleanFilesPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		fail bool
+	}{
+		{path: "/", want: "/"},
+		{path: "/site/index.html", want: "/site/index.html"},
+		{path: "/site//assets/../index.html", want: "/site/index.html"},
+		{path: "/site/assets/", want: "/site/assets/"},
+		{path: "//", want: "/"},
+		{path: "site/index.html", fail: true},
+		{path: "", fail: true},
+	}
+	for i, tt := range tests {
+		have, err := cleanFilesPath(tt.path)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: expected error for %q", i, tt.path)
+			}
+			continue
+		}
+		if err != nil || have != tt.want {
+			t.Errorf("test %d: have %q (%v), want %q", i, have, err, tt.want)
+		}
+	}
+}
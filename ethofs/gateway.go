@@ -0,0 +1,121 @@
+package ethofs
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// defaultGatewayAddr is the address gateway nodes serve the HTTP gateway on
+// unless configured otherwise.
+const defaultGatewayAddr = "/ip4/0.0.0.0/tcp/80"
+
+// gatewayMultiaddr converts a host:port bind address into a TCP multiaddr.
+// Addresses starting with a slash are taken as multiaddrs already.
+func gatewayMultiaddr(addr string) (string, error) {
+	if strings.HasPrefix(addr, "/") {
+		if _, err := ma.NewMultiaddr(addr); err != nil {
+			return "", err
+		}
+		return addr, nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return "", fmt.Errorf("invalid port %q", port)
+	}
+	if host == "" {
+		host = "0.0.0.0"
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address %q", host)
+	}
+	if ip.To4() != nil {
+		return "/ip4/" + ip.String() + "/tcp/" + port, nil
+	}
+	return "/ip6/" + ip.String() + "/tcp/" + port, nil
+}
+
+// normalizeWhitelistPath turns a bare CID into an /ipfs/ path and validates
+// that other entries are /ipfs/ or /ipns/ paths, optionally below the root.
+func normalizeWhitelistPath(p string) (string, error) {
+	p = strings.TrimSuffix(p, "/")
+	if c, err := cid.Decode(p); err == nil {
+		return "/ipfs/" + c.String(), nil
+	}
+	if _, root, _ := splitContentPath(p); root == "" {
+		return "", fmt.Errorf("invalid gateway path %q", p)
+	}
+	return p, nil
+}
+
+// pathWhitelist restricts the content served by the gateway to the listed
+// roots and the paths below them.
+type pathWhitelist []string
+
+func newPathWhitelist(paths []string) (pathWhitelist, error) {
+	list := make(pathWhitelist, 0, len(paths))
+	for _, p := range paths {
+		normalized, err := normalizeWhitelistPath(p)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, normalized)
+	}
+	return list, nil
+}
+
+// allowed reports whether the content path is covered by the whitelist.
+func (list pathWhitelist) allowed(p string) bool {
+	for _, prefix := range list {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// requestContentPath returns the content path a gateway request addresses, or
+// an empty string for requests not addressing content. Previews and thumbnails
+// address the content they are derived from.
+func requestContentPath(p string) string {
+	for _, prefix := range []string{previewPrefix, thumbnailPrefix} {
+		if strings.HasPrefix(p, prefix) {
+			p = "/ipfs/" + strings.TrimPrefix(p, prefix)
+		}
+	}
+	if _, root, _ := splitContentPath(p); root == "" {
+		return ""
+	}
+	return p
+}
+
+// pathWhitelistOption rejects requests for content outside of the whitelisted
+// paths. Requests not addressing content (e.g. the version endpoint) pass.
+func pathWhitelistOption(paths []string) corehttp.ServeOption {
+	return func(_ *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		list, err := newPathWhitelist(paths)
+		if err != nil {
+			return nil, err
+		}
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if p := requestContentPath(r.URL.Path); p != "" && !list.allowed(p) {
+				http.Error(w, "path not served by this gateway", http.StatusForbidden)
+				return
+			}
+			childMux.ServeHTTP(w, r)
+		})
+		return childMux, nil
+	}
+}
@@ -2,25 +2,171 @@ package ethofs
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 
+	humanize "github.com/dustin/go-humanize"
 	"github.com/ipfs/go-ipfs/core"
-	"github.com/ipfs/go-ipfs/core/corerepo"
 )
 
-func gc(node *core.IpfsNode) {
-	ctx, _ := context.WithTimeout(context.Background(), 100*time.Second)
+const (
+	defaultGCWatermark = 90
+	defaultGCPeriod    = time.Hour
 
-	log.Info("ethoFS - Garbage collection initiated")
+	// storageCheckInterval is how often the repo size is checked against the
+	// watermark between the periodic collections.
+	storageCheckInterval = 5 * time.Minute
+
+	gcTimeout = 30 * time.Minute
+)
+
+var errGCRunning = errors.New("garbage collection already running")
+
+var (
+	repoSizeGauge      = metrics.NewRegisteredGauge("ethofs/repo/size", nil)
+	repoGCMeter        = metrics.NewRegisteredMeter("ethofs/repo/gc", nil)
+	repoOverQuotaGauge = metrics.NewRegisteredGauge("ethofs/repo/overquota", nil)
+)
+
+// storageManager keeps the repo below its storage quota. It runs garbage
+// collection every period and as soon as the repo size exceeds the watermark
+// in between. GC only removes unpinned blocks, pinned content is never
+// dropped even if the repo stays over quota.
+type storageManager struct {
+	node      *core.IpfsNode
+	max       uint64 // storage quota in bytes
+	watermark uint64 // size triggering GC in bytes
+	period    time.Duration
 
-	go func(node *core.IpfsNode, ctx context.Context) {
-		err := corerepo.GarbageCollect(node, ctx)
-		if err != nil {
-			log.Debug("ethoFS - Error while collecting Garbage", "error", err)
-		} else {
-			log.Info("ethoFS - Garbage collection completed")
+	running int32 // set while a collection is in progress
+
+	lock sync.Mutex
+	last time.Time // End of the last collection, or the start of the manager
+}
+
+func newStorageManager(node *core.IpfsNode, cfg *Config) (*storageManager, error) {
+	repoCfg, err := node.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	max, err := humanize.ParseBytes(repoCfg.Datastore.StorageMax)
+	if err != nil {
+		return nil, err
+	}
+	watermark := cfg.GCWatermark
+	if watermark == 0 {
+		watermark = defaultGCWatermark
+	}
+	period := cfg.GCPeriod
+	if period == 0 {
+		period = defaultGCPeriod
+	}
+	return &storageManager{
+		node:      node,
+		max:       max,
+		watermark: max * uint64(watermark) / 100,
+		period:    period,
+		last:      time.Now(),
+	}, nil
+}
+
+// loop checks the repo size every storageCheckInterval, or every period if
+// shorter, until the context is cancelled.
+func (m *storageManager) loop(ctx context.Context) {
+	interval := storageCheckInterval
+	if m.period < interval {
+		interval = m.period
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.maybeGC(ctx); err != nil && err != errGCRunning {
+				log.Warn("ethoFS - garbage collection failed", "error", err)
+			}
+		case <-ctx.Done():
+			return
 		}
-	}(node, ctx)
+	}
+}
+
+// usage returns the current repo size.
+func (m *storageManager) usage() (uint64, error) {
+	size, err := m.node.Repo.GetStorageUsage()
+	if err != nil {
+		return 0, err
+	}
+	repoSizeGauge.Update(int64(size))
+	return size, nil
+}
+
+// maybeGC collects garbage if the repo size exceeds the watermark or a period
+// passed since the last collection.
+func (m *storageManager) maybeGC(ctx context.Context) error {
+	size, err := m.usage()
+	if err != nil {
+		return err
+	}
+	switch {
+	case size > m.watermark:
+		log.Info("ethoFS - storage watermark exceeded", "size", humanize.Bytes(size), "watermark", humanize.Bytes(m.watermark))
+	case m.due(time.Now()):
+		log.Debug("ethoFS - periodic garbage collection due", "size", humanize.Bytes(size))
+	default:
+		return nil
+	}
+	return m.gc(ctx)
+}
+
+// due reports whether a period passed since the last collection.
+func (m *storageManager) due(now time.Time) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return now.Sub(m.last) >= m.period
+}
+
+// gc runs a garbage collection, unless one is running already.
+func (m *storageManager) gc(ctx context.Context) (err error) {
+	if !atomic.CompareAndSwapInt32(&m.running, 0, 1) {
+		return errGCRunning
+	}
+	defer atomic.StoreInt32(&m.running, 0)
+	defer func(start time.Time) { history.record("gc", "", "", start, err) }(time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, gcTimeout)
+	defer cancel()
+
+	log.Info("ethoFS - Garbage collection initiated")
+	repoGCMeter.Mark(1)
+
+	start := time.Now()
+	if err := garbageCollect(ctx, m.node, currentDAGWorkers()); err != nil {
+		return err
+	}
+	size, err := m.usage()
+	if err != nil {
+		return err
+	}
+	m.lock.Lock()
+	m.last = time.Now()
+	m.lock.Unlock()
+
+	log.Info("ethoFS - Garbage collection completed", "size", humanize.Bytes(size), "elapsed", time.Since(start))
+	feeds.gcCompleted.Send(GCCompleted{Size: size, Elapsed: time.Since(start)})
+
+	if size > m.max {
+		repoOverQuotaGauge.Update(int64(size - m.max))
+		log.Warn("ethoFS - repo exceeds storage quota with pinned content only", "size", humanize.Bytes(size), "max", humanize.Bytes(m.max))
+	} else {
+		repoOverQuotaGauge.Update(0)
+	}
+	return nil
 }
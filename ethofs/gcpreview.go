@@ -0,0 +1,118 @@
+package ethofs
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs/core/corerepo"
+	"github.com/ipfs/go-ipfs/gc"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+// maxGCPreviewRoots caps the unpinned roots listed by a GC preview.
+const maxGCPreviewRoots = 1000
+
+// GCPreview is the outcome a garbage collection would have at the time of
+// the preview.
+type GCPreview struct {
+	Blocks    int      `json:"blocks"`    // Blocks the collection would remove
+	Size      uint64   `json:"size"`      // Bytes the collection would reclaim
+	Kept      int      `json:"kept"`      // Blocks kept for the pins and the mutable files tree
+	Roots     []string `json:"roots"`     // Tops of the unpinned DAGs that would disappear
+	MoreRoots int      `json:"moreRoots"` // Roots left out of the list
+}
+
+// gcPreview marks the blocks like the go-ipfs garbage collector and reports
+// the blocks it would sweep, without removing any.
+func gcPreview(ctx context.Context, bs blockstore.Blockstore, pinner pin.Pinner, bestEffortRoots []cid.Cid) (*GCPreview, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+
+	// The collector reports the individual unreachable links on the channel
+	// and fails with a summary error afterwards
+	results := make(chan gc.Result)
+	go func() {
+		for range results {
+		}
+	}()
+	kept, err := gc.ColoredSet(ctx, pinner, dag, bestEffortRoots, results)
+	close(results)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		preview = &GCPreview{Roots: []string{}}
+		removed []cid.Cid
+	)
+	for c := range keys {
+		if kept.Has(c) {
+			preview.Kept++
+			continue
+		}
+		size, err := bs.GetSize(c)
+		if err != nil {
+			return nil, err
+		}
+		preview.Blocks++
+		preview.Size += uint64(size)
+		removed = append(removed, c)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// The roots are the removed blocks no other removed block links to
+	children := cid.NewSet()
+	for _, c := range removed {
+		nd, err := dag.Get(ctx, c)
+		if err != nil {
+			continue // blocks of unknown formats have no known links
+		}
+		for _, link := range nd.Links() {
+			children.Add(link.Cid)
+		}
+	}
+	for _, c := range removed {
+		if !children.Has(c) {
+			preview.Roots = append(preview.Roots, c.String())
+		}
+	}
+	sort.Strings(preview.Roots)
+	if len(preview.Roots) > maxGCPreviewRoots {
+		preview.Roots, preview.MoreRoots = preview.Roots[:maxGCPreviewRoots], len(preview.Roots)-maxGCPreviewRoots
+	}
+	return preview, nil
+}
+
+// GCPreview reports the blocks and bytes a garbage collection would reclaim
+// and the unpinned DAGs that would disappear, so operators can review them
+// before collecting. Content added or pinned meanwhile changes the outcome.
+func (s *EthofsService) GCPreview(ctx context.Context) (*GCPreview, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	roots, err := corerepo.BestEffortRoots(node.FilesRoot)
+	if err != nil {
+		return nil, err
+	}
+	return gcPreview(ctx, node.Blockstore, node.Pinning, roots)
+}
+
+// GCPreview reports what a garbage collection of the repo would remove.
+func (api *PublicEthofsAPI) GCPreview(ctx context.Context) (_ *GCPreview, err error) {
+	defer trackCall("gcPreview", time.Now(), &err)
+
+	return api.service.GCPreview(ctx)
+}
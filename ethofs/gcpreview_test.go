@@ -0,0 +1,72 @@
+package ethofs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func TestGCPreview(t *testing.T) {
+	ctx := context.Background()
+	ds := dsync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockstore(ds)
+	dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	pinner := pin.NewPinner(ds, dag, dag)
+
+	var (
+		pinnedLeaf   = merkledag.NewRawNode([]byte("pinned leaf"))
+		pinned       = merkledag.NodeWithData([]byte("pinned"))
+		filesLeaf    = merkledag.NewRawNode([]byte("mutable files leaf"))
+		files        = merkledag.NodeWithData([]byte("files"))
+		unpinnedLeaf = merkledag.NewRawNode([]byte("unpinned leaf"))
+		sharedLeaf   = merkledag.NewRawNode([]byte("unpinned leaf shared"))
+		unpinned     = merkledag.NodeWithData([]byte("unpinned"))
+		loose        = merkledag.NewRawNode([]byte("loose block"))
+	)
+	links := []struct {
+		parent *merkledag.ProtoNode
+		child  ipld.Node
+	}{
+		{pinned, pinnedLeaf}, {files, filesLeaf}, {unpinned, unpinnedLeaf}, {unpinned, sharedLeaf}, {pinned, sharedLeaf},
+	}
+	for _, l := range links {
+		if err := l.parent.AddNodeLink(l.child.Cid().String(), l.child); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dag.AddMany(ctx, []ipld.Node{pinnedLeaf, pinned, filesLeaf, files, unpinnedLeaf, sharedLeaf, unpinned, loose}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pinner.Pin(ctx, pinned, true); err != nil {
+		t.Fatal(err)
+	}
+	preview, err := gcPreview(ctx, bs, pinner, []cid.Cid{files.Cid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := uint64(len(unpinned.RawData()) + len(unpinnedLeaf.RawData()) + len(loose.RawData()))
+	if preview.Blocks != 3 || preview.Size != size || preview.Kept != 5 {
+		t.Errorf("preview mismatch: have %+v, want 3 blocks of %d bytes removed, 5 kept", preview, size)
+	}
+	roots := []string{unpinned.Cid().String(), loose.Cid().String()}
+	if roots[0] > roots[1] {
+		roots[0], roots[1] = roots[1], roots[0]
+	}
+	if !reflect.DeepEqual(preview.Roots, roots) {
+		t.Errorf("roots mismatch: have %v, want %v", preview.Roots, roots)
+	}
+	// Previews never remove anything
+	if has, err := bs.Has(loose.Cid()); err != nil || !has {
+		t.Errorf("preview removed block: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// healthPath is where the health endpoint serves the report.
+const healthPath = "/healthz"
+
+// HealthStatus is the health report of the node, e.g. for monitoring hosting
+// nodes or restarting them when degraded.
+type HealthStatus struct {
+	Healthy      bool       `json:"healthy"`
+	Problems     []string   `json:"problems,omitempty"` // Reasons the node is unhealthy
+	State        string     `json:"state"`              // One of the Startup* states
+	Online       bool       `json:"online"`             // Attached to the swarm
+	RepoOK       bool       `json:"repoOk"`             // Repo readable
+	SwarmKey     bool       `json:"swarmKey"`           // Running in the private network
+	KeyMismatch  bool       `json:"keyMismatch"`        // Swarm key rejected by all reachable peers
+	Peers        int        `json:"peers"`              // Connected swarm peers
+	RoutingTable int        `json:"routingTable"`       // Peers in the DHT routing tables
+	PinQueue     int        `json:"pinQueue"`           // Imported blocks waiting to have their uploads pinned
+	LastGC       *Operation `json:"lastGC,omitempty"`   // Most recent garbage collection
+
+	// HostingReady is set while the node hosts the uploads of the hosting
+	// contract. A node without a chain backend keeps serving and pinning the
+	// content it holds, but is degraded: its contract sync waits for the
+	// backend to recover.
+	HostingReady bool         `json:"hostingReady"`
+	Degraded     []string     `json:"degraded,omitempty"` // Reasons the hosting is degraded
+	Chain        *ChainStatus `json:"chain,omitempty"`    // State of the chain backend
+}
+
+// Status checks the health of the node. Offline nodes are healthy without
+// peers.
+func (s *EthofsService) Status() *HealthStatus {
+	s.lock.Lock()
+	node, state, light := s.node, s.status.State, s.config.Light
+	queue := len(s.blocks)
+	s.lock.Unlock()
+
+	status := &HealthStatus{State: state, PinQueue: queue}
+	if gcs := history.list(&HistoryOptions{Type: "gc", Limit: 1}); len(gcs) > 0 {
+		status.LastGC = &gcs[0]
+	}
+	problem := func(format string, args ...interface{}) {
+		status.Problems = append(status.Problems, fmt.Sprintf(format, args...))
+	}
+	if node == nil {
+		problem("node %s", state)
+		return status
+	}
+	if _, err := node.Repo.GetStorageUsage(); err != nil {
+		problem("repo unreadable: %v", err)
+	} else {
+		status.RepoOK = true
+	}
+	if status.SwarmKey = node.PNetFingerprint != nil; !status.SwarmKey {
+		problem("no swarm key, node is outside the ethoFS network")
+	}
+	if status.Online = node.IsOnline; status.Online {
+		status.Peers = len(node.PeerHost.Network().Peers())
+		if err := dialFailures.swarmKeyMismatch(status.Peers); err != nil {
+			status.KeyMismatch = true
+			problem("%v, is the repo initialized for another network?", err)
+		} else if status.Peers == 0 {
+			problem("no swarm peers")
+		}
+		if node.DHT != nil {
+			status.RoutingTable = node.DHT.WAN.RoutingTable().Size() + node.DHT.LAN.RoutingTable().Size()
+			if status.RoutingTable == 0 {
+				problem("empty DHT routing table")
+			}
+		}
+	}
+	if clock := currentClockMonitor(); clock.skewed() {
+		problem("local clock off by %s", clock.status().Offset)
+	}
+	if queue == blockChanSize {
+		problem("pin queue full")
+	}
+	if status.LastGC != nil && status.LastGC.Error != "" {
+		problem("last garbage collection failed: %s", status.LastGC.Error)
+	}
+	if chain := currentChainBackend(); chain != nil {
+		status.Chain = chain.status()
+		if !status.Chain.Available {
+			status.Degraded = append(status.Degraded, fmt.Sprintf("chain backend unavailable: %s", status.Chain.Error))
+		} else if status.Chain.Stale {
+			status.Degraded = append(status.Degraded, fmt.Sprintf("chain head %d outdated, is the chain syncing?", status.Chain.Head))
+		}
+		if status.Chain.Queued > 0 {
+			status.Degraded = append(status.Degraded, fmt.Sprintf("%d contract sync tasks queued", status.Chain.Queued))
+		}
+	}
+	status.HostingReady = !light && status.Online && len(status.Degraded) == 0
+	status.Healthy = len(status.Problems) == 0
+	return status
+}
+
+// Status returns the health report of the node.
+func (api *PublicEthofsAPI) Status() *HealthStatus {
+	return api.service.Status()
+}
+
+// healthServer serves the health report over HTTP, answering 200 if the node
+// is healthy and 503 otherwise.
+type healthServer struct {
+	server *http.Server
+	addr   net.Addr
+}
+
+// startHealthServer opens the health endpoint of the service.
+func startHealthServer(addr string, s *EthofsService) (*healthServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(healthPath, func(w http.ResponseWriter, r *http.Request) {
+		status := s.Status()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !status.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+	h := &healthServer{server: &http.Server{Handler: mux}, addr: listener.Addr()}
+	go h.server.Serve(listener)
+
+	log.Info("ethoFS - health endpoint opened", "url", fmt.Sprintf("http://%v%s", listener.Addr(), healthPath))
+	return h, nil
+}
+
+// stop closes the health endpoint.
+func (h *healthServer) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	h.server.Shutdown(ctx)
+}
@@ -0,0 +1,72 @@
+package ethofs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHealthStatusStopped(t *testing.T) {
+	s := &EthofsService{config: DefaultConfig, status: StartupStatus{State: StartupStopped}}
+
+	status := s.Status()
+	if status.Healthy || status.State != StartupStopped {
+		t.Errorf("stopped node reported healthy: %+v", status)
+	}
+	if len(status.Problems) != 1 || status.Problems[0] != "node stopped" {
+		t.Errorf("problems mismatch: %v", status.Problems)
+	}
+}
+
+func TestHealthStatusRunning(t *testing.T) {
+	s, stop := newTestService(t)
+	defer stop()
+	s.status = StartupStatus{State: StartupRunning}
+
+	// The test node runs outside the ethoFS network and without peers
+	status := s.Status()
+	if !status.Online || !status.RepoOK || status.SwarmKey || status.Peers != 0 {
+		t.Errorf("node state mismatch: %+v", status)
+	}
+	if status.Healthy {
+		t.Error("node without swarm key and peers reported healthy")
+	}
+	for _, want := range []string{"no swarm key", "no swarm peers"} {
+		found := false
+		for _, problem := range status.Problems {
+			found = found || strings.HasPrefix(problem, want)
+		}
+		if !found {
+			t.Errorf("problem %q not reported: %v", want, status.Problems)
+		}
+	}
+}
+
+func TestHealthServer(t *testing.T) {
+	s := &EthofsService{config: DefaultConfig, status: StartupStatus{State: StartupStopped}}
+
+	h, err := startHealthServer("127.0.0.1:0", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.stop()
+
+	res, err := http.Get(fmt.Sprintf("http://%s%s", h.addr, healthPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status code mismatch: have %d, want %d", res.StatusCode, http.StatusServiceUnavailable)
+	}
+	var status HealthStatus
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		t.Fatalf("invalid report: %v", err)
+	}
+	if status.Healthy || status.State != StartupStopped {
+		t.Errorf("served report mismatch: %+v", status)
+	}
+}
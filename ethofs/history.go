@@ -0,0 +1,192 @@
+package ethofs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	datastore "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+)
+
+// maxHistory is the number of operations kept in the history, older ones are
+// dropped.
+const maxHistory = 1000
+
+// historyPrefix is the datastore namespace of the operation history, stored
+// in the repo to survive restarts.
+var historyPrefix = datastore.NewKey("/ethofs/history")
+
+// Operation is an entry of the operation history.
+type Operation struct {
+	Seq      uint64        `json:"seq"`
+	Type     string        `json:"type"`            // "add", "pin", "unpin", "gc" or "replicate"
+	Cid      string        `json:"cid,omitempty"`   // Content operated on
+	Peer     string        `json:"peer,omitempty"`  // Peer replicated to
+	Started  time.Time     `json:"started"`         // Start of the operation
+	Duration time.Duration `json:"duration"`        // Time the operation took
+	Error    string        `json:"error,omitempty"` // Failure of the operation, empty on success
+}
+
+// HistoryOptions filters the operations returned by History.
+type HistoryOptions struct {
+	Type   string `json:"type"`   // Only list operations of the type
+	Cid    string `json:"cid"`    // Only list operations on the CID
+	Failed bool   `json:"failed"` // Only list failed operations
+	Limit  int    `json:"limit"`  // Maximum number of operations, all if zero
+}
+
+// match reports whether the operation passes the filter.
+func (o *HistoryOptions) match(op *Operation) bool {
+	return (o.Type == "" || op.Type == o.Type) && (o.Cid == "" || op.Cid == o.Cid) && (!o.Failed || op.Error != "")
+}
+
+// opHistory is the bounded log of the recent adds, pins, garbage collections
+// and replications. Operations are persisted to the repo while the history is
+// attached to its datastore, and only kept in memory otherwise.
+type opHistory struct {
+	lock sync.Mutex
+	ds   datastore.Datastore
+	ops  []Operation // oldest first
+	seq  uint64
+}
+
+// history is shared by the service and the package level pinning of the
+// uploads of the chain.
+var history = new(opHistory)
+
+func historyKey(seq uint64) datastore.Key {
+	return historyPrefix.ChildString(fmt.Sprintf("%020d", seq))
+}
+
+// attach loads the history stored in the datastore and persists further
+// operations to it. Operations recorded while detached are appended to the
+// stored ones.
+func (h *opHistory) attach(ds datastore.Datastore) error {
+	results, err := ds.Query(query.Query{Prefix: historyPrefix.String()})
+	if err != nil {
+		return err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return err
+	}
+	stored := make([]Operation, 0, len(entries))
+	for _, entry := range entries {
+		var op Operation
+		if err := json.Unmarshal(entry.Value, &op); err != nil {
+			log.Warn("ethoFS - dropping corrupt history entry", "key", entry.Key, "error", err)
+			continue
+		}
+		stored = append(stored, op)
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].Seq < stored[j].Seq })
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	pending := h.ops
+	h.ds, h.ops, h.seq = ds, stored, 0
+	if len(stored) > 0 {
+		h.seq = stored[len(stored)-1].Seq
+	}
+	for _, op := range pending {
+		h.append(op)
+	}
+	h.prune()
+	return nil
+}
+
+// detach stops persisting operations, dropping the stored ones from memory
+// until the next attach loads them again.
+func (h *opHistory) detach() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.ds, h.ops, h.seq = nil, nil, 0
+}
+
+// record adds an operation that started at the given time and ended now with
+// the given outcome.
+func (h *opHistory) record(typ string, cid string, peer string, start time.Time, err error) {
+	op := Operation{Type: typ, Cid: cid, Peer: peer, Started: start, Duration: time.Since(start)}
+	if err != nil {
+		op.Error = err.Error()
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.append(op)
+	h.prune()
+}
+
+// append numbers and stores the operation. The lock has to be held.
+func (h *opHistory) append(op Operation) {
+	h.seq++
+	op.Seq = h.seq
+	h.ops = append(h.ops, op)
+
+	if h.ds == nil {
+		return
+	}
+	data, err := json.Marshal(op)
+	if err == nil {
+		err = h.ds.Put(historyKey(op.Seq), data)
+	}
+	if err != nil {
+		log.Warn("ethoFS - failed to persist operation history", "seq", op.Seq, "error", err)
+	}
+}
+
+// prune drops the operations exceeding the history size. The lock has to be
+// held.
+func (h *opHistory) prune() {
+	if len(h.ops) <= maxHistory {
+		return
+	}
+	drop := h.ops[:len(h.ops)-maxHistory]
+	if h.ds != nil {
+		for _, op := range drop {
+			if err := h.ds.Delete(historyKey(op.Seq)); err != nil {
+				log.Warn("ethoFS - failed to prune operation history", "seq", op.Seq, "error", err)
+			}
+		}
+	}
+	h.ops = append([]Operation(nil), h.ops[len(drop):]...)
+}
+
+// list returns the operations passing the filter, newest first.
+func (h *opHistory) list(opts *HistoryOptions) []Operation {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	ops := make([]Operation, 0)
+	for i := len(h.ops) - 1; i >= 0; i-- {
+		if opts.Limit > 0 && len(ops) >= opts.Limit {
+			break
+		}
+		if opts.match(&h.ops[i]) {
+			ops = append(ops, h.ops[i])
+		}
+	}
+	return ops
+}
+
+// History returns the recent operations of the node passing the filter,
+// newest first. A nil filter returns the whole history.
+func (s *EthofsService) History(opts *HistoryOptions) []Operation {
+	if opts == nil {
+		opts = new(HistoryOptions)
+	}
+	return history.list(opts)
+}
+
+// History returns the recent adds, pins, garbage collections and replications
+// of the node with their outcomes, newest first.
+func (api *PublicEthofsAPI) History(opts *HistoryOptions) []Operation {
+	return api.service.History(opts)
+}
@@ -0,0 +1,56 @@
+package ethofs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+)
+
+func TestOperationHistory(t *testing.T) {
+	var (
+		ds    = datastore.NewMapDatastore()
+		h     = new(opHistory)
+		start = time.Now()
+	)
+	// Operations recorded before the repo is available are persisted later
+	h.record("pin", "QmA", "", start, errors.New("timeout"))
+	if err := h.attach(ds); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxHistory+10; i++ {
+		h.record("add", "QmB", "", start, nil)
+	}
+	h.record("replicate", "QmB", "peer", start, nil)
+
+	if ops := h.list(&HistoryOptions{}); len(ops) != maxHistory {
+		t.Fatalf("history size mismatch: have %d, want %d", len(ops), maxHistory)
+	}
+	if ops := h.list(&HistoryOptions{Type: "pin"}); len(ops) != 0 {
+		t.Errorf("pruned operation still listed: %+v", ops)
+	}
+	// A restarted node reloads the history from the repo
+	h.detach()
+	if ops := h.list(&HistoryOptions{}); len(ops) != 0 {
+		t.Fatalf("detached history not empty: %d operations", len(ops))
+	}
+	if err := h.attach(ds); err != nil {
+		t.Fatal(err)
+	}
+	ops := h.list(&HistoryOptions{Limit: 2})
+	if len(ops) != 2 || ops[0].Type != "replicate" || ops[0].Peer != "peer" || ops[1].Type != "add" {
+		t.Fatalf("reloaded history mismatch: %+v", ops)
+	}
+	if ops[0].Seq != maxHistory+12 || ops[1].Seq != maxHistory+11 {
+		t.Errorf("sequence numbers mismatch: have %d, %d", ops[0].Seq, ops[1].Seq)
+	}
+	h.record("unpin", "QmB", "", start, errors.New("not pinned"))
+	failed := h.list(&HistoryOptions{Failed: true})
+	if len(failed) != 1 || failed[0].Type != "unpin" || failed[0].Error != "not pinned" || failed[0].Seq != maxHistory+13 {
+		t.Errorf("failed operations mismatch: %+v", failed)
+	}
+	if n := len(h.list(&HistoryOptions{Cid: "QmB"})); n != maxHistory {
+		t.Errorf("operations on CID mismatch: have %d, want %d", n, maxHistory)
+	}
+}
@@ -0,0 +1,273 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
+)
+
+const (
+	// hostingReportVersion is the format of the hosting report documents.
+	hostingReportVersion = 1
+
+	// hostingReportLookups is the number of provider lookups run at once.
+	hostingReportLookups = 8
+
+	// hostingReportLookupTimeout bounds the replica count of a single CID, in
+	// seconds.
+	hostingReportLookupTimeout = 5
+)
+
+var errInvalidReportSigner = errors.New("hosting report not signed by its signer")
+
+// HostedContent is an entry of a hosting report: a CID of the hosting
+// contract pinned by the node.
+type HostedContent struct {
+	Cid        string `json:"cid"`
+	Size       uint64 `json:"size"`            // Total size of the unique blocks of the DAG
+	Blocks     uint64 `json:"blocks"`          // Number of unique blocks of the DAG
+	Replicas   int    `json:"replicas"`        // Copies on the network known to the routing system, counting the local one
+	Hosted     bool   `json:"hosted"`          // Spot check of the DAG passed
+	VerifiedAt uint64 `json:"verifiedAt"`      // Unix time of the spot check
+	Error      string `json:"error,omitempty"` // Reason the spot check failed
+}
+
+// HostingReport is a signed statement of a node about the content it hosts
+// for the hosting contract, for explorers and auditors of the network. The
+// signer signs the Keccak256 hash of the report encoded as compact JSON
+// without the signature field, see SigningHash.
+type HostingReport struct {
+	Version   int             `json:"version"`
+	Node      string          `json:"node"`      // Peer ID of the reporting node
+	Signer    common.Address  `json:"signer"`    // Keystore account signing the report
+	Block     uint64          `json:"block"`     // Chain head the contract was read at
+	Timestamp uint64          `json:"timestamp"` // Unix time of the report
+	Content   []HostedContent `json:"content"`
+	Signature hexutil.Bytes   `json:"signature,omitempty"` // EIP-191 signature of the signing hash by the signer
+}
+
+// HostingReportOptions selects the account signing a hosting report.
+type HostingReportOptions struct {
+	Signer     common.Address `json:"signer"`     // Keystore account signing the report
+	Passphrase string         `json:"passphrase"` // Unlocks the signer account, which has to be unlocked already if empty
+}
+
+// SigningHash returns the hash the signer signs: the Keccak256 hash of the
+// compact JSON encoding of the report without its signature, keeping the
+// field order of the document and leaving HTML characters unescaped.
+func (r *HostingReport) SigningHash() (common.Hash, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(&unsigned); err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))), nil
+}
+
+// Verify checks that the report is signed by its signer.
+func (r *HostingReport) Verify() error {
+	if len(r.Signature) != crypto.SignatureLength {
+		return errInvalidReportSigner
+	}
+	sig := common.CopyBytes(r.Signature)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27 // Accept signatures in the personal_sign format
+	}
+	hash, err := r.SigningHash()
+	if err != nil {
+		return err
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash(hash[:]), sig)
+	if err != nil {
+		return err
+	}
+	if crypto.PubkeyToAddress(*pub) != r.Signer {
+		return errInvalidReportSigner
+	}
+	return nil
+}
+
+// sign signs the report with the wallet holding the signer.
+func (r *HostingReport) sign(wallet accounts.Wallet, passphrase string) error {
+	hash, err := r.SigningHash()
+	if err != nil {
+		return err
+	}
+	account := accounts.Account{Address: r.Signer}
+	var sig []byte
+	if passphrase != "" {
+		sig, err = wallet.SignTextWithPassphrase(account, passphrase, hash[:])
+	} else {
+		sig, err = wallet.SignText(account, hash[:])
+	}
+	if err != nil {
+		return err
+	}
+	r.Signature = sig
+	return nil
+}
+
+// hostedContent describes the locally pinned DAG of a contract CID, spot
+// checking it with the given randomness.
+func hostedContent(ctx context.Context, node *core.IpfsNode, c cid.Cid, samples int, rnd *rand.Rand) HostedContent {
+	entry := HostedContent{Cid: c.String()}
+
+	_, err := spotCheck(ctx, node.Blockstore, c, samples, rnd)
+	entry.Hosted, entry.VerifiedAt = err == nil, uint64(time.Now().Unix())
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	err = walkBlocks(ctx, node.Blockstore, c, func(c cid.Cid, key string) bool {
+		size, err := node.Blockstore.GetSize(c)
+		if err == nil {
+			entry.Size += uint64(size)
+			entry.Blocks++
+		}
+		return err == nil
+	})
+	if err != nil {
+		entry.Hosted, entry.Error = false, err.Error()
+	}
+	return entry
+}
+
+// countReplicas fills in the replica counts of the entries, running a few
+// provider lookups at once. Lookups of offline nodes only count the local
+// copies.
+func countReplicas(ctx context.Context, node *core.IpfsNode, content []HostedContent) {
+	var (
+		slots = make(chan struct{}, hostingReportLookups)
+		wg    sync.WaitGroup
+	)
+	for i := range content {
+		if content[i].Hosted {
+			content[i].Replicas = 1
+		}
+		if !node.IsOnline {
+			continue
+		}
+		c, err := cid.Decode(content[i].Cid)
+		if err != nil {
+			continue
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(entry *HostedContent) {
+			defer func() { <-slots; wg.Done() }()
+
+			records, err := providers(ctx, node, c, ProviderOptions{Timeout: hostingReportLookupTimeout})
+			if err != nil {
+				log.Debug("ethoFS - replica lookup failed", "cid", c, "error", err)
+				return
+			}
+			entry.Replicas = len(records.Providers)
+			if entry.Hosted {
+				entry.Replicas++
+			}
+		}(&content[i])
+	}
+	wg.Wait()
+}
+
+// HostingReport lists the CIDs of the hosting contract pinned by the node,
+// with their sizes, replica counts and the results of fresh spot checks,
+// signed by the given keystore account.
+func (s *EthofsService) HostingReport(ctx context.Context, opts HostingReportOptions) (*HostingReport, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	if err := checkSigningClock(); err != nil {
+		return nil, err
+	}
+	wallet, err := s.stack.AccountManager().Find(accounts.Account{Address: opts.Signer})
+	if err != nil {
+		return nil, err
+	}
+	head, err := pinExpiries.currentHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pins, _, err := s.ContractPins(ctx)
+	if err != nil {
+		return nil, err
+	}
+	samples := s.config.Verifier.Samples
+	if samples == 0 {
+		samples = defaultVerifySamples
+	}
+	var (
+		rnd     = rand.New(rand.NewSource(time.Now().UnixNano()))
+		seen    = make(map[cid.Cid]struct{})
+		content = make([]HostedContent, 0)
+	)
+	sortCids(pins)
+	for _, c := range pins {
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+		if pinned, err := localPins.has(c); err != nil {
+			return nil, err
+		} else if !pinned {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		content = append(content, hostedContent(ctx, node, c, samples, rnd))
+	}
+	countReplicas(ctx, node, content)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	report := &HostingReport{
+		Version:   hostingReportVersion,
+		Node:      node.Identity.Pretty(),
+		Signer:    opts.Signer,
+		Block:     head,
+		Timestamp: uint64(time.Now().Unix()),
+		Content:   content,
+	}
+	if err := report.sign(wallet, opts.Passphrase); err != nil {
+		return nil, err
+	}
+	log.Info("ethoFS - hosting report signed", "signer", opts.Signer, "block", head, "content", len(content))
+	return report, nil
+}
+
+// VerifyHostingReport checks that the hosting report is signed by its signer.
+func (api *PublicEthofsAPI) VerifyHostingReport(report HostingReport) (_ bool, err error) {
+	defer trackCall("verifyHostingReport", time.Now(), &err)
+
+	if err := report.Verify(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// HostingReport returns a signed report of the content the node hosts for the
+// hosting contract.
+func (api *PrivateEthofsAPI) HostingReport(ctx context.Context, opts HostingReportOptions) (_ *HostingReport, err error) {
+	defer trackCall("hostingReport", time.Now(), &err)
+
+	return api.service.HostingReport(ctx, opts)
+}
@@ -0,0 +1,51 @@
+package ethofs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestHostingReportSignature(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	report := &HostingReport{
+		Version:   hostingReportVersion,
+		Node:      "QmNode",
+		Signer:    crypto.PubkeyToAddress(key.PublicKey),
+		Block:     100,
+		Timestamp: 1600000000,
+		Content: []HostedContent{
+			{Cid: "QmHosted", Size: 1024, Blocks: 4, Replicas: 3, Hosted: true, VerifiedAt: 1600000000},
+			{Cid: "QmBroken", Error: "block <missing> & corrupt", VerifiedAt: 1600000000},
+		},
+	}
+	hash, err := report.SigningHash()
+	if err != nil {
+		t.Fatalf("failed to hash report: %v", err)
+	}
+	if report.Signature, err = crypto.Sign(accounts.TextHash(hash[:]), key); err != nil {
+		t.Fatalf("failed to sign report: %v", err)
+	}
+	if err := report.Verify(); err != nil {
+		t.Fatalf("failed to verify report: %v", err)
+	}
+	// The signature has to survive the JSON round trip of the document
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("failed to encode report: %v", err)
+	}
+	var decoded HostingReport
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if err := decoded.Verify(); err != nil {
+		t.Errorf("decoded report verification failed: %v", err)
+	}
+	// Tampered reports are rejected
+	decoded.Content[0].Replicas++
+	if err := decoded.Verify(); err != errInvalidReportSigner {
+		t.Errorf("tampered report verification mismatch: have %v, want %v", err, errInvalidReportSigner)
+	}
+}
@@ -0,0 +1,89 @@
+package ethofs
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ipfs/go-ipfs/core"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+)
+
+// ErrNotReady is returned by Instance while no ethoFS node is running.
+var ErrNotReady = errors.New("ethoFS node not ready")
+
+// ErrStarting is returned to callers initializing the ethoFS repo or node
+// while another initialization of it is in progress.
+var ErrStarting = errors.New("ethoFS node initialization in progress")
+
+// NotReadyError reports the startup state of the ethoFS node while it is not
+// running. It matches ErrNotReady with errors.Is, and ErrStarting during the
+// startup.
+type NotReadyError struct {
+	Status StartupStatus
+}
+
+func (e *NotReadyError) Error() string {
+	if e.Status.Error != "" {
+		return fmt.Sprintf("%v (%s: %s)", ErrNotReady, e.Status.State, e.Status.Error)
+	}
+	return fmt.Sprintf("%v (%s)", ErrNotReady, e.Status.State)
+}
+
+func (e *NotReadyError) Unwrap() error {
+	return ErrNotReady
+}
+
+// Is matches ErrStarting while the node is still starting.
+func (e *NotReadyError) Is(target error) bool {
+	return target == ErrStarting && e.Status.State == StartupStarting
+}
+
+// Ethofs is the running embedded ethoFS node. It stays valid until the node
+// is stopped, after which its calls fail.
+type Ethofs struct {
+	API  icore.CoreAPI
+	Node *core.IpfsNode
+}
+
+var (
+	instanceLock   sync.RWMutex
+	instance       *Ethofs
+	instanceStatus = StartupStatus{State: StartupStopped}
+)
+
+// Instance returns the running ethoFS node, or a *NotReadyError while it is
+// still starting, failed to start or is stopped. It is safe for concurrent
+// use.
+func Instance() (*Ethofs, error) {
+	instanceLock.RLock()
+	defer instanceLock.RUnlock()
+
+	if instance == nil {
+		return nil, &NotReadyError{Status: instanceStatus}
+	}
+	return instance, nil
+}
+
+// setInstance publishes the running node, or clears it if inst is nil.
+func setInstance(inst *Ethofs) {
+	instanceLock.Lock()
+	defer instanceLock.Unlock()
+
+	instance = inst
+
+	// Keep the deprecated globals in sync for existing callers
+	if inst != nil {
+		Ipfs, Node = inst.API, inst.Node
+	} else {
+		Ipfs, Node = nil, nil
+	}
+}
+
+// setInstanceStatus updates the startup state reported by Instance.
+func setInstanceStatus(status StartupStatus) {
+	instanceLock.Lock()
+	defer instanceLock.Unlock()
+
+	instanceStatus = status
+}
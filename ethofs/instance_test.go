@@ -0,0 +1,100 @@
+package ethofs
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInstance(t *testing.T) {
+	defer setInstance(nil)
+
+	setInstanceStatus(StartupStatus{State: StartupFailed, Attempts: 3, Error: "boom"})
+	_, err := Instance()
+	if !errors.Is(err, ErrNotReady) {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrNotReady)
+	}
+	if errors.Is(err, ErrStarting) {
+		t.Fatalf("failed startup reported as in progress: %v", err)
+	}
+	var notReady *NotReadyError
+	if !errors.As(err, &notReady) || notReady.Status.State != StartupFailed || notReady.Status.Error != "boom" {
+		t.Fatalf("startup status mismatch: have %v", err)
+	}
+	setInstanceStatus(StartupStatus{State: StartupStarting, Attempts: 1})
+	if _, err := Instance(); !errors.Is(err, ErrStarting) {
+		t.Fatalf("error mismatch while starting: have %v, want %v", err, ErrStarting)
+	}
+	want := new(Ethofs)
+	setInstance(want)
+	if have, err := Instance(); have != want || err != nil {
+		t.Fatalf("instance mismatch: have %p (%v), want %p", have, err, want)
+	}
+	setInstance(nil)
+	if _, err := Instance(); !errors.Is(err, ErrNotReady) {
+		t.Fatalf("error mismatch after stop: have %v, want %v", err, ErrNotReady)
+	}
+}
+
+func TestInitRepoOnce(t *testing.T) {
+	var (
+		runs    int32
+		release = make(chan struct{})
+		errs    = make(chan error, 4)
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- initRepoOnce("init", "/repo", func() error {
+				atomic.AddInt32(&runs, 1)
+				<-release
+				return nil
+			})
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	if runs != 1 {
+		t.Fatalf("concurrent initializations: have %d, want 1", runs)
+	}
+	var succeeded, starting int
+	for err := range errs {
+		switch err {
+		case nil:
+			succeeded++
+		case ErrStarting:
+			starting++
+		default:
+			t.Errorf("unexpected initialization error: %v", err)
+		}
+	}
+	if succeeded != 1 || starting != 3 {
+		t.Errorf("results mismatch: %d succeeded, %d starting", succeeded, starting)
+	}
+	// Initializations after the first one run again
+	fail := errors.New("boom")
+	if err := initRepoOnce("init", "/repo", func() error { return fail }); err != fail {
+		t.Errorf("sequential initialization error mismatch: have %v, want %v", err, fail)
+	}
+	// Other steps don't share the outcome of a running one
+	started := make(chan struct{})
+	release = make(chan struct{})
+	go initRepoOnce("init", "/repo", func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+	ran := false
+	if err := initRepoOnce("config", "/repo", func() error { ran = true; return nil }); err != nil || !ran {
+		t.Errorf("step blocked by another one: ran %v, error %v", ran, err)
+	}
+	close(release)
+}
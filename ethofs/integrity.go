@@ -0,0 +1,424 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-ipfs/core"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+const (
+	defaultIntegrityInterval = 6 * time.Hour
+	defaultIntegritySamples  = 32
+
+	// maxIntegritySamples bounds the blocks read for a single proof.
+	maxIntegritySamples = 1024
+
+	integritySubmitTimeout = time.Minute
+
+	// integrityRequestInterval is the minimum time between two proofs
+	// requested over the API.
+	integrityRequestInterval = time.Minute
+)
+
+// IntegrityProofABI is the interface of the contract the integrity proofs are
+// posted to, recording the commitment of the node over the blocks sampled
+// with the randomness of the given block.
+const IntegrityProofABI = "[{\"constant\":false,\"inputs\":[{\"name\":\"number\",\"type\":\"uint256\"},{\"name\":\"seed\",\"type\":\"bytes32\"},{\"name\":\"commitment\",\"type\":\"bytes32\"},{\"name\":\"samples\",\"type\":\"uint32\"}],\"name\":\"submitIntegrityProof\",\"outputs\":[],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"}]"
+
+var (
+	errNoIntegrityProver = errors.New("ethoFS integrity proofs not enabled")
+	errNoPinnedContent   = errors.New("no pinned content to prove")
+	errProofRateLimited  = errors.New("integrity proof requested too often")
+	errIncompleteProof   = errors.New("integrity proof misses pinned blocks")
+)
+
+var (
+	integrityProvedMeter  = metrics.NewRegisteredMeter("ethofs/integrity/proved", nil)
+	integrityMissingMeter = metrics.NewRegisteredMeter("ethofs/integrity/missing", nil)
+)
+
+// IntegritySample is a pinned block sampled for an integrity proof.
+type IntegritySample struct {
+	Pin   string      `json:"pin"`             // Pin the sampled path starts at
+	Cid   string      `json:"cid"`             // Block the path ends at, empty if the walk failed
+	Leaf  common.Hash `json:"leaf"`            // Keccak256 hash of the CID and the data of the block, zero if missing
+	Error string      `json:"error,omitempty"` // Reason the block could not be sampled
+}
+
+// IntegrityProof is a commitment over randomly sampled pinned blocks. The
+// samples are derived from the hash of a recent block, so the node can not
+// choose them in advance, and committed to as the root of a Keccak256 Merkle
+// tree over their leaves. Auditors recompute the root from the blocks named by
+// the samples.
+type IntegrityProof struct {
+	Time        uint64            `json:"time"`                  // Unix time the proof was computed
+	Number      uint64            `json:"number"`                // Block the samples were derived from
+	Seed        common.Hash       `json:"seed"`                  // Hash of that block
+	Commitment  common.Hash       `json:"commitment"`            // Merkle root over the sample leaves
+	Pins        int               `json:"pins"`                  // Number of pins sampled from
+	Missing     int               `json:"missing"`               // Samples whose block was unavailable or corrupt
+	Samples     []IntegritySample `json:"samples"`               // Sampled blocks in leaf order
+	Calldata    hexutil.Bytes     `json:"calldata"`              // submitIntegrityProof call, for submission by another wallet
+	Transaction *common.Hash      `json:"transaction,omitempty"` // Proof transaction, if submitted by the node
+	SubmitError string            `json:"submitError,omitempty"`
+}
+
+// sampledPin is a pin integrity proofs sample from. Only recursive pins are
+// descended, direct pins hold their root block alone.
+type sampledPin struct {
+	cid       cid.Cid
+	recursive bool
+}
+
+// sampleIndex derives the choice at the given depth of sample i from the seed.
+func sampleIndex(seed common.Hash, sample, depth int, n int) int {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(sample))
+	binary.BigEndian.PutUint64(buf[8:], uint64(depth))
+	hash := crypto.Keccak256(seed[:], buf[:])
+	return int(binary.BigEndian.Uint64(hash[:8]) % uint64(n))
+}
+
+// pinSamples chooses the position of the pin each of the n samples starts at
+// among the given number of pins.
+func pinSamples(seed common.Hash, n int, count int) []int {
+	if count == 0 {
+		return nil
+	}
+	positions := make([]int, n)
+	for i := range positions {
+		positions[i] = sampleIndex(seed, i, 0, count)
+	}
+	return positions
+}
+
+// sampleBlocks walks a seeded random path down to a leaf for each sample,
+// starting at the pin chosen for it by pinSamples and verifying every block on
+// the way like spotCheck does. The walks only depend on the seed and the pins.
+func sampleBlocks(ctx context.Context, bs blockstore.Blockstore, pins []sampledPin, seed common.Hash) ([]IntegritySample, error) {
+	if len(pins) == 0 {
+		return nil, errNoPinnedContent
+	}
+	samples := make([]IntegritySample, 0, len(pins))
+	for i, pin := range pins {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sample := IntegritySample{Pin: pin.cid.String()}
+
+		leaf, data, err := samplePath(bs, pin, seed, i)
+		if err != nil {
+			sample.Error = err.Error()
+		} else {
+			sample.Cid = leaf.String()
+			sample.Leaf = crypto.Keccak256Hash(leaf.Bytes(), data)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// samplePath descends from the pin along the links chosen by the seed,
+// returning the block the path ends at.
+func samplePath(bs blockstore.Blockstore, pin sampledPin, seed common.Hash, sample int) (cid.Cid, []byte, error) {
+	c := pin.cid
+	for depth := 1; ; depth++ {
+		if depth > maxVerifyDepth {
+			return cid.Cid{}, nil, errDAGTooDeep
+		}
+		blk, err := bs.Get(c)
+		if err != nil {
+			return cid.Cid{}, nil, fmt.Errorf("block %s: %v", c, err)
+		}
+		if sum, err := c.Prefix().Sum(blk.RawData()); err != nil || !sum.Equals(c) {
+			return cid.Cid{}, nil, fmt.Errorf("block %s: %v", c, errBlockCorrupt)
+		}
+		if !pin.recursive || c.Type() != cid.DagProtobuf {
+			return c, blk.RawData(), nil
+		}
+		nd, err := merkledag.DecodeProtobufBlock(blk)
+		if err != nil {
+			return cid.Cid{}, nil, fmt.Errorf("block %s: %v", c, err)
+		}
+		links := nd.Links()
+		if len(links) == 0 {
+			return c, blk.RawData(), nil
+		}
+		c = links[sampleIndex(seed, sample, depth, len(links))].Cid
+	}
+}
+
+// integrityCommitment returns the root of the Keccak256 Merkle tree over the
+// sample leaves, pairing a trailing odd node with itself.
+func integrityCommitment(samples []IntegritySample) common.Hash {
+	if len(samples) == 0 {
+		return common.Hash{}
+	}
+	level := make([]common.Hash, len(samples))
+	for i, sample := range samples {
+		level[i] = sample.Leaf
+	}
+	for len(level) > 1 {
+		next := make([]common.Hash, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			j := i + 1
+			if j == len(level) {
+				j = i
+			}
+			next = append(next, crypto.Keccak256Hash(level[i][:], level[j][:]))
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// integrityProver periodically proves the continued storage of the pinned
+// content, posting the proofs to the proof contract if one is configured.
+type integrityProver struct {
+	node     *core.IpfsNode
+	accounts *accounts.Manager
+	cfg      IntegrityConfig
+
+	lock      sync.Mutex
+	last      *IntegrityProof
+	requested time.Time // Last proof requested over the API
+}
+
+func newIntegrityProver(node *core.IpfsNode, am *accounts.Manager, cfg *IntegrityConfig) *integrityProver {
+	p := &integrityProver{node: node, accounts: am, cfg: *cfg}
+	if p.cfg.Interval == 0 {
+		p.cfg.Interval = defaultIntegrityInterval
+	}
+	if p.cfg.Samples == 0 {
+		p.cfg.Samples = defaultIntegritySamples
+	}
+	return p
+}
+
+// loop proves the storage every interval until the context is cancelled.
+func (p *integrityProver) loop(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := p.round(ctx); err != nil {
+				log.Debug("ethoFS - integrity proof skipped", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// round computes a proof and submits it, queueing the submission while the
+// chain backend is unavailable. Proofs missing samples are kept but not
+// submitted, as the submission claims every sample to be stored.
+func (p *integrityProver) round(ctx context.Context) (*IntegrityProof, error) {
+	proof, err := p.prove(ctx)
+	if err != nil {
+		return nil, err
+	}
+	integrityProvedMeter.Mark(1)
+	if proof.Missing > 0 {
+		integrityMissingMeter.Mark(int64(proof.Missing))
+		log.Warn("ethoFS - pinned blocks missing from integrity proof", "missing", proof.Missing, "samples", len(proof.Samples))
+		if p.cfg.ProofContract != "" {
+			proof.SubmitError = errIncompleteProof.Error()
+		}
+	}
+	log.Info("ethoFS - integrity proof computed", "number", proof.Number, "commitment", proof.Commitment, "pins", proof.Pins)
+
+	p.lock.Lock()
+	p.last = proof
+	p.lock.Unlock()
+
+	if p.cfg.ProofContract != "" && proof.Missing == 0 {
+		err := currentChainBackend().submit(ctx, "integrityProof", func(ctx context.Context) error {
+			hash, err := p.submit(ctx, proof)
+
+			p.lock.Lock()
+			defer p.lock.Unlock()
+
+			if err != nil {
+				proof.SubmitError = err.Error()
+				return err
+			}
+			proof.Transaction, proof.SubmitError = &hash, ""
+			log.Info("ethoFS - integrity proof submitted", "commitment", proof.Commitment, "tx", hash)
+			return nil
+		})
+		if err == errChainUnavailable {
+			log.Debug("ethoFS - integrity proof submission queued, chain backend unavailable")
+		} else if err != nil {
+			log.Warn("ethoFS - integrity proof submission failed", "error", err)
+		}
+	}
+	return p.proof(), nil
+}
+
+// request computes and submits a proof on demand, at most once every
+// integrityRequestInterval, as every proof reads the sampled blocks from disk
+// and may send a transaction.
+func (p *integrityProver) request(ctx context.Context) (*IntegrityProof, error) {
+	p.lock.Lock()
+	if time.Since(p.requested) < integrityRequestInterval {
+		p.lock.Unlock()
+		return nil, errProofRateLimited
+	}
+	p.requested = time.Now()
+	p.lock.Unlock()
+
+	return p.round(ctx)
+}
+
+// prove samples the pinned blocks with the randomness of the chain head.
+func (p *integrityProver) prove(ctx context.Context) (*IntegrityProof, error) {
+	headCtx, cancel := context.WithTimeout(ctx, chainCallTimeout)
+	head, err := probeChainHead(headCtx)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	seed := head.Hash()
+	pins, count, err := localPins.pick(ctx, func(count int) []int {
+		return pinSamples(seed, p.cfg.Samples, count)
+	})
+	if err != nil {
+		return nil, err
+	}
+	samples, err := sampleBlocks(ctx, p.node.Blockstore, pins, seed)
+	if err != nil {
+		return nil, err
+	}
+	proof := &IntegrityProof{
+		Time:       uint64(time.Now().Unix()),
+		Number:     head.Number.Uint64(),
+		Seed:       seed,
+		Commitment: integrityCommitment(samples),
+		Pins:       count,
+		Samples:    samples,
+	}
+	for _, sample := range samples {
+		if sample.Error != "" {
+			proof.Missing++
+		}
+	}
+	if proof.Calldata, err = integrityCalldata(proof); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// integrityCalldata packs the submitIntegrityProof call of the proof.
+func integrityCalldata(proof *IntegrityProof) ([]byte, error) {
+	parsed, err := abi.JSON(strings.NewReader(IntegrityProofABI))
+	if err != nil {
+		return nil, err
+	}
+	return parsed.Pack("submitIntegrityProof", new(big.Int).SetUint64(proof.Number), proof.Seed, proof.Commitment, uint32(len(proof.Samples)))
+}
+
+// submit posts the proof to the proof contract in a transaction signed by the
+// configured account. Nothing is signed while the clock is skewed.
+func (p *integrityProver) submit(ctx context.Context, proof *IntegrityProof) (common.Hash, error) {
+	if err := checkSigningClock(); err != nil {
+		return common.Hash{}, err
+	}
+	if ethClient == nil {
+		return common.Hash{}, errNoEthClient
+	}
+	parsed, err := abi.JSON(strings.NewReader(IntegrityProofABI))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	account := accounts.Account{Address: common.HexToAddress(p.cfg.Account)}
+	wallet, err := p.accounts.Find(account)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, integritySubmitTimeout)
+	defer cancel()
+
+	chainID, err := ethClient.ChainID(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	contract := bind.NewBoundContract(common.HexToAddress(p.cfg.ProofContract), parsed, ethClient, ethClient, nil)
+	tx, err := contract.Transact(&bind.TransactOpts{
+		From:    account.Address,
+		Context: ctx,
+		Signer: func(signer types.Signer, addr common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			return wallet.SignTx(accounts.Account{Address: addr}, tx, chainID)
+		},
+	}, "submitIntegrityProof", new(big.Int).SetUint64(proof.Number), proof.Seed, proof.Commitment, uint32(len(proof.Samples)))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return tx.Hash(), nil
+}
+
+// proof returns a copy of the last proof, or nil if none was computed yet.
+func (p *integrityProver) proof() *IntegrityProof {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.last == nil {
+		return nil
+	}
+	cpy := *p.last
+	return &cpy
+}
+
+// integrityProver returns the integrity prover of the running node, or nil if
+// it is stopped or the proofs are disabled.
+func (s *EthofsService) integrityProver() *integrityProver {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.proofs
+}
+
+// IntegrityProof returns the last scheduled integrity proof, or nil if none
+// was computed yet.
+func (api *PublicEthofsAPI) IntegrityProof() (_ *IntegrityProof, err error) {
+	defer trackCall("integrityProof", time.Now(), &err)
+
+	p := api.service.integrityProver()
+	if p == nil {
+		return nil, errNoIntegrityProver
+	}
+	return p.proof(), nil
+}
+
+// ProveIntegrity computes and submits an integrity proof right away.
+func (api *PrivateEthofsAPI) ProveIntegrity(ctx context.Context) (_ *IntegrityProof, err error) {
+	defer trackCall("proveIntegrity", time.Now(), &err)
+
+	p := api.service.integrityProver()
+	if p == nil {
+		return nil, errNoIntegrityProver
+	}
+	return p.request(ctx)
+}
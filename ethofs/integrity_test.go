@@ -0,0 +1,186 @@
+package ethofs
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func TestSampleBlocks(t *testing.T) {
+	bs := blockstore.NewBlockstore(dsync.MutexWrap(datastore.NewMapDatastore()))
+
+	// A recursive pin of a root linking to two leaves, and a direct pin
+	// whose leaf is not stored
+	left := merkledag.NodeWithData([]byte("left leaf"))
+	right := merkledag.NodeWithData([]byte("right leaf"))
+	root := merkledag.NodeWithData(nil)
+	for _, leaf := range []*merkledag.ProtoNode{left, right} {
+		if err := root.AddNodeLink("leaf", leaf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dangling := merkledag.NodeWithData(nil)
+	if err := dangling.AddNodeLink("missing", merkledag.NodeWithData([]byte("unstored leaf"))); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []blocks.Block{left, right, root, dangling} {
+		if err := bs.Put(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	index := new(pinIndex)
+	if _, _, err := index.pick(ctx, func(int) []int { return nil }); err != errNodeNotRunning {
+		t.Fatalf("detached index pick error mismatch: have %v, want %v", err, errNodeNotRunning)
+	}
+	pinner := &testPinner{recursive: []cid.Cid{root.Cid()}, direct: []cid.Cid{dangling.Cid()}}
+	if err := index.attach(ctx, dsync.MutexWrap(datastore.NewMapDatastore()), pinner); err != nil {
+		t.Fatal(err)
+	}
+	pick := func(seed common.Hash) []sampledPin {
+		pins, count, err := index.pick(ctx, func(count int) []int { return pinSamples(seed, 32, count) })
+		if err != nil {
+			t.Fatalf("failed to pick pins: %v", err)
+		}
+		if count != 2 || len(pins) != 32 {
+			t.Fatalf("picked pins mismatch: have %d of %d, want 32 of 2", len(pins), count)
+		}
+		for i, pin := range pins {
+			if pin.recursive != pin.cid.Equals(root.Cid()) {
+				t.Fatalf("pin %d mode mismatch: %s recursive %v", i, pin.cid, pin.recursive)
+			}
+		}
+		return pins
+	}
+	seed := common.HexToHash("0x1234")
+	pins := pick(seed)
+
+	samples, err := sampleBlocks(ctx, bs, pins, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaves := map[string]bool{left.Cid().String(): true, right.Cid().String(): true, dangling.Cid().String(): true}
+	seen := make(map[string]bool)
+	for i, sample := range samples {
+		if sample.Error != "" {
+			t.Fatalf("sample %d failed: %v", i, sample.Error)
+		}
+		if !leaves[sample.Cid] {
+			t.Fatalf("sample %d ended at inner block %s", i, sample.Cid)
+		}
+		seen[sample.Cid] = true
+	}
+	if len(seen) != len(leaves) {
+		t.Errorf("samples missed blocks: have %v", seen)
+	}
+	// Samples only depend on the seed, the commitment on the block data
+	again, err := sampleBlocks(ctx, bs, pick(seed), seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(samples, again) {
+		t.Error("samples of the same seed differ")
+	}
+	otherSeed := common.HexToHash("0x5678")
+	other, err := sampleBlocks(ctx, bs, pick(otherSeed), otherSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if integrityCommitment(samples) == integrityCommitment(other) {
+		t.Error("commitments of different seeds match")
+	}
+	// Losing a block shows up as a missing sample
+	if err := bs.DeleteBlock(left.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	lost, err := sampleBlocks(ctx, bs, pins, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var missing int
+	for i, sample := range lost {
+		if sample.Error != "" {
+			missing++
+			if sample.Leaf != (common.Hash{}) {
+				t.Errorf("missing sample %d has a leaf", i)
+			}
+		}
+	}
+	if missing == 0 {
+		t.Error("lost block not detected")
+	}
+	if _, err := sampleBlocks(ctx, bs, nil, seed); err != errNoPinnedContent {
+		t.Errorf("sampling without pins: have %v, want %v", err, errNoPinnedContent)
+	}
+}
+
+func TestIntegrityCommitment(t *testing.T) {
+	leaf := func(s string) IntegritySample { return IntegritySample{Leaf: crypto.Keccak256Hash([]byte(s))} }
+	a, b, c := leaf("a"), leaf("b"), leaf("c")
+
+	if root := integrityCommitment(nil); root != (common.Hash{}) {
+		t.Errorf("empty commitment: have %x", root)
+	}
+	if root := integrityCommitment([]IntegritySample{a}); root != a.Leaf {
+		t.Errorf("single leaf commitment: have %x, want %x", root, a.Leaf)
+	}
+	ab := crypto.Keccak256Hash(a.Leaf[:], b.Leaf[:])
+	cc := crypto.Keccak256Hash(c.Leaf[:], c.Leaf[:])
+	if have, want := integrityCommitment([]IntegritySample{a, b, c}), crypto.Keccak256Hash(ab[:], cc[:]); have != want {
+		t.Errorf("commitment mismatch: have %x, want %x", have, want)
+	}
+	if integrityCommitment([]IntegritySample{a, b}) == integrityCommitment([]IntegritySample{b, a}) {
+		t.Error("commitment ignores the sample order")
+	}
+}
+
+func TestIntegrityCalldata(t *testing.T) {
+	proof := &IntegrityProof{
+		Number:     4242,
+		Seed:       common.HexToHash("0x01"),
+		Commitment: common.HexToHash("0x02"),
+		Samples:    make([]IntegritySample, 3),
+	}
+	data, err := integrityCalldata(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := abi.JSON(strings.NewReader(IntegrityProofABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	method, err := parsed.MethodById(data[:4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, err := method.Inputs.UnpackValues(data[4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 4 || args[0].(interface{ Uint64() uint64 }).Uint64() != 4242 || args[3].(uint32) != 3 {
+		t.Errorf("calldata arguments mismatch: %v", args)
+	}
+	if common.Hash(args[2].([32]byte)) != proof.Commitment {
+		t.Errorf("calldata commitment mismatch: have %x", args[2])
+	}
+}
+
+func TestIntegrityRequestLimit(t *testing.T) {
+	p := &integrityProver{requested: time.Now()}
+	if _, err := p.request(context.Background()); err != errProofRateLimited {
+		t.Errorf("repeated request: have %v, want %v", err, errProofRateLimited)
+	}
+}
@@ -0,0 +1,146 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	// selfKeyName is the keystore name of the node identity key, publishing
+	// under the peer ID of the node.
+	selfKeyName = "self"
+
+	// ipnsRecordLifetime is how long published IPNS records stay valid.
+	ipnsRecordLifetime = 24 * time.Hour
+)
+
+var errSelfKeyImport = errors.New("cannot import over the node identity key")
+
+// KeyInfo identifies a key of the ethoFS keystore. IPNS names published with
+// the key resolve under its ID.
+type KeyInfo struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// PublishIPNS points the IPNS name of the given key at the content, making the
+// name a mutable pointer to it. An empty key name publishes under the node
+// identity. It returns the published name.
+func (s *EthofsService) PublishIPNS(ctx context.Context, c cid.Cid, keyName string) (string, error) {
+	ipfs := s.API()
+	if ipfs == nil {
+		return "", errNodeNotRunning
+	}
+	if err := checkSigningClock(); err != nil {
+		return "", err
+	}
+	if keyName == "" {
+		keyName = selfKeyName
+	}
+	entry, err := ipfs.Name().Publish(ctx, path.IpfsPath(c),
+		options.Name.Key(keyName),
+		options.Name.ValidTime(ipnsRecordLifetime),
+	)
+	if err != nil {
+		return "", err
+	}
+	return entry.Name(), nil
+}
+
+// ResolveIPNS resolves an IPNS name (with or without the /ipns/ prefix) to the
+// path it currently points at.
+func (s *EthofsService) ResolveIPNS(ctx context.Context, name string) (string, error) {
+	ipfs := s.API()
+	if ipfs == nil {
+		return "", errNodeNotRunning
+	}
+	if !strings.HasPrefix(name, "/ipns/") {
+		name = "/ipns/" + name
+	}
+	resolved, err := ipfs.Name().Resolve(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return resolved.String(), nil
+}
+
+// CreateKey generates a new ed25519 key under the given name for publishing
+// IPNS names.
+func (s *EthofsService) CreateKey(ctx context.Context, name string) (*KeyInfo, error) {
+	ipfs := s.API()
+	if ipfs == nil {
+		return nil, errNodeNotRunning
+	}
+	key, err := ipfs.Key().Generate(ctx, name, options.Key.Type(options.Ed25519Key))
+	if err != nil {
+		return nil, err
+	}
+	return &KeyInfo{Name: key.Name(), ID: key.ID().Pretty()}, nil
+}
+
+// ListKeys returns the keys of the keystore, the node identity first.
+func (s *EthofsService) ListKeys(ctx context.Context) ([]*KeyInfo, error) {
+	ipfs := s.API()
+	if ipfs == nil {
+		return nil, errNodeNotRunning
+	}
+	keys, err := ipfs.Key().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*KeyInfo, 0, len(keys))
+	for _, key := range keys {
+		infos = append(infos, &KeyInfo{Name: key.Name(), ID: key.ID().Pretty()})
+	}
+	return infos, nil
+}
+
+// ExportKey returns the protobuf encoded private key of the given name, as
+// accepted by ImportKey. The exported key controls all names published with
+// it and has to be kept secret.
+func (s *EthofsService) ExportKey(name string) ([]byte, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	if name == selfKeyName {
+		return ci.MarshalPrivateKey(node.PrivateKey)
+	}
+	key, err := node.Repo.Keystore().Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return ci.MarshalPrivateKey(key)
+}
+
+// ImportKey stores a protobuf encoded private key under the given name, e.g.
+// to move the publishing of an IPNS name to this node.
+func (s *EthofsService) ImportKey(name string, data []byte) (*KeyInfo, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	if name == selfKeyName {
+		return nil, errSelfKeyImport
+	}
+	key, err := ci.UnmarshalPrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := node.Repo.Keystore().Put(name, key); err != nil {
+		return nil, err
+	}
+	return &KeyInfo{Name: name, ID: id.Pretty()}, nil
+}
@@ -0,0 +1,150 @@
+package ethofs
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	config "github.com/ipfs/go-ipfs-config"
+	offroute "github.com/ipfs/go-ipfs-routing/offline"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/keystore"
+	"github.com/ipfs/go-ipfs/repo"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+	record "github.com/libp2p/go-libp2p-record"
+)
+
+// offlineRouting keeps the records of the node in its datastore, letting it
+// publish and resolve its own IPNS names without peers.
+func offlineRouting(_ context.Context, _ host.Host, dstore datastore.Batching, validator record.Validator, _ ...peer.AddrInfo) (routing.Routing, error) {
+	return offroute.NewOfflineRouter(dstore, validator), nil
+}
+
+// newTestService creates a service running an in-memory node listening on
+// localhost, without peers and with pubsub enabled. The returned
+// function stops the node.
+func newTestService(t *testing.T) (*EthofsService, func()) {
+	identity, err := config.CreateIdentity(ioutil.Discard, []options.KeyGenerateOption{options.Key.Type(options.Ed25519Key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.InitWithIdentity(identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Addresses.Swarm = []string{"/ip4/127.0.0.1/tcp/0"}
+	cfg.Bootstrap = nil
+	cfg.Discovery.MDNS.Enabled = false
+	cfg.Swarm.DisableNatPortMap = true
+
+	node, err := core.NewNode(context.Background(), &core.BuildCfg{
+		Online:  true,
+		Routing: offlineRouting,
+		Repo: &repo.Mock{
+			C: *cfg,
+			D: dsync.MutexWrap(datastore.NewMapDatastore()),
+			K: keystore.NewMemKeystore(),
+		},
+		ExtraOpts: map[string]bool{"pubsub": true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(node)
+	if err != nil {
+		node.Close()
+		t.Fatal(err)
+	}
+	s := &EthofsService{config: DefaultConfig, node: node, ipfs: api}
+	return s, func() { node.Close() }
+}
+
+func TestIPNSPublish(t *testing.T) {
+	s, stop := newTestService(t)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c, err := cid.Decode("QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := s.CreateKey(ctx, "site")
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	for _, keyName := range []string{"", "site"} {
+		name, err := s.PublishIPNS(ctx, c, keyName)
+		if err != nil {
+			t.Fatalf("key %q: failed to publish: %v", keyName, err)
+		}
+		if keyName == "site" && name != key.ID {
+			t.Errorf("published name mismatch: have %s, want %s", name, key.ID)
+		}
+		resolved, err := s.ResolveIPNS(ctx, name)
+		if err != nil {
+			t.Fatalf("key %q: failed to resolve: %v", keyName, err)
+		}
+		if resolved != "/ipfs/"+c.String() {
+			t.Errorf("key %q: resolved path mismatch: have %s, want /ipfs/%s", keyName, resolved, c)
+		}
+	}
+	if _, err := s.PublishIPNS(ctx, c, "missing"); err == nil {
+		t.Errorf("published with unknown key")
+	}
+}
+
+func TestIPNSKeys(t *testing.T) {
+	s, stop := newTestService(t)
+	defer stop()
+
+	ctx := context.Background()
+	key, err := s.CreateKey(ctx, "site")
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	keys, err := s.ListKeys(ctx)
+	if err != nil {
+		t.Fatalf("failed to list keys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].Name != selfKeyName || keys[1].Name != "site" || keys[1].ID != key.ID {
+		t.Errorf("key list mismatch: %+v", keys)
+	}
+	// Exported keys import under another name with the same ID
+	data, err := s.ExportKey("site")
+	if err != nil {
+		t.Fatalf("failed to export key: %v", err)
+	}
+	imported, err := s.ImportKey("moved", data)
+	if err != nil {
+		t.Fatalf("failed to import key: %v", err)
+	}
+	if imported.ID != key.ID {
+		t.Errorf("imported key ID mismatch: have %s, want %s", imported.ID, key.ID)
+	}
+	if _, err := s.ExportKey(selfKeyName); err != nil {
+		t.Errorf("failed to export identity key: %v", err)
+	}
+	if _, err := s.ImportKey(selfKeyName, data); err != errSelfKeyImport {
+		t.Errorf("identity import: have %v, want %v", err, errSelfKeyImport)
+	}
+	if _, err := s.ImportKey("garbage", []byte("not a key")); err == nil {
+		t.Errorf("imported invalid key")
+	}
+	stopped := new(EthofsService)
+	if _, err := stopped.ListKeys(ctx); err != errNodeNotRunning {
+		t.Errorf("stopped node: have %v, want %v", err, errNodeNotRunning)
+	}
+	if _, err := stopped.ResolveIPNS(ctx, key.ID); err != errNodeNotRunning {
+		t.Errorf("stopped node: have %v, want %v", err, errNodeNotRunning)
+	}
+}
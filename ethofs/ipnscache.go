@@ -0,0 +1,190 @@
+package ethofs
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	lru "github.com/hashicorp/golang-lru"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	gopath "github.com/ipfs/go-path"
+	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	defaultIPNSCacheSize = 1024
+	defaultIPNSFresh     = time.Minute
+	defaultIPNSMaxStale  = time.Hour
+
+	ipnsRevalidateTimeout = time.Minute
+)
+
+var (
+	ipnsHitMeter   = metrics.NewRegisteredMeter("ethofs/ipns/cache/hit", nil)
+	ipnsStaleMeter = metrics.NewRegisteredMeter("ethofs/ipns/cache/stale", nil)
+	ipnsMissMeter  = metrics.NewRegisteredMeter("ethofs/ipns/cache/miss", nil)
+)
+
+// ipnsEntry is a cached name resolution.
+type ipnsEntry struct {
+	value      gopath.Path
+	resolved   time.Time
+	refreshing bool
+}
+
+// ipnsCache wraps the name system of the node with a stale-while-revalidate
+// cache. Resolutions younger than fresh are served as is, older ones up to
+// fresh+maxStale are served immediately while being revalidated in the
+// background. Anything older is resolved synchronously.
+//
+// Only default resolutions are cached, lookups with custom options and
+// ResolveAsync go straight to the underlying name system.
+type ipnsCache struct {
+	namesys.NameSystem
+
+	fresh    time.Duration
+	maxStale time.Duration
+	ctx      context.Context // bounds background revalidations
+
+	lock    sync.Mutex
+	entries *lru.Cache // name -> *ipnsEntry
+	group   *flightGroup
+}
+
+func newIPNSCache(ctx context.Context, ns namesys.NameSystem, cfg *IPNSCacheConfig) (*ipnsCache, error) {
+	size, fresh, maxStale := cfg.Size, cfg.Fresh, cfg.MaxStale
+	if size == 0 {
+		size = defaultIPNSCacheSize
+	}
+	if fresh == 0 {
+		fresh = defaultIPNSFresh
+	}
+	if maxStale == 0 {
+		maxStale = defaultIPNSMaxStale
+	}
+	entries, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	return &ipnsCache{
+		NameSystem: ns,
+		fresh:      fresh,
+		maxStale:   maxStale,
+		ctx:        ctx,
+		entries:    entries,
+		group:      newFlightGroup(),
+	}, nil
+}
+
+// Resolve implements namesys.Resolver.
+func (c *ipnsCache) Resolve(ctx context.Context, name string, options ...nsopts.ResolveOpt) (gopath.Path, error) {
+	if len(options) > 0 {
+		return c.NameSystem.Resolve(ctx, name, options...)
+	}
+	name = strings.TrimPrefix(name, "/ipns/")
+	now := time.Now()
+
+	c.lock.Lock()
+	if cached, ok := c.entries.Get(name); ok {
+		entry := cached.(*ipnsEntry)
+		age := now.Sub(entry.resolved)
+		if age < c.fresh {
+			c.lock.Unlock()
+			ipnsHitMeter.Mark(1)
+			return entry.value, nil
+		}
+		if age < c.fresh+c.maxStale {
+			value := entry.value
+			if !entry.refreshing {
+				entry.refreshing = true
+				go c.revalidate(name)
+			}
+			c.lock.Unlock()
+			ipnsStaleMeter.Mark(1)
+			return value, nil
+		}
+	}
+	c.lock.Unlock()
+
+	ipnsMissMeter.Mark(1)
+	var value gopath.Path
+	_, err := c.group.do(ctx, name, func(context.Context) error {
+		var err error
+		value, err = c.resolve(c.ctx, name, ipnsRevalidateTimeout)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		// Joined a resolution started by another caller, pick up its result
+		c.lock.Lock()
+		if cached, ok := c.entries.Peek(name); ok {
+			value = cached.(*ipnsEntry).value
+		}
+		c.lock.Unlock()
+	}
+	return value, nil
+}
+
+// revalidate refreshes a stale entry in the background. On failure the stale
+// value is kept until it exceeds the staleness bound.
+func (c *ipnsCache) revalidate(name string) {
+	if _, err := c.resolve(c.ctx, name, ipnsRevalidateTimeout); err != nil {
+		log.Debug("ethoFS - IPNS revalidation failed", "name", name, "error", err)
+
+		c.lock.Lock()
+		if cached, ok := c.entries.Peek(name); ok {
+			cached.(*ipnsEntry).refreshing = false
+		}
+		c.lock.Unlock()
+	}
+}
+
+// resolve looks the name up in the underlying name system and caches the
+// result.
+func (c *ipnsCache) resolve(ctx context.Context, name string, timeout time.Duration) (gopath.Path, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	value, err := c.NameSystem.Resolve(ctx, "/ipns/"+name)
+	if err != nil {
+		return "", err
+	}
+	c.lock.Lock()
+	c.entries.Add(name, &ipnsEntry{value: value, resolved: time.Now()})
+	c.lock.Unlock()
+
+	return value, nil
+}
+
+// Publish implements namesys.Publisher, dropping the cached resolution of the
+// published name.
+func (c *ipnsCache) Publish(ctx context.Context, name ci.PrivKey, value gopath.Path) error {
+	return c.PublishWithEOL(ctx, name, value, time.Now().Add(namesys.DefaultRecordEOL))
+}
+
+// PublishWithEOL implements namesys.Publisher, dropping the cached resolution
+// of the published name.
+func (c *ipnsCache) PublishWithEOL(ctx context.Context, name ci.PrivKey, value gopath.Path, eol time.Time) error {
+	if err := c.NameSystem.PublishWithEOL(ctx, name, value, eol); err != nil {
+		return err
+	}
+	if id, err := peer.IDFromPrivateKey(name); err == nil {
+		c.forget(id)
+	}
+	return nil
+}
+
+// forget drops the cached resolution of the IPNS name of the peer ID.
+func (c *ipnsCache) forget(id peer.ID) {
+	c.lock.Lock()
+	c.entries.Remove(id.Pretty())
+	c.lock.Unlock()
+}
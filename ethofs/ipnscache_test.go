@@ -0,0 +1,88 @@
+package ethofs
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	gopath "github.com/ipfs/go-path"
+	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+)
+
+// countingNamesys resolves every name to the current value, counting lookups.
+type countingNamesys struct {
+	namesys.NameSystem
+
+	value   atomic.Value
+	lookups int32
+}
+
+func (ns *countingNamesys) Resolve(ctx context.Context, name string, options ...nsopts.ResolveOpt) (gopath.Path, error) {
+	atomic.AddInt32(&ns.lookups, 1)
+	return ns.value.Load().(gopath.Path), nil
+}
+
+func TestIPNSCacheRevalidation(t *testing.T) {
+	var (
+		first  = gopath.Path("/ipfs/QmeG81bELkgLBZFYZc53ioxtvRS8iNVzPqxUBKSuah2rcQ")
+		second = gopath.Path("/ipfs/QmRYw68MzD4jPvner913mLWBdFfpPfNUx8SRFjiUCJNA4f")
+	)
+	ns := new(countingNamesys)
+	ns.value.Store(first)
+
+	cache, err := newIPNSCache(context.Background(), ns, &IPNSCacheConfig{Fresh: 50 * time.Millisecond, MaxStale: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	resolve := func() gopath.Path {
+		value, err := cache.Resolve(context.Background(), "/ipns/site.org")
+		if err != nil {
+			t.Fatalf("failed to resolve: %v", err)
+		}
+		return value
+	}
+	// Initial lookup goes through, fresh entries are served from the cache
+	if value := resolve(); value != first {
+		t.Fatalf("value mismatch: have %s, want %s", value, first)
+	}
+	resolve()
+	if lookups := atomic.LoadInt32(&ns.lookups); lookups != 1 {
+		t.Fatalf("lookup count mismatch: have %d, want 1", lookups)
+	}
+	// Stale entries are served while being revalidated in the background
+	ns.value.Store(second)
+	time.Sleep(60 * time.Millisecond)
+
+	if value := resolve(); value != first {
+		t.Fatalf("stale value mismatch: have %s, want %s", value, first)
+	}
+	for i := 0; i < 100 && atomic.LoadInt32(&ns.lookups) < 2; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if value := resolve(); value != second {
+		t.Fatalf("revalidated value mismatch: have %s, want %s", value, second)
+	}
+	if lookups := atomic.LoadInt32(&ns.lookups); lookups != 2 {
+		t.Fatalf("lookup count mismatch: have %d, want 2", lookups)
+	}
+}
+
+func TestIPNSCacheExpiry(t *testing.T) {
+	ns := new(countingNamesys)
+	ns.value.Store(gopath.Path("/ipfs/QmeG81bELkgLBZFYZc53ioxtvRS8iNVzPqxUBKSuah2rcQ"))
+
+	cache, err := newIPNSCache(context.Background(), ns, &IPNSCacheConfig{Fresh: time.Millisecond, MaxStale: time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	cache.Resolve(context.Background(), "/ipns/site.org")
+	time.Sleep(10 * time.Millisecond)
+	cache.Resolve(context.Background(), "/ipns/site.org")
+
+	if lookups := atomic.LoadInt32(&ns.lookups); lookups != 2 {
+		t.Fatalf("expired entry served from cache, lookups: %d", lookups)
+	}
+}
@@ -0,0 +1,141 @@
+package ethofs
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	proto "github.com/gogo/protobuf/proto"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ipfs/go-ipfs/core"
+	ipns "github.com/ipfs/go-ipns"
+	ipnspb "github.com/ipfs/go-ipns/pb"
+	"github.com/libp2p/go-libp2p-core/peer"
+	record "github.com/libp2p/go-libp2p-record"
+)
+
+// ipnsUpdateNames bounds the names whose latest record sequence is tracked.
+const ipnsUpdateNames = 1024
+
+var (
+	ipnsUpdateMeter = metrics.NewRegisteredMeter("ethofs/ipns/pubsub/updates", nil)
+	ipnsDelayTimer  = metrics.NewRegisteredTimer("ethofs/ipns/pubsub/delay", nil)
+)
+
+// ipnsUpdateWatcher wraps the record validator of the IPNS pubsub router,
+// which checks every record received on the name topics. New sequence numbers
+// of names already seen are updates published by other nodes: they drop the
+// cached resolution of the name and are timed for the propagation delay.
+//
+// Records carry no publication time, the delay is derived from their end of
+// validity, assuming the record lifetime of ethoFS publishers.
+type ipnsUpdateWatcher struct {
+	record.Validator
+
+	cache *ipnsCache            // Resolution cache of the node, nil if disabled
+	own   func(id peer.ID) bool // Reports names published by the node itself
+	now   func() time.Time
+
+	lock sync.Mutex
+	seqs *lru.Cache // record key -> latest sequence number
+}
+
+// watchIPNSUpdates installs the update watcher on the IPNS pubsub router of
+// the node, if it runs one. It has to run before the first name subscription.
+func watchIPNSUpdates(node *core.IpfsNode, cache *ipnsCache) error {
+	if node.PSRouter == nil {
+		return nil
+	}
+	w, err := newIPNSUpdateWatcher(node.PSRouter.Validator, cache, localNames(node))
+	if err != nil {
+		return err
+	}
+	node.PSRouter.Validator = w
+	return nil
+}
+
+func newIPNSUpdateWatcher(validator record.Validator, cache *ipnsCache, own func(peer.ID) bool) (*ipnsUpdateWatcher, error) {
+	seqs, err := lru.New(ipnsUpdateNames)
+	if err != nil {
+		return nil, err
+	}
+	return &ipnsUpdateWatcher{Validator: validator, cache: cache, own: own, now: time.Now, seqs: seqs}, nil
+}
+
+// localNames reports whether a name is published with the identity or one of
+// the keystore keys of the node.
+func localNames(node *core.IpfsNode) func(peer.ID) bool {
+	return func(id peer.ID) bool {
+		if id == node.Identity {
+			return true
+		}
+		names, err := node.Repo.Keystore().List()
+		if err != nil {
+			return false
+		}
+		for _, name := range names {
+			key, err := node.Repo.Keystore().Get(name)
+			if err != nil {
+				continue
+			}
+			if kid, err := peer.IDFromPrivateKey(key); err == nil && kid == id {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Validate implements record.Validator.
+func (w *ipnsUpdateWatcher) Validate(key string, value []byte) error {
+	if err := w.Validator.Validate(key, value); err != nil {
+		return err
+	}
+	if strings.HasPrefix(key, "/ipns/") {
+		w.observe(key, value)
+	}
+	return nil
+}
+
+// observe tracks the sequence number of a valid record, returning the
+// propagation delay if the record is an update of another node.
+func (w *ipnsUpdateWatcher) observe(key string, value []byte) (time.Duration, bool) {
+	entry := new(ipnspb.IpnsEntry)
+	if err := proto.Unmarshal(value, entry); err != nil {
+		return 0, false
+	}
+	seq := entry.GetSequence()
+
+	w.lock.Lock()
+	last, seen := w.seqs.Get(key)
+	if seen && last.(uint64) >= seq {
+		w.lock.Unlock()
+		return 0, false
+	}
+	w.seqs.Add(key, seq)
+	w.lock.Unlock()
+
+	// The first record of a name is whatever was current when subscribing
+	id, err := peer.IDFromBytes([]byte(strings.TrimPrefix(key, "/ipns/")))
+	if !seen || err != nil || w.own(id) {
+		return 0, false
+	}
+	ipnsUpdateMeter.Mark(1)
+	if w.cache != nil {
+		w.cache.forget(id)
+	}
+	eol, err := ipns.GetEOL(entry)
+	if err != nil {
+		return 0, false
+	}
+	delay := w.now().Sub(eol.Add(-ipnsRecordLifetime))
+	if delay < 0 || delay > ipnsRecordLifetime {
+		return 0, false // published with a different lifetime
+	}
+	ipnsDelayTimer.Update(delay)
+	log.Debug("ethoFS - IPNS update received over pubsub", "name", id, "seq", seq, "delay", delay)
+	return delay, true
+}
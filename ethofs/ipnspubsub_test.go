@@ -0,0 +1,69 @@
+package ethofs
+
+import (
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	ipns "github.com/ipfs/go-ipns"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	record "github.com/libp2p/go-libp2p-record"
+)
+
+func TestIPNSUpdateWatcher(t *testing.T) {
+	now := time.Now()
+	sign := func(t *testing.T, sk ci.PrivKey, seq uint64, published time.Time) []byte {
+		entry, err := ipns.Create(sk, []byte("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"), seq, published.Add(ipnsRecordLifetime))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := proto.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	remote, _, err := ci.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, _, err := ci.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteID, _ := peer.IDFromPrivateKey(remote)
+	localID, _ := peer.IDFromPrivateKey(local)
+
+	w, err := newIPNSUpdateWatcher(record.NamespacedValidator{"ipns": ipns.Validator{}}, nil, func(id peer.ID) bool { return id == localID })
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.now = func() time.Time { return now }
+
+	// The record current at subscription time is no update
+	key := ipns.RecordKey(remoteID)
+	if _, ok := w.observe(key, sign(t, remote, 1, now.Add(-time.Hour))); ok {
+		t.Error("first record counted as update")
+	}
+	if delay, ok := w.observe(key, sign(t, remote, 2, now.Add(-3*time.Second))); !ok || delay != 3*time.Second {
+		t.Errorf("update delay mismatch: have %v (update %v), want 3s", delay, ok)
+	}
+	// Rebroadcasts and outdated records are no updates either
+	if _, ok := w.observe(key, sign(t, remote, 2, now.Add(-3*time.Second))); ok {
+		t.Error("rebroadcast counted as update")
+	}
+	if _, ok := w.observe(key, sign(t, remote, 1, now.Add(-time.Hour))); ok {
+		t.Error("outdated record counted as update")
+	}
+	// Neither are the names published by the node
+	own := ipns.RecordKey(localID)
+	w.observe(own, sign(t, local, 1, now))
+	if _, ok := w.observe(own, sign(t, local, 2, now)); ok {
+		t.Error("own record counted as update")
+	}
+	// Invalid records are rejected before being observed
+	if err := w.Validate(key, []byte("garbage")); err == nil {
+		t.Error("invalid record accepted")
+	}
+}
@@ -0,0 +1,143 @@
+package ethofs
+
+import (
+	"io/ioutil"
+	"sync"
+
+	datastore "github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	config "github.com/ipfs/go-ipfs-config"
+	"github.com/ipfs/go-ipfs/keystore"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/common"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+// lightSwarmAddrs are the listen addresses of light nodes, picking random
+// ports so they never collide with a full node on the same host.
+var lightSwarmAddrs = []string{"/ip4/0.0.0.0/tcp/0", "/ip6/::/tcp/0"}
+
+// openRepo opens the repo the node runs on: the repo at repoPath, migrated to
+// the current version and patched with the configured swarm settings,
+// mounting the configured block replicas, applying the read verification mode
+// and leaving the reprovides to ethoFS if they are throttled, or a fresh
+// in-memory repo for light nodes.
+func openRepo(repoPath string) (repo.Repo, error) {
+	if ethofsConfig.Light {
+		return newMemoryRepo(&ethofsConfig)
+	}
+	if err := checkRepoVersion(repoPath, &ethofsConfig.RepoMigration); err != nil {
+		return nil, err
+	}
+	fsRepo, err := fsrepo.Open(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := patchSwarmConfig(fsRepo, &ethofsConfig); err != nil {
+		fsRepo.Close()
+		return nil, err
+	}
+	verifyMode := ethofsConfig.Blockstore.ReadVerification
+	r, err := withBlockReplicas(fsRepo, ethofsConfig.BlockReplicas, verifyMode == readVerifyUntrusted)
+	if err != nil {
+		fsRepo.Close()
+		return nil, err
+	}
+	r = withReadVerification(r, verifyMode)
+	if ethofsConfig.Reprovide.throttled() {
+		r = &reprovideRepo{Repo: r}
+	}
+	return r, nil
+}
+
+// memoryRepo is the ephemeral repo of a light node. Its identity, content and
+// keys are discarded once the node stops.
+type memoryRepo struct {
+	repo.Mock
+	lock     sync.Mutex
+	swarmKey []byte
+}
+
+// newMemoryRepo creates the repo of a light node: a DHT client (unless
+// routing is disabled) that never reprovides the content it retrieved.
+func newMemoryRepo(cfg *Config) (*memoryRepo, error) {
+	conf, err := config.Init(ioutil.Discard, cfg.keySize())
+	if err != nil {
+		return nil, err
+	}
+	if err := applyProfiles(conf, cfg.Profile); err != nil {
+		return nil, err
+	}
+	// The ethoFS bootstrap peers are dialed once the node is up
+	conf.Bootstrap = nil
+	conf.Addresses.Swarm = lightSwarmAddrs
+	if err := applySwarmConfig(conf, cfg); err != nil {
+		return nil, err
+	}
+	conf.Routing.Type = "dhtclient"
+	if cfg.Routing == "none" {
+		conf.Routing.Type = "none"
+	}
+	conf.Reprovider.Interval = "0"
+
+	return &memoryRepo{
+		Mock: repo.Mock{
+			C: *conf,
+			D: dsync.MutexWrap(datastore.NewMapDatastore()),
+			K: keystore.NewMemKeystore(),
+		},
+		swarmKey: initialSwarmKey(cfg),
+	}, nil
+}
+
+func (r *memoryRepo) Config() (*config.Config, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	conf := r.C
+	return &conf, nil
+}
+
+func (r *memoryRepo) SetConfig(updated *config.Config) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.C = *updated
+	return nil
+}
+
+func (r *memoryRepo) SetConfigKey(key string, value interface{}) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	mapconf, err := config.ToMap(&r.C)
+	if err != nil {
+		return err
+	}
+	if err := common.MapSetKV(mapconf, key, value); err != nil {
+		return err
+	}
+	conf, err := config.FromMap(mapconf)
+	if err != nil {
+		return err
+	}
+	r.C = *conf
+	return nil
+}
+
+func (r *memoryRepo) GetConfigKey(key string) (interface{}, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	mapconf, err := config.ToMap(&r.C)
+	if err != nil {
+		return nil, err
+	}
+	return common.MapGetKV(mapconf, key)
+}
+
+// SwarmKey returns the key of the private ethoFS network in the swarm.key
+// file format.
+func (r *memoryRepo) SwarmKey() ([]byte, error) {
+	return []byte(encodeSwarmKey(r.swarmKey)), nil
+}
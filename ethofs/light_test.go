@@ -0,0 +1,39 @@
+package ethofs
+
+import (
+	"testing"
+)
+
+func TestMemoryRepo(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.Light, cfg.Routing = true, "none"
+
+	r, err := newMemoryRepo(&cfg)
+	if err != nil {
+		t.Fatalf("failed to create repo: %v", err)
+	}
+	conf, err := r.Config()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if conf.Routing.Type != "none" || conf.Reprovider.Interval != "0" {
+		t.Fatalf("light config mismatch: routing %q, reprovide interval %q", conf.Routing.Type, conf.Reprovider.Interval)
+	}
+	if err := r.SetConfigKey("Datastore.StorageMax", "1GB"); err != nil {
+		t.Fatalf("failed to set config key: %v", err)
+	}
+	if have, err := r.GetConfigKey("Datastore.StorageMax"); err != nil || have != "1GB" {
+		t.Fatalf("config key mismatch: have %v (err %v), want 1GB", have, err)
+	}
+	data, err := r.SwarmKey()
+	if err != nil {
+		t.Fatalf("failed to load swarm key: %v", err)
+	}
+	key, err := decodeSwarmKey(data)
+	if err != nil {
+		t.Fatalf("invalid swarm key: %v", err)
+	}
+	if len(key) != 32 {
+		t.Fatalf("swarm key length mismatch: have %d, want 32", len(key))
+	}
+}
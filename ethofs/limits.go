@@ -0,0 +1,343 @@
+package ethofs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/ipfs/go-ipfs/core"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	ipfslibp2p "github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"golang.org/x/time/rate"
+)
+
+// minLimiterBurst is the smallest burst of a bandwidth limiter, so small rates
+// do not split transfers into tiny chunks.
+const minLimiterBurst = 64 * KB
+
+var rejectedConnMeter = metrics.NewRegisteredMeter("ethofs/swarm/conns/rejected", nil)
+
+// transferLimiter throttles Unixfs transfers through the gateway and the RPC
+// API. Nil means unlimited.
+var transferLimiter *rate.Limiter
+
+// newBandwidthLimiter creates a limiter for the given humanized rate per
+// second, or nil if the rate is empty.
+func newBandwidthLimiter(bandwidth string) (*rate.Limiter, error) {
+	if bandwidth == "" {
+		return nil, nil
+	}
+	bps, err := humanize.ParseBytes(bandwidth)
+	if err != nil || bps == 0 {
+		return nil, err
+	}
+	burst := int(bps)
+	if burst < minLimiterBurst {
+		burst = minLimiterBurst
+	}
+	return rate.NewLimiter(rate.Limit(bps), burst), nil
+}
+
+// configConnManager writes the configured connection manager watermarks to the
+// repo config, keeping the stored ones for unset values.
+func configConnManager(r repo.Repo, cfg *ResourceConfig) error {
+	if cfg.ConnLowWater == 0 && cfg.ConnHighWater == 0 && cfg.ConnGracePeriod == 0 {
+		return nil
+	}
+	repoCfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	connMgr := repoCfg.Swarm.ConnMgr
+	connMgr.Type = "basic"
+	if cfg.ConnLowWater != 0 {
+		connMgr.LowWater = cfg.ConnLowWater
+	}
+	if cfg.ConnHighWater != 0 {
+		connMgr.HighWater = cfg.ConnHighWater
+	}
+	if cfg.ConnGracePeriod != 0 {
+		connMgr.GracePeriod = cfg.ConnGracePeriod.String()
+	}
+	if connMgr.LowWater > connMgr.HighWater {
+		return fmt.Errorf("connection manager low watermark %d above high watermark %d", connMgr.LowWater, connMgr.HighWater)
+	}
+	return r.SetConfigKey("Swarm.ConnMgr", connMgr)
+}
+
+// waitBandwidth blocks until the limiter allows n more bytes.
+func waitBandwidth(ctx context.Context, limiter *rate.Limiter, n int) error {
+	for n > 0 {
+		chunk := n
+		if chunk > limiter.Burst() {
+			chunk = limiter.Burst()
+		}
+		if err := limiter.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// limitedReader throttles reads with a bandwidth limiter.
+type limitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *rate.Limiter
+}
+
+// newLimitedReader wraps the reader with the transfer limiter, if any.
+func newLimitedReader(ctx context.Context, r io.Reader) io.Reader {
+	if transferLimiter == nil {
+		return r
+	}
+	return &limitedReader{ctx: ctx, reader: r, limiter: transferLimiter}
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > r.limiter.Burst() {
+		p = p[:r.limiter.Burst()]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if werr := waitBandwidth(r.ctx, r.limiter, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// limitedResponse throttles the body of a gateway response.
+type limitedResponse struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+func (w *limitedResponse) Write(data []byte) (int, error) {
+	var written int
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > w.limiter.Burst() {
+			chunk = chunk[:w.limiter.Burst()]
+		}
+		if err := waitBandwidth(w.ctx, w.limiter, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		data = data[n:]
+	}
+	return written, nil
+}
+
+// transferLimitOption throttles all gateway responses with the transfer
+// limiter.
+func transferLimitOption(limiter *rate.Limiter) corehttp.ServeOption {
+	return func(_ *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			childMux.ServeHTTP(&limitedResponse{ResponseWriter: w, ctx: r.Context(), limiter: limiter}, r)
+		})
+		return childMux, nil
+	}
+}
+
+// limitedHost wraps a libp2p host, throttling the streams of every peer with
+// per-peer bandwidth limiters and capping the number of open connections.
+type limitedHost struct {
+	host.Host
+
+	bps      rate.Limit
+	burst    int
+	maxConns int
+
+	lock  sync.Mutex
+	peers map[peer.ID]*peerLimiter
+}
+
+// peerLimiter holds the bandwidth limiters of a single peer.
+type peerLimiter struct {
+	in, out *rate.Limiter
+}
+
+// limitedHostOption constructs the default host wrapped with the configured
+// resource limits, gating its connections with the peer denylist and the peer
+// allow-list of strict mode nodes.
+func limitedHostOption(cfg *ResourceConfig) (ipfslibp2p.HostOption, error) {
+	peerLimit, err := newBandwidthLimiter(cfg.PeerBandwidth)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, id peer.ID, ps peerstore.Peerstore, options ...libp2p.Option) (host.Host, error) {
+		options = append(options, gateSwarm(&swarmGater{deny: currentDenylist(), allow: currentAllowlist()}))
+		h, err := ipfslibp2p.DefaultHostOption(ctx, id, ps, options...)
+		if err != nil {
+			return nil, err
+		}
+		return newLimitedHost(wrapChaos(h), peerLimit, cfg.MaxConnections), nil
+	}, nil
+}
+
+func newLimitedHost(h host.Host, peerLimit *rate.Limiter, maxConns int) host.Host {
+	if peerLimit == nil && maxConns == 0 {
+		return h
+	}
+	lh := &limitedHost{
+		Host:     h,
+		maxConns: maxConns,
+		peers:    make(map[peer.ID]*peerLimiter),
+	}
+	if peerLimit != nil {
+		lh.bps, lh.burst = peerLimit.Limit(), peerLimit.Burst()
+	}
+	h.Network().Notify(&network.NotifyBundle{
+		ConnectedF:    lh.connected,
+		DisconnectedF: lh.disconnected,
+	})
+	return lh
+}
+
+// connected closes connections exceeding the connection cap. Outbound
+// connections are kept, the node asked for them.
+func (h *limitedHost) connected(n network.Network, c network.Conn) {
+	if h.maxConns == 0 || c.Stat().Direction != network.DirInbound {
+		return
+	}
+	if len(n.Conns()) > h.maxConns {
+		rejectedConnMeter.Mark(1)
+		log.Trace("ethoFS - connection limit reached, closing inbound connection", "peer", c.RemotePeer(), "limit", h.maxConns)
+		go c.Close()
+	}
+}
+
+// disconnected drops the limiters of peers without remaining connections.
+func (h *limitedHost) disconnected(n network.Network, c network.Conn) {
+	if n.Connectedness(c.RemotePeer()) == network.Connected {
+		return
+	}
+	h.lock.Lock()
+	delete(h.peers, c.RemotePeer())
+	h.lock.Unlock()
+}
+
+// limiter returns the bandwidth limiters of the peer, or nil if peers are not
+// throttled.
+func (h *limitedHost) limiter(id peer.ID) *peerLimiter {
+	if h.bps == 0 {
+		return nil
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	l, ok := h.peers[id]
+	if !ok {
+		l = &peerLimiter{
+			in:  rate.NewLimiter(h.bps, h.burst),
+			out: rate.NewLimiter(h.bps, h.burst),
+		}
+		h.peers[id] = l
+	}
+	return l
+}
+
+func (h *limitedHost) wrap(s network.Stream) network.Stream {
+	if l := h.limiter(s.Conn().RemotePeer()); l != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		return &limitedStream{Stream: s, limits: l, ctx: ctx, cancel: cancel}
+	}
+	return s
+}
+
+// NewStream implements host.Host, throttling the opened stream.
+func (h *limitedHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (network.Stream, error) {
+	s, err := h.Host.NewStream(ctx, p, pids...)
+	if err != nil {
+		return nil, err
+	}
+	return h.wrap(s), nil
+}
+
+// SetStreamHandler implements host.Host, throttling the handled streams.
+func (h *limitedHost) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
+	h.Host.SetStreamHandler(pid, func(s network.Stream) { handler(h.wrap(s)) })
+}
+
+// SetStreamHandlerMatch implements host.Host, throttling the handled streams.
+func (h *limitedHost) SetStreamHandlerMatch(pid protocol.ID, match func(string) bool, handler network.StreamHandler) {
+	h.Host.SetStreamHandlerMatch(pid, match, func(s network.Stream) { handler(h.wrap(s)) })
+}
+
+// limitedStream throttles a libp2p stream with the limiters of its peer. Reads
+// and writes waiting for bandwidth are aborted when the stream is closed or
+// reset.
+type limitedStream struct {
+	network.Stream
+	limits *peerLimiter
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (s *limitedStream) Read(p []byte) (int, error) {
+	if len(p) > s.limits.in.Burst() {
+		p = p[:s.limits.in.Burst()]
+	}
+	n, err := s.Stream.Read(p)
+	if n > 0 {
+		if werr := waitBandwidth(s.ctx, s.limits.in, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (s *limitedStream) Write(data []byte) (int, error) {
+	var written int
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > s.limits.out.Burst() {
+			chunk = chunk[:s.limits.out.Burst()]
+		}
+		if err := waitBandwidth(s.ctx, s.limits.out, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := s.Stream.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		data = data[n:]
+	}
+	return written, nil
+}
+
+// Close implements network.Stream, aborting pending bandwidth waits.
+func (s *limitedStream) Close() error {
+	s.cancel()
+	return s.Stream.Close()
+}
+
+// Reset implements network.Stream, aborting pending bandwidth waits.
+func (s *limitedStream) Reset() error {
+	s.cancel()
+	return s.Stream.Reset()
+}
@@ -0,0 +1,93 @@
+package ethofs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"golang.org/x/time/rate"
+)
+
+func TestBandwidthLimiter(t *testing.T) {
+	tests := []struct {
+		bandwidth string
+		limit     rate.Limit
+		burst     int
+		fail      bool
+	}{
+		{bandwidth: ""},
+		{bandwidth: "1MB", limit: 1000000, burst: 1000000},
+		{bandwidth: "2MiB", limit: 2 * MB, burst: 2 * MB},
+		{bandwidth: "1KB", limit: 1000, burst: minLimiterBurst},
+		{bandwidth: "fast", fail: true},
+	}
+	for _, tt := range tests {
+		limiter, err := newBandwidthLimiter(tt.bandwidth)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.bandwidth)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.bandwidth, err)
+			continue
+		}
+		if tt.limit == 0 {
+			if limiter != nil {
+				t.Errorf("%q: expected no limiter", tt.bandwidth)
+			}
+			continue
+		}
+		if limiter.Limit() != tt.limit || limiter.Burst() != tt.burst {
+			t.Errorf("%q: limiter mismatch: have %v/%d, want %v/%d", tt.bandwidth, limiter.Limit(), limiter.Burst(), tt.limit, tt.burst)
+		}
+	}
+}
+
+func TestResourceConfigValidate(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.Resources = ResourceConfig{ConnLowWater: 100, ConnHighWater: 50}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for inverted watermarks")
+	}
+	cfg.Resources = ResourceConfig{ConnLowWater: 50, ConnHighWater: 100, PeerBandwidth: "512KB"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// discardStream is a stream swallowing all writes.
+type discardStream struct {
+	network.Stream
+}
+
+func (discardStream) Write(p []byte) (int, error) { return len(p), nil }
+func (discardStream) Close() error                { return nil }
+
+func TestLimitedStreamClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &limitedStream{
+		Stream: discardStream{},
+		limits: &peerLimiter{out: rate.NewLimiter(1, 1)},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	errc := make(chan error)
+	go func() {
+		_, err := s.Write(make([]byte, 16))
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	s.Close()
+
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Errorf("throttled write succeeded after close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("throttled write not aborted by close")
+	}
+}
@@ -0,0 +1,257 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+	car "github.com/ipld/go-car"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/helpers"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// migrateProtocol is the libp2p protocol streaming a DAG as a CAR file to a
+// node taking over its hosting. The target pins the root and confirms with a
+// replication response carrying a signed receipt once it holds the complete
+// DAG.
+const migrateProtocol = protocol.ID("/ethofs/migrate/1.0.0")
+
+// migrateTimeout bounds the transfer and verification of a single DAG.
+const migrateTimeout = 30 * time.Minute
+
+var (
+	errNotMigrationSource      = errors.New("peer is not a configured migration source")
+	errInvalidMigrationReceipt = errors.New("migration receipt not signed by the target")
+)
+
+// MigrateFilter selects the pinned DAGs migrated to another node.
+type MigrateFilter struct {
+	Roots []string `json:"roots"` // Recursively pinned CIDs to migrate, all of them if empty
+}
+
+// MigrateResult is the outcome of migrating a single DAG.
+type MigrateResult struct {
+	Cid      string `json:"cid"`
+	Migrated bool   `json:"migrated"`        // The target confirmed holding and pinning the DAG
+	Unpinned bool   `json:"unpinned"`        // The DAG was unpinned locally afterwards
+	Error    string `json:"error,omitempty"` // Why the migration or the unpin failed
+}
+
+// migrationSources returns the peer IDs accepted as migration sources.
+func migrationSources(ids []string) (map[peer.ID]struct{}, error) {
+	sources := make(map[peer.ID]struct{}, len(ids))
+	for _, id := range ids {
+		pid, err := peer.Decode(id)
+		if err != nil {
+			return nil, err
+		}
+		sources[pid] = struct{}{}
+	}
+	return sources, nil
+}
+
+// migrationReceipt returns the statement the target of a migration signs with
+// its peer key once it pinned the roots sent by the source, so the source
+// only unpins content the target provably took over.
+func migrationReceipt(source peer.ID, roots []cid.Cid) []byte {
+	hashes := make([]string, len(roots))
+	for i, root := range roots {
+		hashes[i] = root.String()
+	}
+	return []byte("ethofs-migrate:" + peer.Encode(source) + ":" + strings.Join(hashes, ","))
+}
+
+// verifyMigrationReceipt checks the signature of the target over the receipt
+// of the migrated roots.
+func verifyMigrationReceipt(target peer.ID, pub ci.PubKey, source peer.ID, roots []cid.Cid, sig []byte) error {
+	if pub == nil {
+		var err error
+		if pub, err = target.ExtractPublicKey(); err != nil || pub == nil {
+			return errInvalidMigrationReceipt
+		}
+	}
+	if !target.MatchesPublicKey(pub) {
+		return errInvalidMigrationReceipt
+	}
+	if ok, err := pub.Verify(migrationReceipt(source, roots), sig); err != nil || !ok {
+		return errInvalidMigrationReceipt
+	}
+	return nil
+}
+
+// serveMigration accepts the DAGs streamed by the configured migration
+// sources, pinning them before confirming.
+func serveMigration(node *core.IpfsNode, ids []string) error {
+	sources, err := migrationSources(ids)
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+	node.PeerHost.SetStreamHandler(migrateProtocol, func(s network.Stream) {
+		defer s.Close()
+
+		remote := s.Conn().RemotePeer()
+		if _, ok := sources[remote]; !ok {
+			log.Debug("ethoFS - rejected migration", "peer", remote, "error", errNotMigrationSource)
+			s.Reset()
+			return
+		}
+		s.SetDeadline(time.Now().Add(migrateTimeout))
+
+		ctx, cancel := context.WithTimeout(node.Context(), migrateTimeout)
+		roots, err := importCAR(ctx, node, s)
+		cancel()
+
+		var res replicateResponse
+		if err == nil {
+			res.Signature, err = node.PrivateKey.Sign(migrationReceipt(remote, roots))
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		log.Info("ethoFS - received migrated content", "roots", roots, "peer", remote, "error", err)
+		json.NewEncoder(s).Encode(&res)
+	})
+	return nil
+}
+
+// migrateTo streams the DAG below root to the target as a CAR file and waits
+// for the receipt of the target confirming it pinned it. Unlike ExportCAR,
+// blocks missing locally are fetched from the swarm.
+func migrateTo(ctx context.Context, node *core.IpfsNode, target peer.ID, root cid.Cid) error {
+	ctx, cancel := context.WithTimeout(ctx, migrateTimeout)
+	defer cancel()
+
+	s, err := node.PeerHost.NewStream(ctx, target, migrateProtocol)
+	if err != nil {
+		return err
+	}
+	defer helpers.FullClose(s)
+
+	s.SetDeadline(time.Now().Add(migrateTimeout))
+	if err := car.WriteCar(ctx, currentDAGWorkers().getter(node.DAG), []cid.Cid{root}, s); err != nil {
+		s.Reset()
+		return err
+	}
+	// Closing the stream for writing ends the CAR file of the target
+	if err := s.Close(); err != nil {
+		s.Reset()
+		return err
+	}
+	var res replicateResponse
+	if err := json.NewDecoder(io.LimitReader(s, maxReplicateMessageSize)).Decode(&res); err != nil {
+		s.Reset()
+		if err == io.EOF {
+			return errReplicateEmpty
+		}
+		return err
+	}
+	if res.Error != "" {
+		return errors.New(res.Error)
+	}
+	return verifyMigrationReceipt(target, node.Peerstore.PubKey(target), node.Identity, []cid.Cid{root}, res.Signature)
+}
+
+// parseMigrationTarget accepts a peer ID or a multiaddr ending in one.
+func parseMigrationTarget(target string) (*peer.AddrInfo, error) {
+	if id, err := peer.Decode(target); err == nil {
+		return &peer.AddrInfo{ID: id}, nil
+	}
+	addr, err := ma.NewMultiaddr(target)
+	if err != nil {
+		return nil, err
+	}
+	return peer.AddrInfoFromP2pAddr(addr)
+}
+
+// Migrate streams the selected pinned DAGs one by one to the target node,
+// which has to list this node among its migration sources. Once the target
+// confirmed holding a DAG, it is unpinned locally if unpin is set, so
+// hardware can be decommissioned without losing content.
+func (s *EthofsService) Migrate(ctx context.Context, target string, filter MigrateFilter, unpin bool) ([]MigrateResult, error) {
+	node, err := s.onlineNode()
+	if err != nil {
+		return nil, err
+	}
+	ipfs := s.API()
+	info, err := parseMigrationTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	err = node.PeerHost.Connect(ctx, *info)
+	dialFailures.record("migrate", info.ID, err)
+	if err != nil {
+		return nil, err
+	}
+	var roots []cid.Cid
+	if len(filter.Roots) > 0 {
+		for _, hash := range filter.Roots {
+			c, err := cid.Decode(hash)
+			if err != nil {
+				return nil, err
+			}
+			roots = append(roots, c)
+		}
+	} else {
+		pins, err := ipfs.Pin().Ls(ctx, options.Pin.Ls.Recursive())
+		if err != nil {
+			return nil, err
+		}
+		for pin := range pins {
+			if err := pin.Err(); err != nil {
+				return nil, err
+			}
+			roots = append(roots, pin.Path().Cid())
+		}
+	}
+	results := make([]MigrateResult, 0, len(roots))
+	for _, root := range roots {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		result := MigrateResult{Cid: root.String()}
+		if err := migrateTo(ctx, node, info.ID, root); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Migrated = true
+			if unpin {
+				if err := ipfs.Pin().Rm(ctx, path.IpfsPath(root)); err != nil {
+					result.Error = err.Error()
+				} else {
+					result.Unpinned = true
+					localPins.remove(root)
+				}
+			}
+		}
+		log.Info("ethoFS - migrated content", "cid", root, "target", info.ID, "unpinned", result.Unpinned, "error", result.Error)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Migrate streams the selected pinned DAGs (all recursive pins if no roots
+// are given) to the target peer, optionally unpinning them locally once the
+// target confirmed receipt.
+func (api *PrivateEthofsAPI) Migrate(ctx context.Context, target string, filter *MigrateFilter, unpin bool) (_ []MigrateResult, err error) {
+	defer trackCall("migrate", time.Now(), &err)
+
+	if filter == nil {
+		filter = new(MigrateFilter)
+	}
+	return api.service.Migrate(ctx, target, *filter, unpin)
+}
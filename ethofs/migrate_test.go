@@ -0,0 +1,102 @@
+package ethofs
+
+import (
+	"crypto/rand"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestParseMigrationTarget(t *testing.T) {
+	_, pub, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatalf("failed to derive peer ID: %v", err)
+	}
+	tests := []struct {
+		target string
+		addrs  int
+		fail   bool
+	}{
+		{target: id.Pretty()},
+		{target: "/ip4/10.0.0.1/tcp/4001/p2p/" + id.Pretty(), addrs: 1},
+		{target: "/ip4/10.0.0.1/tcp/4001", fail: true},
+		{target: "not a peer", fail: true},
+	}
+	for _, tt := range tests {
+		info, err := parseMigrationTarget(tt.target)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("%q: expected error, have %v", tt.target, info)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.target, err)
+			continue
+		}
+		if info.ID != id || len(info.Addrs) != tt.addrs {
+			t.Errorf("%q: target mismatch: have %v", tt.target, info)
+		}
+	}
+	if _, err := migrationSources([]string{id.Pretty(), "invalid"}); err == nil {
+		t.Error("invalid migration source accepted")
+	}
+}
+
+func TestMigrationReceipt(t *testing.T) {
+	identity := func() (crypto.PrivKey, peer.ID) {
+		priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		id, err := peer.IDFromPrivateKey(priv)
+		if err != nil {
+			t.Fatalf("failed to derive peer ID: %v", err)
+		}
+		return priv, id
+	}
+	targetKey, target := identity()
+	otherKey, source := identity()
+
+	root, err := cid.Decode("QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := cid.Decode("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(key crypto.PrivKey, source peer.ID, roots ...cid.Cid) []byte {
+		sig, err := key.Sign(migrationReceipt(source, roots))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	tests := []struct {
+		sig  []byte
+		fail bool
+	}{
+		{sig: sign(targetKey, source, root)},
+		{sig: sign(otherKey, source, root), fail: true},  // Signed by another peer
+		{sig: sign(targetKey, target, root), fail: true}, // Receipt for another source
+		{sig: sign(targetKey, source, other), fail: true},
+		{sig: nil, fail: true},
+	}
+	for i, tt := range tests {
+		err := verifyMigrationReceipt(target, nil, source, []cid.Cid{root}, tt.sig)
+		if tt.fail != (err != nil) {
+			t.Errorf("test %d: have %v, want failure %v", i, err, tt.fail)
+		}
+	}
+	// Known keys must belong to the target
+	if err := verifyMigrationReceipt(target, otherKey.GetPublic(), source, []cid.Cid{root}, sign(otherKey, source, root)); err != errInvalidMigrationReceipt {
+		t.Errorf("foreign key: have %v, want %v", err, errInvalidMigrationReceipt)
+	}
+}
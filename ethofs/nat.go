@@ -0,0 +1,121 @@
+package ethofs
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	config "github.com/ipfs/go-ipfs-config"
+	"github.com/ipfs/go-ipfs/repo"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// AutoNAT service modes, see NATConfig.AutoNAT.
+const (
+	autoNATEnabled  = "enabled"
+	autoNATDisabled = "disabled"
+)
+
+// withSwarmPort replaces the TCP and UDP ports of the listen addresses.
+func withSwarmPort(addrs []string, port int) ([]string, error) {
+	value := strconv.Itoa(port)
+	ported := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		maddr, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			return nil, err
+		}
+		parts := ma.Split(maddr)
+		for i, part := range parts {
+			switch code := part.Protocols()[0].Code; code {
+			case ma.P_TCP, ma.P_UDP:
+				if parts[i], err = ma.NewComponent(ma.ProtocolWithCode(code).Name, value); err != nil {
+					return nil, err
+				}
+			}
+		}
+		ported = append(ported, ma.Join(parts...).String())
+	}
+	return ported, nil
+}
+
+// applySwarmConfig writes the configured listen and announce addresses and
+// NAT traversal settings to the repo config. The ethoFS settings take
+// precedence over the ones stored in the repo, the test profile over both.
+// Unset NAT switches keep the repo settings.
+func applySwarmConfig(conf *config.Config, cfg *Config) error {
+	if len(cfg.SwarmAddresses) > 0 {
+		conf.Addresses.Swarm = cfg.SwarmAddresses
+	} else if cfg.NAT.Port != 0 {
+		addrs, err := withSwarmPort(conf.Addresses.Swarm, cfg.NAT.Port)
+		if err != nil {
+			return err
+		}
+		conf.Addresses.Swarm = addrs
+	}
+	if len(cfg.NAT.AnnounceAddresses) > 0 {
+		conf.Addresses.Announce = cfg.NAT.AnnounceAddresses
+	}
+	if len(cfg.NAT.NoAnnounceAddresses) > 0 {
+		conf.Addresses.NoAnnounce = cfg.NAT.NoAnnounceAddresses
+	}
+	for _, setting := range []struct {
+		value  *bool
+		stored *bool
+	}{
+		{cfg.NAT.DisablePortMap, &conf.Swarm.DisableNatPortMap},
+		{cfg.NAT.DisableRelay, &conf.Swarm.DisableRelay},
+		{cfg.NAT.AutoRelay, &conf.Swarm.EnableAutoRelay},
+		{cfg.NAT.RelayHop, &conf.Swarm.EnableRelayHop},
+	} {
+		if setting.value != nil {
+			*setting.stored = *setting.value
+		}
+	}
+	// Disabled relays take precedence over the relay features
+	if conf.Swarm.DisableRelay {
+		conf.Swarm.EnableAutoRelay, conf.Swarm.EnableRelayHop = false, false
+	}
+
+	switch cfg.NAT.AutoNAT {
+	case autoNATEnabled:
+		conf.AutoNAT.ServiceMode = config.AutoNATServiceEnabled
+	case autoNATDisabled:
+		conf.AutoNAT.ServiceMode = config.AutoNATServiceDisabled
+	}
+	if cfg.testing() {
+		applyTestProfile(conf, cfg)
+	}
+	return nil
+}
+
+// patchSwarmConfig applies the swarm settings to the on-disk config of an
+// existing repo, rewriting it only if they changed.
+func patchSwarmConfig(r repo.Repo, cfg *Config) error {
+	current, err := r.Config()
+	if err != nil {
+		return err
+	}
+	patched, err := current.Clone()
+	if err != nil {
+		return err
+	}
+	if err := applySwarmConfig(patched, cfg); err != nil {
+		return err
+	}
+	before, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	after, err := json.Marshal(patched)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(before, after) {
+		return nil
+	}
+	log.Info("ethoFS - updating swarm configuration", "listen", patched.Addresses.Swarm, "announce", patched.Addresses.Announce)
+	return r.SetConfig(patched)
+}
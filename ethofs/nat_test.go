@@ -0,0 +1,77 @@
+package ethofs
+
+import (
+	"reflect"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	config "github.com/ipfs/go-ipfs-config"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+func TestWithSwarmPort(t *testing.T) {
+	addrs := []string{"/ip4/0.0.0.0/tcp/4001", "/ip6/::/udp/4001/quic", "/ip4/127.0.0.1/tcp/0/ws"}
+	have, err := withSwarmPort(addrs, 14001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/ip4/0.0.0.0/tcp/14001", "/ip6/::/udp/14001/quic", "/ip4/127.0.0.1/tcp/14001/ws"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("ported addresses mismatch: have %v, want %v", have, want)
+	}
+	if _, err := withSwarmPort([]string{"not a multiaddr"}, 14001); err == nil {
+		t.Error("ported invalid address")
+	}
+}
+
+func TestPatchSwarmConfig(t *testing.T) {
+	r := &repo.Mock{
+		C: config.Config{Addresses: config.Addresses{Swarm: []string{"/ip4/0.0.0.0/tcp/4001"}}},
+		D: dsync.MutexWrap(datastore.NewMapDatastore()),
+	}
+	enabled := true
+	cfg := &Config{NAT: NATConfig{
+		Port:              4002,
+		AnnounceAddresses: []string{"/ip4/203.0.113.7/tcp/4002"},
+		DisablePortMap:    &enabled,
+		AutoRelay:         &enabled,
+		AutoNAT:           autoNATDisabled,
+	}}
+	if err := patchSwarmConfig(r, cfg); err != nil {
+		t.Fatal(err)
+	}
+	conf, _ := r.Config()
+	if want := []string{"/ip4/0.0.0.0/tcp/4002"}; !reflect.DeepEqual(conf.Addresses.Swarm, want) {
+		t.Errorf("listen addresses mismatch: have %v, want %v", conf.Addresses.Swarm, want)
+	}
+	if !reflect.DeepEqual(conf.Addresses.Announce, cfg.NAT.AnnounceAddresses) {
+		t.Errorf("announce addresses mismatch: have %v, want %v", conf.Addresses.Announce, cfg.NAT.AnnounceAddresses)
+	}
+	if !conf.Swarm.DisableNatPortMap || !conf.Swarm.EnableAutoRelay || conf.AutoNAT.ServiceMode != config.AutoNATServiceDisabled {
+		t.Errorf("NAT settings not applied: %+v, %+v", conf.Swarm, conf.AutoNAT)
+	}
+	// Explicit listen addresses take precedence over the port, disabled
+	// relays over the relay features
+	cfg.SwarmAddresses = []string{"/ip4/0.0.0.0/tcp/5001"}
+	cfg.NAT.DisableRelay = &enabled
+	if err := patchSwarmConfig(r, cfg); err != nil {
+		t.Fatal(err)
+	}
+	conf, _ = r.Config()
+	if !reflect.DeepEqual(conf.Addresses.Swarm, cfg.SwarmAddresses) {
+		t.Errorf("listen addresses mismatch: have %v, want %v", conf.Addresses.Swarm, cfg.SwarmAddresses)
+	}
+	if !conf.Swarm.DisableRelay || conf.Swarm.EnableAutoRelay {
+		t.Errorf("relay settings mismatch: %+v", conf.Swarm)
+	}
+	// Unset switches keep the settings stored in the repo
+	r.C.Swarm = config.SwarmConfig{DisableNatPortMap: true, EnableRelayHop: true}
+	if err := patchSwarmConfig(r, &Config{}); err != nil {
+		t.Fatal(err)
+	}
+	conf, _ = r.Config()
+	if !conf.Swarm.DisableNatPortMap || !conf.Swarm.EnableRelayHop || conf.Swarm.DisableRelay {
+		t.Errorf("stored NAT settings not kept: %+v", conf.Swarm)
+	}
+}
@@ -8,8 +8,11 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	config "github.com/ipfs/go-ipfs-config"
 	files "github.com/ipfs/go-ipfs-files"
@@ -46,8 +49,21 @@ var errRepoExists = errors.New(`ipfs configuration file already exists!
 Reinitializing would overwrite your keys.
 `)
 
+var (
+	pluginsOnce sync.Once
+	pluginsErr  error
+)
+
 // Setting up the ethoFS/IPFS Repo
 func setupPlugins(externalPluginsPath string) error {
+	// Plugins can only be injected once per process, restarts reuse them
+	pluginsOnce.Do(func() {
+		pluginsErr = loadPlugins(externalPluginsPath)
+	})
+	return pluginsErr
+}
+
+func loadPlugins(externalPluginsPath string) error {
 	// Load any external plugins if available on externalPluginsPath
 	plugins, err := loader.NewPluginLoader(filepath.Join(externalPluginsPath, "plugins"))
 	if err != nil {
@@ -87,45 +103,142 @@ func createTempRepo(ctx context.Context) (string, error) {
 	return repoPath, nil
 }
 
+// swarmPeersLogInterval is the minimum time between two peer listings logged
+// at info level, bootstraps and reconnects may run in quick succession.
+const swarmPeersLogInterval = 10 * time.Minute
+
+// swarmPeersLogged is the time of the last peer listing logged at info level,
+// in nanoseconds since the epoch.
+var swarmPeersLogged int64
+
+// swarmPeers logs the connected peers, at info level at most once per
+// swarmPeersLogInterval.
 func swarmPeers(api icore.CoreAPI) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	conns, err := api.Swarm().Peers(ctx)
 	if err != nil {
-		log.Error("ethoFS - peer swarming has failed")
+		log.Error("ethoFS - peer swarming has failed", "error", err)
+		return
+	}
+	logPeer := log.Debug
+	now, last := time.Now().UnixNano(), atomic.LoadInt64(&swarmPeersLogged)
+	if now-last >= int64(swarmPeersLogInterval) && atomic.CompareAndSwapInt64(&swarmPeersLogged, last, now) {
+		logPeer = log.Info
 	}
-
 	for _, c := range conns {
 		addr := c.Address().String()
 		peer := c.ID().Pretty()
-		log.Info("ethoFS - peer connection found", "addr", addr, "id", peer)
+		logPeer("ethoFS - peer connection found", "addr", addr, "id", peer)
 	}
 }
 
 // Creates an ethoFS/IPFS node and returns its coreAPI
 func createNode(ctx context.Context, repoPath string) (icore.CoreAPI, *core.IpfsNode, error) {
 	// Open the repo
-	repo, err := fsrepo.Open(repoPath)
+	repo, err := openRepo(repoPath)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	// Construct the node
 
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, nil, err
+	}
+	checkBlockstoreType(cfg, &ethofsConfig.Blockstore)
+
+	routingType := cfg.Routing.Type
+	if ethofsConfig.Routing != "" {
+		routingType = ethofsConfig.Routing
+	}
+
 	nodeOptions := &core.BuildCfg{
-		Online: true,
+		Online: !ethofsConfig.Offline,
 		// This option sets the node to be a full DHT node (both fetching and storing DHT Records)
 		Routing: libp2p.DHTOption,
+		Repo:    repo,
+		ExtraOpts: map[string]bool{
+			"pubsub": !ethofsConfig.PubSub.Disabled,
+			"ipnsps": ethofsConfig.PubSub.IPNS && !ethofsConfig.PubSub.Disabled,
+		},
+	}
+	if ethofsConfig.PubSub.Router != "" {
+		if err := repo.SetConfigKey("Pubsub.Router", ethofsConfig.PubSub.Router); err != nil {
+			return nil, nil, err
+		}
+	}
+	switch routingType {
+	case "dhtclient":
 		// This option sets the node to be a client DHT node (only fetching records)
-		// Routing: libp2p.DHTClientOption,
-		Repo: repo,
+		nodeOptions.Routing = libp2p.DHTClientOption
+	case "none":
+		// Content is only exchanged with directly connected peers
+		nodeOptions.Routing = libp2p.NilRouterOption
+	}
+	denylist, err := loadDenylist(repo.Datastore())
+	if err != nil {
+		repo.Close()
+		return nil, nil, err
+	}
+	setDenylist(denylist)
+	if nodeOptions.Host, err = limitedHostOption(&ethofsConfig.Resources); err != nil {
+		repo.Close()
+		return nil, nil, err
+	}
+	if transferLimiter, err = newBandwidthLimiter(ethofsConfig.Resources.TransferBandwidth); err != nil {
+		repo.Close()
+		return nil, nil, err
 	}
 
 	node, err := core.NewNode(ctx, nodeOptions)
 	if err != nil {
 		return nil, nil, err
 	}
+	node.Pinning = &indexingPinner{Pinner: node.Pinning, index: localPins}
+
+	missingContent = nil
+	if !ethofsConfig.NotFoundCache.Disabled {
+		missingContent = newNotFoundCache(node.Repo.Datastore(), node.Blockstore, &ethofsConfig.NotFoundCache)
+	}
+	setDAGWorkers(newDAGBudget(ethofsConfig.DAGWorkers, node.Blockstore))
+	var hints *providerHintCache
+	if ethofsConfig.ProviderRegistry != "" {
+		if hints, err = newProviderHintCache(node, ethofsConfig.ProviderRegistry); err != nil {
+			node.Close()
+			return nil, nil, err
+		}
+	}
+	setProviderHints(hints)
+	signatures, err := newSignatureVerifier(&ethofsConfig.Signatures)
+	if err != nil {
+		node.Close()
+		return nil, nil, err
+	}
+	setSignatures(signatures)
+	var popularity *popularityTracker
+	if ethofsConfig.PubSub.Popularity && !ethofsConfig.PubSub.Disabled {
+		if popularity, err = newPopularityTracker(node); err != nil {
+			node.Close()
+			return nil, nil, err
+		}
+	}
+	setPopularity(popularity)
+	if !ethofsConfig.IPNSCache.Disabled {
+		cache, err := newIPNSCache(node.Context(), node.Namesys, &ethofsConfig.IPNSCache)
+		if err != nil {
+			node.Close()
+			return nil, nil, err
+		}
+		node.Namesys = cache
+	}
+	cache, _ := node.Namesys.(*ipnsCache)
+	if err := watchIPNSUpdates(node, cache); err != nil {
+		node.Close()
+		return nil, nil, err
+	}
 
 	// Attach the Core API to the constructed node
 	api, apiErr := coreapi.NewCoreAPI(node)
@@ -134,7 +247,7 @@ func createNode(ctx context.Context, repoPath string) (icore.CoreAPI, *core.Ipfs
 
 // Spawns a node on the default repo location, if the repo exists
 func spawnDefault(ctx context.Context) (icore.CoreAPI, *core.IpfsNode, error) {
-	defaultPath := defaultDataDir + "/ethofs"
+	defaultPath := ethofsConfig.repoPath()
 
 	if err := setupPlugins(defaultPath); err != nil {
 		return nil, nil, err
@@ -144,17 +257,17 @@ func spawnDefault(ctx context.Context) (icore.CoreAPI, *core.IpfsNode, error) {
 	return createNode(ctx, defaultPath)
 }
 
-func connectToPeers(ctx context.Context, ipfs icore.CoreAPI, peers []string) error {
-	var wg sync.WaitGroup
+// parsePeerAddrs groups the multiaddrs of the given peers by peer ID.
+func parsePeerAddrs(peers []string) (map[peer.ID]*peerstore.PeerInfo, error) {
 	peerInfos := make(map[peer.ID]*peerstore.PeerInfo, len(peers))
 	for _, addrStr := range peers {
 		addr, err := ma.NewMultiaddr(addrStr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		pii, err := peerstore.InfoFromP2pAddr(addr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		pi, ok := peerInfos[pii.ID]
 		if !ok {
@@ -163,24 +276,45 @@ func connectToPeers(ctx context.Context, ipfs icore.CoreAPI, peers []string) err
 		}
 		pi.Addrs = append(pi.Addrs, pii.Addrs...)
 	}
+	return peerInfos, nil
+}
+
+// connectToPeers dials the given peers concurrently and reports the outcome
+// of every dial. It fails with a *BootstrapError if fewer than the required
+// number of peers (or all of them, if there are less) could be connected.
+func connectToPeers(ctx context.Context, ipfs icore.CoreAPI, peers []string, required int) ([]PeerResult, error) {
+	var wg sync.WaitGroup
+	peerInfos, err := parsePeerAddrs(peers)
+	if err != nil {
+		return nil, err
+	}
 
-	wg.Add(len(peerInfos))
+	results := make([]PeerResult, 0, len(peerInfos))
 	for _, peerInfo := range peerInfos {
-		go func(peerInfo *peerstore.PeerInfo) {
+		results = append(results, PeerResult{ID: peerInfo.ID})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+
+	wg.Add(len(results))
+	for i := range results {
+		go func(result *PeerResult) {
 			defer wg.Done()
-			err := ipfs.Swarm().Connect(ctx, *peerInfo)
-			if err != nil {
-				log.Debug("ethoFS - peer connection has failed", "node", peerInfo.ID, "message", err)
+			start := time.Now()
+			result.Err = ipfs.Swarm().Connect(ctx, *peerInfos[result.ID])
+			result.Latency = time.Since(start)
+			dialFailures.record("bootstrap", result.ID, result.Err)
+			if result.Err != nil {
+				log.Debug("ethoFS - peer connection has failed", "node", result.ID, "message", result.Err)
 			} else {
-				log.Info("ethoFS - peer connection was successful", "node", peerInfo.ID)
+				log.Info("ethoFS - peer connection was successful", "node", result.ID, "latency", result.Latency)
 			}
-		}(peerInfo)
+		}(&results[i])
 	}
 	wg.Wait()
 
 	go swarmPeers(ipfs)
 
-	return nil
+	return results, checkConnected(results, required)
 }
 
 func getUnixfsFile(path string) (files.File, error) {
@@ -257,6 +391,14 @@ func doInit(out io.Writer, repoRoot string, empty bool, nBitsForKeypair int, con
 		return err
 	}
 
+	if err := applyBlockstoreSpec(conf, &ethofsConfig.Blockstore); err != nil {
+		return err
+	}
+
+	if err := applySwarmConfig(conf, &ethofsConfig); err != nil {
+		return err
+	}
+
 	if err := fsrepo.Init(repoRoot, conf); err != nil {
 		return err
 	}
@@ -278,22 +420,10 @@ func doInit(out io.Writer, repoRoot string, empty bool, nBitsForKeypair int, con
 }
 
 func createSwarmKey(repoRoot string) error {
-	f, err := os.Create(repoRoot + "/swarm.key")
-	if err != nil {
+	if err := writeSwarmKey(repoRoot, initialSwarmKey(&ethofsConfig)); err != nil {
 		return err
 	}
-	_, err = f.WriteString("/key/swarm/psk/1.0.0/\n/base16/\n38307a74b2176d0054ffa2864e31ee22d0fc6c3266dd856f6d41bddf14e2ad63")
-	if err != nil {
-		f.Close()
-		return err
-	}
-
 	log.Info("ethoFS - swarm key has been created successfully")
-	err = f.Close()
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -314,8 +444,9 @@ func checkWritable(dir string) error {
 	}
 
 	if os.IsNotExist(err) {
-		// dir doesn't exist, check that we can create it
-		return os.Mkdir(dir, 0775)
+		// dir doesn't exist, check that we can create it along with its
+		// parents
+		return os.MkdirAll(dir, 0775)
 	}
 
 	if os.IsPermission(err) {
@@ -374,15 +505,21 @@ func initializeIpnsKeyspace(repoRoot string) error {
 
 func initializeEthofsRepo() error {
 
-	empty := true
-	nBitsForKeypair := nBitsForKeypairDefault
+	empty := !ethofsConfig.SeedAssets
+	nBitsForKeypair := ethofsConfig.keySize()
 
 	var conf *config.Config
+	if ethofsConfig.Seed != "" {
+		var err error
+		if conf, err = seededRepoConfig(ethofsConfig.Seed, ethofsConfig.SeedIndex); err != nil {
+			return err
+		}
+		log.Info("ethoFS - initializing repo from seed", "index", ethofsConfig.SeedIndex, "id", conf.Identity.PeerID)
+	}
 
-	profiles := "lowpower"
-	//profiles := "default-networking"
+	profiles := ethofsConfig.Profile
 
-	repoPath := defaultDataDir + "/ethofs"
+	repoPath := ethofsConfig.repoPath()
 
 	return doInit(os.Stdout, repoPath, empty, nBitsForKeypair, profiles, conf)
 }
@@ -406,20 +543,47 @@ func configEthofsNode(node *core.IpfsNode, nodeType string) error {
 	} else if nodeType == "gn" {
 		storageMax = "76GB"
 		routingType = "dht"
-		gatewayString := string("/ip4/0.0.0.0/tcp/80")
+	}
+	if ethofsConfig.gatewayEnabled() {
+		gatewayString := defaultGatewayAddr
+		if ethofsConfig.Seed != "" {
+			gatewayString = seedGatewayAddr(ethofsConfig.SeedIndex)
+		} else if ethofsConfig.testing() {
+			gatewayString = testListenAddr
+		}
+		if ethofsConfig.Gateway.ListenAddr != "" {
+			if gatewayString, err = gatewayMultiaddr(ethofsConfig.Gateway.ListenAddr); err != nil {
+				return err
+			}
+		}
 		if err := r.SetConfigKey("Addresses.Gateway", gatewayString); err != nil {
 			return err
 		}
 		cfg.Addresses.Gateway = config.Strings{gatewayString}
 	}
+	if ethofsConfig.Routing != "" {
+		routingType = ethofsConfig.Routing
+	}
+	if ethofsConfig.StorageMax != "" {
+		storageMax = ethofsConfig.StorageMax
+	}
 
 	if err := r.SetConfigKey("Datastore.StorageMax", storageMax); err != nil {
 		return err
 	}
 	cfg.Datastore.StorageMax = storageMax
+	if ethofsConfig.GCWatermark != 0 {
+		if err := r.SetConfigKey("Datastore.StorageGCWatermark", ethofsConfig.GCWatermark); err != nil {
+			return err
+		}
+		cfg.Datastore.StorageGCWatermark = int64(ethofsConfig.GCWatermark)
+	}
 	if err := r.SetConfigKey("Routing.Type", routingType); err != nil {
 		return err
 	}
+	if err := configConnManager(r, &ethofsConfig.Resources); err != nil {
+		return err
+	}
 	cfg.Routing.Type = routingType
 
 	return nil
@@ -442,7 +606,7 @@ func initializeGateway(node *core.IpfsNode) error {
 		listenerAddrs[string(listener.Multiaddr().Bytes())] = true
 	}
 
-	writable := cfg.Gateway.Writable
+	writable := cfg.Gateway.Writable && !ethofsConfig.Gateway.ReadOnly
 
 	gatewayAddrs := cfg.Addresses.Gateway
 	for _, addr := range gatewayAddrs {
@@ -476,82 +640,161 @@ func initializeGateway(node *core.IpfsNode) error {
 	var opts = []corehttp.ServeOption{
 		corehttp.MetricsCollectionOption("gateway"),
 		corehttp.HostnameOption(),
+		virtualHostOption(gatewayHosts),
+	}
+	opts = append(opts, pluginOptions()...)
+
+	if transferLimiter != nil {
+		opts = append(opts, transferLimitOption(transferLimiter))
+	}
+
+	if len(ethofsConfig.Gateway.PathWhitelist) > 0 {
+		opts = append(opts, pathWhitelistOption(ethofsConfig.Gateway.PathWhitelist))
+	}
+
+	if len(ethofsConfig.Gateway.ACL) > 0 {
+		opts = append(opts, aclOption(ethofsConfig.Gateway.ACL))
+	}
+
+	if signatures := currentSignatures(); signatures != nil {
+		opts = append(opts, signatureOption(signatures))
+	}
+
+	if ethofsConfig.Gateway.CachePolicy == cachePolicyNoStore {
+		opts = append(opts, noStoreOption())
+	}
+
+	if missingContent != nil {
+		opts = append(opts, notFoundOption(missingContent))
+	}
+	if hints := currentProviderHints(); hints != nil {
+		opts = append(opts, providerHintOption(hints))
+	}
+	if tracker := currentPopularity(); tracker != nil {
+		opts = append(opts, popularityOption(tracker))
+	}
+	if !ethofsConfig.Gateway.NoCoalesce {
+		opts = append(opts, coalesceOption())
+	}
+
+	if ethofsConfig.Gateway.Compression {
+		opts = append(opts, compressionOption(ethofsConfig.Gateway.CompressionCache))
+	}
+
+	if ethofsConfig.Gateway.SiteRouting || len(ethofsConfig.Gateway.SPARoots) > 0 {
+		opts = append(opts, siteRoutingOption(ethofsConfig.Gateway.SPARoots))
+	}
+
+	opts = append(opts,
 		corehttp.GatewayOption(writable, "/ipfs", "/ipns"),
 		corehttp.VersionOption(),
 		corehttp.CheckVersionOption(),
-	}
+	)
 
 	if cfg.Experimental.P2pHttpProxy {
 		opts = append(opts, corehttp.P2PProxyOption())
 	}
 
+	if ethofsConfig.Gateway.Previews {
+		opts = append(opts, previewOption())
+	}
+
 	if len(cfg.Gateway.RootRedirect) > 0 {
 		opts = append(opts, corehttp.RedirectOption("", cfg.Gateway.RootRedirect))
 	}
 
-	errc := make(chan error)
-	var wg sync.WaitGroup
+	// Gateway servers terminate when the node is closed
 	for _, lis := range listeners {
-		wg.Add(1)
 		go func(lis manet.Listener) {
-			defer wg.Done()
-			errc <- corehttp.Serve(node, manet.NetListener(lis), opts...)
+			if err := corehttp.Serve(node, manet.NetListener(lis), opts...); err != nil {
+				log.Debug("ethoFS - gateway server terminated", "addr", lis.Multiaddr(), "error", err)
+			}
 		}(lis)
 	}
 
-	go func() {
-		wg.Wait()
-		close(errc)
-	}()
-
 	return nil
 }
 
-func initializeEthofsNodeRepo(nodeType string) error {
+// repoInits lets a single run of each initialization step work on a repo at
+// a time: creating it, configuring it or spawning the node.
+var repoInits = newFlightGroup()
 
-	ctx := context.Background()
+// initRepoOnce runs the initialization step of the repo at path unless the
+// same step is already running on it. Concurrent callers wait for the running
+// one to finish and get its error, or ErrStarting if it succeeded, since its
+// outcome (e.g. a spawned node) belongs to the first caller only. Other steps
+// never share the outcome of a running one.
+func initRepoOnce(step string, path string, init func() error) error {
+	shared, err := repoInits.do(context.Background(), step+":"+path, func(context.Context) error { return init() })
+	if shared && err == nil {
+		return ErrStarting
+	}
+	return err
+}
 
-	log.Info("ethoFS - initializing ethoFS node on default repo path")
+func initializeEthofsNodeRepo(nodeType string) error {
+	return initRepoOnce("init", ethofsConfig.repoPath(), func() error {
+		log.Info("ethoFS - initializing ethoFS node on default repo path")
 
-	spawnDefault(ctx)
+		// The datastore plugins have to be loaded before the repo is created
+		if err := setupPlugins(ethofsConfig.repoPath()); err != nil {
+			return err
+		}
 
-	initErr := initializeEthofsRepo()
-	if initErr != errRepoExists && initErr != nil {
-		log.Error("ethoFS - unable to initalize ethoFS repo on default path", "error", initErr)
-		return initErr
-	}
+		initErr := initializeEthofsRepo()
+		if initErr == errRepoExists {
+			// Upgrade existing repos right away instead of at the next startup
+			return checkRepoVersion(ethofsConfig.repoPath(), &ethofsConfig.RepoMigration)
+		}
+		if initErr != nil {
+			log.Error("ethoFS - unable to initalize ethoFS repo on default path", "error", initErr)
+			return initErr
+		}
 
-	return nil
+		return nil
+	})
 }
 
 func initializeEthofsNodeConfig(nodeType string) error {
+	return initRepoOnce("config", ethofsConfig.repoPath(), func() error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
 
-	ctx := context.Background()
-
-	_, node, _ := spawnDefault(ctx)
+		_, node, err := spawnDefault(ctx)
+		if err != nil {
+			log.Warn("ethoFS - unable to open ethoFS node on default repo path", "error", err)
+			return err
+		}
+		defer node.Close()
 
-	err := configEthofsNode(node, nodeType)
-	if err != nil {
-		log.Warn("ethoFS - unable to set default node configuration", "error", err)
-		return err
-	} else {
-		log.Info("ethoFS - node default configuration setup complete")
-	}
+		err = configEthofsNode(node, nodeType)
+		if err != nil {
+			log.Warn("ethoFS - unable to set default node configuration", "error", err)
+			return err
+		} else {
+			log.Info("ethoFS - node default configuration setup complete")
+		}
 
-	return nil
+		return nil
+	})
 }
 
-func initializeEthofsNode(nodeType string) (icore.CoreAPI, *core.IpfsNode) {
+func initializeEthofsNode(ctx context.Context, nodeType string) (icore.CoreAPI, *core.IpfsNode, error) {
 
 	log.Info("ethoFS - deploying ethoFS node")
 
-	ctx := context.Background()
-
 	log.Info("ethoFS - initializing ethoFS node on default repo path")
-	ipfs, node, err := spawnDefault(ctx)
+	var (
+		ipfs icore.CoreAPI
+		node *core.IpfsNode
+	)
+	err := initRepoOnce("spawn", ethofsConfig.repoPath(), func() (err error) {
+		ipfs, node, err = spawnDefault(ctx)
+		return err
+	})
 	if err != nil {
 		log.Warn("ethoFS - unable to intialize ethoFS node on default repo path", "error", err)
-		os.Exit(0)
+		return nil, nil, err
 	}
 
 	// Setup ethoFS node config defaults
@@ -562,27 +805,31 @@ func initializeEthofsNode(nodeType string) (icore.CoreAPI, *core.IpfsNode) {
 		log.Info("ethoFS - node default configuration setup complete")
 	}
 
-	if nodeType == "gn" {
+	if ethofsConfig.gatewayEnabled() {
 		err = initializeGateway(node)
 		if err != nil {
 			log.Error("ethoFS - error initializing gateway", "error", err)
-			os.Exit(0)
+			node.Close()
+			return nil, nil, err
 		}
 	}
 
 	log.Info("ethoFS - node initialization complete")
 
-	bootstrapNodes := []string{
-		"/ip4/164.68.107.82/tcp/4001/ipfs/QmeG81bELkgLBZFYZc53ioxtvRS8iNVzPqxUBKSuah2rcQ",
-		"/ip4/164.68.98.94/tcp/4001/ipfs/QmRYw68MzD4jPvner913mLWBdFfpPfNUx8SRFjiUCJNA4f",
-		"/ip4/51.38.131.241/tcp/4001/ipfs/QmaGGSUqoFpv6wuqvNKNBsxDParVuGgV3n3iPs2eVWeSN4",
-		"/ip4/164.68.108.54/tcp/4001/ipfs/QmRwQ49Zknc2dQbywrhT8ArMDS9JdmnEyGGy4mZ1wDkgaX",
-		"/ip4/51.77.150.202/tcp/4001/ipfs/QmUEy4ScCYCgP6GRfVgrLDqXfLXnUUh4eKaS1fDgaCoGQJ",
-		"/ip4/51.79.70.144/tcp/4001/ipfs/QmTcwcKqKcnt84wCecShm1zdz1KagfVtqopg1xKLiwVJst",
-		"/ip4/142.44.246.43/tcp/4001/ipfs/QmPW8zExrEeno85Us3H1bk68rBo7N7WEhdpU9pC9wjQxgu",
+	if !node.IsOnline {
+		log.Info("ethoFS - node running offline, not joining the swarm")
+		return ipfs, node, nil
 	}
+	bootstrapNodes := ethofsConfig.bootstrapNodes()
 
-	connectToPeers(ctx, ipfs, bootstrapNodes)
+	if _, err := connectToPeers(ctx, ipfs, bootstrapNodes, ethofsConfig.MinBootstrapPeers); err != nil {
+		// Keep the node running, the reconnect manager retries the bootstrap
+		if mismatch := dialFailures.swarmKeyMismatch(len(node.PeerHost.Network().Peers())); mismatch != nil {
+			log.Error("ethoFS - bootstrap failed, is the repo initialized for another network?", "error", mismatch, "fingerprint", fmt.Sprintf("%x", node.PNetFingerprint))
+		} else {
+			log.Warn("ethoFS - bootstrap incomplete", "error", err)
+		}
+	}
 
-	return ipfs, node
+	return ipfs, node, nil
 }
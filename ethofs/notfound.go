@@ -0,0 +1,305 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-ipfs/core"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+const (
+	defaultNotFoundTTL  = 5 * time.Minute
+	defaultNotFoundSize = 16384
+
+	// notFoundSweepInterval is how often expired entries are dropped from
+	// the datastore.
+	notFoundSweepInterval = 10 * time.Minute
+)
+
+// notFoundPrefix is the datastore namespace of the failed lookups, stored in
+// the repo to survive restarts.
+var notFoundPrefix = datastore.NewKey("/ethofs/notfound")
+
+var errCachedNotFound = errors.New("content not found recently, retry later")
+
+var (
+	notFoundHitMeter   = metrics.NewRegisteredMeter("ethofs/notfound/hit", nil)
+	notFoundAddedMeter = metrics.NewRegisteredMeter("ethofs/notfound/added", nil)
+	notFoundFullMeter  = metrics.NewRegisteredMeter("ethofs/notfound/full", nil)
+)
+
+// missingContent is the negative lookup cache of the running node, or nil if
+// it is disabled.
+var missingContent *notFoundCache
+
+// notFoundCache remembers the CIDs that recently could not be retrieved from
+// the swarm, failing further lookups for them immediately until the negative
+// TTL expires instead of searching the DHT again. At most size entries are
+// kept, lookups failing while the cache is full are not recorded. A nil cache
+// is valid and caches nothing.
+type notFoundCache struct {
+	ds   datastore.Datastore
+	bs   blockstore.Blockstore
+	ttl  time.Duration
+	size int
+
+	lock    sync.Mutex
+	entries int // Number of entries stored, counted by the last sweep
+}
+
+func newNotFoundCache(ds datastore.Datastore, bs blockstore.Blockstore, cfg *NotFoundCacheConfig) *notFoundCache {
+	ttl := cfg.TTL
+	if ttl == 0 {
+		ttl = defaultNotFoundTTL
+	}
+	size := cfg.Size
+	if size <= 0 {
+		size = defaultNotFoundSize
+	}
+	c := &notFoundCache{ds: ds, bs: bs, ttl: ttl, size: size}
+	if err := c.sweep(); err != nil {
+		log.Debug("ethoFS - unable to sweep failed lookups", "error", err)
+	}
+	return c
+}
+
+func notFoundKey(c cid.Cid) datastore.Key {
+	return notFoundPrefix.ChildString(c.String())
+}
+
+// has reports whether the CID failed to be retrieved within the TTL, dropping
+// expired entries.
+func (c *notFoundCache) has(k cid.Cid) bool {
+	if c == nil || !k.Defined() {
+		return false
+	}
+	data, err := c.ds.Get(notFoundKey(k))
+	if err != nil || len(data) != 8 {
+		return false
+	}
+	if expired(data) {
+		c.drop(notFoundKey(k))
+		return false
+	}
+	notFoundHitMeter.Mark(1)
+	return true
+}
+
+// failed records the CID as not found if err says its retrieval timed out or
+// found nothing and the content is still not available locally. Lookups
+// aborted by the caller are not recorded.
+func (c *notFoundCache) failed(k cid.Cid, err error) {
+	if c == nil || err == nil || !k.Defined() {
+		return
+	}
+	if !errors.Is(err, context.DeadlineExceeded) && err != ipld.ErrNotFound {
+		return
+	}
+	if has, err := c.bs.Has(k); err != nil || has {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := notFoundKey(k)
+	known, err := c.ds.Has(key)
+	if err != nil {
+		return
+	}
+	if !known && c.entries >= c.size {
+		notFoundFullMeter.Mark(1)
+		return
+	}
+	expiry := make([]byte, 8)
+	binary.BigEndian.PutUint64(expiry, uint64(time.Now().Add(c.ttl).UnixNano()))
+	if err := c.ds.Put(key, expiry); err != nil {
+		log.Debug("ethoFS - unable to cache failed lookup", "cid", k, "error", err)
+		return
+	}
+	if !known {
+		c.entries++
+	}
+	notFoundAddedMeter.Mark(1)
+	log.Debug("ethoFS - content not found, caching failed lookup", "cid", k, "ttl", c.ttl)
+}
+
+// expired reports whether the stored expiry has passed.
+func expired(data []byte) bool {
+	return len(data) != 8 || time.Now().UnixNano() >= int64(binary.BigEndian.Uint64(data))
+}
+
+// drop deletes a stored entry.
+func (c *notFoundCache) drop(key datastore.Key) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if has, err := c.ds.Has(key); err != nil || !has {
+		return
+	}
+	if c.ds.Delete(key) == nil && c.entries > 0 {
+		c.entries--
+	}
+}
+
+// sweep deletes the expired entries from the datastore and recounts the
+// remaining ones.
+func (c *notFoundCache) sweep() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	results, err := c.ds.Query(query.Query{Prefix: notFoundPrefix.String()})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	var entries int
+	for result := range results.Next() {
+		if result.Error != nil {
+			return result.Error
+		}
+		if !expired(result.Value) {
+			entries++
+			continue
+		}
+		if err := c.ds.Delete(datastore.NewKey(result.Key)); err != nil {
+			return err
+		}
+	}
+	c.entries = entries
+	return nil
+}
+
+// loop periodically drops the expired entries until the context is
+// cancelled.
+func (c *notFoundCache) loop(ctx context.Context) {
+	ticker := time.NewTicker(notFoundSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.sweep(); err != nil {
+				log.Debug("ethoFS - unable to sweep failed lookups", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// purge drops the given CIDs from the cache, or all entries if none are
+// given. It returns the number of entries removed.
+func (c *notFoundCache) purge(cids []cid.Cid) (int, error) {
+	if c == nil {
+		return 0, nil
+	}
+	var keys []datastore.Key
+	if len(cids) > 0 {
+		for _, k := range cids {
+			keys = append(keys, notFoundKey(k))
+		}
+	} else {
+		results, err := c.ds.Query(query.Query{Prefix: notFoundPrefix.String(), KeysOnly: true})
+		if err != nil {
+			return 0, err
+		}
+		entries, err := results.Rest()
+		if err != nil {
+			return 0, err
+		}
+		for _, entry := range entries {
+			keys = append(keys, datastore.NewKey(entry.Key))
+		}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var purged int
+	for _, key := range keys {
+		if has, err := c.ds.Has(key); err != nil || !has {
+			continue
+		}
+		if err := c.ds.Delete(key); err != nil {
+			return purged, err
+		}
+		purged++
+		if c.entries > 0 {
+			c.entries--
+		}
+	}
+	return purged, nil
+}
+
+// contentRoot returns the root CID of a bare CID or /ipfs/ path, or cid.Undef
+// for anything else.
+func contentRoot(p string) cid.Cid {
+	if c, err := cid.Decode(p); err == nil {
+		return c
+	}
+	ns, root, _ := splitContentPath(p)
+	if ns != "/ipfs" {
+		return cid.Undef
+	}
+	c, err := cid.Decode(root)
+	if err != nil {
+		return cid.Undef
+	}
+	return c
+}
+
+// notFoundOption fails gateway requests for content that recently could not
+// be found right away.
+func notFoundOption(cache *notFoundCache) corehttp.ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				if cache.has(contentRoot(r.URL.Path)) {
+					http.Error(w, errCachedNotFound.Error(), http.StatusNotFound)
+					return
+				}
+			}
+			childMux.ServeHTTP(w, r)
+		})
+		return childMux, nil
+	}
+}
+
+// PurgeNotFound drops the given CIDs from the cache of failed lookups, or the
+// whole cache if none are given, and returns the number of entries removed.
+func (s *EthofsService) PurgeNotFound(cids []cid.Cid) (int, error) {
+	if s.Node() == nil {
+		return 0, errNodeNotRunning
+	}
+	return missingContent.purge(cids)
+}
+
+// PurgeNotFound drops CIDs (all if empty) from the cache of failed lookups.
+func (api *PrivateEthofsAPI) PurgeNotFound(hashes []string) (_ int, err error) {
+	defer trackCall("purgeNotFound", time.Now(), &err)
+
+	cids := make([]cid.Cid, 0, len(hashes))
+	for _, hash := range hashes {
+		c, err := cid.Decode(hash)
+		if err != nil {
+			return 0, err
+		}
+		cids = append(cids, c)
+	}
+	return api.service.PurgeNotFound(cids)
+}
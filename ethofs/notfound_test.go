@@ -0,0 +1,116 @@
+package ethofs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+func TestNotFoundCache(t *testing.T) {
+	ds := dsync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockstore(ds)
+	cache := newNotFoundCache(ds, bs, &NotFoundCacheConfig{TTL: time.Hour})
+
+	missing := blocks.NewBlock([]byte("missing")).Cid()
+	local := blocks.NewBlock([]byte("local"))
+	if err := bs.Put(local); err != nil {
+		t.Fatal(err)
+	}
+	// Only timeouts of content not available locally are recorded
+	cache.failed(missing, context.Canceled)
+	cache.failed(local.Cid(), context.DeadlineExceeded)
+	if cache.has(missing) || cache.has(local.Cid()) {
+		t.Fatal("failed lookup recorded for cancelled request or local content")
+	}
+	cache.failed(missing, context.DeadlineExceeded)
+	if !cache.has(missing) {
+		t.Fatal("timed out lookup not recorded")
+	}
+	// Entries persist in the datastore, surviving a new cache instance
+	if !newNotFoundCache(ds, bs, &NotFoundCacheConfig{}).has(missing) {
+		t.Error("failed lookup not persisted")
+	}
+	if n, err := cache.purge(nil); err != nil || n != 1 {
+		t.Errorf("purge mismatch: have %d (%v), want 1", n, err)
+	}
+	if cache.has(missing) {
+		t.Error("purged lookup still cached")
+	}
+	// Expired entries are dropped
+	cache.ttl = -time.Second
+	cache.failed(missing, context.DeadlineExceeded)
+	if cache.has(missing) {
+		t.Error("expired lookup still cached")
+	}
+	var nilCache *notFoundCache
+	nilCache.failed(missing, context.DeadlineExceeded)
+	if nilCache.has(missing) {
+		t.Error("nil cache reported entry")
+	}
+}
+
+func TestNotFoundCacheBounds(t *testing.T) {
+	ds := dsync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockstore(ds)
+	cache := newNotFoundCache(ds, bs, &NotFoundCacheConfig{TTL: time.Hour, Size: 2})
+
+	var missing []cid.Cid
+	for _, data := range []string{"a", "b", "c"} {
+		missing = append(missing, blocks.NewBlock([]byte(data)).Cid())
+	}
+	// Lookups failing while the cache is full are not recorded
+	for _, c := range missing {
+		cache.failed(c, context.DeadlineExceeded)
+	}
+	if !cache.has(missing[0]) || !cache.has(missing[1]) || cache.has(missing[2]) {
+		t.Fatal("full cache recorded failed lookup")
+	}
+	// Repeated failures refresh entries without taking more room
+	cache.failed(missing[0], context.DeadlineExceeded)
+	if cache.entries != 2 {
+		t.Errorf("entry count mismatch: have %d, want 2", cache.entries)
+	}
+	// Sweeps drop the expired entries, making room for new ones
+	cache.ttl = -time.Second
+	cache.failed(missing[0], context.DeadlineExceeded)
+	if err := cache.sweep(); err != nil {
+		t.Fatal(err)
+	}
+	if cache.entries != 1 {
+		t.Errorf("swept entry count mismatch: have %d, want 1", cache.entries)
+	}
+	cache.ttl = time.Hour
+	cache.failed(missing[2], context.DeadlineExceeded)
+	if !cache.has(missing[2]) {
+		t.Error("failed lookup not recorded after sweep")
+	}
+	// New caches count the persisted entries
+	if reopened := newNotFoundCache(ds, bs, &NotFoundCacheConfig{Size: 2}); reopened.entries != 2 {
+		t.Errorf("reopened entry count mismatch: have %d, want 2", reopened.entries)
+	}
+}
+
+func TestContentRoot(t *testing.T) {
+	c := blocks.NewBlock([]byte("root")).Cid()
+	tests := []struct {
+		path string
+		want cid.Cid
+	}{
+		{path: c.String(), want: c},
+		{path: "/ipfs/" + c.String(), want: c},
+		{path: "/ipfs/" + c.String() + "/index.html", want: c},
+		{path: "/ipns/" + c.String(), want: cid.Undef},
+		{path: "/ipfs/nope", want: cid.Undef},
+	}
+	for i, tt := range tests {
+		if have := contentRoot(tt.path); !have.Equals(tt.want) {
+			t.Errorf("test %d: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
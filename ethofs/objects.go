@@ -0,0 +1,156 @@
+package ethofs
+
+import (
+	"context"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	merkledag "github.com/ipfs/go-merkledag"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+)
+
+const (
+	// objectStatTimeout bounds the walk counting the blocks of a DAG.
+	objectStatTimeout = time.Minute
+
+	// maxObjectStatBlocks is the number of blocks counted at most, the walk
+	// of larger DAGs stops there.
+	maxObjectStatBlocks = 100000
+)
+
+// DirEntry is an entry of an immutable unixfs directory.
+type DirEntry struct {
+	Name   string `json:"name"`
+	Cid    string `json:"cid"`
+	Type   string `json:"type"`             // "file", "directory" or "symlink"
+	Size   uint64 `json:"size"`             // Size of the file content in bytes
+	Target string `json:"target,omitempty"` // Target of a symlink
+}
+
+// ObjectStat describes the root node of a DAG and the DAG below it.
+type ObjectStat struct {
+	Cid            string `json:"cid"`
+	NumLinks       int    `json:"numLinks"`       // Links of the root node
+	BlockSize      int    `json:"blockSize"`      // Size of the serialized root node
+	LinksSize      int    `json:"linksSize"`      // Size of the links section of the root node
+	DataSize       int    `json:"dataSize"`       // Size of the data section of the root node
+	CumulativeSize int    `json:"cumulativeSize"` // Size of the whole DAG as recorded in its links
+	Blocks         int    `json:"blocks"`         // Unique blocks of the DAG
+	Truncated      bool   `json:"truncated"`      // The DAG has more blocks than were counted
+}
+
+// Ls lists the entries of the unixfs directory at the given CID or ethoFS
+// path, or the requested page of them. Missing blocks are fetched from the
+// network.
+func (s *EthofsService) Ls(ctx context.Context, p string, page *PageOptions) ([]DirEntry, error) {
+	ipfs := s.API()
+	if ipfs == nil {
+		return nil, errNodeNotRunning
+	}
+	ch, err := ipfs.Unixfs().Ls(ctx, parsePath(p), options.Unixfs.ResolveChildren(true))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]DirEntry, 0)
+	for entry := range ch {
+		if entry.Err != nil {
+			return nil, entry.Err
+		}
+		if page.match(entry.Name) {
+			entries = append(entries, DirEntry{
+				Name:   entry.Name,
+				Cid:    entry.Cid.String(),
+				Type:   entry.Type.String(),
+				Size:   entry.Size,
+				Target: entry.Target,
+			})
+		}
+	}
+	start, end := page.window(len(entries),
+		func(i int) string { return entries[i].Name },
+		func(i, j int) { entries[i], entries[j] = entries[j], entries[i] },
+	)
+	return entries[start:end], nil
+}
+
+// ObjectStat returns the sizes of the root node at the given CID or ethoFS
+// path and the number of unique blocks of its DAG. Counting the blocks walks
+// the DAG, fetching missing blocks from the network, for at most a minute and
+// up to maxObjectStatBlocks blocks.
+func (s *EthofsService) ObjectStat(ctx context.Context, p string) (*ObjectStat, error) {
+	ipfs := s.API()
+	if ipfs == nil {
+		return nil, errNodeNotRunning
+	}
+	resolved, err := ipfs.ResolvePath(ctx, parsePath(p))
+	if err != nil {
+		return nil, err
+	}
+	stat, err := ipfs.Object().Stat(ctx, resolved)
+	if err != nil {
+		return nil, err
+	}
+	blocks, truncated, err := countBlocks(ctx, merkledag.GetLinksWithDAG(ipfs.Dag()), resolved.Cid(), maxObjectStatBlocks)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectStat{
+		Cid:            stat.Cid.String(),
+		NumLinks:       stat.NumLinks,
+		BlockSize:      stat.BlockSize,
+		LinksSize:      stat.LinksSize,
+		DataSize:       stat.DataSize,
+		CumulativeSize: stat.CumulativeSize,
+		Blocks:         blocks,
+		Truncated:      truncated,
+	}, nil
+}
+
+// countBlocks counts the unique blocks of the DAG below root, stopping once
+// limit blocks were counted, and reports whether it stopped early. The walk
+// fails if it takes longer than objectStatTimeout.
+func countBlocks(ctx context.Context, links merkledag.GetLinks, root cid.Cid, limit int) (int, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, objectStatTimeout)
+	defer cancel()
+
+	var (
+		blocks    = 0
+		truncated = false
+		seen      = cid.NewSet()
+	)
+	walkCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	err := merkledag.Walk(walkCtx, links, root, func(c cid.Cid) bool {
+		if truncated || !seen.Visit(c) {
+			return false
+		}
+		if blocks == limit {
+			truncated = true
+			stop()
+			return false
+		}
+		blocks++
+		return true
+	})
+	if truncated {
+		return blocks, true, nil
+	}
+	return blocks, false, err
+}
+
+// Ls lists the entries of the directory at the given CID or ethoFS path, or
+// the requested page of them.
+func (api *PublicEthofsAPI) Ls(ctx context.Context, p string, page *PageOptions) (_ []DirEntry, err error) {
+	defer trackCall("ls", time.Now(), &err)
+
+	return api.service.Ls(ctx, p, page)
+}
+
+// ObjectStat returns the cumulative size and block count of the DAG at the
+// given CID or ethoFS path.
+func (api *PublicEthofsAPI) ObjectStat(ctx context.Context, p string) (_ *ObjectStat, err error) {
+	defer trackCall("objectStat", time.Now(), &err)
+
+	return api.service.ObjectStat(ctx, p)
+}
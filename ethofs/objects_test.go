@@ -0,0 +1,49 @@
+package ethofs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func TestObjectStat(t *testing.T) {
+	s, stop := newTestService(t)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A root linking the same leaf twice counts the leaf once
+	var (
+		leaf  = merkledag.NewRawNode([]byte("leaf"))
+		other = merkledag.NewRawNode([]byte("other leaf"))
+		root  = merkledag.NodeWithData([]byte("root"))
+	)
+	root.AddNodeLink("a", leaf)
+	root.AddNodeLink("b", leaf)
+	root.AddNodeLink("c", other)
+	if err := s.Node().DAG.AddMany(ctx, []ipld.Node{leaf, other, root}); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := s.ObjectStat(ctx, root.Cid().String())
+	if err != nil {
+		t.Fatalf("failed to stat object: %v", err)
+	}
+	if stat.Cid != root.Cid().String() || stat.NumLinks != 3 || stat.Blocks != 3 || stat.Truncated {
+		t.Errorf("object stat mismatch: %+v", stat)
+	}
+	// Walks of large DAGs stop at the limit
+	blocks, truncated, err := countBlocks(ctx, merkledag.GetLinksWithDAG(s.Node().DAG), root.Cid(), 2)
+	if err != nil {
+		t.Fatalf("failed to count blocks: %v", err)
+	}
+	if blocks != 2 || !truncated {
+		t.Errorf("bounded walk mismatch: have %d blocks (truncated %v), want 2 (truncated)", blocks, truncated)
+	}
+	if _, err := new(EthofsService).ObjectStat(ctx, root.Cid().String()); err != errNodeNotRunning {
+		t.Errorf("stopped node: have %v, want %v", err, errNodeNotRunning)
+	}
+}
@@ -0,0 +1,63 @@
+package ethofs
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	ipfscore "github.com/ipfs/go-ipfs/core"
+)
+
+var (
+	errNodeOffline  = errors.New("ethoFS node is offline")
+	errNodeIsOnline = errors.New("ethoFS node is online already")
+)
+
+// onlineNode returns the running node, failing if it is stopped or runs
+// without networking.
+func (s *EthofsService) onlineNode() (*ipfscore.IpfsNode, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	if !node.IsOnline {
+		return nil, errNodeOffline
+	}
+	return node, nil
+}
+
+// GoOnline attaches the node started in offline mode to the swarm. The IPFS
+// node cannot gain networking in place, so it is restarted online on the same
+// repo, like for a swarm key rotation; the startup proceeds in the background.
+func (s *EthofsService) GoOnline() error {
+	s.lock.Lock()
+	node := s.node
+	s.lock.Unlock()
+
+	if node == nil {
+		return errNodeNotRunning
+	}
+	if node.IsOnline {
+		return errNodeIsOnline
+	}
+	if err := s.Stop(); err != nil {
+		log.Warn("ethoFS - error stopping offline node", "error", err)
+	}
+	s.lock.Lock()
+	s.config.Offline = false
+	s.lock.Unlock()
+
+	log.Info("ethoFS - restarting node online")
+	return s.Start()
+}
+
+// GoOnline restarts the node running in offline mode with networking.
+func (api *PrivateEthofsAPI) GoOnline() (_ bool, err error) {
+	defer trackCall("goOnline", time.Now(), &err)
+
+	if err := api.service.GoOnline(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
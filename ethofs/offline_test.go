@@ -0,0 +1,45 @@
+package ethofs
+
+import "testing"
+
+func TestGoOnline(t *testing.T) {
+	s, stop := newLifecycleService(t, func(cfg *Config) { cfg.Offline = true })
+	defer stop()
+
+	if err := s.GoOnline(); err != errNodeNotRunning {
+		t.Fatalf("stopped node: have %v, want %v", err, errNodeNotRunning)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	waitStarted(t, s)
+
+	// The offline node works on the repo only
+	if node := s.Node(); node == nil || node.IsOnline {
+		t.Fatal("node started online")
+	}
+	if _, err := s.onlineNode(); err != errNodeOffline {
+		t.Errorf("offline node: have %v, want %v", err, errNodeOffline)
+	}
+	offline := s.Node()
+
+	// Going online restarts the node with networking on the same repo
+	if err := s.GoOnline(); err != nil {
+		t.Fatalf("failed to go online: %v", err)
+	}
+	waitStarted(t, s)
+
+	node, err := s.onlineNode()
+	if err != nil {
+		t.Fatalf("node not online: %v", err)
+	}
+	if node == offline {
+		t.Error("offline node kept running")
+	}
+	if s.config.Offline {
+		t.Error("offline mode still configured")
+	}
+	if err := s.GoOnline(); err != errNodeIsOnline {
+		t.Errorf("online node: have %v, want %v", err, errNodeIsOnline)
+	}
+}
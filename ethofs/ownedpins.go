@@ -0,0 +1,125 @@
+package ethofs
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+)
+
+// ownedPrefix is the datastore namespace of the owners of the pins ethoFS
+// made on behalf of the node itself, one key per pin and owner.
+var ownedPrefix = datastore.NewKey("/ethofs/owned")
+
+// Owners of the pins made by ethoFS itself, as opposed to the pins of the
+// hosting contract.
+const (
+	pinOwnerAdd    = "add"    // Content added by the user, including receipts
+	pinOwnerImport = "import" // Roots of imported CAR files
+	pinOwnerSite   = "site"   // Manifests of published site versions
+	pinOwnerConfig = "config" // Config snapshots
+	pinOwnerShared = "shared" // Roots and files of shared folders
+	pinOwnerExport = "export" // Roots pinned by filesystem exports
+)
+
+// pinOwners records which pins the node holds for itself, so that aligning
+// the pins with the hosting contract never drops them. An entry lives until
+// the pin is removed.
+type pinOwners struct {
+	lock sync.Mutex
+	ds   datastore.Datastore
+}
+
+// ownedPins is shared by the service and the package level pinning.
+var ownedPins = new(pinOwners)
+
+func ownedKey(c cid.Cid) datastore.Key {
+	return ownedPrefix.ChildString(c.String())
+}
+
+// attach switches the owners to the datastore of the running node.
+func (o *pinOwners) attach(ds datastore.Datastore) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.ds = ds
+}
+
+// detach releases the datastore of the stopped node.
+func (o *pinOwners) detach() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.ds = nil
+}
+
+// own records the owner of the pin.
+func (o *pinOwners) own(c cid.Cid, owner string) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.ds == nil {
+		return errNodeNotRunning
+	}
+	return o.ds.Put(ownedKey(c).ChildString(owner), nil)
+}
+
+// owners returns the owners of the pin, none if it belongs to the hosting
+// contract only.
+func (o *pinOwners) owners(c cid.Cid) ([]string, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.ds == nil {
+		return nil, errNodeNotRunning
+	}
+	return o.query(c)
+}
+
+// release drops all owners of the removed pin.
+func (o *pinOwners) release(c cid.Cid) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.ds == nil {
+		return errNodeNotRunning
+	}
+	owners, err := o.query(c)
+	if err != nil {
+		return err
+	}
+	for _, owner := range owners {
+		if err := o.ds.Delete(ownedKey(c).ChildString(owner)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// query lists the owners of the pin, with the lock held.
+func (o *pinOwners) query(c cid.Cid) ([]string, error) {
+	results, err := o.ds.Query(query.Query{Prefix: ownedKey(c).String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, err
+	}
+	owners := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		owners = append(owners, datastore.RawKey(entry.Key).BaseNamespace())
+	}
+	return owners, nil
+}
+
+// ownPin records the owner of the pin, which only protects it from being
+// dropped by contract reconciliations, so failures are logged only.
+func ownPin(c cid.Cid, owner string) {
+	if err := ownedPins.own(c, owner); err != nil {
+		log.Debug("ethoFS - unable to record pin owner", "cid", c, "owner", owner, "error", err)
+	}
+}
@@ -0,0 +1,39 @@
+package ethofs
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func TestPinOwners(t *testing.T) {
+	o := new(pinOwners)
+	c := merkledag.NewRawNode([]byte("owned")).Cid()
+	if err := o.own(c, pinOwnerAdd); err != errNodeNotRunning {
+		t.Fatalf("detached owners write: have %v, want %v", err, errNodeNotRunning)
+	}
+	o.attach(datastore.NewMapDatastore())
+
+	for _, owner := range []string{pinOwnerAdd, pinOwnerShared, pinOwnerAdd} {
+		if err := o.own(c, owner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	owners, err := o.owners(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(owners)
+	if !reflect.DeepEqual(owners, []string{pinOwnerAdd, pinOwnerShared}) {
+		t.Errorf("owners mismatch: %v", owners)
+	}
+	if err := o.release(c); err != nil {
+		t.Fatal(err)
+	}
+	if owners, _ := o.owners(c); len(owners) != 0 {
+		t.Errorf("released pin still owned by %v", owners)
+	}
+}
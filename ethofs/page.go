@@ -0,0 +1,163 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+)
+
+const (
+	// defaultPageLimit is the number of entries of a page if the request
+	// does not limit it.
+	defaultPageLimit = 1000
+
+	// maxPageLimit caps the entries of a page, keeping responses well
+	// within the RPC size limits.
+	maxPageLimit = 10000
+)
+
+// PageOptions selects a page of a listing. Entries are ordered by key: the
+// CID of pins, the name of directory entries and the ID of peers. A listing
+// without options returns all entries in their natural order.
+type PageOptions struct {
+	After  string `json:"after"`  // Cursor: the key of the last entry of the previous page, empty for the first page
+	Limit  int    `json:"limit"`  // Maximum number of entries, the default if zero
+	Prefix string `json:"prefix"` // Only list entries whose key starts with the prefix
+}
+
+// limit returns the effective page size.
+func (o *PageOptions) limit() int {
+	switch {
+	case o.Limit <= 0:
+		return defaultPageLimit
+	case o.Limit > maxPageLimit:
+		return maxPageLimit
+	default:
+		return o.Limit
+	}
+}
+
+// match reports whether the entry with the key passes the filter of the page.
+func (o *PageOptions) match(key string) bool {
+	return o == nil || strings.HasPrefix(key, o.Prefix)
+}
+
+// window sorts the n entries by key and returns the bounds of the page
+// within them.
+func (o *PageOptions) window(n int, key func(i int) string, swap func(i, j int)) (int, int) {
+	if o == nil {
+		return 0, n
+	}
+	sort.Sort(keyedSlice{n, key, swap})
+
+	start := sort.Search(n, func(i int) bool { return key(i) > o.After })
+	end := n
+	if limit := o.limit(); end-start > limit {
+		end = start + limit
+	}
+	return start, end
+}
+
+// keyedSlice sorts a slice by the keys of its entries.
+type keyedSlice struct {
+	n    int
+	key  func(i int) string
+	swap func(i, j int)
+}
+
+func (s keyedSlice) Len() int           { return s.n }
+func (s keyedSlice) Less(i, j int) bool { return s.key(i) < s.key(j) }
+func (s keyedSlice) Swap(i, j int)      { s.swap(i, j) }
+
+// PinInfo describes a pin of the node.
+type PinInfo struct {
+	Cid  string `json:"cid"`
+	Type string `json:"type"` // "recursive", "direct" or "indirect"
+}
+
+// PinListOptions selects the pins listed by ListPins.
+type PinListOptions struct {
+	PageOptions
+	Type string `json:"type"` // "recursive", "direct", "indirect" or "all", recursive if empty; the latter two only through the admin API
+}
+
+// errPinTypeWalk is returned to public callers listing pin types that need
+// the pinned DAGs walked.
+var errPinTypeWalk = errors.New("indirect pins are only listed through the admin API")
+
+// ListPins returns a page of the pins of the given type, which is one of
+// "recursive", "direct", "indirect" or "all". Recursive and direct pins are
+// paged through the pin index, the other types walk the pinned DAGs. Unlike
+// other listings, a nil page selects the first page of the default size.
+func (s *EthofsService) ListPins(ctx context.Context, typ string, page *PageOptions) ([]PinInfo, error) {
+	ipfs := s.API()
+	if ipfs == nil {
+		return nil, errNodeNotRunning
+	}
+	if page == nil {
+		page = new(PageOptions)
+	}
+	switch typ {
+	case "":
+		typ = "recursive"
+		fallthrough
+	case "recursive", "direct":
+		return localPins.list(ctx, typ, page)
+	case "indirect", "all":
+	default:
+		return nil, fmt.Errorf("invalid pin type %q", typ)
+	}
+	opt, err := options.Pin.Ls.Type(typ)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := ipfs.Pin().Ls(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	pins := make([]PinInfo, 0)
+	for pin := range ch {
+		if err := pin.Err(); err != nil {
+			return nil, err
+		}
+		if c := pin.Path().Cid().String(); page.match(c) {
+			pins = append(pins, PinInfo{Cid: c, Type: pin.Type()})
+		}
+	}
+	start, end := page.window(len(pins),
+		func(i int) string { return pins[i].Cid },
+		func(i, j int) { pins[i], pins[j] = pins[j], pins[i] },
+	)
+	return pins[start:end], nil
+}
+
+// ListPins returns a page of the recursive or direct pins of the node,
+// recursive ones unless the other type is requested. The next page starts
+// after the CID of the last returned pin.
+func (api *PublicEthofsAPI) ListPins(ctx context.Context, opts *PinListOptions) (_ []PinInfo, err error) {
+	defer trackCall("listPins", time.Now(), &err)
+
+	if opts == nil {
+		opts = new(PinListOptions)
+	}
+	if opts.Type == "indirect" || opts.Type == "all" {
+		return nil, errPinTypeWalk
+	}
+	return api.service.ListPins(ctx, opts.Type, &opts.PageOptions)
+}
+
+// ListPins returns a page of the pins of the node of any type, including the
+// indirect ones, which takes a walk of every pinned DAG.
+func (api *PrivateEthofsAPI) ListPins(ctx context.Context, opts *PinListOptions) (_ []PinInfo, err error) {
+	defer trackCall("listAllPins", time.Now(), &err)
+
+	if opts == nil {
+		opts = new(PinListOptions)
+	}
+	return api.service.ListPins(ctx, opts.Type, &opts.PageOptions)
+}
@@ -0,0 +1,42 @@
+package ethofs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPageWindow(t *testing.T) {
+	keys := []string{"d", "b", "bb", "a", "c", "ba"}
+	tests := []struct {
+		page *PageOptions
+		want []string
+	}{
+		{nil, []string{"d", "b", "bb", "a", "c", "ba"}},
+		{&PageOptions{}, []string{"a", "b", "ba", "bb", "c", "d"}},
+		{&PageOptions{Limit: 2}, []string{"a", "b"}},
+		{&PageOptions{After: "b", Limit: 2}, []string{"ba", "bb"}},
+		{&PageOptions{After: "bb", Limit: 2}, []string{"c", "d"}},
+		{&PageOptions{After: "d", Limit: 2}, []string{}},
+		{&PageOptions{After: "0"}, []string{"a", "b", "ba", "bb", "c", "d"}},
+		{&PageOptions{Prefix: "b", Limit: 2}, []string{"b", "ba"}},
+		{&PageOptions{Prefix: "b", After: "ba"}, []string{"bb"}},
+	}
+	for i, tt := range tests {
+		entries := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if tt.page.match(key) {
+				entries = append(entries, key)
+			}
+		}
+		start, end := tt.page.window(len(entries),
+			func(i int) string { return entries[i] },
+			func(i, j int) { entries[i], entries[j] = entries[j], entries[i] },
+		)
+		if have := entries[start:end]; !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("test %d: page mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+	if limit := (&PageOptions{Limit: 10 * maxPageLimit}).limit(); limit != maxPageLimit {
+		t.Errorf("page limit not capped: have %d, want %d", limit, maxPageLimit)
+	}
+}
@@ -0,0 +1,52 @@
+package ethofs
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const (
+	// repoDirName is the name of the repo directory in the data directories.
+	repoDirName = "ethofs"
+
+	// repoPathEnv names an environment variable overriding the default repo
+	// location, like IPFS_PATH does for go-ipfs.
+	repoPathEnv = "ETHOFS_PATH"
+)
+
+// defaultRepoPath returns the repo location used if none is configured: the
+// directory named by ETHOFS_PATH, the ethofs directory of the data directory
+// if a repo exists there already, $XDG_DATA_HOME/ethofs on Linux, or else the
+// ethofs directory of the data directory.
+func defaultRepoPath(dataDir string) string {
+	if path := os.Getenv(repoPathEnv); path != "" {
+		return filepath.Clean(path)
+	}
+	legacy := filepath.Join(dataDir, repoDirName)
+	if _, err := os.Stat(legacy); err == nil {
+		return legacy
+	}
+	if runtime.GOOS == "linux" {
+		if xdg := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(xdg) {
+			return filepath.Join(xdg, repoDirName)
+		}
+	}
+	return legacy
+}
+
+// existingAncestor returns the closest existing directory containing path,
+// e.g. to check the free space of the volume a repo is about to be created on.
+func existingAncestor(path string) string {
+	path = filepath.Clean(path)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,78 @@
+package ethofs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// setenv sets the environment variable, returning a function restoring its
+// previous value.
+func setenv(t *testing.T, key, value string) func() {
+	prev, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if ok {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestDefaultRepoPath(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "ethofs-datadir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	xdg, err := ioutil.TempDir("", "ethofs-xdg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(xdg)
+	defer setenv(t, "XDG_DATA_HOME", xdg)()
+	defer setenv(t, repoPathEnv, "")()
+
+	// ETHOFS_PATH overrides the platform default
+	os.Setenv(repoPathEnv, filepath.Join(xdg, "custom", ".."))
+	if path := defaultRepoPath(dataDir); path != xdg {
+		t.Errorf("env override: have %s, want %s", path, xdg)
+	}
+	os.Setenv(repoPathEnv, "")
+
+	legacy := filepath.Join(dataDir, repoDirName)
+	want := legacy
+	if runtime.GOOS == "linux" {
+		want = filepath.Join(xdg, repoDirName)
+	}
+	if path := defaultRepoPath(dataDir); path != want {
+		t.Errorf("fresh install: have %s, want %s", path, want)
+	}
+	// Existing repos in the data directory keep their location
+	if err := os.Mkdir(legacy, 0775); err != nil {
+		t.Fatal(err)
+	}
+	if path := defaultRepoPath(dataDir); path != legacy {
+		t.Errorf("existing repo: have %s, want %s", path, legacy)
+	}
+}
+
+func TestExistingAncestor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethofs-ancestor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if path := existingAncestor(filepath.Join(dir, "a", "b", "c")); path != dir {
+		t.Errorf("have %s, want %s", path, dir)
+	}
+	if path := existingAncestor(dir); path != dir {
+		t.Errorf("have %s, want %s", path, dir)
+	}
+}
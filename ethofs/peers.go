@@ -0,0 +1,399 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	datastore "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/connmgr"
+	"github.com/libp2p/go-libp2p-core/control"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// denylistPrefix is the datastore namespace of the denied peers, stored in
+// the repo to survive restarts.
+var denylistPrefix = datastore.NewKey("/ethofs/denylist")
+
+var errPeerDenied = errors.New("peer is on the ethoFS denylist")
+
+var deniedConnMeter = metrics.NewRegisteredMeter("ethofs/swarm/conns/denied", nil)
+
+// DeniedPeer is an entry of the peer denylist.
+type DeniedPeer struct {
+	ID     string    `json:"id"`
+	Reason string    `json:"reason,omitempty"`
+	Added  time.Time `json:"added"`
+}
+
+// peerDenylist holds the peers the node refuses to stay connected to.
+type peerDenylist struct {
+	ds datastore.Datastore
+
+	lock  sync.RWMutex
+	peers map[peer.ID]DeniedPeer
+}
+
+func denylistKey(id peer.ID) datastore.Key {
+	return denylistPrefix.ChildString(peer.Encode(id))
+}
+
+// loadDenylist reads the denied peers from the datastore.
+func loadDenylist(ds datastore.Datastore) (*peerDenylist, error) {
+	results, err := ds.Query(query.Query{Prefix: denylistPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, err
+	}
+	l := &peerDenylist{ds: ds, peers: make(map[peer.ID]DeniedPeer, len(entries))}
+	for _, entry := range entries {
+		var denied DeniedPeer
+		if err := json.Unmarshal(entry.Value, &denied); err != nil {
+			log.Warn("ethoFS - dropping corrupt denylist entry", "key", entry.Key, "error", err)
+			continue
+		}
+		id, err := peer.Decode(denied.ID)
+		if err != nil {
+			log.Warn("ethoFS - dropping corrupt denylist entry", "key", entry.Key, "error", err)
+			continue
+		}
+		l.peers[id] = denied
+	}
+	return l, nil
+}
+
+// denied reports whether the peer is on the denylist.
+func (l *peerDenylist) denied(id peer.ID) bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	_, ok := l.peers[id]
+	return ok
+}
+
+// add puts the peer on the denylist, replacing the reason of an existing
+// entry.
+func (l *peerDenylist) add(id peer.ID, reason string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	denied := DeniedPeer{ID: peer.Encode(id), Reason: reason, Added: time.Now()}
+	data, err := json.Marshal(denied)
+	if err != nil {
+		return err
+	}
+	if err := l.ds.Put(denylistKey(id), data); err != nil {
+		return err
+	}
+	l.peers[id] = denied
+	return nil
+}
+
+// remove drops the peer from the denylist, reporting whether it was on it.
+func (l *peerDenylist) remove(id peer.ID) (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, ok := l.peers[id]; !ok {
+		return false, nil
+	}
+	if err := l.ds.Delete(denylistKey(id)); err != nil {
+		return false, err
+	}
+	delete(l.peers, id)
+	return true, nil
+}
+
+// list returns the denied peers, oldest first.
+func (l *peerDenylist) list() []DeniedPeer {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	peers := make([]DeniedPeer, 0, len(l.peers))
+	for _, denied := range l.peers {
+		peers = append(peers, denied)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Added.Before(peers[j].Added) })
+	return peers
+}
+
+// refuse reports whether the connections of the peer are refused, counting
+// the refused ones.
+func (l *peerDenylist) refuse(id peer.ID) bool {
+	if l == nil || !l.denied(id) {
+		return false
+	}
+	deniedConnMeter.Mark(1)
+	log.Trace("ethoFS - refusing connection of denied peer", "peer", id)
+	return true
+}
+
+var (
+	swarmDenylistLock sync.RWMutex
+	swarmDenylist     *peerDenylist // Denylist of the running node
+)
+
+// currentDenylist returns the denylist of the running node, loaded from the
+// repo before the host is constructed so the swarm gates its connections from
+// the start.
+func currentDenylist() *peerDenylist {
+	swarmDenylistLock.RLock()
+	defer swarmDenylistLock.RUnlock()
+
+	return swarmDenylist
+}
+
+// setDenylist replaces the denylist of the running node.
+func setDenylist(denylist *peerDenylist) {
+	swarmDenylistLock.Lock()
+	defer swarmDenylistLock.Unlock()
+
+	swarmDenylist = denylist
+}
+
+// swarmGater is the connection gater of the node, refusing denied peers and,
+// in strict mode, the peers missing from the allow-list. Dials are refused
+// outright, inbound connections once the security handshake authenticated
+// the remote peer ID. The address filters of the repo config are chained
+// behind it, libp2p only takes a single gater.
+type swarmGater struct {
+	deny  *peerDenylist
+	allow *peerAllowlist
+	next  connmgr.ConnectionGater // Address filters of the host, if any
+}
+
+// gateSwarm installs the gater in front of the one already configured for
+// the host.
+func gateSwarm(g *swarmGater) libp2p.Option {
+	return func(cfg *libp2p.Config) error {
+		g.next, cfg.ConnectionGater = cfg.ConnectionGater, g
+		return nil
+	}
+}
+
+// admit checks the peer of a connection.
+func (g *swarmGater) admit(id peer.ID) bool {
+	return !g.deny.refuse(id) && g.allow.admit(id)
+}
+
+// InterceptPeerDial implements connmgr.ConnectionGater.
+func (g *swarmGater) InterceptPeerDial(p peer.ID) bool {
+	return g.admit(p) && (g.next == nil || g.next.InterceptPeerDial(p))
+}
+
+// InterceptAddrDial implements connmgr.ConnectionGater.
+func (g *swarmGater) InterceptAddrDial(p peer.ID, addr ma.Multiaddr) bool {
+	return g.admit(p) && (g.next == nil || g.next.InterceptAddrDial(p, addr))
+}
+
+// InterceptAccept implements connmgr.ConnectionGater. The remote peer of an
+// inbound connection is only known after the handshake.
+func (g *swarmGater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	return g.next == nil || g.next.InterceptAccept(addrs)
+}
+
+// InterceptSecured implements connmgr.ConnectionGater, checking the peer ID
+// authenticated by the security handshake.
+func (g *swarmGater) InterceptSecured(dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) bool {
+	return g.admit(p) && (g.next == nil || g.next.InterceptSecured(dir, p, addrs))
+}
+
+// InterceptUpgraded implements connmgr.ConnectionGater.
+func (g *swarmGater) InterceptUpgraded(conn network.Conn) (bool, control.DisconnectReason) {
+	if g.next == nil {
+		return true, 0
+	}
+	return g.next.InterceptUpgraded(conn)
+}
+
+// PeerInfo describes a swarm peer connected to the node.
+type PeerInfo struct {
+	ID        string `json:"id"`
+	Address   string `json:"address"`
+	Direction string `json:"direction"`         // Whether the peer dialed the node or the other way around
+	Latency   string `json:"latency,omitempty"` // Smoothed round trip time, if measured
+	Agent     string `json:"agent,omitempty"`   // Agent version the peer identified with
+}
+
+// Peers returns the swarm peers the node is connected to, or the requested
+// page of them.
+func (s *EthofsService) Peers(ctx context.Context, page *PageOptions) ([]PeerInfo, error) {
+	ipfs, node := s.API(), s.Node()
+	if ipfs == nil || node == nil {
+		return nil, errNodeNotRunning
+	}
+	conns, err := ipfs.Swarm().Peers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]PeerInfo, 0, len(conns))
+	for _, c := range conns {
+		if !page.match(c.ID().Pretty()) {
+			continue
+		}
+		info := PeerInfo{
+			ID:        c.ID().Pretty(),
+			Address:   c.Address().String(),
+			Direction: c.Direction().String(),
+		}
+		if latency, err := c.Latency(); err == nil && latency > 0 {
+			info.Latency = latency.String()
+		}
+		if agent, err := node.Peerstore.Get(c.ID(), "AgentVersion"); err == nil {
+			info.Agent, _ = agent.(string)
+		}
+		peers = append(peers, info)
+	}
+	start, end := page.window(len(peers),
+		func(i int) string { return peers[i].ID },
+		func(i, j int) { peers[i], peers[j] = peers[j], peers[i] },
+	)
+	return peers[start:end], nil
+}
+
+// Connect dials the peer at the multiaddr, which has to end in its peer ID.
+// Denied peers are refused, and so are unlisted ones in strict mode.
+func (s *EthofsService) Connect(ctx context.Context, addr string) error {
+	ipfs, denylist := s.API(), s.peerDenylist()
+	if ipfs == nil || denylist == nil {
+		return errNodeNotRunning
+	}
+	maddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return err
+	}
+	info, err := peer.AddrInfoFromP2pAddr(maddr)
+	if err != nil {
+		return err
+	}
+	if denylist.denied(info.ID) {
+		return errPeerDenied
+	}
+	if !currentAllowlist().allowed(info.ID) {
+		return errPeerNotAllowed
+	}
+	err = ipfs.Swarm().Connect(ctx, *info)
+	dialFailures.record("connect", info.ID, err)
+	return err
+}
+
+// Disconnect closes all connections to the peer. The peer may reconnect,
+// DenyPeer keeps it away for good.
+func (s *EthofsService) Disconnect(id peer.ID) error {
+	node, err := s.onlineNode()
+	if err != nil {
+		return err
+	}
+	return node.PeerHost.Network().ClosePeer(id)
+}
+
+// DenyPeer puts the peer on the persistent denylist and disconnects it. The
+// connection gater refuses its connections from then on.
+func (s *EthofsService) DenyPeer(id peer.ID, reason string) error {
+	node, denylist := s.Node(), s.peerDenylist()
+	if node == nil || denylist == nil {
+		return errNodeNotRunning
+	}
+	if err := denylist.add(id, reason); err != nil {
+		return err
+	}
+	log.Info("ethoFS - denied peer", "peer", id, "reason", reason)
+	if !node.IsOnline {
+		return nil // the denylist is enforced once the node goes online
+	}
+	return node.PeerHost.Network().ClosePeer(id)
+}
+
+// AllowPeer removes the peer from the denylist, reporting whether it was on
+// it.
+func (s *EthofsService) AllowPeer(id peer.ID) (bool, error) {
+	denylist := s.peerDenylist()
+	if denylist == nil {
+		return false, errNodeNotRunning
+	}
+	removed, err := denylist.remove(id)
+	if removed {
+		log.Info("ethoFS - allowed previously denied peer", "peer", id)
+	}
+	return removed, err
+}
+
+// DeniedPeers returns the entries of the peer denylist.
+func (s *EthofsService) DeniedPeers() ([]DeniedPeer, error) {
+	denylist := s.peerDenylist()
+	if denylist == nil {
+		return nil, errNodeNotRunning
+	}
+	return denylist.list(), nil
+}
+
+// Peers returns the swarm peers the ethoFS node is connected to, with their
+// connection direction, latency and agent. With page options, a page of the
+// peers ordered by ID is returned, the next one starting after the ID of the
+// last peer.
+func (api *PublicEthofsAPI) Peers(ctx context.Context, page *PageOptions) (_ []PeerInfo, err error) {
+	defer trackCall("peers", time.Now(), &err)
+
+	return api.service.Peers(ctx, page)
+}
+
+// DeniedPeers lists the peers on the denylist.
+func (api *PublicEthofsAPI) DeniedPeers() (_ []DeniedPeer, err error) {
+	defer trackCall("deniedPeers", time.Now(), &err)
+
+	return api.service.DeniedPeers()
+}
+
+// Connect dials the peer at the multiaddr ending in its peer ID.
+func (api *PrivateEthofsAPI) Connect(ctx context.Context, addr string) (err error) {
+	defer trackCall("connect", time.Now(), &err)
+
+	return api.service.Connect(ctx, addr)
+}
+
+// Disconnect closes all connections to the peer.
+func (api *PrivateEthofsAPI) Disconnect(id string) (err error) {
+	defer trackCall("disconnect", time.Now(), &err)
+
+	pid, err := peer.Decode(id)
+	if err != nil {
+		return err
+	}
+	return api.service.Disconnect(pid)
+}
+
+// DenyPeer disconnects the peer and refuses its connections until it is
+// allowed again, across restarts.
+func (api *PrivateEthofsAPI) DenyPeer(id string, reason string) (err error) {
+	defer trackCall("denyPeer", time.Now(), &err)
+
+	pid, err := peer.Decode(id)
+	if err != nil {
+		return err
+	}
+	return api.service.DenyPeer(pid, reason)
+}
+
+// AllowPeer removes the peer from the denylist.
+func (api *PrivateEthofsAPI) AllowPeer(id string) (_ bool, err error) {
+	defer trackCall("allowPeer", time.Now(), &err)
+
+	pid, err := peer.Decode(id)
+	if err != nil {
+		return false, err
+	}
+	return api.service.AllowPeer(pid)
+}
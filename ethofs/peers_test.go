@@ -0,0 +1,115 @@
+package ethofs
+
+import (
+	"net"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/test"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestPeerDenylist(t *testing.T) {
+	ds := dsync.MutexWrap(datastore.NewMapDatastore())
+	denylist, err := loadDenylist(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := denylist.add(bad, "serving corrupt blocks"); err != nil {
+		t.Fatal(err)
+	}
+	if !denylist.denied(bad) || denylist.denied(good) {
+		t.Fatal("denylist membership mismatch")
+	}
+	// Entries persist in the datastore, surviving a restart
+	reloaded, err := loadDenylist(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := reloaded.list(); len(list) != 1 || list[0].ID != bad.Pretty() || list[0].Reason != "serving corrupt blocks" {
+		t.Fatalf("reloaded denylist mismatch: have %+v", list)
+	}
+	if removed, err := reloaded.remove(good); err != nil || removed {
+		t.Errorf("removed peer not on the denylist: %v (%v)", removed, err)
+	}
+	if removed, err := reloaded.remove(bad); err != nil || !removed {
+		t.Errorf("denied peer not removed: %v (%v)", removed, err)
+	}
+	if reloaded, err = loadDenylist(ds); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.denied(bad) {
+		t.Error("removed peer still denied after restart")
+	}
+}
+
+func TestSwarmGaterDenylist(t *testing.T) {
+	denylist, err := loadDenylist(dsync.MutexWrap(datastore.NewMapDatastore()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gater := &swarmGater{deny: denylist}
+	if !gater.InterceptPeerDial(bad) {
+		t.Fatal("peer refused before being denied")
+	}
+	if err := denylist.add(bad, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	// Denied peers are refused both ways, without an allow-list all others pass
+	if gater.InterceptPeerDial(bad) || gater.InterceptAddrDial(bad, nil) || gater.InterceptSecured(network.DirInbound, bad, nil) {
+		t.Error("denied peer admitted")
+	}
+	if !gater.InterceptPeerDial(good) || !gater.InterceptSecured(network.DirInbound, good, nil) {
+		t.Error("peer refused without being denied")
+	}
+	if !(&swarmGater{}).InterceptSecured(network.DirOutbound, bad, nil) {
+		t.Error("gater without lists refused peer")
+	}
+}
+
+func TestSwarmGaterFilters(t *testing.T) {
+	// The address filters of the repo config stay in force behind the gater
+	filters := ma.NewFilters()
+	_, private, _ := net.ParseCIDR("10.0.0.0/8")
+	filters.AddFilter(*private, ma.ActionDeny)
+
+	var (
+		cfg   libp2p.Config
+		gater = new(swarmGater)
+	)
+	if err := cfg.Apply(libp2p.Filters(filters), gateSwarm(gater)); err != nil {
+		t.Fatalf("failed to configure gater: %v", err)
+	}
+	if cfg.ConnectionGater != gater {
+		t.Fatalf("gater not installed: have %T", cfg.ConnectionGater)
+	}
+	id, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gater.InterceptAddrDial(id, ma.StringCast("/ip4/10.1.2.3/tcp/4001")) {
+		t.Error("filtered address admitted")
+	}
+	if !gater.InterceptAddrDial(id, ma.StringCast("/ip4/192.0.2.1/tcp/4001")) {
+		t.Error("unfiltered address refused")
+	}
+}
@@ -0,0 +1,406 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs/core"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+)
+
+// expiryResubscribeDelay is the wait before the chain head subscription of
+// the expiry watcher is renewed after a failure.
+const expiryResubscribeDelay = 10 * time.Second
+
+var (
+	// expiryPrefix is the datastore namespace of the ledger of the expiry
+	// block heights of pins, stored in the repo to survive restarts.
+	expiryPrefix = datastore.NewKey("/ethofs/expiry")
+
+	// lapsedPrefix is the datastore namespace of the pins dropped on expiry,
+	// which the contract sync must not pin again.
+	lapsedPrefix = datastore.NewKey("/ethofs/lapsed")
+)
+
+var (
+	errExpiryPassed    = errors.New("expiry block already passed")
+	errExpiryShortened = errors.New("expiry before the current expiry of the pin")
+	errNoChainHead     = errors.New("chain head not available")
+)
+
+var pinExpiredMeter = metrics.NewRegisteredMeter("ethofs/pins/expired", nil)
+
+// PinExpiry is an entry of the pin expiry ledger.
+type PinExpiry struct {
+	Cid    string `json:"cid"`
+	Expiry uint64 `json:"expiry"` // Block height the pin is dropped at
+}
+
+// expiryLedger tracks the block heights the paid hosting periods of pins end
+// at. Pins without an entry never expire.
+type expiryLedger struct {
+	lock sync.Mutex
+	ds   datastore.Datastore
+	head uint64 // last chain head seen by the watcher, zero if unknown
+}
+
+// pinExpiries is shared by the service and the package level pinning of the
+// uploads of the chain.
+var pinExpiries = new(expiryLedger)
+
+func expiryKey(c cid.Cid) datastore.Key {
+	return expiryPrefix.ChildString(c.String())
+}
+
+func lapsedKey(c cid.Cid) datastore.Key {
+	return lapsedPrefix.ChildString(c.String())
+}
+
+// attach switches the ledger to the datastore of the running node.
+func (l *expiryLedger) attach(ds datastore.Datastore) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.ds, l.head = ds, 0
+}
+
+// detach releases the datastore of the stopped node.
+func (l *expiryLedger) detach() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.ds, l.head = nil, 0
+}
+
+// get returns the expiry of the pin, or zero if it never expires.
+func (l *expiryLedger) get(c cid.Cid) (uint64, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.ds == nil {
+		return 0, errNodeNotRunning
+	}
+	data, err := l.ds.Get(expiryKey(c))
+	if err == datastore.ErrNotFound || err == nil && len(data) != 8 {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// set records the expiry of the pin, clearing a lapse of an earlier
+// hosting period.
+func (l *expiryLedger) set(c cid.Cid, expiry uint64) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.ds == nil {
+		return errNodeNotRunning
+	}
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], expiry)
+	if err := l.ds.Put(expiryKey(c), data[:]); err != nil {
+		return err
+	}
+	if err := l.ds.Delete(lapsedKey(c)); err != nil && err != datastore.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// remove drops the expiry of the pin.
+func (l *expiryLedger) remove(c cid.Cid) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.ds == nil {
+		return errNodeNotRunning
+	}
+	return l.ds.Delete(expiryKey(c))
+}
+
+// lapse drops the expiry of the pin and records that its hosting period
+// lapsed.
+func (l *expiryLedger) lapse(c cid.Cid, expiry uint64) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.ds == nil {
+		return errNodeNotRunning
+	}
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], expiry)
+	if err := l.ds.Put(lapsedKey(c), data[:]); err != nil {
+		return err
+	}
+	return l.ds.Delete(expiryKey(c))
+}
+
+// lapsed reports whether the hosting period of the pin lapsed.
+func (l *expiryLedger) lapsed(c cid.Cid) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.ds == nil {
+		return false
+	}
+	has, err := l.ds.Has(lapsedKey(c))
+	return err == nil && has
+}
+
+// list returns the ledger entries, ordered by expiry.
+func (l *expiryLedger) list() ([]PinExpiry, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.ds == nil {
+		return nil, errNodeNotRunning
+	}
+	results, err := l.ds.Query(query.Query{Prefix: expiryPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, err
+	}
+	expiries := make([]PinExpiry, 0, len(entries))
+	for _, entry := range entries {
+		if len(entry.Value) != 8 {
+			continue
+		}
+		expiries = append(expiries, PinExpiry{
+			Cid:    datastore.RawKey(entry.Key).BaseNamespace(),
+			Expiry: binary.BigEndian.Uint64(entry.Value),
+		})
+	}
+	sort.Slice(expiries, func(i, j int) bool { return expiries[i].Expiry < expiries[j].Expiry })
+	return expiries, nil
+}
+
+// setHead records the chain head seen by the watcher.
+func (l *expiryLedger) setHead(number uint64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.head = number
+}
+
+// currentHead returns the chain head, asking the chain client if the watcher
+// has not seen one yet.
+func (l *expiryLedger) currentHead(ctx context.Context) (uint64, error) {
+	l.lock.Lock()
+	head := l.head
+	l.lock.Unlock()
+
+	if head != 0 {
+		return head, nil
+	}
+	if ethClient == nil {
+		return 0, errNoEthClient
+	}
+	header, err := ethClient.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	if header == nil {
+		return 0, errNoChainHead
+	}
+	return header.Number.Uint64(), nil
+}
+
+// trackContractPin sets the expiry of a pin added for the hosting contract to
+// the configured duration from the current head. Pins already in the ledger
+// keep their expiry.
+func trackContractPin(hash string) {
+	if ethofsConfig.PinDuration == 0 {
+		return
+	}
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if expiry, err := pinExpiries.get(c); err != nil || expiry != 0 {
+		return
+	}
+	// Without a chain head the expiry is recorded once the backend recovers
+	err = currentChainBackend().submit(ctx, "expiry/"+hash, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, chainCallTimeout)
+		defer cancel()
+
+		head, err := pinExpiries.currentHead(ctx)
+		if err != nil {
+			return err
+		}
+		return pinExpiries.set(c, head+ethofsConfig.PinDuration)
+	})
+	if err != nil && err != errChainUnavailable {
+		log.Warn("ethoFS - failed to record pin expiry", "hash", hash, "error", err)
+	}
+}
+
+// lapsedContractPin reports whether the hosting period of a pin requested by
+// the hosting contract lapsed, so the contract sync doesn't pin it again.
+func lapsedContractPin(hash string) bool {
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return false
+	}
+	return pinExpiries.lapsed(c)
+}
+
+// expirePins unpins the content whose expiry is at or below the block height
+// and collects the garbage once any pin was dropped.
+func expirePins(ctx context.Context, ipfs icore.CoreAPI, node *core.IpfsNode, storage *storageManager, number uint64) {
+	expiries, err := pinExpiries.list()
+	if err != nil {
+		log.Warn("ethoFS - failed to read pin expiries", "error", err)
+		return
+	}
+	dropped := 0
+	for _, entry := range expiries {
+		if entry.Expiry > number {
+			break
+		}
+		c, err := cid.Decode(entry.Cid)
+		if err != nil {
+			continue
+		}
+		if _, pinned, err := node.Pinning.IsPinnedWithType(ctx, c, pin.Recursive); err != nil {
+			continue
+		} else if pinned {
+			if _, err := pinRemove(ipfs, entry.Cid); err != nil {
+				log.Warn("ethoFS - failed to unpin expired content", "cid", c, "expiry", entry.Expiry, "error", err)
+				continue
+			}
+			dropped++
+			pinExpiredMeter.Mark(1)
+			log.Info("ethoFS - hosting period lapsed, content unpinned", "cid", c, "expiry", entry.Expiry)
+		}
+		if err := pinExpiries.lapse(c, entry.Expiry); err != nil {
+			log.Warn("ethoFS - failed to drop pin expiry", "cid", c, "error", err)
+		}
+	}
+	if dropped > 0 && storage != nil {
+		if err := storage.gc(ctx); err != nil && err != errGCRunning {
+			log.Warn("ethoFS - garbage collection of expired pins failed", "error", err)
+		}
+	}
+}
+
+// watchExpiries follows the chain head and drops the pins whose hosting
+// period lapsed, until the context is cancelled.
+func watchExpiries(ctx context.Context, ipfs icore.CoreAPI, node *core.IpfsNode, storage *storageManager) {
+	for {
+		if ethClient == nil {
+			return
+		}
+		heads := make(chan *types.Header, blockChanSize)
+		sub, err := ethClient.SubscribeNewHead(ctx, heads)
+		if err == nil {
+			err = followExpiries(ctx, ipfs, node, storage, heads, sub.Err())
+			sub.Unsubscribe()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Debug("ethoFS - chain head subscription of pin expiry failed", "error", err)
+		select {
+		case <-time.After(expiryResubscribeDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// followExpiries expires the pins on every new head until the subscription
+// fails or the context is cancelled.
+func followExpiries(ctx context.Context, ipfs icore.CoreAPI, node *core.IpfsNode, storage *storageManager, heads <-chan *types.Header, errc <-chan error) error {
+	for {
+		select {
+		case head := <-heads:
+			number := head.Number.Uint64()
+			pinExpiries.setHead(number)
+			expirePins(ctx, ipfs, node, storage, number)
+		case err := <-errc:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ExtendPin sets the block height the recursively pinned content is hosted
+// until, which may only be prolonged. Pins without an expiry are hosted
+// indefinitely and can't be given one. The pin is dropped and garbage
+// collected once the chain passes the expiry.
+func (s *EthofsService) ExtendPin(ctx context.Context, c cid.Cid, expiry uint64) error {
+	node := s.Node()
+	if node == nil {
+		return errNodeNotRunning
+	}
+	if _, pinned, err := node.Pinning.IsPinnedWithType(ctx, c, pin.Recursive); err != nil {
+		return err
+	} else if !pinned {
+		return errNotPinned
+	}
+	head, err := pinExpiries.currentHead(ctx)
+	if err != nil {
+		return err
+	}
+	if expiry <= head {
+		return errExpiryPassed
+	}
+	current, err := pinExpiries.get(c)
+	if err != nil {
+		return err
+	}
+	if current == 0 || expiry < current {
+		return errExpiryShortened
+	}
+	return pinExpiries.set(c, expiry)
+}
+
+// PinExpiries returns the pins with an expiry, soonest first.
+func (s *EthofsService) PinExpiries() ([]PinExpiry, error) {
+	return pinExpiries.list()
+}
+
+// PinExpiries returns the pins with an expiry block height, soonest first.
+func (api *PublicEthofsAPI) PinExpiries() (_ []PinExpiry, err error) {
+	defer trackCall("pinExpiries", time.Now(), &err)
+
+	return api.service.PinExpiries()
+}
+
+// ExtendPin prolongs the hosting period of the pinned CID to the given block
+// height.
+func (api *PrivateEthofsAPI) ExtendPin(ctx context.Context, hash string, expiry uint64) (_ bool, err error) {
+	defer trackCall("extendPin", time.Now(), &err)
+
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return false, err
+	}
+	if err := api.service.ExtendPin(ctx, c, expiry); err != nil {
+		return false, err
+	}
+	return true, nil
+}
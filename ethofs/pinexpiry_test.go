@@ -0,0 +1,111 @@
+package ethofs
+
+import (
+	"context"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func TestExpiryLedger(t *testing.T) {
+	l := new(expiryLedger)
+	early, _ := cid.Decode("QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn")
+	late, _ := cid.Decode("QmPZ9gcCEpqKTo6aq61g2nXGUhM4iCL3ewB6LDXZCtioEB")
+
+	if err := l.set(early, 100); err != errNodeNotRunning {
+		t.Fatalf("detached ledger write: have %v, want %v", err, errNodeNotRunning)
+	}
+	l.attach(datastore.NewMapDatastore())
+
+	if expiry, err := l.get(early); err != nil || expiry != 0 {
+		t.Fatalf("untracked pin expiry: have %d, %v", expiry, err)
+	}
+	if err := l.set(late, 200); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.set(early, 100); err != nil {
+		t.Fatal(err)
+	}
+	if expiry, err := l.get(late); err != nil || expiry != 200 {
+		t.Fatalf("pin expiry mismatch: have %d, %v", expiry, err)
+	}
+	expiries, err := l.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expiries) != 2 || expiries[0] != (PinExpiry{early.String(), 100}) || expiries[1] != (PinExpiry{late.String(), 200}) {
+		t.Fatalf("ledger mismatch: %+v", expiries)
+	}
+	if err := l.remove(early); err != nil {
+		t.Fatal(err)
+	}
+	if expiries, _ := l.list(); len(expiries) != 1 || expiries[0].Cid != late.String() {
+		t.Errorf("ledger after removal mismatch: %+v", expiries)
+	}
+	l.setHead(150)
+	if head, err := l.currentHead(context.Background()); err != nil || head != 150 {
+		t.Errorf("chain head mismatch: have %d, %v", head, err)
+	}
+}
+
+func TestExpiryLedgerLapse(t *testing.T) {
+	l := new(expiryLedger)
+	l.attach(datastore.NewMapDatastore())
+	c, _ := cid.Decode("QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn")
+
+	if err := l.set(c, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.lapse(c, 100); err != nil {
+		t.Fatal(err)
+	}
+	if !l.lapsed(c) {
+		t.Fatal("expired pin not marked lapsed")
+	}
+	if expiries, _ := l.list(); len(expiries) != 0 {
+		t.Errorf("lapsed pin still in ledger: %+v", expiries)
+	}
+	// A new hosting period clears the lapse
+	if err := l.set(c, 300); err != nil {
+		t.Fatal(err)
+	}
+	if l.lapsed(c) {
+		t.Error("renewed pin still marked lapsed")
+	}
+}
+
+func TestExtendPinLimits(t *testing.T) {
+	s, stop := newTestService(t)
+	defer stop()
+
+	pinExpiries.attach(s.Node().Repo.Datastore())
+	defer pinExpiries.detach()
+	pinExpiries.setHead(100)
+
+	ctx := context.Background()
+	nd := merkledag.NewRawNode([]byte("hosted"))
+	if err := s.Node().DAG.Add(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Node().Pinning.Pin(ctx, nd, true); err != nil {
+		t.Fatal(err)
+	}
+	// Pins without an expiry are hosted indefinitely
+	if err := s.ExtendPin(ctx, nd.Cid(), 200); err != errExpiryShortened {
+		t.Errorf("expiry of indefinite pin: have %v, want %v", err, errExpiryShortened)
+	}
+	if err := pinExpiries.set(nd.Cid(), 200); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ExtendPin(ctx, nd.Cid(), 150); err != errExpiryShortened {
+		t.Errorf("shortened expiry: have %v, want %v", err, errExpiryShortened)
+	}
+	if err := s.ExtendPin(ctx, nd.Cid(), 300); err != nil {
+		t.Errorf("failed to extend pin: %v", err)
+	}
+	if expiry, _ := pinExpiries.get(nd.Cid()); expiry != 300 {
+		t.Errorf("extended expiry mismatch: have %d, want 300", expiry)
+	}
+}
@@ -0,0 +1,533 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// pinIndexBatch is the number of index writes committed at once while the
+// index is filled from the pinner.
+const pinIndexBatch = 1024
+
+// pinIndexVersion is the layout of the pin index, bumped to rebuild the index
+// from the pinner on the next start.
+const pinIndexVersion = "2"
+
+// errPinIndexChanged is returned if the index holds fewer pins than counted
+// while it was locked, which only a datastore shared with another writer does.
+var errPinIndexChanged = errors.New("pin index changed while read")
+
+var (
+	// pinIndexPrefix is the datastore namespace of the pin index, one key per
+	// pinned CID holding its pin mode.
+	pinIndexPrefix = datastore.NewKey("/ethofs/pins")
+
+	// pinIndexVersionKey marks the index as migrated from the pinner.
+	pinIndexVersionKey = datastore.NewKey("/ethofs/pinindex/version")
+)
+
+// pinIndex tracks the recursive and direct pins of the node in the repo
+// datastore, so that pin lookups never need the full pin set in memory. The
+// pinner stays the authority, the index follows every pin change made through
+// it and periodic resyncs drop the entries it lost track of.
+type pinIndex struct {
+	lock sync.Mutex
+	ds   datastore.Batching
+}
+
+// localPins is the pin index of the running node.
+var localPins = new(pinIndex)
+
+func pinIndexKey(c cid.Cid) datastore.Key {
+	return pinIndexPrefix.ChildString(c.String())
+}
+
+// attach switches the index to the datastore of the running node, importing
+// the pins of the pinner if the index has not been built yet.
+func (x *pinIndex) attach(ctx context.Context, ds datastore.Batching, pinner pin.Pinner) error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	version, err := ds.Get(pinIndexVersionKey)
+	switch {
+	case err == nil && string(version) == pinIndexVersion:
+	case err == nil || err == datastore.ErrNotFound:
+		if err := migratePinIndex(ctx, ds, pinner); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+	x.ds = ds
+	return nil
+}
+
+// detach releases the datastore of the stopped node.
+func (x *pinIndex) detach() {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	x.ds = nil
+}
+
+// migratePinIndex rebuilds the index from the recursive and direct pins of the
+// pinner and marks it as current.
+func migratePinIndex(ctx context.Context, ds datastore.Batching, pinner pin.Pinner) error {
+	if err := clearPinIndex(ds); err != nil {
+		return err
+	}
+	count, err := importPins(ctx, ds, pinner)
+	if err != nil {
+		return err
+	}
+	log.Info("ethoFS - pin index migrated from the pinner", "pins", count)
+	return ds.Put(pinIndexVersionKey, []byte(pinIndexVersion))
+}
+
+// clearPinIndex drops all entries of the index.
+func clearPinIndex(ds datastore.Batching) error {
+	results, err := ds.Query(query.Query{Prefix: pinIndexPrefix.String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	batch, err := ds.Batch()
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for result := range results.Next() {
+		if result.Error != nil {
+			return result.Error
+		}
+		if err := batch.Delete(datastore.NewKey(result.Key)); err != nil {
+			return err
+		}
+		if pending++; pending == pinIndexBatch {
+			if err := batch.Commit(); err != nil {
+				return err
+			}
+			if batch, err = ds.Batch(); err != nil {
+				return err
+			}
+			pending = 0
+		}
+	}
+	return batch.Commit()
+}
+
+// importPins writes the recursive and direct pins of the pinner to the index.
+// It returns the number of pins of the pinner.
+func importPins(ctx context.Context, ds datastore.Batching, pinner pin.Pinner) (int, error) {
+	batch, err := ds.Batch()
+	if err != nil {
+		return 0, err
+	}
+	count, pending := 0, 0
+	for _, mode := range []pin.Mode{pin.Recursive, pin.Direct} {
+		var cids []cid.Cid
+		if mode == pin.Recursive {
+			cids, err = pinner.RecursiveKeys(ctx)
+		} else {
+			cids, err = pinner.DirectKeys(ctx)
+		}
+		if err != nil {
+			return 0, err
+		}
+		name, _ := pin.ModeToString(mode)
+		for _, c := range cids {
+			count++
+			if err := batch.Put(pinIndexKey(c), []byte(name)); err != nil {
+				return 0, err
+			}
+			if pending++; pending == pinIndexBatch {
+				if err := batch.Commit(); err != nil {
+					return 0, err
+				}
+				if batch, err = ds.Batch(); err != nil {
+					return 0, err
+				}
+				pending = 0
+			}
+		}
+	}
+	return count, batch.Commit()
+}
+
+// has reports whether the CID is pinned recursively or directly.
+func (x *pinIndex) has(c cid.Cid) (bool, error) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	if x.ds == nil {
+		return false, errNodeNotRunning
+	}
+	return x.ds.Has(pinIndexKey(c))
+}
+
+// count returns the number of indexed pins.
+func (x *pinIndex) count() (int, error) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	if x.ds == nil {
+		return 0, errNodeNotRunning
+	}
+	return x.size()
+}
+
+// pick returns the pins at the positions chosen from the number of indexed
+// pins, in the key order of the index, along with that number. The positions
+// may repeat. The index is locked throughout, so that the pins and their
+// number agree, and it is only read up to the last position.
+func (x *pinIndex) pick(ctx context.Context, choose func(count int) []int) ([]sampledPin, int, error) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	if x.ds == nil {
+		return nil, 0, errNodeNotRunning
+	}
+	count, err := x.size()
+	if err != nil {
+		return nil, 0, err
+	}
+	positions := choose(count)
+	if len(positions) == 0 {
+		return nil, count, nil
+	}
+	wanted := make(map[int][]int, len(positions))
+	last := 0
+	for i, pos := range positions {
+		wanted[pos] = append(wanted[pos], i)
+		if pos > last {
+			last = pos
+		}
+	}
+	results, err := x.ds.Query(query.Query{Prefix: pinIndexPrefix.String(), Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer results.Close()
+
+	var (
+		pins = make([]sampledPin, len(positions))
+		pos  = 0
+	)
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, 0, result.Error
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		if samples, ok := wanted[pos]; ok {
+			c, err := cid.Decode(datastore.RawKey(result.Key).BaseNamespace())
+			if err != nil {
+				return nil, 0, err
+			}
+			mode, _ := pin.StringToMode(string(result.Value))
+			for _, i := range samples {
+				pins[i] = sampledPin{cid: c, recursive: mode == pin.Recursive}
+			}
+		}
+		if pos == last {
+			return pins, count, nil
+		}
+		pos++
+	}
+	return nil, 0, errPinIndexChanged
+}
+
+// list returns a page of the indexed pins in key order, only the ones of the
+// named mode unless it is empty. The index is read up to the end of the page,
+// skipping the pins up to the cursor.
+func (x *pinIndex) list(ctx context.Context, mode string, page *PageOptions) ([]PinInfo, error) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	if x.ds == nil {
+		return nil, errNodeNotRunning
+	}
+	results, err := x.ds.Query(query.Query{Prefix: pinIndexPrefix.String(), Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var (
+		pins  = make([]PinInfo, 0)
+		limit = page.limit()
+	)
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		c := datastore.RawKey(result.Key).BaseNamespace()
+		if c <= page.After || !page.match(c) || (mode != "" && string(result.Value) != mode) {
+			continue
+		}
+		if pins = append(pins, PinInfo{Cid: c, Type: string(result.Value)}); len(pins) == limit {
+			break
+		}
+	}
+	return pins, nil
+}
+
+// each calls visit with the indexed pins in key order until it returns false.
+// Like resync, it leaves the index usable during the scan, so pin changes made
+// meanwhile may or may not be visited.
+func (x *pinIndex) each(ctx context.Context, visit func(c cid.Cid, mode pin.Mode) bool) error {
+	x.lock.Lock()
+	ds := x.ds
+	x.lock.Unlock()
+
+	if ds == nil {
+		return errNodeNotRunning
+	}
+	results, err := ds.Query(query.Query{Prefix: pinIndexPrefix.String(), Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	for result := range results.Next() {
+		if result.Error != nil {
+			return result.Error
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Undecodable entries are left to the next resync to drop
+		c, err := cid.Decode(datastore.RawKey(result.Key).BaseNamespace())
+		mode, ok := pin.StringToMode(string(result.Value))
+		if err != nil || !ok {
+			continue
+		}
+		if !visit(c, mode) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// size counts the indexed pins, with the lock held.
+func (x *pinIndex) size() (int, error) {
+	results, err := x.ds.Query(query.Query{Prefix: pinIndexPrefix.String(), KeysOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close()
+
+	var count int
+	for result := range results.Next() {
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		count++
+	}
+	return count, nil
+}
+
+// add records a pin of the given mode and notifies the plugins.
+func (x *pinIndex) add(c cid.Cid, mode pin.Mode) error {
+	if err := x.put(c, mode); err != nil {
+		return err
+	}
+	notifyPinAdded(c)
+	return nil
+}
+
+// remove drops the pin of the CID and notifies the plugins.
+func (x *pinIndex) remove(c cid.Cid) error {
+	if err := x.delete(c); err != nil {
+		return err
+	}
+	notifyPinRemoved(c)
+	return nil
+}
+
+func (x *pinIndex) put(c cid.Cid, mode pin.Mode) error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	if x.ds == nil {
+		return errNodeNotRunning
+	}
+	name, _ := pin.ModeToString(mode)
+	return x.ds.Put(pinIndexKey(c), []byte(name))
+}
+
+func (x *pinIndex) delete(c cid.Cid) error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	if x.ds == nil {
+		return errNodeNotRunning
+	}
+	return x.ds.Delete(pinIndexKey(c))
+}
+
+// resync drops the entries of the index the pinner no longer holds, e.g. of
+// pin changes lost in a crash before the index was written. New pins are
+// indexed as they are made, so the pinner is only asked about the indexed
+// CIDs one at a time, and the index stays usable during the scan. It returns
+// the number of indexed pins.
+func (x *pinIndex) resync(ctx context.Context, pinner pin.Pinner) (int, error) {
+	x.lock.Lock()
+	ds := x.ds
+	x.lock.Unlock()
+
+	if ds == nil {
+		return 0, errNodeNotRunning
+	}
+	results, err := ds.Query(query.Query{Prefix: pinIndexPrefix.String()})
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close()
+
+	var (
+		count int
+		stale []datastore.Key
+	)
+	for result := range results.Next() {
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		key := datastore.RawKey(result.Key)
+		c, err := cid.Decode(key.BaseNamespace())
+		mode, ok := pin.StringToMode(string(result.Value))
+		if err == nil && ok {
+			var pinned bool
+			if _, pinned, err = pinner.IsPinnedWithType(ctx, c, mode); err != nil {
+				return 0, err
+			}
+			ok = pinned
+		}
+		if err != nil || !ok {
+			stale = append(stale, key)
+		} else {
+			count++
+		}
+		if len(stale) == pinIndexBatch {
+			if err := x.dropStale(ctx, ds, pinner, stale); err != nil {
+				return 0, err
+			}
+			stale = stale[:0]
+		}
+	}
+	return count, x.dropStale(ctx, ds, pinner, stale)
+}
+
+// dropStale deletes the stale entries of the index, keeping the ones pinned
+// again since the scan found them.
+func (x *pinIndex) dropStale(ctx context.Context, ds datastore.Batching, pinner pin.Pinner, stale []datastore.Key) error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	if x.ds != ds {
+		return errNodeNotRunning
+	}
+	for _, key := range stale {
+		value, err := ds.Get(key)
+		if err == datastore.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		c, err := cid.Decode(key.BaseNamespace())
+		if mode, ok := pin.StringToMode(string(value)); err == nil && ok {
+			if _, pinned, err := pinner.IsPinnedWithType(ctx, c, mode); err != nil {
+				return err
+			} else if pinned {
+				continue
+			}
+		}
+		if err := ds.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexingPinner is the pinner of the node, recording every pin change in the
+// pin index, including the ones made without going through ethoFS, e.g. by
+// MFS or the IPFS APIs.
+type indexingPinner struct {
+	pin.Pinner
+	index *pinIndex
+}
+
+// indexed records the pin change in the index. Without an attached index the
+// change is left to the import from the pinner on the next attach.
+func (p *indexingPinner) indexed(c cid.Cid, pinned bool, mode pin.Mode) {
+	var err error
+	if pinned {
+		err = p.index.put(c, mode)
+	} else {
+		err = p.index.delete(c)
+	}
+	if err != nil && err != errNodeNotRunning {
+		log.Debug("ethoFS - unable to index pin change", "cid", c, "error", err)
+	}
+}
+
+func (p *indexingPinner) Pin(ctx context.Context, node ipld.Node, recursive bool) error {
+	if err := p.Pinner.Pin(ctx, node, recursive); err != nil {
+		return err
+	}
+	mode := pin.Direct
+	if recursive {
+		mode = pin.Recursive
+	}
+	p.indexed(node.Cid(), true, mode)
+	return nil
+}
+
+func (p *indexingPinner) Unpin(ctx context.Context, c cid.Cid, recursive bool) error {
+	if err := p.Pinner.Unpin(ctx, c, recursive); err != nil {
+		return err
+	}
+	p.indexed(c, false, pin.NotPinned)
+	return nil
+}
+
+func (p *indexingPinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error {
+	if err := p.Pinner.Update(ctx, from, to, unpin); err != nil {
+		return err
+	}
+	p.indexed(to, true, pin.Recursive)
+	if unpin {
+		p.indexed(from, false, pin.NotPinned)
+	}
+	return nil
+}
+
+func (p *indexingPinner) PinWithMode(c cid.Cid, mode pin.Mode) {
+	p.Pinner.PinWithMode(c, mode)
+	if mode == pin.Recursive || mode == pin.Direct {
+		p.indexed(c, true, mode)
+	}
+}
+
+func (p *indexingPinner) RemovePinWithMode(c cid.Cid, mode pin.Mode) {
+	p.Pinner.RemovePinWithMode(c, mode)
+	p.indexed(c, false, pin.NotPinned)
+}
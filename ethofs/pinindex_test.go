@@ -0,0 +1,185 @@
+package ethofs
+
+import (
+	"context"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+// testPinner serves the pin sets of the index from memory.
+type testPinner struct {
+	pin.Pinner
+	recursive, direct []cid.Cid
+}
+
+func (p *testPinner) RecursiveKeys(context.Context) ([]cid.Cid, error) { return p.recursive, nil }
+func (p *testPinner) DirectKeys(context.Context) ([]cid.Cid, error)    { return p.direct, nil }
+
+func (p *testPinner) PinWithMode(c cid.Cid, mode pin.Mode) {
+	if mode == pin.Direct {
+		p.direct = append(p.direct, c)
+	} else {
+		p.recursive = append(p.recursive, c)
+	}
+}
+
+func (p *testPinner) RemovePinWithMode(c cid.Cid, mode pin.Mode) {
+	set := &p.recursive
+	if mode == pin.Direct {
+		set = &p.direct
+	}
+	for i, pinned := range *set {
+		if pinned.Equals(c) {
+			*set = append((*set)[:i:i], (*set)[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *testPinner) IsPinnedWithType(_ context.Context, c cid.Cid, mode pin.Mode) (string, bool, error) {
+	set := p.recursive
+	if mode == pin.Direct {
+		set = p.direct
+	}
+	for _, pinned := range set {
+		if pinned.Equals(c) {
+			name, _ := pin.ModeToString(mode)
+			return name, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func TestPinIndex(t *testing.T) {
+	var cids []cid.Cid
+	for i := 0; i < 4; i++ {
+		cids = append(cids, merkledag.NodeWithData([]byte{byte(i)}).Cid())
+	}
+	var (
+		ctx    = context.Background()
+		ds     = dssync.MutexWrap(datastore.NewMapDatastore())
+		pinner = &testPinner{recursive: cids[:2], direct: cids[2:3]}
+		index  = new(pinIndex)
+	)
+	if _, err := index.has(cids[0]); err != errNodeNotRunning {
+		t.Fatalf("detached index lookup error mismatch: have %v, want %v", err, errNodeNotRunning)
+	}
+	// Attaching migrates the pins of the pinner
+	if err := index.attach(ctx, ds, pinner); err != nil {
+		t.Fatalf("failed to attach index: %v", err)
+	}
+	for i, want := range []bool{true, true, true, false} {
+		if have, err := index.has(cids[i]); err != nil || have != want {
+			t.Errorf("pin %d: lookup mismatch: have %v (%v), want %v", i, have, err, want)
+		}
+	}
+	if value, err := ds.Get(pinIndexKey(cids[2])); err != nil || string(value) != "direct" {
+		t.Errorf("direct pin mode mismatch: have %q (%v)", value, err)
+	}
+	// Attaching again keeps the index, even if the pinner changed meanwhile
+	index.detach()
+	pinner.recursive = []cid.Cid{cids[1]}
+	if err := index.attach(ctx, ds, pinner); err != nil {
+		t.Fatalf("failed to reattach index: %v", err)
+	}
+	if have, _ := index.has(cids[0]); !have {
+		t.Errorf("index rebuilt on reattach")
+	}
+	// Pin changes through the node pinner are indexed right away
+	indexing := &indexingPinner{Pinner: pinner, index: index}
+	indexing.PinWithMode(cids[3], pin.Recursive)
+	if have, _ := index.has(cids[3]); !have {
+		t.Errorf("pin through the node pinner not indexed")
+	}
+	indexing.RemovePinWithMode(cids[2], pin.Direct)
+	if have, _ := index.has(cids[2]); have {
+		t.Errorf("unpin through the node pinner still indexed")
+	}
+	indexing.PinWithMode(cids[2], pin.Direct)
+
+	// Resyncing drops the pins the pinner lost track of
+	count, err := index.resync(ctx, pinner)
+	if err != nil {
+		t.Fatalf("failed to resync index: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("pin count mismatch: have %d, want 3", count)
+	}
+	if indexed, err := index.count(); err != nil || indexed != 3 {
+		t.Errorf("indexed pin count mismatch: have %d (%v), want 3", indexed, err)
+	}
+	for i, want := range []bool{false, true, true, true} {
+		if have, err := index.has(cids[i]); err != nil || have != want {
+			t.Errorf("pin %d: resynced lookup mismatch: have %v (%v), want %v", i, have, err, want)
+		}
+	}
+	// Incremental updates
+	if err := index.remove(cids[3]); err != nil {
+		t.Fatalf("failed to remove pin: %v", err)
+	}
+	if err := index.add(cids[0], pin.Recursive); err != nil {
+		t.Fatalf("failed to add pin: %v", err)
+	}
+	if have, _ := index.has(cids[3]); have {
+		t.Errorf("removed pin still indexed")
+	}
+	if have, _ := index.has(cids[0]); !have {
+		t.Errorf("added pin not indexed")
+	}
+}
+
+func TestPinIndexList(t *testing.T) {
+	var cids []cid.Cid
+	for i := 0; i < 5; i++ {
+		cids = append(cids, merkledag.NodeWithData([]byte{byte(i)}).Cid())
+	}
+	var (
+		ctx    = context.Background()
+		pinner = &testPinner{recursive: cids[:3], direct: cids[3:]}
+		index  = new(pinIndex)
+	)
+	if err := index.attach(ctx, dssync.MutexWrap(datastore.NewMapDatastore()), pinner); err != nil {
+		t.Fatalf("failed to attach index: %v", err)
+	}
+	// Walk the recursive pins a page at a time
+	var (
+		seen = make(map[string]bool)
+		prev string
+	)
+	for page := (&PageOptions{Limit: 2}); ; {
+		pins, err := index.list(ctx, "recursive", page)
+		if err != nil {
+			t.Fatalf("failed to list pins: %v", err)
+		}
+		if len(pins) > 2 {
+			t.Fatalf("page exceeds limit: %d pins", len(pins))
+		}
+		if len(pins) == 0 {
+			break
+		}
+		for _, pin := range pins {
+			if pin.Cid <= prev || pin.Type != "recursive" {
+				t.Errorf("pin %s (%s) out of order or type", pin.Cid, pin.Type)
+			}
+			prev, seen[pin.Cid] = pin.Cid, true
+		}
+		page.After = prev
+	}
+	if len(seen) != 3 {
+		t.Errorf("recursive pin count mismatch: have %d, want 3", len(seen))
+	}
+	// Listing without a mode returns both, filtered by prefix
+	pins, err := index.list(ctx, "", &PageOptions{})
+	if err != nil || len(pins) != 5 {
+		t.Fatalf("full listing mismatch: have %d pins (%v), want 5", len(pins), err)
+	}
+	want := cids[3].String()
+	if pins, _ := index.list(ctx, "", &PageOptions{Prefix: want}); len(pins) != 1 || pins[0].Cid != want || pins[0].Type != "direct" {
+		t.Errorf("prefix listing mismatch: have %v", pins)
+	}
+}
@@ -2,73 +2,45 @@ package ethofs
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/ethereum/go-ethereum/log"
 
 	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	options "github.com/ipfs/interface-go-ipfs-core/options"
 	path "github.com/ipfs/interface-go-ipfs-core/path"
 )
 
-func updateLocalPinMapping(api coreiface.CoreAPI) (error, bool) {
-
-	tempPinMapping := make(map[string]string)
-
+// updateLocalPinMapping resyncs the pin index of the node with its pinner.
+func updateLocalPinMapping(node *core.IpfsNode) (error, bool) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	opt, err := options.Pin.Ls.Type("all")
-	if err != nil {
-                log.Debug("ethoFS - local pin mapping option failure", "error", err)
-		return err, false
-	}
-
-	pins, err := api.Pin().Ls(ctx, opt)
+	count, err := localPins.resync(ctx, node.Pinning)
 	if err != nil {
-                log.Debug("ethoFS - local pin mapping failure", "error", err)
+		log.Debug("ethoFS - local pin mapping failure", "error", err)
 		return err, false
 	}
-
-
-	tempCount := 0
-
-	for p := range pins {
-		if p != nil && p.Path() != nil {
-			tempCount++
-			tempPinMapping[p.Path().Cid().String()] = p.Type()
-		}
-	}
-
-	select {
-	case <-ctx.Done():
-		if len(tempPinMapping) > 0 {
-			localPinMapping = tempPinMapping
-			log.Info("ethoFS - local pin mapping complete", "pin count", len(localPinMapping))
-			return nil, false
-		} else {
-                	log.Debug("ethoFS - local pin mapping failure", "pin count", len(localPinMapping))
-       	        	return fmt.Errorf("Error - ethoFS local pin mapping failure"), false
-		}
-       	}
+	log.Info("ethoFS - local pin mapping complete", "pin count", count)
 	return nil, false
 }
 
-func pinSearch(hash string, pinMapping map[string]string) bool {
-
-	tempPinMapping := pinMapping
-
-	if _, found := tempPinMapping[hash]; found {
-		log.Debug("ethoFS - Matching pin found", "type", found, "hash", hash)
+func pinSearch(hash string) bool {
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return false
+	}
+	if found, err := localPins.has(c); err == nil && found {
+		log.Debug("ethoFS - Matching pin found", "hash", hash)
 		return true
 	}
 	log.Debug("ethoFS - Matching pin was not found", "hash", hash)
 	return false
 }
 
-func pinAdd(api coreiface.CoreAPI, hash string) (string, error) {
+func pinAdd(api coreiface.CoreAPI, hash string) (_ string, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -76,17 +48,23 @@ func pinAdd(api coreiface.CoreAPI, hash string) (string, error) {
 	if err != nil {
 		return hash, err
 	}
+	defer func(start time.Time) { history.record("pin", hash, "", start, err) }(time.Now())
 
-	resolvedPath := path.IpfsPath(cid)
+	if missingContent.has(cid) {
+		return hash, errCachedNotFound
+	}
+	currentProviderHints().warm(ctx, cid)
 
-	if err := api.Pin().Add(ctx, resolvedPath, options.Pin.Recursive(true)); err != nil {
+	if err := pinRecursive(ctx, api, cid); err != nil {
+		missingContent.failed(cid, err)
 		return hash, err
 	}
+	feeds.contentPinned.Send(ContentPinned{Cid: cid})
 
 	return hash, nil
 }
 
-func pinRemove(api coreiface.CoreAPI, hash string) (string, error) {
+func pinRemove(api coreiface.CoreAPI, hash string) (_ string, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -94,12 +72,19 @@ func pinRemove(api coreiface.CoreAPI, hash string) (string, error) {
 	if err != nil {
 		return hash, err
 	}
+	defer func(start time.Time) { history.record("unpin", hash, "", start, err) }(time.Now())
 
 	resolvedPath := path.IpfsPath(cid)
 
 	if err := api.Pin().Rm(ctx, resolvedPath, options.Pin.RmRecursive(true)); err != nil {
 		return hash, err
 	}
+	if err := localPins.remove(cid); err != nil {
+		log.Debug("ethoFS - unable to drop pin from the index", "hash", hash, "error", err)
+	}
+	if err := ownedPins.release(cid); err != nil {
+		log.Debug("ethoFS - unable to drop pin owners", "hash", hash, "error", err)
+	}
 
 	return hash, nil
 }
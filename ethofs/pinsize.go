@@ -0,0 +1,136 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+var errNotPinned = errors.New("content is not recursively pinned")
+
+// PinSize is the disk usage attributable to a recursively pinned root.
+// Blocks are told apart by their multihash, like the blockstore stores them.
+type PinSize struct {
+	Cid       string `json:"cid"`
+	Blocks    int    `json:"blocks"`    // Unique blocks of the DAG
+	Size      uint64 `json:"size"`      // Total size of the unique blocks
+	Exclusive uint64 `json:"exclusive"` // Size of the blocks no other pin references, freed by unpinning the root
+	Shared    uint64 `json:"shared"`    // Size of the blocks other pins reference too
+	Share     uint64 `json:"share"`     // Size with every shared block split evenly between the pins referencing it
+}
+
+// walkBlocks visits the unique blocks of the locally stored DAG below root,
+// descending into the blocks visit returns true for.
+func walkBlocks(ctx context.Context, bs blockstore.Blockstore, root cid.Cid, visit func(c cid.Cid, key string) bool) error {
+	dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	seen := make(map[string]struct{})
+	return merkledag.Walk(ctx, merkledag.GetLinksWithDAG(currentDAGWorkers().getter(dag)), root, func(c cid.Cid) bool {
+		key := string(c.Hash())
+		if _, ok := seen[key]; ok {
+			return false
+		}
+		seen[key] = struct{}{}
+		return visit(c, key)
+	})
+}
+
+// pinSize computes the disk usage of the recursively pinned root, walking
+// every other indexed pin to find the blocks it shares with them.
+func pinSize(ctx context.Context, pinner pin.Pinner, index *pinIndex, bs blockstore.Blockstore, root cid.Cid) (*PinSize, error) {
+	if _, pinned, err := pinner.IsPinnedWithType(ctx, root, pin.Recursive); err != nil {
+		return nil, err
+	} else if !pinned {
+		return nil, errNotPinned
+	}
+	var (
+		sizes   = make(map[string]int)
+		sizeErr error
+	)
+	err := walkBlocks(ctx, bs, root, func(c cid.Cid, key string) bool {
+		size, err := bs.GetSize(c)
+		if err != nil {
+			sizeErr = err
+			return false
+		}
+		sizes[key] = size
+		return true
+	})
+	if err == nil {
+		err = sizeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Count the other pins referencing each block of the DAG
+	var (
+		refs    = make(map[string]int)
+		walkErr error
+	)
+	err = index.each(ctx, func(other cid.Cid, mode pin.Mode) bool {
+		switch {
+		case mode == pin.Direct:
+			if _, ok := sizes[string(other.Hash())]; ok {
+				refs[string(other.Hash())]++
+			}
+		case !other.Equals(root):
+			walkErr = walkBlocks(ctx, bs, other, func(c cid.Cid, key string) bool {
+				if _, ok := sizes[key]; ok {
+					refs[key]++
+				}
+				return true
+			})
+		}
+		return walkErr == nil
+	})
+	if err == nil {
+		err = walkErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &PinSize{Cid: root.String(), Blocks: len(sizes)}
+	var share float64
+	for key, size := range sizes {
+		result.Size += uint64(size)
+		if n := refs[key]; n > 0 {
+			result.Shared += uint64(size)
+			share += float64(size) / float64(n+1)
+		} else {
+			result.Exclusive += uint64(size)
+			share += float64(size)
+		}
+	}
+	result.Share = uint64(math.Round(share))
+	return result, nil
+}
+
+// PinSize computes the exact disk usage attributable to the recursively
+// pinned root, accounting for the blocks it shares with other pins. It walks
+// all pins of the repo, so it takes a while on large repos.
+func (s *EthofsService) PinSize(ctx context.Context, root cid.Cid) (*PinSize, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	return pinSize(ctx, node.Pinning, localPins, node.Blockstore, root)
+}
+
+// PinSize returns the disk usage attributable to the recursively pinned CID,
+// e.g. for per-content billing.
+func (api *PublicEthofsAPI) PinSize(ctx context.Context, hash string) (_ *PinSize, err error) {
+	defer trackCall("pinSize", time.Now(), &err)
+
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return nil, err
+	}
+	return api.service.PinSize(ctx, c)
+}
@@ -0,0 +1,80 @@
+package ethofs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-blockservice"
+	datastore "github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func TestPinSize(t *testing.T) {
+	ctx := context.Background()
+	ds := dsync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockstore(ds)
+	dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	index := new(pinIndex)
+	pinner := &indexingPinner{Pinner: pin.NewPinner(ds, dag, dag), index: index}
+	if err := index.attach(ctx, ds, pinner.Pinner); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two roots sharing a leaf, plus a direct pin of a leaf of the first
+	var (
+		shared = merkledag.NewRawNode([]byte("shared by both roots"))
+		own    = merkledag.NewRawNode([]byte("only referenced by the first root"))
+		direct = merkledag.NewRawNode([]byte("directly pinned too"))
+		other  = merkledag.NewRawNode([]byte("only in the second root"))
+		first  = merkledag.NodeWithData([]byte("first"))
+		second = merkledag.NodeWithData([]byte("second"))
+	)
+	for _, leaf := range []*merkledag.RawNode{shared, own, direct} {
+		if err := first.AddNodeLink(leaf.Cid().String(), leaf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, leaf := range []*merkledag.RawNode{shared, other} {
+		if err := second.AddNodeLink(leaf.Cid().String(), leaf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dag.AddMany(ctx, []ipld.Node{shared, own, direct, other, first, second}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pinSize(ctx, pinner, index, bs, first.Cid()); err != errNotPinned {
+		t.Fatalf("unpinned root error mismatch: have %v, want %v", err, errNotPinned)
+	}
+	if err := pinner.Pin(ctx, first, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pinner.Pin(ctx, second, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pinner.Pin(ctx, direct, false); err != nil {
+		t.Fatal(err)
+	}
+	size, err := pinSize(ctx, pinner, index, bs, first.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		root      = uint64(len(first.RawData()))
+		exclusive = root + uint64(len(own.RawData()))
+		sharedLen = uint64(len(shared.RawData()) + len(direct.RawData()))
+	)
+	if size.Blocks != 4 {
+		t.Errorf("block count mismatch: have %d, want 4", size.Blocks)
+	}
+	if size.Exclusive != exclusive || size.Shared != sharedLen || size.Size != exclusive+sharedLen {
+		t.Errorf("size mismatch: have %+v, want exclusive %d, shared %d", size, exclusive, sharedLen)
+	}
+	if want := exclusive + sharedLen/2; size.Share < want-1 || size.Share > want+1 {
+		t.Errorf("share mismatch: have %d, want %d", size.Share, want)
+	}
+}
@@ -0,0 +1,197 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+)
+
+var errNoPlugin = errors.New("nil ethoFS plugin")
+
+// Plugin is an optional module extending the ethoFS service, e.g. with
+// analytics, custom gateway authentication or archive formats. A plugin hooks
+// into the service by implementing any of the LifecyclePlugin, APIPlugin,
+// PinPlugin and GatewayPlugin interfaces.
+type Plugin interface {
+	// Name identifies the plugin in logs and errors.
+	Name() string
+}
+
+// LifecyclePlugin is started once the node is running and stopped before it
+// shuts down, including the restarts of the node.
+type LifecyclePlugin interface {
+	Plugin
+
+	// Start is called with the running node and a context cancelled when
+	// the node stops. A failing plugin is skipped, the node keeps running.
+	Start(ctx context.Context, node *Ethofs) error
+
+	// Stop releases the resources of the plugin.
+	Stop() error
+}
+
+// APIPlugin registers RPC APIs next to the ethofs namespace.
+type APIPlugin interface {
+	Plugin
+
+	// APIs returns the APIs of the plugin, served by the service.
+	APIs(service *EthofsService) []rpc.API
+}
+
+// PinPlugin is notified of the pins added and removed by ethoFS. The hooks
+// are called synchronously after the pin change and must not block.
+type PinPlugin interface {
+	Plugin
+
+	PinAdded(c cid.Cid)
+	PinRemoved(c cid.Cid)
+}
+
+// GatewayPlugin wraps the handler of the gateway, e.g. to authenticate or
+// log requests. Middlewares run in the order of the plugin registration,
+// before the built-in request processing of ethoFS.
+type GatewayPlugin interface {
+	Plugin
+
+	GatewayMiddleware(next http.Handler) http.Handler
+}
+
+var (
+	pluginsLock sync.RWMutex
+	plugins     []Plugin
+)
+
+// RegisterPlugin adds a plugin to the ethoFS service. It has to be called
+// before the service is created, typically from an init function of the
+// package implementing the plugin. Registering a name twice fails.
+func RegisterPlugin(p Plugin) error {
+	if p == nil {
+		return errNoPlugin
+	}
+	if p.Name() == "" {
+		return errors.New("empty ethoFS plugin name")
+	}
+	pluginsLock.Lock()
+	defer pluginsLock.Unlock()
+
+	for _, registered := range plugins {
+		if registered.Name() == p.Name() {
+			return fmt.Errorf("ethoFS plugin %q already registered", p.Name())
+		}
+	}
+	plugins = append(plugins, p)
+	return nil
+}
+
+// RegisteredPlugins returns the sorted names of the registered plugins.
+func RegisteredPlugins() []string {
+	pluginsLock.RLock()
+	defer pluginsLock.RUnlock()
+
+	names := make([]string, 0, len(plugins))
+	for _, p := range plugins {
+		names = append(names, p.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// registeredPlugins returns the plugins in registration order.
+func registeredPlugins() []Plugin {
+	pluginsLock.RLock()
+	defer pluginsLock.RUnlock()
+
+	return append([]Plugin(nil), plugins...)
+}
+
+// pluginAPIs collects the RPC APIs of the plugins.
+func pluginAPIs(s *EthofsService) []rpc.API {
+	var apis []rpc.API
+	for _, p := range registeredPlugins() {
+		if p, ok := p.(APIPlugin); ok {
+			apis = append(apis, p.APIs(s)...)
+		}
+	}
+	return apis
+}
+
+// startPlugins starts the lifecycle plugins, returning the ones running.
+func startPlugins(ctx context.Context, node *Ethofs) []LifecyclePlugin {
+	var started []LifecyclePlugin
+	for _, p := range registeredPlugins() {
+		lp, ok := p.(LifecyclePlugin)
+		if !ok {
+			continue
+		}
+		if err := lp.Start(ctx, node); err != nil {
+			log.Error("ethoFS - plugin failed to start", "plugin", p.Name(), "error", err)
+			continue
+		}
+		log.Info("ethoFS - plugin started", "plugin", p.Name())
+		started = append(started, lp)
+	}
+	return started
+}
+
+// stopPlugins stops the running plugins in reverse start order.
+func stopPlugins(started []LifecyclePlugin) {
+	for i := len(started) - 1; i >= 0; i-- {
+		if err := started[i].Stop(); err != nil {
+			log.Warn("ethoFS - plugin failed to stop", "plugin", started[i].Name(), "error", err)
+		}
+	}
+}
+
+// notifyPinAdded calls the pin hooks of the plugins.
+func notifyPinAdded(c cid.Cid) {
+	for _, p := range registeredPlugins() {
+		if p, ok := p.(PinPlugin); ok {
+			p.PinAdded(c)
+		}
+	}
+}
+
+// notifyPinRemoved calls the unpin hooks of the plugins.
+func notifyPinRemoved(c cid.Cid) {
+	for _, p := range registeredPlugins() {
+		if p, ok := p.(PinPlugin); ok {
+			p.PinRemoved(c)
+		}
+	}
+}
+
+// pluginOptions wraps the gateway in the middlewares of the plugins.
+func pluginOptions() []corehttp.ServeOption {
+	var opts []corehttp.ServeOption
+	for _, p := range registeredPlugins() {
+		if p, ok := p.(GatewayPlugin); ok {
+			opts = append(opts, middlewareOption(p.GatewayMiddleware))
+		}
+	}
+	return opts
+}
+
+// middlewareOption serves the rest of the gateway behind the middleware.
+func middlewareOption(middleware func(http.Handler) http.Handler) corehttp.ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		childMux := http.NewServeMux()
+		mux.Handle("/", middleware(childMux))
+		return childMux, nil
+	}
+}
+
+// Plugins returns the names of the registered ethoFS plugins.
+func (api *PublicEthofsAPI) Plugins() []string {
+	return RegisteredPlugins()
+}
@@ -0,0 +1,125 @@
+package ethofs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+// testPlugin records the pin hooks it was called with.
+type testPlugin struct {
+	name    string
+	added   []cid.Cid
+	removed []cid.Cid
+}
+
+func (p *testPlugin) Name() string         { return p.name }
+func (p *testPlugin) PinAdded(c cid.Cid)   { p.added = append(p.added, c) }
+func (p *testPlugin) PinRemoved(c cid.Cid) { p.removed = append(p.removed, c) }
+
+// testMiddleware tags the gateway responses.
+type testMiddleware string
+
+func (m testMiddleware) Name() string { return string(m) }
+func (m testMiddleware) GatewayMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Plugin", string(m))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withPlugins registers only the given plugins, returning a function that
+// restores the previous registrations.
+func withPlugins(t *testing.T, ps ...Plugin) func() {
+	pluginsLock.Lock()
+	saved := plugins
+	plugins = nil
+	pluginsLock.Unlock()
+
+	for _, p := range ps {
+		if err := RegisterPlugin(p); err != nil {
+			t.Fatalf("failed to register plugin %s: %v", p.Name(), err)
+		}
+	}
+	return func() {
+		pluginsLock.Lock()
+		plugins = saved
+		pluginsLock.Unlock()
+	}
+}
+
+func TestRegisterPlugin(t *testing.T) {
+	defer withPlugins(t, &testPlugin{name: "b"}, &testPlugin{name: "a"})()
+
+	if err := RegisterPlugin(&testPlugin{name: "a"}); err == nil {
+		t.Errorf("plugin name registered twice")
+	}
+	if err := RegisterPlugin(nil); err != errNoPlugin {
+		t.Errorf("nil plugin error mismatch: have %v, want %v", err, errNoPlugin)
+	}
+	if names := RegisteredPlugins(); !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("registered plugins mismatch: have %v", names)
+	}
+}
+
+func TestPluginPinHooks(t *testing.T) {
+	plugin := &testPlugin{name: "pins"}
+	defer withPlugins(t, plugin)()
+
+	var (
+		c     = merkledag.NodeWithData([]byte("hooked")).Cid()
+		index = new(pinIndex)
+	)
+	if err := index.add(c, pin.Recursive); err != errNodeNotRunning {
+		t.Fatalf("detached index error mismatch: have %v, want %v", err, errNodeNotRunning)
+	}
+	if len(plugin.added) != 0 {
+		t.Errorf("failed pin notified")
+	}
+	if err := index.attach(context.Background(), dssync.MutexWrap(datastore.NewMapDatastore()), &testPinner{}); err != nil {
+		t.Fatalf("failed to attach index: %v", err)
+	}
+	if err := index.add(c, pin.Recursive); err != nil {
+		t.Fatalf("failed to add pin: %v", err)
+	}
+	if err := index.remove(c); err != nil {
+		t.Fatalf("failed to remove pin: %v", err)
+	}
+	if !reflect.DeepEqual(plugin.added, []cid.Cid{c}) || !reflect.DeepEqual(plugin.removed, []cid.Cid{c}) {
+		t.Errorf("pin hooks mismatch: added %v, removed %v", plugin.added, plugin.removed)
+	}
+}
+
+func TestPluginMiddleware(t *testing.T) {
+	defer withPlugins(t, testMiddleware("first"), &testPlugin{name: "pins"}, testMiddleware("second"))()
+
+	opts := pluginOptions()
+	if len(opts) != 2 {
+		t.Fatalf("gateway option count mismatch: have %d, want 2", len(opts))
+	}
+	var (
+		root = http.NewServeMux()
+		mux  = root
+		err  error
+	)
+	for _, opt := range opts {
+		if mux, err = opt(nil, nil, mux); err != nil {
+			t.Fatalf("failed to apply gateway option: %v", err)
+		}
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	root.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ipfs/QmHash", nil))
+	if have := rec.Header()["X-Plugin"]; !reflect.DeepEqual(have, []string{"first", "second"}) {
+		t.Errorf("middleware order mismatch: have %v", have)
+	}
+}
@@ -0,0 +1,395 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/json"
+	"math/bits"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	lru "github.com/hashicorp/golang-lru"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	// popularityTopic is the pubsub topic the popularity hints are gossiped on.
+	popularityTopic = "/ethofs/popularity/1"
+
+	// popularityInterval is how often a node gossips the hits of the roots it
+	// served since its last message.
+	popularityInterval = 5 * time.Minute
+
+	// popularityWindow is how long a hint of a peer counts towards the
+	// popularity of a root.
+	popularityWindow = 3 * popularityInterval
+
+	// popularityHints caps the roots of a single message.
+	popularityHints = 64
+
+	// minPopularityHits is the number of hits a root needs within an interval
+	// to be gossiped, keeping the requests of single users private.
+	minPopularityHits = 4
+
+	// maxPopularityRoots bounds the roots counted locally and remotely.
+	maxPopularityRoots = 4096
+
+	// maxPopularityPeers bounds the peers whose hints of a root are tracked.
+	maxPopularityPeers = 64
+
+	// maxPeerPopularityHits caps the hits counted for the hint of a single
+	// peer, so that no peer makes a root hot on its own.
+	maxPeerPopularityHits = 64
+
+	// minPopularityPeers is the number of distinct peers that have to report a
+	// root within the window before it counts as popular.
+	minPopularityPeers = 3
+
+	// hotContentHits is the number of hits within the window, summed over the
+	// hints of all peers, that makes a root hot.
+	hotContentHits = 256
+
+	// hotReplicationFactor multiplies the replication target of hot content.
+	hotReplicationFactor = 2
+)
+
+var (
+	popularitySentMeter     = metrics.NewRegisteredMeter("ethofs/popularity/sent", nil)
+	popularityReceivedMeter = metrics.NewRegisteredMeter("ethofs/popularity/received", nil)
+	popularityHotMeter      = metrics.NewRegisteredMeter("ethofs/popularity/hot", nil)
+)
+
+var (
+	contentPopularityLock sync.RWMutex
+	contentPopularity     *popularityTracker // Tracker of the running node, nil unless popularity gossip is enabled
+)
+
+// currentPopularity returns the popularity tracker of the running node, or nil
+// if popularity gossip is disabled.
+func currentPopularity() *popularityTracker {
+	contentPopularityLock.RLock()
+	defer contentPopularityLock.RUnlock()
+
+	return contentPopularity
+}
+
+// setPopularity replaces the popularity tracker of the running node.
+func setPopularity(tracker *popularityTracker) {
+	contentPopularityLock.Lock()
+	defer contentPopularityLock.Unlock()
+
+	contentPopularity = tracker
+}
+
+// popularityHint is the popularity of a root as gossiped by a peer.
+type popularityHint struct {
+	Cid  string `json:"cid"`
+	Hits uint64 `json:"hits"` // Hits of the interval, capped and rounded down to a power of two
+}
+
+// popularityMessage is the payload of a popularity gossip message.
+type popularityMessage struct {
+	Hints []popularityHint `json:"hints"`
+}
+
+// peerHits is a hint of a peer, until it leaves the window.
+type peerHits struct {
+	hits uint64
+	seen time.Time
+}
+
+// popularityTracker counts the hits of the roots served by the node, gossips
+// them to the swarm and aggregates the hints of the other nodes. The hints
+// carry no requester information and bucketed counts only.
+type popularityTracker struct {
+	node *core.IpfsNode
+	now  func() time.Time
+
+	lock   sync.Mutex
+	local  map[cid.Cid]uint64 // hits served since the last message
+	remote *lru.Cache         // root -> map[peer.ID]peerHits
+	hot    *lru.Cache         // root -> time it turned hot
+}
+
+func newPopularityTracker(node *core.IpfsNode) (*popularityTracker, error) {
+	remote, err := lru.New(maxPopularityRoots)
+	if err != nil {
+		return nil, err
+	}
+	hot, err := lru.New(maxPopularityRoots)
+	if err != nil {
+		return nil, err
+	}
+	return &popularityTracker{
+		node:   node,
+		now:    time.Now,
+		local:  make(map[cid.Cid]uint64),
+		remote: remote,
+		hot:    hot,
+	}, nil
+}
+
+// bucketHits caps the hits at the count of a single peer and rounds them down
+// to a power of two.
+func bucketHits(hits uint64) uint64 {
+	if hits == 0 {
+		return 0
+	}
+	if hits > maxPeerPopularityHits {
+		hits = maxPeerPopularityHits
+	}
+	return 1 << (63 - bits.LeadingZeros64(hits))
+}
+
+// served counts a hit of a root stored by the node.
+func (t *popularityTracker) served(c cid.Cid) {
+	if t == nil || !c.Defined() {
+		return
+	}
+	if has, err := t.node.Blockstore.Has(c); err != nil || !has {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	hits, ok := t.local[c]
+	if !ok && len(t.local) >= maxPopularityRoots {
+		return
+	}
+	if hits < maxPeerPopularityHits {
+		t.local[c] = hits + 1
+	}
+}
+
+// collect returns the hints of the most popular roots served since the last
+// call and resets the counters.
+func (t *popularityTracker) collect() []popularityHint {
+	t.lock.Lock()
+	local := t.local
+	t.local = make(map[cid.Cid]uint64)
+	t.lock.Unlock()
+
+	hints := make([]popularityHint, 0, len(local))
+	for c, hits := range local {
+		if hits >= minPopularityHits {
+			hints = append(hints, popularityHint{Cid: c.String(), Hits: bucketHits(hits)})
+		}
+	}
+	sort.Slice(hints, func(i, j int) bool {
+		if hints[i].Hits != hints[j].Hits {
+			return hints[i].Hits > hints[j].Hits
+		}
+		return hints[i].Cid < hints[j].Cid
+	})
+	if len(hints) > popularityHints {
+		hints = hints[:popularityHints]
+	}
+	return hints
+}
+
+// receive records the hints of a peer, returning the roots that turned hot.
+func (t *popularityTracker) receive(from peer.ID, hints []popularityHint) []cid.Cid {
+	now := t.now()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var hot []cid.Cid
+	for i, hint := range hints {
+		if i == popularityHints {
+			break
+		}
+		c, err := cid.Decode(hint.Cid)
+		if err != nil {
+			continue
+		}
+		var peers map[peer.ID]peerHits
+		if v, ok := t.remote.Get(c); ok {
+			peers = v.(map[peer.ID]peerHits)
+		} else {
+			peers = make(map[peer.ID]peerHits)
+			t.remote.Add(c, peers)
+		}
+		if _, ok := peers[from]; ok || len(peers) < maxPopularityPeers {
+			peers[from] = peerHits{hits: bucketHits(hint.Hits), seen: now}
+		}
+		if t.score(peers, now) >= hotContentHits && !t.hot.Contains(c) {
+			t.hot.Add(c, now)
+			hot = append(hot, c)
+		}
+	}
+	return hot
+}
+
+// score sums the hints of the peers within the window, dropping the older
+// ones. Roots reported by fewer than minPopularityPeers peers score zero. The
+// lock has to be held.
+func (t *popularityTracker) score(peers map[peer.ID]peerHits, now time.Time) uint64 {
+	var total uint64
+	for id, hint := range peers {
+		if now.Sub(hint.seen) > popularityWindow {
+			delete(peers, id)
+			continue
+		}
+		total += hint.hits
+	}
+	if len(peers) < minPopularityPeers {
+		return 0
+	}
+	return total
+}
+
+// isHot reports whether the swarm recently reported the root as hot.
+func (t *popularityTracker) isHot(c cid.Cid) bool {
+	if t == nil {
+		return false
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	since, ok := t.hot.Get(c)
+	if !ok {
+		return false
+	}
+	if t.now().Sub(since.(time.Time)) > popularityWindow {
+		// Still hot if the hints within the window add up
+		v, ok := t.remote.Get(c)
+		if !ok || t.score(v.(map[peer.ID]peerHits), t.now()) < hotContentHits {
+			t.hot.Remove(c)
+			return false
+		}
+		t.hot.Add(c, t.now())
+	}
+	return true
+}
+
+// popular returns up to n roots ordered by the hits the swarm reported for
+// them within the window, most popular first.
+func (t *popularityTracker) popular(n int) []cid.Cid {
+	if t == nil {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	type ranked struct {
+		c     cid.Cid
+		score uint64
+	}
+	var (
+		now   = t.now()
+		roots = make([]ranked, 0, t.remote.Len())
+	)
+	for _, key := range t.remote.Keys() {
+		v, ok := t.remote.Peek(key)
+		if !ok {
+			continue
+		}
+		if score := t.score(v.(map[peer.ID]peerHits), now); score > 0 {
+			roots = append(roots, ranked{key.(cid.Cid), score})
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		if roots[i].score != roots[j].score {
+			return roots[i].score > roots[j].score
+		}
+		return roots[i].c.String() < roots[j].c.String()
+	})
+	if len(roots) > n {
+		roots = roots[:n]
+	}
+	cids := make([]cid.Cid, len(roots))
+	for i, r := range roots {
+		cids[i] = r.c
+	}
+	return cids
+}
+
+// loop gossips the local hits every interval and processes the hints of the
+// other nodes until the context is cancelled.
+func (t *popularityTracker) loop(ctx context.Context, ipfs icore.CoreAPI) {
+	sub, err := ipfs.PubSub().Subscribe(ctx, popularityTopic)
+	if err != nil {
+		log.Warn("ethoFS - unable to join popularity gossip", "error", err)
+		return
+	}
+	defer sub.Close()
+
+	go func() {
+		ticker := time.NewTicker(popularityInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				hints := t.collect()
+				if len(hints) == 0 {
+					continue
+				}
+				data, err := json.Marshal(popularityMessage{Hints: hints})
+				if err != nil {
+					continue
+				}
+				if err := ipfs.PubSub().Publish(ctx, popularityTopic, data); err != nil {
+					log.Debug("ethoFS - unable to gossip popularity hints", "error", err)
+					continue
+				}
+				popularitySentMeter.Mark(int64(len(hints)))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			return
+		}
+		if msg.From() == t.node.Identity {
+			continue
+		}
+		var payload popularityMessage
+		if err := json.Unmarshal(msg.Data(), &payload); err != nil {
+			log.Trace("ethoFS - invalid popularity gossip", "peer", msg.From(), "error", err)
+			continue
+		}
+		popularityReceivedMeter.Mark(int64(len(payload.Hints)))
+		for _, c := range t.receive(msg.From(), payload.Hints) {
+			popularityHotMeter.Mark(1)
+			log.Debug("ethoFS - content turned hot", "cid", c)
+			currentProviderHints().warm(ctx, c)
+		}
+	}
+}
+
+// replicationTarget returns the number of providers the re-replication of the
+// hosting contract aims for, raised for content the swarm reports as hot.
+func replicationTarget(hash string) uint64 {
+	if c, err := cid.Decode(hash); err == nil && currentPopularity().isHot(c) {
+		return repFactor * hotReplicationFactor
+	}
+	return repFactor
+}
+
+// popularityOption counts the gateway requests of the roots stored locally.
+func popularityOption(tracker *popularityTracker) corehttp.ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				tracker.served(contentRoot(r.URL.Path))
+			}
+			childMux.ServeHTTP(w, r)
+		})
+		return childMux, nil
+	}
+}
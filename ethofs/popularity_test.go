@@ -0,0 +1,104 @@
+package ethofs
+
+import (
+	"testing"
+	"time"
+
+	merkledag "github.com/ipfs/go-merkledag"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestBucketHits(t *testing.T) {
+	for hits, want := range map[uint64]uint64{0: 0, 1: 1, 3: 2, 4: 4, 48: 32, 1000: maxPeerPopularityHits, 1 << 63: maxPeerPopularityHits} {
+		if have := bucketHits(hits); have != want {
+			t.Errorf("hits %d: bucket mismatch: have %d, want %d", hits, have, want)
+		}
+	}
+}
+
+func TestPopularityGossip(t *testing.T) {
+	tracker, err := newPopularityTracker(nil)
+	if err != nil {
+		t.Fatalf("failed to create tracker: %v", err)
+	}
+	now := time.Unix(1600000000, 0)
+	tracker.now = func() time.Time { return now }
+
+	hot := merkledag.NodeWithData([]byte("hot")).Cid()
+	rare := merkledag.NodeWithData([]byte("rare")).Cid()
+
+	// Rarely requested roots stay private, counts are bucketed
+	tracker.local[hot] = 300
+	tracker.local[rare] = minPopularityHits - 1
+	hints := tracker.collect()
+	if len(hints) != 1 || hints[0].Cid != hot.String() || hints[0].Hits != maxPeerPopularityHits {
+		t.Fatalf("collected hints mismatch: have %v", hints)
+	}
+	if len(tracker.local) != 0 {
+		t.Errorf("local counters not reset")
+	}
+	// Hints of several peers add up until the root turns hot, no peer counts
+	// for more than its capped hits
+	hint := []popularityHint{{Cid: hot.String(), Hits: 1 << 63}}
+	if turned := tracker.receive(peer.ID("a"), hint); len(turned) != 0 {
+		t.Errorf("root hot after a single peer: %v", turned)
+	}
+	if turned := tracker.receive(peer.ID("a"), hint); len(turned) != 0 {
+		t.Errorf("repeated hints of a peer counted twice: %v", turned)
+	}
+	for _, id := range []peer.ID{"b", "c"} {
+		if turned := tracker.receive(id, hint); len(turned) != 0 {
+			t.Errorf("root hot after %s: %v", id, turned)
+		}
+	}
+	if turned := tracker.receive(peer.ID("d"), hint); len(turned) != 1 || !turned[0].Equals(hot) {
+		t.Fatalf("hot roots mismatch: have %v, want [%s]", turned, hot)
+	}
+	if turned := tracker.receive(peer.ID("e"), hint); len(turned) != 0 {
+		t.Errorf("hot root reported again: %v", turned)
+	}
+	if !tracker.isHot(hot) || tracker.isHot(rare) {
+		t.Errorf("hot state mismatch: hot %v, rare %v", tracker.isHot(hot), tracker.isHot(rare))
+	}
+	// Hints leaving the window cool the root down
+	now = now.Add(popularityWindow + time.Second)
+	if tracker.isHot(hot) {
+		t.Errorf("root still hot after the window")
+	}
+}
+
+func TestPopularRoots(t *testing.T) {
+	tracker, err := newPopularityTracker(nil)
+	if err != nil {
+		t.Fatalf("failed to create tracker: %v", err)
+	}
+	var (
+		now  = time.Unix(1600000000, 0)
+		low  = merkledag.NodeWithData([]byte("low")).Cid()
+		high = merkledag.NodeWithData([]byte("high")).Cid()
+		old  = merkledag.NodeWithData([]byte("old")).Cid()
+		rare = merkledag.NodeWithData([]byte("rare")).Cid()
+	)
+	tracker.now = func() time.Time { return now }
+	for _, id := range []peer.ID{"a", "b", "c"} {
+		tracker.receive(id, []popularityHint{{Cid: old.String(), Hits: 1024}})
+	}
+	now = now.Add(popularityWindow + time.Second)
+	for _, id := range []peer.ID{"a", "b", "c"} {
+		tracker.receive(id, []popularityHint{{Cid: low.String(), Hits: 8}, {Cid: high.String(), Hits: 64}})
+	}
+	// Roots of too few peers are not popular, however many hits they report
+	tracker.receive(peer.ID("a"), []popularityHint{{Cid: rare.String(), Hits: 1024}})
+	tracker.receive(peer.ID("b"), []popularityHint{{Cid: rare.String(), Hits: 1024}})
+
+	roots := tracker.popular(10)
+	if len(roots) != 2 || !roots[0].Equals(high) || !roots[1].Equals(low) {
+		t.Fatalf("popular roots mismatch: have %v, want [%s %s]", roots, high, low)
+	}
+	if roots := tracker.popular(1); len(roots) != 1 || !roots[0].Equals(high) {
+		t.Errorf("limited popular roots mismatch: have %v", roots)
+	}
+	if (*popularityTracker)(nil).popular(1) != nil {
+		t.Errorf("disabled tracker returned popular roots")
+	}
+}
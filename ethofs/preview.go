@@ -0,0 +1,338 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	gopath "path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	lru "github.com/hashicorp/golang-lru"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	previewPrefix   = "/ethofs/preview/"
+	thumbnailPrefix = "/ethofs/thumbnail/"
+
+	defaultThumbnailSize = 128
+	maxThumbnailSize     = 1024
+	maxThumbnailSource   = 32 * MB
+
+	// maxThumbnailPixels bounds the decoded size of a thumbnail source. The
+	// dimensions of an image header are checked before decoding it, a small
+	// file may claim a huge canvas.
+	maxThumbnailPixels = 40 * 1000 * 1000
+
+	// maxPreviews bounds the derived previews remembered by the gateway.
+	maxPreviews = 4096
+)
+
+var errImageTooLarge = errors.New("image dimensions too large")
+
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Path}}</title></head>
+<body>
+<h1>{{.Path}}</h1>
+<table>
+{{range .Entries}}<tr>
+<td>{{if .Thumbnail}}<img src="{{.Thumbnail}}" alt="">{{end}}</td>
+<td><a href="{{.Link}}">{{.Name}}</a></td>
+<td>{{.Type}}</td>
+<td>{{.Size}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type previewEntry struct {
+	Name      string
+	Link      string
+	Thumbnail string
+	Type      string
+	Size      uint64
+}
+
+// previewCache maps source CIDs (with rendering parameters) to the CIDs of the
+// derived previews generated from them, evicting the least recently used.
+type previewCache struct {
+	derived *lru.Cache
+}
+
+func newPreviewCache() *previewCache {
+	derived, _ := lru.New(maxPreviews)
+	return &previewCache{derived: derived}
+}
+
+func (c *previewCache) get(key string) (path.Resolved, bool) {
+	p, ok := c.derived.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return p.(path.Resolved), true
+}
+
+func (c *previewCache) put(key string, p path.Resolved) {
+	c.derived.Add(key, p)
+}
+
+func (c *previewCache) drop(key string) {
+	c.derived.Remove(key)
+}
+
+// previewOption serves generated directory listings under /ethofs/preview/
+// and image thumbnails under /ethofs/thumbnail/. Generated content is added
+// to the repo so repeated requests are served from the derived CID.
+func previewOption() corehttp.ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		api, err := coreapi.NewCoreAPI(n)
+		if err != nil {
+			return nil, err
+		}
+		cache := newPreviewCache()
+
+		mux.HandleFunc(previewPrefix, func(w http.ResponseWriter, r *http.Request) {
+			servePreview(w, r, api, cache)
+		})
+		mux.HandleFunc(thumbnailPrefix, func(w http.ResponseWriter, r *http.Request) {
+			serveThumbnail(w, r, api, cache)
+		})
+		return mux, nil
+	}
+}
+
+func servePreview(w http.ResponseWriter, r *http.Request, api icore.CoreAPI, cache *previewCache) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	urlPath := "/ipfs/" + strings.TrimPrefix(r.URL.Path, previewPrefix)
+	resolved, err := api.ResolvePath(ctx, path.New(urlPath))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	key := "index:" + resolved.Cid().String()
+	if serveDerived(ctx, w, api, cache, key, "text/html; charset=utf-8") {
+		return
+	}
+	entries, err := api.Unixfs().Ls(ctx, resolved, options.Unixfs.ResolveChildren(true))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var listing []previewEntry
+	for entry := range entries {
+		if entry.Err != nil {
+			http.Error(w, entry.Err.Error(), http.StatusInternalServerError)
+			return
+		}
+		item := previewEntry{
+			Name: entry.Name,
+			Link: gopath.Join(urlPath, entry.Name),
+			Type: entry.Type.String(),
+			Size: entry.Size,
+		}
+		if entry.Type == icore.TDirectory {
+			item.Link = gopath.Join(previewPrefix, strings.TrimPrefix(urlPath, "/ipfs/"), entry.Name)
+		} else if isImage(entry.Name) {
+			item.Thumbnail = gopath.Join(thumbnailPrefix, strings.TrimPrefix(urlPath, "/ipfs/"), entry.Name)
+		}
+		listing = append(listing, item)
+	}
+	sort.Slice(listing, func(i, j int) bool { return listing[i].Name < listing[j].Name })
+
+	buf := new(bytes.Buffer)
+	if err := previewTemplate.Execute(buf, struct {
+		Path    string
+		Entries []previewEntry
+	}{urlPath, listing}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	storeDerived(ctx, api, cache, key, buf.Bytes())
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func serveThumbnail(w http.ResponseWriter, r *http.Request, api icore.CoreAPI, cache *previewCache) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	size := defaultThumbnailSize
+	if s := r.URL.Query().Get("size"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil || parsed <= 0 || parsed > maxThumbnailSize {
+			http.Error(w, "invalid thumbnail size", http.StatusBadRequest)
+			return
+		}
+		size = parsed
+	}
+	urlPath := "/ipfs/" + strings.TrimPrefix(r.URL.Path, thumbnailPrefix)
+	resolved, err := api.ResolvePath(ctx, path.New(urlPath))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	key := fmt.Sprintf("thumb:%d:%s", size, resolved.Cid())
+	if serveDerived(ctx, w, api, cache, key, "image/png") {
+		return
+	}
+	nd, err := api.Unixfs().Get(ctx, resolved)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	file := files.ToFile(nd)
+	if file == nil {
+		http.Error(w, "not a file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	src, err := decodeThumbnailSource(file)
+	if err == errImageTooLarge {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "unsupported image: "+err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, scaleImage(src, size)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	storeDerived(ctx, api, cache, key, buf.Bytes())
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(buf.Bytes())
+}
+
+// decodeThumbnailSource decodes an untrusted image, refusing images whose
+// header claims more than maxThumbnailPixels before allocating the canvas.
+func decodeThumbnailSource(r io.ReadSeeker) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(io.LimitReader(r, maxThumbnailSource))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxThumbnailPixels {
+		return nil, errImageTooLarge
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(io.LimitReader(r, maxThumbnailSource))
+	return src, err
+}
+
+// serveDerived writes a previously generated preview to the response if it is
+// still available in the repo.
+func serveDerived(ctx context.Context, w http.ResponseWriter, api icore.CoreAPI, cache *previewCache, key string, contentType string) bool {
+	derived, ok := cache.get(key)
+	if !ok {
+		return false
+	}
+	nd, err := api.Unixfs().Get(ctx, derived)
+	if err != nil {
+		// The derived blocks were garbage collected, regenerate them
+		cache.drop(key)
+		return false
+	}
+	file := files.ToFile(nd)
+	if file == nil {
+		cache.drop(key)
+		return false
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Ethofs-Preview", derived.Cid().String())
+	io.Copy(w, file)
+	return true
+}
+
+// storeDerived adds a generated preview to the repo and records its CID.
+func storeDerived(ctx context.Context, api icore.CoreAPI, cache *previewCache, key string, data []byte) {
+	derived, err := api.Unixfs().Add(ctx, files.NewBytesFile(data), options.Unixfs.Pin(false))
+	if err != nil {
+		log.Debug("ethoFS - unable to store gateway preview", "key", key, "error", err)
+		return
+	}
+	cache.put(key, derived)
+}
+
+func isImage(name string) bool {
+	switch strings.ToLower(gopath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif":
+		return true
+	}
+	return false
+}
+
+// scaleImage downsamples the image so its longest side is at most size pixels,
+// averaging the source pixels covered by each destination pixel.
+func scaleImage(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return src
+	}
+	dstWidth, dstHeight := size, size
+	if width > height {
+		dstHeight = height * size / width
+	} else {
+		dstWidth = width * size / height
+	}
+	if dstWidth < 1 {
+		dstWidth = 1
+	}
+	if dstHeight < 1 {
+		dstHeight = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0, y1 := bounds.Min.Y+y*height/dstHeight, bounds.Min.Y+(y+1)*height/dstHeight
+		for x := 0; x < dstWidth; x++ {
+			x0, x1 := bounds.Min.X+x*width/dstWidth, bounds.Min.X+(x+1)*width/dstWidth
+
+			var r, g, b, a, count uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					sr, sg, sb, sa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+sr, g+sg, b+sb, a+sa
+					count++
+				}
+			}
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset+0] = uint8(r / count >> 8)
+			dst.Pix[offset+1] = uint8(g / count >> 8)
+			dst.Pix[offset+2] = uint8(b / count >> 8)
+			dst.Pix[offset+3] = uint8(a / count >> 8)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,75 @@
+package ethofs
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestScaleImage(t *testing.T) {
+	tests := []struct {
+		width, height int
+		size          int
+		wantW, wantH  int
+	}{
+		{64, 32, 128, 64, 32},    // already small enough
+		{512, 256, 128, 128, 64}, // landscape
+		{256, 512, 128, 64, 128}, // portrait
+		{4000, 1, 128, 128, 1},   // degenerate strip
+	}
+	for i, tt := range tests {
+		src := image.NewRGBA(image.Rect(0, 0, tt.width, tt.height))
+		dst := scaleImage(src, tt.size)
+		if b := dst.Bounds(); b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+			t.Errorf("test %d: size mismatch: have %dx%d, want %dx%d", i, b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestScaleImageAverages(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if (x+y)%2 == 0 {
+				src.Set(x, y, color.RGBA{255, 255, 255, 255})
+			} else {
+				src.Set(x, y, color.RGBA{0, 0, 0, 255})
+			}
+		}
+	}
+	dst := scaleImage(src, 1).(*image.RGBA)
+	if have := dst.RGBAAt(0, 0); have.R < 120 || have.R > 135 || have.A != 255 {
+		t.Errorf("averaged pixel mismatch: have %v", have)
+	}
+}
+
+func TestDecodeThumbnailSource(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 16, 8))); err != nil {
+		t.Fatal(err)
+	}
+	src, err := decodeThumbnailSource(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := src.Bounds(); b.Dx() != 16 || b.Dy() != 8 {
+		t.Errorf("decoded size mismatch: have %dx%d, want 16x8", b.Dx(), b.Dy())
+	}
+	// A GIF header claiming a 65535x65535 canvas in a few bytes
+	bomb := []byte("GIF89a\xff\xff\xff\xff\x00\x00\x00")
+	if _, err := decodeThumbnailSource(bytes.NewReader(bomb)); err != errImageTooLarge {
+		t.Errorf("oversized image: have %v, want %v", err, errImageTooLarge)
+	}
+}
+
+func TestPreviewCacheBounded(t *testing.T) {
+	cache := newPreviewCache()
+	for i := 0; i < maxPreviews+10; i++ {
+		cache.put(string(rune(i)), nil)
+	}
+	if n := cache.derived.Len(); n != maxPreviews {
+		t.Errorf("cached previews: have %d, want %d", n, maxPreviews)
+	}
+}
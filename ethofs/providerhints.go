@@ -0,0 +1,229 @@
+package ethofs
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	lru "github.com/hashicorp/golang-lru"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/corehttp"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const (
+	// providerHintTTL is how long the hosts registered for a CID are served
+	// from the cache before they are refreshed from the registry in the
+	// background.
+	providerHintTTL = 10 * time.Minute
+
+	// maxProviderHints caps the hosts taken from the registry per CID.
+	maxProviderHints = 16
+
+	// maxProviderHintRoots bounds the CIDs with cached hints, evicting the
+	// least recently used one.
+	maxProviderHintRoots = 1024
+
+	providerHintLookupTimeout = 5 * time.Second
+	providerHintDialTimeout   = 10 * time.Second
+)
+
+// ProviderRegistryABI is the interface of the contract recording the hosts of
+// the content of the hosting contract, listed as /p2p/ multiaddrs per CID.
+const ProviderRegistryABI = "[{\"constant\":true,\"inputs\":[{\"name\":\"pin\",\"type\":\"string\"}],\"name\":\"GetProviderCount\",\"outputs\":[{\"name\":\"\",\"type\":\"uint32\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":true,\"inputs\":[{\"name\":\"pin\",\"type\":\"string\"},{\"name\":\"index\",\"type\":\"uint256\"}],\"name\":\"GetProvider\",\"outputs\":[{\"name\":\"\",\"type\":\"string\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"}]"
+
+var (
+	providerHintLookupMeter = metrics.NewRegisteredMeter("ethofs/providers/hints/lookups", nil)
+	providerHintDialMeter   = metrics.NewRegisteredMeter("ethofs/providers/hints/dials", nil)
+)
+
+var (
+	providerHintsLock sync.RWMutex
+	providerHints     *providerHintCache // Hint cache of the running node, nil without a registry
+)
+
+// currentProviderHints returns the provider hint cache of the running node,
+// or nil if no registry is configured.
+func currentProviderHints() *providerHintCache {
+	providerHintsLock.RLock()
+	defer providerHintsLock.RUnlock()
+
+	return providerHints
+}
+
+// setProviderHints replaces the provider hint cache of the running node.
+func setProviderHints(hints *providerHintCache) {
+	providerHintsLock.Lock()
+	defer providerHintsLock.Unlock()
+
+	providerHints = hints
+}
+
+// providerHint is the cached registry entry of a CID.
+type providerHint struct {
+	providers  []peer.AddrInfo
+	expires    time.Time
+	refreshing bool // A background refresh is in flight
+}
+
+// providerHintCache looks up the registered hosts of content about to be
+// retrieved and connects to them, so bitswap asks them for the blocks right
+// away instead of waiting for a DHT provider search. Only the first lookup of
+// a CID waits for the registry, expired entries are served while they are
+// refreshed in the background.
+type providerHintCache struct {
+	ctx   context.Context
+	node  *core.IpfsNode
+	query func(ctx context.Context, c cid.Cid) ([]peer.AddrInfo, error)
+
+	registry common.Address
+	abi      abi.ABI
+
+	lock  sync.Mutex
+	hints *lru.Cache // cid -> *providerHint
+}
+
+func newProviderHintCache(node *core.IpfsNode, registry string) (*providerHintCache, error) {
+	hints, err := lru.New(maxProviderHintRoots)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := abi.JSON(strings.NewReader(ProviderRegistryABI))
+	if err != nil {
+		return nil, err
+	}
+	h := &providerHintCache{ctx: node.Context(), node: node, registry: common.HexToAddress(registry), abi: parsed, hints: hints}
+	h.query = h.queryRegistry
+	return h, nil
+}
+
+// queryRegistry reads the registered hosts of the CID from the registry.
+func (h *providerHintCache) queryRegistry(ctx context.Context, c cid.Cid) ([]peer.AddrInfo, error) {
+	if ethClient == nil {
+		return nil, errNoEthClient
+	}
+	contract := bind.NewBoundContract(h.registry, h.abi, ethClient, nil, nil)
+	opts := &bind.CallOpts{Context: ctx}
+
+	count := new(uint32)
+	if err := contract.Call(opts, count, "GetProviderCount", c.String()); err != nil {
+		return nil, err
+	}
+	var addrs []ma.Multiaddr
+	for i := uint32(0); i < *count && i < maxProviderHints; i++ {
+		addr := new(string)
+		if err := contract.Call(opts, addr, "GetProvider", c.String(), new(big.Int).SetUint64(uint64(i))); err != nil {
+			return nil, err
+		}
+		maddr, err := ma.NewMultiaddr(*addr)
+		if err == nil {
+			if _, id := peer.SplitAddr(maddr); id == "" {
+				err = peer.ErrInvalidAddr
+			}
+		}
+		if err != nil {
+			log.Debug("ethoFS - skipping invalid provider hint", "cid", c, "addr", *addr, "error", err)
+			continue
+		}
+		addrs = append(addrs, maddr)
+	}
+	return peer.AddrInfosFromP2pAddrs(addrs...)
+}
+
+// lookup returns the registered hosts of the CID. Cached entries are returned
+// right away, expired ones are refreshed in the background.
+func (h *providerHintCache) lookup(ctx context.Context, c cid.Cid) []peer.AddrInfo {
+	h.lock.Lock()
+	if cached, ok := h.hints.Get(c); ok {
+		hint := cached.(*providerHint)
+		if !hint.refreshing && time.Now().After(hint.expires) {
+			hint.refreshing = true
+			go h.refresh(h.ctx, c, hint.providers)
+		}
+		h.lock.Unlock()
+		return hint.providers
+	}
+	h.lock.Unlock()
+
+	return h.refresh(ctx, c, nil)
+}
+
+// refresh reads the hosts of the CID from the registry and caches them. A
+// failed lookup keeps the previous hosts until the next refresh, leaving
+// content without any to the DHT.
+func (h *providerHintCache) refresh(ctx context.Context, c cid.Cid, previous []peer.AddrInfo) []peer.AddrInfo {
+	providerHintLookupMeter.Mark(1)
+
+	ctx, cancel := context.WithTimeout(ctx, providerHintLookupTimeout)
+	defer cancel()
+
+	providers, err := h.query(ctx, c)
+	if err != nil {
+		log.Debug("ethoFS - provider hint lookup failed", "cid", c, "error", err)
+		providers = previous
+	}
+	h.lock.Lock()
+	h.hints.Add(c, &providerHint{providers: providers, expires: time.Now().Add(providerHintTTL)})
+	h.lock.Unlock()
+
+	return providers
+}
+
+// warm prepares the retrieval of the CID unless it is stored locally: the
+// registered hosts are added to the peerstore and dialed in the background.
+// Bitswap sends its wants to every newly connected peer, so the blocks are
+// requested from the hosts as soon as they are connected.
+func (h *providerHintCache) warm(ctx context.Context, c cid.Cid) {
+	if h == nil || !c.Defined() || !h.node.IsOnline {
+		return
+	}
+	if has, err := h.node.Blockstore.Has(c); err != nil || has {
+		return
+	}
+	for _, info := range h.lookup(ctx, c) {
+		if info.ID == h.node.Identity || len(h.node.PeerHost.Network().ConnsToPeer(info.ID)) > 0 {
+			continue
+		}
+		h.node.Peerstore.AddAddrs(info.ID, info.Addrs, peerstore.ProviderAddrTTL)
+
+		providerHintDialMeter.Mark(1)
+		go func(info peer.AddrInfo) {
+			ctx, cancel := context.WithTimeout(h.node.Context(), providerHintDialTimeout)
+			defer cancel()
+
+			err := h.node.PeerHost.Connect(ctx, info)
+			dialFailures.record("hint", info.ID, err)
+			if err != nil {
+				log.Trace("ethoFS - failed to dial hinted provider", "cid", c, "peer", info.ID, "error", err)
+			}
+		}(info)
+	}
+}
+
+// providerHintOption warms the providers of the content requested from the
+// gateway.
+func providerHintOption(hints *providerHintCache) corehttp.ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				hints.warm(r.Context(), contentRoot(r.URL.Path))
+			}
+			childMux.ServeHTTP(w, r)
+		})
+		return childMux, nil
+	}
+}
@@ -0,0 +1,91 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	cid "github.com/ipfs/go-cid"
+	merkledag "github.com/ipfs/go-merkledag"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// newTestProviderHints creates a hint cache answering lookups with query.
+func newTestProviderHints(t *testing.T, query func(context.Context, cid.Cid) ([]peer.AddrInfo, error)) *providerHintCache {
+	hints, err := lru.New(maxProviderHintRoots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &providerHintCache{ctx: context.Background(), query: query, hints: hints}
+}
+
+func TestProviderHintCache(t *testing.T) {
+	var (
+		queries int32
+		fail    int32
+		served  = []peer.AddrInfo{{ID: peer.ID("host")}}
+	)
+	h := newTestProviderHints(t, func(context.Context, cid.Cid) ([]peer.AddrInfo, error) {
+		atomic.AddInt32(&queries, 1)
+		if atomic.LoadInt32(&fail) == 1 {
+			return nil, errors.New("registry unavailable")
+		}
+		return served, nil
+	})
+	c := merkledag.NewRawNode([]byte("hinted")).Cid()
+
+	// The first lookup waits for the registry, the next ones hit the cache
+	for i := 0; i < 3; i++ {
+		if providers := h.lookup(context.Background(), c); len(providers) != 1 || providers[0].ID != "host" {
+			t.Fatalf("lookup %d: providers mismatch: %v", i, providers)
+		}
+	}
+	if n := atomic.LoadInt32(&queries); n != 1 {
+		t.Errorf("registry queries mismatch: have %d, want 1", n)
+	}
+	// Expired hints are served while refreshed, failed refreshes keep them
+	atomic.StoreInt32(&fail, 1)
+	cached, _ := h.hints.Get(c)
+	cached.(*providerHint).expires = time.Now().Add(-time.Second)
+
+	if providers := h.lookup(context.Background(), c); len(providers) != 1 {
+		t.Fatalf("stale lookup: providers mismatch: %v", providers)
+	}
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&queries) != 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("stale hints not refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		h.lock.Lock()
+		cached, _ := h.hints.Get(c)
+		hint := cached.(*providerHint)
+		refreshed := !hint.refreshing && time.Now().Before(hint.expires)
+		h.lock.Unlock()
+
+		if refreshed {
+			if len(hint.providers) != 1 {
+				t.Errorf("failed refresh dropped providers: %v", hint.providers)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("refreshed hints not cached")
+		}
+	}
+}
+
+func TestProviderHintCacheUnset(t *testing.T) {
+	setProviderHints(nil)
+
+	// Without a registry the hint cache is nil and warming is a no-op
+	hints := currentProviderHints()
+	if hints != nil {
+		t.Fatalf("hint cache set without registry")
+	}
+	hints.warm(context.Background(), merkledag.NewRawNode([]byte("hinted")).Cid())
+}
@@ -0,0 +1,142 @@
+package ethofs
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	// defaultProviderLimit is the number of providers a lookup stops at.
+	defaultProviderLimit = 20
+
+	// maxProviderLimit caps the providers of a single lookup.
+	maxProviderLimit = 100
+
+	// providerLookupTimeout bounds a provider lookup that has not found enough
+	// providers yet.
+	providerLookupTimeout = 10 * time.Second
+
+	// maxProviderLookupTimeout caps the duration requested for a lookup.
+	maxProviderLookupTimeout = time.Minute
+)
+
+// ProviderOptions controls a provider lookup.
+type ProviderOptions struct {
+	Limit   int `json:"limit"`   // Providers to stop the lookup at
+	Timeout int `json:"timeout"` // Maximum duration of the lookup in seconds
+}
+
+// timeout returns the duration the lookup may take.
+func (o ProviderOptions) timeout() time.Duration {
+	if o.Timeout <= 0 {
+		return providerLookupTimeout
+	}
+	if o.Timeout >= int(maxProviderLookupTimeout/time.Second) {
+		return maxProviderLookupTimeout
+	}
+	return time.Duration(o.Timeout) * time.Second
+}
+
+// Provider is a peer of the swarm announcing to hold a CID.
+type Provider struct {
+	ID        string   `json:"id"`
+	Addrs     []string `json:"addrs"`
+	Connected bool     `json:"connected"` // Peer has a connection to the node
+}
+
+// ProviderRecords are the providers of a CID known to the routing system.
+type ProviderRecords struct {
+	Cid       string     `json:"cid"`
+	Local     bool       `json:"local"`     // Root block stored in the local repo
+	Providers []Provider `json:"providers"` // Other peers holding the CID
+	Replicas  int        `json:"replicas"`  // Copies on the network, counting the local one
+	Complete  bool       `json:"complete"`  // Lookup ended before reaching the limit or timeout
+}
+
+// providers looks up the other peers announcing the CID. The swarm key keeps
+// the routing system to the private network, so all of them are ethoFS nodes.
+func providers(ctx context.Context, node *core.IpfsNode, c cid.Cid, opts ProviderOptions) (*ProviderRecords, error) {
+	if !node.IsOnline {
+		return nil, errNodeOffline
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultProviderLimit
+	}
+	if opts.Limit > maxProviderLimit {
+		opts.Limit = maxProviderLimit
+	}
+	local, err := node.Blockstore.Has(c)
+	if err != nil {
+		return nil, err
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, opts.timeout())
+	defer cancel()
+
+	records := &ProviderRecords{Cid: c.String(), Local: local, Providers: []Provider{}}
+	seen := make(map[peer.ID]struct{})
+
+	// The lookup asks for one more in case the node finds itself
+	for info := range node.Routing.FindProvidersAsync(lookupCtx, c, opts.Limit+1) {
+		if _, ok := seen[info.ID]; ok || info.ID == node.Identity {
+			continue
+		}
+		seen[info.ID] = struct{}{}
+
+		provider := Provider{
+			ID:        info.ID.Pretty(),
+			Addrs:     make([]string, 0, len(info.Addrs)),
+			Connected: node.PeerHost.Network().Connectedness(info.ID) == network.Connected,
+		}
+		for _, addr := range info.Addrs {
+			provider.Addrs = append(provider.Addrs, addr.String())
+		}
+		records.Providers = append(records.Providers, provider)
+		if len(records.Providers) == opts.Limit {
+			break
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	records.Complete = len(records.Providers) < opts.Limit && lookupCtx.Err() == nil
+	sort.Slice(records.Providers, func(i, j int) bool { return records.Providers[i].ID < records.Providers[j].ID })
+
+	records.Replicas = len(records.Providers)
+	if local {
+		records.Replicas++
+	}
+	log.Debug("ethoFS - provider lookup complete", "cid", c, "providers", len(records.Providers), "local", local, "complete", records.Complete)
+	return records, nil
+}
+
+// Providers looks up the peers of the private network holding the CID, e.g.
+// to count its replicas before pinning another copy.
+func (s *EthofsService) Providers(ctx context.Context, c cid.Cid, opts ProviderOptions) (*ProviderRecords, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	return providers(ctx, node, c, opts)
+}
+
+// Providers returns the peers of the network holding the CID.
+func (api *PublicEthofsAPI) Providers(ctx context.Context, hash string, opts *ProviderOptions) (_ *ProviderRecords, err error) {
+	defer trackCall("providers", time.Now(), &err)
+
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = new(ProviderOptions)
+	}
+	return api.service.Providers(ctx, c, *opts)
+}
@@ -0,0 +1,24 @@
+package ethofs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProviderOptionsTimeout(t *testing.T) {
+	tests := []struct {
+		seconds int
+		want    time.Duration
+	}{
+		{0, providerLookupTimeout},
+		{-1, providerLookupTimeout},
+		{3, 3 * time.Second},
+		{3600, maxProviderLookupTimeout},
+		{1 << 62, maxProviderLookupTimeout},
+	}
+	for _, tt := range tests {
+		if have := (ProviderOptions{Timeout: tt.seconds}).timeout(); have != tt.want {
+			t.Errorf("timeout of %d seconds: have %v, want %v", tt.seconds, have, tt.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	icore "github.com/ipfs/interface-go-ipfs-core"
+)
+
+// messageChanSize is the buffer of subscription channels. Messages arriving
+// while it is full wait, eventually making libp2p drop newer ones.
+const messageChanSize = 64
+
+var (
+	errPubSubDisabled = errors.New("ethoFS pubsub disabled")
+	errUnknownSub     = errors.New("unknown subscription")
+)
+
+// Message is a pubsub message received on the ethoFS private swarm.
+type Message struct {
+	From  string        `json:"from"`
+	Topic string        `json:"topic"`
+	Data  hexutil.Bytes `json:"data"`
+	Seq   hexutil.Bytes `json:"seq"`
+}
+
+// subscriptions tracks the open topic subscriptions of the service so they
+// can be cancelled individually.
+type subscriptions struct {
+	lock sync.Mutex
+	subs map[<-chan Message]context.CancelFunc
+}
+
+func (s *subscriptions) add(ch <-chan Message, cancel context.CancelFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.subs == nil {
+		s.subs = make(map[<-chan Message]context.CancelFunc)
+	}
+	s.subs[ch] = cancel
+}
+
+func (s *subscriptions) remove(ch <-chan Message) (context.CancelFunc, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	cancel, ok := s.subs[ch]
+	delete(s.subs, ch)
+	return cancel, ok
+}
+
+// Subscribe joins the pubsub topic and returns the channel receiving its
+// messages. The channel is closed on Unsubscribe or when the node stops.
+func (s *EthofsService) Subscribe(topic string) (<-chan Message, error) {
+	if s.config.PubSub.Disabled {
+		return nil, errPubSubDisabled
+	}
+	ipfs, node := s.API(), s.Node()
+	if ipfs == nil || node == nil {
+		return nil, errNodeNotRunning
+	}
+	ctx, cancel := context.WithCancel(node.Context())
+	sub, err := ipfs.PubSub().Subscribe(ctx, topic)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	ch := make(chan Message, messageChanSize)
+	s.subs.add(ch, cancel)
+
+	go func() {
+		defer close(ch)
+		defer s.subs.remove(ch)
+		defer sub.Close()
+
+		s.deliver(ctx, topic, sub, ch)
+	}()
+	return ch, nil
+}
+
+// deliver forwards the messages of the subscription until it is cancelled.
+func (s *EthofsService) deliver(ctx context.Context, topic string, sub icore.PubSubSubscription, ch chan<- Message) {
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Debug("ethoFS - pubsub subscription failed", "topic", topic, "error", err)
+			}
+			return
+		}
+		select {
+		case ch <- Message{From: msg.From().Pretty(), Topic: topic, Data: msg.Data(), Seq: msg.Seq()}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Unsubscribe leaves the topic of a subscription returned by Subscribe.
+func (s *EthofsService) Unsubscribe(ch <-chan Message) error {
+	cancel, ok := s.subs.remove(ch)
+	if !ok {
+		return errUnknownSub
+	}
+	cancel()
+	return nil
+}
+
+// Publish broadcasts the data to the subscribers of the topic.
+func (s *EthofsService) Publish(ctx context.Context, topic string, data []byte) error {
+	if s.config.PubSub.Disabled {
+		return errPubSubDisabled
+	}
+	ipfs := s.API()
+	if ipfs == nil {
+		return errNodeNotRunning
+	}
+	return ipfs.PubSub().Publish(ctx, topic, data)
+}
+
+// Messages creates an RPC subscription streaming the messages of a pubsub
+// topic.
+func (api *PublicEthofsAPI) Messages(ctx context.Context, topic string) (_ *rpc.Subscription, err error) {
+	defer trackCall("messages", time.Now(), &err)
+
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	ch, err := api.service.Subscribe(topic)
+	if err != nil {
+		return nil, err
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		defer api.service.Unsubscribe(ch)
+		for {
+			select {
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				notifier.Notify(rpcSub.ID, msg)
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
+// Publish broadcasts the data to the subscribers of the pubsub topic.
+func (api *PublicEthofsAPI) Publish(ctx context.Context, topic string, data hexutil.Bytes) (err error) {
+	defer trackCall("publish", time.Now(), &err)
+
+	return api.service.Publish(ctx, topic, data)
+}
@@ -0,0 +1,61 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPubSubDelivery(t *testing.T) {
+	s, stop := newTestService(t)
+	defer stop()
+
+	ch, err := s.Subscribe("ethofs-test")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Subscriptions propagate asynchronously, publish until delivered
+	var msg Message
+	for delivered := false; !delivered; {
+		if err := s.Publish(ctx, "ethofs-test", []byte("hello")); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+		select {
+		case msg = <-ch:
+			delivered = true
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatalf("message not delivered")
+		}
+	}
+	if msg.Topic != "ethofs-test" || !bytes.Equal(msg.Data, []byte("hello")) || msg.From != s.Node().Identity.Pretty() {
+		t.Errorf("message mismatch: %+v", msg)
+	}
+	if err := s.Unsubscribe(ch); err != nil {
+		t.Fatalf("failed to unsubscribe: %v", err)
+	}
+	for range ch {
+		// Drain messages buffered before the subscription closed
+	}
+	if err := s.Unsubscribe(ch); err != errUnknownSub {
+		t.Errorf("repeated unsubscribe: have %v, want %v", err, errUnknownSub)
+	}
+}
+
+func TestPubSubDisabled(t *testing.T) {
+	s := &EthofsService{config: DefaultConfig}
+	if _, err := s.Subscribe("ethofs-test"); err != errNodeNotRunning {
+		t.Errorf("stopped node: have %v, want %v", err, errNodeNotRunning)
+	}
+	s.config.PubSub.Disabled = true
+	if _, err := s.Subscribe("ethofs-test"); err != errPubSubDisabled {
+		t.Errorf("subscribe: have %v, want %v", err, errPubSubDisabled)
+	}
+	if err := s.Publish(context.Background(), "ethofs-test", nil); err != errPubSubDisabled {
+		t.Errorf("publish: have %v, want %v", err, errPubSubDisabled)
+	}
+}
@@ -0,0 +1,270 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/libp2p/go-libp2p-core/helpers"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// replicateProtocol is the libp2p protocol asking a quorum peer to pin
+// content and confirm once it holds all of it.
+const replicateProtocol = protocol.ID("/ethofs/replicate/1.0.0")
+
+const (
+	defaultQuorumTimeout = 2 * time.Minute
+
+	// maxReplicateMessageSize bounds the requests and responses of the
+	// replication protocol.
+	maxReplicateMessageSize = 4 * 1024
+)
+
+var (
+	errNoQuorumPeers  = errors.New("no ethoFS quorum peers configured")
+	errNotQuorumPeer  = errors.New("peer is not a configured quorum peer")
+	errInvalidQuorum  = errors.New("quorum exceeds the number of quorum peers")
+	errReplicateEmpty = errors.New("empty replication response")
+)
+
+// replicateRequest asks the remote peer to pin a CID.
+type replicateRequest struct {
+	Cid string `json:"cid"`
+}
+
+// replicateResponse confirms a replication, or reports why it failed.
+type replicateResponse struct {
+	Error     string `json:"error,omitempty"`
+	Signature []byte `json:"signature,omitempty"` // Signature of the migration receipt, see migrationReceipt
+}
+
+// QuorumError is returned if fewer quorum peers than required confirmed a
+// replication.
+type QuorumError struct {
+	Confirmed int
+	Required  int
+	Results   []PeerResult
+}
+
+func (e *QuorumError) Error() string {
+	return fmt.Sprintf("replicated to %d of %d quorum peers, %d required", e.Confirmed, len(e.Results), e.Required)
+}
+
+// ErrorCode implements rpc.Error.
+func (e *QuorumError) ErrorCode() int { return ErrCodeInternal }
+
+// ErrorData implements rpc.DataError, handing the outcome per peer to RPC
+// callers, as the local pin and the confirmed replications stay in place.
+func (e *QuorumError) ErrorData() interface{} {
+	return &struct {
+		RPCErrorData
+		Confirmed int          `json:"confirmed"`
+		Required  int          `json:"required"`
+		Results   []PeerResult `json:"results"`
+	}{RPCErrorData{Reason: ErrReasonInternal}, e.Confirmed, e.Required, e.Results}
+}
+
+// checkQuorum fails if fewer than n of the asked peers confirmed.
+func checkQuorum(results []PeerResult, n int) error {
+	var confirmed int
+	for _, r := range results {
+		if r.Success() {
+			confirmed++
+		}
+	}
+	if confirmed < n {
+		return &QuorumError{Confirmed: confirmed, Required: n, Results: results}
+	}
+	return nil
+}
+
+// quorumPeers returns the addresses of the configured quorum peers other
+// than the node itself, so a shared peer list can be configured on all of
+// them.
+func (c *QuorumConfig) quorumPeers(self peer.ID) (map[peer.ID]*peer.AddrInfo, error) {
+	peers, err := parsePeerAddrs(c.Peers)
+	if err != nil {
+		return nil, err
+	}
+	delete(peers, self)
+	return peers, nil
+}
+
+func (c *QuorumConfig) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return defaultQuorumTimeout
+	}
+	return c.Timeout
+}
+
+// serveReplication handles the replication requests of the quorum peers,
+// pinning the requested content before confirming.
+func serveReplication(node *core.IpfsNode, cfg *QuorumConfig) error {
+	peers, err := cfg.quorumPeers(node.Identity)
+	if err != nil {
+		return err
+	}
+	if len(peers) == 0 {
+		return nil
+	}
+	ipfs, err := coreapi.NewCoreAPI(node)
+	if err != nil {
+		return err
+	}
+	timeout := cfg.timeout()
+	node.PeerHost.SetStreamHandler(replicateProtocol, func(s network.Stream) {
+		defer s.Close()
+
+		remote := s.Conn().RemotePeer()
+		if _, ok := peers[remote]; !ok {
+			log.Debug("ethoFS - rejected replication request", "peer", remote, "error", errNotQuorumPeer)
+			s.Reset()
+			return
+		}
+		var req replicateRequest
+		s.SetReadDeadline(time.Now().Add(10 * time.Second))
+		if err := json.NewDecoder(io.LimitReader(s, maxReplicateMessageSize)).Decode(&req); err != nil {
+			s.Reset()
+			return
+		}
+		var res replicateResponse
+		if c, err := cid.Decode(req.Cid); err != nil {
+			res.Error = err.Error()
+		} else {
+			ctx, cancel := context.WithTimeout(node.Context(), timeout)
+			err = pinRecursive(ctx, ipfs, c)
+			cancel()
+			if err != nil {
+				res.Error = err.Error()
+			}
+			log.Info("ethoFS - replicated content for quorum peer", "cid", c, "peer", remote, "error", err)
+		}
+		s.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		json.NewEncoder(s).Encode(&res)
+	})
+	return nil
+}
+
+// replicateTo asks a quorum peer to pin the content and waits for its
+// confirmation.
+func replicateTo(ctx context.Context, node *core.IpfsNode, info peer.AddrInfo, c cid.Cid) error {
+	err := node.PeerHost.Connect(ctx, info)
+	dialFailures.record("quorum", info.ID, err)
+	if err != nil {
+		return err
+	}
+	s, err := node.PeerHost.NewStream(ctx, info.ID, replicateProtocol)
+	if err != nil {
+		return err
+	}
+	defer helpers.FullClose(s)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+	if err := json.NewEncoder(s).Encode(&replicateRequest{Cid: c.String()}); err != nil {
+		s.Reset()
+		return err
+	}
+	var res replicateResponse
+	if err := json.NewDecoder(io.LimitReader(s, maxReplicateMessageSize)).Decode(&res); err != nil {
+		s.Reset()
+		if err == io.EOF {
+			return errReplicateEmpty
+		}
+		return err
+	}
+	if res.Error != "" {
+		return errors.New(res.Error)
+	}
+	return nil
+}
+
+// PinQuorum pins the content locally and only reports success once at least
+// n of the configured quorum peers confirmed they hold it too. If n is zero,
+// the configured quorum size is required, or all quorum peers if none is
+// set. It fails with a *QuorumError if too few peers confirmed in time.
+func (s *EthofsService) PinQuorum(ctx context.Context, c cid.Cid, n int) ([]PeerResult, error) {
+	node, err := s.onlineNode()
+	if err != nil {
+		return nil, err
+	}
+	ipfs := s.API()
+	peers, err := s.config.Quorum.quorumPeers(node.Identity)
+	if err != nil {
+		return nil, err
+	}
+	if len(peers) == 0 {
+		return nil, errNoQuorumPeers
+	}
+	if n == 0 {
+		n = s.config.Quorum.Size
+	}
+	if n == 0 {
+		n = len(peers)
+	}
+	if n > len(peers) {
+		return nil, errInvalidQuorum
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.config.Quorum.timeout())
+	defer cancel()
+
+	start := time.Now()
+	err = pinRecursive(ctx, ipfs, c)
+	history.record("pin", c.String(), "", start, err)
+	if err != nil {
+		return nil, err
+	}
+	feeds.contentPinned.Send(ContentPinned{Cid: c})
+
+	results := make([]PeerResult, 0, len(peers))
+	for id := range peers {
+		results = append(results, PeerResult{ID: id})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+
+	var wg sync.WaitGroup
+	wg.Add(len(results))
+	for i := range results {
+		go func(result *PeerResult) {
+			defer wg.Done()
+			start := time.Now()
+			result.Err = replicateTo(ctx, node, *peers[result.ID], c)
+			result.Latency = time.Since(start)
+			history.record("replicate", c.String(), peer.Encode(result.ID), start, result.Err)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.Err != nil {
+			feeds.replicationFailed.Send(ReplicationFailed{Cid: c, Peer: result.ID, Error: result.Err.Error()})
+		}
+	}
+	return results, checkQuorum(results, n)
+}
+
+// PinQuorum pins the CID and waits until n quorum peers (the configured
+// quorum if zero) confirmed holding it.
+func (api *PrivateEthofsAPI) PinQuorum(ctx context.Context, hash string, n int) (_ []PeerResult, err error) {
+	defer trackCall("pinQuorum", time.Now(), &err)
+
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return nil, err
+	}
+	return api.service.PinQuorum(ctx, c, n)
+}
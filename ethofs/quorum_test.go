@@ -0,0 +1,88 @@
+package ethofs
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestCheckQuorum(t *testing.T) {
+	failed := errors.New("replication failed")
+	results := []PeerResult{{ID: "a"}, {ID: "b"}, {ID: "c", Err: failed}}
+
+	if err := checkQuorum(results, 2); err != nil {
+		t.Errorf("quorum met, unexpected error: %v", err)
+	}
+	err := checkQuorum(results, 3)
+	qerr, ok := err.(*QuorumError)
+	if !ok {
+		t.Fatalf("expected quorum error, have %v", err)
+	}
+	if qerr.Confirmed != 2 || qerr.Required != 3 {
+		t.Errorf("error mismatch: have %d/%d confirmed, want 2/3", qerr.Confirmed, qerr.Required)
+	}
+	// Unlike bootstrapping, the quorum is never capped
+	if err := checkQuorum(results[:1], 2); err == nil {
+		t.Error("quorum above peer count, expected error")
+	}
+}
+
+func TestQuorumRPCError(t *testing.T) {
+	results := []PeerResult{{ID: "a"}, {ID: "b", Err: errors.New("pin failed")}}
+	err := rpcError(checkQuorum(results, 2))
+
+	rerr, ok := err.(rpc.DataError)
+	if !ok {
+		t.Fatalf("quorum error carries no data: %v", err)
+	}
+	data, err := json.Marshal(rerr.ErrorData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Confirmed int `json:"confirmed"`
+		Results   []struct {
+			Success bool   `json:"success"`
+			Error   string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Confirmed != 1 || len(decoded.Results) != 2 || !decoded.Results[0].Success || decoded.Results[1].Error != "pin failed" {
+		t.Errorf("error data mismatch: %s", data)
+	}
+}
+
+func TestQuorumPeersExcludeSelf(t *testing.T) {
+	identities := make([]string, 2)
+	for i := range identities {
+		priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := peer.IDFromPrivateKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		identities[i] = id.Pretty()
+	}
+	cfg := QuorumConfig{Peers: []string{
+		"/ip4/127.0.0.1/tcp/4001/p2p/" + identities[0],
+		"/ip4/127.0.0.1/tcp/4002/p2p/" + identities[1],
+	}}
+	self, _ := peer.Decode(identities[0])
+	peers, err := cfg.quorumPeers(self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := peers[self]; ok || len(peers) != 1 {
+		t.Errorf("quorum peers mismatch: %v", peers)
+	}
+}
@@ -0,0 +1,68 @@
+package ethofs
+
+import (
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	datastore "github.com/ipfs/go-datastore"
+	config "github.com/ipfs/go-ipfs-config"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// Read verification modes of the blockstore.
+const (
+	// readVerifyAll re-hashes every block read from the repo.
+	readVerifyAll = "all"
+
+	// readVerifyUntrusted trusts the blocks of the local repo, only checking
+	// the ones read from block replicas.
+	readVerifyUntrusted = "untrusted"
+)
+
+var replicaCorruptMeter = metrics.NewRegisteredMeter("ethofs/replica/corrupt", nil)
+
+// readVerifyRepo overrides Datastore.HashOnRead of the repo config, which
+// go-ipfs applies to every block read from the blockstore.
+type readVerifyRepo struct {
+	repo.Repo
+	hashOnRead bool
+}
+
+func (r *readVerifyRepo) Config() (*config.Config, error) {
+	cfg, err := r.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	conf := *cfg
+	conf.Datastore.HashOnRead = r.hashOnRead
+	return &conf, nil
+}
+
+// withReadVerification applies the read verification mode to the repo. The
+// repo is returned as is if the mode keeps the repo config.
+func withReadVerification(r repo.Repo, mode string) repo.Repo {
+	switch mode {
+	case readVerifyAll:
+		return &readVerifyRepo{Repo: r, hashOnRead: true}
+	case readVerifyUntrusted:
+		return &readVerifyRepo{Repo: r, hashOnRead: false}
+	}
+	return r
+}
+
+// validReplicaBlock reports whether the data read from a block replica hashes
+// to the CID of its flatfs key.
+func validReplicaBlock(key datastore.Key, data []byte) bool {
+	c, err := dshelp.DsKeyToCid(key)
+	if err != nil {
+		return false
+	}
+	sum, err := c.Prefix().Sum(data)
+	if err != nil || !sum.Equals(c) {
+		replicaCorruptMeter.Mark(1)
+		log.Warn("ethoFS - corrupt block in replica", "cid", c)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,201 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// ReceiptABI is the interface of the contract upload receipts are anchored
+// in, recording the hash of every receipt in a transaction of its uploader.
+const ReceiptABI = "[{\"constant\":false,\"inputs\":[{\"name\":\"receipt\",\"type\":\"bytes32\"}],\"name\":\"anchorReceipt\",\"outputs\":[],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"}]"
+
+// receiptAnchorTimeout bounds the submission of a receipt anchor transaction.
+const receiptAnchorTimeout = 30 * time.Second
+
+var (
+	errNoReceiptContract    = errors.New("no ethoFS receipt contract configured")
+	errInvalidReceiptSigner = errors.New("receipt not signed by its uploader")
+)
+
+// Receipt is the signed proof of an upload: the uploader states having stored
+// the DAG of the CID at the given time.
+type Receipt struct {
+	Cid         string         `json:"cid"`
+	Size        uint64         `json:"size"`      // Total size of the unique blocks of the DAG
+	Blocks      uint64         `json:"blocks"`    // Number of unique blocks of the DAG
+	Timestamp   uint64         `json:"timestamp"` // Unix time of the upload
+	Uploader    common.Address `json:"uploader"`
+	Signature   hexutil.Bytes  `json:"signature"`             // EIP-191 signature of the hash by the uploader
+	Transaction *common.Hash   `json:"transaction,omitempty"` // Anchor transaction, if the receipt was anchored
+}
+
+// Hash returns the hash the uploader signs and anchors: the Keccak256 hash of
+// the RLP encoding of the receipt fields, without signature and transaction.
+func (r *Receipt) Hash() common.Hash {
+	data, _ := rlp.EncodeToBytes([]interface{}{r.Cid, r.Size, r.Blocks, r.Timestamp, r.Uploader})
+	return crypto.Keccak256Hash(data)
+}
+
+// Verify checks that the receipt is signed by its uploader.
+func (r *Receipt) Verify() error {
+	if len(r.Signature) != crypto.SignatureLength {
+		return errInvalidReceiptSigner
+	}
+	signer, err := recoverTextSigner(r.Hash(), r.Signature)
+	if err != nil {
+		return err
+	}
+	if signer != r.Uploader {
+		return errInvalidReceiptSigner
+	}
+	return nil
+}
+
+// ReceiptOptions controls the content added by AddWithReceipt and the signing
+// of its receipt.
+type ReceiptOptions struct {
+	AddOptions
+	Uploader   common.Address `json:"uploader"`   // Keystore account signing the receipt
+	Passphrase string         `json:"passphrase"` // Unlocks the uploader account, which has to be unlocked already if empty
+	Anchor     bool           `json:"anchor"`     // Publish the receipt hash in a transaction to the receipt contract
+}
+
+// signReceipt signs the receipt hash with the wallet holding the uploader.
+func signReceipt(wallet accounts.Wallet, r *Receipt, passphrase string) error {
+	var (
+		account = accounts.Account{Address: r.Uploader}
+		hash    = r.Hash()
+		sig     []byte
+		err     error
+	)
+	if passphrase != "" {
+		sig, err = wallet.SignTextWithPassphrase(account, passphrase, hash[:])
+	} else {
+		sig, err = wallet.SignText(account, hash[:])
+	}
+	if err != nil {
+		return err
+	}
+	r.Signature = sig
+	return nil
+}
+
+// anchorReceipt publishes the receipt hash in a transaction of the uploader
+// to the receipt contract.
+func (s *EthofsService) anchorReceipt(ctx context.Context, wallet accounts.Wallet, r *Receipt, passphrase string) (common.Hash, error) {
+	if s.config.ReceiptContract == "" {
+		return common.Hash{}, errNoReceiptContract
+	}
+	if ethClient == nil {
+		return common.Hash{}, errNoEthClient
+	}
+	parsed, err := abi.JSON(strings.NewReader(ReceiptABI))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, receiptAnchorTimeout)
+	defer cancel()
+
+	chainID, err := ethClient.ChainID(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	contract := bind.NewBoundContract(common.HexToAddress(s.config.ReceiptContract), parsed, ethClient, ethClient, nil)
+	tx, err := contract.Transact(&bind.TransactOpts{
+		From:    r.Uploader,
+		Context: ctx,
+		Signer: func(signer types.Signer, addr common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if passphrase != "" {
+				return wallet.SignTxWithPassphrase(accounts.Account{Address: addr}, passphrase, tx, chainID)
+			}
+			return wallet.SignTx(accounts.Account{Address: addr}, tx, chainID)
+		},
+	}, "anchorReceipt", r.Hash())
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return tx.Hash(), nil
+}
+
+// AddWithReceipt adds the content of r like Add, and returns a receipt of the
+// upload signed by the uploader account, optionally anchored on chain. The
+// content is stored even if signing or anchoring the receipt fails.
+func (s *EthofsService) AddWithReceipt(ctx context.Context, r io.Reader, opts ReceiptOptions) (*Receipt, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	if err := checkSigningClock(); err != nil {
+		return nil, err
+	}
+	wallet, err := s.stack.AccountManager().Find(accounts.Account{Address: opts.Uploader})
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.Add(ctx, r, opts.AddOptions, nil)
+	if err != nil {
+		return nil, err
+	}
+	receipt := &Receipt{
+		Cid:       c.String(),
+		Timestamp: uint64(time.Now().Unix()),
+		Uploader:  opts.Uploader,
+	}
+	err = walkBlocks(ctx, node.Blockstore, c, func(c cid.Cid, key string) bool {
+		size, err := node.Blockstore.GetSize(c)
+		if err == nil {
+			receipt.Size += uint64(size)
+			receipt.Blocks++
+		}
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := signReceipt(wallet, receipt, opts.Passphrase); err != nil {
+		return nil, err
+	}
+	if opts.Anchor {
+		hash, err := s.anchorReceipt(ctx, wallet, receipt, opts.Passphrase)
+		if err != nil {
+			return receipt, err
+		}
+		receipt.Transaction = &hash
+		log.Info("ethoFS - upload receipt anchored", "cid", c, "receipt", receipt.Hash(), "tx", hash)
+	}
+	return receipt, nil
+}
+
+// VerifyReceipt checks that the receipt is signed by its uploader.
+func (api *PublicEthofsAPI) VerifyReceipt(receipt Receipt) (_ bool, err error) {
+	defer trackCall("verifyReceipt", time.Now(), &err)
+
+	if err := receipt.Verify(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AddWithReceipt stores the data as a file and returns a receipt of the upload
+// signed by the uploader account.
+func (api *PrivateEthofsAPI) AddWithReceipt(ctx context.Context, data hexutil.Bytes, opts ReceiptOptions) (_ *Receipt, err error) {
+	defer trackCall("addWithReceipt", time.Now(), &err)
+
+	return api.service.AddWithReceipt(ctx, bytes.NewReader(data), opts)
+}
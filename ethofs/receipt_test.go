@@ -0,0 +1,56 @@
+package ethofs
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestReceiptVerify(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt := &Receipt{
+		Cid:       "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn",
+		Size:      1024,
+		Blocks:    3,
+		Timestamp: 1600000000,
+		Uploader:  crypto.PubkeyToAddress(key.PublicKey),
+	}
+	hash := receipt.Hash()
+	if receipt.Signature, err = crypto.Sign(accounts.TextHash(hash[:]), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := receipt.Verify(); err != nil {
+		t.Fatalf("valid receipt rejected: %v", err)
+	}
+	// Signatures in the personal_sign format are accepted too
+	legacy := *receipt
+	legacy.Signature = append([]byte{}, receipt.Signature...)
+	legacy.Signature[crypto.RecoveryIDOffset] += 27
+	if err := legacy.Verify(); err != nil {
+		t.Fatalf("personal_sign receipt rejected: %v", err)
+	}
+	// Every signed field is covered by the signature
+	tampered := []func(r *Receipt){
+		func(r *Receipt) { r.Cid = "QmPZ9gcCEpqKTo6aq61g2nXGUhM4iCL3ewB6LDXZCtioEB" },
+		func(r *Receipt) { r.Size++ },
+		func(r *Receipt) { r.Blocks++ },
+		func(r *Receipt) { r.Timestamp++ },
+		func(r *Receipt) { r.Uploader[0] ^= 0xff },
+	}
+	for i, tamper := range tampered {
+		r := *receipt
+		tamper(&r)
+		if err := r.Verify(); err != errInvalidReceiptSigner {
+			t.Errorf("tampered receipt %d: have %v, want %v", i, err, errInvalidReceiptSigner)
+		}
+	}
+	unsigned := *receipt
+	unsigned.Signature = nil
+	if err := unsigned.Verify(); err != errInvalidReceiptSigner {
+		t.Errorf("unsigned receipt: have %v, want %v", err, errInvalidReceiptSigner)
+	}
+}
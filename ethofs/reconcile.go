@@ -0,0 +1,358 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/log"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	// defaultReconcileConcurrency is the number of pins changed at once by a
+	// reconciliation.
+	defaultReconcileConcurrency = 8
+
+	// maxReconcileConcurrency caps the pins changed at once, every addition
+	// fetches a DAG of its own.
+	maxReconcileConcurrency = 64
+
+	// contractPinListTimeout bounds the retrieval of a single pin list of the
+	// hosting contract.
+	contractPinListTimeout = 30 * time.Second
+)
+
+// errReplicationPolicy is reported for the changes the replication policy
+// leaves out.
+var errReplicationPolicy = errors.New("replication within target")
+
+// ReconcileOptions controls a pin reconciliation.
+type ReconcileOptions struct {
+	DryRun      bool `json:"dryRun"`      // Only report the changes
+	Concurrency int  `json:"concurrency"` // Pins changed at once
+	Additive    bool `json:"additive"`    // Only pin the missing CIDs, keep the pins outside the set
+	Replication bool `json:"replication"` // Only change pins below or above the replication target, like the contract sync
+}
+
+// ReconcileFailure is a pin change of a reconciliation that failed.
+type ReconcileFailure struct {
+	Cid   string `json:"cid"`
+	Op    string `json:"op"` // "pin" or "unpin"
+	Error string `json:"error"`
+}
+
+// ReconcileReport is the outcome of a pin reconciliation. In dry runs the
+// additions and removals are the changes a reconciliation would make.
+type ReconcileReport struct {
+	DryRun    bool               `json:"dryRun"`
+	Desired   int                `json:"desired"`             // Unique CIDs of the desired set
+	Pinned    int                `json:"pinned"`              // Recursive pins before the reconciliation
+	Additions []string           `json:"additions"`           // Desired CIDs not pinned
+	Removals  []string           `json:"removals"`            // Pins not in the desired set
+	Protected []string           `json:"protected,omitempty"` // Pins not in the desired set kept as ethoFS owns them
+	Skipped   []string           `json:"skipped,omitempty"`   // Changes left out by the replication policy
+	Failed    []ReconcileFailure `json:"failed,omitempty"`
+	Duration  time.Duration      `json:"duration"`
+
+	SkippedLists int `json:"skippedLists,omitempty"` // Contract pin lists not retrieved, removals are left out then
+}
+
+// diffPins returns the CIDs of the desired set missing from the pins and the
+// pins missing from the desired set, both sorted.
+func diffPins(desired, pinned []cid.Cid) (add, remove []cid.Cid, unique int) {
+	want, have := cid.NewSet(), cid.NewSet()
+	for _, c := range pinned {
+		have.Add(c)
+	}
+	for _, c := range desired {
+		if want.Visit(c) && !have.Has(c) {
+			add = append(add, c)
+		}
+	}
+	for _, c := range pinned {
+		if !want.Has(c) {
+			remove = append(remove, c)
+		}
+	}
+	sortCids(add)
+	sortCids(remove)
+	return add, remove, want.Len()
+}
+
+// sortCids sorts the CIDs by their string form.
+func sortCids(cids []cid.Cid) {
+	sort.Slice(cids, func(i, j int) bool { return cids[i].String() < cids[j].String() })
+}
+
+// reconcilePins applies the additions and removals of the report with the
+// given number of workers, recording the changes that failed or that the
+// replication policy left out. Changes not started before the context ends
+// are left out.
+func reconcilePins(ctx context.Context, report *ReconcileReport, workers int, pin, unpin func(hash string) error) {
+	type change struct {
+		hash, op string
+		apply    func(hash string) error
+	}
+	var (
+		jobs = make(chan change)
+		lock sync.Mutex
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				err := job.apply(job.hash)
+				if err == errReplicationPolicy {
+					lock.Lock()
+					report.Skipped = append(report.Skipped, job.hash)
+					lock.Unlock()
+				} else if err != nil {
+					log.Debug("ethoFS - pin reconciliation failure", "op", job.op, "hash", job.hash, "error", err)
+
+					lock.Lock()
+					report.Failed = append(report.Failed, ReconcileFailure{Cid: job.hash, Op: job.op, Error: err.Error()})
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+	// Removals go first, freeing space for the additions
+	var changes []change
+	for _, hash := range report.Removals {
+		changes = append(changes, change{hash, "unpin", unpin})
+	}
+	for _, hash := range report.Additions {
+		changes = append(changes, change{hash, "pin", pin})
+	}
+dispatch:
+	for _, job := range changes {
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Strings(report.Skipped)
+	sort.Slice(report.Failed, func(i, j int) bool { return report.Failed[i].Cid < report.Failed[j].Cid })
+}
+
+// Reconcile diffs the desired set of CIDs against the recursive pins of the
+// node, pinning the missing CIDs and unpinning the pins outside the set. Pins
+// ethoFS owns, e.g. user adds, site manifests or shared folders, are never
+// unpinned. Dry runs only report the changes, without consulting the
+// replication policy.
+func (s *EthofsService) Reconcile(ctx context.Context, desired []cid.Cid, opts ReconcileOptions) (*ReconcileReport, error) {
+	node, ipfs := s.Node(), s.API()
+	if node == nil || ipfs == nil {
+		return nil, errNodeNotRunning
+	}
+	start := time.Now()
+
+	var pinned []cid.Cid
+	err := localPins.each(ctx, func(c cid.Cid, mode pin.Mode) bool {
+		if mode == pin.Recursive {
+			pinned = append(pinned, c)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	add, remove, unique := diffPins(desired, pinned)
+
+	report := &ReconcileReport{
+		DryRun:    opts.DryRun,
+		Desired:   unique,
+		Pinned:    len(pinned),
+		Additions: make([]string, 0, len(add)),
+		Removals:  make([]string, 0, len(remove)),
+	}
+	for _, c := range add {
+		report.Additions = append(report.Additions, c.String())
+	}
+	for _, c := range remove {
+		if opts.Additive {
+			break
+		}
+		owners, err := ownedPins.owners(c)
+		if err != nil {
+			return nil, err
+		}
+		if len(owners) > 0 {
+			report.Protected = append(report.Protected, c.String())
+			continue
+		}
+		report.Removals = append(report.Removals, c.String())
+	}
+	if !opts.DryRun {
+		workers := opts.Concurrency
+		if workers <= 0 {
+			workers = defaultReconcileConcurrency
+		}
+		if workers > maxReconcileConcurrency {
+			workers = maxReconcileConcurrency
+		}
+		// The replication policy pins content lacking providers and unpins
+		// content with plenty of them, like the contract sync does
+		pin := func(hash string) error {
+			if opts.Replication {
+				providers, err := FindProvs(node, hash)
+				if err != nil {
+					return err
+				}
+				if providers >= replicationTarget(hash)/2 {
+					return errReplicationPolicy
+				}
+			}
+			_, err := pinAdd(ipfs, hash)
+			return err
+		}
+		unpin := func(hash string) error {
+			if opts.Replication {
+				providers, err := FindProvs(node, hash)
+				if err != nil {
+					return err
+				}
+				if target := replicationTarget(hash); providers <= target+target/2 {
+					return errReplicationPolicy
+				}
+			}
+			_, err := pinRemove(ipfs, hash)
+			return err
+		}
+		reconcilePins(ctx, report, workers, pin, unpin)
+	}
+	report.Duration = time.Since(start)
+
+	log.Info("ethoFS - pin reconciliation complete", "dryrun", opts.DryRun, "desired", report.Desired, "pinned", report.Pinned,
+		"additions", len(report.Additions), "removals", len(report.Removals), "protected", len(report.Protected),
+		"skipped", len(report.Skipped), "failed", len(report.Failed), "elapsed", report.Duration)
+	return report, ctx.Err()
+}
+
+// ContractPins collects the CIDs of all pin lists of the hosting contract.
+// Lists that can't be retrieved in time are skipped, their number is
+// returned along.
+func (s *EthofsService) ContractPins(ctx context.Context) ([]cid.Cid, int, error) {
+	ipfs := s.API()
+	if ipfs == nil {
+		return nil, 0, errNodeNotRunning
+	}
+	if ethClient == nil {
+		return nil, 0, errNoEthClient
+	}
+	contract, err := NewPinStorage(pinStorageAddress, ethClient)
+	if err != nil {
+		return nil, 0, err
+	}
+	count, err := contract.PinCount(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, 0, err
+	}
+	var (
+		pins    []cid.Cid
+		skipped int
+	)
+	for i := uint32(0); i < count && ctx.Err() == nil; i++ {
+		list, err := contractPinList(ctx, ipfs, contract, i)
+		if err != nil {
+			log.Debug("ethoFS - skipping contract pin list", "number", i, "error", err)
+			skipped++
+			continue
+		}
+		pins = append(pins, list...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	if skipped > 0 {
+		log.Warn("ethoFS - contract pin lists not retrieved", "skipped", skipped, "lists", count)
+	}
+	return pins, skipped, nil
+}
+
+// contractPinList retrieves the CIDs of a pin list of the hosting contract.
+func contractPinList(ctx context.Context, ipfs icore.CoreAPI, contract *PinStorage, number uint32) ([]cid.Cid, error) {
+	ctx, cancel := context.WithTimeout(ctx, contractPinListTimeout)
+	defer cancel()
+
+	list, err := contract.Pins(&bind.CallOpts{Context: ctx}, new(big.Int).SetUint64(uint64(number)))
+	if err != nil {
+		return nil, err
+	}
+	c, err := cid.Decode(list)
+	if err != nil {
+		return nil, err
+	}
+	nd, err := ipfs.Unixfs().Get(ctx, path.IpfsPath(c))
+	if err != nil {
+		return nil, err
+	}
+	file := files.ToFile(nd)
+	if file == nil {
+		nd.Close()
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	var pins []cid.Cid
+	for _, hash := range scanForCids(data) {
+		if c, err := cid.Decode(hash); err == nil {
+			pins = append(pins, c)
+		}
+	}
+	return pins, nil
+}
+
+// Reconcile brings the pins of the node in line with the given CIDs, or with
+// the pin lists of the hosting contract under its replication policy if none
+// are given.
+func (api *PrivateEthofsAPI) Reconcile(ctx context.Context, hashes []string, opts *ReconcileOptions) (_ *ReconcileReport, err error) {
+	defer trackCall("reconcile", time.Now(), &err)
+
+	if opts == nil {
+		opts = new(ReconcileOptions)
+	}
+	var (
+		desired []cid.Cid
+		skipped int
+	)
+	if len(hashes) == 0 {
+		if desired, skipped, err = api.service.ContractPins(ctx); err != nil {
+			return nil, err
+		}
+		// Pins of skipped lists are missing from the set, keep all
+		opts.Replication, opts.Additive = true, opts.Additive || skipped > 0
+	}
+	for _, hash := range hashes {
+		c, err := cid.Decode(hash)
+		if err != nil {
+			return nil, err
+		}
+		desired = append(desired, c)
+	}
+	report, err := api.service.Reconcile(ctx, desired, *opts)
+	if report != nil {
+		report.SkippedLists = skipped
+	}
+	return report, err
+}
@@ -0,0 +1,140 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func TestReconcilePins(t *testing.T) {
+	var cids []cid.Cid
+	for i := 0; i < 5; i++ {
+		cids = append(cids, merkledag.NodeWithData([]byte{byte(i)}).Cid())
+	}
+	// The desired set repeats a CID and shares two with the pins
+	desired := []cid.Cid{cids[0], cids[1], cids[2], cids[0]}
+	pinned := []cid.Cid{cids[1], cids[2], cids[3], cids[4]}
+
+	add, remove, unique := diffPins(desired, pinned)
+	if unique != 3 {
+		t.Errorf("desired set size mismatch: have %d, want 3", unique)
+	}
+	if want := []cid.Cid{cids[0]}; !reflect.DeepEqual(add, want) {
+		t.Errorf("additions mismatch: have %v, want %v", add, want)
+	}
+	wantRemove := []cid.Cid{cids[3], cids[4]}
+	sortCids(wantRemove)
+	if !reflect.DeepEqual(remove, wantRemove) {
+		t.Errorf("removals mismatch: have %v, want %v", remove, wantRemove)
+	}
+
+	report := &ReconcileReport{
+		Additions: []string{cids[0].String()},
+		Removals:  []string{wantRemove[0].String(), wantRemove[1].String()},
+	}
+	var (
+		lock    sync.Mutex
+		applied = make(map[string]string)
+	)
+	record := func(op string, fail string) func(string) error {
+		return func(hash string) error {
+			lock.Lock()
+			defer lock.Unlock()
+
+			applied[hash] = op
+			if hash == fail {
+				return errors.New("failed")
+			}
+			return nil
+		}
+	}
+	reconcilePins(context.Background(), report, 2, record("pin", ""), record("unpin", wantRemove[1].String()))
+
+	want := map[string]string{cids[0].String(): "pin", wantRemove[0].String(): "unpin", wantRemove[1].String(): "unpin"}
+	if !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied changes mismatch: have %v, want %v", applied, want)
+	}
+	if len(report.Failed) != 1 || report.Failed[0].Cid != wantRemove[1].String() || report.Failed[0].Op != "unpin" {
+		t.Errorf("failures mismatch: have %+v", report.Failed)
+	}
+	// Cancelled reconciliations start no further changes
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	applied = make(map[string]string)
+	reconcilePins(ctx, &ReconcileReport{Additions: report.Additions}, 1, record("pin", ""), nil)
+	if len(applied) > 1 {
+		t.Errorf("cancelled reconciliation applied %d changes", len(applied))
+	}
+}
+
+func TestReconcileSkipped(t *testing.T) {
+	report := &ReconcileReport{Additions: []string{"b", "a"}}
+	skip := func(string) error { return errReplicationPolicy }
+	reconcilePins(context.Background(), report, 2, skip, nil)
+
+	if !reflect.DeepEqual(report.Skipped, []string{"a", "b"}) || len(report.Failed) != 0 {
+		t.Errorf("skipped changes mismatch: skipped %v, failed %+v", report.Skipped, report.Failed)
+	}
+}
+
+func TestReconcileProtectsOwned(t *testing.T) {
+	s, stop := newTestService(t)
+	defer stop()
+
+	ctx := context.Background()
+	ds := s.Node().Repo.Datastore()
+	if err := localPins.attach(ctx, ds, s.Node().Pinning); err != nil {
+		t.Fatal(err)
+	}
+	defer localPins.detach()
+	s.Node().Pinning = &indexingPinner{Pinner: s.Node().Pinning, index: localPins}
+	ownedPins.attach(ds)
+	defer ownedPins.detach()
+
+	var (
+		added    = merkledag.NewRawNode([]byte("user add"))
+		contract = merkledag.NewRawNode([]byte("contract pin"))
+	)
+	for _, nd := range []*merkledag.RawNode{added, contract} {
+		if err := s.Node().DAG.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Node().Pinning.Pin(ctx, nd, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Node().Pinning.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ownPin(added.Cid(), pinOwnerAdd)
+
+	report, err := s.Reconcile(ctx, nil, ReconcileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Removals, []string{contract.Cid().String()}) || !reflect.DeepEqual(report.Protected, []string{added.Cid().String()}) {
+		t.Errorf("report mismatch: removals %v, protected %v", report.Removals, report.Protected)
+	}
+	if _, pinned, _ := s.Node().Pinning.IsPinned(ctx, added.Cid()); !pinned {
+		t.Error("owned pin removed")
+	}
+	if _, pinned, _ := s.Node().Pinning.IsPinned(ctx, contract.Cid()); pinned {
+		t.Error("pin outside the set kept")
+	}
+	// Removed pins lose their owners, additive runs keep all pins
+	if owners, _ := ownedPins.owners(contract.Cid()); len(owners) != 0 {
+		t.Errorf("removed pin still owned by %v", owners)
+	}
+	report, err = s.Reconcile(ctx, nil, ReconcileOptions{Additive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Removals) != 0 || len(report.Protected) != 0 {
+		t.Errorf("additive run removes pins: %+v", report)
+	}
+}
@@ -0,0 +1,185 @@
+package ethofs
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	icore "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/libp2p/go-libp2p-core/peer"
+	peerstore "github.com/libp2p/go-libp2p-peerstore"
+)
+
+const (
+	defaultMinPeers          = 3
+	defaultReconnectInterval = 30 * time.Second
+
+	// maxReconnectBackoff caps the delay between dials of an unreachable
+	// bootstrap peer.
+	maxReconnectBackoff = 10 * time.Minute
+
+	reconnectDialTimeout = 30 * time.Second
+)
+
+var (
+	swarmPeersGauge     = metrics.NewRegisteredGauge("ethofs/swarm/peers", nil)
+	bootstrapPeersGauge = metrics.NewRegisteredGauge("ethofs/swarm/bootstrap", nil)
+	rebootstrapMeter    = metrics.NewRegisteredMeter("ethofs/swarm/rebootstrap", nil)
+)
+
+// peerBackoff tracks the failed dials of a bootstrap peer.
+type peerBackoff struct {
+	failures int
+	next     time.Time
+}
+
+// failed records a failed dial, doubling the retry delay up to the maximum.
+func (b *peerBackoff) failed(now time.Time, base time.Duration) {
+	delay := base
+	for i := 0; i < b.failures && delay < maxReconnectBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxReconnectBackoff {
+		delay = maxReconnectBackoff
+	}
+	b.failures++
+	b.next = now.Add(delay)
+}
+
+// reconnectManager keeps the node connected to the swarm. It redials
+// unreachable bootstrap peers with exponential backoff and re-bootstraps
+// ignoring the backoff whenever the peer count drops below the threshold.
+type reconnectManager struct {
+	ipfs      icore.CoreAPI
+	bootstrap map[peer.ID]*peerstore.PeerInfo
+	minPeers  int
+	interval  time.Duration
+
+	backoff  map[peer.ID]*peerBackoff
+	updates  chan map[peer.ID]*peerstore.PeerInfo
+	mismatch bool // swarm key mismatch reported already
+}
+
+func newReconnectManager(ipfs icore.CoreAPI, cfg *Config) (*reconnectManager, error) {
+	bootstrap, err := parsePeerAddrs(cfg.bootstrapNodes())
+	if err != nil {
+		return nil, err
+	}
+	m := &reconnectManager{
+		ipfs:      ipfs,
+		bootstrap: bootstrap,
+		minPeers:  cfg.MinPeers,
+		interval:  cfg.ReconnectInterval,
+		backoff:   make(map[peer.ID]*peerBackoff),
+		updates:   make(chan map[peer.ID]*peerstore.PeerInfo),
+	}
+	if m.minPeers == 0 {
+		m.minPeers = defaultMinPeers
+	}
+	if m.interval == 0 {
+		m.interval = defaultReconnectInterval
+	}
+	return m, nil
+}
+
+// loop checks the swarm health every interval until the context is cancelled.
+func (m *reconnectManager) loop(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.check(ctx, time.Now())
+		case bootstrap := <-m.updates:
+			for id := range m.backoff {
+				if _, ok := bootstrap[id]; !ok {
+					delete(m.backoff, id)
+				}
+			}
+			m.bootstrap = bootstrap
+			m.check(ctx, time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// setBootstrap replaces the bootstrap set, dialing newly added peers right
+// away.
+func (m *reconnectManager) setBootstrap(ctx context.Context, peers []string) error {
+	bootstrap, err := parsePeerAddrs(peers)
+	if err != nil {
+		return err
+	}
+	select {
+	case m.updates <- bootstrap:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// check dials the disconnected bootstrap peers that are due.
+func (m *reconnectManager) check(ctx context.Context, now time.Time) {
+	conns, err := m.ipfs.Swarm().Peers(ctx)
+	if err != nil {
+		log.Debug("ethoFS - unable to list swarm peers", "error", err)
+		return
+	}
+	connected := make(map[peer.ID]bool, len(conns))
+	for _, c := range conns {
+		connected[c.ID()] = true
+	}
+	var bootstrapConnected int
+	for id := range m.bootstrap {
+		if connected[id] {
+			bootstrapConnected++
+			delete(m.backoff, id)
+		}
+	}
+	swarmPeersGauge.Update(int64(len(conns)))
+	bootstrapPeersGauge.Update(int64(bootstrapConnected))
+
+	rebootstrap := len(conns) < m.minPeers
+	if rebootstrap {
+		log.Warn("ethoFS - swarm peer count below threshold, re-bootstrapping", "peers", len(conns), "min", m.minPeers)
+		rebootstrapMeter.Mark(1)
+	}
+	for id, info := range m.bootstrap {
+		if connected[id] {
+			continue
+		}
+		b, ok := m.backoff[id]
+		if !ok {
+			b = new(peerBackoff)
+			m.backoff[id] = b
+		}
+		if !rebootstrap && now.Before(b.next) {
+			continue
+		}
+		dialCtx, cancel := context.WithTimeout(ctx, reconnectDialTimeout)
+		err := m.ipfs.Swarm().Connect(dialCtx, *info)
+		cancel()
+
+		dialFailures.record("reconnect", id, err)
+		if err != nil {
+			b.failed(now, m.interval)
+			log.Debug("ethoFS - bootstrap peer reconnection failed", "node", id, "failures", b.failures, "retry", b.next, "error", err)
+			continue
+		}
+		delete(m.backoff, id)
+		log.Info("ethoFS - bootstrap peer reconnected", "node", id)
+	}
+	// Report a swarm key mismatch once instead of retrying silently
+	if err := dialFailures.swarmKeyMismatch(len(conns)); err != nil {
+		if !m.mismatch {
+			log.Error("ethoFS - all reachable peers reject the handshake, is the repo initialized for another network?", "error", err)
+		}
+		m.mismatch = true
+	} else {
+		m.mismatch = false
+	}
+}
@@ -0,0 +1,24 @@
+package ethofs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeerBackoff(t *testing.T) {
+	var (
+		b    peerBackoff
+		now  = time.Unix(0, 0)
+		base = 30 * time.Second
+	)
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, maxReconnectBackoff, maxReconnectBackoff}
+	for i, delay := range want {
+		b.failed(now, base)
+		if have := b.next.Sub(now); have != delay {
+			t.Errorf("failure %d: delay mismatch: have %v, want %v", i+1, have, delay)
+		}
+	}
+	if b.failures != len(want) {
+		t.Errorf("failure count mismatch: have %d, want %d", b.failures, len(want))
+	}
+}
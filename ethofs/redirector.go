@@ -0,0 +1,250 @@
+package ethofs
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rpc"
+	lru "github.com/hashicorp/golang-lru"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	// defaultRedirectWindow is the time over which the redirects sent to a
+	// gateway decay.
+	defaultRedirectWindow = time.Minute
+
+	// redirectLookupTimeout bounds the search for gateways providing the
+	// requested content.
+	redirectLookupTimeout = 5 * time.Second
+
+	// redirectProvidersTTL is how long the gateways found in the DHT for a CID
+	// are reused before searching again.
+	redirectProvidersTTL = time.Minute
+
+	// maxRedirectProviderRoots bounds the CIDs with cached DHT results.
+	maxRedirectProviderRoots = 1024
+)
+
+var (
+	redirectSentMeter   = metrics.NewRegisteredMeter("ethofs/redirector/sent", nil)
+	redirectMissedMeter = metrics.NewRegisteredMeter("ethofs/redirector/missed", nil)
+)
+
+// parseRedirectGateway parses a gateway of the redirector, given as
+// <peer ID>=<base URL>.
+func parseRedirectGateway(spec string) (peer.ID, *url.URL, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 {
+		return "", nil, fmt.Errorf("gateway %q not in <peer ID>=<URL> format", spec)
+	}
+	id, err := peer.Decode(parts[0])
+	if err != nil {
+		return "", nil, err
+	}
+	base, err := url.Parse(parts[1])
+	if err != nil {
+		return "", nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return "", nil, fmt.Errorf("gateway URL %q is not an absolute HTTP URL", parts[1])
+	}
+	return id, base, nil
+}
+
+// gatewayLoad estimates the load of a gateway by the redirects sent to it,
+// decaying exponentially over the window.
+type gatewayLoad struct {
+	base    *url.URL
+	load    float64
+	updated time.Time
+}
+
+// current returns the decayed load at the given time.
+func (g *gatewayLoad) current(now time.Time, window time.Duration) float64 {
+	return g.load * math.Exp(-float64(now.Sub(g.updated))/float64(window))
+}
+
+// redirector sends content requests to the least loaded known gateway that
+// provides the content.
+type redirector struct {
+	node   *core.IpfsNode
+	window time.Duration
+	server *http.Server
+
+	lock     sync.Mutex
+	gateways map[peer.ID]*gatewayLoad
+
+	found *lru.Cache // cid -> *redirectProviders, gateways found in the DHT
+}
+
+// redirectProviders are the gateways found in the DHT providing a CID.
+type redirectProviders struct {
+	gateways map[peer.ID]struct{}
+	expires  time.Time
+}
+
+func newRedirector(node *core.IpfsNode, cfg *RedirectorConfig) (*redirector, error) {
+	found, err := lru.New(maxRedirectProviderRoots)
+	if err != nil {
+		return nil, err
+	}
+	r := &redirector{
+		node:     node,
+		window:   cfg.Window,
+		gateways: make(map[peer.ID]*gatewayLoad, len(cfg.Gateways)),
+		found:    found,
+	}
+	if r.window == 0 {
+		r.window = defaultRedirectWindow
+	}
+	for _, spec := range cfg.Gateways {
+		id, base, err := parseRedirectGateway(spec)
+		if err != nil {
+			return nil, err
+		}
+		r.gateways[id] = &gatewayLoad{base: base}
+	}
+	return r, nil
+}
+
+// providers returns the known gateways providing the CID, as registered in the
+// provider registry or announced in the DHT. DHT results are cached for a
+// while, so repeated requests for the same content don't search again.
+func (r *redirector) providers(ctx context.Context, c cid.Cid) map[peer.ID]struct{} {
+	found := make(map[peer.ID]struct{})
+	if hints := currentProviderHints(); hints != nil {
+		for _, info := range hints.lookup(ctx, c) {
+			if _, ok := r.gateways[info.ID]; ok {
+				found[info.ID] = struct{}{}
+			}
+		}
+	}
+	if len(found) == len(r.gateways) || r.node.Routing == nil {
+		return found
+	}
+	for id := range r.searchProviders(ctx, c) {
+		found[id] = struct{}{}
+	}
+	return found
+}
+
+// searchProviders returns the known gateways announcing the CID in the DHT,
+// searching only if no recent result is cached.
+func (r *redirector) searchProviders(ctx context.Context, c cid.Cid) map[peer.ID]struct{} {
+	if cached, ok := r.found.Get(c); ok {
+		if res := cached.(*redirectProviders); time.Now().Before(res.expires) {
+			return res.gateways
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, redirectLookupTimeout)
+	defer cancel()
+
+	found := make(map[peer.ID]struct{})
+	for info := range r.node.Routing.FindProvidersAsync(ctx, c, 0) {
+		if _, ok := r.gateways[info.ID]; ok {
+			found[info.ID] = struct{}{}
+			if len(found) == len(r.gateways) {
+				break
+			}
+		}
+	}
+	// Searches aborted by the client found nothing conclusive, don't cache
+	if len(found) > 0 || ctx.Err() != context.Canceled {
+		r.found.Add(c, &redirectProviders{gateways: found, expires: time.Now().Add(redirectProvidersTTL)})
+	}
+	return found
+}
+
+// pick selects the least loaded of the providing gateways, preferring lower
+// latency on equal load, and accounts the redirect to it.
+func (r *redirector) pick(providers map[peer.ID]struct{}) *url.URL {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var (
+		now  = time.Now()
+		best peer.ID
+		min  = math.Inf(1)
+	)
+	for id := range providers {
+		load := r.gateways[id].current(now, r.window)
+		if load < min || load == min && r.node.Peerstore.LatencyEWMA(id) < r.node.Peerstore.LatencyEWMA(best) {
+			best, min = id, load
+		}
+	}
+	if best == "" {
+		return nil
+	}
+	gw := r.gateways[best]
+	gw.load, gw.updated = min+1, now
+	return gw.base
+}
+
+// ServeHTTP redirects requests for /ipfs/<cid>/<path> or /<cid>/<path> to the
+// same path on the chosen gateway.
+func (r *redirector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p := req.URL.Path
+	if !strings.HasPrefix(p, "/ipfs/") {
+		p = "/ipfs" + p
+	}
+	c := contentRoot(p)
+	if !c.Defined() {
+		http.Error(w, "invalid content path", http.StatusBadRequest)
+		return
+	}
+	base := r.pick(r.providers(req.Context(), c))
+	if base == nil {
+		redirectMissedMeter.Mark(1)
+		http.Error(w, "no gateway provides the content", http.StatusNotFound)
+		return
+	}
+	redirectSentMeter.Mark(1)
+
+	target := *base
+	target.Path = strings.TrimSuffix(base.Path, "/") + p
+	target.RawQuery = req.URL.RawQuery
+	http.Redirect(w, req, target.String(), http.StatusFound)
+}
+
+// start opens the endpoint of the redirector.
+func (r *redirector) start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	r.server = &http.Server{
+		Handler:      r,
+		ReadTimeout:  rpc.DefaultHTTPTimeouts.ReadTimeout,
+		WriteTimeout: rpc.DefaultHTTPTimeouts.WriteTimeout,
+		IdleTimeout:  rpc.DefaultHTTPTimeouts.IdleTimeout,
+	}
+	go r.server.Serve(listener)
+
+	log.Info("ethoFS - redirector opened", "url", fmt.Sprintf("http://%v/", listener.Addr()), "gateways", len(r.gateways))
+	return nil
+}
+
+// stop closes the endpoint of the redirector.
+func (r *redirector) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r.server.Shutdown(ctx)
+}
@@ -0,0 +1,113 @@
+package ethofs
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
+	merkledag "github.com/ipfs/go-merkledag"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+	"github.com/libp2p/go-libp2p-peerstore/pstoremem"
+)
+
+func TestParseRedirectGateway(t *testing.T) {
+	const id = "QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC"
+
+	if _, base, err := parseRedirectGateway(id + "=https://gw.example.org/base"); err != nil {
+		t.Errorf("valid gateway rejected: %v", err)
+	} else if base.String() != "https://gw.example.org/base" {
+		t.Errorf("gateway URL mismatch: have %v", base)
+	}
+	for _, spec := range []string{
+		"https://gw.example.org",
+		"invalid=https://gw.example.org",
+		id + "=gw.example.org",
+		id + "=ftp://gw.example.org",
+	} {
+		if _, _, err := parseRedirectGateway(spec); err == nil {
+			t.Errorf("invalid gateway %q accepted", spec)
+		}
+	}
+}
+
+func TestRedirectorPick(t *testing.T) {
+	ids := []peer.ID{"gw-a", "gw-b", "gw-c"}
+	r, err := newRedirector(&core.IpfsNode{Peerstore: pstoremem.NewPeerstore()}, &RedirectorConfig{Window: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		r.gateways[id] = &gatewayLoad{base: &url.URL{Scheme: "https", Host: string(id) + ".example.org"}}
+	}
+	// The latency breaks the tie of the unloaded gateways
+	r.node.Peerstore.RecordLatency(ids[0], 300*time.Millisecond)
+	r.node.Peerstore.RecordLatency(ids[1], 100*time.Millisecond)
+	r.node.Peerstore.RecordLatency(ids[2], 200*time.Millisecond)
+
+	all := map[peer.ID]struct{}{ids[0]: {}, ids[1]: {}, ids[2]: {}}
+	var picked []string
+	for i := 0; i < 6; i++ {
+		picked = append(picked, r.pick(all).Host)
+	}
+	want := []string{"gw-b.example.org", "gw-c.example.org", "gw-a.example.org", "gw-b.example.org", "gw-c.example.org", "gw-a.example.org"}
+	for i := range want {
+		if picked[i] != want[i] {
+			t.Fatalf("redirect %d: have %s, want %s (all %v)", i, picked[i], want[i], picked)
+		}
+	}
+	// Only providing gateways are picked
+	if base := r.pick(map[peer.ID]struct{}{ids[0]: {}}); base.Host != "gw-a.example.org" {
+		t.Errorf("non-providing gateway picked: %v", base)
+	}
+	if base := r.pick(nil); base != nil {
+		t.Errorf("gateway picked without providers: %v", base)
+	}
+}
+
+// countingRouting announces a fixed provider for every CID and counts the
+// searches.
+type countingRouting struct {
+	routing.Routing
+	provider peer.ID
+	searches int
+}
+
+func (r *countingRouting) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	r.searches++
+
+	ch := make(chan peer.AddrInfo, 1)
+	ch <- peer.AddrInfo{ID: r.provider}
+	close(ch)
+	return ch
+}
+
+func TestRedirectorProviderCache(t *testing.T) {
+	router := &countingRouting{provider: "gw-a"}
+	r, err := newRedirector(&core.IpfsNode{Routing: router}, &RedirectorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.gateways["gw-a"] = &gatewayLoad{}
+	r.gateways["gw-b"] = &gatewayLoad{}
+
+	c := merkledag.NewRawNode([]byte("redirected")).Cid()
+	for i := 0; i < 3; i++ {
+		if found := r.providers(context.Background(), c); len(found) != 1 {
+			t.Fatalf("lookup %d: providers mismatch: %v", i, found)
+		}
+	}
+	if router.searches != 1 {
+		t.Errorf("DHT searches mismatch: have %d, want 1", router.searches)
+	}
+	// Expired results are searched again
+	cached, _ := r.found.Get(c)
+	cached.(*redirectProviders).expires = time.Now().Add(-time.Second)
+	r.providers(context.Background(), c)
+	if router.searches != 2 {
+		t.Errorf("DHT searches after expiry mismatch: have %d, want 2", router.searches)
+	}
+}
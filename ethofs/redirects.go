@@ -0,0 +1,250 @@
+package ethofs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	redirectsFile = "_redirects"
+	notFoundFile  = "404.html"
+	indexFile     = "index.html"
+
+	maxRedirectRules = 1000
+)
+
+// redirectRule is a single line of a site's _redirects file, e.g.
+//
+//	/old/*   /new/:splat   301
+//	/*       /index.html   200
+type redirectRule struct {
+	from   string
+	to     string
+	status int
+}
+
+// match checks whether the rule applies to the site relative path and returns
+// the target with any splat placeholder substituted.
+func (rule redirectRule) match(p string) (string, bool) {
+	if strings.HasSuffix(rule.from, "*") {
+		prefix := strings.TrimSuffix(rule.from, "*")
+		if !strings.HasPrefix(p, prefix) {
+			return "", false
+		}
+		return strings.Replace(rule.to, ":splat", strings.TrimPrefix(p, prefix), -1), true
+	}
+	if p != rule.from && strings.TrimSuffix(p, "/") != rule.from {
+		return "", false
+	}
+	return rule.to, true
+}
+
+// parseRedirects reads the rules of a _redirects file. Each non-comment line
+// consists of a source path, a target and an optional status code (default
+// 301).
+func parseRedirects(r io.Reader) ([]redirectRule, error) {
+	var rules []redirectRule
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: invalid redirect rule", line)
+		}
+		rule := redirectRule{from: fields[0], to: fields[1], status: http.StatusMovedPermanently}
+		if len(fields) == 3 {
+			status, err := strconv.Atoi(strings.TrimSuffix(fields[2], "!"))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid status %q", line, fields[2])
+			}
+			switch status {
+			case http.StatusOK, http.StatusNotFound, http.StatusMovedPermanently, http.StatusFound,
+				http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			default:
+				return nil, fmt.Errorf("line %d: unsupported status %d", line, status)
+			}
+			rule.status = status
+		}
+		if !strings.HasPrefix(rule.from, "/") {
+			return nil, fmt.Errorf("line %d: source must be an absolute path", line)
+		}
+		rules = append(rules, rule)
+		if len(rules) > maxRedirectRules {
+			return nil, fmt.Errorf("too many redirect rules (max %d)", maxRedirectRules)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// splitContentPath splits a gateway path like /ipfs/<root>/a/b into its
+// namespace, root and site relative remainder.
+func splitContentPath(p string) (string, string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(p, "/"), "/", 3)
+	if len(parts) < 2 || (parts[0] != "ipfs" && parts[0] != "ipns") || parts[1] == "" {
+		return "", "", ""
+	}
+	rest := "/"
+	if len(parts) == 3 {
+		rest += parts[2]
+	}
+	return "/" + parts[0], parts[1], rest
+}
+
+// siteRouter applies _redirects rules, custom 404 pages and SPA fallbacks to
+// gateway requests for paths that do not exist in a hosted site.
+type siteRouter struct {
+	api      icore.CoreAPI
+	spaRoots map[string]bool
+
+	lock  sync.Mutex
+	rules map[string][]redirectRule // resolved site root CID -> rules
+}
+
+// siteRoutingOption wraps the gateway handlers registered after it with the
+// site router.
+func siteRoutingOption(spaRoots []string) corehttp.ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		api, err := coreapi.NewCoreAPI(n)
+		if err != nil {
+			return nil, err
+		}
+		router := &siteRouter{
+			api:      api,
+			spaRoots: make(map[string]bool),
+			rules:    make(map[string][]redirectRule),
+		}
+		for _, root := range spaRoots {
+			router.spaRoots[strings.Trim(root, "/")] = true
+		}
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			router.serveHTTP(w, r, childMux)
+		})
+		return childMux, nil
+	}
+}
+
+func (s *siteRouter) serveHTTP(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		next.ServeHTTP(w, r)
+		return
+	}
+	ns, root, rest := splitContentPath(r.URL.Path)
+	if root == "" {
+		next.ServeHTTP(w, r)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	if _, err := s.api.ResolvePath(ctx, path.New(r.URL.Path)); err == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+	sitePath := ns + "/" + root
+	for _, rule := range s.siteRules(ctx, sitePath) {
+		target, ok := rule.match(rest)
+		if !ok {
+			continue
+		}
+		switch rule.status {
+		case http.StatusOK:
+			r.URL.Path = sitePath + target
+			next.ServeHTTP(w, r)
+		case http.StatusNotFound:
+			if !s.serveFile(ctx, w, r, sitePath+target, http.StatusNotFound) {
+				next.ServeHTTP(w, r)
+			}
+		default:
+			if strings.HasPrefix(target, "/") {
+				target = sitePath + target
+			}
+			http.Redirect(w, r, target, rule.status)
+		}
+		return
+	}
+	if s.spaRoots[root] || s.spaRoots[ns+"/"+root] {
+		r.URL.Path = sitePath + "/" + indexFile
+		next.ServeHTTP(w, r)
+		return
+	}
+	if s.serveFile(ctx, w, r, sitePath+"/"+notFoundFile, http.StatusNotFound) {
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// siteRules returns the parsed _redirects rules of a site, caching them by
+// the resolved root CID.
+func (s *siteRouter) siteRules(ctx context.Context, sitePath string) []redirectRule {
+	resolved, err := s.api.ResolvePath(ctx, path.New(sitePath))
+	if err != nil {
+		return nil
+	}
+	key := resolved.Cid().String()
+
+	s.lock.Lock()
+	rules, ok := s.rules[key]
+	s.lock.Unlock()
+	if ok {
+		return rules
+	}
+	nd, err := s.api.Unixfs().Get(ctx, path.Join(resolved, redirectsFile))
+	if err == nil {
+		if file := files.ToFile(nd); file != nil {
+			rules, err = parseRedirects(io.LimitReader(file, 64*KB))
+			if err != nil {
+				log.Debug("ethoFS - invalid site redirects", "root", key, "error", err)
+				rules = nil
+			}
+			file.Close()
+		}
+	}
+	s.lock.Lock()
+	s.rules[key] = rules
+	s.lock.Unlock()
+
+	return rules
+}
+
+// serveFile writes the file at the given content path with the given status
+// code, reporting whether the file could be served.
+func (s *siteRouter) serveFile(ctx context.Context, w http.ResponseWriter, r *http.Request, p string, status int) bool {
+	nd, err := s.api.Unixfs().Get(ctx, path.New(p))
+	if err != nil {
+		return false
+	}
+	file := files.ToFile(nd)
+	if file == nil {
+		return false
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		io.Copy(w, file)
+	}
+	return true
+}
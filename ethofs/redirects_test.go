@@ -0,0 +1,78 @@
+package ethofs
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseRedirects(t *testing.T) {
+	input := `
+# comment
+/old        /new          302
+/blog/*     /posts/:splat
+/*          /index.html   200
+`
+	rules, err := parseRedirects(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("failed to parse rules: %v", err)
+	}
+	want := []redirectRule{
+		{"/old", "/new", http.StatusFound},
+		{"/blog/*", "/posts/:splat", http.StatusMovedPermanently},
+		{"/*", "/index.html", http.StatusOK},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("rule count mismatch: have %d, want %d", len(rules), len(want))
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d mismatch: have %+v, want %+v", i, rules[i], want[i])
+		}
+	}
+	for _, invalid := range []string{"/a", "relative /b", "/a /b 999", "/a /b c d"} {
+		if _, err := parseRedirects(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestRedirectRuleMatch(t *testing.T) {
+	tests := []struct {
+		rule   redirectRule
+		path   string
+		target string
+		ok     bool
+	}{
+		{redirectRule{"/old", "/new", 301}, "/old", "/new", true},
+		{redirectRule{"/old", "/new", 301}, "/old/", "/new", true},
+		{redirectRule{"/old", "/new", 301}, "/older", "", false},
+		{redirectRule{"/blog/*", "/posts/:splat", 301}, "/blog/2020/hello", "/posts/2020/hello", true},
+		{redirectRule{"/blog/*", "/posts/:splat", 301}, "/about", "", false},
+		{redirectRule{"/*", "/index.html", 200}, "/any/route", "/index.html", true},
+	}
+	for i, tt := range tests {
+		target, ok := tt.rule.match(tt.path)
+		if ok != tt.ok || target != tt.target {
+			t.Errorf("test %d: have (%q, %v), want (%q, %v)", i, target, ok, tt.target, tt.ok)
+		}
+	}
+}
+
+func TestSplitContentPath(t *testing.T) {
+	tests := []struct {
+		path, ns, root, rest string
+	}{
+		{"/ipfs/QmRoot", "/ipfs", "QmRoot", "/"},
+		{"/ipfs/QmRoot/a/b", "/ipfs", "QmRoot", "/a/b"},
+		{"/ipns/example.com/x", "/ipns", "example.com", "/x"},
+		{"/api/v0/cat", "", "", ""},
+		{"/ipfs/", "", "", ""},
+	}
+	for _, tt := range tests {
+		ns, root, rest := splitContentPath(tt.path)
+		if ns != tt.ns || root != tt.root || rest != tt.rest {
+			t.Errorf("%s: have (%q, %q, %q), want (%q, %q, %q)", tt.path, ns, root, rest, tt.ns, tt.root, tt.rest)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package ethofs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	datastore "github.com/ipfs/go-datastore"
+	flatfs "github.com/ipfs/go-ds-flatfs"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// blocksPrefix is the namespace of the blocks in the repo datastore.
+var blocksPrefix = datastore.NewKey(blocksMountpoint)
+
+var replicaHitMeter = metrics.NewRegisteredMeter("ethofs/replica/hit", nil)
+
+// blockReplica is a read-only flatfs block directory of another node, e.g. an
+// NFS share of its repo's blocks directory. It never writes to the directory,
+// not even the disk usage cache flatfs itself maintains.
+type blockReplica struct {
+	path  string
+	shard flatfs.ShardFunc
+}
+
+func openBlockReplica(path string) (*blockReplica, error) {
+	id, err := flatfs.ReadShardFunc(path)
+	if err != nil {
+		return nil, fmt.Errorf("block replica %s: %v", path, err)
+	}
+	return &blockReplica{path: path, shard: id.Func()}, nil
+}
+
+// file returns the path of the block stored under the flatfs key.
+func (r *blockReplica) file(key datastore.Key) (string, bool) {
+	name := key.String()[1:]
+	if name == "" || strings.ContainsAny(name, `/\.`) {
+		return "", false
+	}
+	return filepath.Join(r.path, r.shard(name), name+".data"), true
+}
+
+func (r *blockReplica) get(key datastore.Key) ([]byte, error) {
+	file, ok := r.file(key)
+	if !ok {
+		return nil, datastore.ErrNotFound
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, datastore.ErrNotFound
+	}
+	return data, err
+}
+
+// replicaDatastore serves the blocks missing from the repo datastore from
+// the read-only replicas, before the blockservice falls back to a network
+// fetch. Only reads consult the replicas: Has, GetSize, writes, deletes and
+// queries answer from the repo datastore alone, so replica blocks are neither
+// counted against the quota, garbage collected nor served to the swarm as
+// blocks the node stores.
+// Unless verify is set, replica blocks are hashed only if the blockstore
+// hashes all reads.
+type replicaDatastore struct {
+	repo.Datastore
+	replicas []*blockReplica
+	verify   bool
+}
+
+// replicaKey returns the flatfs key of a block key of the repo datastore.
+func replicaKey(key datastore.Key) (datastore.Key, bool) {
+	if !key.IsDescendantOf(blocksPrefix) {
+		return datastore.Key{}, false
+	}
+	return datastore.RawKey(strings.TrimPrefix(key.String(), blocksPrefix.String())), true
+}
+
+func (d *replicaDatastore) Get(key datastore.Key) ([]byte, error) {
+	data, err := d.Datastore.Get(key)
+	if err != datastore.ErrNotFound {
+		return data, err
+	}
+	rkey, ok := replicaKey(key)
+	if !ok {
+		return nil, err
+	}
+	for _, r := range d.replicas {
+		data, rerr := r.get(rkey)
+		if rerr == nil && d.verify && !validReplicaBlock(rkey, data) {
+			// Leave the block to the swarm, bitswap checks what it receives
+			continue
+		}
+		if rerr == nil {
+			replicaHitMeter.Mark(1)
+			return data, nil
+		}
+		if rerr != datastore.ErrNotFound {
+			log.Debug("ethoFS - block replica read failed", "replica", r.path, "key", key, "error", rerr)
+		}
+	}
+	return nil, err
+}
+
+// replicaRepo hands the node a datastore consulting the block replicas.
+type replicaRepo struct {
+	repo.Repo
+	ds *replicaDatastore
+}
+
+func (r *replicaRepo) Datastore() repo.Datastore {
+	return r.ds
+}
+
+// withBlockReplicas wraps the repo to serve blocks from the read-only
+// replicas at the given paths, checking the hashes of the replica blocks if
+// verify is set. The repo is returned as is if there are no replicas.
+func withBlockReplicas(r repo.Repo, paths []string, verify bool) (repo.Repo, error) {
+	if len(paths) == 0 {
+		return r, nil
+	}
+	ds := &replicaDatastore{Datastore: r.Datastore(), verify: verify}
+	for _, path := range paths {
+		replica, err := openBlockReplica(path)
+		if err != nil {
+			return nil, err
+		}
+		ds.replicas = append(ds.replicas, replica)
+		log.Info("ethoFS - mounted read-only block replica", "path", path)
+	}
+	return &replicaRepo{Repo: r, ds: ds}, nil
+}
@@ -0,0 +1,106 @@
+package ethofs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	datastore "github.com/ipfs/go-datastore"
+	mount "github.com/ipfs/go-datastore/mount"
+	dsync "github.com/ipfs/go-datastore/sync"
+	flatfs "github.com/ipfs/go-ds-flatfs"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+)
+
+func TestReplicaDatastore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethofs-replica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	shared, err := flatfs.CreateOrOpen(dir, flatfs.NextToLast(2), false)
+	if err != nil {
+		t.Fatalf("failed to create replica: %v", err)
+	}
+	block := blocks.NewBlock([]byte("shared block"))
+	if err := blockstore.NewBlockstore(mount.New([]mount.Mount{{Prefix: blocksPrefix, Datastore: shared}})).Put(block); err != nil {
+		t.Fatalf("failed to store replica block: %v", err)
+	}
+	shared.Close()
+
+	replica, err := openBlockReplica(dir)
+	if err != nil {
+		t.Fatalf("failed to open replica: %v", err)
+	}
+	ds := &replicaDatastore{Datastore: dsync.MutexWrap(datastore.NewMapDatastore()), replicas: []*blockReplica{replica}}
+	bs := blockstore.NewBlockstore(ds)
+
+	have, err := bs.Get(block.Cid())
+	if err != nil {
+		t.Fatalf("failed to read replica block: %v", err)
+	}
+	if !bytes.Equal(have.RawData(), block.RawData()) {
+		t.Fatalf("replica block mismatch: have %q, want %q", have.RawData(), block.RawData())
+	}
+	// Replica blocks are read, but not reported as stored by the repo
+	if has, err := bs.Has(block.Cid()); err != nil || has {
+		t.Fatalf("replica block reported as local: has %v, err %v", has, err)
+	}
+	if _, err := bs.GetSize(block.Cid()); err != blockstore.ErrNotFound {
+		t.Fatalf("replica block size error mismatch: have %v, want %v", err, blockstore.ErrNotFound)
+	}
+	missing := blocks.NewBlock([]byte("missing block"))
+	if _, err := bs.Get(missing.Cid()); err != blockstore.ErrNotFound {
+		t.Fatalf("missing block error mismatch: have %v, want %v", err, blockstore.ErrNotFound)
+	}
+	if _, err := ds.Get(datastore.NewKey("/local/key")); err != datastore.ErrNotFound {
+		t.Fatalf("non-block key served from replica: %v", err)
+	}
+}
+
+func TestReplicaVerification(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethofs-replica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	shared, err := flatfs.CreateOrOpen(dir, flatfs.NextToLast(2), false)
+	if err != nil {
+		t.Fatalf("failed to create replica: %v", err)
+	}
+	good, bad := blocks.NewBlock([]byte("good block")), blocks.NewBlock([]byte("bad block"))
+	bs := blockstore.NewBlockstore(mount.New([]mount.Mount{{Prefix: blocksPrefix, Datastore: shared}}))
+	if err := bs.PutMany([]blocks.Block{good, bad}); err != nil {
+		t.Fatalf("failed to store replica blocks: %v", err)
+	}
+	shared.Close()
+
+	replica, err := openBlockReplica(dir)
+	if err != nil {
+		t.Fatalf("failed to open replica: %v", err)
+	}
+	file, _ := replica.file(dshelp.CidToDsKey(bad.Cid()))
+	if err := ioutil.WriteFile(file, []byte("corrupted"), 0644); err != nil {
+		t.Fatalf("failed to corrupt replica block: %v", err)
+	}
+	for _, verify := range []bool{false, true} {
+		ds := &replicaDatastore{Datastore: dsync.MutexWrap(datastore.NewMapDatastore()), replicas: []*blockReplica{replica}, verify: verify}
+		bs := blockstore.NewBlockstore(ds)
+
+		if _, err := bs.Get(good.Cid()); err != nil {
+			t.Errorf("verify %v: failed to read valid replica block: %v", verify, err)
+		}
+		_, err := bs.Get(bad.Cid())
+		if verify && err != blockstore.ErrNotFound {
+			t.Errorf("verified corrupt block error mismatch: have %v, want %v", err, blockstore.ErrNotFound)
+		}
+		if !verify && err != nil {
+			t.Errorf("unverified corrupt block rejected: %v", err)
+		}
+	}
+}
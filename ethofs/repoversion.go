@@ -0,0 +1,125 @@
+package ethofs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	lockfile "github.com/ipfs/go-fs-lock"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	mfsr "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
+)
+
+// errRepoVersion is returned if the repo on disk does not match the repo
+// version of the embedded go-ipfs and could not be migrated. Retrying the
+// startup does not help, so the supervisor gives up right away.
+var errRepoVersion = errors.New("ethoFS repo version mismatch")
+
+// repoMigration upgrades the repo at repoPath by a single version.
+type repoMigration func(repoPath string) error
+
+// repoMigrations are the vendored migration steps, keyed by the version they
+// upgrade from. Older repos need the external fs-repo-migrations tool.
+var repoMigrations = map[int]repoMigration{
+	9: migrateRepo9To10,
+}
+
+// migrateRepo9To10 is the go-ipfs 0.6 migration. Upstream it adds QUIC
+// listeners and replaces the public bootstrap peers, neither of which applies
+// to the private ethoFS network: libp2p has no QUIC support for private
+// networks and the ethoFS bootstrap peers are dialed separately. Only the
+// version is bumped.
+func migrateRepo9To10(repoPath string) error {
+	return mfsr.RepoPath(repoPath).WriteVersion(10)
+}
+
+// repoMigrationPlan returns the vendored steps upgrading a repo from the
+// given version to the current one, or false if any of them is missing.
+func repoMigrationPlan(from, to int) ([]repoMigration, bool) {
+	var steps []repoMigration
+	for v := from; v < to; v++ {
+		step, ok := repoMigrations[v]
+		if !ok {
+			return nil, false
+		}
+		steps = append(steps, step)
+	}
+	return steps, true
+}
+
+// checkRepoVersion makes sure the repo at repoPath can be opened by the
+// embedded go-ipfs, migrating outdated repos unless migrations are disabled.
+// Repos that are not initialized yet are left to fsrepo.
+func checkRepoVersion(repoPath string, cfg *RepoMigrationConfig) error {
+	if !fsrepo.IsInitialized(repoPath) {
+		return nil
+	}
+	have, err := mfsr.RepoPath(repoPath).Version()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: unreadable version of repo %s: %v", errRepoVersion, repoPath, err)
+	}
+	want := fsrepo.RepoVersion
+	switch {
+	case have == want:
+		return nil
+	case have > want:
+		return fmt.Errorf("%w: repo %s is version %d, newer than the supported version %d", errRepoVersion, repoPath, have, want)
+	case cfg.Disabled:
+		return fmt.Errorf("%w: repo %s is version %d, version %d required and automatic migration disabled (run fs-repo-migrations -to %d)", errRepoVersion, repoPath, have, want, want)
+	}
+	log.Warn("ethoFS - migrating repo", "path", repoPath, "from", have, "to", want)
+	if err := migrateRepo(repoPath, have, want, cfg); err != nil {
+		log.Error("ethoFS - repo migration failed", "path", repoPath, "from", have, "to", want, "error", err)
+		return fmt.Errorf("%w: migrating repo %s from version %d to %d failed: %v", errRepoVersion, repoPath, have, want, err)
+	}
+	log.Info("ethoFS - repo migration successful", "path", repoPath, "version", want)
+	return nil
+}
+
+// migrateRepo runs the vendored migration steps while holding the repo lock,
+// falling back to the fs-repo-migrations tool if they do not cover the
+// upgrade and external migrations are allowed.
+func migrateRepo(repoPath string, from, to int, cfg *RepoMigrationConfig) error {
+	steps, ok := repoMigrationPlan(from, to)
+	if !ok {
+		if !cfg.External {
+			return fmt.Errorf("no built-in migration from version %d, enable external migrations or run fs-repo-migrations -to %d", from, to)
+		}
+		return runExternalMigration(repoPath, to)
+	}
+	lock, err := lockfile.Lock(repoPath, fsrepo.LockFile)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	for i, step := range steps {
+		if err := step(repoPath); err != nil {
+			return fmt.Errorf("version %d to %d: %v", from+i, from+i+1, err)
+		}
+	}
+	return nil
+}
+
+// runExternalMigration runs the fs-repo-migrations tool found in the PATH,
+// or downloaded from the IPFS distribution site, on the repo at repoPath.
+func runExternalMigration(repoPath string, to int) error {
+	// The tool locates the repo through the environment only
+	prev, set := os.LookupEnv("IPFS_PATH")
+	if err := os.Setenv("IPFS_PATH", repoPath); err != nil {
+		return err
+	}
+	defer func() {
+		if set {
+			os.Setenv("IPFS_PATH", prev)
+		} else {
+			os.Unsetenv("IPFS_PATH")
+		}
+	}()
+	return mfsr.RunMigration(to)
+}
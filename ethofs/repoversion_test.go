@@ -0,0 +1,48 @@
+package ethofs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	mfsr "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
+)
+
+func TestCheckRepoVersion(t *testing.T) {
+	tests := []struct {
+		version int
+		cfg     RepoMigrationConfig
+		want    int // Version on disk afterwards
+		fail    bool
+	}{
+		{version: fsrepo.RepoVersion, want: fsrepo.RepoVersion},
+		{version: 9, want: 10},
+		{version: 9, cfg: RepoMigrationConfig{Disabled: true}, want: 9, fail: true},
+		{version: 7, want: 7, fail: true},
+		{version: fsrepo.RepoVersion + 1, want: fsrepo.RepoVersion + 1, fail: true},
+	}
+	for i, tt := range tests {
+		dir, err := ioutil.TempDir("", "ethofs-repo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		if err := ioutil.WriteFile(filepath.Join(dir, "config"), []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := mfsr.RepoPath(dir).WriteVersion(tt.version); err != nil {
+			t.Fatal(err)
+		}
+		err = checkRepoVersion(dir, &tt.cfg)
+		if tt.fail != errors.Is(err, errRepoVersion) {
+			t.Errorf("test %d: error mismatch: have %v, want failure %v", i, err, tt.fail)
+		}
+		if have, _ := mfsr.RepoPath(dir).Version(); have != tt.want {
+			t.Errorf("test %d: version mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
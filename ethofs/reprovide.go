@@ -0,0 +1,248 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	cid "github.com/ipfs/go-cid"
+	config "github.com/ipfs/go-ipfs-config"
+	"github.com/ipfs/go-ipfs-provider/simple"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/libp2p/go-libp2p-core/routing"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultReprovideRate   = 20
+	defaultReprovideSpread = 10 * time.Minute
+
+	// initialReprovideDelay and defaultReprovideInterval mirror the go-ipfs
+	// reprovider, which announces all keys a minute after startup and every
+	// 12 hours afterwards.
+	initialReprovideDelay    = time.Minute
+	defaultReprovideInterval = 12 * time.Hour
+
+	// reprovideLogInterval is the number of announcements between two
+	// progress log messages.
+	reprovideLogInterval = 1000
+)
+
+var errReprovideNotThrottled = errors.New("ethoFS reprovides are not throttled")
+
+var (
+	reprovidedMeter       = metrics.NewRegisteredMeter("ethofs/reprovide/provided", nil)
+	reprovideFailureMeter = metrics.NewRegisteredMeter("ethofs/reprovide/failed", nil)
+)
+
+// ReprovideStatus reports the progress of the throttled reprovider.
+type ReprovideStatus struct {
+	Running  bool       `json:"running"`            // A reprovide is in progress
+	Total    int        `json:"total"`              // Keys of the current or last reprovide
+	Provided int        `json:"provided"`           // Keys announced so far
+	Failed   int        `json:"failed"`             // Keys whose announcement failed
+	Started  *time.Time `json:"started,omitempty"`  // Start of the current or last reprovide
+	Finished *time.Time `json:"finished,omitempty"` // End of the last reprovide
+	Next     *time.Time `json:"next,omitempty"`     // Scheduled start of the next reprovide
+}
+
+// throttled reports whether the keys are reprovided by ethoFS instead of
+// go-ipfs.
+func (c *ReprovideConfig) throttled() bool {
+	return c.Rate > 0 || c.Spread > 0
+}
+
+// reprovideRepo hides the reprovide interval from go-ipfs, whose reprovider
+// would announce all keys at once, leaving the announcements to the
+// throttled reprovider of ethoFS.
+type reprovideRepo struct {
+	repo.Repo
+}
+
+func (r *reprovideRepo) Config() (*config.Config, error) {
+	cfg, err := r.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	conf := *cfg
+	conf.Reprovider.Interval = "0"
+	return &conf, nil
+}
+
+// reprovider announces the keys of the repo to the DHT in random order at a
+// limited rate, spreading the burst after a restart over time.
+type reprovider struct {
+	routing  routing.ContentRouting
+	keys     simple.KeyChanFunc
+	interval time.Duration
+	spread   time.Duration
+	limiter  *rate.Limiter
+
+	lock   sync.Mutex
+	status ReprovideStatus
+}
+
+// newReprovider creates the throttled reprovider of the node, or returns nil
+// if the node reprovides through go-ipfs or not at all.
+func newReprovider(node *core.IpfsNode, cfg *ReprovideConfig) (*reprovider, error) {
+	r, ok := node.Repo.(*reprovideRepo)
+	if !ok {
+		return nil, nil
+	}
+	repoCfg, err := r.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	interval := defaultReprovideInterval
+	if repoCfg.Reprovider.Interval != "" {
+		if interval, err = time.ParseDuration(repoCfg.Reprovider.Interval); err != nil {
+			return nil, err
+		}
+	}
+	if interval == 0 {
+		return nil, nil
+	}
+	var keys simple.KeyChanFunc
+	switch repoCfg.Reprovider.Strategy {
+	case "", "all":
+		keys = simple.NewBlockstoreProvider(node.Blockstore)
+	case "roots":
+		keys = simple.NewPinnedProvider(true, node.Pinning, node.DAG)
+	case "pinned":
+		keys = simple.NewPinnedProvider(false, node.Pinning, node.DAG)
+	default:
+		return nil, fmt.Errorf("unknown reprovider strategy %q", repoCfg.Reprovider.Strategy)
+	}
+	limit := rate.Inf
+	if cfg.Rate > 0 {
+		limit = rate.Limit(cfg.Rate)
+	}
+	return &reprovider{
+		routing:  node.Routing,
+		keys:     keys,
+		interval: interval,
+		spread:   cfg.Spread,
+		limiter:  rate.NewLimiter(limit, 1),
+	}, nil
+}
+
+// loop reprovides the keys once after a random share of the spread has
+// passed, then every interval until the context is cancelled.
+func (r *reprovider) loop(ctx context.Context) {
+	delay := initialReprovideDelay
+	if r.spread > 0 {
+		delay += time.Duration(rand.Int63n(int64(r.spread)))
+	}
+	for {
+		next := time.Now().Add(delay)
+		r.lock.Lock()
+		r.status.Next = &next
+		r.lock.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if err := r.reprovide(ctx); err != nil && ctx.Err() == nil {
+			log.Warn("ethoFS - reprovide failed", "error", err)
+		}
+		delay = r.interval
+	}
+}
+
+// reprovide announces all keys once, in random order so nodes restarted
+// together do not announce the same content at the same time.
+func (r *reprovider) reprovide(ctx context.Context) error {
+	keyCh, err := r.keys(ctx)
+	if err != nil {
+		return err
+	}
+	var keys []cid.Cid
+	for c := range keyCh {
+		keys = append(keys, c)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+
+	start := time.Now()
+	r.lock.Lock()
+	r.status = ReprovideStatus{Running: true, Total: len(keys), Started: &start}
+	r.lock.Unlock()
+
+	log.Info("ethoFS - reprovide started", "keys", len(keys), "rate", r.limiter.Limit())
+	defer func() {
+		end := time.Now()
+		r.lock.Lock()
+		r.status.Running, r.status.Finished = false, &end
+		status := r.status
+		r.lock.Unlock()
+
+		log.Info("ethoFS - reprovide finished", "provided", status.Provided, "failed", status.Failed, "elapsed", end.Sub(start))
+	}()
+	for i, c := range keys {
+		if err := r.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		err := r.routing.Provide(ctx, c, true)
+
+		r.lock.Lock()
+		if err != nil {
+			r.status.Failed++
+		} else {
+			r.status.Provided++
+		}
+		r.lock.Unlock()
+
+		if err != nil {
+			reprovideFailureMeter.Mark(1)
+			log.Debug("ethoFS - reprovide of key failed", "cid", c, "error", err)
+		} else {
+			reprovidedMeter.Mark(1)
+		}
+		if (i+1)%reprovideLogInterval == 0 {
+			log.Info("ethoFS - reprovide in progress", "done", i+1, "total", len(keys))
+		}
+	}
+	return nil
+}
+
+// Status returns the progress of the current or last reprovide.
+func (r *reprovider) Status() ReprovideStatus {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.status
+}
+
+// ReprovideStatus returns the progress of the throttled reprovider of the
+// running node.
+func (s *EthofsService) ReprovideStatus() (ReprovideStatus, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.node == nil {
+		return ReprovideStatus{}, errNodeNotRunning
+	}
+	if s.reprov == nil {
+		return ReprovideStatus{}, errReprovideNotThrottled
+	}
+	return s.reprov.Status(), nil
+}
+
+// Reprovide returns the progress of the throttled announcement of the
+// repo's content to the DHT.
+func (api *PublicEthofsAPI) Reprovide() (_ ReprovideStatus, err error) {
+	defer trackCall("reprovide", time.Now(), &err)
+
+	return api.service.ReprovideStatus()
+}
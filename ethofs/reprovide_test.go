@@ -0,0 +1,65 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs-blocksutil"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/time/rate"
+)
+
+// providerRecorder is a content router recording the announced keys.
+type providerRecorder struct {
+	provided map[cid.Cid]int
+	fail     cid.Cid
+}
+
+func (p *providerRecorder) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	if c == p.fail {
+		return errors.New("provide failed")
+	}
+	p.provided[c]++
+	return nil
+}
+
+func (p *providerRecorder) FindProvidersAsync(context.Context, cid.Cid, int) <-chan peer.AddrInfo {
+	return nil
+}
+
+func TestReprovide(t *testing.T) {
+	var (
+		gen  = blocksutil.NewBlockGenerator()
+		keys []cid.Cid
+	)
+	for _, block := range gen.Blocks(100) {
+		keys = append(keys, block.Cid())
+	}
+	router := &providerRecorder{provided: make(map[cid.Cid]int), fail: keys[0]}
+	r := &reprovider{
+		routing: router,
+		keys: func(context.Context) (<-chan cid.Cid, error) {
+			ch := make(chan cid.Cid, len(keys))
+			for _, c := range keys {
+				ch <- c
+			}
+			close(ch)
+			return ch, nil
+		},
+		limiter: rate.NewLimiter(rate.Inf, 1),
+	}
+	if err := r.reprovide(context.Background()); err != nil {
+		t.Fatalf("reprovide failed: %v", err)
+	}
+	for _, c := range keys[1:] {
+		if router.provided[c] != 1 {
+			t.Errorf("key %s announced %d times", c, router.provided[c])
+		}
+	}
+	status := r.Status()
+	if status.Running || status.Total != len(keys) || status.Provided != len(keys)-1 || status.Failed != 1 || status.Finished == nil {
+		t.Errorf("status mismatch: have %+v", status)
+	}
+}
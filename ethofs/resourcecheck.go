@@ -1,8 +1,8 @@
 package ethofs
 
 import (
-	"os"
-	"runtime"
+	"errors"
+	"fmt"
 
 	"github.com/ethereum/go-ethereum/log"
 
@@ -17,15 +17,23 @@ const (
 	GB = 1024 * MB
 )
 
-func checkResources(nodeType string) {
+var errInsufficientResources = errors.New("ethoFS resource requirements not met")
 
-	v, _ := mem.VirtualMemory()
-	path := "/"
-	if runtime.GOOS == "windows" {
-		path = "C:"
-	}
+// checkResources verifies that the host has enough memory and disk space for
+// the node type.
+func checkResources(nodeType string) error {
 
-	d, _ := disk.Usage(path)
+	v, err := mem.VirtualMemory()
+	if err != nil {
+		log.Warn("ethoFS - unable to check available memory", "error", err)
+		return nil
+	}
+	// Check the volume the repo lives on, which need not be the system one
+	d, err := disk.Usage(existingAncestor(ethofsConfig.repoPath()))
+	if err != nil {
+		log.Warn("ethoFS - unable to check available storage space", "error", err)
+		return nil
+	}
 
 	if nodeType == "mn" {
 		if (float64(v.Total)/float64(GB)) > float64(1.5) && (float64(d.Total)/float64(GB)) > float64(38.00) {
@@ -39,8 +47,8 @@ func checkResources(nodeType string) {
 			} else if (float64(d.Total) / float64(GB)) < float64(38.00) {
 				errorMessage = "not enough storage space"
 			}
-			log.Error("ethoFS - resource requirements not met - exiting", "node type", nodeType, "error", errorMessage)
-			os.Exit(0)
+			log.Error("ethoFS - resource requirements not met", "node type", nodeType, "error", errorMessage)
+			return fmt.Errorf("%w: %s", errInsufficientResources, errorMessage)
 		}
 	} else if nodeType == "sn" {
 		if (float64(v.Total)/float64(GB)) > float64(0.75) && (float64(d.Total)/float64(GB)) > float64(18.00) {
@@ -54,8 +62,8 @@ func checkResources(nodeType string) {
 			} else if (float64(d.Total) / float64(GB)) < float64(18.00) {
 				errorMessage = "not enough storage space"
 			}
-			log.Error("ethoFS - resource requirements not met - exiting", "node type", nodeType, "error", errorMessage)
-			os.Exit(0)
+			log.Error("ethoFS - resource requirements not met", "node type", nodeType, "error", errorMessage)
+			return fmt.Errorf("%w: %s", errInsufficientResources, errorMessage)
 		}
 	} else if nodeType == "gn" {
 		if (float64(v.Total)/float64(GB)) > float64(3.0) && (float64(d.Total)/float64(GB)) > float64(70.00) {
@@ -69,8 +77,9 @@ func checkResources(nodeType string) {
 			} else if (float64(d.Total) / float64(GB)) < float64(70.00) {
 				errorMessage = "not enough storage space"
 			}
-			log.Error("ethoFS - resource requirements not met - exiting", "node type", nodeType, "error", errorMessage)
-			os.Exit(0)
+			log.Error("ethoFS - resource requirements not met", "node type", nodeType, "error", errorMessage)
+			return fmt.Errorf("%w: %s", errInsufficientResources, errorMessage)
 		}
 	}
+	return nil
 }
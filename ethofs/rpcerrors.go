@@ -0,0 +1,121 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	datastore "github.com/ipfs/go-datastore"
+	ipfskeystore "github.com/ipfs/go-ipfs/keystore"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-path/resolver"
+)
+
+// Error codes of the ethofs RPC methods. They are stable across releases, so
+// clients can handle failures without parsing the error messages. Errors not
+// falling into any class keep the default code of the RPC server.
+const (
+	ErrCodeInternal     = -32000 // Unclassified failure
+	ErrCodeOffline      = -32010 // Node not running, offline or without a chain connection
+	ErrCodeNotFound     = -32011 // Content, key, name or record not found
+	ErrCodeUnauthorized = -32012 // Missing or invalid credentials, signatures or permissions
+	ErrCodeQuota        = -32013 // A size or resource limit of the node was exceeded
+	ErrCodeTimeout      = -32014 // Operation did not complete within its deadline
+	ErrCodeDisabled     = -32015 // Feature disabled by the node configuration
+)
+
+// Reasons of the ethofs RPC errors, the machine-readable counterpart of the
+// error codes in the data field of the errors.
+const (
+	ErrReasonInternal     = "internal"
+	ErrReasonOffline      = "offline"
+	ErrReasonNotFound     = "notFound"
+	ErrReasonUnauthorized = "unauthorized"
+	ErrReasonQuota        = "quota"
+	ErrReasonTimeout      = "timeout"
+	ErrReasonDisabled     = "disabled"
+)
+
+// RPCErrorData is the data field of the ethofs RPC errors.
+type RPCErrorData struct {
+	Reason string `json:"reason"`
+}
+
+// rpcErr is an error of the ethofs RPC methods carrying its error code.
+type rpcErr struct {
+	code   int
+	reason string
+	err    error
+}
+
+func (e *rpcErr) Error() string          { return e.err.Error() }
+func (e *rpcErr) Unwrap() error          { return e.err }
+func (e *rpcErr) ErrorCode() int         { return e.code }
+func (e *rpcErr) ErrorData() interface{} { return &RPCErrorData{Reason: e.reason} }
+
+// rpcErrClasses maps the known failures to their error codes, the first
+// matching class wins.
+var rpcErrClasses = []struct {
+	code   int
+	reason string
+	errs   []error
+}{
+	{ErrCodeTimeout, ErrReasonTimeout, []error{
+		context.DeadlineExceeded,
+	}},
+	{ErrCodeOffline, ErrReasonOffline, []error{
+		errNodeNotRunning, errNodeOffline, errNoEthClient, errNoChainHead, errChainUnavailable,
+	}},
+	{ErrCodeNotFound, ErrReasonNotFound, []error{
+		datastore.ErrNotFound, ipld.ErrNotFound, os.ErrNotExist, ipfskeystore.ErrNoSuchKey,
+		namesys.ErrResolveFailed, accounts.ErrUnknownAccount, errCachedNotFound, errNotPinned,
+		errUnknownSub, errUnknownSharedFolder, errSharedFileNotFound, errNoTimeLock, errUnknownSite,
+		errUnknownVersion, errNoPinnedContent, errUnknownExport,
+	}},
+	{ErrCodeUnauthorized, ErrReasonUnauthorized, []error{
+		errAccessDenied, errSignatureExpired, errNoCredentials, errInvalidCredentials,
+		errUnknownChallenge, errPeerDenied, errNotRecipient, errTimeLocked, errUnverifiedContent,
+		errNotQuorumPeer, errNotMigrationSource, errPeerNotAllowed, keystore.ErrDecrypt, keystore.ErrLocked,
+	}},
+	{ErrCodeQuota, ErrReasonQuota, []error{
+		errFileTooLarge, errDAGTooDeep,
+	}},
+	{ErrCodeDisabled, ErrReasonDisabled, []error{
+		errPubSubDisabled, errNoCreditLedger, errNoVerifier, errNoSignatureVerifier,
+		errNoClockCheck, errNoReceiptContract, errNoQuorumPeers, errReprovideNotThrottled,
+		errNoKeystore, errNoAllowlist, errNoIntegrityProver, rpc.ErrNotificationsUnsupported,
+	}},
+}
+
+// rpcError attaches the error code and reason of its class to the error of an
+// RPC method. Errors already carrying a code, like invalid parameters, are
+// returned as is.
+func rpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(rpc.Error); ok {
+		return err
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return &rpcErr{code: ErrCodeTimeout, reason: ErrReasonTimeout, err: err}
+	}
+	var noLink resolver.ErrNoLink
+	if errors.As(err, &noLink) {
+		return &rpcErr{code: ErrCodeNotFound, reason: ErrReasonNotFound, err: err}
+	}
+	for _, class := range rpcErrClasses {
+		for _, target := range class.errs {
+			if errors.Is(err, target) {
+				return &rpcErr{code: class.code, reason: class.reason, err: err}
+			}
+		}
+	}
+	return &rpcErr{code: ErrCodeInternal, reason: ErrReasonInternal, err: err}
+}
@@ -0,0 +1,74 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-path/resolver"
+)
+
+// timeoutError is a network failure reporting a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// paramsError is an error already carrying an RPC error code.
+type paramsError struct{}
+
+func (paramsError) Error() string  { return "invalid argument" }
+func (paramsError) ErrorCode() int { return -32602 }
+
+func TestRPCError(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   int
+		reason string
+	}{
+		{errNodeNotRunning, ErrCodeOffline, ErrReasonOffline},
+		{ipld.ErrNotFound, ErrCodeNotFound, ErrReasonNotFound},
+		{fmt.Errorf("resolve: %w", errSharedFileNotFound), ErrCodeNotFound, ErrReasonNotFound},
+		{resolver.ErrNoLink{Name: "index.html", Node: cid.Undef}, ErrCodeNotFound, ErrReasonNotFound},
+		{errAccessDenied, ErrCodeUnauthorized, ErrReasonUnauthorized},
+		{fmt.Errorf("%w of %d bytes", errFileTooLarge, maxGetSize), ErrCodeQuota, ErrReasonQuota},
+		{context.DeadlineExceeded, ErrCodeTimeout, ErrReasonTimeout},
+		{fmt.Errorf("block not retrieved: %w", context.DeadlineExceeded), ErrCodeTimeout, ErrReasonTimeout},
+		{timeoutError{}, ErrCodeTimeout, ErrReasonTimeout},
+		{errPubSubDisabled, ErrCodeDisabled, ErrReasonDisabled},
+		{errors.New("unexpected failure"), ErrCodeInternal, ErrReasonInternal},
+	}
+	for i, tt := range tests {
+		err := rpcError(tt.err)
+		coded, ok := err.(rpc.Error)
+		if !ok {
+			t.Errorf("test %d: error without code: %v", i, err)
+			continue
+		}
+		if coded.ErrorCode() != tt.code {
+			t.Errorf("test %d: code mismatch: have %d, want %d", i, coded.ErrorCode(), tt.code)
+		}
+		data := err.(rpc.DataError).ErrorData().(*RPCErrorData)
+		if data.Reason != tt.reason {
+			t.Errorf("test %d: reason mismatch: have %q, want %q", i, data.Reason, tt.reason)
+		}
+		if err.Error() != tt.err.Error() {
+			t.Errorf("test %d: message changed: have %q, want %q", i, err.Error(), tt.err.Error())
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d: coded error does not wrap the failure", i)
+		}
+	}
+	if err := rpcError(nil); err != nil {
+		t.Errorf("nil error coded: %v", err)
+	}
+	if err := rpcError(paramsError{}); err != (paramsError{}) {
+		t.Errorf("coded error rewrapped: %#v", err)
+	}
+}
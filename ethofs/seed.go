@@ -0,0 +1,120 @@
+package ethofs
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+
+	config "github.com/ipfs/go-ipfs-config"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Seeded devnet nodes listen on localhost, node i on the base ports plus i.
+const (
+	seedHost            = "127.0.0.1"
+	seedSwarmBasePort   = 4001
+	seedAPIBasePort     = 5001
+	seedGatewayBasePort = 8080
+
+	// maxSeedNodes bounds the node index so the port ranges do not overlap.
+	maxSeedNodes = seedAPIBasePort - seedSwarmBasePort
+)
+
+// seedStream is an endless deterministic byte stream derived from a seed,
+// used in place of crypto/rand when initializing seeded repos.
+type seedStream struct {
+	prefix  []byte
+	counter uint64
+	buf     []byte
+}
+
+// newSeedStream derives the stream for the given purpose of devnet node index.
+func newSeedStream(seed string, purpose string, index int) *seedStream {
+	return &seedStream{prefix: []byte(fmt.Sprintf("ethofs/%s/%d/%s", purpose, index, seed))}
+}
+
+func (s *seedStream) Read(p []byte) (int, error) {
+	for n := 0; n < len(p); {
+		if len(s.buf) == 0 {
+			var counter [8]byte
+			binary.BigEndian.PutUint64(counter[:], s.counter)
+			s.counter++
+
+			block := sha256.Sum256(append(append([]byte{}, s.prefix...), counter[:]...))
+			s.buf = block[:]
+		}
+		copied := copy(p[n:], s.buf)
+		s.buf = s.buf[copied:]
+		n += copied
+	}
+	return len(p), nil
+}
+
+// seedKey derives the ed25519 identity key of devnet node index.
+func seedKey(seed string, index int) (ci.PrivKey, peer.ID, error) {
+	key, _, err := ci.GenerateEd25519Key(newSeedStream(seed, "identity", index))
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, id, nil
+}
+
+// seedSwarmKey derives the private network key shared by all nodes of the
+// devnet, keeping it apart from the production network.
+func seedSwarmKey(seed string) []byte {
+	key := make([]byte, 32)
+	newSeedStream(seed, "swarm", 0).Read(key)
+	return key
+}
+
+// seedBootstrap returns the bootstrap peers of devnet node index: every node
+// but the first bootstraps from the first one.
+func seedBootstrap(seed string, index int) ([]string, error) {
+	if index == 0 {
+		return nil, nil
+	}
+	_, id, err := seedKey(seed, 0)
+	if err != nil {
+		return nil, err
+	}
+	return []string{fmt.Sprintf("/ip4/%s/tcp/%d/ipfs/%s", seedHost, seedSwarmBasePort, id.Pretty())}, nil
+}
+
+// seedGatewayAddr returns the gateway listen address of devnet node index.
+func seedGatewayAddr(index int) string {
+	return fmt.Sprintf("/ip4/%s/tcp/%d", seedHost, seedGatewayBasePort+index)
+}
+
+// seededRepoConfig creates the repo config of devnet node index. Repos
+// initialized from the same seed and index always get the same identity,
+// addresses and bootstrap peers.
+func seededRepoConfig(seed string, index int) (*config.Config, error) {
+	key, id, err := seedKey(seed, index)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err := key.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	conf, err := config.InitWithIdentity(config.Identity{
+		PeerID:  id.Pretty(),
+		PrivKey: base64.StdEncoding.EncodeToString(keyBytes),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if conf.Bootstrap, err = seedBootstrap(seed, index); err != nil {
+		return nil, err
+	}
+	conf.Addresses.Swarm = []string{fmt.Sprintf("/ip4/%s/tcp/%d", seedHost, seedSwarmBasePort+index)}
+	conf.Addresses.API = config.Strings{fmt.Sprintf("/ip4/%s/tcp/%d", seedHost, seedAPIBasePort+index)}
+	conf.Addresses.Gateway = config.Strings{seedGatewayAddr(index)}
+	return conf, nil
+}
@@ -0,0 +1,54 @@
+package ethofs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSeededRepoConfig(t *testing.T) {
+	first, err := seededRepoConfig("devnet", 1)
+	if err != nil {
+		t.Fatalf("failed to create seeded config: %v", err)
+	}
+	second, err := seededRepoConfig("devnet", 1)
+	if err != nil {
+		t.Fatalf("failed to create seeded config: %v", err)
+	}
+	if first.Identity != second.Identity {
+		t.Errorf("identity not deterministic: %s != %s", first.Identity.PeerID, second.Identity.PeerID)
+	}
+	other, err := seededRepoConfig("devnet", 2)
+	if err != nil {
+		t.Fatalf("failed to create seeded config: %v", err)
+	}
+	if other.Identity.PeerID == first.Identity.PeerID {
+		t.Error("nodes of the same devnet share an identity")
+	}
+	if have, want := first.Addresses.Swarm[0], "/ip4/127.0.0.1/tcp/4002"; have != want {
+		t.Errorf("swarm address mismatch: have %s, want %s", have, want)
+	}
+	root, err := seededRepoConfig("devnet", 0)
+	if err != nil {
+		t.Fatalf("failed to create seeded config: %v", err)
+	}
+	if len(root.Bootstrap) != 0 {
+		t.Errorf("first node has bootstrap peers: %v", root.Bootstrap)
+	}
+	if len(first.Bootstrap) != 1 || !strings.HasSuffix(first.Bootstrap[0], "/ipfs/"+root.Identity.PeerID) {
+		t.Errorf("bootstrap peers do not point at the first node: %v", first.Bootstrap)
+	}
+}
+
+func TestSeedSwarmKey(t *testing.T) {
+	key := seedSwarmKey("devnet")
+	if len(key) != 32 {
+		t.Fatalf("swarm key length mismatch: have %d, want 32", len(key))
+	}
+	if !bytes.Equal(key, seedSwarmKey("devnet")) {
+		t.Error("swarm key not deterministic")
+	}
+	if bytes.Equal(key, seedSwarmKey("other")) {
+		t.Error("different seeds share a swarm key")
+	}
+}
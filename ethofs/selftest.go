@@ -0,0 +1,369 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+// Outcomes of a self-test check.
+const (
+	checkOK      = "ok"
+	checkWarning = "warning"
+	checkFailed  = "failed"
+	checkSkipped = "skipped"
+)
+
+// selfTestTimeout bounds the network checks of a self-test.
+const selfTestTimeout = 10 * time.Second
+
+// defaultSwarmAddrs are the listen addresses of repos initialized by go-ipfs,
+// checked if the repo does not exist yet.
+var defaultSwarmAddrs = []string{"/ip4/0.0.0.0/tcp/4001", "/ip6/::/tcp/4001"}
+
+// SelfTestCheck is the outcome of a single self-test check.
+type SelfTestCheck struct {
+	Name   string `json:"name"`
+	Result string `json:"result"` // ok, warning, failed or skipped
+	Detail string `json:"detail,omitempty"`
+}
+
+// SelfTestReport is the outcome of a self-test. The node is fit to run if no
+// check failed, warnings point at degraded setups.
+type SelfTestReport struct {
+	OK     bool            `json:"ok"`
+	Checks []SelfTestCheck `json:"checks"`
+}
+
+// selfTest runs the checks of a self-test. Running nodes own the ports of the
+// configuration, so ports in use are only reported for stopped ones.
+type selfTest struct {
+	cfg     *Config
+	chain   *rpc.Client
+	running bool
+}
+
+// SelfTest checks whether the environment of the configuration lets an ethoFS
+// node run: disk writability, port availability, swarm key validity, clock
+// skew, bootstrap reachability and chain RPC connectivity. The chain checks
+// are skipped without a client.
+func SelfTest(ctx context.Context, cfg *Config, chain *rpc.Client) *SelfTestReport {
+	// Contract key sources read the chain through the client of the node
+	if chain != nil && ethClient == nil {
+		initializeEthClient(chain)
+		defer func() { ethClient = nil }()
+	}
+	return (&selfTest{cfg: cfg, chain: chain}).run(ctx)
+}
+
+func (t *selfTest) run(ctx context.Context) *SelfTestReport {
+	checks := []func(context.Context) SelfTestCheck{
+		t.checkDisk, t.checkPorts, t.checkSwarmKey, t.checkClock, t.checkBootstrap, t.checkChain,
+	}
+	report := &SelfTestReport{OK: true, Checks: make([]SelfTestCheck, len(checks))}
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check func(context.Context) SelfTestCheck) {
+			defer wg.Done()
+			report.Checks[i] = check(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, check := range report.Checks {
+		if check.Result == checkFailed {
+			report.OK = false
+		}
+	}
+	return report
+}
+
+// checkDisk creates a file in the repo, or in the directory the repo is going
+// to be created in.
+func (t *selfTest) checkDisk(ctx context.Context) SelfTestCheck {
+	check := SelfTestCheck{Name: "disk"}
+
+	root := t.cfg.repoPath()
+	dir := existingAncestor(root)
+	f, err := ioutil.TempFile(dir, ".ethofs-selftest")
+	if err != nil {
+		check.Result, check.Detail = checkFailed, fmt.Sprintf("%s not writable: %v", dir, err)
+		return check
+	}
+	_, err = f.Write([]byte("ethoFS"))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	os.Remove(f.Name())
+	if err != nil {
+		check.Result, check.Detail = checkFailed, fmt.Sprintf("%s not writable: %v", dir, err)
+		return check
+	}
+	check.Result, check.Detail = checkOK, fmt.Sprintf("%s writable", root)
+	if dir != root {
+		check.Detail = fmt.Sprintf("%s writable, repo not initialized at %s", dir, root)
+	}
+	return check
+}
+
+// checkPorts tries to listen on the swarm addresses and the HTTP endpoints of
+// the configuration.
+func (t *selfTest) checkPorts(ctx context.Context) SelfTestCheck {
+	check := SelfTestCheck{Name: "ports", Result: checkOK}
+
+	swarm := t.cfg.SwarmAddresses
+	if len(swarm) == 0 {
+		swarm = defaultSwarmAddrs
+		if root := t.cfg.repoPath(); fsrepo.IsInitialized(root) {
+			if conf, err := fsrepo.ConfigAt(root); err == nil {
+				swarm = conf.Addresses.Swarm
+			}
+		}
+		if t.cfg.NAT.Port != 0 {
+			if ported, err := withSwarmPort(swarm, t.cfg.NAT.Port); err == nil {
+				swarm = ported
+			}
+		}
+	}
+	var addrs []string
+	for _, addr := range swarm {
+		maddr, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			check.Result, check.Detail = checkFailed, fmt.Sprintf("invalid swarm address %s: %v", addr, err)
+			return check
+		}
+		network, host, err := manet.DialArgs(maddr)
+		if err != nil {
+			continue // transports without a plain socket, e.g. websockets
+		}
+		addrs = append(addrs, network+" "+host)
+	}
+	for _, addr := range []string{t.cfg.HealthAddr, t.cfg.Admin.ListenAddr, t.cfg.Redirector.ListenAddr, t.cfg.Gateway.ListenAddr} {
+		if addr != "" {
+			addrs = append(addrs, "tcp "+addr)
+		}
+	}
+	if t.running {
+		check.Detail = fmt.Sprintf("%d addresses in use by the running node", len(addrs))
+		return check
+	}
+	var busy []string
+	for _, addr := range addrs {
+		parts := strings.SplitN(addr, " ", 2)
+		if err := tryListen(parts[0], parts[1]); err != nil {
+			busy = append(busy, fmt.Sprintf("%s/%s", parts[0], parts[1]))
+		}
+	}
+	if len(busy) > 0 {
+		check.Result, check.Detail = checkFailed, "in use: "+strings.Join(busy, ", ")
+		return check
+	}
+	check.Detail = fmt.Sprintf("%d addresses available", len(addrs))
+	return check
+}
+
+// tryListen checks whether the address can be listened on.
+func tryListen(network, addr string) error {
+	if strings.HasPrefix(network, "udp") {
+		conn, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	return listener.Close()
+}
+
+// checkSwarmKey validates the swarm key of the repo and compares it against
+// the configured key source.
+func (t *selfTest) checkSwarmKey(ctx context.Context) SelfTestCheck {
+	check := SelfTestCheck{Name: "swarmkey"}
+	if t.cfg.Light {
+		check.Result, check.Detail = checkSkipped, "light nodes join the public network"
+		return check
+	}
+	source, err := configuredSwarmKeySource(t.cfg)
+	if err != nil {
+		check.Result, check.Detail = checkFailed, err.Error()
+		return check
+	}
+	var want []byte
+	if source != nil {
+		ctx, cancel := context.WithTimeout(ctx, swarmKeyTimeout)
+		defer cancel()
+
+		if want, err = source.key(ctx); err != nil {
+			result := checkFailed
+			if source.dynamic() {
+				result = checkWarning // the node keeps the key of the repo
+			}
+			check.Result, check.Detail = result, fmt.Sprintf("key source %s unavailable: %v", source, err)
+			return check
+		}
+	}
+	current, err := readSwarmKey(t.cfg.repoPath())
+	switch {
+	case os.IsNotExist(err) && want == nil:
+		check.Result, check.Detail = checkOK, "no repo key yet, the network key is written at init"
+	case os.IsNotExist(err):
+		check.Result, check.Detail = checkOK, fmt.Sprintf("no repo key yet, the key of %s is written at start", source)
+	case err != nil:
+		check.Result, check.Detail = checkFailed, fmt.Sprintf("repo key unusable: %v", err)
+	case want != nil && !bytes.Equal(current, want):
+		check.Result, check.Detail = checkWarning, fmt.Sprintf("repo key differs from %s, replaced at next start", source)
+	case want == nil && t.cfg.Seed == "" && !t.cfg.testing() && hex.EncodeToString(current) != defaultSwarmKey:
+		check.Result, check.Detail = checkWarning, "repo key is not the ethoFS network key"
+	default:
+		check.Result, check.Detail = checkOK, "repo key valid"
+	}
+	return check
+}
+
+// checkClock compares the local clock against NTP.
+func (t *selfTest) checkClock(ctx context.Context) SelfTestCheck {
+	check := SelfTestCheck{Name: "clock"}
+
+	ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+
+	skew, err := sntpOffset(ctx, ntpServer)
+	switch {
+	case err != nil:
+		check.Result, check.Detail = checkWarning, fmt.Sprintf("NTP unreachable: %v", err)
+	case skew > maxClockSkew || skew < -maxClockSkew:
+		check.Result, check.Detail = checkWarning, fmt.Sprintf("clock off by %v, signed records may be rejected", skew.Round(time.Millisecond))
+	default:
+		check.Result, check.Detail = checkOK, fmt.Sprintf("clock off by %v", skew.Round(time.Millisecond))
+	}
+	return check
+}
+
+// checkBootstrap opens TCP connections to the bootstrap peers. The libp2p
+// handshake needs a node, so a reachable peer may still reject the swarm key.
+func (t *selfTest) checkBootstrap(ctx context.Context) SelfTestCheck {
+	check := SelfTestCheck{Name: "bootstrap"}
+	if t.cfg.Offline {
+		check.Result, check.Detail = checkSkipped, "offline node"
+		return check
+	}
+	peers, err := parsePeerAddrs(t.cfg.bootstrapNodes())
+	if err != nil {
+		check.Result, check.Detail = checkFailed, err.Error()
+		return check
+	}
+	if len(peers) == 0 {
+		check.Result, check.Detail = checkWarning, "no bootstrap peers configured"
+		return check
+	}
+	ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+
+	var (
+		reachable int
+		lock      sync.Mutex
+		wg        sync.WaitGroup
+	)
+	for _, info := range peers {
+		for _, addr := range info.Addrs {
+			network, host, err := manet.DialArgs(addr)
+			if err != nil || !strings.HasPrefix(network, "tcp") {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				var dialer net.Dialer
+				if conn, err := dialer.DialContext(ctx, network, host); err == nil {
+					conn.Close()
+					lock.Lock()
+					reachable++
+					lock.Unlock()
+				}
+			}()
+			break // one address per peer
+		}
+	}
+	wg.Wait()
+
+	min := t.cfg.MinBootstrapPeers
+	if min <= 0 {
+		min = defaultMinBootstrapPeers
+	}
+	check.Detail = fmt.Sprintf("%d of %d peers reachable", reachable, len(peers))
+	switch {
+	case reachable < min:
+		check.Result = checkFailed
+	case reachable < len(peers):
+		check.Result = checkWarning
+	default:
+		check.Result = checkOK
+	}
+	return check
+}
+
+// checkChain queries the chain RPC for the head block.
+func (t *selfTest) checkChain(ctx context.Context) SelfTestCheck {
+	check := SelfTestCheck{Name: "chain"}
+	if t.chain == nil {
+		check.Result, check.Detail = checkSkipped, "no chain RPC endpoint"
+		return check
+	}
+	ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+
+	var head hexutil.Uint64
+	if err := t.chain.CallContext(ctx, &head, "eth_blockNumber"); err != nil {
+		check.Result, check.Detail = checkFailed, fmt.Sprintf("chain RPC unreachable: %v", err)
+		return check
+	}
+	var syncing interface{}
+	if err := t.chain.CallContext(ctx, &syncing, "eth_syncing"); err == nil && syncing != false {
+		check.Result, check.Detail = checkWarning, fmt.Sprintf("chain syncing at block %d, contract state may be stale", head)
+		return check
+	}
+	check.Result, check.Detail = checkOK, fmt.Sprintf("head block %d", head)
+	return check
+}
+
+// SelfTest checks the environment of the service. The ports of the running
+// node are not probed.
+func (s *EthofsService) SelfTest(ctx context.Context) (*SelfTestReport, error) {
+	chain, err := s.stack.Attach()
+	if err != nil {
+		return nil, err
+	}
+	defer chain.Close()
+
+	cfg := s.config
+	t := &selfTest{cfg: &cfg, chain: chain, running: s.Node() != nil}
+	return t.run(ctx), nil
+}
+
+// SelfTest checks disk, ports, swarm key, clock, bootstrap peers and chain of
+// the node.
+func (api *PublicEthofsAPI) SelfTest(ctx context.Context) (_ *SelfTestReport, err error) {
+	defer trackCall("selfTest", time.Now(), &err)
+
+	return api.service.SelfTest(ctx)
+}
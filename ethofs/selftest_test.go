@@ -0,0 +1,60 @@
+package ethofs
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelfTestDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethofs-selftest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := DefaultConfig
+	cfg.RepoPath = filepath.Join(dir, "repo")
+
+	check := (&selfTest{cfg: &cfg}).checkDisk(context.Background())
+	if check.Result != checkOK || !strings.Contains(check.Detail, "not initialized") {
+		t.Errorf("fresh repo: have %+v", check)
+	}
+}
+
+func TestSelfTestPorts(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	port := busy.Addr().(*net.TCPAddr).Port
+
+	dir, err := ioutil.TempDir("", "ethofs-selftest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := DefaultConfig
+	cfg.RepoPath = dir
+	cfg.SwarmAddresses = []string{"/ip4/127.0.0.1/tcp/0", "/ip4/127.0.0.1/udp/0/quic"}
+
+	test := &selfTest{cfg: &cfg}
+	if check := test.checkPorts(context.Background()); check.Result != checkOK {
+		t.Errorf("free ports: have %+v", check)
+	}
+	cfg.HealthAddr = busy.Addr().String()
+	if check := test.checkPorts(context.Background()); check.Result != checkFailed || !strings.Contains(check.Detail, busy.Addr().String()) {
+		t.Errorf("busy port %d: have %+v", port, check)
+	}
+	// The ports of running nodes are their own
+	test.running = true
+	if check := test.checkPorts(context.Background()); check.Result != checkOK {
+		t.Errorf("running node: have %+v", check)
+	}
+}
@@ -0,0 +1,588 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+
+	ipfscore "github.com/ipfs/go-ipfs/core"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+)
+
+// blockChanSize is the size of the channel receiving newly imported blocks.
+const blockChanSize = 16
+
+var errServiceRunning = errors.New("ethoFS service already running")
+
+// EthofsService runs the embedded ethoFS node as a lifecycle of the geth
+// protocol stack. It can be stopped and started again, every run creating a
+// fresh IPFS node on the same repo.
+type EthofsService struct {
+	stack  *node.Node
+	config Config
+	blocks chan *types.Block
+
+	lifecycle sync.Mutex // Serializes Start and Stop, held while tearing down
+	lock      sync.Mutex
+	ipfs      icore.CoreAPI
+	node      *ipfscore.IpfsNode
+	storage   *storageManager
+	reprov    *reprovider
+	fetches   *sessionCache
+	denied    *peerDenylist
+	scope     event.SubscriptionScope // Event subscriptions, kept across in-process restarts
+	verify    *availabilityVerifier
+	admin     *adminServer
+	redir     *redirector
+	health    *healthServer
+	startup   *startupSupervisor
+	status    StartupStatus
+	auth      []AuthProvider
+	subs      subscriptions
+	shared    *sharedSync
+	credits   *creditLedger
+	hooks     *addHookRunner
+	proofs    *integrityProver
+	exports   *treeExporter
+	plugins   []LifecyclePlugin
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// New creates the ethoFS service and registers it with the protocol stack.
+func New(stack *node.Node, cfg *Config) (*EthofsService, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	s := &EthofsService{
+		stack:  stack,
+		config: *cfg,
+		blocks: make(chan *types.Block, blockChanSize),
+		status: StartupStatus{State: StartupStopped},
+	}
+	core.InitializeBlockCommunication(s.blocks)
+
+	stack.RegisterAPIs(s.APIs())
+	stack.RegisterLifecycle(s)
+	return s, nil
+}
+
+// Start implements node.Lifecycle, launching the supervised startup of the
+// IPFS node and the block processing goroutines. Startup failures are retried
+// in the background and never fail the protocol stack, see StartupStatus.
+func (s *EthofsService) Start() error {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.node != nil || s.startup != nil && s.status.State != StartupFailed {
+		return errServiceRunning
+	}
+	if s.startup != nil {
+		s.startup.cancel() // release the context of a failed startup
+	}
+	// The health endpoint reports on the startup too, and on failed ones
+	if s.health == nil && s.config.HealthAddr != "" {
+		health, err := startHealthServer(s.config.HealthAddr, s)
+		if err != nil {
+			return err
+		}
+		s.health = health
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.startup = &startupSupervisor{cancel: cancel, done: make(chan struct{})}
+	s.status = StartupStatus{State: StartupStarting}
+	setInstanceStatus(s.status)
+
+	go s.supervise(ctx, s.startup.done)
+	return nil
+}
+
+// startNode spawns the IPFS node and its background services, tearing
+// everything down again if any of them fails to initialize.
+func (s *EthofsService) startNode(parent context.Context) error {
+	// The startup runs without the service lock so the status and health
+	// reports stay responsive, only the results are published under it
+	s.lock.Lock()
+	cfg, auth := s.config, s.auth
+	s.lock.Unlock()
+
+	ethofsConfig = cfg
+	nodeType := cfg.NodeType
+
+	if err := checkResources(nodeType); err != nil {
+		return err
+	}
+	if err := gatewayHosts.reset(cfg.Gateway.VirtualHosts); err != nil {
+		return err
+	}
+
+	client, err := s.stack.Attach()
+	if err != nil {
+		return err
+	}
+	initializeEthClient(client)
+
+	keySource, err := configuredSwarmKeySource(&cfg)
+	if err == nil && !cfg.Light {
+		err = syncSwarmKey(context.Background(), cfg.repoPath(), keySource)
+	}
+	if err == nil {
+		var allowed *peerAllowlist
+		if allowed, err = loadPeerAllowlist(parent, &cfg.Allowlist); err == nil {
+			setAllowlist(allowed)
+		}
+	}
+	if err != nil {
+		ethClient.Close()
+		return err
+	}
+	log.Info("Starting ethoFS node initialization", "type", nodeType)
+	ctx, cancel := context.WithCancel(parent)
+	ipfs, node, err := initializeEthofsNode(ctx, nodeType)
+	if err != nil {
+		cancel()
+		resetNodeState()
+		ethClient.Close()
+		return err
+	}
+	// Tear the node down again if any of its background services fails to
+	// initialize
+	fail := func(err error) error {
+		cancel()
+		resetNodeState()
+		history.detach()
+		pinExpiries.detach()
+		ownedPins.detach()
+		localPins.detach()
+		sharedFolders.detach()
+		treeExports.detach()
+		timeLocks.detach()
+		node.Close()
+		ethClient.Close()
+		return err
+	}
+	// Offline nodes have no swarm, they only work on the local repo
+	online := node.IsOnline
+	if online {
+		if err := serveReplication(node, &cfg.Quorum); err != nil {
+			return fail(err)
+		}
+		if err := serveMigration(node, cfg.MigrationSources); err != nil {
+			return fail(err)
+		}
+		if cfg.ColdStart.Serve && !cfg.Light {
+			serveBundle(node, cfg.repoPath(), &cfg.ColdStart)
+		}
+	}
+	reconnect, err := newReconnectManager(ipfs, &cfg)
+	if err != nil {
+		return fail(err)
+	}
+	discovery, err := newBootstrapDiscovery(&cfg, reconnect.setBootstrap)
+	if err != nil {
+		return fail(err)
+	}
+	storage, err := newStorageManager(node, &cfg)
+	if err != nil {
+		return fail(err)
+	}
+	reprov, err := newReprovider(node, &cfg.Reprovide)
+	if err != nil {
+		return fail(err)
+	}
+	fetches, err := newSessionCache(node)
+	if err != nil {
+		return fail(err)
+	}
+	denied := currentDenylist()
+	if err := history.attach(node.Repo.Datastore()); err != nil {
+		return fail(err)
+	}
+	pinExpiries.attach(node.Repo.Datastore())
+	ownedPins.attach(node.Repo.Datastore())
+	sharedFolders.attach(node.Repo.Datastore())
+	treeExports.attach(node.Repo.Datastore())
+	timeLocks.attach(node.Repo.Datastore())
+	if err := localPins.attach(ctx, node.Repo.Datastore(), node.Pinning); err != nil {
+		return fail(err)
+	}
+	if _, err := snapshotConfig(ctx, node, &cfg); err != nil {
+		log.Warn("ethoFS - unable to snapshot config", "error", err)
+	}
+	if online {
+		watchPeers(node.PeerHost)
+	}
+
+	var admin *adminServer
+	if cfg.Admin.ListenAddr != "" {
+		if admin, err = startAdminServer(&cfg.Admin, NewPublicEthofsAPI(s), NewPrivateEthofsAPI(s), auth); err != nil {
+			return fail(err)
+		}
+	}
+	var redir *redirector
+	if cfg.Redirector.ListenAddr != "" && online {
+		redir, err = newRedirector(node, &cfg.Redirector)
+		if err == nil {
+			err = redir.start(cfg.Redirector.ListenAddr)
+		}
+		if err != nil {
+			if admin != nil {
+				admin.stop()
+			}
+			return fail(err)
+		}
+	}
+	var verify *availabilityVerifier
+	if cfg.Verifier.Enabled {
+		verify = newAvailabilityVerifier(ipfs, node, s.stack.AccountManager(), &cfg.Verifier)
+	}
+	var (
+		credits *creditLedger
+		proofs  *integrityProver
+		hooks   = newAddHookRunner(&cfg.AddHooks)
+		shared  *sharedSync
+		exports = newTreeExporter(ipfs, node, cfg.ExportRefresh, cfg.ExportRoot)
+	)
+	if online && !cfg.Credits.Disabled {
+		if credits, err = loadCreditLedger(node.Repo.Datastore(), &cfg.Credits); err != nil {
+			log.Warn("ethoFS - bandwidth credits disabled", "error", err)
+		}
+	}
+	if cfg.Integrity.Enabled {
+		proofs = newIntegrityProver(node, s.stack.AccountManager(), &cfg.Integrity)
+	}
+	if online {
+		shared = newSharedSync(ctx, s, ipfs, node.Identity)
+	}
+	plugins := startPlugins(ctx, &Ethofs{API: ipfs, Node: node})
+
+	// Publish the node only once all of its services are assigned, RPC
+	// callers never see it half initialized
+	s.lock.Lock()
+	s.ipfs, s.node, s.storage, s.reprov, s.fetches, s.denied, s.verify, s.admin, s.redir, s.cancel = ipfs, node, storage, reprov, fetches, denied, verify, admin, redir, cancel
+	s.plugins, s.shared, s.credits, s.hooks, s.proofs, s.exports = plugins, shared, credits, hooks, proofs, exports
+	s.lock.Unlock()
+	setInstance(&Ethofs{API: ipfs, Node: node})
+
+	// The contract sync waits for the chain backend, serving does not
+	chain := newChainMonitor()
+	setChainBackend(chain)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		chain.loop(ctx)
+	}()
+
+	s.wg.Add(1)
+	if !cfg.Light && online {
+		// Light nodes only retrieve content, they never host the uploads
+		// of the pinning contract
+		s.wg.Add(2)
+		go func() {
+			defer s.wg.Done()
+
+			// New nodes hold the popular content before they start hosting
+			if err := coldStart(ctx, node, cfg.repoPath(), cfg.ColdStart.Seeds); err != nil {
+				log.Warn("ethoFS - cold start failed, hosting without bundle", "error", err)
+			}
+			err := chain.submit(ctx, "pinContract", updatePinContractValues)
+			if err == errChainUnavailable {
+				log.Debug("ethoFS - pin contract update queued, chain backend unavailable")
+			} else if err != nil {
+				log.Debug("ethoFS - error updating pin contract values")
+			} else {
+				log.Debug("ethoFS - pin contract value update successful")
+			}
+
+			updateLocalPinMapping(node)
+		}()
+		// Initialize block listener
+		go func() {
+			defer s.wg.Done()
+			BlockListener(ctx, s.blocks, chain, &s.wg)
+		}()
+	}
+	if online {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			reconnect.loop(ctx)
+		}()
+	}
+	go func() {
+		defer s.wg.Done()
+		storage.loop(ctx)
+	}()
+	if !cfg.Light {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			watchExpiries(ctx, ipfs, node, storage)
+		}()
+	}
+	if cache := missingContent; cache != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			cache.loop(ctx)
+		}()
+	}
+	if allowed := currentAllowlist(); allowed != nil && online {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			allowed.loop(ctx, node.PeerHost)
+		}()
+	}
+	if len(cfg.BootstrapSources) > 0 && online {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			discovery.loop(ctx)
+		}()
+	}
+	if reprov != nil && online {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			reprov.loop(ctx)
+		}()
+	}
+	if verify != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			verify.loop(ctx)
+		}()
+	}
+	if cfg.Telemetry.Enabled {
+		reporter, err := newTelemetryReporter(node, &cfg)
+		if err != nil {
+			log.Warn("ethoFS - telemetry disabled", "error", err)
+		} else {
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				reporter.loop(ctx)
+			}()
+		}
+	}
+	setClockMonitor(nil)
+	if online && !cfg.Clock.Disabled {
+		monitor := newClockMonitor(&cfg.Clock)
+		setClockMonitor(monitor)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			monitor.loop(ctx)
+		}()
+	}
+	if credits != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			credits.loop(ctx, node)
+		}()
+	}
+	if proofs != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			proofs.loop(ctx)
+		}()
+	}
+	if hooks != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			hooks.loop(ctx)
+		}()
+	}
+	if shared != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			shared.loop(ctx)
+		}()
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		exports.loop(ctx)
+	}()
+	if online && !cfg.PubSub.Disabled {
+		watcher := newTimeLockWatcher(ipfs, node.Identity)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			watcher.loop(ctx)
+		}()
+	}
+	if tracker := currentPopularity(); tracker != nil && online {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			tracker.loop(ctx, ipfs)
+		}()
+	}
+	if keySource != nil && keySource.dynamic() && !cfg.Light {
+		watcher := &swarmKeyWatcher{
+			source:   keySource,
+			interval: cfg.SwarmKeyRefresh,
+			rotate:   s.rotateSwarmKey,
+		}
+		if watcher.interval == 0 {
+			watcher.interval = defaultSwarmKeyRefresh
+		}
+		if watcher.current, err = readSwarmKey(cfg.repoPath()); err != nil {
+			log.Warn("ethoFS - unable to read swarm key", "error", err)
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			watcher.loop(ctx)
+		}()
+	}
+	return nil
+}
+
+// resetNodeState drops the swarm allowlist, denylist and provider hints of a
+// node that stopped or failed to start.
+func resetNodeState() {
+	setAllowlist(nil)
+	setDenylist(nil)
+	setProviderHints(nil)
+}
+
+// Stop implements node.Lifecycle, closing the swarm connections and the repo
+// of the IPFS node and waiting for the block processing to terminate.
+func (s *EthofsService) Stop() error {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	// Abort a startup still in progress before tearing the node down
+	s.lock.Lock()
+	startup, health := s.startup, s.health
+	s.startup, s.health = nil, nil
+	s.lock.Unlock()
+
+	if health != nil {
+		health.stop()
+	}
+	if startup != nil {
+		startup.cancel()
+		<-startup.done
+	}
+	// Detach the running services under the lock and tear them down outside
+	// of it, keeping the status reports responsive
+	s.lock.Lock()
+	s.status = StartupStatus{State: StartupStopped}
+	setInstanceStatus(s.status)
+
+	node, fetches, admin, redir, plugins, cancel := s.node, s.fetches, s.admin, s.redir, s.plugins, s.cancel
+	s.plugins, s.shared, s.credits, s.hooks, s.proofs, s.exports = nil, nil, nil, nil, nil, nil
+	s.ipfs, s.node, s.storage, s.reprov, s.fetches, s.denied, s.verify, s.admin, s.redir, s.cancel = nil, nil, nil, nil, nil, nil, nil, nil, nil, nil
+	s.lock.Unlock()
+
+	if node == nil {
+		return nil
+	}
+	setInstance(nil)
+	stopPlugins(plugins)
+	cancel()
+	s.wg.Wait()
+	setChainBackend(nil)
+	resetNodeState()
+	fetches.close()
+	history.detach()
+	pinExpiries.detach()
+	ownedPins.detach()
+	localPins.detach()
+	sharedFolders.detach()
+	treeExports.detach()
+	timeLocks.detach()
+
+	// Closing the node tears down the libp2p host and flushes and unlocks
+	// the repo
+	err := node.Close()
+	ethClient.Close()
+
+	if admin != nil {
+		admin.stop()
+	}
+	if redir != nil {
+		redir.stop()
+	}
+	log.Info("ethoFS node stopped")
+	return err
+}
+
+// AddAuthProvider adds a custom authentication provider to the admin endpoint,
+// tried after the configured ones. It takes effect on the next start.
+func (s *EthofsService) AddAuthProvider(provider AuthProvider) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.auth = append(s.auth, provider)
+}
+
+// API returns the core API of the running node, or nil if it is stopped.
+func (s *EthofsService) API() icore.CoreAPI {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.ipfs
+}
+
+// repoStorage returns the storage manager of the running node, or nil if it
+// is stopped.
+func (s *EthofsService) repoStorage() *storageManager {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.storage
+}
+
+// fetchSessions returns the bitswap sessions shared by related reads of the
+// running node, or nil if it is stopped.
+func (s *EthofsService) fetchSessions() *sessionCache {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.fetches
+}
+
+// peerDenylist returns the peer denylist of the running node, or nil if it is
+// stopped.
+func (s *EthofsService) peerDenylist() *peerDenylist {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.denied
+}
+
+// availabilityVerifier returns the hosting verifier of the running node, or
+// nil if it is stopped or verification is disabled.
+func (s *EthofsService) availabilityVerifier() *availabilityVerifier {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.verify
+}
+
+// Node returns the running IPFS node, or nil if it is stopped.
+func (s *EthofsService) Node() *ipfscore.IpfsNode {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.node
+}
@@ -0,0 +1,131 @@
+package ethofs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/node"
+)
+
+// newLifecycleService creates the service of a protocol stack on a fresh
+// repo of the test profile, with the config adjusted by configure if given.
+// The returned function stops the service and drops the repo.
+func newLifecycleService(t *testing.T, configure func(*Config)) (*EthofsService, func()) {
+	dir, err := ioutil.TempDir("", "ethofs-lifecycle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig
+	cfg.Profile = "test"
+	cfg.RepoPath = filepath.Join(dir, "ethofs")
+	cfg.Clock.Disabled = true
+	cfg.StorageMax = "1GB"
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	if err := InitializeRepo(&cfg); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed to initialize repo: %v", err)
+	}
+	stack, err := node.New(&node.Config{DataDir: filepath.Join(dir, "geth")})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	s, err := New(stack, &cfg)
+	if err != nil {
+		stack.Close()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() {
+		s.Stop()
+		stack.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// waitStarted waits for the supervised startup to bring the node up.
+func waitStarted(t *testing.T, s *EthofsService) {
+	for deadline := time.Now().Add(time.Minute); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		status := s.StartupStatus()
+		switch status.State {
+		case StartupRunning:
+			return
+		case StartupFailed:
+			t.Fatalf("node startup failed: %s", status.Error)
+		}
+		if status.Error != "" {
+			t.Fatalf("node startup attempt %d failed: %s", status.Attempts, status.Error)
+		}
+	}
+	t.Fatal("node startup timed out")
+}
+
+func TestServiceLifecycle(t *testing.T) {
+	s, stop := newLifecycleService(t, nil)
+	defer stop()
+
+	for run := 0; run < 2; run++ {
+		if err := s.Start(); err != nil {
+			t.Fatalf("run %d: failed to start: %v", run, err)
+		}
+		if err := s.Start(); err != errServiceRunning {
+			t.Errorf("run %d: repeated start: have %v, want %v", run, err, errServiceRunning)
+		}
+		waitStarted(t, s)
+
+		// The published node comes with all of its services assigned
+		inst, err := Instance()
+		if err != nil {
+			t.Fatalf("run %d: node not published: %v", run, err)
+		}
+		if inst.Node != s.Node() || s.treeExporter() == nil || s.sharedFolderSync() == nil {
+			t.Errorf("run %d: published node without its services", run)
+		}
+		if err := s.Stop(); err != nil {
+			t.Fatalf("run %d: failed to stop: %v", run, err)
+		}
+		if _, err := Instance(); err == nil {
+			t.Errorf("run %d: stopped node still published", run)
+		}
+		if s.Node() != nil || s.treeExporter() != nil || currentDenylist() != nil {
+			t.Errorf("run %d: stopped node left services behind", run)
+		}
+		if status := s.StartupStatus(); status.State != StartupStopped {
+			t.Errorf("run %d: stopped status mismatch: have %v, want %v", run, status.State, StartupStopped)
+		}
+	}
+	// Stopping a stopped service is a no-op
+	if err := s.Stop(); err != nil {
+		t.Errorf("repeated stop: %v", err)
+	}
+}
+
+func TestServiceStartFailure(t *testing.T) {
+	s, stop := newLifecycleService(t, func(cfg *Config) {
+		cfg.Admin.ListenAddr = "256.0.0.1:0"
+		cfg.Startup.Retries = 0
+	})
+	defer stop()
+
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	for deadline := time.Now().Add(time.Minute); s.StartupStatus().State != StartupFailed; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("startup did not fail: %+v", s.StartupStatus())
+		}
+	}
+	// A failed startup publishes nothing and leaves no node state behind
+	if _, err := Instance(); err == nil {
+		t.Error("failed node published")
+	}
+	if s.Node() != nil || currentDenylist() != nil || currentAllowlist() != nil || currentProviderHints() != nil {
+		t.Error("failed startup left node state behind")
+	}
+}
@@ -0,0 +1,142 @@
+package ethofs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+
+	lru "github.com/hashicorp/golang-lru"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	gopath "github.com/ipfs/go-path"
+	"github.com/ipfs/go-path/resolver"
+	unixfile "github.com/ipfs/go-unixfs/file"
+	uio "github.com/ipfs/go-unixfs/io"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	// sessionIdleTimeout is how long a fetch session outlives the last read
+	// below its root.
+	sessionIdleTimeout = time.Minute
+
+	// maxFetchSessions bounds the roots with a fetch session, evicting the
+	// least recently used one.
+	maxFetchSessions = 128
+)
+
+var (
+	sessionNewMeter    = metrics.NewRegisteredMeter("ethofs/session/new", nil)
+	sessionReusedMeter = metrics.NewRegisteredMeter("ethofs/session/reused", nil)
+)
+
+// fetchSession is a bitswap session shared by the reads below a root, so the
+// providers found for the first file are asked for the next ones right away.
+// A session dropped from the cache is only cancelled once the last read using
+// it is done.
+type fetchSession struct {
+	dag      ipld.DAGService
+	resolver *resolver.Resolver
+	cancel   context.CancelFunc
+	lastUse  time.Time
+
+	refs    int  // Reads currently using the session
+	evicted bool // Dropped from the cache, cancelled with the last reference
+}
+
+// sessionCache hands out the fetch sessions of recently read roots.
+type sessionCache struct {
+	node *core.IpfsNode
+
+	lock     sync.Mutex
+	sessions *lru.Cache // root -> *fetchSession
+}
+
+func newSessionCache(node *core.IpfsNode) (*sessionCache, error) {
+	// Evictions run with the cache lock held
+	sessions, err := lru.NewWithEvict(maxFetchSessions, func(_, value interface{}) {
+		ses := value.(*fetchSession)
+		if ses.evicted = true; ses.refs == 0 {
+			ses.cancel()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sessionCache{node: node, sessions: sessions}, nil
+}
+
+// session returns the fetch session of the root, starting a new one if there
+// is none or it was idle for too long. The session has to be released once
+// the read is done.
+func (c *sessionCache) session(root cid.Cid) *fetchSession {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	if cached, ok := c.sessions.Get(root); ok {
+		ses := cached.(*fetchSession)
+		if now.Sub(ses.lastUse) < sessionIdleTimeout {
+			ses.lastUse = now
+			ses.refs++
+			sessionReusedMeter.Mark(1)
+			return ses
+		}
+		c.sessions.Remove(root)
+	}
+	// The session lives on after the read, bound only by the node
+	ctx, cancel := context.WithCancel(c.node.Context())
+	dag := merkledag.NewReadOnlyDagService(merkledag.NewSession(ctx, c.node.DAG))
+	ses := &fetchSession{
+		dag:      dag,
+		resolver: &resolver.Resolver{DAG: dag, ResolveOnce: uio.ResolveUnixfsOnce},
+		cancel:   cancel,
+		lastUse:  now,
+		refs:     1,
+	}
+	c.sessions.Add(root, ses)
+	sessionNewMeter.Mark(1)
+	return ses
+}
+
+// release drops a reference to the session, cancelling it if it was the last
+// one of an evicted session.
+func (c *sessionCache) release(ses *fetchSession) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ses.refs--
+	ses.lastUse = time.Now()
+	if ses.refs == 0 && ses.evicted {
+		ses.cancel()
+	}
+}
+
+// readFile reads the file at the /ipfs/ path below root through the fetch
+// session of the root, failing if it is larger than max.
+func (c *sessionCache) readFile(ctx context.Context, root cid.Cid, p path.Path, max int) ([]byte, error) {
+	ses := c.session(root)
+	defer c.release(ses)
+
+	nd, err := ses.resolver.ResolvePath(ctx, gopath.Path(p.String()))
+	if err != nil {
+		return nil, err
+	}
+	file, err := unixfile.NewUnixfsFile(ctx, ses.dag, nd)
+	if err != nil {
+		return nil, err
+	}
+	return readFileNode(ctx, file, p, max)
+}
+
+// close ends all fetch sessions, the ones in use once their reads are done.
+func (c *sessionCache) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.sessions.Purge()
+}
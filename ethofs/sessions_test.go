@@ -0,0 +1,39 @@
+package ethofs
+
+import (
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+)
+
+func TestSessionRelease(t *testing.T) {
+	c, err := newSessionCache(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cancelled int
+	root := blocks.NewBlock([]byte("root")).Cid()
+	c.sessions.Add(root, &fetchSession{cancel: func() { cancelled++ }, lastUse: time.Now()})
+
+	// Sessions in use outlive their eviction until the last read is done
+	first, second := c.session(root), c.session(root)
+	c.close()
+	if cancelled != 0 {
+		t.Fatal("session in use cancelled on eviction")
+	}
+	c.release(first)
+	if cancelled != 0 {
+		t.Fatal("session cancelled before the last release")
+	}
+	c.release(second)
+	if cancelled != 1 {
+		t.Errorf("released session cancellations mismatch: have %d, want 1", cancelled)
+	}
+	// Idle sessions are cancelled on eviction right away
+	c.sessions.Add(root, &fetchSession{cancel: func() { cancelled++ }, lastUse: time.Now()})
+	c.close()
+	if cancelled != 2 {
+		t.Errorf("idle session cancellations mismatch: have %d, want 2", cancelled)
+	}
+}
@@ -0,0 +1,1156 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	files "github.com/ipfs/go-ipfs-files"
+	merkledag "github.com/ipfs/go-merkledag"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	// sharedIndexVersion is the format version of the shared folder index.
+	sharedIndexVersion = 2
+
+	// sharedFolderInterval is how often the IPNS names of the shared folders
+	// are resolved, catching up on announcements missed while offline.
+	sharedFolderInterval = 10 * time.Minute
+
+	// sharedFolderTimeout bounds the sync of a single folder root.
+	sharedFolderTimeout = 2 * time.Minute
+)
+
+var (
+	errUnknownSharedFolder = errors.New("unknown shared folder")
+	errNotSharedFolder     = errors.New("not a shared folder root")
+	errSharedFolderPath    = errors.New("shared folder paths have to name a file")
+	errSharedFileNotFound  = errors.New("file not found in shared folder")
+	errNotSharedMember     = errors.New("shared folder root not signed by a member")
+)
+
+// sharedFolderPrefix is the datastore namespace of the joined shared folders.
+var sharedFolderPrefix = datastore.NewKey("/ethofs/shared")
+
+// sharedIndex is the content of a shared folder, encrypted with the folder key
+// in the root document its IPNS name points at. Removed files stay listed as
+// tombstones so the removal wins the merge against older copies.
+type sharedIndex struct {
+	Version int                    `json:"version"`
+	Name    string                 `json:"name"`
+	Seq     uint64                 `json:"seq"`
+	Key     []byte                 `json:"key"` // IPNS private key, members publish updates
+	Files   map[string]*sharedFile `json:"files"`
+}
+
+// sharedRoot is the plaintext of a root document: the index, signed by the
+// member that published it. Members sign with a key of their node, granted by
+// their account when creating or joining the folder, so that publishing does
+// not need the account unlocked.
+type sharedRoot struct {
+	Index     json.RawMessage `json:"index"`
+	Member    common.Address  `json:"member"`    // Account of the publishing member
+	Signer    common.Address  `json:"signer"`    // Node key granted by the member
+	Grant     []byte          `json:"grant"`     // Signature of the member over the signer
+	Signature []byte          `json:"signature"` // Signature of the signer over the index
+}
+
+// sharedGrantHash is the hash a member account signs to let a node key publish
+// the roots of the folder.
+func sharedGrantHash(id string, signer common.Address) []byte {
+	return crypto.Keccak256([]byte("ethoFS shared folder member"), []byte(id), signer.Bytes())
+}
+
+// signedBy reports whether the signature of the hash is made by the address.
+func signedBy(hash, sig []byte, addr common.Address) bool {
+	pub, err := crypto.SigToPub(hash, sig)
+	return err == nil && crypto.PubkeyToAddress(*pub) == addr
+}
+
+// verify checks that the index is signed by a node key granted by one of the
+// members.
+func (root *sharedRoot) verify(id string, members []envelopeRecipient) error {
+	for _, member := range members {
+		if member.Address != root.Member {
+			continue
+		}
+		if !signedBy(sharedGrantHash(id, root.Signer), root.Grant, root.Member) ||
+			!signedBy(crypto.Keccak256(root.Index), root.Signature, root.Signer) {
+			return errNotSharedMember
+		}
+		return nil
+	}
+	return errNotSharedMember
+}
+
+// sharedFile is an entry of the shared folder index.
+type sharedFile struct {
+	Cid      string `json:"cid,omitempty"` // Encrypted content, empty for removed files
+	Size     int64  `json:"size"`          // Plaintext size
+	Modified int64  `json:"modified"`      // Unix time of the change in nanoseconds
+	Deleted  bool   `json:"deleted,omitempty"`
+}
+
+// newer reports whether the entry replaces the other one in a merge: the later
+// change wins, ties are broken by the CID to converge on all members.
+func (f *sharedFile) newer(other *sharedFile) bool {
+	if other == nil {
+		return true
+	}
+	if f.Modified != other.Modified {
+		return f.Modified > other.Modified
+	}
+	return f.Cid > other.Cid
+}
+
+// mergeSharedIndex merges the remote index into the local one, keeping the
+// latest change of every path. It reports whether the local index held changes
+// missing from the remote one, which have to be published again.
+func mergeSharedIndex(local, remote *sharedIndex) (*sharedIndex, bool) {
+	merged := &sharedIndex{
+		Version: sharedIndexVersion,
+		Name:    remote.Name,
+		Seq:     remote.Seq,
+		Key:     remote.Key,
+		Files:   make(map[string]*sharedFile, len(remote.Files)),
+	}
+	for p, f := range remote.Files {
+		merged.Files[p] = f
+	}
+	if local == nil {
+		return merged, false
+	}
+	if local.Seq > merged.Seq {
+		merged.Seq = local.Seq
+	}
+	var ahead bool
+	for p, f := range local.Files {
+		if f.newer(merged.Files[p]) {
+			merged.Files[p] = f
+			ahead = true
+		}
+	}
+	return merged, ahead
+}
+
+// sharedFolder is the local state of a joined shared folder.
+type sharedFolder struct {
+	ID         string              `json:"id"`      // IPNS name of the folder
+	KeyName    string              `json:"keyName"` // Keystore name of the IPNS key
+	FolderKey  []byte              `json:"folderKey"`
+	Recipients []envelopeRecipient `json:"recipients"` // Folder key wrapped to the members
+	Root       string              `json:"root"`       // Latest root document
+	Index      *sharedIndex        `json:"index"`
+	Member     common.Address      `json:"member"`     // Account the node takes part as
+	SigningKey []byte              `json:"signingKey"` // Node key signing the published roots
+	Grant      []byte              `json:"grant"`      // Signature of the member over the signing key
+}
+
+// grantSigner generates the node key signing the roots the node publishes for
+// the member account.
+func (f *sharedFolder) grantSigner(account *ecdsa.PrivateKey) error {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	grant, err := crypto.Sign(sharedGrantHash(f.ID, crypto.PubkeyToAddress(key.PublicKey)), account)
+	if err != nil {
+		return err
+	}
+	f.Member = crypto.PubkeyToAddress(account.PublicKey)
+	f.SigningKey = crypto.FromECDSA(key)
+	f.Grant = grant
+	return nil
+}
+
+// SharedFolder describes a joined shared folder.
+type SharedFolder struct {
+	ID      string           `json:"id"`
+	Name    string           `json:"name"`
+	Root    string           `json:"root"`
+	Seq     uint64           `json:"seq"`
+	Files   int              `json:"files"`
+	Members []common.Address `json:"members"`
+}
+
+// SharedFile is a file of a shared folder.
+type SharedFile struct {
+	Path     string `json:"path"`
+	Cid      string `json:"cid"`
+	Size     int64  `json:"size"`
+	Modified uint64 `json:"modified"` // Unix time of the last change
+}
+
+func (f *sharedFolder) info() *SharedFolder {
+	info := &SharedFolder{ID: f.ID, Name: f.Index.Name, Root: f.Root, Seq: f.Index.Seq}
+	for _, file := range f.Index.Files {
+		if !file.Deleted {
+			info.Files++
+		}
+	}
+	for _, recipient := range f.Recipients {
+		info.Members = append(info.Members, recipient.Address)
+	}
+	return info
+}
+
+// topic returns the pubsub topic the new roots of the folder are announced on.
+func (f *sharedFolder) topic() string {
+	return "/ethofs/shared/" + f.ID
+}
+
+// sharedFolderStore keeps the state of the joined shared folders in the repo
+// datastore. The folder keys are stored in the clear, like the IPNS keys of the
+// keystore, and are protected by the repo permissions only.
+type sharedFolderStore struct {
+	lock sync.Mutex
+	ds   datastore.Datastore
+}
+
+// sharedFolders is shared by the RPC API and the background sync.
+var sharedFolders = new(sharedFolderStore)
+
+func sharedFolderKey(id string) datastore.Key {
+	return sharedFolderPrefix.ChildString(id)
+}
+
+// attach switches the store to the datastore of the running node.
+func (st *sharedFolderStore) attach(ds datastore.Datastore) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	st.ds = ds
+}
+
+// detach releases the datastore of the stopped node.
+func (st *sharedFolderStore) detach() {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	st.ds = nil
+}
+
+// get returns the state of the folder.
+func (st *sharedFolderStore) get(id string) (*sharedFolder, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if st.ds == nil {
+		return nil, errNodeNotRunning
+	}
+	data, err := st.ds.Get(sharedFolderKey(id))
+	if err == datastore.ErrNotFound {
+		return nil, errUnknownSharedFolder
+	}
+	if err != nil {
+		return nil, err
+	}
+	folder := new(sharedFolder)
+	if err := json.Unmarshal(data, folder); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// put stores the state of the folder.
+func (st *sharedFolderStore) put(folder *sharedFolder) error {
+	data, err := json.Marshal(folder)
+	if err != nil {
+		return err
+	}
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if st.ds == nil {
+		return errNodeNotRunning
+	}
+	return st.ds.Put(sharedFolderKey(folder.ID), data)
+}
+
+// remove drops the state of the folder.
+func (st *sharedFolderStore) remove(id string) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if st.ds == nil {
+		return errNodeNotRunning
+	}
+	return st.ds.Delete(sharedFolderKey(id))
+}
+
+// list returns the joined folders.
+func (st *sharedFolderStore) list() ([]*sharedFolder, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if st.ds == nil {
+		return nil, errNodeNotRunning
+	}
+	results, err := st.ds.Query(query.Query{Prefix: sharedFolderPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var folders []*sharedFolder
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		folder := new(sharedFolder)
+		if err := json.Unmarshal(result.Value, folder); err != nil {
+			log.Debug("ethoFS - dropping corrupt shared folder", "key", result.Key, "error", err)
+			continue
+		}
+		folders = append(folders, folder)
+	}
+	return folders, nil
+}
+
+// sealSharedIndex signs the index and encrypts it into a root document of the
+// folder.
+func sealSharedIndex(folder *sharedFolder, index *sharedIndex) ([]byte, error) {
+	if len(folder.SigningKey) == 0 {
+		return nil, errNotSharedMember
+	}
+	key, err := crypto.ToECDSA(folder.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := json.Marshal(index)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := crypto.Sign(crypto.Keccak256(rendered), key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(&sharedRoot{
+		Index:     rendered,
+		Member:    folder.Member,
+		Signer:    crypto.PubkeyToAddress(key.PublicKey),
+		Grant:     folder.Grant,
+		Signature: sig,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sealed := new(bytes.Buffer)
+	if err := sealEnvelope(sealed, bytes.NewReader(data), folder.FolderKey, folder.Recipients); err != nil {
+		return nil, err
+	}
+	return sealed.Bytes(), nil
+}
+
+// openSharedIndex decrypts a root document of the folder with the folder key,
+// accepting only indexes signed for one of the members.
+func openSharedIndex(r io.Reader, id string, folderKey []byte, members []envelopeRecipient) (*sharedIndex, error) {
+	plain, err := openEnvelopeWithKey(r, folderKey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readLimited(plain)
+	if err != nil {
+		return nil, err
+	}
+	root := new(sharedRoot)
+	if err := json.Unmarshal(data, root); err != nil {
+		return nil, errNotSharedFolder
+	}
+	if err := root.verify(id, members); err != nil {
+		return nil, err
+	}
+	index := new(sharedIndex)
+	if err := json.Unmarshal(root.Index, index); err != nil || index.Version != sharedIndexVersion {
+		return nil, errNotSharedFolder
+	}
+	if index.Files == nil {
+		index.Files = make(map[string]*sharedFile)
+	}
+	return index, nil
+}
+
+// readLimited reads the content up to the maximum size returned over RPC.
+func readLimited(r io.Reader) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if _, err := io.Copy(buf, io.LimitReader(r, int64(maxGetSize)+1)); err != nil {
+		return nil, err
+	}
+	if buf.Len() > maxGetSize {
+		return nil, fmt.Errorf("%w of %d bytes", errFileTooLarge, maxGetSize)
+	}
+	return buf.Bytes(), nil
+}
+
+// cleanSharedPath validates the path of a file of a shared folder.
+func cleanSharedPath(p string) (string, error) {
+	cleaned, err := cleanFilesPath(p)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(cleaned, "/") {
+		return "", errSharedFolderPath
+	}
+	return cleaned, nil
+}
+
+// sharedSync keeps the joined folders of the running node in sync with the
+// other members, following the announcements of new roots on pubsub and
+// resolving the IPNS names of the folders periodically. Changes of a folder
+// are serialized by the lock.
+type sharedSync struct {
+	service *EthofsService
+	ipfs    icore.CoreAPI
+	self    peer.ID
+	ctx     context.Context
+	wg      *sync.WaitGroup
+	lock    sync.Mutex
+
+	followLock sync.Mutex
+	follow     map[string]context.CancelFunc
+}
+
+func newSharedSync(ctx context.Context, s *EthofsService, ipfs icore.CoreAPI, self peer.ID) *sharedSync {
+	return &sharedSync{
+		service: s,
+		ipfs:    ipfs,
+		self:    self,
+		ctx:     ctx,
+		wg:      &s.wg,
+		follow:  make(map[string]context.CancelFunc),
+	}
+}
+
+// loop follows the joined folders and resolves their names every interval
+// until the context is cancelled.
+func (ss *sharedSync) loop(ctx context.Context) {
+	folders, err := sharedFolders.list()
+	if err != nil {
+		log.Warn("ethoFS - unable to list shared folders", "error", err)
+		return
+	}
+	for _, folder := range folders {
+		ss.subscribe(folder)
+	}
+	ticker := time.NewTicker(sharedFolderInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			folders, err := sharedFolders.list()
+			if err != nil {
+				continue
+			}
+			for _, folder := range folders {
+				if err := ss.resolve(ctx, folder.ID); err != nil {
+					log.Debug("ethoFS - unable to sync shared folder", "id", folder.ID, "error", err)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// subscribe follows the root announcements of the folder on pubsub.
+func (ss *sharedSync) subscribe(folder *sharedFolder) {
+	if ss.service.config.PubSub.Disabled {
+		return
+	}
+	ss.followLock.Lock()
+	defer ss.followLock.Unlock()
+
+	if _, ok := ss.follow[folder.ID]; ok {
+		return
+	}
+	// Counted before subscribing, so that stopping the node waits for the
+	// subscription to be closed
+	ss.wg.Add(1)
+	ctx, cancel := context.WithCancel(ss.ctx)
+	sub, err := ss.ipfs.PubSub().Subscribe(ctx, folder.topic())
+	if err != nil {
+		cancel()
+		ss.wg.Done()
+		log.Warn("ethoFS - unable to follow shared folder", "id", folder.ID, "error", err)
+		return
+	}
+	ss.follow[folder.ID] = cancel
+
+	id := folder.ID
+	go func() {
+		defer ss.wg.Done()
+		defer sub.Close()
+
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				return
+			}
+			if msg.From() == ss.self {
+				continue
+			}
+			root, err := cid.Parse(string(msg.Data()))
+			if err != nil {
+				continue
+			}
+			if err := ss.sync(ctx, id, root); err != nil && ctx.Err() == nil {
+				log.Debug("ethoFS - unable to sync shared folder", "id", id, "root", root, "error", err)
+			}
+		}
+	}()
+}
+
+// unsubscribe stops following the folder.
+func (ss *sharedSync) unsubscribe(id string) {
+	ss.followLock.Lock()
+	defer ss.followLock.Unlock()
+
+	if cancel, ok := ss.follow[id]; ok {
+		cancel()
+		delete(ss.follow, id)
+	}
+}
+
+// resolve syncs the folder with the root its IPNS name points at.
+func (ss *sharedSync) resolve(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, sharedFolderTimeout)
+	defer cancel()
+
+	resolved, err := ss.ipfs.Name().Resolve(ctx, "/ipns/"+id, options.Name.Cache(false))
+	if err != nil {
+		return err
+	}
+	root, err := ss.ipfs.ResolvePath(ctx, resolved)
+	if err != nil {
+		return err
+	}
+	return ss.sync(ctx, id, root.Cid())
+}
+
+// sync merges the index of a root announced by another member into the
+// folder, pinning the files added and unpinning the ones replaced. Local
+// changes missing from the root are published again. The root and its files
+// are retrieved before taking the lock, so slow roots do not hold up the
+// changes of the folders.
+func (ss *sharedSync) sync(ctx context.Context, id string, root cid.Cid) error {
+	folder, err := sharedFolders.get(id)
+	if err != nil {
+		return err
+	}
+	if folder.Root == root.String() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, sharedFolderTimeout)
+	defer cancel()
+
+	remote, err := ss.fetchIndex(ctx, root, folder)
+	if err != nil {
+		return err
+	}
+	ss.prefetch(ctx, remote)
+
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	// The folder may have changed while fetching
+	if folder, err = sharedFolders.get(id); err != nil {
+		return err
+	}
+	if folder.Root == root.String() {
+		return nil
+	}
+	merged, ahead := mergeSharedIndex(folder.Index, remote)
+	if err := ss.apply(ctx, folder, merged); err != nil {
+		return err
+	}
+	if ahead {
+		merged.Seq++
+		return ss.publish(ctx, folder, merged)
+	}
+	if err := pinRecursive(ctx, ss.ipfs, root); err != nil {
+		return err
+	}
+	ownPin(root, pinOwnerShared)
+	ss.unpin(folder.Root)
+	folder.Root, folder.Index = root.String(), merged
+	return sharedFolders.put(folder)
+}
+
+// fetchIndex retrieves, decrypts and verifies the index of a root document of
+// the folder.
+func (ss *sharedSync) fetchIndex(ctx context.Context, root cid.Cid, folder *sharedFolder) (*sharedIndex, error) {
+	nd, err := ss.ipfs.Unixfs().Get(ctx, path.IpfsPath(root))
+	if err != nil {
+		return nil, err
+	}
+	file := files.ToFile(nd)
+	if file == nil {
+		nd.Close()
+		return nil, errNotSharedFolder
+	}
+	defer file.Close()
+
+	return openSharedIndex(newLimitedReader(ctx, file), folder.ID, folder.FolderKey, folder.Recipients)
+}
+
+// prefetch retrieves the files of the index without pinning them, so that the
+// pins made under the lock find them locally. Failures are left to the pins.
+func (ss *sharedSync) prefetch(ctx context.Context, index *sharedIndex) {
+	opts := FetchOptions{}.withDefaults(&ethofsConfig.Fetch)
+	for _, f := range index.Files {
+		if f.Deleted {
+			continue
+		}
+		c, err := cid.Parse(f.Cid)
+		if err != nil {
+			continue
+		}
+		getter := currentDAGWorkers().getter(merkledag.NewSession(ctx, ss.ipfs.Dag()))
+		if _, err := fetchDAG(ctx, getter, c, opts); err != nil {
+			log.Debug("ethoFS - unable to prefetch shared folder file", "cid", c, "error", err)
+			return
+		}
+	}
+}
+
+// apply pins the files of the new index and unpins the ones of the old index
+// it no longer references.
+func (ss *sharedSync) apply(ctx context.Context, folder *sharedFolder, index *sharedIndex) error {
+	keep := make(map[string]bool, len(index.Files))
+	for _, f := range index.Files {
+		if f.Deleted {
+			continue
+		}
+		keep[f.Cid] = true
+
+		c, err := cid.Parse(f.Cid)
+		if err != nil {
+			return err
+		}
+		if err := pinRecursive(ctx, ss.ipfs, c); err != nil {
+			return err
+		}
+		ownPin(c, pinOwnerShared)
+	}
+	if folder.Index == nil {
+		return nil
+	}
+	for _, f := range folder.Index.Files {
+		if !f.Deleted && !keep[f.Cid] {
+			ss.unpin(f.Cid)
+		}
+	}
+	return nil
+}
+
+// publish stores the index in a new root document, announces it to the other
+// members and points the IPNS name of the folder at it.
+func (ss *sharedSync) publish(ctx context.Context, folder *sharedFolder, index *sharedIndex) error {
+	if err := checkSigningClock(); err != nil {
+		return err
+	}
+	sealed, err := sealSharedIndex(folder, index)
+	if err != nil {
+		return err
+	}
+	root, err := ss.service.Add(ctx, bytes.NewReader(sealed), AddOptions{Pin: true}, nil)
+	if err != nil {
+		return err
+	}
+	ownPin(root, pinOwnerShared)
+	previous := folder.Root
+	folder.Root, folder.Index = root.String(), index
+	if err := sharedFolders.put(folder); err != nil {
+		return err
+	}
+	if previous != folder.Root {
+		ss.unpin(previous)
+	}
+	if !ss.service.config.PubSub.Disabled {
+		if err := ss.ipfs.PubSub().Publish(ctx, folder.topic(), []byte(folder.Root)); err != nil {
+			log.Debug("ethoFS - unable to announce shared folder root", "id", folder.ID, "error", err)
+		}
+	}
+	_, err = ss.ipfs.Name().Publish(ctx, path.IpfsPath(root),
+		options.Name.Key(folder.KeyName),
+		options.Name.ValidTime(ipnsRecordLifetime),
+	)
+	return err
+}
+
+// unpin drops the pin of a CID no longer referenced by the folder.
+func (ss *sharedSync) unpin(c string) {
+	if c == "" {
+		return
+	}
+	if _, err := pinRemove(ss.ipfs, c); err != nil {
+		log.Debug("ethoFS - unable to unpin shared folder content", "cid", c, "error", err)
+	}
+}
+
+// sharedFolderSync returns the shared folder sync of the running node, or nil
+// if it is stopped or offline.
+func (s *EthofsService) sharedFolderSync() *sharedSync {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.shared
+}
+
+// CreateSharedFolder creates an empty folder shared end-to-end encrypted with
+// the owners of the recipient public keys and the creator account of the key.
+// The folder key is wrapped to each member, so the members are fixed at
+// creation. It returns the IPNS name identifying the folder.
+func (s *EthofsService) CreateSharedFolder(ctx context.Context, name string, recipients []*ecdsa.PublicKey, key *ecdsa.PrivateKey) (*SharedFolder, error) {
+	ss := s.sharedFolderSync()
+	if ss == nil {
+		return nil, errNodeNotRunning
+	}
+	if len(recipients) == 0 {
+		return nil, errNoRecipients
+	}
+	creator := crypto.PubkeyToAddress(key.PublicKey)
+	member := false
+	for _, pub := range recipients {
+		if crypto.PubkeyToAddress(*pub) == creator {
+			member = true
+			break
+		}
+	}
+	if !member {
+		recipients = append(recipients, &key.PublicKey)
+	}
+	folderKey := make([]byte, 32)
+	if _, err := rand.Read(folderKey); err != nil {
+		return nil, err
+	}
+	wrapped, err := wrapDataKey(folderKey, recipients)
+	if err != nil {
+		return nil, err
+	}
+	priv, _, err := ci.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ipnsKey, err := ci.MarshalPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	folder := &sharedFolder{
+		ID:         id.Pretty(),
+		KeyName:    "shared-" + id.Pretty(),
+		FolderKey:  folderKey,
+		Recipients: wrapped,
+	}
+	if err := folder.grantSigner(key); err != nil {
+		return nil, err
+	}
+	if _, err := s.ImportKey(folder.KeyName, ipnsKey); err != nil {
+		return nil, err
+	}
+	index := &sharedIndex{Version: sharedIndexVersion, Name: name, Key: ipnsKey, Files: make(map[string]*sharedFile)}
+
+	ss.lock.Lock()
+	err = ss.publish(ctx, folder, index)
+	ss.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	ss.subscribe(folder)
+	return folder.info(), nil
+}
+
+// JoinSharedFolder joins the shared folder of the IPNS name, unwrapping the
+// folder key with the private key of one of its members.
+func (s *EthofsService) JoinSharedFolder(ctx context.Context, id string, key *ecdsa.PrivateKey) (*SharedFolder, error) {
+	ss := s.sharedFolderSync()
+	if ss == nil {
+		return nil, errNodeNotRunning
+	}
+	if _, err := sharedFolders.get(id); err == nil {
+		return nil, fmt.Errorf("shared folder %s already joined", id)
+	}
+	ctx, cancel := context.WithTimeout(ctx, sharedFolderTimeout)
+	defer cancel()
+
+	resolved, err := ss.ipfs.Name().Resolve(ctx, "/ipns/"+id)
+	if err != nil {
+		return nil, err
+	}
+	nd, err := ss.ipfs.Unixfs().Get(ctx, resolved)
+	if err != nil {
+		return nil, err
+	}
+	file := files.ToFile(nd)
+	if file == nil {
+		nd.Close()
+		return nil, errNotSharedFolder
+	}
+	defer file.Close()
+
+	_, _, hdr, err := readEnvelopeHeader(newLimitedReader(ctx, file))
+	if err != nil {
+		return nil, err
+	}
+	folderKey, err := unwrapDataKey(hdr, key)
+	if err != nil {
+		return nil, err
+	}
+	root, err := ss.ipfs.ResolvePath(ctx, resolved)
+	if err != nil {
+		return nil, err
+	}
+	folder := &sharedFolder{
+		ID:         id,
+		KeyName:    "shared-" + id,
+		FolderKey:  folderKey,
+		Recipients: hdr.Recipients,
+	}
+	index, err := ss.fetchIndex(ctx, root.Cid(), folder)
+	if err != nil {
+		return nil, err
+	}
+	// The index carries the IPNS key of the folder, which has to match the
+	// joined name
+	priv, err := ci.UnmarshalPrivateKey(index.Key)
+	if err != nil {
+		return nil, err
+	}
+	if owner, err := peer.IDFromPrivateKey(priv); err != nil || owner.Pretty() != id {
+		return nil, errNotSharedFolder
+	}
+	if err := folder.grantSigner(key); err != nil {
+		return nil, err
+	}
+	if _, err := s.ImportKey(folder.KeyName, index.Key); err != nil {
+		return nil, err
+	}
+	ss.lock.Lock()
+	err = ss.apply(ctx, folder, index)
+	if err == nil {
+		err = pinRecursive(ctx, ss.ipfs, root.Cid())
+	}
+	if err == nil {
+		ownPin(root.Cid(), pinOwnerShared)
+		folder.Root, folder.Index = root.Cid().String(), index
+		err = sharedFolders.put(folder)
+	}
+	ss.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	ss.subscribe(folder)
+	return folder.info(), nil
+}
+
+// SharedFolders returns the joined shared folders.
+func (s *EthofsService) SharedFolders() ([]*SharedFolder, error) {
+	folders, err := sharedFolders.list()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*SharedFolder, 0, len(folders))
+	for _, folder := range folders {
+		infos = append(infos, folder.info())
+	}
+	return infos, nil
+}
+
+// WriteSharedFile encrypts the data with the folder key and stores it at the
+// path of the shared folder, publishing the new root to the members.
+func (s *EthofsService) WriteSharedFile(ctx context.Context, id, p string, r io.Reader) (*SharedFile, error) {
+	ss := s.sharedFolderSync()
+	if ss == nil {
+		return nil, errNodeNotRunning
+	}
+	p, err := cleanSharedPath(p)
+	if err != nil {
+		return nil, err
+	}
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	folder, err := sharedFolders.get(id)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		counted = &countingReader{r: r}
+		pr, pw  = io.Pipe()
+	)
+	defer pr.Close()
+
+	go func() {
+		pw.CloseWithError(sealEnvelope(pw, counted, folder.FolderKey, nil))
+	}()
+	c, err := s.Add(ctx, pr, AddOptions{Pin: true}, nil)
+	if err != nil {
+		return nil, err
+	}
+	entry := &sharedFile{Cid: c.String(), Size: counted.n, Modified: time.Now().UnixNano()}
+	old := folder.Index.Files[p]
+
+	index := *folder.Index
+	index.Files = make(map[string]*sharedFile, len(folder.Index.Files)+1)
+	for path, f := range folder.Index.Files {
+		index.Files[path] = f
+	}
+	index.Files[p] = entry
+	index.Seq++
+
+	if err := ss.publish(ctx, folder, &index); err != nil {
+		return nil, err
+	}
+	if old != nil && !old.Deleted && old.Cid != entry.Cid {
+		ss.unpin(old.Cid)
+	}
+	return entry.info(p), nil
+}
+
+// RemoveSharedFile removes the file at the path of the shared folder.
+func (s *EthofsService) RemoveSharedFile(ctx context.Context, id, p string) error {
+	ss := s.sharedFolderSync()
+	if ss == nil {
+		return errNodeNotRunning
+	}
+	p, err := cleanSharedPath(p)
+	if err != nil {
+		return err
+	}
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	folder, err := sharedFolders.get(id)
+	if err != nil {
+		return err
+	}
+	old := folder.Index.Files[p]
+	if old == nil || old.Deleted {
+		return errSharedFileNotFound
+	}
+	index := *folder.Index
+	index.Files = make(map[string]*sharedFile, len(folder.Index.Files))
+	for path, f := range folder.Index.Files {
+		index.Files[path] = f
+	}
+	index.Files[p] = &sharedFile{Modified: time.Now().UnixNano(), Deleted: true}
+	index.Seq++
+
+	if err := ss.publish(ctx, folder, &index); err != nil {
+		return err
+	}
+	ss.unpin(old.Cid)
+	return nil
+}
+
+// ReadSharedFile returns the decrypted content of the file at the path of the
+// shared folder.
+func (s *EthofsService) ReadSharedFile(ctx context.Context, id, p string) (io.ReadCloser, error) {
+	ipfs := s.API()
+	if ipfs == nil {
+		return nil, errNodeNotRunning
+	}
+	p, err := cleanSharedPath(p)
+	if err != nil {
+		return nil, err
+	}
+	folder, err := sharedFolders.get(id)
+	if err != nil {
+		return nil, err
+	}
+	entry := folder.Index.Files[p]
+	if entry == nil || entry.Deleted {
+		return nil, errSharedFileNotFound
+	}
+	nd, err := ipfs.Unixfs().Get(ctx, parsePath(entry.Cid))
+	if err != nil {
+		return nil, err
+	}
+	file := files.ToFile(nd)
+	if file == nil {
+		nd.Close()
+		return nil, fmt.Errorf("%s is not a file", p)
+	}
+	plain, err := openEnvelopeWithKey(newLimitedReader(ctx, file), folder.FolderKey)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{plain, file}, nil
+}
+
+// ListSharedFiles returns the files of the shared folder sorted by path.
+func (s *EthofsService) ListSharedFiles(id string) ([]*SharedFile, error) {
+	folder, err := sharedFolders.get(id)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*SharedFile, 0, len(folder.Index.Files))
+	for p, f := range folder.Index.Files {
+		if !f.Deleted {
+			list = append(list, f.info(p))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list, nil
+}
+
+// LeaveSharedFolder stops syncing the shared folder, unpinning its content
+// and dropping its keys. The other members keep the folder.
+func (s *EthofsService) LeaveSharedFolder(ctx context.Context, id string) error {
+	ss := s.sharedFolderSync()
+	if ss == nil {
+		return errNodeNotRunning
+	}
+	ss.unsubscribe(id)
+
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	folder, err := sharedFolders.get(id)
+	if err != nil {
+		return err
+	}
+	for _, f := range folder.Index.Files {
+		if !f.Deleted {
+			ss.unpin(f.Cid)
+		}
+	}
+	ss.unpin(folder.Root)
+
+	if _, err := ss.ipfs.Key().Remove(ctx, folder.KeyName); err != nil {
+		log.Debug("ethoFS - unable to drop shared folder key", "id", id, "error", err)
+	}
+	return sharedFolders.remove(id)
+}
+
+func (f *sharedFile) info(p string) *SharedFile {
+	return &SharedFile{Path: p, Cid: f.Cid, Size: f.Size, Modified: uint64(f.Modified / int64(time.Second))}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// SharedFolders returns the joined shared folders.
+func (api *PublicEthofsAPI) SharedFolders() (_ []*SharedFolder, err error) {
+	defer trackCall("sharedFolders", time.Now(), &err)
+
+	return api.service.SharedFolders()
+}
+
+// SharedFolderLs lists the files of the shared folder.
+func (api *PublicEthofsAPI) SharedFolderLs(id string) (_ []*SharedFile, err error) {
+	defer trackCall("sharedFolderLs", time.Now(), &err)
+
+	return api.service.ListSharedFiles(id)
+}
+
+// CreateSharedFolder creates a folder shared end-to-end encrypted with the
+// owners of the given secp256k1 public keys and the given keystore account,
+// unlocked with the passphrase, returning it with its IPNS name.
+func (api *PrivateEthofsAPI) CreateSharedFolder(ctx context.Context, name string, recipients []hexutil.Bytes, account common.Address, passphrase string) (_ *SharedFolder, err error) {
+	defer trackCall("createSharedFolder", time.Now(), &err)
+
+	keys := make([]*ecdsa.PublicKey, 0, len(recipients))
+	for _, recipient := range recipients {
+		pub, err := parsePublicKey(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient public key %s: %v", recipient, err)
+		}
+		keys = append(keys, pub)
+	}
+	key, err := api.service.accountKey(account, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return api.service.CreateSharedFolder(ctx, name, keys, key)
+}
+
+// JoinSharedFolder joins the shared folder of the IPNS name with the key of
+// the given keystore account, unlocked with the passphrase.
+func (api *PrivateEthofsAPI) JoinSharedFolder(ctx context.Context, id string, account common.Address, passphrase string) (_ *SharedFolder, err error) {
+	defer trackCall("joinSharedFolder", time.Now(), &err)
+
+	key, err := api.service.accountKey(account, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return api.service.JoinSharedFolder(ctx, id, key)
+}
+
+// SharedFolderRead returns the decrypted content of the file at the path of
+// the shared folder.
+func (api *PrivateEthofsAPI) SharedFolderRead(ctx context.Context, id, p string) (_ hexutil.Bytes, err error) {
+	defer trackCall("sharedFolderRead", time.Now(), &err)
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	plain, err := api.service.ReadSharedFile(ctx, id, p)
+	if err != nil {
+		return nil, err
+	}
+	defer plain.Close()
+
+	return readLimited(plain)
+}
+
+// SharedFolderWrite stores the data at the path of the shared folder.
+func (api *PrivateEthofsAPI) SharedFolderWrite(ctx context.Context, id, p string, data hexutil.Bytes) (_ *SharedFile, err error) {
+	defer trackCall("sharedFolderWrite", time.Now(), &err)
+
+	return api.service.WriteSharedFile(ctx, id, p, bytes.NewReader(data))
+}
+
+// SharedFolderRemove removes the file at the path of the shared folder.
+func (api *PrivateEthofsAPI) SharedFolderRemove(ctx context.Context, id, p string) (err error) {
+	defer trackCall("sharedFolderRemove", time.Now(), &err)
+
+	return api.service.RemoveSharedFile(ctx, id, p)
+}
+
+// LeaveSharedFolder stops syncing the shared folder and drops its content.
+func (api *PrivateEthofsAPI) LeaveSharedFolder(ctx context.Context, id string) (err error) {
+	defer trackCall("leaveSharedFolder", time.Now(), &err)
+
+	return api.service.LeaveSharedFolder(ctx, id)
+}
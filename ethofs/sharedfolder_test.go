@@ -0,0 +1,126 @@
+package ethofs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestMergeSharedIndex(t *testing.T) {
+	local := &sharedIndex{Seq: 5, Files: map[string]*sharedFile{
+		"/kept":    {Cid: "a", Modified: 10},
+		"/changed": {Cid: "old", Modified: 10},
+		"/local":   {Cid: "l", Modified: 30},
+		"/removed": {Cid: "r", Modified: 10},
+	}}
+	remote := &sharedIndex{Seq: 3, Files: map[string]*sharedFile{
+		"/kept":    {Cid: "a", Modified: 10},
+		"/changed": {Cid: "new", Modified: 20},
+		"/removed": {Modified: 20, Deleted: true},
+	}}
+	merged, ahead := mergeSharedIndex(local, remote)
+	if !ahead {
+		t.Errorf("local changes not detected")
+	}
+	if merged.Seq != 5 {
+		t.Errorf("sequence mismatch: have %d, want 5", merged.Seq)
+	}
+	for p, want := range map[string]string{"/kept": "a", "/changed": "new", "/local": "l", "/removed": ""} {
+		if f := merged.Files[p]; f == nil || f.Cid != want {
+			t.Errorf("%s: merged entry mismatch: have %+v, want cid %q", p, f, want)
+		}
+	}
+	if !merged.Files["/removed"].Deleted {
+		t.Errorf("removal lost in the merge")
+	}
+	// Merging the result again converges, ties break on the CID
+	if _, ahead := mergeSharedIndex(merged, merged); ahead {
+		t.Errorf("identical indexes reported as diverged")
+	}
+	a := &sharedIndex{Files: map[string]*sharedFile{"/f": {Cid: "x", Modified: 1}}}
+	b := &sharedIndex{Files: map[string]*sharedFile{"/f": {Cid: "y", Modified: 1}}}
+	ab, _ := mergeSharedIndex(a, b)
+	ba, _ := mergeSharedIndex(b, a)
+	if ab.Files["/f"].Cid != "y" || ba.Files["/f"].Cid != "y" {
+		t.Errorf("tie broken inconsistently: %s, %s", ab.Files["/f"].Cid, ba.Files["/f"].Cid)
+	}
+}
+
+func TestSharedIndexEnvelope(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 2)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		keys[i] = key
+	}
+	folderKey := bytes.Repeat([]byte{0x42}, 32)
+	wrapped, err := wrapDataKey(folderKey, []*ecdsa.PublicKey{&keys[0].PublicKey})
+	if err != nil {
+		t.Fatalf("failed to wrap folder key: %v", err)
+	}
+	folder := &sharedFolder{ID: "folder", FolderKey: folderKey, Recipients: wrapped}
+	if err := folder.grantSigner(keys[0]); err != nil {
+		t.Fatalf("failed to grant signer: %v", err)
+	}
+	index := &sharedIndex{Version: sharedIndexVersion, Name: "docs", Seq: 7, Files: map[string]*sharedFile{
+		"/a.txt": {Cid: "a", Size: 3, Modified: 1},
+	}}
+	sealed, err := sealSharedIndex(folder, index)
+	if err != nil {
+		t.Fatalf("failed to seal index: %v", err)
+	}
+	// Members unwrap the folder key from the header of the root
+	_, _, hdr, err := readEnvelopeHeader(bytes.NewReader(sealed))
+	if err != nil {
+		t.Fatalf("failed to read header: %v", err)
+	}
+	unwrapped, err := unwrapDataKey(hdr, keys[0])
+	if err != nil || !bytes.Equal(unwrapped, folderKey) {
+		t.Fatalf("folder key mismatch: have %x, want %x (%v)", unwrapped, folderKey, err)
+	}
+	if _, err := unwrapDataKey(hdr, keys[1]); err != errNotRecipient {
+		t.Errorf("non-member error mismatch: have %v, want %v", err, errNotRecipient)
+	}
+	opened, err := openSharedIndex(bytes.NewReader(sealed), folder.ID, folderKey, wrapped)
+	if err != nil {
+		t.Fatalf("failed to open index: %v", err)
+	}
+	if opened.Name != "docs" || opened.Seq != 7 || opened.Files["/a.txt"].Cid != "a" {
+		t.Errorf("opened index mismatch: have %+v", opened)
+	}
+	if _, err := openSharedIndex(bytes.NewReader(sealed), folder.ID, bytes.Repeat([]byte{0x43}, 32), wrapped); err == nil {
+		t.Errorf("index opened with the wrong folder key")
+	}
+	// Roots of other folders and of non-members are rejected, even if sealed
+	// with the folder key
+	if _, err := openSharedIndex(bytes.NewReader(sealed), "other", folderKey, wrapped); err != errNotSharedMember {
+		t.Errorf("root of another folder: have %v, want %v", err, errNotSharedMember)
+	}
+	if err := folder.grantSigner(keys[1]); err != nil {
+		t.Fatalf("failed to grant signer: %v", err)
+	}
+	forged, err := sealSharedIndex(folder, index)
+	if err != nil {
+		t.Fatalf("failed to seal index: %v", err)
+	}
+	if _, err := openSharedIndex(bytes.NewReader(forged), folder.ID, folderKey, wrapped); err != errNotSharedMember {
+		t.Errorf("non-member root: have %v, want %v", err, errNotSharedMember)
+	}
+}
+
+func TestCleanSharedPath(t *testing.T) {
+	for p, want := range map[string]string{"/a/../b.txt": "/b.txt", "/dir/file": "/dir/file"} {
+		if have, err := cleanSharedPath(p); err != nil || have != want {
+			t.Errorf("%s: cleaned path mismatch: have %q (%v), want %q", p, have, err, want)
+		}
+	}
+	for _, p := range []string{"relative", "/", "/dir/"} {
+		if _, err := cleanSharedPath(p); err == nil {
+			t.Errorf("%s: invalid path accepted", p)
+		}
+	}
+}
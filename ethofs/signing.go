@@ -0,0 +1,369 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	lru "github.com/hashicorp/golang-lru"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/corehttp"
+)
+
+const (
+	// signatureTTL is how long the verification of a root is cached before
+	// the registry is asked again.
+	signatureTTL = 10 * time.Minute
+
+	// maxSignatureRoots bounds the roots with cached verifications, evicting
+	// the least recently used one.
+	maxSignatureRoots = 1024
+
+	// maxRegistrySignatures caps the signatures read from the registry per
+	// root.
+	maxRegistrySignatures = 16
+
+	signatureLookupTimeout = 5 * time.Second
+)
+
+// SignatureRegistryABI is the interface of the contract recording the
+// signatures of the publishers of content, listed per CID.
+const SignatureRegistryABI = "[{\"constant\":true,\"inputs\":[{\"name\":\"pin\",\"type\":\"string\"}],\"name\":\"GetSignatureCount\",\"outputs\":[{\"name\":\"\",\"type\":\"uint32\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":true,\"inputs\":[{\"name\":\"pin\",\"type\":\"string\"},{\"name\":\"index\",\"type\":\"uint256\"}],\"name\":\"GetSignature\",\"outputs\":[{\"name\":\"publisher\",\"type\":\"address\"},{\"name\":\"timestamp\",\"type\":\"uint64\"},{\"name\":\"signature\",\"type\":\"bytes\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"}]"
+
+var (
+	errUnverifiedContent     = errors.New("content not signed by a trusted publisher")
+	errInvalidContentSigner  = errors.New("content not signed by its publisher")
+	errNoSignatureVerifier   = errors.New("ethoFS signature checks disabled")
+	errUnverifiableNamespace = errors.New("only /ipfs paths can be verified")
+
+	signatureVerifiedMeter   = metrics.NewRegisteredMeter("ethofs/signatures/verified", nil)
+	signatureUnverifiedMeter = metrics.NewRegisteredMeter("ethofs/signatures/unverified", nil)
+)
+
+var (
+	contentSignaturesLock sync.RWMutex
+	contentSignatures     *signatureVerifier // Verifier of the running node, nil if no trusted publishers are configured
+)
+
+// currentSignatures returns the verifier of the retrieved roots of the running
+// node, or nil if no trusted publishers are configured.
+func currentSignatures() *signatureVerifier {
+	contentSignaturesLock.RLock()
+	defer contentSignaturesLock.RUnlock()
+
+	return contentSignatures
+}
+
+// setSignatures replaces the verifier of the running node.
+func setSignatures(v *signatureVerifier) {
+	contentSignaturesLock.Lock()
+	defer contentSignaturesLock.Unlock()
+
+	contentSignatures = v
+}
+
+// ContentSignature is the statement of a publisher having published the DAG
+// of the CID, as listed in signature manifests and the registry contract.
+type ContentSignature struct {
+	Cid       string         `json:"cid"`
+	Publisher common.Address `json:"publisher"`
+	Timestamp uint64         `json:"timestamp"` // Unix time of the signature
+	Signature hexutil.Bytes  `json:"signature"` // EIP-191 signature of the hash by the publisher
+}
+
+// Hash returns the hash the publisher signs: the Keccak256 hash of the RLP
+// encoding of the CID, publisher and timestamp.
+func (s *ContentSignature) Hash() common.Hash {
+	data, _ := rlp.EncodeToBytes([]interface{}{s.Cid, s.Publisher, s.Timestamp})
+	return crypto.Keccak256Hash(data)
+}
+
+// Verify checks that the signature is made by its publisher.
+func (s *ContentSignature) Verify() error {
+	signer, err := recoverTextSigner(s.Hash(), s.Signature)
+	if err != nil || signer != s.Publisher {
+		return errInvalidContentSigner
+	}
+	return nil
+}
+
+// recoverTextSigner returns the address of the EIP-191 signature of the hash.
+func recoverTextSigner(hash common.Hash, signature []byte) (common.Address, error) {
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, errors.New("invalid signature length")
+	}
+	sig := common.CopyBytes(signature)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27 // Accept signatures in the personal_sign format
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash(hash[:]), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// ContentVerification is the outcome of the signature check of a root.
+type ContentVerification struct {
+	Cid        string           `json:"cid"`
+	Verified   bool             `json:"verified"`
+	Publishers []common.Address `json:"publishers"` // Trusted publishers with a valid signature
+}
+
+// signatureResult is the cached verification of a root.
+type signatureResult struct {
+	verification *ContentVerification
+	expires      time.Time
+}
+
+// signatureVerifier checks retrieved roots against the signatures of the
+// trusted publishers, read from the loaded manifests and the registry.
+type signatureVerifier struct {
+	publishers map[common.Address]bool
+	manifests  map[string][]*ContentSignature // cid -> signatures
+	registry   common.Address                 // zero if there is none
+	strict     bool
+	results    *lru.Cache // cid -> *signatureResult
+}
+
+// newSignatureVerifier loads the signature manifests of the config. It returns
+// nil if no trusted publishers are configured.
+func newSignatureVerifier(cfg *SignatureConfig) (*signatureVerifier, error) {
+	if len(cfg.Publishers) == 0 {
+		return nil, nil
+	}
+	results, err := lru.New(maxSignatureRoots)
+	if err != nil {
+		return nil, err
+	}
+	v := &signatureVerifier{
+		publishers: make(map[common.Address]bool, len(cfg.Publishers)),
+		manifests:  make(map[string][]*ContentSignature),
+		strict:     cfg.Strict,
+		results:    results,
+	}
+	for _, publisher := range cfg.Publishers {
+		v.publishers[publisher] = true
+	}
+	if cfg.Registry != "" {
+		v.registry = common.HexToAddress(cfg.Registry)
+	}
+	for _, file := range cfg.Manifests {
+		sigs, err := loadSignatureManifest(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature manifest %s: %v", file, err)
+		}
+		for _, sig := range sigs {
+			v.manifests[sig.Cid] = append(v.manifests[sig.Cid], sig)
+		}
+		log.Info("ethoFS - loaded signature manifest", "file", file, "signatures", len(sigs))
+	}
+	return v, nil
+}
+
+// loadSignatureManifest reads a JSON list of content signatures.
+func loadSignatureManifest(file string) ([]*ContentSignature, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var sigs []*ContentSignature
+	if err := json.Unmarshal(data, &sigs); err != nil {
+		return nil, err
+	}
+	for _, sig := range sigs {
+		c, err := cid.Decode(sig.Cid)
+		if err != nil {
+			return nil, err
+		}
+		sig.Cid = c.String()
+	}
+	return sigs, nil
+}
+
+// query reads the signatures of the CID from the registry.
+func (v *signatureVerifier) query(ctx context.Context, c cid.Cid) ([]*ContentSignature, error) {
+	if ethClient == nil {
+		return nil, errNoEthClient
+	}
+	parsed, err := abi.JSON(strings.NewReader(SignatureRegistryABI))
+	if err != nil {
+		return nil, err
+	}
+	contract := bind.NewBoundContract(v.registry, parsed, ethClient, nil, nil)
+	opts := &bind.CallOpts{Context: ctx}
+
+	count := new(uint32)
+	if err := contract.Call(opts, count, "GetSignatureCount", c.String()); err != nil {
+		return nil, err
+	}
+	var sigs []*ContentSignature
+	for i := uint32(0); i < *count && i < maxRegistrySignatures; i++ {
+		entry := new(struct {
+			Publisher common.Address
+			Timestamp uint64
+			Signature []byte
+		})
+		if err := contract.Call(opts, entry, "GetSignature", c.String(), new(big.Int).SetUint64(uint64(i))); err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, &ContentSignature{Cid: c.String(), Publisher: entry.Publisher, Timestamp: entry.Timestamp, Signature: entry.Signature})
+	}
+	return sigs, nil
+}
+
+// verify checks the signatures of the root, from the cache if fresh. Failed
+// registry lookups leave the root to the manifests and are not cached.
+func (v *signatureVerifier) verify(ctx context.Context, c cid.Cid) *ContentVerification {
+	if cached, ok := v.results.Get(c); ok {
+		if result := cached.(*signatureResult); time.Now().Before(result.expires) {
+			return result.verification
+		}
+	}
+	sigs := v.manifests[c.String()]
+
+	cache := true
+	if v.registry != (common.Address{}) {
+		ctx, cancel := context.WithTimeout(ctx, signatureLookupTimeout)
+		registered, err := v.query(ctx, c)
+		cancel()
+
+		if err != nil {
+			log.Debug("ethoFS - signature registry lookup failed", "cid", c, "error", err)
+			cache = false
+		}
+		sigs = append(append([]*ContentSignature(nil), sigs...), registered...)
+	}
+	verification := &ContentVerification{Cid: c.String(), Publishers: []common.Address{}}
+	seen := make(map[common.Address]bool)
+	for _, sig := range sigs {
+		if sig.Cid != c.String() || !v.publishers[sig.Publisher] || seen[sig.Publisher] {
+			continue
+		}
+		if err := sig.Verify(); err != nil {
+			log.Debug("ethoFS - invalid content signature", "cid", c, "publisher", sig.Publisher)
+			continue
+		}
+		seen[sig.Publisher] = true
+		verification.Publishers = append(verification.Publishers, sig.Publisher)
+	}
+	verification.Verified = len(verification.Publishers) > 0
+	if cache || verification.Verified {
+		v.results.Add(c, &signatureResult{verification: verification, expires: time.Now().Add(signatureTTL)})
+	}
+	return verification
+}
+
+// check verifies the root about to be returned. Unverified content only fails
+// in strict mode, which also refuses the paths of other namespaces than /ipfs.
+func (v *signatureVerifier) check(ctx context.Context, c cid.Cid) error {
+	if v == nil {
+		return nil
+	}
+	if !c.Defined() {
+		if v.strict {
+			return errUnverifiableNamespace
+		}
+		return nil
+	}
+	if v.verify(ctx, c).Verified {
+		signatureVerifiedMeter.Mark(1)
+		return nil
+	}
+	signatureUnverifiedMeter.Mark(1)
+	if v.strict {
+		return fmt.Errorf("%w: %s", errUnverifiedContent, c)
+	}
+	log.Debug("ethoFS - returning unverified content", "cid", c)
+	return nil
+}
+
+// signatureOption refuses gateway requests for unverified content in strict
+// mode, and counts them otherwise.
+func signatureOption(v *signatureVerifier) corehttp.ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				if err := v.check(r.Context(), contentRoot(r.URL.Path)); err != nil {
+					http.Error(w, err.Error(), http.StatusForbidden)
+					return
+				}
+			}
+			childMux.ServeHTTP(w, r)
+		})
+		return childMux, nil
+	}
+}
+
+// SignContent signs the CID with the publisher account, for publishing in a
+// signature manifest or the registry contract. Its timestamp would be off
+// while the clock is skewed, so nothing is signed then.
+func (s *EthofsService) SignContent(c cid.Cid, publisher common.Address, passphrase string) (*ContentSignature, error) {
+	if err := checkSigningClock(); err != nil {
+		return nil, err
+	}
+	wallet, err := s.stack.AccountManager().Find(accounts.Account{Address: publisher})
+	if err != nil {
+		return nil, err
+	}
+	sig := &ContentSignature{Cid: c.String(), Publisher: publisher, Timestamp: uint64(time.Now().Unix())}
+	hash := sig.Hash()
+
+	account := accounts.Account{Address: publisher}
+	if passphrase != "" {
+		sig.Signature, err = wallet.SignTextWithPassphrase(account, passphrase, hash[:])
+	} else {
+		sig.Signature, err = wallet.SignText(account, hash[:])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// VerifyContent checks the signatures of the trusted publishers of the CID.
+func (api *PublicEthofsAPI) VerifyContent(ctx context.Context, hash string) (_ *ContentVerification, err error) {
+	defer trackCall("verifyContent", time.Now(), &err)
+
+	v := currentSignatures()
+	if v == nil {
+		return nil, errNoSignatureVerifier
+	}
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return nil, err
+	}
+	return v.verify(ctx, c), nil
+}
+
+// SignContent signs the CID with the keystore account of the publisher,
+// unlocked with the passphrase or already unlocked if empty.
+func (api *PrivateEthofsAPI) SignContent(hash string, publisher common.Address, passphrase string) (_ *ContentSignature, err error) {
+	defer trackCall("signContent", time.Now(), &err)
+
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return nil, err
+	}
+	return api.service.SignContent(c, publisher, passphrase)
+}
@@ -0,0 +1,111 @@
+package ethofs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	cid "github.com/ipfs/go-cid"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func TestContentSignatureVerify(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	sig := &ContentSignature{
+		Cid:       merkledag.NodeWithData([]byte("signed")).Cid().String(),
+		Publisher: crypto.PubkeyToAddress(key.PublicKey),
+		Timestamp: 1600000000,
+	}
+	signContentWithKey(t, sig, key)
+	if err := sig.Verify(); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	// Signatures in the personal_sign format verify as well
+	sig.Signature[crypto.RecoveryIDOffset] += 27
+	if err := sig.Verify(); err != nil {
+		t.Fatalf("personal_sign signature rejected: %v", err)
+	}
+	sig.Timestamp++
+	if err := sig.Verify(); err != errInvalidContentSigner {
+		t.Errorf("tampered signature error mismatch: have %v, want %v", err, errInvalidContentSigner)
+	}
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	trusted, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+
+	signed := merkledag.NodeWithData([]byte("signed")).Cid()
+	foreign := merkledag.NodeWithData([]byte("foreign")).Cid()
+	unsigned := merkledag.NodeWithData([]byte("unsigned")).Cid()
+
+	var sigs []*ContentSignature
+	for c, key := range map[cid.Cid]*ecdsa.PrivateKey{signed: trusted, foreign: other} {
+		sig := &ContentSignature{Cid: c.String(), Publisher: crypto.PubkeyToAddress(key.PublicKey), Timestamp: 1}
+		signContentWithKey(t, sig, key)
+		sigs = append(sigs, sig)
+	}
+	dir, err := ioutil.TempDir("", "ethofs-signatures")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := filepath.Join(dir, "manifest.json")
+	data, _ := json.Marshal(sigs)
+	if err := ioutil.WriteFile(manifest, data, 0600); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	cfg := &SignatureConfig{
+		Publishers: []common.Address{crypto.PubkeyToAddress(trusted.PublicKey)},
+		Manifests:  []string{manifest},
+	}
+	ctx := context.Background()
+	v, err := newSignatureVerifier(cfg)
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+	if res := v.verify(ctx, signed); !res.Verified || len(res.Publishers) != 1 || res.Publishers[0] != cfg.Publishers[0] {
+		t.Errorf("signed content verification mismatch: have %+v", res)
+	}
+	for _, c := range []cid.Cid{foreign, unsigned} {
+		if res := v.verify(ctx, c); res.Verified {
+			t.Errorf("%s: content of untrusted publisher verified", c)
+		}
+	}
+	// Only strict mode refuses unverified content
+	if err := v.check(ctx, unsigned); err != nil {
+		t.Errorf("lenient check failed: %v", err)
+	}
+	v.strict = true
+	if err := v.check(ctx, signed); err != nil {
+		t.Errorf("strict check of signed content failed: %v", err)
+	}
+	if err := v.check(ctx, unsigned); !errors.Is(err, errUnverifiedContent) {
+		t.Errorf("strict check error mismatch: have %v, want %v", err, errUnverifiedContent)
+	}
+	if err := v.check(ctx, cid.Undef); err != errUnverifiableNamespace {
+		t.Errorf("strict check of unresolved path mismatch: have %v, want %v", err, errUnverifiableNamespace)
+	}
+	if err := (*signatureVerifier)(nil).check(ctx, unsigned); err != nil {
+		t.Errorf("disabled verifier refused content: %v", err)
+	}
+}
+
+func signContentWithKey(t *testing.T, sig *ContentSignature, key *ecdsa.PrivateKey) {
+	hash := sig.Hash()
+	signature, err := crypto.Sign(accounts.TextHash(hash[:]), key)
+	if err != nil {
+		t.Fatalf("failed to sign content: %v", err)
+	}
+	sig.Signature = signature
+}
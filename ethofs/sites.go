@@ -0,0 +1,391 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	"github.com/ipfs/go-ipfs/core"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+)
+
+const (
+	// siteRootLink names the link of a manifest to the content of the site.
+	siteRootLink = "root"
+
+	// sitePreviousLink names the link of a manifest to the version it
+	// replaced.
+	sitePreviousLink = "previous"
+
+	// siteKeyPrefix prefixes the keystore names of the IPNS keys the sites
+	// are published under.
+	siteKeyPrefix = "site-"
+
+	// defaultSiteVersions is the number of versions listed by default.
+	defaultSiteVersions = 20
+
+	// maxSiteVersions caps the versions listed at once.
+	maxSiteVersions = 1000
+)
+
+// siteHeadPrefix is the datastore namespace of the CIDs of the latest
+// manifests of the sites published by the node.
+var siteHeadPrefix = datastore.NewKey("/ethofs/sites")
+
+var (
+	errNotSiteManifest = errors.New("not an ethoFS site manifest")
+	errInvalidSiteName = errors.New("site names have to be 1-64 letters, digits, dots, dashes or underscores")
+	errNoSiteVersion   = errors.New("site version must not be empty")
+	errUnknownSite     = errors.New("unknown site")
+	errUnknownVersion  = errors.New("unknown site version")
+)
+
+var siteNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+
+// sitesLock serializes the publishing of versions, each one linking to the
+// head it replaces.
+var sitesLock sync.Mutex
+
+// SiteManifest is a published version of a website. Manifests are IPLD nodes
+// linking to the content of the version as "root" and to the manifest of the
+// version it replaced as "previous", so /ipfs/<manifest>/root/ serves the site
+// and the history is walked through the links alone.
+type SiteManifest struct {
+	Cid      string    `json:"cid"`
+	Name     string    `json:"name"`
+	Version  string    `json:"version"`
+	Root     string    `json:"root"`               // Root CID of the content of the version
+	Previous string    `json:"previous,omitempty"` // Manifest of the version replaced by this one
+	Time     time.Time `json:"time"`               // Publishing time of the version
+	IPNS     string    `json:"ipns,omitempty"`     // IPNS name the site is published under
+}
+
+// siteRecord is the data of a manifest node.
+type siteRecord struct {
+	Site    string    `json:"site"`
+	Version string    `json:"version"`
+	Time    time.Time `json:"time"`
+}
+
+// encodeSiteManifest creates the manifest node of a version.
+func encodeSiteManifest(record siteRecord, root cid.Cid, previous *merkledag.ProtoNode) (*merkledag.ProtoNode, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	nd := merkledag.NodeWithData(data)
+	if err := nd.AddRawLink(siteRootLink, &ipld.Link{Cid: root}); err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		if err := nd.AddNodeLink(sitePreviousLink, previous); err != nil {
+			return nil, err
+		}
+	}
+	return nd, nil
+}
+
+// decodeSiteManifest reads the manifest stored in a node.
+func decodeSiteManifest(nd *merkledag.ProtoNode) (*SiteManifest, error) {
+	var record siteRecord
+	if err := json.Unmarshal(nd.Data(), &record); err != nil || record.Site == "" {
+		return nil, errNotSiteManifest
+	}
+	root, err := nd.GetNodeLink(siteRootLink)
+	if err != nil {
+		return nil, errNotSiteManifest
+	}
+	manifest := &SiteManifest{
+		Cid:     nd.Cid().String(),
+		Name:    record.Site,
+		Version: record.Version,
+		Root:    root.Cid.String(),
+		Time:    record.Time,
+	}
+	if link, err := nd.GetNodeLink(sitePreviousLink); err == nil {
+		manifest.Previous = link.Cid.String()
+	}
+	return manifest, nil
+}
+
+// loadSiteManifest retrieves the manifest node of the CID.
+func loadSiteManifest(ctx context.Context, dag ipld.DAGService, c cid.Cid) (*merkledag.ProtoNode, *SiteManifest, error) {
+	nd, err := dag.Get(ctx, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	pn, ok := nd.(*merkledag.ProtoNode)
+	if !ok {
+		return nil, nil, errNotSiteManifest
+	}
+	manifest, err := decodeSiteManifest(pn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pn, manifest, nil
+}
+
+// siteHead returns the CID of the latest manifest of a site published by the
+// node, undefined if it published none.
+func siteHead(ds datastore.Datastore, name string) (cid.Cid, error) {
+	data, err := ds.Get(siteHeadPrefix.ChildString(name))
+	if err == datastore.ErrNotFound {
+		return cid.Undef, nil
+	}
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cid.Cast(data)
+}
+
+// siteVersions walks the manifests back from the given one, newest first.
+func siteVersions(ctx context.Context, dag ipld.DAGService, c cid.Cid, limit int) ([]SiteManifest, error) {
+	if limit <= 0 {
+		limit = defaultSiteVersions
+	}
+	if limit > maxSiteVersions {
+		limit = maxSiteVersions
+	}
+	versions := make([]SiteManifest, 0)
+	for c.Defined() && len(versions) < limit {
+		_, manifest, err := loadSiteManifest(ctx, dag, c)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *manifest)
+
+		c = cid.Undef
+		if manifest.Previous != "" {
+			if c, err = cid.Decode(manifest.Previous); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return versions, nil
+}
+
+// PublishVersion records a new version of the site with the given content
+// root, linked to the version it replaces, and points the IPNS name of the
+// site at it. The manifest is pinned recursively, keeping the content of all
+// versions of the site available for rollbacks.
+func (s *EthofsService) PublishVersion(ctx context.Context, name, version string, root cid.Cid) (*SiteManifest, error) {
+	ipfs, node := s.API(), s.Node()
+	if ipfs == nil || node == nil {
+		return nil, errNodeNotRunning
+	}
+	if !siteNamePattern.MatchString(name) {
+		return nil, errInvalidSiteName
+	}
+	if version == "" {
+		return nil, errNoSiteVersion
+	}
+	sitesLock.Lock()
+	defer sitesLock.Unlock()
+
+	ds := node.Repo.Datastore()
+	head, err := siteHead(ds, name)
+	if err != nil {
+		return nil, err
+	}
+	var previous *merkledag.ProtoNode
+	if head.Defined() {
+		if previous, _, err = loadSiteManifest(ctx, node.DAG, head); err != nil {
+			return nil, err
+		}
+	}
+	nd, err := encodeSiteManifest(siteRecord{Site: name, Version: version, Time: time.Now().UTC()}, root, previous)
+	if err != nil {
+		return nil, err
+	}
+	if err := node.DAG.Add(ctx, nd); err != nil {
+		return nil, err
+	}
+	if err := pinRecursive(ctx, ipfs, nd.Cid()); err != nil {
+		return nil, err
+	}
+	ownPin(nd.Cid(), pinOwnerSite)
+
+	key := siteKeyPrefix + name
+	has, err := node.Repo.Keystore().Has(key)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		if _, err := ipfs.Key().Generate(ctx, key, options.Key.Type(options.Ed25519Key)); err != nil {
+			return nil, err
+		}
+	}
+	published, err := s.PublishIPNS(ctx, nd.Cid(), key)
+	if err != nil {
+		// Without the name the version is unreachable, leave the head as is
+		if _, err := pinRemove(ipfs, nd.Cid().String()); err != nil {
+			log.Debug("ethoFS - unable to unpin unpublished site version", "cid", nd.Cid(), "error", err)
+		}
+		return nil, err
+	}
+	if err := ds.Put(siteHeadPrefix.ChildString(name), nd.Cid().Bytes()); err != nil {
+		return nil, err
+	}
+	// The new manifest links to the previous one, pinning it along
+	if previous != nil {
+		if _, err := pinRemove(ipfs, head.String()); err != nil {
+			log.Debug("ethoFS - unable to unpin replaced site version", "cid", head, "error", err)
+		}
+	}
+	manifest, err := decodeSiteManifest(nd)
+	if err != nil {
+		return nil, err
+	}
+	manifest.IPNS = published
+	log.Info("ethoFS - site version published", "site", name, "version", version, "root", root, "manifest", nd.Cid())
+	return manifest, nil
+}
+
+// siteManifestRef resolves a site reference to the CID of a manifest: the
+// name of a site published by the node, an IPNS name or a manifest CID.
+func (s *EthofsService) siteManifestRef(ctx context.Context, node *core.IpfsNode, ref string) (cid.Cid, error) {
+	if siteNamePattern.MatchString(ref) {
+		head, err := siteHead(node.Repo.Datastore(), ref)
+		if err != nil {
+			return cid.Undef, err
+		}
+		if head.Defined() {
+			return head, nil
+		}
+	}
+	if !strings.HasPrefix(ref, "/ipns/") {
+		if c, err := cid.Decode(strings.TrimPrefix(ref, "/ipfs/")); err == nil {
+			return c, nil
+		}
+	}
+	resolved, err := s.ResolveIPNS(ctx, ref)
+	if err != nil {
+		return cid.Undef, errUnknownSite
+	}
+	return cid.Decode(strings.Split(strings.TrimPrefix(resolved, "/ipfs/"), "/")[0])
+}
+
+// ListVersions returns the latest versions of a site, newest first. The site
+// is referenced by the name it was published under on this node, its IPNS
+// name or the CID of a manifest.
+func (s *EthofsService) ListVersions(ctx context.Context, ref string, limit int) ([]SiteManifest, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	c, err := s.siteManifestRef(ctx, node, ref)
+	if err != nil {
+		return nil, err
+	}
+	return siteVersions(ctx, node.DAG, c, limit)
+}
+
+// RollbackSite publishes the content of an earlier version of the site as its
+// new version. The history is kept, the rollback is recorded as the latest
+// version linking to the one it replaced.
+func (s *EthofsService) RollbackSite(ctx context.Context, name, version string) (*SiteManifest, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	head, err := siteHead(node.Repo.Datastore(), name)
+	if err != nil {
+		return nil, err
+	}
+	if !head.Defined() {
+		return nil, errUnknownSite
+	}
+	versions, err := siteVersions(ctx, node.DAG, head, maxSiteVersions)
+	if err != nil {
+		return nil, err
+	}
+	for _, manifest := range versions {
+		if manifest.Version != version {
+			continue
+		}
+		root, err := cid.Decode(manifest.Root)
+		if err != nil {
+			return nil, err
+		}
+		return s.PublishVersion(ctx, name, version, root)
+	}
+	return nil, errUnknownVersion
+}
+
+// Sites returns the latest versions of the sites published by the node.
+func (s *EthofsService) Sites(ctx context.Context) ([]SiteManifest, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	results, err := node.Repo.Datastore().Query(query.Query{Prefix: siteHeadPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, err
+	}
+	sites := make([]SiteManifest, 0, len(entries))
+	for _, entry := range entries {
+		c, err := cid.Cast(entry.Value)
+		if err != nil {
+			log.Warn("ethoFS - skipping corrupt site head", "key", entry.Key, "error", err)
+			continue
+		}
+		_, manifest, err := loadSiteManifest(ctx, node.DAG, c)
+		if err != nil {
+			return nil, err
+		}
+		sites = append(sites, *manifest)
+	}
+	return sites, nil
+}
+
+// ListVersions returns the latest versions of a site, newest first.
+func (api *PublicEthofsAPI) ListVersions(ctx context.Context, ref string, limit *int) (_ []SiteManifest, err error) {
+	defer trackCall("listVersions", time.Now(), &err)
+
+	n := 0
+	if limit != nil {
+		n = *limit
+	}
+	return api.service.ListVersions(ctx, ref, n)
+}
+
+// Sites returns the latest versions of the sites published by the node.
+func (api *PublicEthofsAPI) Sites(ctx context.Context) (_ []SiteManifest, err error) {
+	defer trackCall("sites", time.Now(), &err)
+
+	return api.service.Sites(ctx)
+}
+
+// PublishVersion publishes the content at the given CID as a new version of
+// the site, returning its manifest.
+func (api *PrivateEthofsAPI) PublishVersion(ctx context.Context, name string, version string, hash string) (_ *SiteManifest, err error) {
+	defer trackCall("publishVersion", time.Now(), &err)
+
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return nil, err
+	}
+	return api.service.PublishVersion(ctx, name, version, c)
+}
+
+// RollbackSite republishes an earlier version of the site as its latest one.
+func (api *PrivateEthofsAPI) RollbackSite(ctx context.Context, name string, version string) (_ *SiteManifest, err error) {
+	defer trackCall("rollbackSite", time.Now(), &err)
+
+	return api.service.RollbackSite(ctx, name, version)
+}
@@ -0,0 +1,77 @@
+package ethofs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	merkledag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+func TestSiteVersions(t *testing.T) {
+	ctx := context.Background()
+	dag := mdtest.Mock()
+
+	var (
+		previous *merkledag.ProtoNode
+		roots    []string
+	)
+	for i, version := range []string{"1.0.0", "1.1.0", "2.0.0"} {
+		content := merkledag.NodeWithData([]byte("<html>" + version + "</html>"))
+		roots = append(roots, content.Cid().String())
+
+		record := siteRecord{Site: "docs", Version: version, Time: time.Unix(1600000000+int64(i), 0).UTC()}
+		nd, err := encodeSiteManifest(record, content.Cid(), previous)
+		if err != nil {
+			t.Fatalf("failed to encode manifest %s: %v", version, err)
+		}
+		if err := dag.Add(ctx, nd); err != nil {
+			t.Fatalf("failed to store manifest %s: %v", version, err)
+		}
+		previous = nd
+	}
+	versions, err := siteVersions(ctx, dag, previous.Cid(), 0)
+	if err != nil {
+		t.Fatalf("failed to list versions: %v", err)
+	}
+	if len(versions) != 3 {
+		t.Fatalf("version count mismatch: have %d, want 3", len(versions))
+	}
+	for i, want := range []string{"2.0.0", "1.1.0", "1.0.0"} {
+		if versions[i].Version != want || versions[i].Name != "docs" || versions[i].Root != roots[2-i] {
+			t.Errorf("version %d mismatch: have %+v, want %s with root %s", i, versions[i], want, roots[2-i])
+		}
+	}
+	if versions[0].Previous != versions[1].Cid || versions[2].Previous != "" {
+		t.Errorf("version links mismatch: %+v", versions)
+	}
+	if limited, err := siteVersions(ctx, dag, previous.Cid(), 2); err != nil || len(limited) != 2 {
+		t.Errorf("limited listing mismatch: have %d versions (%v), want 2", len(limited), err)
+	}
+	// Nodes without the site record are no manifests
+	other := merkledag.NodeWithData([]byte(`{"time":"2020-09-13T12:26:40Z"}`))
+	if _, err := decodeSiteManifest(other); err != errNotSiteManifest {
+		t.Errorf("foreign node decoded: %v", err)
+	}
+}
+
+func TestSiteNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"docs", true},
+		{"ethofs.io", true},
+		{"my_site-2", true},
+		{"", false},
+		{".hidden", false},
+		{"a/b", false},
+		{"with space", false},
+	}
+	for _, tt := range tests {
+		if valid := siteNamePattern.MatchString(tt.name); valid != tt.valid {
+			t.Errorf("%q: validity mismatch: have %v, want %v", tt.name, valid, tt.valid)
+		}
+	}
+}
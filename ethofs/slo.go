@@ -0,0 +1,234 @@
+package ethofs
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// sloBucketSize is the resolution of the rolling SLO windows.
+	sloBucketSize = time.Minute
+
+	// sloBuckets is the number of buckets kept per method, bounding the
+	// longest SLO window.
+	sloBuckets = 60
+
+	defaultSLOTarget  = 0.99
+	defaultSLOLatency = 5 * time.Second
+)
+
+// sloWindows are the rolling windows reported for every method.
+var sloWindows = []time.Duration{5 * time.Minute, time.Hour}
+
+// rpcMetrics holds the call metrics of the ethofs RPC methods.
+var rpcMetrics = newMethodRegistry()
+
+// sloBucket counts the calls of a single method in one bucket interval.
+type sloBucket struct {
+	start  int64 // bucket index since the epoch
+	calls  uint64
+	errors uint64
+	slow   uint64
+}
+
+// methodMetrics tracks the calls of a single RPC method, both in the metrics
+// registry and in rolling buckets for SLO evaluation.
+type methodMetrics struct {
+	calls     metrics.Meter
+	errors    metrics.Meter
+	duration  metrics.Timer
+	errorRate metrics.GaugeFloat64 // error rate of the shortest SLO window
+
+	lock    sync.Mutex
+	buckets [sloBuckets]sloBucket
+}
+
+func newMethodMetrics(method string) *methodMetrics {
+	prefix := "ethofs/rpc/" + method + "/"
+	return &methodMetrics{
+		calls:     metrics.GetOrRegisterMeter(prefix+"calls", nil),
+		errors:    metrics.GetOrRegisterMeter(prefix+"errors", nil),
+		duration:  metrics.GetOrRegisterTimer(prefix+"duration", nil),
+		errorRate: metrics.GetOrRegisterGaugeFloat64(prefix+"errorrate", nil),
+	}
+}
+
+// record accounts a finished call. Calls slower than the latency objective
+// count against the SLO like failed ones.
+func (m *methodMetrics) record(now time.Time, elapsed time.Duration, failed bool, latency time.Duration) {
+	m.calls.Mark(1)
+	m.duration.Update(elapsed)
+	if failed {
+		m.errors.Mark(1)
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	index := now.UnixNano() / int64(sloBucketSize)
+	b := &m.buckets[index%sloBuckets]
+	if b.start != index {
+		*b = sloBucket{start: index}
+	}
+	b.calls++
+	if failed {
+		b.errors++
+	}
+	if latency > 0 && elapsed > latency {
+		b.slow++
+	}
+	m.errorRate.Update(m.windowLocked(now, sloWindows[0]).errorRate())
+}
+
+// window sums the buckets of the given trailing window.
+func (m *methodMetrics) window(now time.Time, window time.Duration) sloBucket {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.windowLocked(now, window)
+}
+
+func (m *methodMetrics) windowLocked(now time.Time, window time.Duration) sloBucket {
+	var (
+		index = now.UnixNano() / int64(sloBucketSize)
+		first = index - int64(window/sloBucketSize) + 1
+		sum   sloBucket
+	)
+	for _, b := range m.buckets {
+		if b.start >= first && b.start <= index {
+			sum.calls += b.calls
+			sum.errors += b.errors
+			sum.slow += b.slow
+		}
+	}
+	return sum
+}
+
+func (b sloBucket) errorRate() float64 {
+	if b.calls == 0 {
+		return 0
+	}
+	return float64(b.errors) / float64(b.calls)
+}
+
+// methodRegistry creates the metrics of RPC methods on first use.
+type methodRegistry struct {
+	lock    sync.Mutex
+	methods map[string]*methodMetrics
+}
+
+func newMethodRegistry() *methodRegistry {
+	return &methodRegistry{methods: make(map[string]*methodMetrics)}
+}
+
+func (r *methodRegistry) get(method string) *methodMetrics {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	m, ok := r.methods[method]
+	if !ok {
+		m = newMethodMetrics(method)
+		r.methods[method] = m
+	}
+	return m
+}
+
+// names returns the tracked methods in alphabetical order.
+func (r *methodRegistry) names() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	names := make([]string, 0, len(r.methods))
+	for name := range r.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// trackCall records a call of the RPC method started at the given time and
+// attaches the error code to its failure. It is deferred by the API methods
+// with a pointer to their error result.
+func trackCall(method string, start time.Time, err *error) {
+	now := time.Now()
+	rpcMetrics.get(method).record(now, now.Sub(start), *err != nil, ethofsConfig.SLO.latency())
+	*err = rpcError(*err)
+}
+
+// SLOWindow summarizes the calls of a method in a rolling window against the
+// service level objective.
+type SLOWindow struct {
+	Calls        uint64  `json:"calls"`
+	Errors       uint64  `json:"errors"`
+	Slow         uint64  `json:"slow"`
+	ErrorRate    float64 `json:"errorRate"`
+	Availability float64 `json:"availability"`
+
+	// BudgetRemaining is the fraction of the error budget left in the window,
+	// negative once the objective is breached.
+	BudgetRemaining float64 `json:"budgetRemaining"`
+	Breached        bool    `json:"breached"`
+}
+
+// SLOReport contains the rolling SLO windows of every called RPC method.
+type SLOReport struct {
+	Target  float64                          `json:"target"`
+	Latency string                           `json:"latency"`
+	Methods map[string]map[string]*SLOWindow `json:"methods"`
+}
+
+// sloReport evaluates the tracked methods against the objective.
+func sloReport(r *methodRegistry, cfg *SLOConfig, now time.Time) *SLOReport {
+	target := cfg.target()
+	report := &SLOReport{
+		Target:  target,
+		Latency: cfg.latency().String(),
+		Methods: make(map[string]map[string]*SLOWindow),
+	}
+	for _, name := range r.names() {
+		windows := make(map[string]*SLOWindow)
+		for _, window := range sloWindows {
+			windows[formatWindow(window)] = evaluateSLO(r.get(name).window(now, window), target)
+		}
+		report.Methods[name] = windows
+	}
+	return report
+}
+
+// evaluateSLO compares the calls of a window with the availability target.
+func evaluateSLO(b sloBucket, target float64) *SLOWindow {
+	w := &SLOWindow{
+		Calls:           b.calls,
+		Errors:          b.errors,
+		Slow:            b.slow,
+		ErrorRate:       b.errorRate(),
+		Availability:    1,
+		BudgetRemaining: 1,
+	}
+	if b.calls == 0 {
+		return w
+	}
+	bad := b.errors + b.slow
+	if bad > b.calls {
+		bad = b.calls
+	}
+	w.Availability = 1 - float64(bad)/float64(b.calls)
+	if budget := 1 - target; budget > 0 {
+		w.BudgetRemaining = 1 - (1-w.Availability)/budget
+	} else if bad > 0 {
+		w.BudgetRemaining = -1
+	}
+	w.Breached = w.Availability < target
+	return w
+}
+
+// formatWindow renders a window duration the way operators write it (5m, 1h).
+func formatWindow(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
@@ -0,0 +1,61 @@
+package ethofs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMethodMetricsWindows(t *testing.T) {
+	var (
+		m   = newMethodMetrics("test")
+		now = time.Unix(1600000000, 0)
+	)
+	// Calls two hours ago fall out of both windows
+	for i := 0; i < 10; i++ {
+		m.record(now.Add(-2*time.Hour), time.Millisecond, true, time.Second)
+	}
+	// Calls 30 minutes ago only count in the hourly window
+	for i := 0; i < 4; i++ {
+		m.record(now.Add(-30*time.Minute), time.Millisecond, i == 0, time.Second)
+	}
+	// Recent calls, one failing and one slow
+	for i := 0; i < 5; i++ {
+		elapsed := time.Millisecond
+		if i == 1 {
+			elapsed = 2 * time.Second
+		}
+		m.record(now.Add(-time.Minute), elapsed, i == 0, time.Second)
+	}
+	if w := m.window(now, 5*time.Minute); w.calls != 5 || w.errors != 1 || w.slow != 1 {
+		t.Errorf("5m window mismatch: have %+v", w)
+	}
+	if w := m.window(now, time.Hour); w.calls != 9 || w.errors != 2 || w.slow != 1 {
+		t.Errorf("1h window mismatch: have %+v", w)
+	}
+}
+
+func TestEvaluateSLO(t *testing.T) {
+	tests := []struct {
+		bucket   sloBucket
+		target   float64
+		avail    float64
+		budget   float64
+		breached bool
+	}{
+		{bucket: sloBucket{}, target: 0.99, avail: 1, budget: 1},
+		{bucket: sloBucket{calls: 1000, errors: 5}, target: 0.99, avail: 0.995, budget: 0.5},
+		{bucket: sloBucket{calls: 100, errors: 1, slow: 1}, target: 0.99, avail: 0.98, budget: -1, breached: true},
+		{bucket: sloBucket{calls: 10, errors: 1}, target: 1, avail: 0.9, budget: -1, breached: true},
+	}
+	for i, tt := range tests {
+		w := evaluateSLO(tt.bucket, tt.target)
+		if !closeTo(w.Availability, tt.avail) || !closeTo(w.BudgetRemaining, tt.budget) || w.Breached != tt.breached {
+			t.Errorf("test %d: have availability %v budget %v breached %v, want %v %v %v",
+				i, w.Availability, w.BudgetRemaining, w.Breached, tt.avail, tt.budget, tt.breached)
+		}
+	}
+}
+
+func closeTo(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
@@ -0,0 +1,120 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	defaultStartupRetries = 5
+	defaultStartupBackoff = 10 * time.Second
+
+	// maxStartupBackoff caps the delay between two startup attempts.
+	maxStartupBackoff = 5 * time.Minute
+)
+
+// Startup states of the ethoFS node.
+const (
+	StartupStopped  = "stopped"
+	StartupStarting = "starting"
+	StartupRunning  = "running"
+	StartupFailed   = "failed"
+)
+
+// StartupStatus reports the progress of the supervised node startup.
+type StartupStatus struct {
+	State       string     `json:"state"`                 // One of the Startup* states
+	Attempts    int        `json:"attempts"`              // Startup attempts of the current run
+	Error       string     `json:"error,omitempty"`       // Error of the last failed attempt
+	NextAttempt *time.Time `json:"nextAttempt,omitempty"` // Time of the next attempt while backing off
+}
+
+// startupSupervisor is a running startup routine of the service.
+type startupSupervisor struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startupBackoff returns the delay before the given retry, doubling the base
+// delay with every failed attempt.
+func startupBackoff(base time.Duration, retry int) time.Duration {
+	delay := base
+	for i := 1; i < retry && delay < maxStartupBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxStartupBackoff {
+		delay = maxStartupBackoff
+	}
+	return delay
+}
+
+// supervise starts the node, retrying failed attempts with exponential
+// backoff until it runs, the retries are used up or the service is stopped.
+// A node that fails to come up never takes down the chain node, its status
+// is reported through ethofs_startup instead.
+func (s *EthofsService) supervise(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	cfg := s.config.Startup
+	backoff := cfg.Backoff
+	if backoff == 0 {
+		backoff = defaultStartupBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		s.setStartupStatus(StartupStatus{State: StartupStarting, Attempts: attempt})
+
+		err := s.startNode(ctx)
+		if err == nil {
+			s.setStartupStatus(StartupStatus{State: StartupRunning, Attempts: attempt})
+			if node := s.Node(); node != nil {
+				feeds.nodeStarted.Send(NodeStarted{ID: node.Identity})
+			}
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		status := StartupStatus{State: StartupFailed, Attempts: attempt, Error: err.Error()}
+		if attempt > cfg.Retries || errors.Is(err, errInsufficientResources) || errors.Is(err, errRepoVersion) {
+			log.Error("ethoFS - node startup failed, giving up", "attempts", attempt, "error", err)
+			s.setStartupStatus(status)
+			return
+		}
+		delay := startupBackoff(backoff, attempt)
+		next := time.Now().Add(delay)
+		status.State, status.NextAttempt = StartupStarting, &next
+		s.setStartupStatus(status)
+
+		log.Warn("ethoFS - node startup failed, retrying", "attempt", attempt, "retry", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (s *EthofsService) setStartupStatus(status StartupStatus) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.status = status
+	setInstanceStatus(status)
+}
+
+// StartupStatus returns the state of the supervised node startup.
+func (s *EthofsService) StartupStatus() StartupStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.status
+}
+
+// Startup returns the state of the node startup: whether it is running,
+// still (re)trying to start or gave up, and the last startup error.
+func (api *PublicEthofsAPI) Startup() StartupStatus {
+	return api.service.StartupStatus()
+}
@@ -0,0 +1,15 @@
+package ethofs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartupBackoff(t *testing.T) {
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, 160 * time.Second, maxStartupBackoff, maxStartupBackoff}
+	for i, delay := range want {
+		if have := startupBackoff(10*time.Second, i+1); have != delay {
+			t.Errorf("retry %d: delay mismatch: have %v, want %v", i+1, have, delay)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// swarmKeyFile is the name of the pre-shared network key in the repo.
+	swarmKeyFile = "swarm.key"
+
+	// swarmKeyFileEnv names an environment variable pointing at a swarm key
+	// file, used if no key source is configured.
+	swarmKeyFileEnv = "ETHOFS_SWARM_KEY_FILE"
+
+	swarmKeyHeader = "/key/swarm/psk/1.0.0/\n/base16/\n"
+
+	// defaultSwarmKey is the hex encoded pre-shared key of the public ethoFS
+	// network, used unless another key is configured.
+	defaultSwarmKey = "38307a74b2176d0054ffa2864e31ee22d0fc6c3266dd856f6d41bddf14e2ad63"
+
+	defaultSwarmKeyRefresh = 10 * time.Minute
+	swarmKeyTimeout        = 30 * time.Second
+)
+
+// SwarmKeyRegistryABI is the interface of the contract publishing the current
+// swarm key of the ethoFS network.
+const SwarmKeyRegistryABI = "[{\"constant\":true,\"inputs\":[],\"name\":\"swarmKey\",\"outputs\":[{\"name\":\"\",\"type\":\"bytes32\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"}]"
+
+// ErrSwarmKeyMismatch is reported while the handshakes with all the peers the
+// node reaches fail, the usual result of a repo initialized for another
+// network.
+var ErrSwarmKeyMismatch = errors.New("ethoFS swarm key rejected by all reachable peers")
+
+var (
+	errInvalidSwarmKey  = errors.New("invalid swarm key")
+	errSwarmKeyFixed    = errors.New("swarm key managed by its configured source")
+	errEmptySwarmKeyReg = errors.New("swarm key registry holds no key")
+)
+
+// swarmKeySource is a location the swarm key of the network is loaded from.
+type swarmKeySource interface {
+	String() string
+	key(ctx context.Context) ([]byte, error)
+
+	// dynamic reports whether the key can change while the node runs and
+	// should be polled for rotations.
+	dynamic() bool
+}
+
+// parseSwarmKeySource parses a swarm key spec, which is one of
+//
+//	<hex>                 the 32 byte key itself
+//	file:<path>           a swarm.key formatted or hex encoded key file
+//	contract:<address>    swarm key registry contract
+func parseSwarmKeySource(spec string) (swarmKeySource, error) {
+	switch {
+	case strings.HasPrefix(spec, "file:"):
+		path := strings.TrimPrefix(spec, "file:")
+		if path == "" {
+			return nil, errors.New("empty swarm key file path")
+		}
+		return fileKeySource(path), nil
+	case strings.HasPrefix(spec, "contract:"):
+		addr := strings.TrimPrefix(spec, "contract:")
+		if !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("invalid swarm key registry address %q", addr)
+		}
+		return contractKeySource(common.HexToAddress(addr)), nil
+	}
+	key, err := decodeSwarmKey([]byte(spec))
+	if err != nil {
+		return nil, err
+	}
+	return staticKeySource(key), nil
+}
+
+// configuredSwarmKeySource returns the key source of the config, falling back
+// to the key file named by the environment. It returns nil if neither is set,
+// leaving the key stored in the repo in charge.
+func configuredSwarmKeySource(cfg *Config) (swarmKeySource, error) {
+	if cfg.SwarmKey != "" {
+		return parseSwarmKeySource(cfg.SwarmKey)
+	}
+	if path := os.Getenv(swarmKeyFileEnv); path != "" {
+		return fileKeySource(path), nil
+	}
+	return nil, nil
+}
+
+// staticKeySource is a key given in the config.
+type staticKeySource []byte
+
+func (s staticKeySource) String() string                          { return "config" }
+func (s staticKeySource) key(ctx context.Context) ([]byte, error) { return s, nil }
+func (s staticKeySource) dynamic() bool                           { return false }
+
+// fileKeySource reads the key from a file, e.g. a secret mounted by the
+// environment. The file is polled, replacing it rotates the key.
+type fileKeySource string
+
+func (s fileKeySource) String() string { return "file:" + string(s) }
+func (s fileKeySource) dynamic() bool  { return true }
+
+func (s fileKeySource) key(ctx context.Context) ([]byte, error) {
+	data, err := ioutil.ReadFile(string(s))
+	if err != nil {
+		return nil, err
+	}
+	return decodeSwarmKey(data)
+}
+
+// contractKeySource reads the key from the swarm key registry contract.
+type contractKeySource common.Address
+
+func (s contractKeySource) String() string { return "contract:" + common.Address(s).Hex() }
+func (s contractKeySource) dynamic() bool  { return true }
+
+func (s contractKeySource) key(ctx context.Context) ([]byte, error) {
+	if ethClient == nil {
+		return nil, errNoEthClient
+	}
+	parsed, err := abi.JSON(strings.NewReader(SwarmKeyRegistryABI))
+	if err != nil {
+		return nil, err
+	}
+	contract := bind.NewBoundContract(common.Address(s), parsed, ethClient, nil, nil)
+
+	key := new([32]byte)
+	if err := contract.Call(&bind.CallOpts{Context: ctx}, key, "swarmKey"); err != nil {
+		return nil, err
+	}
+	if *key == ([32]byte{}) {
+		return nil, errEmptySwarmKeyReg
+	}
+	return key[:], nil
+}
+
+// decodeSwarmKey parses a key in the swarm.key file format or as bare hex.
+func decodeSwarmKey(data []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(data))
+	if strings.HasPrefix(text, "/key/swarm/psk/1.0.0/") {
+		lines := strings.Split(text, "\n")
+		if len(lines) != 3 || strings.TrimSpace(lines[1]) != "/base16/" {
+			return nil, errInvalidSwarmKey
+		}
+		text = strings.TrimSpace(lines[2])
+	}
+	key, err := hex.DecodeString(text)
+	if err != nil || len(key) != 32 {
+		return nil, errInvalidSwarmKey
+	}
+	return key, nil
+}
+
+// encodeSwarmKey renders the key in the swarm.key file format.
+func encodeSwarmKey(key []byte) string {
+	return swarmKeyHeader + hex.EncodeToString(key)
+}
+
+// readSwarmKey loads the swarm key of the repo.
+func readSwarmKey(repoRoot string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(repoRoot, swarmKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	return decodeSwarmKey(data)
+}
+
+// writeSwarmKey replaces the swarm key of the repo. The key only takes effect
+// once the libp2p host is recreated.
+func writeSwarmKey(repoRoot string, key []byte) error {
+	// The key of a configured source is written before the repo is created
+	if err := os.MkdirAll(repoRoot, 0775); err != nil {
+		return err
+	}
+	path := filepath.Join(repoRoot, swarmKeyFile)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(encodeSwarmKey(key)), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// initialSwarmKey returns the key written to newly initialized repos: the
+// devnet key for seeded repos, the configured key if it can be loaded without
+// a running chain, an ephemeral key for test profile repos, or the default
+// ethoFS network key.
+func initialSwarmKey(cfg *Config) []byte {
+	if cfg.Seed != "" {
+		return seedSwarmKey(cfg.Seed)
+	}
+	if source, err := configuredSwarmKeySource(cfg); err == nil && source != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), swarmKeyTimeout)
+		defer cancel()
+
+		if key, err := source.key(ctx); err == nil {
+			return key
+		}
+	}
+	if cfg.testing() {
+		return ephemeralSwarmKey()
+	}
+	key, _ := hex.DecodeString(defaultSwarmKey)
+	return key
+}
+
+// syncSwarmKey updates the repo swarm key to the one of the configured source
+// before the node starts. Failing dynamic sources keep the current key.
+func syncSwarmKey(ctx context.Context, repoRoot string, source swarmKeySource) error {
+	if source == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, swarmKeyTimeout)
+	defer cancel()
+
+	key, err := source.key(ctx)
+	if err != nil {
+		if source.dynamic() {
+			log.Warn("ethoFS - unable to load swarm key, keeping current one", "source", source, "error", err)
+			return nil
+		}
+		return err
+	}
+	current, err := readSwarmKey(repoRoot)
+	if err == nil && bytes.Equal(current, key) {
+		return nil
+	}
+	log.Info("ethoFS - updating swarm key", "source", source)
+	return writeSwarmKey(repoRoot, key)
+}
+
+// swarmKeyWatcher polls a dynamic key source and triggers a rotation once the
+// published key changes.
+type swarmKeyWatcher struct {
+	source   swarmKeySource
+	current  []byte
+	interval time.Duration
+	rotate   func(key []byte) error
+}
+
+// loop polls the key source until the context is cancelled or a rotation was
+// triggered, which restarts the node and with it the watcher.
+func (w *swarmKeyWatcher) loop(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if w.check(ctx) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check loads the published key, triggering a rotation if it changed.
+func (w *swarmKeyWatcher) check(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, swarmKeyTimeout)
+	defer cancel()
+
+	key, err := w.source.key(ctx)
+	if err != nil {
+		log.Debug("ethoFS - swarm key check failed", "source", w.source, "error", err)
+		return false
+	}
+	if bytes.Equal(key, w.current) {
+		return false
+	}
+	log.Warn("ethoFS - swarm key rotated, restarting node", "source", w.source)
+	// The rotation stops the node, which waits for this goroutine to return
+	go func() {
+		if err := w.rotate(key); err != nil {
+			log.Error("ethoFS - swarm key rotation failed", "error", err)
+		}
+	}()
+	return true
+}
+
+// RotateSwarmKey replaces the pre-shared key of the private network and
+// restarts the node, as libp2p only reads the key when constructing the host.
+// Nodes with a configured key source follow the source instead.
+func (s *EthofsService) RotateSwarmKey(key []byte) error {
+	if len(key) != 32 {
+		return errInvalidSwarmKey
+	}
+	source, err := configuredSwarmKeySource(&s.config)
+	if err != nil {
+		return err
+	}
+	if source != nil {
+		return errSwarmKeyFixed
+	}
+	return s.rotateSwarmKey(key)
+}
+
+// rotateSwarmKey writes the new swarm key while the node is stopped.
+func (s *EthofsService) rotateSwarmKey(key []byte) error {
+	if err := s.Stop(); err != nil {
+		log.Warn("ethoFS - error stopping node for swarm key rotation", "error", err)
+	}
+	if err := writeSwarmKey(s.config.repoPath(), key); err != nil {
+		return err
+	}
+	dialFailures.resetHandshakes()
+	log.Info("ethoFS - swarm key replaced, restarting node")
+	return s.Start()
+}
@@ -0,0 +1,81 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeSwarmKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, 32)
+	tests := []struct {
+		data string
+		fail bool
+	}{
+		{data: hex.EncodeToString(key)},
+		{data: encodeSwarmKey(key)},
+		{data: encodeSwarmKey(key) + "\n"},
+		{data: "/key/swarm/psk/1.0.0/\n/base64/\n" + hex.EncodeToString(key), fail: true},
+		{data: hex.EncodeToString(key[:16]), fail: true},
+		{data: "not a key", fail: true},
+	}
+	for i, tt := range tests {
+		have, err := decodeSwarmKey([]byte(tt.data))
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(have, key) {
+			t.Errorf("test %d: have %x (%v), want %x", i, have, err, key)
+		}
+	}
+}
+
+func TestSwarmKeySources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethofs-swarmkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := bytes.Repeat([]byte{0x01}, 32)
+	if err := writeSwarmKey(dir, key); err != nil {
+		t.Fatalf("failed to write swarm key: %v", err)
+	}
+	if have, err := readSwarmKey(dir); err != nil || !bytes.Equal(have, key) {
+		t.Fatalf("swarm key mismatch: have %x (%v), want %x", have, err, key)
+	}
+	source, err := parseSwarmKeySource("file:" + filepath.Join(dir, swarmKeyFile))
+	if err != nil {
+		t.Fatalf("failed to parse file source: %v", err)
+	}
+	if !source.dynamic() {
+		t.Error("file source not polled for rotations")
+	}
+	if have, err := source.key(context.Background()); err != nil || !bytes.Equal(have, key) {
+		t.Errorf("file source key mismatch: have %x (%v), want %x", have, err, key)
+	}
+	if source, err = parseSwarmKeySource(hex.EncodeToString(key)); err != nil || source.dynamic() {
+		t.Errorf("hex key not parsed as static source: %v", err)
+	}
+	if _, err := parseSwarmKeySource("contract:0xnope"); err == nil {
+		t.Error("expected error for invalid registry address")
+	}
+
+	// The environment only applies without a configured source
+	os.Setenv(swarmKeyFileEnv, filepath.Join(dir, swarmKeyFile))
+	defer os.Unsetenv(swarmKeyFileEnv)
+
+	if source, _ := configuredSwarmKeySource(&Config{}); source == nil || source.String() != "file:"+filepath.Join(dir, swarmKeyFile) {
+		t.Errorf("environment key file not used: %v", source)
+	}
+	if source, _ := configuredSwarmKeySource(&Config{SwarmKey: hex.EncodeToString(key)}); source == nil || source.dynamic() {
+		t.Errorf("configured key not preferred over environment: %v", source)
+	}
+}
@@ -0,0 +1,274 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-ipfs/core"
+)
+
+const (
+	defaultTelemetryInterval = 6 * time.Hour
+
+	// telemetryTimeout bounds the delivery of a single report.
+	telemetryTimeout = 30 * time.Second
+
+	// maxTelemetryDelay caps the random delay of the first report, keeping
+	// nodes restarted together from reporting at once.
+	maxTelemetryDelay = 10 * time.Minute
+)
+
+var (
+	errNoTelemetrySink = errors.New("nil telemetry sink factory")
+
+	telemetrySentMeter   = metrics.NewRegisteredMeter("ethofs/telemetry/sent", nil)
+	telemetryFailedMeter = metrics.NewRegisteredMeter("ethofs/telemetry/failed", nil)
+)
+
+// telemetryInstanceKey holds the random ID of the installation in the repo
+// datastore.
+var telemetryInstanceKey = datastore.NewKey("/ethofs/telemetry/instance")
+
+// TelemetryReport is the anonymized statistics a node reports. It carries no
+// peer ID, address or content identifiers, only a random installation ID so
+// that the reports of a node are counted once.
+type TelemetryReport struct {
+	Instance    string `json:"instance"`         // Random ID of the installation, unrelated to the peer ID
+	Version     string `json:"version"`          // Client version of the node
+	NodeType    string `json:"nodeType"`         // gn, mn or sn
+	Light       bool   `json:"light"`            // Light node not hosting the contract uploads
+	Region      string `json:"region,omitempty"` // Region label configured by the operator
+	StoredBytes uint64 `json:"storedBytes"`      // Disk usage of the repo
+	Pins        int    `json:"pins"`             // Recursive and direct pins
+	Peers       int    `json:"peers"`            // Connected swarm peers
+	Timestamp   uint64 `json:"timestamp"`        // Unix time of the report
+}
+
+// TelemetrySink delivers telemetry reports to a network statistics service.
+type TelemetrySink interface {
+	Report(ctx context.Context, report *TelemetryReport) error
+}
+
+// TelemetrySinkFactory creates the sink delivering the reports to the
+// configured endpoint URL.
+type TelemetrySinkFactory func(endpoint *url.URL) (TelemetrySink, error)
+
+var (
+	telemetrySinksLock sync.RWMutex
+	telemetrySinks     = map[string]TelemetrySinkFactory{
+		"http":  newHTTPTelemetrySink,
+		"https": newHTTPTelemetrySink,
+	}
+)
+
+// RegisterTelemetrySink makes a delivery method available for the telemetry
+// endpoints of the given URL scheme (e.g. a message queue). Reports to
+// http and https endpoints are POSTed as JSON by default. It has to be called
+// before the node is started, registering a scheme twice fails.
+func RegisterTelemetrySink(scheme string, factory TelemetrySinkFactory) error {
+	if scheme == "" {
+		return errors.New("empty telemetry sink scheme")
+	}
+	if factory == nil {
+		return errNoTelemetrySink
+	}
+	telemetrySinksLock.Lock()
+	defer telemetrySinksLock.Unlock()
+
+	if _, ok := telemetrySinks[scheme]; ok {
+		return fmt.Errorf("telemetry sink scheme %q already registered", scheme)
+	}
+	telemetrySinks[scheme] = factory
+	return nil
+}
+
+// newTelemetrySink creates the sink of the endpoint URL.
+func newTelemetrySink(endpoint string) (TelemetrySink, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	telemetrySinksLock.RLock()
+	factory, ok := telemetrySinks[u.Scheme]
+	telemetrySinksLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no telemetry sink for scheme %q", u.Scheme)
+	}
+	return factory(u)
+}
+
+// httpTelemetrySink POSTs the reports as JSON.
+type httpTelemetrySink struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPTelemetrySink(endpoint *url.URL) (TelemetrySink, error) {
+	if endpoint.Host == "" {
+		return nil, fmt.Errorf("telemetry endpoint %q without host", endpoint)
+	}
+	return &httpTelemetrySink{url: endpoint.String(), client: &http.Client{Timeout: telemetryTimeout}}, nil
+}
+
+func (s *httpTelemetrySink) Report(ctx context.Context, report *TelemetryReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("telemetry endpoint answered %s", res.Status)
+	}
+	return nil
+}
+
+// telemetryInstance returns the random installation ID of the repo, creating
+// it on first use.
+func telemetryInstance(ds datastore.Datastore) (string, error) {
+	id, err := ds.Get(telemetryInstanceKey)
+	if err == nil {
+		return string(id), nil
+	}
+	if err != datastore.ErrNotFound {
+		return "", err
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	instance := hex.EncodeToString(buf)
+	return instance, ds.Put(telemetryInstanceKey, []byte(instance))
+}
+
+// telemetryReport collects the statistics of the node.
+func telemetryReport(node *core.IpfsNode, cfg *Config) (*TelemetryReport, error) {
+	instance, err := telemetryInstance(node.Repo.Datastore())
+	if err != nil {
+		return nil, err
+	}
+	stored, err := node.Repo.GetStorageUsage()
+	if err != nil {
+		return nil, err
+	}
+	pins, err := localPins.count()
+	if err != nil {
+		return nil, err
+	}
+	report := &TelemetryReport{
+		Instance:    instance,
+		Version:     params.VersionWithMeta,
+		NodeType:    cfg.NodeType,
+		Light:       cfg.Light,
+		Region:      cfg.Telemetry.Region,
+		StoredBytes: stored,
+		Pins:        pins,
+		Timestamp:   uint64(time.Now().Unix()),
+	}
+	if node.IsOnline {
+		report.Peers = len(node.PeerHost.Network().Peers())
+	}
+	return report, nil
+}
+
+// telemetryReporter periodically delivers the statistics of the node.
+type telemetryReporter struct {
+	node     *core.IpfsNode
+	cfg      *Config
+	sink     TelemetrySink
+	interval time.Duration
+}
+
+func newTelemetryReporter(node *core.IpfsNode, cfg *Config) (*telemetryReporter, error) {
+	sink, err := newTelemetrySink(cfg.Telemetry.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	r := &telemetryReporter{node: node, cfg: cfg, sink: sink, interval: cfg.Telemetry.Interval}
+	if r.interval == 0 {
+		r.interval = defaultTelemetryInterval
+	}
+	return r, nil
+}
+
+// loop reports after a random delay and then every interval until the
+// context is cancelled.
+func (r *telemetryReporter) loop(ctx context.Context) {
+	delay := time.Duration(mrand.Int63n(int64(maxTelemetryDelay)))
+	if delay > r.interval {
+		delay = r.interval
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			r.report(ctx)
+			timer.Reset(r.interval)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// report delivers the current statistics.
+func (r *telemetryReporter) report(ctx context.Context) {
+	report, err := telemetryReport(r.node, r.cfg)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(ctx, telemetryTimeout)
+		err = r.sink.Report(ctx, report)
+		cancel()
+	}
+	if err != nil {
+		telemetryFailedMeter.Mark(1)
+		log.Debug("ethoFS - telemetry report failed", "endpoint", r.cfg.Telemetry.Endpoint, "error", err)
+		return
+	}
+	telemetrySentMeter.Mark(1)
+	log.Trace("ethoFS - telemetry report sent", "endpoint", r.cfg.Telemetry.Endpoint)
+}
+
+// Telemetry returns the statistics the node reports if telemetry is enabled,
+// whether or not it is.
+func (s *EthofsService) Telemetry() (*TelemetryReport, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	return telemetryReport(node, &s.config)
+}
+
+// Telemetry returns the anonymized statistics the node reports to the
+// network statistics service when telemetry is enabled.
+func (api *PublicEthofsAPI) Telemetry() (_ *TelemetryReport, err error) {
+	defer trackCall("telemetry", time.Now(), &err)
+
+	return api.service.Telemetry()
+}
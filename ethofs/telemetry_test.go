@@ -0,0 +1,77 @@
+package ethofs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+)
+
+func TestTelemetryInstance(t *testing.T) {
+	ds := datastore.NewMapDatastore()
+
+	first, err := telemetryInstance(ds)
+	if err != nil {
+		t.Fatalf("failed to create instance ID: %v", err)
+	}
+	if len(first) != 32 {
+		t.Errorf("instance ID length mismatch: have %d, want 32", len(first))
+	}
+	if second, err := telemetryInstance(ds); err != nil || second != first {
+		t.Errorf("instance ID not kept: have %s (%v), want %s", second, err, first)
+	}
+}
+
+func TestHTTPTelemetrySink(t *testing.T) {
+	var received TelemetryReport
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink, err := newTelemetrySink(server.URL + "/report")
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	report := &TelemetryReport{Instance: "00ff", NodeType: "sn", Region: "eu-west", StoredBytes: 1024, Pins: 3, Peers: 8}
+	if err := sink.Report(context.Background(), report); err != nil {
+		t.Fatalf("failed to deliver report: %v", err)
+	}
+	if received != *report {
+		t.Errorf("received report mismatch: have %+v, want %+v", received, *report)
+	}
+	if _, err := newTelemetrySink("udp://stats.example.org"); err == nil {
+		t.Errorf("sink created for unregistered scheme")
+	}
+}
+
+type testTelemetrySink struct{}
+
+func (testTelemetrySink) Report(ctx context.Context, report *TelemetryReport) error { return nil }
+
+func TestRegisterTelemetrySink(t *testing.T) {
+	factory := func(*url.URL) (TelemetrySink, error) { return testTelemetrySink{}, nil }
+	if err := RegisterTelemetrySink("https", factory); err == nil {
+		t.Errorf("built-in scheme registered again")
+	}
+	if err := RegisterTelemetrySink("ethotest", factory); err != nil {
+		t.Fatalf("failed to register sink: %v", err)
+	}
+	defer func() {
+		telemetrySinksLock.Lock()
+		delete(telemetrySinks, "ethotest")
+		telemetrySinksLock.Unlock()
+	}()
+	if sink, err := newTelemetrySink("ethotest://queue/stats"); err != nil || sink != (testTelemetrySink{}) {
+		t.Errorf("registered sink mismatch: have %v (%v)", sink, err)
+	}
+}
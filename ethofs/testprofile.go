@@ -0,0 +1,80 @@
+package ethofs
+
+import (
+	"crypto/rand"
+	"strings"
+
+	config "github.com/ipfs/go-ipfs-config"
+)
+
+// testProfile is the profile of nodes run side by side on a developer
+// machine. Besides the go-ipfs test profile applied on repo initialization,
+// it keeps the ethoFS settings of the node local: every start listens on
+// random localhost ports, nothing is announced, the NAT services are off, the
+// production bootstrap nodes are never dialed and new repos get an ephemeral
+// swarm key instead of the ethoFS network key.
+const testProfile = "test"
+
+// testListenAddr is the localhost address with a random port that test
+// profile nodes listen on.
+const testListenAddr = "/ip4/127.0.0.1/tcp/0"
+
+// testing reports whether the test profile is configured.
+func (c *Config) testing() bool {
+	for _, profile := range strings.Split(c.Profile, ",") {
+		if strings.TrimSpace(profile) == testProfile {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTestProfile isolates the repo config of a test profile node. Explicit
+// swarm addresses are kept, so test setups can still pin the ports.
+func applyTestProfile(conf *config.Config, cfg *Config) {
+	if len(cfg.SwarmAddresses) == 0 {
+		conf.Addresses.Swarm = []string{testListenAddr}
+	}
+	conf.Addresses.API = config.Strings{testListenAddr}
+	conf.Addresses.Announce = nil
+	conf.Bootstrap = nil
+	conf.Discovery.MDNS.Enabled = false
+
+	// Neither the added content nor the repo keys are provided to the DHT
+	conf.Experimental.StrategicProviding = true
+	conf.Reprovider.Interval = "0"
+
+	conf.Swarm.DisableNatPortMap = true
+	conf.Swarm.DisableRelay = true
+	conf.Swarm.EnableAutoRelay = false
+	conf.Swarm.EnableRelayHop = false
+	conf.AutoNAT.ServiceMode = config.AutoNATServiceDisabled
+}
+
+// withoutDefaultBootstrap drops the production bootstrap nodes from the peers.
+func withoutDefaultBootstrap(peers []string) []string {
+	var kept []string
+	for _, addr := range peers {
+		production := false
+		for _, node := range defaultBootstrapNodes {
+			if addr == node {
+				production = true
+				break
+			}
+		}
+		if !production {
+			kept = append(kept, addr)
+		}
+	}
+	return kept
+}
+
+// ephemeralSwarmKey generates a random private network key, keeping a test
+// node apart from the ethoFS network and from unrelated test nodes.
+func ephemeralSwarmKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
@@ -0,0 +1,67 @@
+package ethofs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	config "github.com/ipfs/go-ipfs-config"
+)
+
+func TestTestProfile(t *testing.T) {
+	for profiles, want := range map[string]bool{"": false, "lowpower": false, "test": true, "lowpower, test": true, "testing": false} {
+		if have := (&Config{Profile: profiles}).testing(); have != want {
+			t.Errorf("profiles %q: test profile %v, want %v", profiles, have, want)
+		}
+	}
+	autoRelay := true
+	cfg := &Config{
+		Profile:        "lowpower,test",
+		BootstrapNodes: append([]string{"/ip4/127.0.0.1/tcp/4001/ipfs/QmPeer"}, defaultBootstrapNodes...),
+		NAT: NATConfig{
+			AnnounceAddresses: []string{"/ip4/203.0.113.7/tcp/4002"},
+			AutoRelay:         &autoRelay,
+			AutoNAT:           autoNATEnabled,
+		},
+	}
+	conf := &config.Config{
+		Addresses: config.Addresses{Swarm: []string{"/ip4/0.0.0.0/tcp/4001"}},
+		Bootstrap: defaultBootstrapNodes,
+	}
+	if err := applySwarmConfig(conf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{testListenAddr}; !reflect.DeepEqual(conf.Addresses.Swarm, want) {
+		t.Errorf("listen addresses mismatch: have %v, want %v", conf.Addresses.Swarm, want)
+	}
+	if len(conf.Addresses.Announce) != 0 || len(conf.Bootstrap) != 0 {
+		t.Errorf("test node announces %v, bootstraps from %v", conf.Addresses.Announce, conf.Bootstrap)
+	}
+	if !conf.Experimental.StrategicProviding || conf.Reprovider.Interval != "0" {
+		t.Errorf("test node provides content: %+v, %+v", conf.Experimental, conf.Reprovider)
+	}
+	if !conf.Swarm.DisableNatPortMap || !conf.Swarm.DisableRelay || conf.Swarm.EnableAutoRelay || conf.AutoNAT.ServiceMode != config.AutoNATServiceDisabled {
+		t.Errorf("NAT services enabled: %+v, %+v", conf.Swarm, conf.AutoNAT)
+	}
+	// Explicit listen addresses pin the ports
+	cfg.SwarmAddresses = []string{"/ip4/127.0.0.1/tcp/14001"}
+	if err := applySwarmConfig(conf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(conf.Addresses.Swarm, cfg.SwarmAddresses) {
+		t.Errorf("listen addresses mismatch: have %v, want %v", conf.Addresses.Swarm, cfg.SwarmAddresses)
+	}
+	if have, want := cfg.bootstrapNodes(), cfg.BootstrapNodes[:1]; !reflect.DeepEqual(have, want) {
+		t.Errorf("bootstrap peers mismatch: have %v, want %v", have, want)
+	}
+	// Every test repo gets its own swarm key, unless one is configured
+	first, second := initialSwarmKey(cfg), initialSwarmKey(cfg)
+	if len(first) != 32 || bytes.Equal(first, second) || hex.EncodeToString(first) == defaultSwarmKey {
+		t.Errorf("swarm keys not ephemeral: %x, %x", first, second)
+	}
+	cfg.SwarmKey = defaultSwarmKey
+	if key := initialSwarmKey(cfg); hex.EncodeToString(key) != defaultSwarmKey {
+		t.Errorf("configured swarm key ignored: have %x", key)
+	}
+}
@@ -0,0 +1,554 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	lru "github.com/hashicorp/golang-lru"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	files "github.com/ipfs/go-ipfs-files"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	// timeLockTopic is the pubsub topic the keys of time-locked content are
+	// released on.
+	timeLockTopic = "/ethofs/timelock"
+
+	// timeLockInterval is how often the pending locks are checked, about the
+	// block time of the chain.
+	timeLockInterval = 15 * time.Second
+
+	// timeLockRebroadcast is how often released keys are announced again for
+	// the nodes offline at the release, within timeLockRebroadcastWindow.
+	timeLockRebroadcast       = time.Hour
+	timeLockRebroadcastWindow = 7 * 24 * time.Hour
+
+	// maxTimeLockKeys bounds the unverified keys kept per content. Anyone on
+	// the swarm can announce a key, only the right one decrypts.
+	maxTimeLockKeys = 4
+
+	// maxTimeLockWatches bounds the content asked for before its release
+	// whose keys are kept once announced.
+	maxTimeLockWatches = 1024
+)
+
+var (
+	errTimeLocked       = errors.New("content still time-locked")
+	errNoTimeLock       = errors.New("unknown time-locked content")
+	errTimeLockRelease  = errors.New("time lock needs either a release block or a release time")
+	errTimeLockReleased = errors.New("time lock release already passed")
+
+	timeLockReleasedMeter = metrics.NewRegisteredMeter("ethofs/timelock/released", nil)
+	timeLockReceivedMeter = metrics.NewRegisteredMeter("ethofs/timelock/received", nil)
+)
+
+// timeLockPrefix is the datastore namespace of the time locks.
+var timeLockPrefix = datastore.NewKey("/ethofs/timelock")
+
+// timeLock is the local record of time-locked content, either added by this
+// node, which holds the key until the release, or watched for the release of
+// its key by another node.
+type timeLock struct {
+	Cid       string   `json:"cid"`
+	Keys      [][]byte `json:"keys,omitempty"`  // Data key, or the candidates announced for watched content
+	Verified  bool     `json:"verified"`        // Keys holds the single key decrypting the content
+	Own       bool     `json:"own"`             // Added by this node
+	Block     uint64   `json:"block,omitempty"` // Release block height
+	Time      uint64   `json:"time,omitempty"`  // Release unix time
+	Released  uint64   `json:"released"`        // Unix time of the release, zero while locked
+	Announced uint64   `json:"announced"`       // Unix time of the last key announcement
+}
+
+// TimeLock describes time-locked content.
+type TimeLock struct {
+	Cid      string `json:"cid"`
+	Own      bool   `json:"own"`
+	Block    uint64 `json:"block,omitempty"`
+	Time     uint64 `json:"time,omitempty"`
+	Released uint64 `json:"released"`
+}
+
+func (l *timeLock) info() *TimeLock {
+	return &TimeLock{Cid: l.Cid, Own: l.Own, Block: l.Block, Time: l.Time, Released: l.Released}
+}
+
+// due reports whether the lock is to be released at the chain head and time.
+func (l *timeLock) due(head uint64, now time.Time) bool {
+	if l.Block != 0 {
+		return head != 0 && head >= l.Block
+	}
+	return uint64(now.Unix()) >= l.Time
+}
+
+// addKey adds a key announced for watched content, reporting whether it was
+// new. Verified keys are final.
+func (l *timeLock) addKey(key []byte) bool {
+	if l.Verified || len(l.Keys) >= maxTimeLockKeys {
+		return false
+	}
+	for _, known := range l.Keys {
+		if bytes.Equal(known, key) {
+			return false
+		}
+	}
+	l.Keys = append(l.Keys, key)
+	return true
+}
+
+// timeLockRelease is the announcement of a released key.
+type timeLockRelease struct {
+	Cid string        `json:"cid"`
+	Key hexutil.Bytes `json:"key"`
+}
+
+// timeLockStore keeps the time locks in the repo datastore. The content asked
+// for before its release is watched in memory only, until a key for it is
+// announced.
+type timeLockStore struct {
+	lock     sync.Mutex
+	ds       datastore.Datastore
+	watching *lru.Cache // CIDs of the watched content
+}
+
+// timeLocks is shared by the RPC API and the release watcher.
+var timeLocks = new(timeLockStore)
+
+func timeLockKey(c string) datastore.Key {
+	return timeLockPrefix.ChildString(c)
+}
+
+// attach switches the store to the datastore of the running node.
+func (st *timeLockStore) attach(ds datastore.Datastore) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	st.ds = ds
+}
+
+// detach releases the datastore of the stopped node.
+func (st *timeLockStore) detach() {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	st.ds = nil
+}
+
+// get returns the lock of the content, or nil if there is none.
+func (st *timeLockStore) get(c string) (*timeLock, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if st.ds == nil {
+		return nil, errNodeNotRunning
+	}
+	data, err := st.ds.Get(timeLockKey(c))
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l := new(timeLock)
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// put stores the lock.
+func (st *timeLockStore) put(l *timeLock) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if st.ds == nil {
+		return errNodeNotRunning
+	}
+	return st.ds.Put(timeLockKey(l.Cid), data)
+}
+
+// watch keeps the keys announced for the content from now on.
+func (st *timeLockStore) watch(c cid.Cid) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if st.watching == nil {
+		st.watching, _ = lru.New(maxTimeLockWatches)
+	}
+	st.watching.Add(c, struct{}{})
+}
+
+// watched reports whether the content was asked for before its release.
+func (st *timeLockStore) watched(c cid.Cid) bool {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	return st.watching != nil && st.watching.Contains(c)
+}
+
+// list returns all locks.
+func (st *timeLockStore) list() ([]*timeLock, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if st.ds == nil {
+		return nil, errNodeNotRunning
+	}
+	results, err := st.ds.Query(query.Query{Prefix: timeLockPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var locks []*timeLock
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		l := new(timeLock)
+		if err := json.Unmarshal(result.Value, l); err != nil {
+			log.Debug("ethoFS - dropping corrupt time lock", "key", result.Key, "error", err)
+			continue
+		}
+		locks = append(locks, l)
+	}
+	return locks, nil
+}
+
+// receive records a key announced by another node. Keys are kept for the
+// watched content and the content pinned locally, so the hosting nodes can
+// answer for the ones that missed the announcement.
+func (st *timeLockStore) receive(c cid.Cid, key []byte) error {
+	l, err := st.get(c.String())
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		if !st.watched(c) {
+			if pinned, err := localPins.has(c); err != nil || !pinned {
+				return err
+			}
+		}
+		l = &timeLock{Cid: c.String()}
+	}
+	if l.Own || !l.addKey(key) {
+		return nil
+	}
+	if l.Released == 0 {
+		l.Released = uint64(time.Now().Unix())
+	}
+	timeLockReceivedMeter.Mark(1)
+	return st.put(l)
+}
+
+// timeLockWatcher releases the keys of the due locks of the node and follows
+// the releases of the other nodes until the context is cancelled.
+type timeLockWatcher struct {
+	ipfs icore.CoreAPI
+	self peer.ID
+	now  func() time.Time
+}
+
+func newTimeLockWatcher(ipfs icore.CoreAPI, self peer.ID) *timeLockWatcher {
+	return &timeLockWatcher{ipfs: ipfs, self: self, now: time.Now}
+}
+
+func (w *timeLockWatcher) loop(ctx context.Context) {
+	sub, err := w.ipfs.PubSub().Subscribe(ctx, timeLockTopic)
+	if err != nil {
+		log.Warn("ethoFS - unable to follow time lock releases", "error", err)
+		return
+	}
+	defer sub.Close()
+
+	go func() {
+		ticker := time.NewTicker(timeLockInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.release(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			return
+		}
+		if msg.From() == w.self {
+			continue
+		}
+		var release timeLockRelease
+		if err := json.Unmarshal(msg.Data(), &release); err != nil || len(release.Key) != 32 {
+			continue
+		}
+		c, err := cid.Parse(release.Cid)
+		if err != nil {
+			continue
+		}
+		if err := timeLocks.receive(c, release.Key); err != nil {
+			log.Debug("ethoFS - unable to record time lock release", "cid", c, "error", err)
+		}
+	}
+}
+
+// release announces the keys of the due locks, and again the recently released
+// ones. Locks on the time wait while the clock is known to be skewed.
+func (w *timeLockWatcher) release(ctx context.Context) {
+	locks, err := timeLocks.list()
+	if err != nil {
+		return
+	}
+	var (
+		now  = w.now()
+		head uint64
+	)
+	for _, l := range locks {
+		if !l.Own {
+			continue
+		}
+		if l.Released == 0 {
+			if l.Block != 0 && head == 0 {
+				if head, err = pinExpiries.currentHead(ctx); err != nil {
+					log.Debug("ethoFS - unable to check time lock height", "error", err)
+					continue
+				}
+			}
+			if l.Block == 0 && currentClockMonitor().skewed() {
+				continue
+			}
+			if !l.due(head, now) {
+				continue
+			}
+			l.Released = uint64(now.Unix())
+			timeLockReleasedMeter.Mark(1)
+			log.Info("ethoFS - releasing time-locked content", "cid", l.Cid)
+		} else {
+			released := time.Unix(int64(l.Released), 0)
+			if now.Sub(released) > timeLockRebroadcastWindow || now.Sub(time.Unix(int64(l.Announced), 0)) < timeLockRebroadcast {
+				continue
+			}
+		}
+		data, err := json.Marshal(timeLockRelease{Cid: l.Cid, Key: l.Keys[0]})
+		if err != nil {
+			continue
+		}
+		if err := w.ipfs.PubSub().Publish(ctx, timeLockTopic, data); err != nil {
+			log.Debug("ethoFS - unable to announce time lock release", "cid", l.Cid, "error", err)
+		} else {
+			l.Announced = uint64(now.Unix())
+		}
+		if err := timeLocks.put(l); err != nil {
+			log.Warn("ethoFS - unable to store time lock release", "cid", l.Cid, "error", err)
+		}
+	}
+}
+
+// AddTimeLocked encrypts the content of r with a fresh key and adds it to the
+// ethoFS node, pinned. The key is released on pubsub once the chain reaches
+// the release block or, without one, at the release unix time. Until then
+// only this node can decrypt the content.
+func (s *EthofsService) AddTimeLocked(ctx context.Context, r io.Reader, block, release uint64) (*TimeLock, error) {
+	if s.config.PubSub.Disabled {
+		return nil, errPubSubDisabled
+	}
+	if (block == 0) == (release == 0) {
+		return nil, errTimeLockRelease
+	}
+	if release != 0 && release <= uint64(time.Now().Unix()) {
+		return nil, errTimeLockReleased
+	}
+	if block != 0 {
+		head, err := pinExpiries.currentHead(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if block <= head {
+			return nil, errTimeLockReleased
+		}
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	defer pr.Close()
+
+	go func() {
+		pw.CloseWithError(sealEnvelope(pw, r, key, nil))
+	}()
+	c, err := s.Add(ctx, pr, AddOptions{Pin: true}, nil)
+	if err != nil {
+		return nil, err
+	}
+	l := &timeLock{Cid: c.String(), Keys: [][]byte{key}, Verified: true, Own: true, Block: block, Time: release}
+	if err := timeLocks.put(l); err != nil {
+		return nil, err
+	}
+	return l.info(), nil
+}
+
+// GetTimeLocked retrieves and decrypts time-locked content once its key was
+// released. Unknown content is watched for the release of its key, without
+// recording it in the repo until a key is announced.
+func (s *EthofsService) GetTimeLocked(ctx context.Context, c cid.Cid) ([]byte, error) {
+	ipfs := s.API()
+	if ipfs == nil {
+		return nil, errNodeNotRunning
+	}
+	l, err := timeLocks.get(c.String())
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		timeLocks.watch(c)
+		return nil, errTimeLocked
+	}
+	// The keys of own content are held until the release
+	if l.Released == 0 {
+		if !l.Own {
+			return nil, errTimeLocked
+		}
+		var head uint64
+		if l.Block != 0 {
+			if head, err = pinExpiries.currentHead(ctx); err != nil {
+				return nil, err
+			}
+		}
+		if l.Block == 0 && currentClockMonitor().skewed() || !l.due(head, time.Now()) {
+			return nil, errTimeLocked
+		}
+	}
+	if len(l.Keys) == 0 {
+		return nil, errTimeLocked
+	}
+	for _, key := range l.Keys {
+		data, err := readTimeLocked(ctx, ipfs, c, key)
+		if err == errEnvelopeCorrupted {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !l.Verified {
+			l.Keys, l.Verified = [][]byte{key}, true
+			if err := timeLocks.put(l); err != nil {
+				log.Debug("ethoFS - unable to store time lock key", "cid", c, "error", err)
+			}
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%w: no released key decrypts the content", errTimeLocked)
+}
+
+// readTimeLocked retrieves the content and decrypts it with the key.
+func readTimeLocked(ctx context.Context, ipfs icore.CoreAPI, c cid.Cid, key []byte) ([]byte, error) {
+	nd, err := ipfs.Unixfs().Get(ctx, path.IpfsPath(c))
+	if err != nil {
+		return nil, err
+	}
+	file := files.ToFile(nd)
+	if file == nil {
+		nd.Close()
+		return nil, fmt.Errorf("%s is not a file", c)
+	}
+	defer file.Close()
+
+	plain, err := openEnvelopeWithKey(newLimitedReader(ctx, file), key)
+	if err != nil {
+		return nil, err
+	}
+	return readLimited(plain)
+}
+
+// TimeLocks returns the time-locked content added or watched by the node.
+func (s *EthofsService) TimeLocks() ([]*TimeLock, error) {
+	locks, err := timeLocks.list()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*TimeLock, 0, len(locks))
+	for _, l := range locks {
+		infos = append(infos, l.info())
+	}
+	return infos, nil
+}
+
+// TimeLockKey returns the released key of time-locked content, once it is
+// known to decrypt it.
+func (s *EthofsService) TimeLockKey(c cid.Cid) ([]byte, error) {
+	l, err := timeLocks.get(c.String())
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return nil, errNoTimeLock
+	}
+	if l.Released == 0 || !l.Verified {
+		return nil, errTimeLocked
+	}
+	return l.Keys[0], nil
+}
+
+// TimeLocks returns the time-locked content added or watched by the node.
+func (api *PublicEthofsAPI) TimeLocks() (_ []*TimeLock, err error) {
+	defer trackCall("timeLocks", time.Now(), &err)
+
+	return api.service.TimeLocks()
+}
+
+// TimeLockKey returns the released decryption key of time-locked content.
+func (api *PublicEthofsAPI) TimeLockKey(hash string) (_ hexutil.Bytes, err error) {
+	defer trackCall("timeLockKey", time.Now(), &err)
+
+	c, err := cid.Parse(hash)
+	if err != nil {
+		return nil, err
+	}
+	return api.service.TimeLockKey(c)
+}
+
+// AddTimeLocked adds the data encrypted, releasing the decryption key at the
+// block height or else the unix time.
+func (api *PrivateEthofsAPI) AddTimeLocked(ctx context.Context, data hexutil.Bytes, block hexutil.Uint64, release hexutil.Uint64) (_ *TimeLock, err error) {
+	defer trackCall("addTimeLocked", time.Now(), &err)
+
+	return api.service.AddTimeLocked(ctx, bytes.NewReader(data), uint64(block), uint64(release))
+}
+
+// GetTimeLocked retrieves and decrypts time-locked content once released.
+func (api *PrivateEthofsAPI) GetTimeLocked(ctx context.Context, hash string) (_ hexutil.Bytes, err error) {
+	defer trackCall("getTimeLocked", time.Now(), &err)
+
+	c, err := cid.Parse(hash)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	return api.service.GetTimeLocked(ctx, c)
+}
@@ -0,0 +1,108 @@
+package ethofs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func TestTimeLockDue(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	tests := []struct {
+		lock timeLock
+		head uint64
+		want bool
+	}{
+		{timeLock{Block: 100}, 99, false},
+		{timeLock{Block: 100}, 100, true},
+		{timeLock{Block: 100}, 0, false}, // unknown head
+		{timeLock{Time: 1600000001}, 0, false},
+		{timeLock{Time: 1600000000}, 0, true},
+	}
+	for i, tt := range tests {
+		if have := tt.lock.due(tt.head, now); have != tt.want {
+			t.Errorf("test %d: due mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
+
+func TestTimeLockKeys(t *testing.T) {
+	l := new(timeLock)
+	for i := 0; i < maxTimeLockKeys; i++ {
+		if !l.addKey(bytes.Repeat([]byte{byte(i)}, 32)) {
+			t.Fatalf("key %d rejected", i)
+		}
+	}
+	if l.addKey(bytes.Repeat([]byte{0}, 32)) {
+		t.Errorf("duplicate key accepted")
+	}
+	if l.addKey(bytes.Repeat([]byte{0xff}, 32)) {
+		t.Errorf("key beyond the limit accepted")
+	}
+	verified := &timeLock{Keys: [][]byte{make([]byte, 32)}, Verified: true}
+	if verified.addKey(bytes.Repeat([]byte{1}, 32)) {
+		t.Errorf("key added to verified lock")
+	}
+}
+
+func TestTimeLockStore(t *testing.T) {
+	store := new(timeLockStore)
+	if _, err := store.get("x"); err != errNodeNotRunning {
+		t.Fatalf("detached store error mismatch: have %v, want %v", err, errNodeNotRunning)
+	}
+	store.attach(datastore.NewMapDatastore())
+	defer store.detach()
+
+	if l, err := store.get("x"); l != nil || err != nil {
+		t.Fatalf("missing lock mismatch: have %v, %v", l, err)
+	}
+	want := &timeLock{Cid: "x", Keys: [][]byte{{1, 2, 3}}, Own: true, Block: 42}
+	if err := store.put(want); err != nil {
+		t.Fatalf("failed to store lock: %v", err)
+	}
+	have, err := store.get("x")
+	if err != nil || have.Block != 42 || !have.Own || !bytes.Equal(have.Keys[0], want.Keys[0]) {
+		t.Fatalf("stored lock mismatch: have %+v (%v), want %+v", have, err, want)
+	}
+	if locks, err := store.list(); err != nil || len(locks) != 1 {
+		t.Errorf("listed locks mismatch: have %d (%v), want 1", len(locks), err)
+	}
+}
+
+func TestGetTimeLocked(t *testing.T) {
+	s, stop := newTestService(t)
+	defer stop()
+
+	timeLocks.attach(datastore.NewMapDatastore())
+	defer timeLocks.detach()
+
+	// Own content stays locked until its release, although the node holds the key
+	ctx := context.Background()
+	release := uint64(time.Now().Add(time.Hour).Unix())
+	l, err := s.AddTimeLocked(ctx, bytes.NewReader([]byte("sealed")), 0, release)
+	if err != nil {
+		t.Fatalf("failed to add time-locked content: %v", err)
+	}
+	c := merkledag.NodeWithData([]byte("unknown")).Cid()
+	for _, hash := range []string{l.Cid, c.String()} {
+		lc, err := cid.Decode(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetTimeLocked(ctx, lc); err != errTimeLocked {
+			t.Errorf("%s: have %v, want %v", hash, err, errTimeLocked)
+		}
+	}
+	// Unknown content is watched without being recorded
+	if locks, err := timeLocks.list(); err != nil || len(locks) != 1 {
+		t.Errorf("recorded locks mismatch: have %d (%v), want 1", len(locks), err)
+	}
+	if !timeLocks.watched(c) {
+		t.Errorf("unknown content not watched")
+	}
+}
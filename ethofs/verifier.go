@@ -0,0 +1,413 @@
+package ethofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-ipfs/core"
+	merkledag "github.com/ipfs/go-merkledag"
+	icore "github.com/ipfs/interface-go-ipfs-core"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	defaultVerifyInterval = time.Hour
+	defaultVerifyTargets  = 16
+	defaultVerifySamples  = 4
+
+	// maxVerifyLists caps the pin lists of the hosting contract scanned for
+	// hosted content in a round.
+	maxVerifyLists = 32
+
+	// maxVerifyDepth bounds the descent into a DAG, guarding against cycles
+	// of corrupted blocks.
+	maxVerifyDepth = 64
+
+	verifyListTimeout   = 15 * time.Second
+	verifySubmitTimeout = time.Minute
+)
+
+// HostingProofABI is the interface of the contract the results of the
+// availability checks are submitted to.
+const HostingProofABI = "[{\"constant\":false,\"inputs\":[{\"name\":\"cids\",\"type\":\"string[]\"},{\"name\":\"hosted\",\"type\":\"bool[]\"}],\"name\":\"submitProof\",\"outputs\":[],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"}]"
+
+var (
+	errBlockCorrupt = errors.New("block content does not match its CID")
+	errDAGTooDeep   = errors.New("DAG exceeds maximum verification depth")
+	errNoVerifier   = errors.New("availability verifier not enabled")
+)
+
+var (
+	verifyPassedMeter = metrics.NewRegisteredMeter("ethofs/verifier/passed", nil)
+	verifyFailedMeter = metrics.NewRegisteredMeter("ethofs/verifier/failed", nil)
+)
+
+// VerifierConfig configures the periodic proof-of-hosting checks of the
+// content the node pinned for the hosting contract.
+type VerifierConfig struct {
+	// Enabled turns the periodic checks on.
+	Enabled bool `toml:",omitempty"`
+
+	// Interval is the time between two verification rounds.
+	Interval time.Duration `toml:",omitempty"`
+
+	// Targets is the number of hosted CIDs checked per round.
+	Targets int `toml:",omitempty"`
+
+	// Samples is the number of random root-to-leaf paths checked per CID.
+	Samples int `toml:",omitempty"`
+
+	// ProofContract is the address of the contract the results of every
+	// round are submitted to. If empty, results are only logged and reported
+	// through ethofs_verification.
+	ProofContract string `toml:",omitempty"`
+
+	// Account signs the proof transactions. It has to be unlocked in the
+	// account manager of the node.
+	Account string `toml:",omitempty"`
+}
+
+// HostingProof is the outcome of the spot check of a single CID.
+type HostingProof struct {
+	Cid    string `json:"cid"`
+	Hosted bool   `json:"hosted"`
+	Blocks int    `json:"blocks"`
+	Error  string `json:"error,omitempty"`
+}
+
+// VerificationReport is the result of a verification round.
+type VerificationReport struct {
+	Time        time.Time      `json:"time"`
+	Proofs      []HostingProof `json:"proofs"`
+	Passed      int            `json:"passed"`
+	Failed      int            `json:"failed"`
+	Transaction *common.Hash   `json:"transaction,omitempty"`
+	SubmitError string         `json:"submitError,omitempty"`
+}
+
+// spotCheck verifies that the DAG below root is available locally by walking
+// random paths from the root to a leaf. Every block on the way has to be in
+// the blockstore and match its CID. It returns the number of blocks checked.
+func spotCheck(ctx context.Context, bs blockstore.Blockstore, root cid.Cid, samples int, rnd *rand.Rand) (int, error) {
+	var checked int
+	for i := 0; i < samples; i++ {
+		c := root
+		for depth := 0; ; depth++ {
+			if depth > maxVerifyDepth {
+				return checked, errDAGTooDeep
+			}
+			if err := ctx.Err(); err != nil {
+				return checked, err
+			}
+			blk, err := bs.Get(c)
+			if err != nil {
+				return checked, fmt.Errorf("block %s: %v", c, err)
+			}
+			if sum, err := c.Prefix().Sum(blk.RawData()); err != nil || !sum.Equals(c) {
+				return checked, fmt.Errorf("block %s: %v", c, errBlockCorrupt)
+			}
+			checked++
+
+			// Only unixfs DAGs are descended, raw leaves have no links
+			if c.Type() != cid.DagProtobuf {
+				break
+			}
+			nd, err := merkledag.DecodeProtobufBlock(blk)
+			if err != nil {
+				return checked, fmt.Errorf("block %s: %v", c, err)
+			}
+			links := nd.Links()
+			if len(links) == 0 {
+				break
+			}
+			c = links[rnd.Intn(len(links))].Cid
+		}
+	}
+	return checked, nil
+}
+
+// availabilityVerifier periodically spot checks the content this node hosts
+// for the hosting contract and reports the results, optionally as a signed
+// transaction to the proof contract.
+type availabilityVerifier struct {
+	api      icore.CoreAPI
+	node     *core.IpfsNode
+	accounts *accounts.Manager
+	cfg      VerifierConfig
+
+	lock sync.Mutex
+	rand *rand.Rand
+	last *VerificationReport
+}
+
+func newAvailabilityVerifier(api icore.CoreAPI, node *core.IpfsNode, am *accounts.Manager, cfg *VerifierConfig) *availabilityVerifier {
+	v := &availabilityVerifier{
+		api:      api,
+		node:     node,
+		accounts: am,
+		cfg:      *cfg,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if v.cfg.Interval == 0 {
+		v.cfg.Interval = defaultVerifyInterval
+	}
+	if v.cfg.Targets == 0 {
+		v.cfg.Targets = defaultVerifyTargets
+	}
+	if v.cfg.Samples == 0 {
+		v.cfg.Samples = defaultVerifySamples
+	}
+	return v
+}
+
+// loop runs a verification round every interval until the context is
+// cancelled.
+func (v *availabilityVerifier) loop(ctx context.Context) {
+	ticker := time.NewTicker(v.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			v.round(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// round checks a sample of the hosted content and reports the results.
+func (v *availabilityVerifier) round(ctx context.Context) *VerificationReport {
+	targets, err := v.hostedTargets(ctx)
+	if err != nil {
+		log.Debug("ethoFS - unable to load hosted content for verification", "error", err)
+		return nil
+	}
+	report := &VerificationReport{Time: time.Now(), Proofs: v.verify(ctx, targets)}
+	for _, proof := range report.Proofs {
+		if proof.Hosted {
+			report.Passed++
+		} else {
+			report.Failed++
+			log.Warn("ethoFS - hosted content failed availability check", "cid", proof.Cid, "error", proof.Error)
+		}
+	}
+	verifyPassedMeter.Mark(int64(report.Passed))
+	verifyFailedMeter.Mark(int64(report.Failed))
+
+	if v.cfg.ProofContract != "" && len(report.Proofs) > 0 {
+		hash, err := v.submit(ctx, report.Proofs)
+		if err != nil {
+			report.SubmitError = err.Error()
+			log.Warn("ethoFS - hosting proof submission failed", "error", err)
+		} else {
+			report.Transaction = &hash
+			log.Info("ethoFS - hosting proof submitted", "tx", hash)
+		}
+	}
+	log.Info("ethoFS - availability verification complete", "passed", report.Passed, "failed", report.Failed)
+
+	v.lock.Lock()
+	v.last = report
+	v.lock.Unlock()
+	return report
+}
+
+// verify spot checks the given CIDs.
+func (v *availabilityVerifier) verify(ctx context.Context, cids []cid.Cid) []HostingProof {
+	proofs := make([]HostingProof, 0, len(cids))
+	for _, c := range cids {
+		v.lock.Lock()
+		rnd := rand.New(rand.NewSource(v.rand.Int63()))
+		v.lock.Unlock()
+
+		checked, err := spotCheck(ctx, v.node.Blockstore, c, v.cfg.Samples, rnd)
+		proof := HostingProof{Cid: c.String(), Hosted: err == nil, Blocks: checked}
+		if err != nil {
+			proof.Error = err.Error()
+		}
+		proofs = append(proofs, proof)
+	}
+	return proofs
+}
+
+// hostedTargets samples the pin lists of the hosting contract and returns up
+// to the configured number of the listed CIDs this node has pinned.
+func (v *availabilityVerifier) hostedTargets(ctx context.Context) ([]cid.Cid, error) {
+	if ethClient == nil {
+		return nil, errNoEthClient
+	}
+	contract, err := NewPinStorage(pinStorageAddress, ethClient)
+	if err != nil {
+		return nil, err
+	}
+	opts := &bind.CallOpts{Context: ctx}
+	count, err := contract.PinCount(opts)
+	if err != nil || count == 0 {
+		return nil, err
+	}
+	v.lock.Lock()
+	offset := uint32(v.rand.Int63n(int64(count)))
+	v.lock.Unlock()
+
+	var (
+		targets []cid.Cid
+		seen    = make(map[cid.Cid]bool)
+	)
+	for i := uint32(0); i < count && i < maxVerifyLists && len(targets) < v.cfg.Targets; i++ {
+		list, err := contract.Pins(opts, new(big.Int).SetUint64(uint64((offset+i)%count)))
+		if err != nil {
+			return nil, err
+		}
+		hashes, err := v.pinList(ctx, list)
+		if err != nil {
+			log.Debug("ethoFS - unable to load pin list for verification", "hash", list, "error", err)
+			continue
+		}
+		for _, hash := range hashes {
+			c, err := cid.Decode(hash)
+			if err != nil || seen[c] {
+				continue
+			}
+			seen[c] = true
+			if _, pinned, err := v.node.Pinning.IsPinned(ctx, c); err == nil && pinned {
+				targets = append(targets, c)
+			}
+		}
+	}
+	if len(targets) > v.cfg.Targets {
+		v.lock.Lock()
+		v.rand.Shuffle(len(targets), func(i, j int) { targets[i], targets[j] = targets[j], targets[i] })
+		v.lock.Unlock()
+		targets = targets[:v.cfg.Targets]
+	}
+	return targets, nil
+}
+
+// pinList retrieves a serialized pin list of the hosting contract.
+func (v *availabilityVerifier) pinList(ctx context.Context, hash string) ([]string, error) {
+	c, err := cid.Parse(hash)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, verifyListTimeout)
+	defer cancel()
+
+	data, err := readFile(ctx, v.api, path.IpfsPath(c), maxGetSize)
+	if err != nil {
+		return nil, err
+	}
+	return scanForCids(data), nil
+}
+
+// submit sends the proofs to the proof contract in a transaction signed by the
+// configured account. Nothing is signed while the clock is skewed.
+func (v *availabilityVerifier) submit(ctx context.Context, proofs []HostingProof) (common.Hash, error) {
+	if err := checkSigningClock(); err != nil {
+		return common.Hash{}, err
+	}
+	if ethClient == nil {
+		return common.Hash{}, errNoEthClient
+	}
+	parsed, err := abi.JSON(strings.NewReader(HostingProofABI))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	account := accounts.Account{Address: common.HexToAddress(v.cfg.Account)}
+	wallet, err := v.accounts.Find(account)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, verifySubmitTimeout)
+	defer cancel()
+
+	chainID, err := ethClient.ChainID(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var (
+		cids   = make([]string, len(proofs))
+		hosted = make([]bool, len(proofs))
+	)
+	for i, proof := range proofs {
+		cids[i], hosted[i] = proof.Cid, proof.Hosted
+	}
+	contract := bind.NewBoundContract(common.HexToAddress(v.cfg.ProofContract), parsed, ethClient, ethClient, nil)
+	tx, err := contract.Transact(&bind.TransactOpts{
+		From:    account.Address,
+		Context: ctx,
+		Signer: func(signer types.Signer, addr common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			return wallet.SignTx(accounts.Account{Address: addr}, tx, chainID)
+		},
+	}, "submitProof", cids, hosted)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return tx.Hash(), nil
+}
+
+// report returns the result of the last verification round.
+func (v *availabilityVerifier) report() *VerificationReport {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return v.last
+}
+
+// VerifyHosting spot checks that the DAGs of the given CIDs are completely
+// available in the local repo, without fetching anything from the swarm.
+func (s *EthofsService) VerifyHosting(ctx context.Context, cids []cid.Cid) ([]HostingProof, error) {
+	node := s.Node()
+	if node == nil {
+		return nil, errNodeNotRunning
+	}
+	samples := s.config.Verifier.Samples
+	if samples == 0 {
+		samples = defaultVerifySamples
+	}
+	v := newAvailabilityVerifier(s.API(), node, s.stack.AccountManager(), &VerifierConfig{Samples: samples})
+	return v.verify(ctx, cids), nil
+}
+
+// Verification returns the report of the last periodic verification round,
+// or nil if no round completed yet.
+func (api *PublicEthofsAPI) Verification() (_ *VerificationReport, err error) {
+	defer trackCall("verification", time.Now(), &err)
+
+	v := api.service.availabilityVerifier()
+	if v == nil {
+		return nil, errNoVerifier
+	}
+	return v.report(), nil
+}
+
+// VerifyHosting spot checks the local availability of the given CIDs.
+func (api *PrivateEthofsAPI) VerifyHosting(ctx context.Context, hashes []string) (_ []HostingProof, err error) {
+	defer trackCall("verifyHosting", time.Now(), &err)
+
+	cids := make([]cid.Cid, 0, len(hashes))
+	for _, hash := range hashes {
+		c, err := cid.Decode(hash)
+		if err != nil {
+			return nil, err
+		}
+		cids = append(cids, c)
+	}
+	return api.service.VerifyHosting(ctx, cids)
+}
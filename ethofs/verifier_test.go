@@ -0,0 +1,65 @@
+package ethofs
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func TestSpotCheck(t *testing.T) {
+	bs := blockstore.NewBlockstore(dsync.MutexWrap(datastore.NewMapDatastore()))
+
+	// Build a two level DAG of a root linking to raw and dag-pb leaves
+	rawCid, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1}.Sum([]byte("raw leaf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := blocks.NewBlockWithCid([]byte("raw leaf"), rawCid)
+	leaf := merkledag.NodeWithData([]byte("unixfs leaf"))
+	root := merkledag.NodeWithData(nil)
+	if err := root.AddRawLink("raw", &ipld.Link{Cid: raw.Cid()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []blocks.Block{raw, leaf, root} {
+		if err := bs.Put(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	rnd := rand.New(rand.NewSource(1))
+
+	checked, err := spotCheck(ctx, bs, root.Cid(), 8, rnd)
+	if err != nil {
+		t.Fatalf("complete DAG failed check: %v", err)
+	}
+	if checked != 16 {
+		t.Errorf("checked block count mismatch: have %d, want 16", checked)
+	}
+	// Dropping a leaf has to be detected by enough samples
+	if err := bs.DeleteBlock(leaf.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := spotCheck(ctx, bs, root.Cid(), 16, rnd); err == nil {
+		t.Error("missing block not detected")
+	}
+	// Corrupted content must not pass as hosted
+	corrupt, _ := blocks.NewBlockWithCid([]byte("tampered"), leaf.Cid())
+	if err := bs.Put(corrupt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := spotCheck(ctx, bs, root.Cid(), 16, rnd); err == nil {
+		t.Error("corrupted block not detected")
+	}
+}
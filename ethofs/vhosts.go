@@ -0,0 +1,130 @@
+package ethofs
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+)
+
+// gatewayHosts maps custom domains to the hosted site roots served for them.
+var gatewayHosts = newVirtualHosts()
+
+// virtualHosts is a concurrent safe hostname to site root mapping.
+type virtualHosts struct {
+	lock  sync.RWMutex
+	roots map[string]string
+}
+
+func newVirtualHosts() *virtualHosts {
+	return &virtualHosts{roots: make(map[string]string)}
+}
+
+// normalizeHost lowercases a hostname and strips any port from it.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// normalizeSiteRoot turns a bare CID into an /ipfs/ path and validates that
+// other roots are /ipfs/ or /ipns/ paths.
+func normalizeSiteRoot(root string) (string, error) {
+	root = strings.TrimSuffix(root, "/")
+	if c, err := cid.Decode(root); err == nil {
+		return "/ipfs/" + c.String(), nil
+	}
+	if ns, name, rest := splitContentPath(root); name != "" && rest == "/" {
+		return ns + "/" + name, nil
+	}
+	return "", fmt.Errorf("invalid site root %q", root)
+}
+
+// set maps the hostname to the given site root.
+func (v *virtualHosts) set(host, root string) error {
+	host = normalizeHost(host)
+	if host == "" {
+		return fmt.Errorf("empty hostname")
+	}
+	root, err := normalizeSiteRoot(root)
+	if err != nil {
+		return err
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.roots[host] = root
+	return nil
+}
+
+// remove drops the mapping of the hostname, reporting whether it existed.
+func (v *virtualHosts) remove(host string) bool {
+	host = normalizeHost(host)
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	_, ok := v.roots[host]
+	delete(v.roots, host)
+	return ok
+}
+
+// reset replaces all mappings with the given ones.
+func (v *virtualHosts) reset(hosts map[string]string) error {
+	roots := make(map[string]string, len(hosts))
+	for host, root := range hosts {
+		normalized, err := normalizeSiteRoot(root)
+		if err != nil {
+			return err
+		}
+		roots[normalizeHost(host)] = normalized
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.roots = roots
+	return nil
+}
+
+// lookup returns the site root mapped to the hostname.
+func (v *virtualHosts) lookup(host string) (string, bool) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	root, ok := v.roots[normalizeHost(host)]
+	return root, ok
+}
+
+// list returns a copy of all mappings.
+func (v *virtualHosts) list() map[string]string {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	hosts := make(map[string]string, len(v.roots))
+	for host, root := range v.roots {
+		hosts[host] = root
+	}
+	return hosts
+}
+
+// virtualHostOption rewrites requests for mapped hostnames into the content
+// path of the site root, so the gateway handlers after it serve the site.
+func virtualHostOption(hosts *virtualHosts) corehttp.ServeOption {
+	return func(_ *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if root, ok := hosts.lookup(r.Host); ok {
+				r.URL.Path = root + r.URL.Path
+				r.URL.RawPath = ""
+			}
+			childMux.ServeHTTP(w, r)
+		})
+		return childMux, nil
+	}
+}
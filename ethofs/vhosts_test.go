@@ -0,0 +1,81 @@
+package ethofs
+
+import "testing"
+
+func TestVirtualHosts(t *testing.T) {
+	hosts := newVirtualHosts()
+
+	root := "QmRwQ49Zknc2dQbywrhT8ArMDS9JdmnEyGGy4mZ1wDkgaX"
+	if err := hosts.set("Example.COM", root); err != nil {
+		t.Fatalf("failed to set host: %v", err)
+	}
+	if err := hosts.set("site.org", "/ipns/site.org/"); err != nil {
+		t.Fatalf("failed to set host: %v", err)
+	}
+	if err := hosts.set("bad.org", "not-a-root"); err == nil {
+		t.Errorf("expected error for invalid root")
+	}
+	if have, ok := hosts.lookup("example.com:8080"); !ok || have != "/ipfs/"+root {
+		t.Errorf("lookup mismatch: have (%q, %v)", have, ok)
+	}
+	if have, ok := hosts.lookup("site.org"); !ok || have != "/ipns/site.org" {
+		t.Errorf("lookup mismatch: have (%q, %v)", have, ok)
+	}
+	if !hosts.remove("EXAMPLE.com") {
+		t.Errorf("expected host to be removed")
+	}
+	if _, ok := hosts.lookup("example.com"); ok {
+		t.Errorf("removed host still mapped")
+	}
+	if err := hosts.reset(map[string]string{"a.org": root}); err != nil {
+		t.Fatalf("failed to reset hosts: %v", err)
+	}
+	if list := hosts.list(); len(list) != 1 || list["a.org"] != "/ipfs/"+root {
+		t.Errorf("unexpected mappings after reset: %v", list)
+	}
+}
+
+func TestPathWhitelist(t *testing.T) {
+	root := "QmRwQ49Zknc2dQbywrhT8ArMDS9JdmnEyGGy4mZ1wDkgaX"
+	list, err := newPathWhitelist([]string{root, "/ipns/site.org/public/"})
+	if err != nil {
+		t.Fatalf("failed to create whitelist: %v", err)
+	}
+	tests := map[string]bool{
+		"/ipfs/" + root:                   true,
+		"/ipfs/" + root + "/a/b.html":     true,
+		"/ipfs/" + root + "x":             false,
+		"/ipns/site.org/public":           true,
+		"/ipns/site.org/public/app.js":    true,
+		"/ipns/site.org/private/app.js":   false,
+		"/ipfs/QmOtherRootNotWhitelisted": false,
+	}
+	for p, want := range tests {
+		if have := list.allowed(p); have != want {
+			t.Errorf("%s: have %v, want %v", p, have, want)
+		}
+	}
+	if _, err := newPathWhitelist([]string{"/etc/passwd"}); err == nil {
+		t.Errorf("expected error for invalid path")
+	}
+}
+
+func TestGatewayMultiaddr(t *testing.T) {
+	tests := map[string]string{
+		":8080":                "/ip4/0.0.0.0/tcp/8080",
+		"127.0.0.1:8080":       "/ip4/127.0.0.1/tcp/8080",
+		"[::1]:80":             "/ip6/::1/tcp/80",
+		"/ip4/10.0.0.1/tcp/81": "/ip4/10.0.0.1/tcp/81",
+	}
+	for addr, want := range tests {
+		have, err := gatewayMultiaddr(addr)
+		if err != nil || have != want {
+			t.Errorf("%s: have (%q, %v), want %q", addr, have, err, want)
+		}
+	}
+	for _, addr := range []string{"localhost:8080", "127.0.0.1", ":99999"} {
+		if _, err := gatewayMultiaddr(addr); err == nil {
+			t.Errorf("%s: expected error", addr)
+		}
+	}
+}
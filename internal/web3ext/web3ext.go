@@ -18,24 +18,480 @@
 package web3ext
 
 var Modules = map[string]string{
-	"accounting": AccountingJs,
-	"admin":      AdminJs,
-	"chequebook": ChequebookJs,
-	"clique":     CliqueJs,
-	"ethash":     EthashJs,
-	"debug":      DebugJs,
-	"eth":        EthJs,
-	"miner":      MinerJs,
-	"net":        NetJs,
-	"personal":   PersonalJs,
-	"rpc":        RpcJs,
-	"shh":        ShhJs,
-	"swarmfs":    SwarmfsJs,
-	"txpool":     TxpoolJs,
-	"les":        LESJs,
-	"lespay":     LESPayJs,
+	"accounting":  AccountingJs,
+	"admin":       AdminJs,
+	"chequebook":  ChequebookJs,
+	"clique":      CliqueJs,
+	"ethash":      EthashJs,
+	"ethofs":      EthofsJs,
+	"ethofsadmin": EthofsadminJs,
+	"debug":       DebugJs,
+	"eth":         EthJs,
+	"miner":       MinerJs,
+	"net":         NetJs,
+	"personal":    PersonalJs,
+	"rpc":         RpcJs,
+	"shh":         ShhJs,
+	"swarmfs":     SwarmfsJs,
+	"txpool":      TxpoolJs,
+	"les":         LESJs,
+	"lespay":      LESPayJs,
 }
 
+const EthofsadminJs = `
+web3._extend({
+	property: 'ethofsadmin',
+	methods: [
+		new web3._extend.Method({
+			name: 'add',
+			call: 'ethofsadmin_add',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'pin',
+			call: 'ethofsadmin_pin',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'unpin',
+			call: 'ethofsadmin_unpin',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'setVirtualHost',
+			call: 'ethofsadmin_setVirtualHost',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'removeVirtualHost',
+			call: 'ethofsadmin_removeVirtualHost',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'gc',
+			call: 'ethofsadmin_gC',
+			params: 0
+		}),
+		new web3._extend.Method({
+			name: 'publishIPNS',
+			call: 'ethofsadmin_publishIPNS',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'createKey',
+			call: 'ethofsadmin_createKey',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getDecrypted',
+			call: 'ethofsadmin_getDecrypted',
+			params: 3
+		}),
+		new web3._extend.Method({
+			name: 'connect',
+			call: 'ethofsadmin_connect',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'disconnect',
+			call: 'ethofsadmin_disconnect',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'denyPeer',
+			call: 'ethofsadmin_denyPeer',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'allowPeer',
+			call: 'ethofsadmin_allowPeer',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'addWithReceipt',
+			call: 'ethofsadmin_addWithReceipt',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'reconcile',
+			call: 'ethofsadmin_reconcile',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'configRollback',
+			call: 'ethofsadmin_configRollback',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'hostingReport',
+			call: 'ethofsadmin_hostingReport',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'signContent',
+			call: 'ethofsadmin_signContent',
+			params: 3
+		}),
+		new web3._extend.Method({
+			name: 'proveIntegrity',
+			call: 'ethofsadmin_proveIntegrity',
+			params: 0
+		}),
+		new web3._extend.Method({
+			name: 'exportTree',
+			call: 'ethofsadmin_exportTree',
+			params: 3
+		}),
+		new web3._extend.Method({
+			name: 'stopExport',
+			call: 'ethofsadmin_stopExport',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'filesMkdir',
+			call: 'ethofsadmin_filesMkdir',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'filesWrite',
+			call: 'ethofsadmin_filesWrite',
+			params: 3
+		}),
+		new web3._extend.Method({
+			name: 'filesCp',
+			call: 'ethofsadmin_filesCp',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'filesFlush',
+			call: 'ethofsadmin_filesFlush',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'bootstrap',
+			call: 'ethofsadmin_bootstrap',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'verifyHosting',
+			call: 'ethofsadmin_verifyHosting',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'purgeNotFound',
+			call: 'ethofsadmin_purgeNotFound',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'addEncrypted',
+			call: 'ethofsadmin_addEncrypted',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'pinQuorum',
+			call: 'ethofsadmin_pinQuorum',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'migrate',
+			call: 'ethofsadmin_migrate',
+			params: 3
+		}),
+		new web3._extend.Method({
+			name: 'listPins',
+			call: 'ethofsadmin_listPins',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'createSharedFolder',
+			call: 'ethofsadmin_createSharedFolder',
+			params: 4
+		}),
+		new web3._extend.Method({
+			name: 'joinSharedFolder',
+			call: 'ethofsadmin_joinSharedFolder',
+			params: 3
+		}),
+		new web3._extend.Method({
+			name: 'sharedFolderRead',
+			call: 'ethofsadmin_sharedFolderRead',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'sharedFolderWrite',
+			call: 'ethofsadmin_sharedFolderWrite',
+			params: 3
+		}),
+		new web3._extend.Method({
+			name: 'sharedFolderRemove',
+			call: 'ethofsadmin_sharedFolderRemove',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'leaveSharedFolder',
+			call: 'ethofsadmin_leaveSharedFolder',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'addTimeLocked',
+			call: 'ethofsadmin_addTimeLocked',
+			params: 3,
+			inputFormatter: [null, web3._extend.utils.fromDecimal, web3._extend.utils.fromDecimal]
+		}),
+		new web3._extend.Method({
+			name: 'getTimeLocked',
+			call: 'ethofsadmin_getTimeLocked',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'publishVersion',
+			call: 'ethofsadmin_publishVersion',
+			params: 3
+		}),
+		new web3._extend.Method({
+			name: 'rollbackSite',
+			call: 'ethofsadmin_rollbackSite',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'extendPin',
+			call: 'ethofsadmin_extendPin',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'fetch',
+			call: 'ethofsadmin_fetch',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'goOnline',
+			call: 'ethofsadmin_goOnline',
+			params: 0
+		}),
+	]
+});
+`
+
+const EthofsJs = `
+web3._extend({
+	property: 'ethofs',
+	methods: [
+		new web3._extend.Method({
+			name: 'get',
+			call: 'ethofs_get',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'gcPreview',
+			call: 'ethofs_gCPreview',
+			params: 0
+		}),
+		new web3._extend.Method({
+			name: 'resolveIPNS',
+			call: 'ethofs_resolveIPNS',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'publish',
+			call: 'ethofs_publish',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'listPins',
+			call: 'ethofs_listPins',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'pinSize',
+			call: 'ethofs_pinSize',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'verifyReceipt',
+			call: 'ethofs_verifyReceipt',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'peers',
+			call: 'ethofs_peers',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'ls',
+			call: 'ethofs_ls',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'objectStat',
+			call: 'ethofs_objectStat',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'history',
+			call: 'ethofs_history',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'providers',
+			call: 'ethofs_providers',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'dedupStat',
+			call: 'ethofs_dedupStat',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'selfTest',
+			call: 'ethofs_selfTest',
+			params: 0
+		}),
+		new web3._extend.Method({
+			name: 'configHistory',
+			call: 'ethofs_configHistory',
+			params: 1,
+			inputFormatter: [null]
+		}),
+		new web3._extend.Method({
+			name: 'verifyHostingReport',
+			call: 'ethofs_verifyHostingReport',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'filesRead',
+			call: 'ethofs_filesRead',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'filesLs',
+			call: 'ethofs_filesLs',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'filesStat',
+			call: 'ethofs_filesStat',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'sharedFolderLs',
+			call: 'ethofs_sharedFolderLs',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'timeLockKey',
+			call: 'ethofs_timeLockKey',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'verifyContent',
+			call: 'ethofs_verifyContent',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'credit',
+			call: 'ethofs_credit',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'listVersions',
+			call: 'ethofs_listVersions',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
+	],
+	properties: [
+		new web3._extend.Property({
+			name: 'repoStat',
+			getter: 'ethofs_repoStat'
+		}),
+		new web3._extend.Property({
+			name: 'virtualHosts',
+			getter: 'ethofs_virtualHosts'
+		}),
+		new web3._extend.Property({
+			name: 'slo',
+			getter: 'ethofs_slo'
+		}),
+		new web3._extend.Property({
+			name: 'dialFailures',
+			getter: 'ethofs_dialFailures'
+		}),
+		new web3._extend.Property({
+			name: 'clock',
+			getter: 'ethofs_clock'
+		}),
+		new web3._extend.Property({
+			name: 'telemetry',
+			getter: 'ethofs_telemetry'
+		}),
+		new web3._extend.Property({
+			name: 'plugins',
+			getter: 'ethofs_plugins'
+		}),
+		new web3._extend.Property({
+			name: 'sharedFolders',
+			getter: 'ethofs_sharedFolders'
+		}),
+		new web3._extend.Property({
+			name: 'timeLocks',
+			getter: 'ethofs_timeLocks'
+		}),
+		new web3._extend.Property({
+			name: 'credits',
+			getter: 'ethofs_credits'
+		}),
+		new web3._extend.Property({
+			name: 'sites',
+			getter: 'ethofs_sites'
+		}),
+		new web3._extend.Property({
+			name: 'chain',
+			getter: 'ethofs_chain'
+		}),
+		new web3._extend.Property({
+			name: 'allowlist',
+			getter: 'ethofs_allowlist'
+		}),
+		new web3._extend.Property({
+			name: 'integrityProof',
+			getter: 'ethofs_integrityProof'
+		}),
+		new web3._extend.Property({
+			name: 'exports',
+			getter: 'ethofs_exports'
+		}),
+		new web3._extend.Property({
+			name: 'keys',
+			getter: 'ethofs_keys'
+		}),
+		new web3._extend.Property({
+			name: 'verification',
+			getter: 'ethofs_verification'
+		}),
+		new web3._extend.Property({
+			name: 'startup',
+			getter: 'ethofs_startup'
+		}),
+		new web3._extend.Property({
+			name: 'reprovide',
+			getter: 'ethofs_reprovide'
+		}),
+		new web3._extend.Property({
+			name: 'deniedPeers',
+			getter: 'ethofs_deniedPeers'
+		}),
+		new web3._extend.Property({
+			name: 'pinExpiries',
+			getter: 'ethofs_pinExpiries'
+		}),
+		new web3._extend.Property({
+			name: 'status',
+			getter: 'ethofs_status'
+		}),
+	]
+});
+`
+
 const ChequebookJs = `
 web3._extend({
 	property: 'chequebook',